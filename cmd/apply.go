@@ -2,24 +2,33 @@ package cmd
 
 import (
 	"bindiff/core"
+	"bindiff/pkg/config"
+	"bindiff/pkg/i18n"
 	"bindiff/pkg/logger"
+	"bindiff/pkg/progress"
 	"bindiff/pkg/utils"
+	"bindiff/types"
+	"bufio"
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"time"
 
 	"github.com/spf13/cobra"
 )
 
-// ApplyCommand 创建应用补丁命令（增强版）
-func ApplyCommand() *cobra.Command {
+// ApplyCommand 创建应用补丁命令（增强版），流式应用时使用配置中的 IO 提示
+func ApplyCommand(getConfig func() *config.Config) *cobra.Command {
 	var (
 		outFile      string
 		showProgress bool
 		verifyResult bool
 		backupOrig   bool
 		timeout      time.Duration
+		opID         string
+		asJSON       bool
 	)
 
 	cmd := &cobra.Command{
@@ -32,12 +41,27 @@ func ApplyCommand() *cobra.Command {
 - Detailed error reporting and logging`,
 		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runApply(args[0], args[1], ApplyOptions{
+			id, err := startOperation(opID)
+			if err != nil {
+				return err
+			}
+			// 未指定 --backup 时使用配置项 backup_original
+			if cfg := getConfig(); cfg != nil && !cmd.Flags().Changed("backup") {
+				backupOrig = cfg.BackupOriginal
+			}
+			options := &ApplyOptions{
 				OutputFile:     outFile,
 				ShowProgress:   showProgress,
 				VerifyResult:   verifyResult,
 				BackupOriginal: backupOrig,
 				Timeout:        timeout,
+				Config:         getConfig(),
+				OperationID:    id,
+				JSON:           asJSON,
+				Context:        cmd.Context(),
+			}
+			return auditApply(options.Config, args[0], args[1], options, func() error {
+				return runApply(args[0], args[1], options)
 			})
 		},
 	}
@@ -46,8 +70,10 @@ func ApplyCommand() *cobra.Command {
 	cmd.Flags().StringVarP(&outFile, "output", "o", "", "Output file name (default: from patch metadata)")
 	cmd.Flags().BoolVar(&showProgress, "progress", true, "Show progress bar")
 	cmd.Flags().BoolVar(&verifyResult, "verify", true, "Verify result file hash")
-	cmd.Flags().BoolVar(&backupOrig, "backup", false, "Backup original file")
+	cmd.Flags().BoolVar(&backupOrig, "backup", false, "Backup original file to OLD.backup.<time>, pruned per backup.keep/backup.max_age_days (see restore)")
 	cmd.Flags().DurationVar(&timeout, "timeout", 0, "Operation timeout (0 = no timeout)")
+	cmd.Flags().StringVar(&opID, "op-id", "", "Operation ID attached to every log line and the audit record (default: $BINDIFF_OPERATION_ID or random)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the result as JSON on stdout (logs go to stderr)")
 
 	return cmd
 }
@@ -59,11 +85,20 @@ type ApplyOptions struct {
 	VerifyResult   bool
 	BackupOriginal bool
 	Timeout        time.Duration
+	// Config 提供流式应用的 IO 提示与缓冲区大小，nil 时使用默认配置
+	Config *config.Config
+	// OperationID 本次操作的 ID，写入 --json 输出与审计记录
+	OperationID string
+	// JSON 以 JSON 输出结果
+	JSON bool
+	// Context 命令的上下文，收到中断信号时取消；nil 时使用 context.Background()
+	Context context.Context
 }
 
-// runApply 执行补丁应用操作
-func runApply(oldPath, patchPath string, options ApplyOptions) error {
-	start := time.Now()
+// runApply 执行补丁应用操作，未指定输出文件时把补丁中的文件名填入 options.OutputFile
+func runApply(oldPath, patchPath string, options *ApplyOptions) error {
+	stats := startStats()
+	defer stats.stop()
 	logger.Infof("Starting apply operation: %s + %s", oldPath, patchPath)
 
 	// 1. 验证文件存在
@@ -74,16 +109,21 @@ func runApply(oldPath, patchPath string, options ApplyOptions) error {
 	// 2. 备份原文件（如果需要）
 	if options.BackupOriginal {
 		logger.Info("Creating backup of original file...")
-		if err := utils.BackupFile(oldPath); err != nil {
-			logger.Warnf("Failed to backup original file: %v", err)
-		}
+		backupOriginal(oldPath, options.Config)
 	}
 
-	// 3. 读取文件
-	oldData, err := os.ReadFile(oldPath)
+	// 原始格式的补丁流式应用，不在内存中缓冲结果
+	if streamed, err := applyStream(oldPath, patchPath, options, stats); streamed {
+		return err
+	}
+
+	// 3. 读取文件（原文件以内存映射打开）
+	oldFile, err := utils.MapFile(oldPath)
 	if err != nil {
 		return fmt.Errorf("failed to read old file: %w", err)
 	}
+	defer oldFile.Close()
+	oldData := oldFile.Bytes()
 
 	patchBytes, err := os.ReadFile(patchPath)
 	if err != nil {
@@ -93,6 +133,10 @@ func runApply(oldPath, patchPath string, options ApplyOptions) error {
 	logger.Infof("File sizes: original=%s, patch=%s",
 		utils.FormatBytes(int64(len(oldData))), utils.FormatBytes(int64(len(patchBytes))))
 
+	if isMSDelta(patchBytes) {
+		return fmt.Errorf("%s is a Windows MSDelta (PA30) delta, which bdiff cannot decode", patchPath)
+	}
+
 	// 4. 解码补丁文件
 	logger.Info("Decoding patch file...")
 	df, err := core.DecodeDiffFile(patchBytes)
@@ -100,41 +144,51 @@ func runApply(oldPath, patchPath string, options ApplyOptions) error {
 		return fmt.Errorf("failed to decode patch: %w", err)
 	}
 
-	logger.Infof("Patch info: %d patches, offset=%d", len(df.Diff), df.Offset)
-
-	// 5. 验证原文件哈希
-	logger.Info("Verifying original file hash...")
-	calculatedHash := core.ComputeHash(oldData)
-	if !utils.CompareHashes(calculatedHash, df.OldHash) {
-		return fmt.Errorf("hash mismatch: input file does not match patch source\nExpected: %x\nActual: %x",
-			df.OldHash, calculatedHash)
+	logger.Infof("Patch info: %d patches, offset=%d", core.PatchCount(df), df.Offset)
+	if err := core.ValidateDiffFile(df); err != nil {
+		return fmt.Errorf("invalid patch: %w", err)
 	}
 
+	// 5. 在后台验证原文件哈希，与应用同时进行；提前返回时也要等待计算结束再解除映射
+	logger.Infof("Verifying original file hash (%s)...", utils.HashAlgorithmName(df.HashAlgorithm))
+	oldHashing := utils.HashAsync(df.HashAlgorithm, oldData)
+	defer oldHashing.Wait()
+
 	// 6. 创建上下文（支持超时）
-	ctx := context.Background()
-	if options.Timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
-		defer cancel()
-	}
+	ctx, cancel := operationContext(options.Context, options.Timeout)
+	defer cancel()
 
 	// 7. 应用补丁
 	logger.Info("Applying patches...")
 	applyOptions := &core.ApplyOptions{
+		Config:       options.Config,
 		ShowProgress: options.ShowProgress,
 		Context:      ctx,
 		VerifyResult: options.VerifyResult,
+		Logger:       logger.Global(),
+	}
+	if options.ShowProgress {
+		applyOptions.Progress = progress.Default()
 	}
 
-	newData := core.ApplyPatchWithOptions(oldData, df.Diff, applyOptions)
+	newData, applyErr := core.ApplyDiffFile(oldData, df, applyOptions)
+	// 原文件不匹配时应用的错误没有意义，优先报告校验结果
+	oldHash, err := oldHashing.Wait()
+	if err != nil {
+		return err
+	}
+	if err := core.CheckHash(df.HashAlgorithm, oldHash, df.OldHash, nil); err != nil {
+		return fmt.Errorf("input file does not match patch source: %w", err)
+	}
+	if applyErr != nil {
+		return fmt.Errorf("failed to apply patch: %w", applyErr)
+	}
 
 	// 8. 验证结果哈希（如果启用）
 	if options.VerifyResult {
 		logger.Info("Verifying result file hash...")
-		resultHash := core.ComputeHash(newData)
-		if !utils.CompareHashes(resultHash, df.NewHash) {
-			return fmt.Errorf("result hash mismatch: patch application failed\nExpected: %x\nActual: %x",
-				df.NewHash, resultHash)
+		if err := core.VerifyDiffFileResult(df, newData, nil); err != nil {
+			return fmt.Errorf("patch application failed: %w", err)
 		}
 	}
 
@@ -143,25 +197,167 @@ func runApply(oldPath, patchPath string, options ApplyOptions) error {
 		options.OutputFile = string(df.NewFileName)
 	}
 
-	// 10. 写入结果文件
+	// 10. 写入结果文件。先解除原文件的映射，Windows 上映射中的文件不能被替换（原地更新）
+	newData = oldFile.Detach(newData)
+	oldFile.Close()
 	logger.Infof("Writing result to %s", options.OutputFile)
-	if err := utils.SafeWrite(options.OutputFile, newData); err != nil {
+	write := utils.SafeWrite
+	if df.Format == types.FORMAT_DISK {
+		// 磁盘镜像中的全零块写为空洞
+		write = func(name string, data []byte) error {
+			return utils.SafeWriteSparse(name, data, core.DefaultDiskBlockSize)
+		}
+	}
+	if err := write(options.OutputFile, newData); err != nil {
 		return fmt.Errorf("failed to write new file: %w", err)
 	}
 
 	// 11. 输出结果统计
-	duration := time.Since(start)
-
-	fmt.Printf("\n✓ Patch applied successfully: %s\n", options.OutputFile)
-	fmt.Printf("  Original size: %s\n", utils.FormatBytes(int64(len(oldData))))
-	fmt.Printf("  Result size: %s\n", utils.FormatBytes(int64(len(newData))))
-	fmt.Printf("  Processing time: %s\n", utils.FormatDuration(duration))
-	fmt.Printf("  Patches applied: %d\n", len(df.Diff))
+	return reportApply(options, OperationResult{
+		OldSize:  int64(len(oldData)),
+		NewSize:  int64(len(newData)),
+		Patches:  core.PatchCount(df),
+		Verified: options.VerifyResult,
+	}, stats)
+}
 
-	if options.VerifyResult {
-		fmt.Printf("  ✓ Hash verification: PASSED\n")
+// reportApply 输出应用结果：--json 时为一行 JSON，否则为可读的统计
+func reportApply(options *ApplyOptions, r OperationResult, stats *operationStats) error {
+	r.OperationID, r.Operation, r.Output = options.OperationID, "apply", options.OutputFile
+	duration := stats.finish(&r)
+	logger.Infof("Apply operation completed in %v", duration)
+	if options.JSON {
+		return printJSONResult(r)
 	}
 
-	logger.Infof("Apply operation completed in %v", duration)
+	i18n.Printf("\n✓ Patch applied successfully: %s\n", r.Output)
+	i18n.Printf("  Original size: %s\n", utils.FormatBytes(r.OldSize))
+	i18n.Printf("  Result size: %s\n", utils.FormatBytes(r.NewSize))
+	i18n.Printf("  Processing time: %s\n", utils.FormatDuration(duration))
+	if r.Patches > 0 {
+		i18n.Printf("  Patches applied: %d\n", r.Patches)
+	}
+	printPeakMemory(r)
+	if r.Verified {
+		i18n.Printf("  ✓ Hash verification: PASSED\n")
+	}
+	if r.OperationID != "" {
+		i18n.Printf("  Operation ID: %s\n", r.OperationID)
+	}
 	return nil
 }
+
+// applyStream 流式应用原始格式的补丁：旧文件按需读取，结果直接写入临时文件，
+// 内存占用与文件大小无关。补丁不是原始格式时返回 false，由调用方读入内存应用
+func applyStream(oldPath, patchPath string, options *ApplyOptions, stats *operationStats) (bool, error) {
+	patchFile, err := os.Open(patchPath)
+	if err != nil {
+		return true, fmt.Errorf("failed to read patch file: %w", err)
+	}
+	defer patchFile.Close()
+	df, err := core.ReadDiffHeader(patchFile)
+	if err != nil || df.Format != types.FORMAT_RAW {
+		return false, nil
+	}
+	dataStart, err := patchFile.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return true, fmt.Errorf("failed to read patch file: %w", err)
+	}
+
+	// 任何处理之前先检查整体校验和，传输中损坏的补丁直接拒绝
+	logger.Info("Verifying patch checksum...")
+	if _, err := patchFile.Seek(0, io.SeekStart); err != nil {
+		return true, fmt.Errorf("failed to read patch file: %w", err)
+	}
+	if _, err := core.VerifyDiffFileChecksum(bufio.NewReader(patchFile)); err != nil {
+		return true, fmt.Errorf("invalid patch: %w", err)
+	}
+	if _, err := patchFile.Seek(dataStart, io.SeekStart); err != nil {
+		return true, fmt.Errorf("failed to read patch file: %w", err)
+	}
+
+	// 写出结果之前检查整个补丁的结构
+	logger.Info("Validating patch structure...")
+	ops := bufio.NewReader(io.LimitReader(patchFile, int64(df.DataLength)))
+	if err := core.ValidatePatchStream(ops, int64(df.OldSize), int64(df.NewSize)); err != nil {
+		return true, fmt.Errorf("invalid patch: %w", err)
+	}
+	if _, err := patchFile.Seek(0, io.SeekStart); err != nil {
+		return true, fmt.Errorf("failed to read patch file: %w", err)
+	}
+
+	cfg := options.Config
+	if cfg == nil {
+		cfg = config.DefaultConfig()
+	}
+	hints := cfg.IO.Hints()
+	oldFile, err := utils.OpenInput(oldPath, hints)
+	if err != nil {
+		return true, fmt.Errorf("failed to read old file: %w", err)
+	}
+	defer oldFile.Close()
+
+	logger.Infof("Patch info: %s patch data, hash %s",
+		utils.FormatBytes(int64(df.DataLength)), utils.HashAlgorithmName(df.HashAlgorithm))
+
+	ctx, cancel := operationContext(options.Context, options.Timeout)
+	defer cancel()
+	applyOptions := &core.ApplyOptions{
+		Config:       cfg,
+		ShowProgress: options.ShowProgress,
+		Context:      ctx,
+		VerifyResult: options.VerifyResult,
+		Logger:       logger.Global(),
+	}
+	if options.ShowProgress {
+		applyOptions.Progress = progress.Default()
+	}
+
+	if options.OutputFile == "" {
+		options.OutputFile = string(df.NewFileName)
+	}
+	logger.Infof("Streaming result to %s", options.OutputFile)
+	patchReader := bufio.NewReaderSize(patchFile, hints.ReadBufferSize())
+	err = utils.SafeWriteFunc(options.OutputFile, func(w io.Writer) error {
+		_, err := core.ApplyDiffFileStream(oldFile, patchReader, w, applyOptions)
+		// 替换前关闭原文件，Windows 上打开中的文件不能被替换（原地更新）
+		oldFile.Close()
+		return err
+	})
+	if err != nil {
+		return true, fmt.Errorf("failed to apply patch: %w", err)
+	}
+
+	return true, reportApply(options, OperationResult{
+		OldSize:  int64(df.OldSize),
+		NewSize:  int64(df.NewSize),
+		Verified: options.VerifyResult,
+	}, stats)
+}
+
+// isMSDelta 判断补丁是否为 Windows MSDelta（PA30）增量，WinSxS 中的 .delta 文件前有 4 字节 CRC32
+func isMSDelta(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PA30")) || len(data) >= 8 && string(data[4:8]) == "PA30"
+}
+
+// backupOriginal 备份原文件并按配置的保留策略清理旧备份，失败只记录警告
+func backupOriginal(path string, cfg *config.Config) {
+	if cfg == nil {
+		cfg = config.DefaultConfig()
+	}
+	backup, err := utils.BackupFile(path)
+	if err != nil {
+		logger.Warnf("Failed to backup original file: %v", err)
+		return
+	}
+	logger.Infof("Original file backed up to %s", backup)
+
+	maxAge := time.Duration(cfg.Backup.MaxAgeDays) * 24 * time.Hour
+	removed, err := utils.PruneBackups(path, cfg.Backup.Keep, maxAge)
+	if err != nil {
+		logger.Warnf("Failed to prune old backups: %v", err)
+	}
+	for _, p := range removed {
+		logger.Debugf("Removed old backup %s", p)
+	}
+}
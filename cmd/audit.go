@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bindiff/pkg/audit"
+	"bindiff/pkg/config"
+	"bindiff/pkg/i18n"
+	"bindiff/pkg/logger"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// AuditCommand 创建审计命令，getConfig 在执行时返回已加载的配置
+func AuditCommand(getConfig func() *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Inspect the apply audit log",
+		Long: `Every apply is recorded in an append-only, hash-chained audit log
+(audit.path, default <repo_dir>/audit.log) with the time, user and the
+SHA-256 of the source, patch and result files.`,
+	}
+	cmd.AddCommand(auditListCommand(getConfig))
+	cmd.AddCommand(auditVerifyCommand(getConfig))
+	return cmd
+}
+
+// auditListCommand 列出审计记录
+func auditListCommand(getConfig func() *config.Config) *cobra.Command {
+	var (
+		asJSON bool
+		limit  int
+	)
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List recorded apply operations, oldest first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := audit.Read(getConfig().AuditPath())
+			if err != nil {
+				return err
+			}
+			if limit > 0 && len(entries) > limit {
+				entries = entries[len(entries)-limit:]
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				for _, e := range entries {
+					if err := enc.Encode(e); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SEQ\tTIME\tUSER\tOUTCOME\tSOURCE\tPATCH\tRESULT")
+			for _, e := range entries {
+				result := shortHash(e.ResultHash)
+				if e.Outcome != audit.OutcomeSuccess {
+					result = e.Error
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s (%s)\t%s (%s)\t%s\n",
+					e.Seq, e.Time.Local().Format(time.RFC3339), e.User, e.Outcome,
+					e.Source, shortHash(e.SourceHash), e.Patch, shortHash(e.PatchHash), result)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the full records as JSON Lines")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 0, "Only show the last N records (0 = all)")
+	return cmd
+}
+
+// auditVerifyCommand 校验审计文件的哈希链
+func auditVerifyCommand(getConfig func() *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify",
+		Short: "Check that no audit record has been modified, removed or reordered",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := getConfig().AuditPath()
+			entries, err := audit.Read(path)
+			if err != nil {
+				return err
+			}
+			if err := audit.Verify(entries); err != nil {
+				return err
+			}
+			i18n.Printf("✓ %s: %d records, hash chain intact\n", path, len(entries))
+			return nil
+		},
+	}
+}
+
+// shortHash 缩短显示的哈希
+func shortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	if h == "" {
+		return "-"
+	}
+	return h
+}
+
+// auditApply 执行 apply 并记录审计。源文件与补丁的哈希在应用前计算（原地更新会覆盖源文件），
+// 结果文件的哈希在成功后计算。补丁已应用但记录失败时返回错误，使受监管的流水线不会忽略缺失的记录
+func auditApply(cfg *config.Config, oldPath, patchPath string, options *ApplyOptions, apply func() error) error {
+	if cfg == nil || !cfg.Audit.Enabled {
+		return apply()
+	}
+
+	entry := &audit.Entry{
+		Operation:   audit.OperationApply,
+		OperationID: options.OperationID,
+		Source:      absPath(oldPath),
+		Patch:       absPath(patchPath),
+	}
+	entry.SourceHash, _ = audit.HashFile(oldPath)
+	entry.PatchHash, _ = audit.HashFile(patchPath)
+
+	err := apply()
+	if options.OutputFile != "" {
+		entry.Result = absPath(options.OutputFile)
+	}
+	if err == nil {
+		entry.Outcome = audit.OutcomeSuccess
+		entry.ResultHash, _ = audit.HashFile(options.OutputFile)
+	} else {
+		entry.Outcome = audit.OutcomeFailure
+		entry.Error = err.Error()
+	}
+
+	log := audit.New(cfg.AuditPath())
+	defer log.Close()
+	if cfg.Audit.Syslog {
+		if serr := log.EnableSyslog(); serr != nil {
+			logger.Warnf("Audit: %v", serr)
+		}
+	}
+	if aerr := log.Append(entry); aerr != nil {
+		if err != nil {
+			logger.Warnf("Failed to record failed apply in audit log: %v", aerr)
+			return err
+		}
+		return fmt.Errorf("patch applied but audit record failed: %w", aerr)
+	}
+	return err
+}
+
+// absPath 返回绝对路径，失败时原样返回
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"bindiff/pkg/debdelta"
+	"bindiff/pkg/i18n"
+	"bindiff/pkg/logger"
+	"bindiff/pkg/utils"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// DebDeltaCommand 创建 debdelta 增量包命令，getConfig 在执行时返回已加载的配置
+func DebDeltaCommand(getConfig func() *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "debdelta",
+		Short: "Build and apply debdelta-compatible delta packages",
+		Long: `Wrap bindiff patches between two .deb files into debdelta containers:
+- The ar container holds 'info', 'patch.sh' and the bindiff patch
+- debpatch runs patch.sh, which calls 'bdiff apply' on the target system
+- apply does the same without debpatch and checks sizes and MD5 sums`,
+	}
+
+	cmd.AddCommand(debDeltaCreateCommand(getConfig))
+	cmd.AddCommand(debDeltaApplyCommand(getConfig))
+	return cmd
+}
+
+// debDeltaCreateCommand 创建增量包生成命令
+func debDeltaCreateCommand(getConfig func() *config.Config) *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "create OLD.deb NEW.deb",
+		Short: "Build a .debdelta that upgrades OLD.deb to NEW.deb",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			oldDeb, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read old package: %w", err)
+			}
+			newDeb, err := os.ReadFile(args[1])
+			if err != nil {
+				return fmt.Errorf("failed to read new package: %w", err)
+			}
+			delta, info, err := debdelta.Create(oldDeb, newDeb, args[0], args[1],
+				&core.DiffOptions{Config: getConfig(), Logger: logger.Global()})
+			if err != nil {
+				return err
+			}
+			if output == "" {
+				output = info.Name()
+			}
+			if err := utils.SafeWrite(output, delta); err != nil {
+				return fmt.Errorf("failed to write delta: %w", err)
+			}
+			i18n.Printf("✓ Debdelta written: %s (%s, new package %s)\n",
+				output, utils.FormatBytes(int64(len(delta))), utils.FormatBytes(info.New.Size))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file (default: name_oldversion_newversion_arch.debdelta)")
+	return cmd
+}
+
+// debDeltaApplyCommand 创建增量包应用命令
+func debDeltaApplyCommand(getConfig func() *config.Config) *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "apply OLD.deb DELTA",
+		Short: "Rebuild the new .deb from the old one and a .debdelta",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			oldDeb, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read old package: %w", err)
+			}
+			delta, err := os.ReadFile(args[1])
+			if err != nil {
+				return fmt.Errorf("failed to read delta: %w", err)
+			}
+			newDeb, info, err := debdelta.Apply(oldDeb, delta, &core.ApplyOptions{Config: getConfig(), Logger: logger.Global()})
+			if err != nil {
+				return err
+			}
+			if output == "" {
+				// 与 dpkg-name 相同，文件名中的版本不含 epoch
+				_, version, ok := strings.Cut(info.New.Version, ":")
+				if !ok {
+					version = info.New.Version
+				}
+				output = fmt.Sprintf("%s_%s_%s.deb", info.New.Name, version, info.New.Architecture)
+			}
+			if err := utils.SafeWrite(output, newDeb); err != nil {
+				return fmt.Errorf("failed to write package: %w", err)
+			}
+			i18n.Printf("✓ %s %s written: %s (%s)\n", info.New.Name, info.New.Version, output, utils.FormatBytes(info.New.Size))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file (default: name_version_arch.deb)")
+	return cmd
+}
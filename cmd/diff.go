@@ -3,7 +3,9 @@ package cmd
 import (
 	"bindiff/core"
 	"bindiff/pkg/config"
+	"bindiff/pkg/i18n"
 	"bindiff/pkg/logger"
+	"bindiff/pkg/progress"
 	"bindiff/pkg/utils"
 	"bindiff/types"
 	"context"
@@ -15,17 +17,27 @@ import (
 	"github.com/spf13/cobra"
 )
 
-// DiffCommand 创建差分命令（增强版）
-func DiffCommand() *cobra.Command {
+// DiffCommand 创建差分命令（增强版），未指定的选项使用配置中的值
+func DiffCommand(getConfig func() *config.Config) *cobra.Command {
 	var (
 		outFile      string
 		showProgress bool
 		useFFT       bool
+		fftPrecision string
+		alignBy      string
+		backend      string
 		useParallel  bool
 		maxWorkers   int
 		blockSize    int
 		minMatch     int
+		maxMemory    int
+		autoTune     bool
+		merkleBlock  int
 		timeout      time.Duration
+		hashAlgo     string
+		raw          bool
+		opID         string
+		asJSON       bool
 	)
 
 	cmd := &cobra.Command{
@@ -35,19 +47,32 @@ func DiffCommand() *cobra.Command {
 - FFT-based alignment for better matching
 - Parallel processing for large files
 - Advanced hash-based block matching
+- Entry-by-entry diffing when both inputs are tar or zip archives
+- Recompression-aware diffing when both inputs are gzip files
 - Configurable compression settings`,
 		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runDiff(args[0], args[1], DiffOptions{
-				OutputFile:   outFile,
-				ShowProgress: showProgress,
-				UseFFT:       useFFT,
-				UseParallel:  useParallel,
-				MaxWorkers:   maxWorkers,
-				BlockSize:    blockSize,
-				MinMatch:     minMatch,
-				Timeout:      timeout,
-			})
+				OutputFile:    outFile,
+				ShowProgress:  showProgress,
+				UseFFT:        useFFT,
+				FFTPrecision:  fftPrecision,
+				AlignStrategy: alignBy,
+				Backend:       backend,
+				UseParallel:   useParallel,
+				MaxWorkers:    maxWorkers,
+				BlockSize:     blockSize,
+				MinMatch:      minMatch,
+				MaxMemoryMB:   maxMemory,
+				AutoTune:      autoTune,
+				MerkleBlockKB: merkleBlock,
+				Timeout:       timeout,
+				HashAlgorithm: hashAlgo,
+				Raw:           raw,
+				OperationID:   opID,
+				JSON:          asJSON,
+				Context:       cmd.Context(),
+			}.WithConfig(cmd, getConfig()))
 		},
 	}
 
@@ -55,11 +80,21 @@ func DiffCommand() *cobra.Command {
 	cmd.Flags().StringVarP(&outFile, "output", "o", "", "Output patch file name (default: patch.bdf)")
 	cmd.Flags().BoolVar(&showProgress, "progress", true, "Show progress bar")
 	cmd.Flags().BoolVar(&useFFT, "fft", true, "Enable FFT-based alignment")
+	cmd.Flags().StringVar(&fftPrecision, "fft-precision", config.FFTPrecisionFloat64, "FFT alignment precision (float64, float32; default: config fft_precision)")
+	cmd.Flags().StringVar(&alignBy, "align", config.AlignStrategyFFT, "Alignment strategy (fft, winnow, sampled; default: config align_strategy)")
+	cmd.Flags().StringVar(&backend, "correlation-backend", config.CorrelationBackendCPU, "Correlation backend for FFT alignment (cpu, cuda; default: config correlation_backend)")
 	cmd.Flags().BoolVar(&useParallel, "parallel", true, "Enable parallel processing")
 	cmd.Flags().IntVar(&maxWorkers, "workers", 4, "Maximum number of workers")
 	cmd.Flags().IntVar(&blockSize, "block-size", 1024, "Block size for matching")
 	cmd.Flags().IntVar(&minMatch, "min-match", 64, "Minimum match length")
+	cmd.Flags().IntVar(&maxMemory, "max-memory", 512, "Memory budget for matching in MB, beyond the input files (0 = no limit)")
+	cmd.Flags().BoolVar(&autoTune, "auto-tune", false, "Pick block size and min match length by sampling before diffing (default: config auto_tune)")
+	cmd.Flags().IntVar(&merkleBlock, "merkle-block", 0, "Store a Merkle tree of NEW in blocks of this many KB so apply and verify can locate wrong output regions (0 = none)")
 	cmd.Flags().DurationVar(&timeout, "timeout", 0, "Operation timeout (0 = no timeout)")
+	cmd.Flags().StringVar(&hashAlgo, "hash", "sha256", "Verification hash algorithm (sha256, blake3, xxhash; default: config hash_algorithm)")
+	cmd.Flags().BoolVar(&raw, "raw", false, "Always diff raw bytes, even for archives and gzip files")
+	cmd.Flags().StringVar(&opID, "op-id", "", "Operation ID attached to every log line (default: $BINDIFF_OPERATION_ID or random)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the result as JSON on stdout (logs go to stderr)")
 
 	return cmd
 }
@@ -69,16 +104,113 @@ type DiffOptions struct {
 	OutputFile   string
 	ShowProgress bool
 	UseFFT       bool
-	UseParallel  bool
-	MaxWorkers   int
-	BlockSize    int
-	MinMatch     int
-	Timeout      time.Duration
+	// FFTPrecision FFT 对齐的浮点精度：float64、float32
+	FFTPrecision string
+	// AlignStrategy 对齐方式：fft、winnow、sampled
+	AlignStrategy string
+	// Backend 互相关后端：cpu、cuda（需要以 -tags cuda 构建）
+	Backend     string
+	UseParallel bool
+	MaxWorkers  int
+	BlockSize   int
+	MinMatch    int
+	// MaxMemoryMB 差分的内存预算，0 不限制
+	MaxMemoryMB int
+	// AutoTune 抽样选择块大小与最小匹配长度，覆盖 BlockSize 与 MinMatch
+	AutoTune bool
+	// MerkleBlockKB 在补丁中保存新文件按此大小（KB）分块的 Merkle 树，0 不保存
+	MerkleBlockKB int
+	Timeout       time.Duration
+	// HashAlgorithm 校验哈希算法：sha256、blake3、xxhash
+	HashAlgorithm string
+	// Raw 禁用归档感知与压缩感知差分
+	Raw bool
+	// OperationID 附加到日志与 --json 输出的操作 ID，为空时读取 BINDIFF_OPERATION_ID 或随机生成
+	OperationID string
+	// JSON 以 JSON 输出结果
+	JSON bool
+	// Context 命令的上下文，收到中断信号时取消；nil 时使用 context.Background()
+	Context context.Context
+	// Config 加载的配置，其余差分参数（如 align_samples）取自这里；nil 时使用默认配置
+	Config *config.Config
+}
+
+// WithConfig 返回把未在命令行指定的选项换成 cfg 中对应值的选项，cfg 为 nil 时原样返回
+func (o DiffOptions) WithConfig(cmd *cobra.Command, cfg *config.Config) DiffOptions {
+	if cfg == nil {
+		return o
+	}
+	o.Config = cfg
+	flags := cmd.Flags()
+	if !flags.Changed("progress") {
+		o.ShowProgress = cfg.ShowProgress
+	}
+	if !flags.Changed("fft") {
+		o.UseFFT = cfg.EnableFFT
+	}
+	if !flags.Changed("fft-precision") {
+		o.FFTPrecision = cfg.FFTPrecision
+	}
+	if !flags.Changed("align") {
+		o.AlignStrategy = cfg.AlignStrategy
+	}
+	if !flags.Changed("correlation-backend") {
+		o.Backend = cfg.CorrelationBackend
+	}
+	if !flags.Changed("parallel") {
+		o.UseParallel = cfg.UseParallel
+	}
+	if !flags.Changed("workers") {
+		o.MaxWorkers = cfg.MaxWorkers
+	}
+	if !flags.Changed("block-size") {
+		o.BlockSize = cfg.BlockSize
+	}
+	if !flags.Changed("min-match") {
+		o.MinMatch = cfg.MinMatchLength
+	}
+	if !flags.Changed("max-memory") {
+		o.MaxMemoryMB = cfg.MaxMemoryMB
+	}
+	if !flags.Changed("auto-tune") {
+		o.AutoTune = cfg.AutoTune
+	}
+	if !flags.Changed("hash") {
+		o.HashAlgorithm = cfg.HashAlgorithm
+	}
+	return o
+}
+
+// EngineConfig 返回传给差分引擎的配置：以 Config 为基础，换上选项中的值
+func (o DiffOptions) EngineConfig() *config.Config {
+	cfg := config.DefaultConfig()
+	if o.Config != nil {
+		c := *o.Config
+		cfg = &c
+	}
+	cfg.BlockSize = o.BlockSize
+	cfg.MinMatchLength = o.MinMatch
+	cfg.MaxMemoryMB = o.MaxMemoryMB
+	cfg.MaxWorkers = o.MaxWorkers
+	cfg.EnableFFT = o.UseFFT
+	cfg.FFTPrecision = o.FFTPrecision
+	cfg.AlignStrategy = o.AlignStrategy
+	cfg.CorrelationBackend = o.Backend
+	cfg.UseParallel = o.UseParallel
+	cfg.ShowProgress = o.ShowProgress
+	cfg.AutoTune = o.AutoTune
+	cfg.HashAlgorithm = o.HashAlgorithm
+	return cfg
 }
 
 // runDiff 执行差分操作
 func runDiff(oldPath, newPath string, options DiffOptions) error {
-	start := time.Now()
+	stats := startStats()
+	defer stats.stop()
+	opID, err := startOperation(options.OperationID)
+	if err != nil {
+		return err
+	}
 	logger.Infof("Starting diff operation: %s -> %s", oldPath, newPath)
 
 	// 1. 验证文件存在
@@ -86,96 +218,101 @@ func runDiff(oldPath, newPath string, options DiffOptions) error {
 		return err
 	}
 
-	// 2. 读取文件信息
-	oldInfo, err := utils.GetFileInfo(oldPath)
+	// 2. 解析校验哈希算法
+	hashAlgo, err := utils.ParseHashAlgorithm(options.HashAlgorithm)
 	if err != nil {
-		return fmt.Errorf("failed to get old file info: %w", err)
+		return err
 	}
-
-	newInfo, err := utils.GetFileInfo(newPath)
-	if err != nil {
-		return fmt.Errorf("failed to get new file info: %w", err)
+	switch options.FFTPrecision {
+	case "", config.FFTPrecisionFloat64, config.FFTPrecisionFloat32:
+	default:
+		return fmt.Errorf("invalid FFT precision: %s", options.FFTPrecision)
+	}
+	switch options.AlignStrategy {
+	case "", config.AlignStrategyFFT, config.AlignStrategyWinnow, config.AlignStrategySampled:
+	default:
+		return fmt.Errorf("invalid alignment strategy: %s", options.AlignStrategy)
+	}
+	switch options.Backend {
+	case "", config.CorrelationBackendCPU, config.CorrelationBackendCUDA:
+	default:
+		return fmt.Errorf("invalid correlation backend: %s", options.Backend)
+	}
+	if options.MerkleBlockKB < 0 {
+		return fmt.Errorf("invalid merkle block size: %d KB", options.MerkleBlockKB)
 	}
 
-	logger.Infof("File sizes: old=%s, new=%s",
-		utils.FormatBytes(oldInfo.Size), utils.FormatBytes(newInfo.Size))
-
-	// 3. 读取文件数据
-	oldData, err := os.ReadFile(oldPath)
+	// 3. 映射文件数据（由操作系统按需调页）
+	oldFile, err := utils.MapFile(oldPath)
 	if err != nil {
 		return fmt.Errorf("failed to read old file: %w", err)
 	}
+	defer oldFile.Close()
+	oldData := oldFile.Bytes()
 
-	newData, err := os.ReadFile(newPath)
+	newFile, err := utils.MapFile(newPath)
 	if err != nil {
 		return fmt.Errorf("failed to read new file: %w", err)
 	}
+	defer newFile.Close()
+	newData := newFile.Bytes()
+
+	logger.Infof("File sizes: old=%s, new=%s",
+		utils.FormatBytes(int64(len(oldData))), utils.FormatBytes(int64(len(newData))))
+	logger.Infof("Verification hash: %s", utils.HashAlgorithmName(hashAlgo))
 
 	// 4. 创建上下文（支持超时）
-	ctx := context.Background()
-	if options.Timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
-		defer cancel()
-	}
+	ctx, cancel := operationContext(options.Context, options.Timeout)
+	defer cancel()
 
 	// 5. 配置差分选项
-	diffConfig := &config.Config{
-		BlockSize:      options.BlockSize,
-		MinMatchLength: options.MinMatch,
-		MaxWorkers:     options.MaxWorkers,
-		EnableFFT:      options.UseFFT,
-		UseParallel:    options.UseParallel,
-		ShowProgress:   options.ShowProgress,
-	}
+	diffConfig := options.EngineConfig()
 
 	coreDiffOptions := &core.DiffOptions{
 		Config:       diffConfig,
 		ShowProgress: options.ShowProgress,
 		Context:      ctx,
+		Logger:       logger.Global(),
+	}
+	if options.ShowProgress {
+		coreDiffOptions.Progress = progress.Default()
+	}
+	if options.Raw {
+		coreDiffOptions.Strategy = config.StrategyRaw
 	}
 
-	// 6. 计算偏移量（如果启用FFT）
-	var offset int32
-	if options.UseFFT {
-		logger.Info("Computing FFT-based alignment...")
-		offset = int32(core.ComputeOffset(oldData, newData))
-		logger.Infof("Computed offset: %d", offset)
-	} else {
+	// 6. 计算差分（启用 FFT 时同时计算偏移量），两端哈希在后台同时计算
+	if !options.UseFFT {
 		logger.Info("FFT alignment disabled")
 	}
+	diffFile, result, err := core.CreateDiffFile(oldData, newData, coreDiffOptions)
+	if err != nil {
+		return fmt.Errorf("failed to compute diff: %w", err)
+	}
+	if diffFile.Format == types.FORMAT_RAW {
+		logger.Infof("Generated %d patches, offset=%d (confidence %.2f)",
+			len(result.Patches), result.Offset, result.AlignConfidence)
+	}
+	logger.Infof("Compression ratio: %.2f%%", result.CompressionRatio*100)
 
-	// 7. 计算差分
-	logger.Info("Computing binary diff...")
-	patches := core.DiffWithOptions(oldData, newData, coreDiffOptions)
-	logger.Infof("Generated %d patches", len(patches))
-
-	// 8. 计算统计信息
-	compressionRatio := calculateCompressionRatio(patches, int64(len(newData)))
-	logger.Infof("Compression ratio: %.2f%%", compressionRatio*100)
-
-	// 9. 创建补丁文件
-	diffFile := types.DiffFile{
-		MagicNumber:       types.PATCH_MAGIC,
-		Version:           types.PATCH_VERSION,
-		OldFileNameLength: uint32(len(filepath.Base(oldPath))),
-		FileName:          []byte(filepath.Base(oldPath)),
-		NewFileNameLength: uint32(len(filepath.Base(newPath))),
-		NewFileName:       []byte(filepath.Base(newPath)),
-		OldSize:           uint32(len(oldData)),
-		NewSize:           uint32(len(newData)),
-		OldHash:           oldInfo.Hash,
-		NewHash:           newInfo.Hash,
-		Offset:            offset,
-		Diff:              patches,
-	}
-
-	// 10. 编码补丁数据
+	// 7. 记录文件名与 Merkle 树
+	diffFile.OldFileNameLength = uint32(len(filepath.Base(oldPath)))
+	diffFile.FileName = []byte(filepath.Base(oldPath))
+	diffFile.NewFileNameLength = uint32(len(filepath.Base(newPath)))
+	diffFile.NewFileName = []byte(filepath.Base(newPath))
+	if options.MerkleBlockKB > 0 {
+		if err := core.AddMerkleTree(&diffFile, newData, int64(options.MerkleBlockKB)<<10); err != nil {
+			return err
+		}
+		logger.Infof("Merkle tree: %d KB blocks", options.MerkleBlockKB)
+	}
+
+	// 8. 编码补丁数据
 	logger.Info("Encoding patch data...")
 	diffBytes := core.EncodeDiffFile(diffFile)
 	diffFile.DataLength = uint32(len(diffBytes))
 
-	// 11. 写入补丁文件
+	// 9. 写入补丁文件
 	if options.OutputFile == "" {
 		options.OutputFile = "patch.bdf"
 	}
@@ -184,18 +321,31 @@ func runDiff(oldPath, newPath string, options DiffOptions) error {
 		return fmt.Errorf("failed to write patch file: %w", err)
 	}
 
-	// 12. 输出结果统计
-	duration := time.Since(start)
-	patchSize := int64(len(diffBytes))
-
-	fmt.Printf("\n✓ Patch file generated: %s\n", options.OutputFile)
-	fmt.Printf("  Original size: %s\n", utils.FormatBytes(int64(len(newData))))
-	fmt.Printf("  Patch size: %s\n", utils.FormatBytes(patchSize))
-	fmt.Printf("  Compression: %.2f%%\n", compressionRatio*100)
-	fmt.Printf("  Processing time: %s\n", utils.FormatDuration(duration))
-	fmt.Printf("  Patches generated: %d\n", len(patches))
+	// 10. 输出结果统计
+	r := OperationResult{
+		OperationID: opID,
+		Operation:   "diff",
+		Output:      options.OutputFile,
+		OldSize:     int64(len(oldData)),
+		NewSize:     int64(len(newData)),
+		PatchSize:   int64(len(diffBytes)),
+		Patches:     core.PatchCount(diffFile),
+	}
+	duration := stats.finish(&r)
 
 	logger.Infof("Diff operation completed in %v", duration)
+	if options.JSON {
+		return printJSONResult(r)
+	}
+
+	i18n.Printf("\n✓ Patch file generated: %s\n", r.Output)
+	i18n.Printf("  Original size: %s\n", utils.FormatBytes(r.NewSize))
+	i18n.Printf("  Patch size: %s\n", utils.FormatBytes(r.PatchSize))
+	i18n.Printf("  Compression: %.2f%%\n", result.CompressionRatio*100)
+	i18n.Printf("  Processing time: %s\n", utils.FormatDuration(duration))
+	i18n.Printf("  Patches generated: %d\n", r.Patches)
+	printPeakMemory(r)
+	i18n.Printf("  Operation ID: %s\n", opID)
 	return nil
 }
 
@@ -210,18 +360,3 @@ func validateFiles(paths ...string) error {
 	}
 	return nil
 }
-
-// calculateCompressionRatio 计算压缩率
-func calculateCompressionRatio(patches []types.Patch, originalSize int64) float64 {
-	var patchSize int64
-	for _, patch := range patches {
-		patchSize += int64(len(patch.Data))
-		patchSize += 24 // 头信息大小
-	}
-
-	if originalSize == 0 {
-		return 0
-	}
-
-	return float64(patchSize) / float64(originalSize)
-}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/bundle"
+	"bindiff/pkg/config"
+	"bindiff/pkg/i18n"
+	"bindiff/pkg/ignore"
+	"bindiff/pkg/logger"
+	"bindiff/pkg/utils"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// DirCommand 创建目录增量包命令，getConfig 在执行时返回已加载的配置
+func DirCommand(getConfig func() *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dir",
+		Short: "Build and apply delta bundles of whole directories",
+		Long: `Update a directory tree as a single unit:
+- The bundle manifest lists every file with its mode and hash
+- Changed files are shipped as patches against the old files
+- Apply stages and verifies every file before replacing anything,
+  and restores the original files if any replacement fails`,
+	}
+
+	cmd.AddCommand(dirDiffCommand(getConfig))
+	cmd.AddCommand(dirApplyCommand(getConfig))
+	return cmd
+}
+
+// dirDiffCommand 创建目录增量包生成命令
+func dirDiffCommand(getConfig func() *config.Config) *cobra.Command {
+	var (
+		output   string
+		excludes []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "diff OLD_DIR NEW_DIR",
+		Short: "Build a bundle that upgrades OLD_DIR to NEW_DIR",
+		Long: `Build a bundle that upgrades OLD_DIR to NEW_DIR.
+Paths matching the gitignore-style patterns in NEW_DIR/.bindiffignore or
+--exclude are left out of the bundle and are not touched on apply.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			m, err := ignore.Load(os.DirFS(args[1]), excludes...)
+			if err != nil {
+				return err
+			}
+
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create bundle: %w", err)
+			}
+			defer utils.TrackPartial(output)()
+			defer func() {
+				if cerr := f.Close(); err == nil {
+					err = cerr
+				}
+				if err != nil {
+					os.Remove(output)
+				}
+			}()
+
+			manifest, err := bundle.Diff(ignore.Filter(os.DirFS(args[0]), m), ignore.Filter(os.DirFS(args[1]), m), f,
+				&core.DiffOptions{Config: getConfig(), Context: cmd.Context(), Logger: logger.Global()})
+			if err != nil {
+				return err
+			}
+
+			counts := make(map[string]int)
+			for _, e := range manifest.Files {
+				counts[e.Kind]++
+			}
+			i18n.Printf("✓ Bundle written: %s (%d added, %d modified, %d renamed, %d removed, %d unchanged)\n",
+				output, counts[bundle.KindAdded], counts[bundle.KindModified], counts[bundle.KindRenamed],
+				counts[bundle.KindRemoved], counts[bundle.KindUnchanged])
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "bundle.tar", "Output bundle path")
+	cmd.Flags().StringArrayVar(&excludes, "exclude", nil, "Skip paths matching a gitignore-style pattern (repeatable)")
+	return cmd
+}
+
+// dirApplyCommand 创建目录增量包应用命令
+func dirApplyCommand(getConfig func() *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "apply DIR BUNDLE",
+		Short: "Update DIR in place from a bundle, all files or none",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := os.Open(args[1])
+			if err != nil {
+				return fmt.Errorf("failed to open bundle: %w", err)
+			}
+			defer f.Close()
+
+			manifest, err := bundle.Apply(args[0], f, &core.ApplyOptions{Config: getConfig(), Context: cmd.Context(), Logger: logger.Global()})
+			if err != nil {
+				return err
+			}
+			i18n.Printf("✓ %s updated (%d file(s) in manifest)\n", args[0], len(manifest.Files))
+			return nil
+		},
+	}
+}
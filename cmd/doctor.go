@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bindiff/pkg/config"
+	"bindiff/pkg/doctor"
+	"bindiff/pkg/i18n"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// DoctorCommand 创建自检命令
+func DoctorCommand(getConfig func() *config.Config) *cobra.Command {
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Run built-in self-tests and print a diagnostic report",
+		Long: `Run built-in self-tests and print a diagnostic report:
+- Golden patch vector: encoding, decoding and apply
+- Diff/apply round trips with the current configuration
+- FFT round trip and alignment of a known shift
+- Configuration validation and environment detection
+- Atomic rename, directory sync and transactions in the repository directory
+
+Exits with an error when any check fails; warnings do not fail the command.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := getConfig()
+			dir := os.TempDir()
+			if cfg != nil {
+				dir = cfg.RepoDir
+			}
+			report := doctor.Run(cmd.Context(), doctor.Checks(cfg, dir))
+			if asJSON {
+				if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+					return err
+				}
+			} else {
+				printDoctorReport(report)
+			}
+			if failed := report.Failed(); failed > 0 {
+				return fmt.Errorf("%d of %d checks failed", failed, len(report.Results))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the report as JSON on stdout (logs go to stderr)")
+	return cmd
+}
+
+// printDoctorReport 输出可读的自检报告
+func printDoctorReport(report *doctor.Report) {
+	env := report.Environment
+	i18n.Printf("Environment:\n")
+	i18n.Printf("  Go: %s %s/%s, %d CPUs (GOMAXPROCS %d)\n", env.GoVersion, env.OS, env.Arch, env.CPUs, env.GOMAXPROCS)
+	i18n.Printf("  Language: %s\n", env.Language)
+	i18n.Printf("  Working directory: %s\n", env.WorkDir)
+	i18n.Printf("  Temp directory: %s\n", env.TempDir)
+	i18n.Printf("  Config files: %s\n", joinOrNone(env.ConfigFiles))
+	i18n.Printf("  Environment variables: %s\n", joinOrNone(env.EnvVars))
+
+	i18n.Printf("\nChecks:\n")
+	for _, res := range report.Results {
+		mark := "✓"
+		switch res.Status {
+		case doctor.StatusWarn:
+			mark = "!"
+		case doctor.StatusFail:
+			mark = "✗"
+		}
+		fmt.Printf("  %s %-13s %s\n", mark, res.Name, res.Detail)
+		if res.Error != "" {
+			fmt.Printf("    %s\n", res.Error)
+		}
+	}
+
+	if failed := report.Failed(); failed == 0 {
+		i18n.Printf("\n✓ All %d checks passed\n", len(report.Results))
+	}
+}
+
+// joinOrNone 以逗号连接，为空时返回 none
+func joinOrNone(items []string) string {
+	if len(items) == 0 {
+		return i18n.T("none")
+	}
+	return strings.Join(items, ", ")
+}
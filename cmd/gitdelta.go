@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/gitdelta"
+	"bindiff/pkg/i18n"
+	"bindiff/pkg/logger"
+	"bindiff/pkg/utils"
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// GitDeltaCommand 创建 git 增量导出命令
+func GitDeltaCommand() *cobra.Command {
+	var (
+		output   string
+		packFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "git-delta OLD PATCH",
+		Short: "Convert a patch into git's delta instruction format",
+		Long: `Convert a bindiff patch into git's delta format (the payload of
+OBJ_OFS_DELTA and OBJ_REF_DELTA pack objects).
+With --pack, also write a two-object packfile holding OLD as a blob and the
+new file as an OBJ_OFS_DELTA against it; index it with 'git index-pack'.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output == "" && packFile == "" {
+				output = "patch.delta"
+			}
+			oldData, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read old file: %w", err)
+			}
+			patchData, err := os.ReadFile(args[1])
+			if err != nil {
+				return fmt.Errorf("failed to read patch: %w", err)
+			}
+			df, err := core.DecodeDiffFile(patchData)
+			if err != nil {
+				return fmt.Errorf("failed to decode patch: %w", err)
+			}
+			if err := core.ValidateDiffFile(df); err != nil {
+				return fmt.Errorf("invalid patch: %w", err)
+			}
+
+			delta, err := gitdelta.FromDiffFile(oldData, df, &core.ApplyOptions{Logger: logger.Global()})
+			if err != nil {
+				return err
+			}
+			if output != "" {
+				if err := utils.SafeWrite(output, delta); err != nil {
+					return fmt.Errorf("failed to write delta: %w", err)
+				}
+				i18n.Printf("✓ Git delta written: %s (%s)\n", output, utils.FormatBytes(int64(len(delta))))
+			}
+			if packFile != "" {
+				var buf bytes.Buffer
+				if err := gitdelta.WritePack(&buf, oldData, delta); err != nil {
+					return err
+				}
+				if err := utils.SafeWrite(packFile, buf.Bytes()); err != nil {
+					return fmt.Errorf("failed to write pack: %w", err)
+				}
+				i18n.Printf("✓ Packfile written: %s (%s)\n", packFile, utils.FormatBytes(int64(buf.Len())))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output delta file (default: patch.delta unless --pack is given)")
+	cmd.Flags().StringVar(&packFile, "pack", "", "Also write a packfile with OLD as base and the new file as OBJ_OFS_DELTA")
+	return cmd
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/graph"
+	"bindiff/pkg/i18n"
+	"bindiff/pkg/utils"
+	"bindiff/types"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// GraphCommand 创建版本图命令
+func GraphCommand() *cobra.Command {
+	var graphFile string
+
+	cmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Maintain a version graph and plan the cheapest update path",
+		Long: `Maintain a version graph: the released versions (each optionally
+downloadable in full) and the patches available between them.
+'plan' computes the patch chain with the fewest bytes to download from the
+client's current file to a target version, or picks the full download when
+that is smaller. 'serve --graph' answers the same query over HTTP.`,
+	}
+	cmd.PersistentFlags().StringVarP(&graphFile, "graph", "g", "versions.json", "Version graph file")
+
+	cmd.AddCommand(graphAddVersionCommand(&graphFile))
+	cmd.AddCommand(graphAddPatchCommand(&graphFile))
+	cmd.AddCommand(graphPlanCommand(&graphFile))
+	return cmd
+}
+
+// graphAddVersionCommand 创建添加版本命令
+func graphAddVersionCommand(graphFile *string) *cobra.Command {
+	var url string
+
+	cmd := &cobra.Command{
+		Use:   "add-version NAME FILE",
+		Short: "Add a released version (appended as the latest)",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(args[1])
+			if err != nil {
+				return fmt.Errorf("failed to read file: %w", err)
+			}
+			sum := sha256.Sum256(data)
+			v := graph.Version{Name: args[0], SHA256: hex.EncodeToString(sum[:]), Size: int64(len(data)), URL: url}
+			return updateGraph(*graphFile, func(g *graph.Graph) error {
+				if err := g.AddVersion(v); err != nil {
+					return err
+				}
+				i18n.Printf("✓ Version %s added (%s)\n", v.Name, utils.FormatBytes(v.Size))
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&url, "url", "u", "", "Full download URL of this version")
+	return cmd
+}
+
+// graphAddPatchCommand 创建添加补丁命令
+func graphAddPatchCommand(graphFile *string) *cobra.Command {
+	var url string
+
+	cmd := &cobra.Command{
+		Use:   "add-patch FROM TO PATCH",
+		Short: "Add a patch between two versions",
+		Long: `Add a patch between two versions already in the graph.
+For bindiff patches using SHA-256 the old and new hashes in the patch header
+must match the two versions.`,
+		Args: cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(args[2])
+			if err != nil {
+				return fmt.Errorf("failed to read patch: %w", err)
+			}
+			p := graph.Patch{From: args[0], To: args[1], Size: int64(len(data)), URL: url}
+			return updateGraph(*graphFile, func(g *graph.Graph) error {
+				if err := checkPatchVersions(g, p, data); err != nil {
+					return err
+				}
+				if err := g.AddPatch(p); err != nil {
+					return err
+				}
+				i18n.Printf("✓ Patch %s -> %s added (%s)\n", p.From, p.To, utils.FormatBytes(p.Size))
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&url, "url", "u", "", "Download URL of the patch")
+	return cmd
+}
+
+// graphPlanCommand 创建求解命令
+func graphPlanCommand(graphFile *string) *cobra.Command {
+	var (
+		from     string
+		fromHash string
+		stepCost int64
+		asJSON   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "plan [TARGET]",
+		Short: "Compute the cheapest update path to TARGET (default: latest)",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			g, err := graph.Load(*graphFile)
+			if err != nil {
+				return err
+			}
+			if from != "" {
+				data, err := os.ReadFile(from)
+				if err != nil {
+					return fmt.Errorf("failed to read file: %w", err)
+				}
+				sum := sha256.Sum256(data)
+				fromHash = hex.EncodeToString(sum[:])
+			}
+			target := ""
+			if len(args) == 1 {
+				target = args[0]
+			}
+			plan, err := g.Plan(fromHash, target, &graph.PlanOptions{StepCost: stepCost})
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(plan)
+			}
+
+			switch {
+			case plan.Full:
+				i18n.Printf("✓ Full download of %s: %s\n", plan.Target.Name, utils.FormatBytes(plan.Size))
+				fmt.Printf("  %s\n", plan.Target.URL)
+			case len(plan.Steps) == 0:
+				i18n.Printf("✓ Already at %s\n", plan.Target.Name)
+			default:
+				i18n.Printf("✓ %s -> %s in %d patch(es): %s (full download %s)\n",
+					plan.From, plan.Target.Name, len(plan.Steps), utils.FormatBytes(plan.Size), utils.FormatBytes(plan.Target.Size))
+				for _, p := range plan.Steps {
+					fmt.Printf("  %s -> %s  %s  %s\n", p.From, p.To, utils.FormatBytes(p.Size), p.URL)
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&from, "from", "", "Current file of the client")
+	cmd.Flags().StringVar(&fromHash, "from-hash", "", "SHA-256 of the client's current file")
+	cmd.Flags().Int64Var(&stepCost, "step-cost", 0, "Extra bytes counted per download, favoring shorter chains")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the plan as JSON")
+	return cmd
+}
+
+// updateGraph 读取版本图，修改后写回
+func updateGraph(path string, fn func(g *graph.Graph) error) error {
+	g, err := graph.Load(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(g); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := g.Save(&buf); err != nil {
+		return err
+	}
+	return utils.SafeWrite(path, buf.Bytes())
+}
+
+// checkPatchVersions 检查 bindiff 补丁头中的哈希与两端版本一致
+func checkPatchVersions(g *graph.Graph, p graph.Patch, data []byte) error {
+	df, err := core.DecodeDiffFile(data)
+	if err != nil || df.HashAlgorithm != types.HASH_SHA256 {
+		// 其他格式的补丁无法校验
+		return nil
+	}
+	from, err := g.Version(p.From)
+	if err != nil {
+		return err
+	}
+	to, err := g.Version(p.To)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(df.OldHash) != from.SHA256 || hex.EncodeToString(df.NewHash) != to.SHA256 {
+		return fmt.Errorf("patch does not transform %s into %s", p.From, p.To)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"bindiff/pkg/config"
+	"bindiff/pkg/i18n"
+	"bindiff/pkg/logger"
+	"bindiff/pkg/metrics"
+	"bindiff/pkg/rpc"
+	"bindiff/pkg/trace"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// grpcTokenEnv 未指定 --token-file 时读取认证令牌的环境变量
+const grpcTokenEnv = "BINDIFF_GRPC_TOKEN"
+
+// GRPCServeCommand 创建 gRPC 差分服务命令，getConfig 在执行时返回已加载的配置
+func GRPCServeCommand(getConfig func() *config.Config) *cobra.Command {
+	var (
+		listen     string
+		certFile   string
+		keyFile    string
+		tokenFile  string
+		maxInputMB int64
+		maxTimeout time.Duration
+		metricsAt  string
+		otlpURL    string
+		webhooks   []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "grpc-serve",
+		Short: "Serve diff and apply as a gRPC service",
+		Long: `Serve the bindiff.v1.BinDiff gRPC service (see pkg/rpc/bindiff.proto):
+- ComputeDiff: the client streams old and new file chunks, the server
+  streams back progress messages and the patch
+- ApplyPatch: the client streams old file and patch chunks, the server
+  streams back progress messages and the new file
+Calls honour the client's grpc-timeout deadline, capped by --max-timeout.
+Clients authenticate with "authorization: Bearer <token>"; the token is read
+from --token-file or the ` + grpcTokenEnv + ` environment variable.
+Prometheus metrics are served at /metrics on the same port (same token), and
+without authentication over plain HTTP on --metrics-listen when given.
+With --otlp-endpoint each call is traced and exported over OTLP/HTTP; a
+traceparent in the call metadata becomes the parent of the call's spans.
+Each call sends job.started and job.completed or job.failed events to the
+configured webhooks (see serve).
+gRPC requires HTTP/2, so the service is only offered over TLS.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if certFile == "" || keyFile == "" {
+				return errors.New("--tls-cert and --tls-key are required")
+			}
+			token, err := readToken(tokenFile, grpcTokenEnv)
+			if err != nil {
+				return err
+			}
+
+			cfg := getConfig()
+			m := metrics.New(nil)
+			tracer := newTracer(otlpURL)
+			defer shutdownTracer(tracer)
+			notifier, err := newNotifier(cfg.Webhooks, webhooks)
+			if err != nil {
+				return err
+			}
+			defer closeNotifier(notifier)
+			handler := &rpc.Server{
+				Config:       cfg,
+				Token:        token,
+				MaxInputSize: maxInputMB << 20,
+				MaxTimeout:   maxTimeout,
+				Logger:       logger.Global(),
+				Metrics:      m,
+				Tracer:       tracer,
+				Webhooks:     notifier,
+			}
+			if metricsAt != "" {
+				serveMetrics(metricsAt, m.Registry)
+			}
+			srv := &http.Server{
+				Addr:              listen,
+				Handler:           withMetrics(handler, m.Registry, token),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			logger.Infof("gRPC service listening on %s", listen)
+			i18n.Printf("✓ Serving bindiff.v1.BinDiff on %s\n", listen)
+			return srv.ListenAndServeTLS(certFile, keyFile)
+		},
+	}
+
+	cmd.Flags().StringVar(&listen, "listen", ":9443", "Listen address")
+	cmd.Flags().StringVar(&certFile, "tls-cert", "", "TLS certificate file (PEM)")
+	cmd.Flags().StringVar(&keyFile, "tls-key", "", "TLS private key file (PEM)")
+	cmd.Flags().StringVar(&tokenFile, "token-file", "", "File containing the bearer token clients must send")
+	cmd.Flags().Int64Var(&maxInputMB, "max-input-mb", rpc.DefaultMaxInputSize>>20, "Maximum bytes received per call, in MB")
+	cmd.Flags().DurationVar(&maxTimeout, "max-timeout", 0, "Maximum duration of a call (0 = no limit)")
+	cmd.Flags().StringVar(&metricsAt, "metrics-listen", "", "Also serve /metrics without authentication on this address")
+	cmd.Flags().StringVar(&otlpURL, "otlp-endpoint", trace.EndpointFromEnv(), "OTLP/HTTP traces endpoint, e.g. http://collector:4318/v1/traces (default from OTEL_EXPORTER_OTLP_ENDPOINT)")
+	cmd.Flags().StringSliceVar(&webhooks, "webhook", nil, "URL to POST call events to, in addition to webhooks.urls (repeatable)")
+	return cmd
+}
+
+// readToken 从 tokenFile 或环境变量 env 读取服务的认证令牌，未配置时给出警告
+func readToken(tokenFile, env string) (string, error) {
+	token := os.Getenv(env)
+	if tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read token file: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" {
+		logger.Warnf("No token configured, the service accepts unauthenticated requests")
+	}
+	return token, nil
+}
@@ -0,0 +1,58 @@
+/*
+ * 用 libbindiff 应用补丁的最小示例：
+ *
+ *   go build -buildmode=c-shared -o libbindiff.so ./cmd/libbindiff
+ *   cc -o update cmd/libbindiff/example/update.c -I. -L. -lbindiff
+ *   LD_LIBRARY_PATH=. ./update app-1.0 app-1.0-1.1.bdf app-1.1
+ */
+#include <stdio.h>
+#include <stdlib.h>
+
+#include "libbindiff.h"
+
+static void *read_file(const char *path, size_t *len) {
+	FILE *f = fopen(path, "rb");
+	if (f == NULL) {
+		return NULL;
+	}
+	fseek(f, 0, SEEK_END);
+	long size = ftell(f);
+	fseek(f, 0, SEEK_SET);
+	void *buf = malloc(size > 0 ? size : 1);
+	*len = fread(buf, 1, size, f);
+	fclose(f);
+	return buf;
+}
+
+int main(int argc, char **argv) {
+	if (argc != 4) {
+		fprintf(stderr, "usage: %s OLD PATCH OUTPUT\n", argv[0]);
+		return 2;
+	}
+	size_t old_len, patch_len, out_len;
+	void *old_data = read_file(argv[1], &old_len);
+	void *patch = read_file(argv[2], &patch_len);
+	if (old_data == NULL || patch == NULL) {
+		perror("read");
+		return 1;
+	}
+
+	void *out = NULL;
+	char *err = NULL;
+	int rc = bindiff_apply(old_data, old_len, patch, patch_len, &out, &out_len, &err);
+	if (rc != BINDIFF_OK) {
+		fprintf(stderr, "bindiff_apply failed (%d): %s\n", rc, err);
+		bindiff_free(err);
+		return 1;
+	}
+
+	FILE *f = fopen(argv[3], "wb");
+	if (f == NULL || fwrite(out, 1, out_len, f) != out_len) {
+		perror("write");
+		return 1;
+	}
+	fclose(f);
+	bindiff_free(out);
+	printf("libbindiff %s: %s written (%zu bytes)\n", bindiff_version(), argv[3], out_len);
+	return 0;
+}
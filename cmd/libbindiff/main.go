@@ -0,0 +1,165 @@
+// libbindiff 以 C 共享库导出差分、应用与校验，供 C/C++/Rust/Python 等更新客户端直接嵌入：
+//
+//	go build -buildmode=c-shared -o libbindiff.so ./cmd/libbindiff
+//
+// 同时生成的 libbindiff.h 声明下列函数与 BINDIFF_* 错误码。输出缓冲区与错误信息由库分配，
+// 调用方以 bindiff_free 释放；err 参数可以为 NULL。
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+
+// 返回值
+enum {
+	BINDIFF_OK = 0,
+	BINDIFF_EINVAL = 1,       // 参数无效（空指针等）
+	BINDIFF_ECORRUPT = 2,     // 补丁损坏或格式无效
+	BINDIFF_EUNSUPPORTED = 3, // 补丁版本或哈希算法不受支持
+	BINDIFF_EHASH = 4,        // 旧数据与补丁不匹配，或结果校验失败
+	BINDIFF_ETOOLARGE = 5,    // 数据超出补丁格式的大小限制或配置的资源上限
+	BINDIFF_EINTERNAL = 6     // 其他错误
+};
+*/
+import "C"
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// Version 由构建时的 -ldflags 设置
+var Version = "dev"
+
+// version bindiff_version 返回的字符串，进程内只分配一次
+var version = C.CString(Version)
+
+func main() {}
+
+// bindiff_version 返回库版本，字符串归库所有，不要释放
+//
+//export bindiff_version
+func bindiff_version() *C.char {
+	return version
+}
+
+// bindiff_free 释放库分配的缓冲区或错误信息
+//
+//export bindiff_free
+func bindiff_free(p unsafe.Pointer) {
+	C.free(p)
+}
+
+// bindiff_diff 比较 old_data 与 new_data，生成 .bdf 补丁写入 *patch（长度 *patch_len）
+//
+//export bindiff_diff
+func bindiff_diff(oldData unsafe.Pointer, oldLen C.size_t, newData unsafe.Pointer, newLen C.size_t,
+	patch *unsafe.Pointer, patchLen *C.size_t, errMsg **C.char) (code C.int) {
+	defer recoverInternal(&code, errMsg)
+	if patch == nil || patchLen == nil || (oldData == nil && oldLen > 0) || (newData == nil && newLen > 0) {
+		return fail(errMsg, C.BINDIFF_EINVAL, errors.New("invalid argument"))
+	}
+	out, err := diff(goBytes(oldData, oldLen), goBytes(newData, newLen))
+	if err != nil {
+		return fail(errMsg, errorCode(err), err)
+	}
+	*patch, *patchLen = cBytes(out), C.size_t(len(out))
+	return C.BINDIFF_OK
+}
+
+// bindiff_apply 校验两端哈希并把补丁应用到 old_data，结果写入 *out（长度 *out_len）
+//
+//export bindiff_apply
+func bindiff_apply(oldData unsafe.Pointer, oldLen C.size_t, patch unsafe.Pointer, patchLen C.size_t,
+	out *unsafe.Pointer, outLen *C.size_t, errMsg **C.char) (code C.int) {
+	defer recoverInternal(&code, errMsg)
+	if out == nil || outLen == nil || patch == nil || (oldData == nil && oldLen > 0) {
+		return fail(errMsg, C.BINDIFF_EINVAL, errors.New("invalid argument"))
+	}
+	newData, err := apply(goBytes(oldData, oldLen), goBytes(patch, patchLen))
+	if err != nil {
+		return fail(errMsg, errorCode(err), err)
+	}
+	*out, *outLen = cBytes(newData), C.size_t(len(newData))
+	return C.BINDIFF_OK
+}
+
+// bindiff_verify 校验补丁结构而不应用；old_data 不为 NULL 时同时校验其与补丁记录的旧文件哈希一致
+//
+//export bindiff_verify
+func bindiff_verify(patch unsafe.Pointer, patchLen C.size_t, oldData unsafe.Pointer, oldLen C.size_t,
+	errMsg **C.char) (code C.int) {
+	defer recoverInternal(&code, errMsg)
+	if patch == nil {
+		return fail(errMsg, C.BINDIFF_EINVAL, errors.New("invalid argument"))
+	}
+	df, err := core.DecodeDiffFile(goBytes(patch, patchLen))
+	if err == nil {
+		err = core.ValidateDiffFile(df)
+	}
+	if err == nil && oldData != nil {
+		err = core.VerifyHash(df.HashAlgorithm, goBytes(oldData, oldLen), df.OldHash, nil)
+	}
+	if err != nil {
+		return fail(errMsg, errorCode(err), err)
+	}
+	return C.BINDIFF_OK
+}
+
+// diff 生成补丁文件
+func diff(oldData, newData []byte) ([]byte, error) {
+	return core.CreatePatchFile(oldData, newData, &core.DiffOptions{Config: config.DefaultConfig()})
+}
+
+// apply 校验两端哈希并应用补丁
+func apply(oldData, patch []byte) ([]byte, error) {
+	return core.ApplyPatchFile(oldData, patch, &core.ApplyOptions{Config: config.DefaultConfig()})
+}
+
+// errorCode 把错误映射为 BINDIFF_* 错误码
+func errorCode(err error) C.int {
+	switch {
+	case errors.Is(err, core.ErrHashMismatch):
+		return C.BINDIFF_EHASH
+	case errors.Is(err, core.ErrUnsupportedVersion), errors.Is(err, core.ErrUnsupportedHash):
+		return C.BINDIFF_EUNSUPPORTED
+	case errors.Is(err, core.ErrPatchTooLarge), errors.Is(err, core.ErrLimitExceeded):
+		return C.BINDIFF_ETOOLARGE
+	case errors.Is(err, core.ErrCorruptPatch):
+		return C.BINDIFF_ECORRUPT
+	}
+	return C.BINDIFF_EINTERNAL
+}
+
+// fail 写入错误信息并返回 code
+func fail(errMsg **C.char, code C.int, err error) C.int {
+	if errMsg != nil {
+		*errMsg = C.CString(err.Error())
+	}
+	return code
+}
+
+// recoverInternal 把 panic 转换为 BINDIFF_EINTERNAL，避免终止宿主进程
+func recoverInternal(code *C.int, errMsg **C.char) {
+	if r := recover(); r != nil {
+		*code = fail(errMsg, C.BINDIFF_EINTERNAL, fmt.Errorf("internal error: %v", r))
+	}
+}
+
+// goBytes 以 Go 切片访问调用方的缓冲区，不复制，仅在调用期间使用
+func goBytes(p unsafe.Pointer, n C.size_t) []byte {
+	if p == nil || n == 0 {
+		return []byte{}
+	}
+	return unsafe.Slice((*byte)(p), int(n))
+}
+
+// cBytes 把数据复制到 C 堆上，调用方以 bindiff_free 释放
+func cBytes(b []byte) unsafe.Pointer {
+	p := C.malloc(C.size_t(max(len(b), 1)))
+	copy(unsafe.Slice((*byte)(p), len(b)), b)
+	return p
+}
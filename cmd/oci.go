@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"bindiff/pkg/i18n"
+	"bindiff/pkg/logger"
+	"bindiff/pkg/oci"
+	"bindiff/pkg/utils"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// OCICommand 创建 OCI 镜像增量命令，getConfig 在执行时返回已加载的配置
+func OCICommand(getConfig func() *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "oci",
+		Short: "Build and apply layer-by-layer deltas of OCI images",
+		Long: `Distribute container image updates without a registry:
+- Images are OCI image layout directories or oci-archive tarballs
+- Layers already present in the old image are not transferred
+- Changed layers are shipped as patches against the old image's layers`,
+	}
+
+	cmd.AddCommand(ociDiffCommand(getConfig))
+	cmd.AddCommand(ociApplyCommand(getConfig))
+	return cmd
+}
+
+// ociDiffCommand 创建镜像增量生成命令
+func ociDiffCommand(getConfig func() *config.Config) *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "diff OLD_IMAGE NEW_IMAGE",
+		Short: "Build a delta bundle that upgrades OLD_IMAGE to NEW_IMAGE",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			oldImg, err := oci.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open old image: %w", err)
+			}
+			newImg, err := oci.Open(args[1])
+			if err != nil {
+				return fmt.Errorf("failed to open new image: %w", err)
+			}
+
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create bundle: %w", err)
+			}
+			defer utils.TrackPartial(output)()
+			defer func() {
+				if cerr := f.Close(); err == nil {
+					err = cerr
+				}
+				if err != nil {
+					os.Remove(output)
+				}
+			}()
+
+			bundle, err := oci.Diff(oldImg, newImg, f, &core.DiffOptions{Config: getConfig(), Context: cmd.Context(), Logger: logger.Global()})
+			if err != nil {
+				return err
+			}
+
+			var total, transferred int64
+			for _, l := range bundle.Layers {
+				total += l.Size
+				transferred += l.Transferred
+				fmt.Printf("  %-9s %s %s -> %s\n", l.Kind, l.Digest,
+					utils.FormatBytes(l.Size), utils.FormatBytes(l.Transferred))
+			}
+			i18n.Printf("✓ Bundle written: %s (%d layer(s), %s of %s)\n",
+				output, len(bundle.Layers), utils.FormatBytes(transferred), utils.FormatBytes(total))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "bundle.tar", "Output bundle path")
+	return cmd
+}
+
+// ociApplyCommand 创建镜像增量应用命令
+func ociApplyCommand(getConfig func() *config.Config) *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "apply OLD_IMAGE BUNDLE",
+		Short: "Rebuild the new image from OLD_IMAGE and a delta bundle",
+		Long: `Apply a delta bundle to the old image and write the new image as an
+OCI image layout directory. Every blob is verified against its digest.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			oldImg, err := oci.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open old image: %w", err)
+			}
+			f, err := os.Open(args[1])
+			if err != nil {
+				return fmt.Errorf("failed to open bundle: %w", err)
+			}
+			defer f.Close()
+
+			bundle, err := oci.Apply(oldImg, f, output, &core.ApplyOptions{Config: getConfig(), Context: cmd.Context(), Logger: logger.Global()})
+			if err != nil {
+				return err
+			}
+			i18n.Printf("✓ Image %s written to %s\n", bundle.Target.Digest, output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "image", "Output OCI image layout directory")
+	return cmd
+}
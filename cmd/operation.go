@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"bindiff/pkg/i18n"
+	"bindiff/pkg/logger"
+	"bindiff/pkg/utils"
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// operationIDEnv 未指定 --op-id 时读取的环境变量，流水线可以在多个步骤间传递同一个 ID
+const operationIDEnv = "BINDIFF_OPERATION_ID"
+
+// OperationResult diff 与 apply 的 --json 输出
+type OperationResult struct {
+	OperationID string `json:"operation_id"`
+	Operation   string `json:"operation"`
+	// Output 生成的补丁或结果文件
+	Output          string  `json:"output"`
+	OldSize         int64   `json:"old_size"`
+	NewSize         int64   `json:"new_size"`
+	PatchSize       int64   `json:"patch_size,omitempty"`
+	Patches         int     `json:"patches,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	// Verified 结果文件的哈希已校验
+	Verified bool `json:"verified,omitempty"`
+	// PeakHeapBytes、PeakRSSBytes 操作期间采样到的内存峰值（见 utils.MemoryPeak）
+	PeakHeapBytes uint64 `json:"peak_heap_bytes,omitempty"`
+	PeakRSSBytes  uint64 `json:"peak_rss_bytes,omitempty"`
+}
+
+// operationStats 一次操作的计时与内存峰值采样
+type operationStats struct {
+	start  time.Time
+	memory *utils.MemoryTracker
+}
+
+// startStats 开始计时并在后台采样内存，出错返回时由调用方 defer stop
+func startStats() *operationStats {
+	return &operationStats{start: time.Now(), memory: utils.TrackMemory(0)}
+}
+
+// stop 停止内存采样
+func (s *operationStats) stop() {
+	s.memory.Stop()
+}
+
+// finish 停止采样，把耗时与内存峰值填入 r 并写入性能日志，返回耗时
+func (s *operationStats) finish(r *OperationResult) time.Duration {
+	duration := time.Since(s.start)
+	peak := s.memory.Stop()
+	r.DurationSeconds = duration.Seconds()
+	r.PeakHeapBytes, r.PeakRSSBytes = peak.HeapBytes, peak.RSSBytes
+	logger.NewPerformance().LogPeakMemory(r.Operation, peak)
+	return duration
+}
+
+// printPeakMemory 输出可读的内存峰值
+func printPeakMemory(r OperationResult) {
+	i18n.Printf("  Peak memory: %s heap, %s RSS\n",
+		utils.FormatBytes(int64(r.PeakHeapBytes)), utils.FormatBytes(int64(r.PeakRSSBytes)))
+}
+
+// startOperation 确定本次操作的 ID（--op-id、BINDIFF_OPERATION_ID 或随机生成），并附加到之后的每行日志
+func startOperation(id string) (string, error) {
+	if id == "" {
+		id = os.Getenv(operationIDEnv)
+	}
+	return logger.StartOperation(id)
+}
+
+// printJSONResult 把操作结果以一行 JSON 写到标准输出
+func printJSONResult(r OperationResult) error {
+	return json.NewEncoder(os.Stdout).Encode(r)
+}
+
+// operationContext 返回以 parent 为父（nil 时为 context.Background()）的上下文，timeout 大于 0 时按其超时
+func operationContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if parent == nil {
+		parent = context.Background()
+	}
+	if timeout > 0 {
+		return context.WithTimeout(parent, timeout)
+	}
+	return context.WithCancel(parent)
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"bindiff/pkg/i18n"
+	"bindiff/pkg/logger"
+	"bindiff/pkg/ostree"
+	"bindiff/pkg/utils"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// OSTreeCommand 创建 OSTree 静态增量命令，getConfig 在执行时返回已加载的配置
+func OSTreeCommand(getConfig func() *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ostree",
+		Short: "Generate OSTree static deltas between two commits",
+		Long: `Work with OSTree repositories used by embedded Linux OTA systems:
+- delta writes a static delta (superblock and parts) under REPO/deltas,
+  where 'ostree pull' looks for it
+- Files changed between the commits are sent as patches against the
+  file at the same path in the old commit
+- commit and apply are small helpers for archive repositories`,
+	}
+
+	cmd.AddCommand(ostreeDeltaCommand(getConfig))
+	cmd.AddCommand(ostreeApplyCommand())
+	cmd.AddCommand(ostreeCommitCommand())
+	return cmd
+}
+
+// ostreeDeltaCommand 创建静态增量生成命令
+func ostreeDeltaCommand(getConfig func() *config.Config) *cobra.Command {
+	var (
+		from, to     string
+		maxPartMB    int64
+		minFuzzySize int64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "delta REPO --to REV [--from REV]",
+		Short: "Write a static delta from one commit to another",
+		Long: `Write a static delta from --from to --to into REPO/deltas.
+Without --from a scratch delta containing every object of --to is written.
+REV is a commit checksum or a branch name.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := ostree.Open(args[0])
+			if err != nil {
+				return err
+			}
+			toRev, err := r.Resolve(to)
+			if err != nil {
+				return err
+			}
+			fromRev := ""
+			if from != "" {
+				if fromRev, err = r.Resolve(from); err != nil {
+					return err
+				}
+			}
+
+			delta, err := ostree.GenerateDelta(r, fromRev, toRev, &ostree.DeltaOptions{
+				MaxPartSize:  maxPartMB * 1024 * 1024,
+				MinFuzzySize: minFuzzySize,
+				Diff:         &core.DiffOptions{Config: getConfig(), Logger: logger.Global()},
+			})
+			if err != nil {
+				return err
+			}
+			i18n.Printf("✓ Static delta written: %s (%s, %d part(s), %d object(s), %d sent as patches)\n",
+				delta.Dir, utils.FormatBytes(delta.Size), delta.Parts, delta.Objects, delta.Fuzzy)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&from, "from", "", "Source commit or branch (empty for a scratch delta)")
+	cmd.Flags().StringVar(&to, "to", "", "Target commit or branch")
+	cmd.Flags().Int64Var(&maxPartMB, "max-part-mb", ostree.DefaultMaxPartSize/(1024*1024), "Maximum size of a delta part in MB")
+	cmd.Flags().Int64Var(&minFuzzySize, "min-fuzzy-size", ostree.DefaultMinFuzzySize, "Changed files smaller than this are sent whole")
+	cmd.MarkFlagRequired("to")
+	return cmd
+}
+
+// ostreeApplyCommand 创建静态增量应用命令
+func ostreeApplyCommand() *cobra.Command {
+	var ref string
+
+	cmd := &cobra.Command{
+		Use:   "apply REPO DELTA_DIR",
+		Short: "Import the objects of a static delta into an archive repository",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := ostree.Open(args[0])
+			if err != nil {
+				return err
+			}
+			delta, err := ostree.ApplyDelta(r, args[1])
+			if err != nil {
+				return err
+			}
+			if ref != "" {
+				if err := r.SetRef(ref, delta.To); err != nil {
+					return err
+				}
+			}
+			i18n.Printf("✓ Commit %s imported (%d object(s))\n", delta.To, delta.Objects)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&ref, "ref", "", "Point this branch at the imported commit")
+	return cmd
+}
+
+// ostreeCommitCommand 创建目录提交命令
+func ostreeCommitCommand() *cobra.Command {
+	var (
+		branch   string
+		subject  string
+		initRepo bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "commit REPO DIR --branch BRANCH",
+		Short: "Commit a directory tree to a branch of an archive repository",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var r *ostree.Repo
+			var err error
+			if initRepo {
+				r, err = ostree.Init(args[0])
+			} else {
+				r, err = ostree.Open(args[0])
+			}
+			if err != nil {
+				return err
+			}
+			checksum, err := r.CommitDir(args[1], branch, subject, time.Now())
+			if err != nil {
+				return err
+			}
+			fmt.Printf("✓ %s -> %s\n", branch, checksum)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&branch, "branch", "b", "", "Branch to commit to")
+	cmd.Flags().StringVarP(&subject, "subject", "s", "", "Commit subject")
+	cmd.Flags().BoolVar(&initRepo, "init", false, "Create the repository first")
+	cmd.MarkFlagRequired("branch")
+	return cmd
+}
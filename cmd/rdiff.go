@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"bindiff/pkg/i18n"
+	"bindiff/pkg/rdiff"
+	"bindiff/pkg/utils"
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// SignatureCommand 创建 librsync 兼容的签名命令
+func SignatureCommand() *cobra.Command {
+	var (
+		blockLen int
+		sumLen   int
+		hashAlgo string
+		rollsum  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "signature BASE SIGNATURE",
+		Short: "Write a librsync-compatible signature of BASE",
+		Long: `Write a librsync-compatible signature of BASE (rdiff signature).
+Together with 'delta' and 'patch' this implements the rdiff three-step workflow:
+  bdiff signature BASE base.sig
+  bdiff delta base.sig NEW out.delta
+  bdiff patch BASE out.delta NEW
+Signature and delta files can be exchanged with rdiff and librsync.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			magic, err := signatureMagic(hashAlgo, rollsum)
+			if err != nil {
+				return err
+			}
+			base, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open base file: %w", err)
+			}
+			defer base.Close()
+
+			var buf bytes.Buffer
+			if err := rdiff.WriteSignature(base, &buf, magic, blockLen, sumLen); err != nil {
+				return err
+			}
+			if err := utils.SafeWrite(args[1], buf.Bytes()); err != nil {
+				return fmt.Errorf("failed to write signature: %w", err)
+			}
+			i18n.Printf("✓ Signature written: %s (%d bytes)\n", args[1], buf.Len())
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&blockLen, "block-size", "b", rdiff.DefaultBlockLen, "Signature block length")
+	cmd.Flags().IntVarP(&sumLen, "sum-size", "S", 0, "Strong sum length in bytes (0 = full length)")
+	cmd.Flags().StringVarP(&hashAlgo, "hash", "H", "blake2", "Strong sum algorithm (blake2, md4)")
+	cmd.Flags().StringVarP(&rollsum, "rollsum", "R", "rabinkarp", "Rolling checksum algorithm (rabinkarp, rollsum)")
+	return cmd
+}
+
+// signatureMagic 根据强校验与弱校验算法选择签名魔数
+func signatureMagic(hashAlgo, rollsum string) (rdiff.Magic, error) {
+	switch {
+	case hashAlgo == "blake2" && rollsum == "rabinkarp":
+		return rdiff.RKBlake2SigMagic, nil
+	case hashAlgo == "md4" && rollsum == "rabinkarp":
+		return rdiff.RKMD4SigMagic, nil
+	case hashAlgo == "blake2" && rollsum == "rollsum":
+		return rdiff.Blake2SigMagic, nil
+	case hashAlgo == "md4" && rollsum == "rollsum":
+		return rdiff.MD4SigMagic, nil
+	}
+	return 0, fmt.Errorf("unsupported signature algorithms: --hash %s --rollsum %s", hashAlgo, rollsum)
+}
+
+// DeltaCommand 创建 librsync 兼容的增量命令
+func DeltaCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delta SIGNATURE NEW DELTA",
+		Short: "Write a librsync-compatible delta from a signature to NEW",
+		Args:  cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sigFile, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open signature: %w", err)
+			}
+			defer sigFile.Close()
+			sig, err := rdiff.ReadSignature(sigFile)
+			if err != nil {
+				return err
+			}
+			newData, err := os.ReadFile(args[1])
+			if err != nil {
+				return fmt.Errorf("failed to read new file: %w", err)
+			}
+
+			var buf bytes.Buffer
+			if err := rdiff.WriteDelta(sig, newData, &buf); err != nil {
+				return err
+			}
+			if err := utils.SafeWrite(args[2], buf.Bytes()); err != nil {
+				return fmt.Errorf("failed to write delta: %w", err)
+			}
+			i18n.Printf("✓ Delta written: %s (%d bytes)\n", args[2], buf.Len())
+			return nil
+		},
+	}
+}
+
+// PatchCommand 创建 librsync 兼容的补丁应用命令
+func PatchCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "patch BASE DELTA NEW",
+		Short: "Apply a librsync-compatible delta to BASE and write NEW",
+		Args:  cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			base, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open base file: %w", err)
+			}
+			defer base.Close()
+			delta, err := os.Open(args[1])
+			if err != nil {
+				return fmt.Errorf("failed to open delta: %w", err)
+			}
+			defer delta.Close()
+
+			// 先写入内存，NEW 与 BASE 相同时也不会破坏基准文件
+			var buf bytes.Buffer
+			if err := rdiff.Patch(base, delta, &buf); err != nil {
+				return err
+			}
+			if err := utils.SafeWrite(args[2], buf.Bytes()); err != nil {
+				return fmt.Errorf("failed to write new file: %w", err)
+			}
+			i18n.Printf("✓ Patched file written: %s (%d bytes)\n", args[2], buf.Len())
+			return nil
+		},
+	}
+}
@@ -0,0 +1,703 @@
+package cmd
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"bindiff/pkg/i18n"
+	"bindiff/pkg/ignore"
+	"bindiff/pkg/logger"
+	"bindiff/pkg/repo"
+	"bindiff/pkg/storage"
+	"bindiff/pkg/utils"
+	"bindiff/types"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/cobra"
+)
+
+// RepoCommand 创建仓库命令，getConfig 在执行时返回已加载的配置
+func RepoCommand(getConfig func() *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "repo",
+		Short: "Manage the versioned file repository",
+		Long: `Track file versions in a content-addressed repository:
+- Versions are stored as full or delta objects under the repo directory
+- The repository index records the version history of every path`,
+	}
+
+	cmd.AddCommand(repoCommitCommand(getConfig))
+	cmd.AddCommand(repoLogCommand(getConfig))
+	cmd.AddCommand(repoCheckoutCommand(getConfig))
+	cmd.AddCommand(repoStatusCommand(getConfig))
+	cmd.AddCommand(repoDiffCommand(getConfig))
+	cmd.AddCommand(repoFsckCommand(getConfig))
+	cmd.AddCommand(repoExportCommand(getConfig))
+	cmd.AddCommand(repoImportCommand(getConfig))
+	cmd.AddCommand(repoTagCommand(getConfig))
+	cmd.AddCommand(repoChannelCommand(getConfig))
+	return cmd
+}
+
+// openRepo 打开仓库并加锁，exclusive 为 true 时获取排他锁，调用方负责 Unlock
+func openRepo(getConfig func() *config.Config, exclusive bool) (*repo.Repository, error) {
+	cfg := getConfig()
+	objects, err := openStorage(cfg, "objects")
+	if err != nil {
+		return nil, err
+	}
+	r, err := repo.Open(cfg.RepoDir, &repo.Options{
+		Diff:             &core.DiffOptions{Config: cfg, Logger: logger.Global()},
+		SnapshotInterval: cfg.RepoSnapshotInterval,
+		Chunking:         cfg.RepoChunking,
+		Storage:          objects,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	lock := r.RLock
+	if exclusive {
+		lock = r.Lock
+	}
+	if err := lock(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// openStorage 打开配置中 storage.url 下 prefix 目录的存储后端，未配置时返回 nil（使用本地目录）
+func openStorage(cfg *config.Config, prefix string) (storage.Backend, error) {
+	if cfg.Storage.URL == "" {
+		return nil, nil
+	}
+	b, err := storage.Open(cfg.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage: %w", err)
+	}
+	return storage.Prefixed(b, prefix), nil
+}
+
+// repoCommitCommand 创建提交命令
+func repoCommitCommand(getConfig func() *config.Config) *cobra.Command {
+	var excludes []string
+
+	cmd := &cobra.Command{
+		Use:   "commit PATH...",
+		Short: "Record new versions of files or directories",
+		Long: `Record new versions of files or directories.
+Files under a directory argument that match the gitignore-style patterns in
+./.bindiffignore or --exclude are skipped.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ignored, err := repoIgnore(getConfig().RepoDir, excludes)
+			if err != nil {
+				return err
+			}
+			r, err := openRepo(getConfig, true)
+			if err != nil {
+				return err
+			}
+			defer r.Unlock()
+
+			changed := 0
+			for _, arg := range args {
+				err := filepath.WalkDir(arg, func(p string, d fs.DirEntry, err error) error {
+					if err != nil {
+						return err
+					}
+					// 显式给出的路径总是提交，只过滤目录中的内容
+					if p != arg && ignored(filepath.ToSlash(filepath.Clean(p)), d.IsDir()) {
+						if d.IsDir() {
+							return filepath.SkipDir
+						}
+						return nil
+					}
+					if !d.Type().IsRegular() {
+						return nil
+					}
+					data, err := os.ReadFile(p)
+					if err != nil {
+						return fmt.Errorf("failed to read %s: %w", p, err)
+					}
+					version, ok, err := r.Commit(p, data)
+					if err != nil {
+						return fmt.Errorf("failed to commit %s: %w", p, err)
+					}
+					if ok {
+						changed++
+						logger.Infof("Committed %s (%s object %s)", p, version.Kind, version.Object[:12])
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			if err := r.Save(); err != nil {
+				return err
+			}
+			i18n.Printf("✓ %d file(s) changed\n", changed)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&excludes, "exclude", nil, "Skip paths matching a gitignore-style pattern (repeatable)")
+	return cmd
+}
+
+// repoLogCommand 创建历史命令
+func repoLogCommand(getConfig func() *config.Config) *cobra.Command {
+	var showStat bool
+
+	cmd := &cobra.Command{
+		Use:   "log PATH",
+		Short: "Show the version history of a file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := openRepo(getConfig, false)
+			if err != nil {
+				return err
+			}
+			defer r.Unlock()
+			versions, err := r.History(args[0])
+			if err != nil {
+				return err
+			}
+
+			for i := len(versions) - 1; i >= 0; i-- {
+				v := versions[i]
+				i18n.Printf("version %d  %s\n", i, v.Hash)
+				i18n.Printf("  Date: %s\n", time.Unix(v.Timestamp, 0).Format(time.RFC3339))
+				i18n.Printf("  Size: %s\n", utils.FormatBytes(v.Size))
+				i18n.Printf("  Stored as: %s\n", v.Kind)
+				if showStat {
+					stored, err := r.Store().Size(v.Object)
+					if err != nil {
+						return err
+					}
+					i18n.Printf("  Object size: %s\n", utils.FormatBytes(stored))
+					i18n.Printf("  Chain depth: %d\n", repo.ChainDepth(versions, i))
+				}
+			}
+
+			if showStat {
+				stats, err := r.Stats(args[0])
+				if err != nil {
+					return err
+				}
+				i18n.Printf("\n%d versions: %d full, %d delta, max chain depth %d\n",
+					stats.Versions, stats.Full, stats.Delta, stats.MaxDepth)
+				i18n.Printf("Stored %s for %s of content\n",
+					utils.FormatBytes(stats.StoredSize), utils.FormatBytes(stats.LogicalSize))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&showStat, "stat", false, "Show object sizes and delta chain statistics")
+	return cmd
+}
+
+// repoCheckoutCommand 创建检出命令
+func repoCheckoutCommand(getConfig func() *config.Config) *cobra.Command {
+	var (
+		version int
+		ref     string
+		outFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "checkout PATH",
+		Short: "Restore a version of a file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := openRepo(getConfig, false)
+			if err != nil {
+				return err
+			}
+			defer r.Unlock()
+			var data []byte
+			if ref != "" {
+				data, err = r.CheckoutRef(args[0], ref)
+			} else {
+				data, err = r.Checkout(args[0], version)
+			}
+			if err != nil {
+				return err
+			}
+
+			if outFile == "" {
+				outFile = args[0]
+			}
+			if err := utils.SafeWrite(outFile, data); err != nil {
+				return fmt.Errorf("failed to write %s: %w", outFile, err)
+			}
+			i18n.Printf("✓ Restored %s (%s)\n", outFile, utils.FormatBytes(int64(len(data))))
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&version, "version", -1, "Version number to restore (default: latest)")
+	cmd.Flags().StringVar(&ref, "ref", "", "Restore the version recorded in a tag or channel")
+	cmd.MarkFlagsMutuallyExclusive("version", "ref")
+	cmd.Flags().StringVarP(&outFile, "output", "o", "", "Output file (default: the tracked path)")
+	return cmd
+}
+
+// repoFsckCommand 创建完整性检查命令
+func repoFsckCommand(getConfig func() *config.Config) *cobra.Command {
+	var repair bool
+
+	cmd := &cobra.Command{
+		Use:   "fsck",
+		Short: "Verify the integrity of the repository",
+		Long: `Verify every version in the repository index:
+- Reads each stored object and checks it against its content hash
+- Reconstructs every delta chain and re-hashes the result
+- With --repair, rewrites broken versions as full snapshots when the same
+  content can still be reconstructed from another path or version`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := openRepo(getConfig, repair)
+			if err != nil {
+				return err
+			}
+			defer r.Unlock()
+			report, err := r.Fsck(repair)
+			if err != nil {
+				return err
+			}
+
+			for _, p := range report.Problems {
+				fmt.Printf("✗ %s\n", p)
+			}
+			for _, id := range report.Unreferenced {
+				logger.Debugf("Unreferenced object %s", id)
+			}
+
+			i18n.Printf("Checked %d file(s), %d version(s), %d object(s)\n",
+				report.Files, report.Versions, report.Objects)
+			if len(report.Unreferenced) > 0 {
+				i18n.Printf("%d unreferenced object(s)\n", len(report.Unreferenced))
+			}
+			if n := report.Unrepaired(); n > 0 {
+				return fmt.Errorf("repository has %d unrepaired problem(s)", n)
+			}
+			i18n.Println("✓ Repository is consistent")
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&repair, "repair", false, "Rewrite broken versions from redundant copies when possible")
+	return cmd
+}
+
+// repoStatusCommand 创建状态命令
+func repoStatusCommand(getConfig func() *config.Config) *cobra.Command {
+	var (
+		estimate bool
+		excludes []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "List working tree files that differ from their latest version",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ignored, err := repoIgnore(getConfig().RepoDir, excludes)
+			if err != nil {
+				return err
+			}
+			r, err := openRepo(getConfig, false)
+			if err != nil {
+				return err
+			}
+			defer r.Unlock()
+			statuses, err := r.Status(os.DirFS("."), &repo.StatusOptions{
+				Estimate: estimate,
+				Ignore:   func(p string) bool { return ignored(p, false) },
+			})
+			if err != nil {
+				return err
+			}
+
+			if len(statuses) == 0 {
+				i18n.Println("✓ Working tree matches the repository")
+				return nil
+			}
+			for _, s := range statuses {
+				line := fmt.Sprintf("%-9s %s", statusLabel(s.Kind), s.Path)
+				if s.Kind == types.FILE_RENAMED {
+					line = fmt.Sprintf("%-9s %s -> %s", statusLabel(s.Kind), s.OldPath, s.Path)
+				}
+				if estimate && s.Kind != types.FILE_REMOVED {
+					line += fmt.Sprintf("  (~%s delta)", utils.FormatBytes(s.EstimatedDelta))
+				}
+				fmt.Println(line)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&estimate, "estimate", false, "Estimate the delta size of each changed file")
+	cmd.Flags().StringArrayVar(&excludes, "exclude", nil, "Skip paths matching a gitignore-style pattern (repeatable)")
+	return cmd
+}
+
+// repoDiffCommand 创建工作区差分命令
+func repoDiffCommand(getConfig func() *config.Config) *cobra.Command {
+	var excludes []string
+
+	cmd := &cobra.Command{
+		Use:   "diff [PATH...]",
+		Short: "Show the delta between working tree files and their latest version",
+		Long: `Compute the delta between files on disk and their latest committed version.
+Without arguments, every modified tracked file in the working tree that is not
+excluded by ./.bindiffignore or --exclude is compared.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := openRepo(getConfig, false)
+			if err != nil {
+				return err
+			}
+			defer r.Unlock()
+
+			if len(args) == 0 {
+				ignored, err := repoIgnore(getConfig().RepoDir, excludes)
+				if err != nil {
+					return err
+				}
+				statuses, err := r.Status(os.DirFS("."), &repo.StatusOptions{
+					Ignore: func(p string) bool { return ignored(p, false) },
+				})
+				if err != nil {
+					return err
+				}
+				for _, s := range statuses {
+					if s.Kind == types.FILE_MODIFIED {
+						args = append(args, s.Path)
+					}
+				}
+			}
+
+			for _, p := range args {
+				old, err := r.Checkout(p, -1)
+				if err != nil {
+					return err
+				}
+				data, err := os.ReadFile(p)
+				if err != nil {
+					return fmt.Errorf("failed to read %s: %w", p, err)
+				}
+				patches, err := core.DiffBytes(old, data, &core.DiffOptions{Config: getConfig(), Logger: logger.Global()})
+				if err != nil {
+					return fmt.Errorf("failed to diff %s: %w", p, err)
+				}
+
+				var inserted, removed int64
+				for _, patch := range patches {
+					switch patch.Op {
+					case types.OP_INSERT:
+						inserted += int64(len(patch.Data))
+					case types.OP_REPLACE:
+						inserted += int64(len(patch.Data))
+						removed += patch.Length
+					case types.OP_DELETE:
+						removed += patch.Length
+					}
+				}
+				fmt.Printf("%s: %s -> %s\n", p, utils.FormatBytes(int64(len(old))), utils.FormatBytes(int64(len(data))))
+				i18n.Printf("  %d operation(s), +%s -%s, delta %s\n", len(patches),
+					utils.FormatBytes(inserted), utils.FormatBytes(removed),
+					utils.FormatBytes(core.EncodedPatchSize(patches)))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&excludes, "exclude", nil, "Skip paths matching a gitignore-style pattern (repeatable)")
+	return cmd
+}
+
+// repoIgnore 返回工作区的忽略判断函数：仓库目录本身，以及 ./.bindiffignore 与 excludes 中的规则。
+// 路径相对于当前目录，上级目录被忽略时其中的路径同样被忽略
+func repoIgnore(repoDir string, excludes []string) (func(p string, isDir bool) bool, error) {
+	m, err := ignore.Load(os.DirFS("."), excludes...)
+	if err != nil {
+		return nil, err
+	}
+	isRepo := ignoreRepoDir(repoDir)
+	return func(p string, isDir bool) bool {
+		return isRepo(p) || m.Ignored(p, isDir)
+	}, nil
+}
+
+// ignoreRepoDir 返回忽略仓库目录本身的过滤函数，路径相对于当前目录
+func ignoreRepoDir(repoDir string) func(string) bool {
+	rel := repoDir
+	if filepath.IsAbs(repoDir) {
+		if wd, err := os.Getwd(); err == nil {
+			if r, err := filepath.Rel(wd, repoDir); err == nil {
+				rel = r
+			}
+		}
+	}
+	rel = filepath.ToSlash(filepath.Clean(rel))
+	return func(p string) bool {
+		return p == rel
+	}
+}
+
+// statusLabel 返回文件状态的显示名称
+func statusLabel(kind types.FileChangeKind) string {
+	switch kind {
+	case types.FILE_ADDED:
+		return "added"
+	case types.FILE_REMOVED:
+		return "missing"
+	case types.FILE_RENAMED:
+		return "renamed"
+	default:
+		return "modified"
+	}
+}
+
+// repoExportCommand 创建导出命令
+func repoExportCommand(getConfig func() *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "export ARCHIVE",
+		Short: "Export the repository as a portable archive",
+		Long: `Serialize the repository index and blob store into a single archive.
+The archive is gzip-compressed when its name ends in .gz or .tgz, and
+zstd-compressed when it ends in .zst or .tzst.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			r, err := openRepo(getConfig, false)
+			if err != nil {
+				return err
+			}
+			defer r.Unlock()
+
+			f, err := os.Create(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to create archive: %w", err)
+			}
+			defer utils.TrackPartial(args[0])()
+			defer func() {
+				if cerr := f.Close(); err == nil {
+					err = cerr
+				}
+				if err != nil {
+					os.Remove(args[0])
+				}
+			}()
+
+			w, err := archiveWriter(f, archiveCompression(args[0]))
+			if err != nil {
+				return fmt.Errorf("failed to create archive: %w", err)
+			}
+			defer func() {
+				if cerr := w.Close(); err == nil {
+					err = cerr
+				}
+			}()
+			if err := r.Export(w); err != nil {
+				return err
+			}
+			i18n.Printf("✓ Exported %d file(s) to %s\n", len(r.Files()), args[0])
+			return nil
+		},
+	}
+}
+
+// repoImportCommand 创建导入命令
+func repoImportCommand(getConfig func() *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "import ARCHIVE",
+		Short: "Restore an exported archive into an empty repository",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := openRepo(getConfig, true)
+			if err != nil {
+				return err
+			}
+			defer r.Unlock()
+
+			f, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open archive: %w", err)
+			}
+			defer f.Close()
+
+			rd, err := archiveReader(f, archiveCompression(args[0]))
+			if err != nil {
+				return fmt.Errorf("failed to open archive: %w", err)
+			}
+			defer rd.Close()
+			if err := r.Import(rd); err != nil {
+				return err
+			}
+			i18n.Printf("✓ Imported %d file(s) from %s\n", len(r.Files()), args[0])
+			return nil
+		},
+	}
+}
+
+// 归档的压缩方式
+const (
+	archiveNone = ""
+	archiveGzip = "gzip"
+	archiveZstd = "zstd"
+)
+
+// archiveCompression 根据归档文件名判断压缩方式
+func archiveCompression(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".gz"), strings.HasSuffix(name, ".tgz"):
+		return archiveGzip
+	case strings.HasSuffix(name, ".zst"), strings.HasSuffix(name, ".tzst"):
+		return archiveZstd
+	default:
+		return archiveNone
+	}
+}
+
+// archiveWriter 按压缩方式包装归档的输出，Close 写完压缩流但不关闭 w
+func archiveWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case archiveGzip:
+		return gzip.NewWriter(w), nil
+	case archiveZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+// archiveReader 按压缩方式包装归档的输入，Close 不关闭 r
+func archiveReader(r io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case archiveGzip:
+		return gzip.NewReader(r)
+	case archiveZstd:
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	default:
+		return io.NopCloser(r), nil
+	}
+}
+
+// nopWriteCloser 为不压缩的归档提供空的 Close
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close 实现 io.Closer
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// repoTagCommand 创建标签命令
+func repoTagCommand(getConfig func() *config.Config) *cobra.Command {
+	var remove bool
+
+	cmd := &cobra.Command{
+		Use:   "tag [NAME]",
+		Short: "Name the current repository state, or list tags",
+		Long: `Record the latest version of every tracked file under a tag name.
+Without arguments, list existing tags. Use -d to delete a tag.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := openRepo(getConfig, len(args) > 0)
+			if err != nil {
+				return err
+			}
+			defer r.Unlock()
+
+			if len(args) == 0 {
+				for _, name := range r.Tags() {
+					tag, _ := r.Resolve(name)
+					fmt.Printf("%-20s %s  %d file(s)\n", name,
+						time.Unix(tag.Timestamp, 0).Format(time.RFC3339), len(tag.Files))
+				}
+				return nil
+			}
+
+			if remove {
+				err = r.DeleteTag(args[0])
+			} else {
+				err = r.Tag(args[0])
+			}
+			if err != nil {
+				return err
+			}
+			if err := r.Save(); err != nil {
+				return err
+			}
+			if remove {
+				i18n.Printf("✓ Deleted tag %s\n", args[0])
+			} else {
+				i18n.Printf("✓ Tagged %d file(s) as %s\n", len(r.Files()), args[0])
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&remove, "delete", "d", false, "Delete the tag")
+	return cmd
+}
+
+// repoChannelCommand 创建通道命令
+func repoChannelCommand(getConfig func() *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "channel [NAME TAG]",
+		Short: "Point a release channel at a tag, or list channels",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 && len(args) != 2 {
+				return fmt.Errorf("expected no arguments or NAME TAG, got %d argument(s)", len(args))
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := openRepo(getConfig, len(args) > 0)
+			if err != nil {
+				return err
+			}
+			defer r.Unlock()
+
+			if len(args) == 0 {
+				channels := r.Channels()
+				names := make([]string, 0, len(channels))
+				for name := range channels {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					fmt.Printf("%-12s -> %s\n", name, channels[name])
+				}
+				return nil
+			}
+
+			if err := r.SetChannel(args[0], args[1]); err != nil {
+				return err
+			}
+			if err := r.Save(); err != nil {
+				return err
+			}
+			i18n.Printf("✓ Channel %s now points to %s\n", args[0], args[1])
+			return nil
+		},
+	}
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"bindiff/pkg/i18n"
+	"bindiff/pkg/logger"
+	"bindiff/pkg/utils"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// RestoreCommand 创建恢复命令：列出 apply --backup 生成的备份，或用其中一个替换文件
+func RestoreCommand() *cobra.Command {
+	var backup bool
+
+	cmd := &cobra.Command{
+		Use:   "restore FILE [BACKUP]",
+		Short: "List or restore backups made by apply --backup",
+		Long: `Without BACKUP, list the backups of FILE (FILE.backup.<time>), newest first.
+BACKUP selects the backup to restore: its number in the list (1 = newest),
+"latest", or a path. FILE is replaced atomically; with --backup the current
+FILE is backed up first so the restore can itself be undone.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file := args[0]
+			backups, err := utils.ListBackups(file)
+			if err != nil {
+				return err
+			}
+			if len(args) == 1 {
+				return printBackups(file, backups)
+			}
+
+			src, err := selectBackup(backups, args[1])
+			if err != nil {
+				return err
+			}
+			// 此处不按保留策略清理，以免删除要恢复的备份
+			if backup {
+				if _, err := os.Stat(file); err == nil {
+					saved, err := utils.BackupFile(file)
+					if err != nil {
+						return err
+					}
+					logger.Infof("Current file backed up to %s", saved)
+				}
+			}
+			if err := utils.RestoreBackup(src, file); err != nil {
+				return err
+			}
+			logger.Infof("Restored %s from %s", file, src)
+			i18n.Printf("✓ Restored %s from %s\n", file, src)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&backup, "backup", false, "Back up the current FILE before restoring")
+
+	return cmd
+}
+
+// printBackups 列出备份
+func printBackups(file string, backups []utils.Backup) error {
+	if len(backups) == 0 {
+		i18n.Printf("No backups of %s\n", file)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tTIME\tSIZE\tPATH")
+	for i, b := range backups {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i+1, b.Time.Format(time.RFC3339), utils.FormatBytes(b.Size), b.Path)
+	}
+	return w.Flush()
+}
+
+// selectBackup 按序号、latest 或路径选择备份
+func selectBackup(backups []utils.Backup, sel string) (string, error) {
+	if sel == "latest" {
+		sel = "1"
+	}
+	if n, err := strconv.Atoi(sel); err == nil {
+		if n < 1 || n > len(backups) {
+			return "", fmt.Errorf("backup %d not found: %d backup(s) available", n, len(backups))
+		}
+		return backups[n-1].Path, nil
+	}
+	for _, b := range backups {
+		if b.Path == sel || filepath.Base(b.Path) == sel {
+			return b.Path, nil
+		}
+	}
+	if _, err := os.Stat(sel); err != nil {
+		return "", fmt.Errorf("backup not found: %w", err)
+	}
+	return sel, nil
+}
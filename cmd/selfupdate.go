@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/i18n"
+	"bindiff/pkg/logger"
+	"bindiff/pkg/update"
+	"bindiff/pkg/utils"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// SelfUpdateCommand 创建自更新签名与应用命令
+func SelfUpdateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "selfupdate",
+		Short: "Sign patches for pkg/update and apply them to executables",
+		Long: `Publish delta self-updates for Go programs using bindiff/pkg/update:
+- keygen creates an Ed25519 key pair; embed the public key in the program
+- sign writes PATCH.sig next to the patch; serve both over HTTP
+- apply downloads, verifies and installs a patch the way pkg/update does`,
+	}
+
+	cmd.AddCommand(selfUpdateKeygenCommand())
+	cmd.AddCommand(selfUpdateSignCommand())
+	cmd.AddCommand(selfUpdateApplyCommand())
+	return cmd
+}
+
+// selfUpdateKeygenCommand 创建密钥生成命令
+func selfUpdateKeygenCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "keygen NAME",
+		Short: "Write NAME.key (private) and NAME.pub (public), base64-encoded",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pub, priv, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				return err
+			}
+			keyFile, pubFile := args[0]+".key", args[0]+".pub"
+			if _, err := os.Stat(keyFile); err == nil {
+				return fmt.Errorf("%s already exists", keyFile)
+			}
+			if err := os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(priv.Seed())+"\n"), 0600); err != nil {
+				return err
+			}
+			if err := utils.SafeWrite(pubFile, []byte(base64.StdEncoding.EncodeToString(pub)+"\n")); err != nil {
+				return err
+			}
+			i18n.Printf("✓ Key pair written: %s, %s\n", keyFile, pubFile)
+			return nil
+		},
+	}
+}
+
+// selfUpdateSignCommand 创建补丁签名命令
+func selfUpdateSignCommand() *cobra.Command {
+	var (
+		keyFile string
+		output  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "sign PATCH --key NAME.key",
+		Short: "Sign a patch, writing PATCH.sig",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keyData, err := os.ReadFile(keyFile)
+			if err != nil {
+				return fmt.Errorf("failed to read key: %w", err)
+			}
+			key, err := update.ParsePrivateKey(string(keyData))
+			if err != nil {
+				return err
+			}
+			patch, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read patch: %w", err)
+			}
+			if _, err := core.DecodeDiffFile(patch); err != nil {
+				return fmt.Errorf("failed to decode patch: %w", err)
+			}
+			if output == "" {
+				output = args[0] + ".sig"
+			}
+			sig := base64.StdEncoding.EncodeToString(update.Sign(key, patch)) + "\n"
+			if err := utils.SafeWrite(output, []byte(sig)); err != nil {
+				return fmt.Errorf("failed to write signature: %w", err)
+			}
+			i18n.Printf("✓ Signature written: %s\n", output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&keyFile, "key", "k", "", "Private key file from 'selfupdate keygen'")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Signature file (default: PATCH.sig)")
+	cmd.MarkFlagRequired("key")
+	return cmd
+}
+
+// selfUpdateApplyCommand 创建自更新应用命令
+func selfUpdateApplyCommand() *cobra.Command {
+	var (
+		pubFile string
+		sigURL  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "apply TARGET PATCH_URL --pub NAME.pub",
+		Short: "Download a signed patch and replace TARGET with the patched file",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pubData, err := os.ReadFile(pubFile)
+			if err != nil {
+				return fmt.Errorf("failed to read public key: %w", err)
+			}
+			pub, err := update.ParsePublicKey(string(pubData))
+			if err != nil {
+				return err
+			}
+			res, err := update.Apply(context.Background(), args[1], &update.Options{
+				PublicKey:    pub,
+				SignatureURL: sigURL,
+				TargetPath:   args[0],
+				Apply:        &core.ApplyOptions{Logger: logger.Global()},
+			})
+			if err != nil {
+				return err
+			}
+			i18n.Printf("✓ %s updated: %s -> %s (patch %s)\n", res.Path,
+				utils.FormatBytes(res.OldSize), utils.FormatBytes(res.NewSize), utils.FormatBytes(res.PatchSize))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&pubFile, "pub", "", "Public key file from 'selfupdate keygen'")
+	cmd.Flags().StringVar(&sigURL, "sig-url", "", "Signature URL (default: PATCH_URL.sig)")
+	cmd.MarkFlagRequired("pub")
+	return cmd
+}
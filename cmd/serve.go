@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"bindiff/pkg/config"
+	"bindiff/pkg/graph"
+	"bindiff/pkg/i18n"
+	"bindiff/pkg/jobs"
+	"bindiff/pkg/logger"
+	"bindiff/pkg/metrics"
+	"bindiff/pkg/rpc"
+	"bindiff/pkg/trace"
+	"bindiff/pkg/utils"
+	"bindiff/pkg/webhook"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// apiTokenEnv 未指定 --token-file 时读取 REST API 认证令牌的环境变量
+const apiTokenEnv = "BINDIFF_API_TOKEN"
+
+// ServeCommand 创建 REST API 服务命令，getConfig 在执行时返回已加载的配置
+func ServeCommand(getConfig func() *config.Config) *cobra.Command {
+	var (
+		listen     string
+		dataDir    string
+		workers    int
+		maxQueued  int
+		maxInputMB int64
+		jobTimeout time.Duration
+		certFile   string
+		keyFile    string
+		tokenFile  string
+		metricsAt  string
+		otlpURL    string
+		graphFile  string
+		webhooks   []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve a REST API that runs diff and apply jobs asynchronously",
+		Long: `Serve a REST API backed by a persistent job queue:
+  POST   /v1/jobs/diff         multipart form with files "old" and "new"
+  POST   /v1/jobs/apply        multipart form with files "old" and "patch"
+  GET    /v1/jobs              list jobs
+  GET    /v1/jobs/{id}         job status and progress
+  GET    /v1/jobs/{id}/result  download the patch or new file
+  DELETE /v1/jobs/{id}         cancel and delete a job
+  GET    /metrics              Prometheus metrics
+  GET    /v1/plan?from=&to=    cheapest update path (with --graph)
+  GET    /v1/versions          version graph (with --graph)
+Jobs run on --workers workers. Inputs, status and results are kept in
+--data-dir; unfinished jobs are resumed after a restart. When storage.url is
+set in the config, results are stored under its jobs/ prefix instead.
+Clients authenticate with "Authorization: Bearer <token>"; the token is read
+from --token-file or the ` + apiTokenEnv + ` environment variable.
+/metrics requires the same token; --metrics-listen additionally serves it
+without authentication on a separate plain HTTP address.
+With --otlp-endpoint each job is traced (read, diff stages, encode or
+decode/verify/apply, write) and exported over OTLP/HTTP; a traceparent
+header on the submit request becomes the parent of the job's spans.
+Job lifecycle events (job.queued, job.started, job.completed, job.failed)
+are POSTed as JSON to the webhooks.urls in the config and --webhook URLs,
+signed with HMAC-SHA256 when webhooks.secret or ` + webhookSecretEnv + ` is set.
+With --graph the server answers update path queries from a version graph
+maintained with 'bdiff graph'; the file is reloaded when it changes.
+With --tls-cert and --tls-key the gRPC service (see grpc-serve) is served
+on the same port.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if (certFile == "") != (keyFile == "") {
+				return errors.New("--tls-cert and --tls-key must be given together")
+			}
+			token, err := readToken(tokenFile, apiTokenEnv)
+			if err != nil {
+				return err
+			}
+
+			cfg := getConfig()
+			results, err := openStorage(cfg, "jobs")
+			if err != nil {
+				return err
+			}
+			m := metrics.New(nil)
+			tracer := newTracer(otlpURL)
+			defer shutdownTracer(tracer)
+			notifier, err := newNotifier(cfg.Webhooks, webhooks)
+			if err != nil {
+				return err
+			}
+			defer closeNotifier(notifier)
+			queue, err := jobs.Open(dataDir, jobs.Options{
+				Config:    cfg,
+				Workers:   workers,
+				MaxQueued: maxQueued,
+				Timeout:   jobTimeout,
+				Logger:    logger.Global(),
+				Storage:   results,
+				Metrics:   m,
+				Tracer:    tracer,
+				Webhooks:  notifier,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to open job queue: %w", err)
+			}
+			defer queue.Close()
+			m.QueueDepth(queue.Pending)
+
+			var handler http.Handler = &jobs.Handler{Queue: queue, Token: token, MaxInputSize: maxInputMB << 20}
+			if certFile != "" {
+				grpc := &rpc.Server{Config: cfg, Token: token, MaxInputSize: maxInputMB << 20, Logger: logger.Global(), Metrics: m, Tracer: tracer, Webhooks: notifier}
+				rest := handler
+				handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+						grpc.ServeHTTP(w, r)
+						return
+					}
+					rest.ServeHTTP(w, r)
+				})
+			}
+			if graphFile != "" {
+				if _, err := graph.Load(graphFile); err != nil {
+					return err
+				}
+				handler = withGraph(handler, &graph.Handler{Path: graphFile}, token)
+			}
+			handler = withMetrics(handler, m.Registry, token)
+			if metricsAt != "" {
+				serveMetrics(metricsAt, m.Registry)
+			}
+			srv := &http.Server{Addr: listen, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+
+			// 收到中断信号时停止接收请求，运行中的任务保持排队状态，下次启动时继续
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			errc := make(chan error, 1)
+			go func() {
+				if certFile != "" {
+					errc <- srv.ListenAndServeTLS(certFile, keyFile)
+				} else {
+					errc <- srv.ListenAndServe()
+				}
+			}()
+			logger.Infof("REST API listening on %s, jobs in %s", listen, dataDir)
+			i18n.Printf("✓ Serving REST API on %s\n", listen)
+
+			select {
+			case err := <-errc:
+				return err
+			case <-ctx.Done():
+			}
+			logger.Infof("Shutting down...")
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			return srv.Shutdown(shutdownCtx)
+		},
+	}
+
+	cmd.Flags().StringVar(&listen, "listen", ":8080", "Listen address")
+	cmd.Flags().StringVar(&dataDir, "data-dir", "bindiff-jobs", "Directory for job inputs, status and results")
+	cmd.Flags().IntVar(&workers, "workers", 2, "Number of jobs run concurrently")
+	cmd.Flags().IntVar(&maxQueued, "max-queued", 100, "Maximum number of queued jobs (0 = no limit)")
+	cmd.Flags().Int64Var(&maxInputMB, "max-input-mb", 1024, "Maximum size of each uploaded file, in MB")
+	cmd.Flags().DurationVar(&jobTimeout, "job-timeout", 0, "Maximum run time of a job (0 = no limit)")
+	cmd.Flags().StringVar(&certFile, "tls-cert", "", "TLS certificate file (PEM)")
+	cmd.Flags().StringVar(&keyFile, "tls-key", "", "TLS private key file (PEM)")
+	cmd.Flags().StringVar(&tokenFile, "token-file", "", "File containing the bearer token clients must send")
+	cmd.Flags().StringVar(&metricsAt, "metrics-listen", "", "Also serve /metrics without authentication on this address")
+	cmd.Flags().StringVar(&otlpURL, "otlp-endpoint", trace.EndpointFromEnv(), "OTLP/HTTP traces endpoint, e.g. http://collector:4318/v1/traces (default from OTEL_EXPORTER_OTLP_ENDPOINT)")
+	cmd.Flags().StringVar(&graphFile, "graph", "", "Version graph file used to answer /v1/plan queries")
+	cmd.Flags().StringSliceVar(&webhooks, "webhook", nil, "URL to POST job events to, in addition to webhooks.urls (repeatable)")
+	return cmd
+}
+
+// webhookSecretEnv 配置中未设置 webhooks.secret 时读取签名密钥的环境变量
+const webhookSecretEnv = "BINDIFF_WEBHOOK_SECRET"
+
+// newNotifier 按配置与命令行的地址创建事件通知器，没有地址时返回 nil
+func newNotifier(cfg config.WebhookConfig, extra []string) (*webhook.Notifier, error) {
+	for _, u := range extra {
+		if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+			return nil, fmt.Errorf("invalid --webhook URL: %s", u)
+		}
+	}
+	urls := append(append([]string{}, cfg.URLs...), extra...)
+	if len(urls) == 0 {
+		return nil, nil
+	}
+	secret := cfg.Secret
+	if secret == "" {
+		secret = os.Getenv(webhookSecretEnv)
+	}
+	if secret == "" {
+		logger.Warnf("No webhook secret configured, job events are sent unsigned")
+	}
+	logger.Infof("Sending job events to %d webhook(s)", len(urls))
+	return webhook.New(webhook.Options{URLs: urls, Secret: secret, Events: cfg.Events, Logger: logger.Global()}), nil
+}
+
+// closeNotifier 投递剩余的事件
+func closeNotifier(n *webhook.Notifier) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := n.Close(ctx); err != nil {
+		logger.Warnf("Some job events were not delivered: %v", err)
+	}
+}
+
+// newTracer 创建导出到 endpoint 的 Tracer，endpoint 为空时返回 nil（不记录跨度）
+func newTracer(endpoint string) *trace.Tracer {
+	if endpoint == "" {
+		return nil
+	}
+	logger.Infof("Exporting traces to %s", endpoint)
+	return trace.NewTracer(trace.NewOTLPExporter(trace.OTLPOptions{
+		Endpoint:    endpoint,
+		ServiceName: os.Getenv("OTEL_SERVICE_NAME"),
+		Headers:     trace.HeadersFromEnv(),
+		OnError: func(err error) {
+			logger.Warnf("%v", err)
+		},
+	}))
+}
+
+// shutdownTracer 导出剩余的跨度
+func shutdownTracer(t *trace.Tracer) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := t.Shutdown(ctx); err != nil {
+		logger.Warnf("Failed to export remaining spans: %v", err)
+	}
+}
+
+// withMetrics 把 GET /metrics 交给 reg 处理，其余请求交给 next；token 非空时 /metrics 同样要求认证
+func withMetrics(next http.Handler, reg *metrics.Registry, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" || strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !utils.BearerAuthorized(r, token) {
+			http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	})
+}
+
+// withGraph 把 /v1/plan 与 /v1/versions 交给版本图处理，其余请求交给 next
+func withGraph(next http.Handler, g *graph.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/plan" && r.URL.Path != "/v1/versions" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !utils.BearerAuthorized(r, token) {
+			http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		g.ServeHTTP(w, r)
+	})
+}
+
+// serveMetrics 在 addr 上以 HTTP 提供不需要认证的 /metrics，供内网的 Prometheus 抓取
+func serveMetrics(addr string, reg *metrics.Registry) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", reg)
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil {
+			logger.Errorf("Metrics listener on %s stopped: %v", addr, err)
+		}
+	}()
+	logger.Infof("Metrics listening on %s", addr)
+}
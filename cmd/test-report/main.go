@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bindiff/pkg/i18n"
 	"bufio"
 	"encoding/json"
 	"encoding/xml"
@@ -131,12 +132,13 @@ type ReportData struct {
 }
 
 var (
-	configFile = flag.String("config", "configs/test-report.yaml", "配置文件路径")
-	format     = flag.String("format", "", "报告格式 (html,json,xml,all)")
-	output     = flag.String("output", "", "输出目录")
-	coverage   = flag.Bool("coverage", false, "生成覆盖率报告")
-	benchmark  = flag.Bool("benchmark", false, "运行基准测试")
-	profile    = flag.Bool("profile", false, "生成性能分析")
+	configFile = flag.String("config", "configs/test-report.yaml", "Configuration file")
+	format     = flag.String("format", "", "Report formats (html,json,xml)")
+	output     = flag.String("output", "", "Output directory")
+	coverage   = flag.Bool("coverage", false, "Generate a coverage report")
+	benchmark  = flag.Bool("benchmark", false, "Run benchmarks")
+	profile    = flag.Bool("profile", false, "Collect CPU and memory profiles")
+	lang       = flag.String("lang", "", "Output language (en, zh; default: from LC_ALL, LC_MESSAGES or LANG)")
 )
 
 // initializeConfig 初始化配置
@@ -145,7 +147,7 @@ func initializeConfig() (*ReportConfig, error) {
 	// 加载基础配置
 	config, err := loadConfig(*configFile)
 	if err != nil {
-		log.Printf("警告: 无法加载配置文件 %s: %v", *configFile, err)
+		log.Print(i18n.Sprintf("Warning: cannot load config file %s: %v", *configFile, err))
 		config = defaultConfig()
 	}
 
@@ -154,7 +156,7 @@ func initializeConfig() (*ReportConfig, error) {
 
 	// 验证配置的有效性
 	if err := validateConfig(config); err != nil {
-		return nil, fmt.Errorf("配置验证失败: %v", err)
+		return nil, fmt.Errorf("invalid configuration: %v", err)
 	}
 
 	return config, nil
@@ -182,7 +184,7 @@ func applyCommandLineOverrides(config *ReportConfig) {
 // validateConfig 验证配置的有效性
 func validateConfig(config *ReportConfig) error {
 	if config.Output.Directory == "" {
-		return fmt.Errorf("输出目录不能为空")
+		return fmt.Errorf("output directory must not be empty")
 	}
 	if len(config.Output.Formats) == 0 {
 		config.Output.Formats = []string{"html"} // 默认格式
@@ -192,7 +194,7 @@ func validateConfig(config *ReportConfig) error {
 	supportedFormats := map[string]bool{"html": true, "json": true, "xml": true}
 	for _, format := range config.Output.Formats {
 		if !supportedFormats[format] {
-			return fmt.Errorf("不支持的报告格式: %s", format)
+			return fmt.Errorf("unsupported report format: %s", format)
 		}
 	}
 
@@ -201,17 +203,17 @@ func validateConfig(config *ReportConfig) error {
 
 // printStartupInfo 显示启动信息
 func printStartupInfo(config *ReportConfig) {
-	fmt.Printf("🚀 BindDiff 测试报告生成器启动\n")
-	fmt.Printf("📋 项目: %s v%s\n", config.Report.ProjectName, config.Report.Version)
-	fmt.Printf("📁 输出目录: %s\n", config.Output.Directory)
-	fmt.Printf("📄 报告格式: %v\n", config.Output.Formats)
+	i18n.Printf("🚀 BindDiff test report generator\n")
+	i18n.Printf("📋 Project: %s v%s\n", config.Report.ProjectName, config.Report.Version)
+	i18n.Printf("📁 Output directory: %s\n", config.Output.Directory)
+	i18n.Printf("📄 Report formats: %v\n", config.Output.Formats)
 }
 
 // setupOutputDirectories 设置输出目录结构
 func setupOutputDirectories(config *ReportConfig) error {
 	// 创建主输出目录
 	if err := os.MkdirAll(config.Output.Directory, 0755); err != nil {
-		return fmt.Errorf("创建主输出目录失败: %v", err)
+		return fmt.Errorf("failed to create output directory: %v", err)
 	}
 
 	// 创建子目录
@@ -219,7 +221,7 @@ func setupOutputDirectories(config *ReportConfig) error {
 	for _, subdir := range subdirs {
 		subdirPath := filepath.Join(config.Output.Directory, subdir)
 		if err := os.MkdirAll(subdirPath, 0755); err != nil {
-			log.Printf("警告: 创建子目录 %s 失败: %v", subdir, err)
+			log.Print(i18n.Sprintf("Warning: failed to create subdirectory %s: %v", subdir, err))
 		}
 	}
 
@@ -241,17 +243,17 @@ func executeTestsAndCollectData(config *ReportConfig) (*ReportData, error) {
 		enabled bool
 		execute func(*ReportData) error
 	}{
-		{"单元测试", config.Testing.UnitTests.Enabled, runUnitTests},
-		{"覆盖率测试", config.Testing.Coverage.Enabled, runCoverageTests},
-		{"基准测试", config.Testing.Benchmark.Enabled, runBenchmarkTests},
-		{"性能分析", config.Testing.Profiling.Enabled, runProfilingTests},
+		{"unit tests", config.Testing.UnitTests.Enabled, runUnitTests},
+		{"coverage tests", config.Testing.Coverage.Enabled, runCoverageTests},
+		{"benchmarks", config.Testing.Benchmark.Enabled, runBenchmarkTests},
+		{"profiling", config.Testing.Profiling.Enabled, runProfilingTests},
 	}
 
 	for _, step := range testSteps {
 		if step.enabled {
-			fmt.Printf("🧪 正在执行%s...\n", step.name)
+			i18n.Printf("🧪 Running %s...\n", i18n.T(step.name))
 			if err := step.execute(reportData); err != nil {
-				log.Printf("警告: %s失败: %v", step.name, err)
+				log.Print(i18n.Sprintf("Warning: %s failed: %v", i18n.T(step.name), err))
 			}
 		}
 	}
@@ -274,14 +276,14 @@ func generateAllReports(reportData *ReportData) error {
 	for _, format := range reportData.Config.Output.Formats {
 		if generator, exists := reportGenerators[format]; exists {
 			if err := generator(reportData); err != nil {
-				errorMsg := fmt.Sprintf("生成%s报告失败: %v", strings.ToUpper(format), err)
+				errorMsg := fmt.Sprintf("failed to generate %s report: %v", strings.ToUpper(format), err)
 				errors = append(errors, errorMsg)
 				log.Print(errorMsg)
 			} else {
-				fmt.Printf("✅ %s报告已生成\n", strings.ToUpper(format))
+				i18n.Printf("✅ %s report generated\n", strings.ToUpper(format))
 			}
 		} else {
-			errorMsg := fmt.Sprintf("不支持的报告格式: %s", format)
+			errorMsg := fmt.Sprintf("unsupported report format: %s", format)
 			errors = append(errors, errorMsg)
 			log.Print(errorMsg)
 		}
@@ -289,7 +291,7 @@ func generateAllReports(reportData *ReportData) error {
 
 	// 如果有错误，返回聚合错误信息
 	if len(errors) > 0 {
-		return fmt.Errorf("报告生成错误: %s", strings.Join(errors, "; "))
+		return fmt.Errorf("report generation failed: %s", strings.Join(errors, "; "))
 	}
 
 	return nil
@@ -298,26 +300,26 @@ func generateAllReports(reportData *ReportData) error {
 // printFinalSummary 显示最终摘要
 func printFinalSummary(reportData *ReportData) {
 	fmt.Println("\n" + strings.Repeat("=", 60))
-	fmt.Println("📋 测试报告摘要")
+	i18n.Println("📋 Test report summary")
 	fmt.Println(strings.Repeat("=", 60))
-	fmt.Printf("📊 总测试数: %d\n", reportData.Summary.TotalTests)
-	fmt.Printf("✅ 通过数: %d\n", reportData.Summary.PassedTests)
+	i18n.Printf("📊 Total tests: %d\n", reportData.Summary.TotalTests)
+	i18n.Printf("✅ Passed: %d\n", reportData.Summary.PassedTests)
 	if reportData.Summary.FailedTests > 0 {
-		fmt.Printf("❌ 失败数: %d\n", reportData.Summary.FailedTests)
+		i18n.Printf("❌ Failed: %d\n", reportData.Summary.FailedTests)
 	}
 	if reportData.Summary.SkippedTests > 0 {
-		fmt.Printf("⏭️  跳过数: %d\n", reportData.Summary.SkippedTests)
+		i18n.Printf("⏭️  Skipped: %d\n", reportData.Summary.SkippedTests)
 	}
 	if reportData.Summary.Coverage > 0 {
-		fmt.Printf("📈 覆盖率: %.1f%%\n", reportData.Summary.Coverage)
+		i18n.Printf("📈 Coverage: %.1f%%\n", reportData.Summary.Coverage)
 	}
-	fmt.Printf("📁 输出目录: %s\n", reportData.OutputDir)
+	i18n.Printf("📁 Output directory: %s\n", reportData.OutputDir)
 	fmt.Println(strings.Repeat("=", 60))
 
 	if reportData.Summary.FailedTests > 0 {
-		fmt.Println("⚠️  存在失败的测试用例，请检查详细报告")
+		i18n.Println("⚠️  Some tests failed, see the detailed report")
 	} else {
-		fmt.Println("🎉 所有测试均通过！")
+		i18n.Println("🎉 All tests passed!")
 	}
 }
 
@@ -333,11 +335,14 @@ func setExitCode(reportData *ReportData) {
 // 解析命令行参数，加载配置，运行测试并生成报告
 func main() {
 	flag.Parse()
+	if err := i18n.SetLanguage(*lang); err != nil {
+		log.Fatal(err)
+	}
 
 	// 初始化并验证配置
 	config, err := initializeConfig()
 	if err != nil {
-		log.Fatalf("配置初始化失败: %v", err)
+		log.Fatal(i18n.Sprintf("Configuration failed: %v", err))
 	}
 
 	// 显示启动信息
@@ -345,18 +350,18 @@ func main() {
 
 	// 设置输出环境
 	if err := setupOutputDirectories(config); err != nil {
-		log.Fatalf("设置输出目录失败: %v", err)
+		log.Fatal(i18n.Sprintf("Failed to set up the output directory: %v", err))
 	}
 
 	// 执行测试并收集数据
 	reportData, err := executeTestsAndCollectData(config)
 	if err != nil {
-		log.Fatalf("测试执行失败: %v", err)
+		log.Fatal(i18n.Sprintf("Test run failed: %v", err))
 	}
 
 	// 生成所有格式的报告
 	if err := generateAllReports(reportData); err != nil {
-		log.Printf("报告生成过程中出现错误: %v", err)
+		log.Print(i18n.Sprintf("Errors while generating reports: %v", err))
 	}
 
 	// 显示最终摘要
@@ -371,12 +376,12 @@ func main() {
 func loadConfig(filename string) (*ReportConfig, error) {
 	data, err := ioutil.ReadFile(filename)
 	if err != nil {
-		return nil, fmt.Errorf("读取配置文件失败: %v", err)
+		return nil, fmt.Errorf("failed to read config file: %v", err)
 	}
 
 	var config ReportConfig
 	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("解析配置文件失败: %v", err)
+		return nil, fmt.Errorf("failed to parse config file: %v", err)
 	}
 
 	return &config, nil
@@ -390,7 +395,7 @@ func defaultConfig() *ReportConfig {
 	// 设置项目基本信息
 	config.Report.ProjectName = "BindDiff"
 	config.Report.Version = "2.0.0"
-	config.Report.Description = "高性能二进制差异分析工具"
+	config.Report.Description = i18n.T("High-performance binary diff tool")
 
 	// 设置输出配置
 	config.Output.Directory = "test-reports"
@@ -414,7 +419,7 @@ func defaultConfig() *ReportConfig {
 	config.Testing.Benchmark.Timeout = "30m"
 
 	// 设置HTML报告配置
-	config.Content.HTML.Title = "BindDiff 测试报告"
+	config.Content.HTML.Title = i18n.T("BindDiff Test Report")
 	config.Content.HTML.Theme = "modern"
 
 	return config
@@ -432,7 +437,7 @@ func runUnitTests(reportData *ReportData) error {
 	// 执行测试命令
 	output, err := executeTestCommand(args)
 	if err != nil {
-		log.Printf("测试执行警告: %v", err)
+		log.Print(i18n.Sprintf("Warning: go test: %v", err))
 	}
 
 	// 解析测试输出结果
@@ -504,17 +509,17 @@ func runCoverageTests(reportData *ReportData) error {
 
 	// 执行覆盖率测试
 	if err := executeCoverageTest(coverageFile); err != nil {
-		return fmt.Errorf("执行覆盖率测试失败: %v", err)
+		return fmt.Errorf("coverage run failed: %v", err)
 	}
 
 	// 生成HTML覆盖率报告
 	if err := generateCoverageHTML(coverageFile, htmlFile); err != nil {
-		return fmt.Errorf("生成HTML覆盖率报告失败: %v", err)
+		return fmt.Errorf("failed to generate the HTML coverage report: %v", err)
 	}
 
 	// 解析覆盖率数据
 	if err := parseCoverageData(coverageFile, reportData); err != nil {
-		return fmt.Errorf("解析覆盖率数据失败: %v", err)
+		return fmt.Errorf("failed to parse coverage data: %v", err)
 	}
 
 	return nil
@@ -625,7 +630,7 @@ func runProfilingTests(reportData *ReportData) error {
 		args := []string{"test", "-cpuprofile=" + cpuProfileFile, "-bench=.", "./test/core/"}
 		cmd := exec.Command("go", args...)
 		if _, err := cmd.CombinedOutput(); err != nil {
-			log.Printf("CPU性能分析失败: %v", err)
+			log.Print(i18n.Sprintf("CPU profiling failed: %v", err))
 		}
 	}
 
@@ -634,7 +639,7 @@ func runProfilingTests(reportData *ReportData) error {
 		args := []string{"test", "-memprofile=" + memProfileFile, "-bench=.", "./test/core/"}
 		cmd := exec.Command("go", args...)
 		if _, err := cmd.CombinedOutput(); err != nil {
-			log.Printf("内存性能分析失败: %v", err)
+			log.Print(i18n.Sprintf("Memory profiling failed: %v", err))
 		}
 	}
 
@@ -678,7 +683,7 @@ func generateHTMLReport(data *ReportData) error {
 	filename := filepath.Join(data.OutputDir, fmt.Sprintf("test-report-%s.html", timestamp))
 
 	tmpl := `<!DOCTYPE html>
-<html lang="zh-CN">
+<html lang="{{lang}}">
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
@@ -725,46 +730,46 @@ func generateHTMLReport(data *ReportData) error {
         <div class="header">
             <h1>{{.Config.Content.HTML.Title}}</h1>
             <p>{{.Config.Report.Description}}</p>
-            <p>生成时间: {{.GeneratedAt.Format "2006-01-02 15:04:05"}}</p>
+            <p>{{t "Generated at"}}: {{.GeneratedAt.Format "2006-01-02 15:04:05"}}</p>
         </div>
         
         <div class="section">
-            <h2>📊 测试概览</h2>
+            <h2>📊 {{t "Overview"}}</h2>
             <div class="stats-grid">
                 <div class="stat-card {{if eq .Summary.FailedTests 0}}success{{else}}danger{{end}}">
                     <div class="stat-number">{{.Summary.TotalTests}}</div>
-                    <div class="stat-label">测试总数</div>
+                    <div class="stat-label">{{t "Total tests"}}</div>
                 </div>
                 <div class="stat-card success">
                     <div class="stat-number">{{.Summary.PassedTests}}</div>
-                    <div class="stat-label">通过测试</div>
+                    <div class="stat-label">{{t "Passed"}}</div>
                 </div>
                 {{if gt .Summary.FailedTests 0}}
                 <div class="stat-card danger">
                     <div class="stat-number">{{.Summary.FailedTests}}</div>
-                    <div class="stat-label">失败测试</div>
+                    <div class="stat-label">{{t "Failed"}}</div>
                 </div>
                 {{end}}
                 {{if gt .Summary.Coverage 0}}
                 <div class="stat-card {{if ge .Summary.Coverage 70}}success{{else if ge .Summary.Coverage 50}}warning{{else}}danger{{end}}">
                     <div class="stat-number">{{printf "%.1f%%" .Summary.Coverage}}</div>
-                    <div class="stat-label">代码覆盖率</div>
+                    <div class="stat-label">{{t "Coverage"}}</div>
                 </div>
                 {{end}}
             </div>
             
             {{if gt .Summary.Coverage 0}}
-            <h3>覆盖率详情</h3>
+            <h3>{{t "Coverage details"}}</h3>
             <div class="coverage-bar">
                 <div class="coverage-fill" style="width: {{.Summary.Coverage}}%"></div>
             </div>
-            <p>当前覆盖率: {{printf "%.1f%%" .Summary.Coverage}} 
+            <p>{{t "Current coverage"}}: {{printf "%.1f%%" .Summary.Coverage}} 
             {{if ge .Summary.Coverage 70}}
-                <span class="badge success">优秀</span>
+                <span class="badge success">{{t "Excellent"}}</span>
             {{else if ge .Summary.Coverage 50}}
-                <span class="badge warning">良好</span>
+                <span class="badge warning">{{t "Good"}}</span>
             {{else}}
-                <span class="badge danger">需要改进</span>
+                <span class="badge danger">{{t "Needs improvement"}}</span>
             {{end}}
             </p>
             {{end}}
@@ -772,7 +777,7 @@ func generateHTMLReport(data *ReportData) error {
         
         {{if .Results}}
         <div class="section">
-            <h2>📝 测试结果</h2>
+            <h2>📝 {{t "Test results"}}</h2>
             <div class="test-results">
                 {{range .Results}}
                 <div class="test-item {{if eq .Status "PASS"}}pass{{else}}fail{{end}}">
@@ -786,27 +791,30 @@ func generateHTMLReport(data *ReportData) error {
         
         {{if .CoverageDetails}}
         <div class="section">
-            <h2>📊 详细覆盖率</h2>
+            <h2>📊 {{t "Detailed coverage"}}</h2>
             <pre>{{.CoverageDetails}}</pre>
         </div>
         {{end}}
         
         {{if .BenchmarkResults}}
         <div class="section">
-            <h2>⚡ 基准测试结果</h2>
+            <h2>⚡ {{t "Benchmark results"}}</h2>
             <pre>{{.BenchmarkResults}}</pre>
         </div>
         {{end}}
         
         <div class="footer">
             <p>{{.Config.Report.ProjectName}} v{{.Config.Report.Version}}</p>
-            <p>测试报告生成器 - 让测试结果一目了然</p>
+            <p>{{t "Test report generator"}}</p>
         </div>
     </div>
 </body>
 </html>`
 
-	t, err := template.New("report").Parse(tmpl)
+	t, err := template.New("report").Funcs(template.FuncMap{
+		"t":    i18n.T,
+		"lang": i18n.Language,
+	}).Parse(tmpl)
 	if err != nil {
 		return err
 	}
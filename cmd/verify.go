@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/i18n"
+	"bindiff/pkg/logger"
+	"bindiff/pkg/utils"
+	"bindiff/types"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// VerifyCommand 创建补丁校验命令
+func VerifyCommand() *cobra.Command {
+	var resultPath string
+
+	cmd := &cobra.Command{
+		Use:   "verify PATCH [OLD]",
+		Short: "Validate a patch file without applying it",
+		Long: `Validate the structure of a patch file without writing any output:
+- Header, hash algorithm and entry encoding
+- Ordered offsets and old data bounds for every entry
+- Total output length against the recorded new size
+- Source file hash when OLD is given
+- Result file hash with --result, pinpointing wrong regions when the patch
+  carries a Merkle tree`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			oldPath := ""
+			if len(args) > 1 {
+				oldPath = args[1]
+			}
+			return runVerify(args[0], oldPath, resultPath)
+		},
+	}
+
+	cmd.Flags().StringVar(&resultPath, "result", "", "Check a result file against the patch, reporting wrong byte ranges when the patch has a Merkle tree")
+
+	return cmd
+}
+
+// runVerify 执行补丁校验
+func runVerify(patchPath, oldPath, resultPath string) error {
+	logger.Infof("Verifying patch %s", patchPath)
+
+	if err := validateFiles(patchPath); err != nil {
+		return err
+	}
+	patchBytes, err := os.ReadFile(patchPath)
+	if err != nil {
+		return fmt.Errorf("failed to read patch file: %w", err)
+	}
+
+	df, err := core.DecodeDiffFile(patchBytes)
+	if err != nil {
+		return fmt.Errorf("failed to decode patch: %w", err)
+	}
+	if err := core.ValidateDiffFile(df); err != nil {
+		return fmt.Errorf("invalid patch: %w", err)
+	}
+
+	if oldPath != "" {
+		if err := validateFiles(oldPath); err != nil {
+			return err
+		}
+		oldHash, err := utils.HashFile(oldPath, df.HashAlgorithm)
+		if err != nil {
+			return err
+		}
+		if !utils.CompareHashes(oldHash, df.OldHash) {
+			return fmt.Errorf("hash mismatch: %s does not match patch source\nExpected: %x\nActual: %x",
+				oldPath, df.OldHash, oldHash)
+		}
+	}
+
+	tree, err := core.DiffFileMerkleTree(df)
+	if err != nil {
+		return fmt.Errorf("invalid patch: %w", err)
+	}
+	if resultPath != "" {
+		if err := validateFiles(resultPath); err != nil {
+			return err
+		}
+		resultData, err := os.ReadFile(resultPath)
+		if err != nil {
+			return fmt.Errorf("failed to read result file: %w", err)
+		}
+		if err := core.VerifyDiffFileResult(df, resultData, nil); err != nil {
+			return fmt.Errorf("%s does not match patch result: %w", resultPath, err)
+		}
+	}
+
+	i18n.Printf("\n✓ Patch is valid: %s\n", patchPath)
+	i18n.Printf("  Version: %d\n", df.Version)
+	i18n.Printf("  Hash algorithm: %s\n", utils.HashAlgorithmName(df.HashAlgorithm))
+	i18n.Printf("  Original size: %s\n", utils.FormatBytes(int64(df.OldSize)))
+	i18n.Printf("  Result size: %s\n", utils.FormatBytes(int64(df.NewSize)))
+	switch df.Format {
+	case types.FORMAT_ARCHIVE:
+		i18n.Printf("  Format: archive (entry-by-entry)\n")
+	case types.FORMAT_DISK:
+		i18n.Printf("  Format: disk image (partition-aware)\n")
+	case types.FORMAT_SQLITE:
+		i18n.Printf("  Format: sqlite (page-level)\n")
+	case types.FORMAT_EXEC:
+		if patch, err := core.DecodeExecPatch(df.Payload); err == nil {
+			i18n.Printf("  Format: %s executable (%d regions)\n", patch.Format, len(patch.Sections))
+		}
+	case types.FORMAT_GZIP:
+		i18n.Printf("  Format: gzip (recompression-aware)\n")
+	}
+	i18n.Printf("  Patch entries: %d\n", core.PatchCount(df))
+	if tree != nil {
+		i18n.Printf("  Merkle tree: %d blocks of %s\n", tree.Blocks(), utils.FormatBytes(tree.BlockSize))
+		i18n.Printf("  Merkle root: %x\n", tree.Root())
+	}
+	if oldPath != "" {
+		i18n.Printf("  ✓ Source hash: PASSED\n")
+	}
+	if resultPath != "" {
+		i18n.Printf("  ✓ Result hash: PASSED\n")
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"bindiff/pkg/utils"
+	"bindiff/types"
+)
+
+// 导出函数的实现不依赖 syscall/js，可在普通构建中测试；main.go 只负责与 JavaScript 之间的转换
+
+// formatNames 补丁负载格式的名称
+var formatNames = map[types.PatchFormat]string{
+	types.FORMAT_RAW:     "raw",
+	types.FORMAT_ARCHIVE: "archive",
+	types.FORMAT_GZIP:    "gzip",
+	types.FORMAT_SQLITE:  "sqlite",
+	types.FORMAT_EXEC:    "exec",
+	types.FORMAT_DISK:    "disk",
+}
+
+// applyPatch 校验两端哈希并应用补丁
+func applyPatch(oldData, patch []byte) ([]byte, error) {
+	return core.ApplyPatchFile(oldData, patch, &core.ApplyOptions{Config: config.DefaultConfig()})
+}
+
+// diff 生成补丁文件
+func diff(oldData, newData []byte) ([]byte, error) {
+	cfg := config.DefaultConfig()
+	// 浏览器中只有一个线程，并行差分没有收益
+	cfg.UseParallel = false
+	return core.CreatePatchFile(oldData, newData, &core.DiffOptions{Config: cfg})
+}
+
+// inspect 返回补丁头信息，键名与 JavaScript 对象的属性一致
+func inspect(patch []byte) (map[string]interface{}, error) {
+	df, err := core.DecodeDiffFile(patch)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"version": int(df.Version),
+		"format":  formatNames[df.Format],
+		"hash":    utils.HashAlgorithmName(df.HashAlgorithm),
+		"oldSize": int(df.OldSize),
+		"newSize": int(df.NewSize),
+		"patches": core.PatchCount(df),
+	}, nil
+}
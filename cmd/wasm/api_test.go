@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bindiff/core"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// 导出函数的 Go 侧测试：main 包无法从 test/ 导入，测试放在包内
+
+// TestDiffAndApplyPatch 测试 diff 生成的补丁可由 applyPatch 还原，且 inspect 返回补丁头信息
+func TestDiffAndApplyPatch(t *testing.T) {
+	oldData := bytes.Repeat([]byte("browser asset "), 200)
+	newData := append(append([]byte{}, oldData[:1000]...), []byte("changed")...)
+	newData = append(newData, oldData[1000:]...)
+
+	patch, err := diff(oldData, newData)
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	got, err := applyPatch(oldData, patch)
+	if err != nil {
+		t.Fatalf("applyPatch failed: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatal("applyPatch result mismatch")
+	}
+
+	info, err := inspect(patch)
+	if err != nil {
+		t.Fatalf("inspect failed: %v", err)
+	}
+	if info["format"] != "raw" || info["hash"] != "sha256" ||
+		info["oldSize"] != len(oldData) || info["newSize"] != len(newData) {
+		t.Errorf("Unexpected inspect result %v", info)
+	}
+	if n, ok := info["patches"].(int); !ok || n == 0 {
+		t.Errorf("Expected patch entries, got %v", info["patches"])
+	}
+}
+
+// TestApplyPatchRejects 测试旧数据不匹配与补丁损坏时 applyPatch 返回错误
+func TestApplyPatchRejects(t *testing.T) {
+	oldData := bytes.Repeat([]byte("a"), 500)
+	patch, err := diff(oldData, append(oldData, 'b'))
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	if _, err := applyPatch([]byte("other"), patch); !errors.Is(err, core.ErrHashMismatch) {
+		t.Errorf("Expected ErrHashMismatch, got %v", err)
+	}
+	if _, err := applyPatch(oldData, patch[:len(patch)/2]); err == nil {
+		t.Error("Expected an error for a truncated patch")
+	}
+	if _, err := inspect([]byte("not a patch")); err == nil {
+		t.Error("Expected an error from inspect for invalid data")
+	}
+}
@@ -0,0 +1,30 @@
+// bindiff WebAssembly 加载器。先加载 Go 发行版中的 wasm_exec.js（$(go env GOROOT)/lib/wasm/wasm_exec.js），
+// 然后：
+//
+//   const bindiff = await loadBindiff("bindiff.wasm");
+//   const newData = await bindiff.applyPatch(oldData, patch);
+//
+// applyPatch 校验补丁两端的哈希，不匹配时以 Error 拒绝。
+
+async function loadBindiff(source) {
+  if (typeof Go === "undefined") {
+    throw new Error("wasm_exec.js must be loaded before bindiff.js");
+  }
+  const go = new Go();
+  let result;
+  if (source instanceof ArrayBuffer || ArrayBuffer.isView(source)) {
+    result = await WebAssembly.instantiate(source, go.importObject);
+  } else if (typeof WebAssembly.instantiateStreaming === "function") {
+    result = await WebAssembly.instantiateStreaming(fetch(source), go.importObject);
+  } else {
+    const resp = await fetch(source);
+    result = await WebAssembly.instantiate(await resp.arrayBuffer(), go.importObject);
+  }
+  // Go 程序常驻运行，main 中注册全局对象 bindiff
+  go.run(result.instance);
+  return globalThis.bindiff;
+}
+
+if (typeof module !== "undefined" && module.exports) {
+  module.exports = { loadBindiff };
+}
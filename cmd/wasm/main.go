@@ -0,0 +1,124 @@
+//go:build js && wasm
+
+// bindiff 的 WebAssembly 构建，向 JavaScript 导出全局对象 bindiff：
+//
+//	bindiff.applyPatch(old: Uint8Array, patch: Uint8Array): Promise<Uint8Array>
+//	bindiff.diff(old: Uint8Array, new: Uint8Array): Promise<Uint8Array>
+//	bindiff.inspect(patch: Uint8Array): Promise<{version, format, hash, oldSize, newSize, patches}>
+//	bindiff.version: string
+//
+// 构建：GOOS=js GOARCH=wasm go build -o bindiff.wasm ./cmd/wasm
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall/js"
+)
+
+// Version 由构建时的 -ldflags 设置
+var Version = "dev"
+
+func main() {
+	api := js.Global().Get("Object").New()
+	api.Set("applyPatch", promiseFunc(2, func(args []js.Value) (js.Value, error) {
+		oldData, err := bytesOf(args[0])
+		if err != nil {
+			return js.Undefined(), err
+		}
+		patch, err := bytesOf(args[1])
+		if err != nil {
+			return js.Undefined(), err
+		}
+		newData, err := applyPatch(oldData, patch)
+		if err != nil {
+			return js.Undefined(), err
+		}
+		return uint8Array(newData), nil
+	}))
+	api.Set("diff", promiseFunc(2, func(args []js.Value) (js.Value, error) {
+		oldData, err := bytesOf(args[0])
+		if err != nil {
+			return js.Undefined(), err
+		}
+		newData, err := bytesOf(args[1])
+		if err != nil {
+			return js.Undefined(), err
+		}
+		patch, err := diff(oldData, newData)
+		if err != nil {
+			return js.Undefined(), err
+		}
+		return uint8Array(patch), nil
+	}))
+	api.Set("inspect", promiseFunc(1, func(args []js.Value) (js.Value, error) {
+		patch, err := bytesOf(args[0])
+		if err != nil {
+			return js.Undefined(), err
+		}
+		info, err := inspect(patch)
+		if err != nil {
+			return js.Undefined(), err
+		}
+		return js.ValueOf(info), nil
+	}))
+	api.Set("version", Version)
+	js.Global().Set("bindiff", api)
+
+	// 保持运行，导出的函数在 Go 程序退出后不可用
+	select {}
+}
+
+// promiseFunc 包装为返回 Promise 的 JavaScript 函数，fn 在单独的 goroutine 中执行，错误以 Error 拒绝
+func promiseFunc(nargs int, fn func(args []js.Value) (js.Value, error)) js.Func {
+	return js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		executor := js.FuncOf(func(this js.Value, p []js.Value) interface{} {
+			resolve, reject := p[0], p[1]
+			go func() {
+				defer func() {
+					if r := recover(); r != nil {
+						reject.Invoke(jsError(fmt.Errorf("internal error: %v", r)))
+					}
+				}()
+				if len(args) != nargs {
+					reject.Invoke(jsError(fmt.Errorf("expected %d arguments, got %d", nargs, len(args))))
+					return
+				}
+				v, err := fn(args)
+				if err != nil {
+					reject.Invoke(jsError(err))
+					return
+				}
+				resolve.Invoke(v)
+			}()
+			return nil
+		})
+		defer executor.Release()
+		return js.Global().Get("Promise").New(executor)
+	})
+}
+
+// bytesOf 复制 Uint8Array（或 ArrayBuffer）的内容
+func bytesOf(v js.Value) ([]byte, error) {
+	if v.InstanceOf(js.Global().Get("ArrayBuffer")) {
+		v = js.Global().Get("Uint8Array").New(v)
+	}
+	if !v.InstanceOf(js.Global().Get("Uint8Array")) {
+		return nil, errors.New("expected a Uint8Array or ArrayBuffer")
+	}
+	b := make([]byte, v.Get("byteLength").Int())
+	js.CopyBytesToGo(b, v)
+	return b, nil
+}
+
+// uint8Array 把数据复制为 JavaScript 的 Uint8Array
+func uint8Array(b []byte) js.Value {
+	v := js.Global().Get("Uint8Array").New(len(b))
+	js.CopyBytesToJS(v, b)
+	return v
+}
+
+// jsError 创建 JavaScript Error
+func jsError(err error) js.Value {
+	return js.Global().Get("Error").New(err.Error())
+}
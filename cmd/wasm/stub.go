@@ -0,0 +1,14 @@
+//go:build !(js && wasm)
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// 非 WebAssembly 构建只用于测试 api.go
+func main() {
+	fmt.Fprintln(os.Stderr, "cmd/wasm must be built with GOOS=js GOARCH=wasm")
+	os.Exit(2)
+}
@@ -0,0 +1,328 @@
+package cmd
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"bindiff/pkg/i18n"
+	"bindiff/pkg/logger"
+	"bindiff/pkg/p2p"
+	"bindiff/pkg/storage"
+	"bindiff/pkg/utils"
+	"bindiff/pkg/zchunk"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// manifestSuffix 清单文件名的后缀
+const manifestSuffix = ".zck.json"
+
+// ZchunkCommand 创建分块清单命令，getConfig 在执行时返回已加载的配置（对象存储凭据）
+func ZchunkCommand(getConfig func() *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "zchunk",
+		Short: "CDN-friendly delta downloads using content-addressed chunks",
+		Long: `zchunk-style delivery over plain HTTP:
+- 'make' splits a file (a release or a patch) into content-defined chunks,
+  compresses each one and stores it under chunks/ named by its SHA-256, and
+  writes a manifest listing the chunks
+- 'fetch' chunks a local file the same way, downloads only the chunks it
+  lacks with ordinary GET requests and reassembles the file
+- 'seed' serves the chunks of local files to peers on the LAN, so fleets
+  updating at the same time fetch most chunks from each other (fetch --peer)
+Chunks never change once written, so CDNs can cache them indefinitely and
+chunks shared between releases are stored and downloaded once.`,
+	}
+
+	cmd.AddCommand(zchunkMakeCommand(getConfig))
+	cmd.AddCommand(zchunkFetchCommand(getConfig))
+	cmd.AddCommand(zchunkSeedCommand(getConfig))
+	return cmd
+}
+
+// zchunkMakeCommand 创建清单生成命令
+func zchunkMakeCommand(getConfig func() *config.Config) *cobra.Command {
+	var (
+		dest      string
+		chunksURL string
+		avgKB     int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "make FILE",
+		Short: "Publish FILE as compressed chunks plus a manifest",
+		Long: `Publish FILE as compressed chunks plus a manifest.
+DEST is a local directory or an object storage URL (default: the directory of
+FILE). The manifest is written to DEST/FILE` + manifestSuffix + ` and the chunks to
+DEST/chunks/; chunks already present are not uploaded again.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read file: %w", err)
+			}
+			if dest == "" {
+				dest = filepath.Dir(args[0])
+			}
+			storageCfg := getConfig().Storage
+			storageCfg.URL = dest
+			backend, err := storage.Open(storageCfg)
+			if err != nil {
+				return err
+			}
+
+			name := filepath.Base(args[0])
+			ctx := cmd.Context()
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			m, stats, err := zchunk.Build(ctx, data, name, storage.Prefixed(backend, "chunks"), &zchunk.BuildOptions{
+				Chunk:     &core.ChunkOptions{MinSize: avgKB << 10 / 4, AvgSize: avgKB << 10, MaxSize: avgKB << 10 * 8},
+				ChunksURL: chunksURL,
+			})
+			if err != nil {
+				return err
+			}
+			var buf bytes.Buffer
+			if _, err := m.WriteTo(&buf); err != nil {
+				return err
+			}
+			if err := backend.Put(ctx, name+manifestSuffix, buf.Bytes()); err != nil {
+				return fmt.Errorf("failed to write manifest: %w", err)
+			}
+			i18n.Printf("✓ Manifest written: %s/%s%s (%d chunks)\n", strings.TrimSuffix(dest, "/"), name, manifestSuffix, len(m.Chunks))
+			i18n.Printf("  Uploaded: %d chunks (%s), already present: %d\n",
+				stats.Uploaded, utils.FormatBytes(stats.Compressed), stats.Existing)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&dest, "dest", "d", "", "Publish directory or object storage URL (default: directory of FILE)")
+	cmd.Flags().StringVar(&chunksURL, "chunks-url", zchunk.DefaultChunksURL, "Chunk directory URL recorded in the manifest, relative to the manifest")
+	cmd.Flags().IntVar(&avgKB, "chunk-kb", core.DefaultChunkAvg>>10, "Average chunk size in KB")
+	return cmd
+}
+
+// zchunkFetchCommand 创建重建命令
+func zchunkFetchCommand(getConfig func() *config.Config) *cobra.Command {
+	var (
+		output      string
+		input       string
+		chunksURL   string
+		concurrency int
+		peers       []string
+		seedAt      string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "fetch MANIFEST",
+		Short: "Reconstruct a file from its manifest, downloading only missing chunks",
+		Long: `Reconstruct a file from its manifest.
+MANIFEST is an http(s) URL, an object storage URL or a local path. Chunks found
+in the input file (default: the existing output file) are reused; the rest are
+downloaded. Every chunk and the result are verified against their SHA-256.
+With --peer, missing chunks are requested from peers first ('zchunk seed' or
+'fetch --seed') and only fetched from the chunk directory when no peer has
+them; --seed keeps serving the result to other peers after the fetch.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			storageCfg := getConfig().Storage
+			data, manifestURL, err := readLocation(ctx, storageCfg, args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read manifest: %w", err)
+			}
+			m, err := zchunk.ReadManifest(bytes.NewReader(data))
+			if err != nil {
+				return err
+			}
+			if chunksURL == "" {
+				if chunksURL, err = m.BaseURL(manifestURL); err != nil {
+					return err
+				}
+			}
+			if output == "" {
+				output = filepath.Base(m.Filename)
+			}
+			if input == "" {
+				input = output
+			}
+			seed, err := os.ReadFile(input)
+			// 默认的输出文件不存在时下载全部的块
+			if err != nil && (cmd.Flags().Changed("input") || !errors.Is(err, os.ErrNotExist)) {
+				return fmt.Errorf("failed to read input file: %w", err)
+			}
+
+			opts := &zchunk.FetchOptions{Concurrency: concurrency}
+			if len(peers) > 0 {
+				opts.Source = p2p.NewPeers(peers)
+			}
+			switch {
+			case storage.IsURL(chunksURL):
+				storageCfg.URL = chunksURL
+				if opts.Storage, err = storage.Open(storageCfg); err != nil {
+					return err
+				}
+			case !strings.HasPrefix(chunksURL, "http://") && !strings.HasPrefix(chunksURL, "https://"):
+				opts.Storage = storage.NewFS(chunksURL)
+			}
+			out, stats, err := zchunk.Fetch(ctx, m, chunksURL, seed, opts)
+			if err != nil {
+				return err
+			}
+			if err := utils.SafeWrite(output, out); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+			i18n.Printf("✓ %s reconstructed (%s reused, %d chunk(s) downloaded, %s)\n",
+				output, utils.FormatBytes(stats.Reused), stats.Chunks, utils.FormatBytes(stats.Downloaded))
+			if len(peers) > 0 {
+				i18n.Printf("  From peers: %s\n", utils.FormatBytes(stats.FromSource))
+			}
+			if seedAt == "" {
+				return nil
+			}
+			seeder := p2p.NewSeeder()
+			seeder.Add(out, manifestChunking(m))
+			return serveSeeder(seedAt, seeder)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file (default: file name from the manifest)")
+	cmd.Flags().StringVarP(&input, "input", "i", "", "Local file to reuse chunks from (default: the output file)")
+	cmd.Flags().StringVar(&chunksURL, "chunks-url", "", "Override the chunk directory URL from the manifest")
+	cmd.Flags().IntVar(&concurrency, "concurrency", zchunk.DefaultConcurrency, "Number of chunks downloaded in parallel")
+	cmd.Flags().StringSliceVar(&peers, "peer", nil, "Peer to request chunks from before the chunk directory (host:port, repeatable)")
+	cmd.Flags().StringVar(&seedAt, "seed", "", "After fetching, serve the file's chunks to peers on this address until interrupted")
+	return cmd
+}
+
+// zchunkSeedCommand 创建对等节点做种命令
+func zchunkSeedCommand(getConfig func() *config.Config) *cobra.Command {
+	var (
+		manifest   string
+		listen     string
+		maxUploads int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "seed FILE...",
+		Short: "Serve the chunks of local files to peers",
+		Long: `Serve the chunks of local files to peers until interrupted.
+FILEs are chunked with the parameters of MANIFEST (default parameters when no
+manifest is given); any version sharing chunks with the release helps. Peers
+verify every chunk against their manifest, so seeders need not be trusted.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var chunking *core.ChunkOptions
+			if manifest != "" {
+				data, _, err := readLocation(context.Background(), getConfig().Storage, manifest)
+				if err != nil {
+					return fmt.Errorf("failed to read manifest: %w", err)
+				}
+				m, err := zchunk.ReadManifest(bytes.NewReader(data))
+				if err != nil {
+					return err
+				}
+				chunking = manifestChunking(m)
+			}
+			seeder := p2p.NewSeeder()
+			seeder.MaxUploads = maxUploads
+			for _, path := range args {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("failed to read file: %w", err)
+				}
+				seeder.Add(data, chunking)
+			}
+			return serveSeeder(listen, seeder)
+		},
+	}
+
+	cmd.Flags().StringVarP(&manifest, "manifest", "m", "", "Manifest whose chunk parameters are used (URL or path)")
+	cmd.Flags().StringVar(&listen, "listen", ":7070", "Listen address")
+	cmd.Flags().IntVar(&maxUploads, "max-uploads", p2p.DefaultMaxUploads, "Maximum number of chunks served at once")
+	return cmd
+}
+
+// manifestChunking 返回清单的分块参数
+func manifestChunking(m *zchunk.Manifest) *core.ChunkOptions {
+	return &core.ChunkOptions{MinSize: m.ChunkMin, AvgSize: m.ChunkAvg, MaxSize: m.ChunkMax}
+}
+
+// serveSeeder 在 addr 上提供块，直到收到中断信号
+func serveSeeder(addr string, seeder *p2p.Seeder) error {
+	srv := &http.Server{Addr: addr, Handler: seeder, ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	logger.Infof("Seeding %d chunks on %s", seeder.Len(), addr)
+	i18n.Printf("✓ Seeding %d chunks on %s\n", seeder.Len(), addr)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// readLocation 从 http(s) URL、对象存储或本地路径读取文件，返回内容与作为相对地址基准的地址
+func readLocation(ctx context.Context, cfg config.StorageConfig, location string) ([]byte, string, error) {
+	if storage.IsURL(location) {
+		b, key, err := storage.OpenObject(cfg, location)
+		if err != nil {
+			return nil, "", err
+		}
+		data, err := b.Get(ctx, key)
+		return data, location, err
+	}
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		data, err := os.ReadFile(location)
+		return data, filepath.ToSlash(location), err
+	}
+
+	return httpGetWithRetry(ctx, location)
+}
+
+// httpGetWithRetry 下载 url 的内容，连接失败或服务暂时不可用时重试；返回重定向后的最终地址
+func httpGetWithRetry(ctx context.Context, url string) (data []byte, finalURL string, err error) {
+	err = utils.RetryWithContext(ctx, utils.RetryOptions{}, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return utils.Permanent(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			io.Copy(io.Discard, resp.Body)
+			return utils.NewStatusError(resp)
+		}
+		if data, err = io.ReadAll(resp.Body); err != nil {
+			return err
+		}
+		// 重定向后以最终地址为基准
+		finalURL = resp.Request.URL.String()
+		return nil
+	})
+	return data, finalURL, err
+}
@@ -1,60 +1,289 @@
 package core
 
+import (
+	"bindiff/pkg/config"
+	"context"
+	"math"
+)
+
+const (
+	// MinAlignConfidence 对齐结果可信的最低置信度，DiffFull 低于该值时回退为偏移量 0
+	MinAlignConfidence = 1.5
+	// confidenceSpan 估计相关值局部趋势时两侧取样的距离
+	confidenceSpan = 16
+)
 
 // 计算两个二进制数据的最佳对齐偏移量
 func ComputeOffset(oldData, newData []byte) int {
-	lenA := len(oldData)
-	lenB := len(newData)
-	
-	// 确定FFT大小
-	n := NextPowerOfTwo(lenA + lenB - 1)
-	
-	// 准备FFT输入
-	fft := NewFFT(n)
-	a := make([]complex128, n)
-	b := make([]complex128, n)
-	
-	for i := 0; i < lenA; i++ {
-		a[i] = complex(float64(oldData[i]), 0)
-	}
-	
-	// 翻转新数据
-	for i := 0; i < lenB; i++ {
-		b[i] = complex(float64(newData[lenB-1-i]), 0)
-	}
-	
-	// 计算FFT
-	aFFT := make([]complex128, n)
-	bFFT := make([]complex128, n)
-	fft.Transform(a, aFFT, false)
-	fft.Transform(b, bFFT, false)
-	
-	// 点乘
-	product := make([]complex128, n)
-	for i := range aFFT {
-		product[i] = aFFT[i] * bFFT[i]
-	}
-	
+	// 不可取消的上下文下不会返回错误
+	offset, _ := ComputeOffsetWithContext(context.Background(), oldData, newData)
+	return offset
+}
+
+// ComputeOffsetWithContext 计算最佳对齐偏移量，在各 FFT 阶段之间检查上下文。
+// 对整个数据做相关，FFT 大小随数据增长，大文件使用 ComputeOffsetHierarchical
+func ComputeOffsetWithContext(ctx context.Context, oldData, newData []byte) (int, error) {
+	align, err := computeAlignment(ctx, oldData, newData, nil)
+	return align.Offset, err
+}
+
+// computeAlignment 以双精度对整个数据做相关，backend 为 nil 时在 CPU 上计算
+func computeAlignment(ctx context.Context, oldData, newData []byte, backend CorrelationBackend) (Alignment, error) {
+	n := NextPowerOfTwo(len(oldData) + len(newData) - 1)
+	corr, err := convolve(ctx, backend, n, fillBytes(oldData), fillReversed(newData))
+	if err != nil {
+		return Alignment{}, err
+	}
+	return peakAlignment(corr, len(oldData), len(newData)), nil
+}
+
+// ComputeOffsetFloat32 以单精度 FFT 计算最佳对齐偏移量：缓冲区与 FFT 表约为双精度的一半，
+// 适合对齐上百 MB 的文件。只需相关值的最大位置，相关峰值接近时可能与双精度的结果不同
+func ComputeOffsetFloat32(ctx context.Context, oldData, newData []byte) (int, error) {
+	n := NextPowerOfTwo(len(oldData) + len(newData) - 1)
+	rfft := realFFT32Plan(n)
+	align, err := computeOffset32(ctx, oldData, newData, rfft, newAlignBuffers32(rfft))
+	return align.Offset, err
+}
+
+// Alignment 对齐结果
+type Alignment struct {
+	// Offset 相关值最大的偏移量：旧数据的位置 j 对应新数据的 j-Offset
+	Offset int
+	// Confidence 相关峰值的置信度，低于 MinAlignConfidence 时峰值与噪声无法区分
+	Confidence float64
+}
+
+// ComputeAlignment 按配置的对齐方式与精度计算对齐偏移量与置信度：winnow 使用指纹对齐
+// （见 LocalAlignments），sampled 只对抽样窗口做相关（见 ComputeOffsetSampled），
+// FFT 在数据过大时使用分层对齐（见 ComputeOffsetHierarchical）。
+// 配置了互相关后端（见 CorrelationBackend）时由该后端计算，忽略 FFTPrecision。
+// 不对低置信度的结果回退，由调用方根据 Confidence 决定；cfg 为 nil 时使用双精度 FFT
+func ComputeAlignment(ctx context.Context, oldData, newData []byte, cfg *config.Config) (Alignment, error) {
+	if cfg != nil && cfg.AlignStrategy == config.AlignStrategyWinnow {
+		return computeWinnow(ctx, oldData, newData)
+	}
+	backend, err := correlationBackend(cfg)
+	if err != nil {
+		return Alignment{}, err
+	}
+	if cfg != nil && cfg.AlignStrategy == config.AlignStrategySampled {
+		return computeSampled(ctx, oldData, newData, cfg.AlignSamples, cfg.AlignSampleSize, backend)
+	}
+	if NextPowerOfTwo(len(oldData)+len(newData)-1) > maxDirectFFTSize {
+		return computeHierarchical(ctx, oldData, newData, backend)
+	}
+	if backend == nil && cfg != nil && cfg.FFTPrecision == config.FFTPrecisionFloat32 {
+		n := NextPowerOfTwo(len(oldData) + len(newData) - 1)
+		rfft := realFFT32Plan(n)
+		return computeOffset32(ctx, oldData, newData, rfft, newAlignBuffers32(rfft))
+	}
+	return computeAlignment(ctx, oldData, newData, backend)
+}
+
+// alignBuffers 对齐计算所需的缓冲区：n 个实数的输入与两个半频谱
+type alignBuffers struct {
+	input []float64
+	spec  [2][]complex128
+}
+
+// newAlignBuffers 按实数 FFT 的大小分配对齐缓冲区
+func newAlignBuffers(rfft *RealFFT) *alignBuffers {
+	bufs := &alignBuffers{input: make([]float64, rfft.n)}
+	for i := range bufs.spec {
+		bufs.spec[i] = make([]complex128, rfft.SpectrumLen())
+	}
+	return bufs
+}
+
+// computeOffset 使用给定的实数 FFT 实例和缓冲区计算偏移量，缓冲区内容会被覆盖
+func computeOffset(ctx context.Context, oldData, newData []byte, rfft *RealFFT, bufs *alignBuffers) (Alignment, error) {
+	corr, err := convolveCPU(ctx, rfft, bufs, fillBytes(oldData), fillReversed(newData))
+	if err != nil {
+		return Alignment{}, err
+	}
+	return peakAlignment(corr, len(oldData), len(newData)), nil
+}
+
+// fillBytes 返回把 data 按字节值写入输入缓冲区的函数
+func fillBytes(data []byte) func(in []float64) {
+	return func(in []float64) {
+		for i, v := range data {
+			in[i] = float64(v)
+		}
+	}
+}
+
+// fillReversed 返回把 data 翻转后写入输入缓冲区的函数
+func fillReversed(data []byte) func(in []float64) {
+	return func(in []float64) {
+		n := len(data)
+		for i := 0; i < n; i++ {
+			in[i] = float64(data[n-1-i])
+		}
+	}
+}
+
+// convolveCPU 以实数 FFT 计算旧序列与翻转后新序列的循环卷积（即互相关）：fillOld 写入旧序列，
+// fillNew 写入翻转后的新序列，写入前输入缓冲区已清零。结果存放在 bufs.input 中
+func convolveCPU(ctx context.Context, rfft *RealFFT, bufs *alignBuffers, fillOld, fillNew func(in []float64)) ([]float64, error) {
+	// 准备FFT输入，输入缓冲区在两次变换间复用
+	in, aFFT, bFFT := bufs.input, bufs.spec[0], bufs.spec[1]
+	clear(in)
+	fillOld(in)
+	rfft.Forward(in, aFFT)
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	clear(in)
+	fillNew(in)
+	rfft.Forward(in, bFFT)
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	// 点乘（复用第一个频谱）
+	product := aFFT
+	for i := range product {
+		product[i] *= bFFT[i]
+	}
+
 	// 逆FFT
-	corr := make([]complex128, n)
-	fft.Transform(product, corr, true)
-	
-	// 找到最大相关值的位置
-	maxVal := real(corr[0])
+	corr := in
+	rfft.Inverse(product, corr)
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	return corr, nil
+}
+
+// peakAlignment 找到最大相关值的位置，返回对应的偏移量与置信度
+func peakAlignment(corr []float64, lenA, lenB int) Alignment {
+	maxVal := corr[0]
+	maxIdx := 0
+	for i := 1; i < len(corr); i++ {
+		if corr[i] > maxVal {
+			maxVal = corr[i]
+			maxIdx = i
+		}
+	}
+	return Alignment{
+		Offset:     peakOffset(maxIdx, lenB, len(corr)),
+		Confidence: peakConfidence(corr[:max(lenA+lenB-1, 0)], maxIdx),
+	}
+}
+
+// alignBuffers32 单精度对齐计算所需的缓冲区
+type alignBuffers32 struct {
+	input []float32
+	spec  [2][]complex64
+}
+
+// newAlignBuffers32 按单精度实数 FFT 的大小分配对齐缓冲区
+func newAlignBuffers32(rfft *realFFT32) *alignBuffers32 {
+	bufs := &alignBuffers32{input: make([]float32, rfft.n)}
+	for i := range bufs.spec {
+		bufs.spec[i] = make([]complex64, rfft.spectrumLen())
+	}
+	return bufs
+}
+
+// computeOffset32 computeOffset 的单精度版本
+func computeOffset32(ctx context.Context, oldData, newData []byte, rfft *realFFT32, bufs *alignBuffers32) (Alignment, error) {
+	lenA, lenB := len(oldData), len(newData)
+	n := rfft.n
+
+	in, aFFT, bFFT := bufs.input, bufs.spec[0], bufs.spec[1]
+	clear(in)
+	for i, v := range oldData {
+		in[i] = float32(v)
+	}
+	rfft.forward(in, aFFT)
+	if err := checkContext(ctx); err != nil {
+		return Alignment{}, err
+	}
+
+	clear(in)
+	for i := 0; i < lenB; i++ {
+		in[i] = float32(newData[lenB-1-i])
+	}
+	rfft.forward(in, bFFT)
+	if err := checkContext(ctx); err != nil {
+		return Alignment{}, err
+	}
+
+	product := aFFT
+	for i := range product {
+		product[i] *= bFFT[i]
+	}
+	corr := in
+	rfft.inverse(product, corr)
+	if err := checkContext(ctx); err != nil {
+		return Alignment{}, err
+	}
+
+	maxVal := corr[0]
 	maxIdx := 0
 	for i := 1; i < n; i++ {
-		val := real(corr[i])
-		if val > maxVal {
-			maxVal = val
+		if corr[i] > maxVal {
+			maxVal = corr[i]
 			maxIdx = i
 		}
 	}
-	
-	// 计算偏移量
+
+	return Alignment{
+		Offset:     peakOffset(maxIdx, lenB, n),
+		Confidence: peakConfidence(corr[:max(lenA+lenB-1, 0)], maxIdx),
+	}, nil
+}
+
+// peakOffset 由循环相关的最大位置计算偏移量
+func peakOffset(maxIdx, lenB, n int) int {
 	offset := maxIdx - lenB + 1
 	if offset < -lenB+1 {
 		offset += n
 	}
-	
 	return offset
-}
\ No newline at end of file
+}
+
+// peakConfidence 计算相关峰值 corr[peak] 的置信度。每个位置减去两侧相隔 confidenceSpan 的平均值，
+// 消除重叠长度带来的线性趋势；峰值去趋势后高出平均的幅度除以其余位置的标准差，
+// 再除以同样多的独立噪声中最大值的期望 sqrt(2 ln m)，约 1 表示峰值与噪声无异。
+// 位置太少无法估计时为 0
+func peakConfidence[T float32 | float64](corr []T, peak int) float64 {
+	m := len(corr)
+	if m <= 4*confidenceSpan {
+		return 0
+	}
+	detrend := func(i int) float64 {
+		return float64(corr[i]) - (float64(corr[(i-confidenceSpan+m)%m])+float64(corr[(i+confidenceSpan)%m]))/2
+	}
+
+	var sum, sumSq float64
+	count := 0
+	for i := 0; i < m; i++ {
+		// 峰值本身以及以峰值为趋势样本的位置不计入噪声
+		dist := i - peak
+		if dist < 0 {
+			dist = -dist
+		}
+		if min(dist, m-dist) <= confidenceSpan {
+			continue
+		}
+		e := detrend(i)
+		sum += e
+		sumSq += e * e
+		count++
+	}
+	mean := sum / float64(count)
+	std := math.Sqrt(max(sumSq/float64(count)-mean*mean, 0))
+	prominence := detrend(peak) - mean
+	if std == 0 {
+		if prominence > 0 {
+			return math.Inf(1)
+		}
+		return 0
+	}
+	return prominence / std / math.Sqrt(2*math.Log(float64(m)))
+}
@@ -0,0 +1,663 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bindiff/types"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ArchiveFormat 归档类型
+type ArchiveFormat int
+
+// 支持逐条目差分的归档类型
+const (
+	ArchiveNone ArchiveFormat = iota
+	ArchiveTar
+	ArchiveZip
+	ArchiveAr
+)
+
+// ErrNotArchive 输入不是同一类型的受支持归档
+var ErrNotArchive = errors.New("inputs are not archives of the same supported format")
+
+// ArchivePatch 归档感知的补丁：按新归档的字节顺序排列的片段，
+// 各片段以旧归档中的某个区域为基，拼接后逐字节还原新归档
+type ArchivePatch struct {
+	Segments []ArchiveSegment
+}
+
+// ArchiveSegment 以旧数据 [BaseOffset, BaseOffset+BaseLength) 为基应用 Patches 得到的一段输出，
+// BaseLength 为 0 时 Patches 只包含插入的字面数据（归档头、目录、新增条目等）
+type ArchiveSegment struct {
+	BaseOffset int64
+	BaseLength int64
+	Patches    []types.Patch
+
+	// Deflate 为 true 时基区域是 deflate 压缩的条目数据：先解压，应用补丁后以 Level 重新压缩
+	Deflate bool
+	Level   int
+	// Nested 非空时基区域（解压后）本身是归档，使用嵌套的归档补丁代替 Patches
+	Nested *ArchivePatch
+	// Zero 为 true 时片段不引用旧数据，输出 Size 个零字节（如磁盘镜像中的空闲块）
+	Zero bool
+	// Size 带有变换（Deflate、Nested 或 Zero）的片段的输出长度
+	Size int64
+}
+
+// patchCount 返回所有片段（含嵌套归档）中的操作条目数
+func (p *ArchivePatch) patchCount() int {
+	n := 0
+	for _, seg := range p.Segments {
+		if seg.Nested != nil {
+			n += seg.Nested.patchCount()
+		} else {
+			n += len(seg.Patches)
+		}
+	}
+	return n
+}
+
+// maxArchiveDepth 嵌套归档的最大深度
+const maxArchiveDepth = 4
+
+// validBase 检查基区域是否位于长度为 oldSize 的旧数据内
+func (s ArchiveSegment) validBase(oldSize int64) bool {
+	return s.BaseOffset >= 0 && s.BaseLength >= 0 &&
+		s.BaseOffset <= oldSize && s.BaseLength <= oldSize-s.BaseOffset
+}
+
+// transformed 片段是否带有解压或嵌套变换
+func (s ArchiveSegment) transformed() bool {
+	return s.Deflate || s.Nested != nil || s.Zero
+}
+
+// archiveEntry 归档中一个条目的数据区域
+type archiveEntry struct {
+	name   string
+	offset int64
+	length int64
+	// deflated zip 条目使用 deflate 压缩，rawSize 为解压后的长度
+	deflated bool
+	rawSize  int64
+}
+
+// DetectArchive 根据文件头识别归档类型
+func DetectArchive(data []byte) ArchiveFormat {
+	switch {
+	case len(data) >= 4 && (bytes.Equal(data[:4], []byte("PK\x03\x04")) || bytes.Equal(data[:4], []byte("PK\x05\x06"))):
+		return ArchiveZip
+	case len(data) >= 512 && bytes.Equal(data[257:262], []byte("ustar")):
+		return ArchiveTar
+	case bytes.HasPrefix(data, []byte("!<arch>\n")):
+		return ArchiveAr
+	default:
+		return ArchiveNone
+	}
+}
+
+// DiffArchive 逐条目比较两个同类型归档：条目先按名称匹配，再按内容相似度匹配重命名的条目，
+// 条目的数据区域以对应旧条目为基计算差分，其余字节作为字面数据保存。
+// 条目重排不影响匹配，输入不是同类型归档时返回 ErrNotArchive
+func DiffArchive(oldData, newData []byte, options *DiffOptions) (*ArchivePatch, error) {
+	return diffArchive(oldData, newData, normalizeDiffOptions(options), 0)
+}
+
+// diffArchive 计算归档补丁，depth 为当前嵌套深度
+func diffArchive(oldData, newData []byte, options *DiffOptions, depth int) (*ArchivePatch, error) {
+	format := DetectArchive(oldData)
+	if format == ArchiveNone || DetectArchive(newData) != format {
+		return nil, ErrNotArchive
+	}
+	oldEntries, err := listArchiveEntries(format, oldData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: old archive: %v", ErrNotArchive, err)
+	}
+	newEntries, err := listArchiveEntries(format, newData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: new archive: %v", ErrNotArchive, err)
+	}
+
+	bases := matchArchiveEntries(oldData, newData, oldEntries, newEntries, options)
+
+	result := &ArchivePatch{}
+	var pos int64
+	for i, e := range newEntries {
+		if err := checkContext(options.Context); err != nil {
+			return nil, err
+		}
+		result.addLiteral(newData[pos:e.offset])
+
+		region := newData[e.offset : e.offset+e.length]
+		base, ok := bases[i]
+		if !ok {
+			result.addLiteral(region)
+		} else {
+			seg, err := diffEntry(oldData[base.offset:base.offset+base.length], region, base, e, options, depth)
+			if err != nil {
+				return nil, fmt.Errorf("failed to diff entry %s: %w", e.name, err)
+			}
+			seg.BaseOffset, seg.BaseLength = base.offset, base.length
+			result.Segments = append(result.Segments, seg)
+		}
+		pos = e.offset + e.length
+	}
+
+	// 归档尾部（结束块与记录填充）通常与旧归档相同，以旧尾部为基差分
+	tail := newData[pos:]
+	oldTail := archiveTail(oldData, oldEntries)
+	if len(tail) > 0 && oldTail < int64(len(oldData)) {
+		patches, err := DiffBytes(oldData[oldTail:], tail, options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff archive trailer: %w", err)
+		}
+		result.Segments = append(result.Segments, ArchiveSegment{
+			BaseOffset: oldTail,
+			BaseLength: int64(len(oldData)) - oldTail,
+			Patches:    patches,
+		})
+	} else {
+		result.addLiteral(tail)
+	}
+
+	if depth == 0 {
+		options.Logger.Infof("Archive diff: %d entries, %d matched, %d segments",
+			len(newEntries), len(bases), len(result.Segments))
+	}
+	return result, nil
+}
+
+// diffEntry 比较一对条目的数据：两端都是可逐字节重新压缩的 deflate 数据时比较解压后的内容，
+// 内容本身是同类型归档（如 APK 中的 jar、jar 中的 jar）时递归按条目比较
+func diffEntry(oldRegion, newRegion []byte, oldEntry, newEntry archiveEntry, options *DiffOptions, depth int) (ArchiveSegment, error) {
+	var seg ArchiveSegment
+	oldContent, newContent := oldRegion, newRegion
+	if oldEntry.deflated && newEntry.deflated {
+		oldRaw, err1 := inflate(oldRegion, oldEntry.rawSize)
+		newRaw, err2 := inflate(newRegion, newEntry.rawSize)
+		if err1 == nil && err2 == nil {
+			if level, ok := findGzipLevel(newRaw, newRegion); ok {
+				seg.Deflate, seg.Level = true, level
+				oldContent, newContent = oldRaw, newRaw
+			}
+		}
+	}
+
+	if depth < maxArchiveDepth {
+		if format := DetectArchive(oldContent); format != ArchiveNone && DetectArchive(newContent) == format {
+			nested, err := diffArchive(oldContent, newContent, options, depth+1)
+			if err == nil {
+				seg.Nested = nested
+				seg.Size = int64(len(newRegion))
+				return seg, nil
+			}
+			if !errors.Is(err, ErrNotArchive) {
+				return seg, err
+			}
+		}
+	}
+
+	patches, err := DiffBytes(oldContent, newContent, &DiffOptions{Config: options.Config, Context: options.Context})
+	if err != nil {
+		return seg, err
+	}
+	seg.Patches = patches
+	if seg.Deflate {
+		seg.Size = int64(len(newRegion))
+	}
+	return seg, nil
+}
+
+// inflate 解压 deflate 数据，解压结果必须恰好为 size 字节
+func inflate(data []byte, size int64) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	raw, err := io.ReadAll(io.LimitReader(r, size+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(raw)) != size {
+		return nil, fmt.Errorf("deflate data expands to %d bytes, expected %d", len(raw), size)
+	}
+	return raw, nil
+}
+
+// archiveTail 返回最后一个条目数据之后的位置
+func archiveTail(data []byte, entries []archiveEntry) int64 {
+	if len(entries) == 0 {
+		return int64(len(data))
+	}
+	last := entries[len(entries)-1]
+	return last.offset + last.length
+}
+
+// addLiteral 追加字面数据，与前一个字面片段合并
+func (p *ArchivePatch) addLiteral(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	if n := len(p.Segments); n > 0 && p.Segments[n-1].BaseLength == 0 && !p.Segments[n-1].transformed() {
+		last := &p.Segments[n-1].Patches[0]
+		last.Data = append(last.Data, data...)
+		last.Length = int64(len(last.Data))
+		return
+	}
+	p.Segments = append(p.Segments, ArchiveSegment{
+		Patches: []types.Patch{{
+			Op:     types.OP_INSERT,
+			Length: int64(len(data)),
+			Data:   append([]byte(nil), data...),
+		}},
+	})
+}
+
+// matchArchiveEntries 为新条目选择旧条目作为差分基：先按名称，再按相似度
+func matchArchiveEntries(oldData, newData []byte, oldEntries, newEntries []archiveEntry, options *DiffOptions) map[int]archiveEntry {
+	byName := make(map[string]archiveEntry, len(oldEntries))
+	for _, e := range oldEntries {
+		if e.length > 0 {
+			byName[e.name] = e
+		}
+	}
+
+	bases := make(map[int]archiveEntry)
+	usedNames := make(map[string]bool)
+	for i, e := range newEntries {
+		if old, ok := byName[e.name]; ok && e.length > 0 {
+			bases[i] = old
+			usedNames[e.name] = true
+		}
+	}
+
+	threshold, blockSize, ok := RenameDetection(options)
+	if !ok {
+		return bases
+	}
+	removed := make(map[string]*Fingerprint)
+	for name, e := range byName {
+		if !usedNames[name] {
+			removed[name] = NewFingerprint(oldData[e.offset:e.offset+e.length], blockSize)
+		}
+	}
+	added := make(map[string]*Fingerprint)
+	addedIndex := make(map[string]int)
+	for i, e := range newEntries {
+		if _, matched := bases[i]; !matched && e.length > 0 {
+			added[e.name] = NewFingerprint(newData[e.offset:e.offset+e.length], blockSize)
+			addedIndex[e.name] = i
+		}
+	}
+	for to, from := range MatchRenames(removed, added, threshold) {
+		bases[addedIndex[to]] = byName[from]
+	}
+	return bases
+}
+
+// listArchiveEntries 列出归档条目的数据区域（按偏移量递增）
+func listArchiveEntries(format ArchiveFormat, data []byte) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	switch format {
+	case ArchiveTar:
+		cr := &countingReader{r: bytes.NewReader(data)}
+		tr := tar.NewReader(cr)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if hdr.Typeflag == tar.TypeGNUSparse {
+				return nil, fmt.Errorf("sparse entry %s is not supported", hdr.Name)
+			}
+			e := archiveEntry{name: hdr.Name, offset: cr.n, length: hdr.Size}
+			if e.offset+e.length > int64(len(data)) {
+				return nil, fmt.Errorf("entry %s exceeds archive", hdr.Name)
+			}
+			// 确认记录的区域就是条目内容
+			content, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(content, data[e.offset:e.offset+e.length]) {
+				return nil, fmt.Errorf("cannot locate data of entry %s", hdr.Name)
+			}
+			entries = append(entries, e)
+		}
+	case ArchiveZip:
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			offset, err := f.DataOffset()
+			if err != nil {
+				return nil, err
+			}
+			e := archiveEntry{
+				name:     f.Name,
+				offset:   offset,
+				length:   int64(f.CompressedSize64),
+				deflated: f.Method == zip.Deflate,
+				rawSize:  int64(f.UncompressedSize64),
+			}
+			if e.offset+e.length > int64(len(data)) {
+				return nil, fmt.Errorf("entry %s exceeds archive", f.Name)
+			}
+			entries = append(entries, e)
+		}
+	case ArchiveAr:
+		// ar（.deb 软件包的外层容器）：8 字节魔数后是 60 字节的成员头与按 2 字节对齐的成员数据
+		pos := int64(len("!<arch>\n"))
+		for pos < int64(len(data)) {
+			if int64(len(data))-pos < 60 || string(data[pos+58:pos+60]) != "`\n" {
+				return nil, fmt.Errorf("bad ar header at offset %d", pos)
+			}
+			hdr := data[pos : pos+60]
+			size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+			if err != nil || size < 0 || size > int64(len(data))-pos-60 {
+				return nil, fmt.Errorf("bad ar member size at offset %d", pos)
+			}
+			name := strings.TrimSuffix(strings.TrimRight(string(hdr[:16]), " "), "/")
+			entries = append(entries, archiveEntry{name: name, offset: pos + 60, length: size})
+			pos += 60 + size + size%2
+		}
+	}
+
+	// 数据区域必须有序且互不重叠，否则无法按顺序拼接
+	var end int64
+	for _, e := range entries {
+		if e.offset < end {
+			return nil, fmt.Errorf("entry %s overlaps previous entry", e.name)
+		}
+		end = e.offset + e.length
+	}
+	return entries, nil
+}
+
+// countingReader 记录已读取的字节数
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read 实现 io.Reader
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ApplyArchive 将归档补丁应用到旧归档
+func ApplyArchive(oldData []byte, patch *ArchivePatch, options *ApplyOptions) (out []byte, err error) {
+	start := time.Now()
+	options = normalizeApplyOptions(options)
+	options.Hooks.start(OperationApply, int64(len(oldData)), -1)
+	defer func() {
+		options.Hooks.complete(OperationApply, start, err)
+	}()
+
+	segmentOptions := &ApplyOptions{
+		Config:  options.Config,
+		Context: options.Context,
+		Lenient: options.Lenient,
+	}
+	return applyArchive(oldData, patch, segmentOptions)
+}
+
+// applyArchive 依次应用各片段并拼接输出
+func applyArchive(oldData []byte, patch *ArchivePatch, options *ApplyOptions) (out []byte, err error) {
+	limits := limitsOf(options.Config)
+	for i, seg := range patch.Segments {
+		if !seg.validBase(int64(len(oldData))) {
+			return nil, fmt.Errorf("%w: segment %d base exceeds old data", ErrCorruptPatch, i)
+		}
+		data, err := applySegment(oldData[seg.BaseOffset:seg.BaseOffset+seg.BaseLength], seg, options)
+		if err != nil {
+			return nil, fmt.Errorf("segment %d: %w", i, err)
+		}
+		if err := limits.checkOutput(int64(len(out) + len(data))); err != nil {
+			return nil, err
+		}
+		out = append(out, data...)
+	}
+	return out, nil
+}
+
+// applySegment 应用单个片段：按需解压基区域、应用（嵌套）补丁并重新压缩
+func applySegment(base []byte, seg ArchiveSegment, options *ApplyOptions) ([]byte, error) {
+	limits := limitsOf(options.Config)
+	if seg.Zero {
+		if err := limits.checkOutput(seg.Size); err != nil {
+			return nil, err
+		}
+		return make([]byte, seg.Size), nil
+	}
+	if seg.Deflate {
+		// 有输出上限时解压到上限为止，压缩炸弹不会耗尽内存
+		var src io.Reader = flate.NewReader(bytes.NewReader(base))
+		if limits.maxOutput > 0 {
+			src = io.LimitReader(src, limits.maxOutput+1)
+		}
+		raw, err := io.ReadAll(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inflate base entry: %w", err)
+		}
+		if err := limits.checkOutput(int64(len(raw))); err != nil {
+			return nil, fmt.Errorf("inflating base entry: %w", err)
+		}
+		base = raw
+	}
+
+	var data []byte
+	var err error
+	if seg.Nested != nil {
+		data, err = applyArchive(base, seg.Nested, options)
+	} else {
+		data, err = Apply(base, seg.Patches, options)
+	}
+	if err != nil || !seg.Deflate {
+		return data, err
+	}
+
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, seg.Level)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptPatch, err)
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ValidateArchivePatch 检查归档补丁结构：各片段的基区域不越界，片段内补丁合法。
+// 压缩片段的内部补丁依赖解压后的数据，只在应用时检查
+func ValidateArchivePatch(patch *ArchivePatch, oldSize, newSize int64) error {
+	var total int64
+	for i, seg := range patch.Segments {
+		if !seg.validBase(oldSize) {
+			return fmt.Errorf("%w: segment %d base exceeds old data", ErrCorruptPatch, i)
+		}
+		if seg.transformed() {
+			if seg.Deflate && (seg.Level < flate.HuffmanOnly || seg.Level > flate.BestCompression) {
+				return fmt.Errorf("%w: segment %d has invalid compression level %d", ErrCorruptPatch, i, seg.Level)
+			}
+			if seg.Nested != nil && !seg.Deflate {
+				if err := ValidateArchivePatch(seg.Nested, seg.BaseLength, seg.Size); err != nil {
+					return fmt.Errorf("segment %d: %w", i, err)
+				}
+			}
+			total += seg.Size
+			continue
+		}
+		size := outputSize(seg.Patches, seg.BaseLength)
+		if err := ValidatePatch(seg.Patches, seg.BaseLength, size); err != nil {
+			return fmt.Errorf("segment %d: %w", i, err)
+		}
+		total += size
+	}
+	if newSize >= 0 && total != newSize {
+		return fmt.Errorf("%w: archive patch produces %d bytes, expected %d", ErrCorruptPatch, total, newSize)
+	}
+	return nil
+}
+
+// outputSize 计算补丁应用到长度为 oldSize 的数据后的输出长度
+func outputSize(patches []types.Patch, oldSize int64) int64 {
+	size := oldSize
+	for _, p := range patches {
+		switch p.Op {
+		case types.OP_INSERT:
+			size += int64(len(p.Data))
+		case types.OP_REPLACE:
+			size += int64(len(p.Data)) - p.Length
+		case types.OP_DELETE:
+			size -= p.Length
+		}
+	}
+	return size
+}
+
+// extendedSegments 扩展片段编码的标记，写在片段数的位置
+const extendedSegments = 0xFFFFFFFF
+
+// 扩展片段编码的变换标志
+const (
+	segmentDeflate = 1 << iota
+	segmentNested
+	segmentZero
+)
+
+// EncodeArchivePatch 编码归档补丁：片段数(4)，每个片段为 基偏移(8) + 基长度(8) + 补丁长度(4) + 补丁数据。
+// 含有解压或嵌套变换的补丁使用扩展编码：标记(4) + 片段数(4)，
+// 每个片段为 标志(1，deflate/嵌套/全零) + 级别(1) + 基偏移(8) + 基长度(8) + 输出长度(8) + 数据长度(4) + 补丁或嵌套归档补丁
+func EncodeArchivePatch(p *ArchivePatch) []byte {
+	buf := new(bytes.Buffer)
+	extended := false
+	for _, seg := range p.Segments {
+		extended = extended || seg.transformed()
+	}
+	if extended {
+		binary.Write(buf, binary.LittleEndian, uint32(extendedSegments))
+	}
+	binary.Write(buf, binary.LittleEndian, uint32(len(p.Segments)))
+	for _, seg := range p.Segments {
+		var data []byte
+		if seg.Nested != nil {
+			data = EncodeArchivePatch(seg.Nested)
+		} else {
+			data = EncodePatch(seg.Patches)
+		}
+		if extended {
+			var flags uint8
+			if seg.Deflate {
+				flags |= segmentDeflate
+			}
+			if seg.Nested != nil {
+				flags |= segmentNested
+			}
+			if seg.Zero {
+				flags |= segmentZero
+			}
+			buf.WriteByte(flags)
+			buf.WriteByte(byte(int8(seg.Level)))
+		}
+		binary.Write(buf, binary.LittleEndian, seg.BaseOffset)
+		binary.Write(buf, binary.LittleEndian, seg.BaseLength)
+		if extended {
+			binary.Write(buf, binary.LittleEndian, seg.Size)
+		}
+		binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+		buf.Write(data)
+	}
+	return buf.Bytes()
+}
+
+// DecodeArchivePatch 解码归档补丁
+func DecodeArchivePatch(data []byte) (*ArchivePatch, error) {
+	return decodeArchivePatch(data, 0)
+}
+
+// decodeArchivePatch 解码归档补丁，depth 为当前嵌套深度
+func decodeArchivePatch(data []byte, depth int) (*ArchivePatch, error) {
+	if depth > maxArchiveDepth {
+		return nil, fmt.Errorf("%w: archive patch nested too deeply", ErrCorruptPatch)
+	}
+	r := bytes.NewReader(data)
+	hr := &headerReader{r: r}
+	var count uint32
+	hr.read(&count)
+	extended := count == extendedSegments
+	minSize := int64(20)
+	if extended {
+		hr.read(&count)
+		minSize = 30
+	}
+	// 限制片段数，防止伪造的数量导致过度分配
+	if hr.err == nil && int64(count)*minSize > int64(r.Len()) {
+		return nil, fmt.Errorf("%w: segment count %d exceeds payload", ErrCorruptPatch, count)
+	}
+
+	p := &ArchivePatch{Segments: make([]ArchiveSegment, 0, count)}
+	for i := uint32(0); i < count && hr.err == nil; i++ {
+		var seg ArchiveSegment
+		var flags uint8
+		var level int8
+		var length uint32
+		if extended {
+			hr.read(&flags)
+			hr.read(&level)
+		}
+		hr.read(&seg.BaseOffset)
+		hr.read(&seg.BaseLength)
+		if extended {
+			hr.read(&seg.Size)
+		}
+		hr.read(&length)
+		if hr.err == nil && int64(length) > int64(r.Len()) {
+			return nil, fmt.Errorf("%w: segment %d length exceeds payload", ErrCorruptPatch, i)
+		}
+		if flags&^(segmentDeflate|segmentNested|segmentZero) != 0 || seg.Size < 0 ||
+			(flags&segmentZero != 0 && (flags != segmentZero || seg.BaseLength != 0)) {
+			return nil, fmt.Errorf("%w: segment %d has invalid flags", ErrCorruptPatch, i)
+		}
+		seg.Deflate, seg.Level, seg.Zero = flags&segmentDeflate != 0, int(level), flags&segmentZero != 0
+
+		body := hr.bytes(int64(length))
+		if hr.err != nil {
+			break
+		}
+		if flags&segmentNested != 0 {
+			nested, err := decodeArchivePatch(body, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			seg.Nested = nested
+		} else {
+			patches, err := DecodePatch(body)
+			if err != nil {
+				return nil, err
+			}
+			seg.Patches = patches
+		}
+		p.Segments = append(p.Segments, seg)
+	}
+	if hr.err != nil {
+		return nil, fmt.Errorf("%w: truncated archive patch: %v", ErrCorruptPatch, hr.err)
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes in archive patch", ErrCorruptPatch, r.Len())
+	}
+	return p, nil
+}
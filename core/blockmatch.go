@@ -0,0 +1,315 @@
+package core
+
+import (
+	"bindiff/pkg/utils"
+	"bindiff/types"
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	// matchSegmentSize 新数据按该大小切分为互不重叠的扫描区间。区间与工作线程数无关，
+	// 因此输出与工作线程数无关
+	matchSegmentSize = 1 << 20
+	// indexShardBits 块索引按哈希最高位分片的位数
+	indexShardBits = 8
+	// blockIndexEntrySize 块索引中每个块约占用的内存：构建时的校验数组与分片中的条目
+	blockIndexEntrySize = 64
+)
+
+// blockMatch 旧数据 oldPos 开始的 length 字节与新数据 newPos 开始的内容相同
+type blockMatch struct {
+	oldPos, newPos, length int
+}
+
+// blockEntry 旧数据块的强哈希与位置
+type blockEntry struct {
+	strong uint64
+	offset int
+}
+
+// blockIndex 旧数据按块对齐位置的索引：以滚动弱校验为键、按弱校验前缀分片，
+// 值为强哈希与位置。构建完成后只读，扫描线程无锁并发查找
+type blockIndex struct {
+	data      []byte
+	blockSize int
+	shards    [1 << indexShardBits]map[uint32][]blockEntry
+}
+
+// shardOf 返回弱校验所在的分片，先乘以奇数常量打散各位
+func shardOf(weak uint32) int {
+	return int((weak * 0x9e3779b1) >> (32 - indexShardBits))
+}
+
+// newBlockIndex 一次性构建旧数据的块索引：先并发计算各块的弱校验与强哈希，
+// 再由各工作线程填充各自负责的分片，同一弱校验的位置按升序排列
+func newBlockIndex(oldData []byte, blockSize, workers int) *blockIndex {
+	x := &blockIndex{data: oldData, blockSize: blockSize}
+	weak := make([]uint32, len(oldData)/blockSize)
+	strong := make([]uint64, len(weak))
+
+	var wg sync.WaitGroup
+	per := (len(weak) + workers - 1) / workers
+	for lo := 0; lo < len(weak); lo += per {
+		hi := lo + per
+		if hi > len(weak) {
+			hi = len(weak)
+		}
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			for k := lo; k < hi; k++ {
+				block := oldData[k*blockSize : (k+1)*blockSize]
+				weak[k], strong[k] = weakSum(block), xxhash.Sum64(block)
+			}
+		}(lo, hi)
+	}
+	wg.Wait()
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for s := w; s < len(x.shards); s += workers {
+				x.shards[s] = make(map[uint32][]blockEntry)
+			}
+			for k, h := range weak {
+				if s := shardOf(h); s%workers == w {
+					x.shards[s][h] = append(x.shards[s][h], blockEntry{strong: strong[k], offset: k * blockSize})
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	return x
+}
+
+// lookup 查找与 block（弱校验为 weak）内容相同的旧数据块。只有弱校验命中时才计算强哈希，
+// 有多个相同的块时取不小于 expect 的第一个（没有时取小于 expect 的最后一个），
+// 使匹配尽量保持与前一个匹配相同的相对位置
+func (x *blockIndex) lookup(weak uint32, block []byte, expect int) (int, bool) {
+	entries := x.shards[shardOf(weak)][weak]
+	if len(entries) == 0 {
+		return 0, false
+	}
+	strong := xxhash.Sum64(block)
+	i := sort.Search(len(entries), func(k int) bool { return entries[k].offset >= expect })
+	for k := i; k < len(entries); k++ {
+		if entries[k].strong == strong {
+			return x.confirm(entries[k].offset, block)
+		}
+	}
+	for k := i - 1; k >= 0; k-- {
+		if entries[k].strong == strong {
+			return x.confirm(entries[k].offset, block)
+		}
+	}
+	return 0, false
+}
+
+// confirm 逐字节确认 pos 处的旧数据块与 block 相同
+func (x *blockIndex) confirm(pos int, block []byte) (int, bool) {
+	return pos, EqualBytes(x.data[pos:pos+x.blockSize], block)
+}
+
+// matchSegment 以滚动哈希逐字节扫描新数据 [from, to) 中开始的匹配：命中的块向后扩展到区间末尾，
+// 向前扩展到上一个匹配的结束位置，返回按新位置排序、互不重叠的匹配
+func (x *blockIndex) matchSegment(ctx context.Context, newData []byte, from, to int) ([]blockMatch, error) {
+	var matches []blockMatch
+	covered := from // 区间内已匹配数据的结束位置
+	delta := 0      // 上一个匹配的旧位置与新位置之差
+	nextCheck := from
+	var rh rollingHash
+	rolled := -1 // rh 当前窗口的起点
+	for i := from; i < to && i+x.blockSize <= len(newData); {
+		if i >= nextCheck {
+			if err := checkContext(ctx); err != nil {
+				return nil, err
+			}
+			nextCheck = i + ctxCheckInterval
+		}
+		if rolled != i {
+			rh.reset(newData[i : i+x.blockSize])
+		}
+		oldPos, ok := x.lookup(rh.sum(), newData[i:i+x.blockSize], i+delta)
+		if !ok {
+			if i+x.blockSize < len(newData) {
+				rh.roll(newData[i], newData[i+x.blockSize])
+			}
+			i++
+			rolled = i
+			continue
+		}
+
+		back := commonSuffix(x.data[:oldPos], newData[covered:i])
+		end := i + x.blockSize
+		if end < to {
+			end += commonPrefix(x.data[oldPos+x.blockSize:], newData[end:to])
+		}
+		matches = append(matches, blockMatch{oldPos: oldPos - back, newPos: i - back, length: end - i + back})
+		covered, delta, i = end, oldPos-i, end
+	}
+	return matches, nil
+}
+
+// blockDiff 块匹配差分：块大小与工作线程数按内存预算确定（见 planDiff），旧数据的块索引只构建一次，
+// 工作线程从队列中领取新数据的扫描区间并发查找匹配，再按区间顺序合并为补丁。补丁只能按旧数据顺序前进，
+// 落在已使用的旧数据之前的匹配被裁剪或丢弃；匹配之间的数据按位置逐字节比较生成
+// COPY/REPLACE，长度差以 INSERT/DELETE 补齐
+func blockDiff(oldData, newData []byte, options *DiffOptions) ([]types.Patch, error) {
+	plan := planDiff(len(oldData), len(newData), options.Config)
+	workers, blockSize := plan.workers, plan.blockSize
+	if limit := int64(options.Config.MaxMemoryMB) * 1024 * 1024; plan.indexMemory > limit && limit > 0 {
+		options.Logger.Warnf("Block index needs %s, more than the %s memory budget",
+			utils.FormatBytes(plan.indexMemory), utils.FormatBytes(limit))
+	} else if plan.adjusted {
+		options.Logger.Infof("Memory budget %s: block size %d, %d workers",
+			utils.FormatBytes(limit), blockSize, workers)
+	}
+	budget := newMemoryBudget(options)
+
+	index := newBlockIndex(oldData, blockSize, workers)
+
+	numSegments := (len(newData) + matchSegmentSize - 1) / matchSegmentSize
+	results := make([][]blockMatch, numSegments)
+	errs := make([]error, workers)
+	done := make(chan int, numSegments)
+
+	ctx, cancel := context.WithCancel(options.Context)
+	defer cancel()
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for {
+				s := int(next.Add(1) - 1)
+				if s >= numSegments {
+					return
+				}
+				from := s * matchSegmentSize
+				to := from + matchSegmentSize
+				if to > len(newData) {
+					to = len(newData)
+				}
+				budget.acquire()
+				var err error
+				results[s], err = index.matchSegment(ctx, newData, from, to)
+				budget.release()
+				if err != nil {
+					errs[w] = err
+					cancel()
+					return
+				}
+				done <- to - from
+			}
+		}(w)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	progress := newProgressTracker(options.Progress, ProgressStageDiff, int64(len(newData)))
+	var processed int64
+	for n := range done {
+		processed += int64(n)
+		progress.update(processed)
+	}
+	for _, err := range errs {
+		if err != nil {
+			options.Logger.Warnf("Diff operation cancelled")
+			return nil, err
+		}
+	}
+
+	b := &patchRuns{oldData: oldData, newData: newData}
+	cursor, np := 0, 0 // 旧数据与新数据中已处理的位置
+	for _, segment := range results {
+		for _, m := range segment {
+			// 跨越区间边界的匹配与后一区间的匹配重叠，按两侧已处理的位置裁剪
+			if skip := np - m.newPos; skip > 0 {
+				m.oldPos, m.newPos, m.length = m.oldPos+skip, m.newPos+skip, m.length-skip
+			}
+			if skip := cursor - m.oldPos; skip > 0 {
+				m.oldPos, m.newPos, m.length = m.oldPos+skip, m.newPos+skip, m.length-skip
+			}
+			if m.length < options.Config.MinMatchLength || m.length <= 0 {
+				continue
+			}
+			b.gap(cursor, m.oldPos, np, m.newPos)
+			b.add(types.OP_COPY, m.oldPos, m.length, m.newPos)
+			cursor, np = m.oldPos+m.length, m.newPos+m.length
+		}
+	}
+	b.gap(cursor, len(oldData), np, len(newData))
+
+	progress.finish()
+	return b.patches, nil
+}
+
+// patchRuns 按顺序生成补丁，合并相邻的同类操作
+type patchRuns struct {
+	oldData, newData []byte
+	patches          []types.Patch
+	newEnd           int // 最后一个操作在新数据中的结束位置
+}
+
+// add 追加旧数据 offset 处、对应新数据 newPos 处的 length 字节操作
+func (b *patchRuns) add(op types.Operator, offset, length, newPos int) {
+	if length == 0 {
+		return
+	}
+	hasData := op == types.OP_INSERT || op == types.OP_REPLACE
+	if n := len(b.patches); n > 0 {
+		last := &b.patches[n-1]
+		oldEnd := last.Offset
+		if op != types.OP_INSERT {
+			oldEnd += last.Length
+		}
+		if last.Op == op && oldEnd == int64(offset) && (!hasData || b.newEnd == newPos) {
+			last.Length += int64(length)
+			if hasData {
+				start := newPos - int(last.Length) + length
+				last.Data = b.newData[start : newPos+length]
+			}
+			b.newEnd = newPos + length
+			return
+		}
+	}
+	patch := types.Patch{Op: op, Offset: int64(offset), Length: int64(length)}
+	if hasData {
+		patch.Data = b.newData[newPos : newPos+length]
+	}
+	b.patches = append(b.patches, patch)
+	if op != types.OP_DELETE {
+		b.newEnd = newPos + length
+	}
+}
+
+// gap 处理两个匹配之间的数据：公共长度内按位置逐字节比较，
+// 新数据更长的部分 INSERT，旧数据更长的部分 DELETE
+func (b *patchRuns) gap(oldFrom, oldTo, newFrom, newTo int) {
+	common := oldTo - oldFrom
+	if newTo-newFrom < common {
+		common = newTo - newFrom
+	}
+	old, cur := b.oldData[oldFrom:oldFrom+common], b.newData[newFrom:newFrom+common]
+	for i := 0; i < common; {
+		op, run := types.OP_REPLACE, differingPrefix
+		if old[i] == cur[i] {
+			op, run = types.OP_COPY, commonPrefix
+		}
+		n := run(old[i:], cur[i:])
+		b.add(op, oldFrom+i, n, newFrom+i)
+		i += n
+	}
+	b.add(types.OP_INSERT, oldFrom+common, newTo-newFrom-common, newFrom+common)
+	b.add(types.OP_DELETE, oldFrom+common, oldTo-oldFrom-common, newTo)
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"bindiff/pkg/config"
+	"bindiff/pkg/logger"
+	"bindiff/pkg/utils"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	// matchEntrySize 每个块匹配约占用的内存：匹配记录与其生成的补丁条目
+	matchEntrySize = 128
+	// maxBudgetBlockSize 按预算放大块大小的上限
+	maxBudgetBlockSize = 1 << 20
+	// workerOverhead 每个扫描线程除匹配记录外的开销（协程栈等）
+	workerOverhead = 64 * 1024
+	// memSampleInterval 两次读取运行时内存统计的最小间隔
+	memSampleInterval = 10 * time.Millisecond
+)
+
+// diffPlan 按内存预算确定的块匹配参数
+type diffPlan struct {
+	blockSize int
+	workers   int
+	// indexMemory 块索引与匹配记录约占用的内存
+	indexMemory int64
+	// adjusted 为了满足预算修改了配置的块大小或工作线程数
+	adjusted bool
+}
+
+// planDiff 按 MaxMemoryMB 确定块大小与工作线程数。预算限制的是输入数据之外新分配的内存：
+// 块索引与匹配记录放不下时按倍数放大块大小，剩余的预算决定并发扫描的线程数。
+// MaxMemoryMB 不大于 0 时不限制
+func planDiff(oldLen, newLen int, cfg *config.Config) diffPlan {
+	plan := diffPlan{blockSize: cfg.BlockSize, workers: 1}
+	if plan.blockSize <= 0 {
+		plan.blockSize = 1024
+	}
+	if cfg.UseParallel && cfg.MaxWorkers > 1 {
+		plan.workers = cfg.MaxWorkers
+	}
+	cost := func(blockSize int) int64 {
+		return int64(oldLen/blockSize)*blockIndexEntrySize + int64(newLen/blockSize)*matchEntrySize
+	}
+	plan.indexMemory = cost(plan.blockSize)
+	limit := int64(cfg.MaxMemoryMB) * 1024 * 1024
+	if limit <= 0 {
+		return plan
+	}
+
+	for plan.indexMemory > limit && plan.blockSize < maxBudgetBlockSize {
+		plan.blockSize *= 2
+		plan.indexMemory = cost(plan.blockSize)
+		plan.adjusted = true
+	}
+	perWorker := int64(matchSegmentSize/plan.blockSize)*matchEntrySize + workerOverhead
+	if fit := (limit - plan.indexMemory) / perWorker; fit < int64(plan.workers) {
+		plan.workers = int(max(fit, 1))
+		plan.adjusted = true
+	}
+	return plan
+}
+
+// memoryBudget 在差分运行中监控堆内存：超出预算时只保留一个扫描线程继续工作，
+// 其余线程等待内存回落，由 GC 按常规节奏回收而不强制触发
+type memoryBudget struct {
+	limit    uint64
+	baseline uint64 // 开始时已使用的堆内存（含输入数据）
+	logger   logger.Logger
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	active   int
+	sampled  time.Time
+	over     bool
+	reported bool
+}
+
+// newMemoryBudget 创建预算监控，MaxMemoryMB 不大于 0 时返回 nil（不限制）
+func newMemoryBudget(options *DiffOptions) *memoryBudget {
+	if options.Config.MaxMemoryMB <= 0 {
+		return nil
+	}
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	b := &memoryBudget{
+		limit:    uint64(options.Config.MaxMemoryMB) * 1024 * 1024,
+		baseline: stats.HeapAlloc,
+		logger:   options.Logger,
+		sampled:  time.Now(),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire 在扫描一个区间前调用：已有线程在工作且内存超出预算时等待
+func (b *memoryBudget) acquire() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.active > 0 && b.exceeded() {
+		b.cond.Wait()
+	}
+	b.active++
+}
+
+// release 在区间扫描完成后调用，唤醒等待的线程重新检查内存
+func (b *memoryBudget) release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.active--
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// exceeded 报告新分配的堆内存是否超出预算，运行时统计最多每 memSampleInterval 读取一次。
+// 调用方持有 mu
+func (b *memoryBudget) exceeded() bool {
+	if now := time.Now(); now.Sub(b.sampled) >= memSampleInterval {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		b.sampled = now
+		b.over = stats.HeapAlloc > b.baseline && stats.HeapAlloc-b.baseline > b.limit
+		if b.over && !b.reported {
+			b.reported = true
+			b.logger.Warnf("Heap use above the %s memory budget, reducing diff concurrency",
+				utils.FormatBytes(int64(b.limit)))
+		}
+	}
+	return b.over
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"bindiff/types"
+	"path/filepath"
+)
+
+// PatchBuilder 以编程方式构造补丁，追加操作时即检查不变量
+// （偏移量有序、不越过旧数据边界），最终生成完整的 DiffFile
+type PatchBuilder struct {
+	oldData []byte
+	oldName string
+	newName string
+	algo    types.HashAlgorithm
+	cursor  int64
+	patches []types.Patch
+}
+
+// NewPatchBuilder 基于旧数据创建补丁构造器
+func NewPatchBuilder(oldData []byte) *PatchBuilder {
+	return &PatchBuilder{
+		oldData: oldData,
+		algo:    types.HASH_SHA256,
+	}
+}
+
+// SetNames 设置补丁中记录的新旧文件名
+func (b *PatchBuilder) SetNames(oldName, newName string) *PatchBuilder {
+	b.oldName = filepath.Base(oldName)
+	b.newName = filepath.Base(newName)
+	return b
+}
+
+// SetHashAlgorithm 设置校验哈希算法，默认 SHA256
+func (b *PatchBuilder) SetHashAlgorithm(algo types.HashAlgorithm) *PatchBuilder {
+	b.algo = algo
+	return b
+}
+
+// AppendCopy 从旧数据 offset 处复制 length 字节
+func (b *PatchBuilder) AppendCopy(offset, length int64) error {
+	return b.append(types.Patch{Op: types.OP_COPY, Offset: offset, Length: length})
+}
+
+// AppendInsert 在旧数据 offset 处插入 data，不消耗旧数据
+func (b *PatchBuilder) AppendInsert(offset int64, data []byte) error {
+	return b.append(types.Patch{Op: types.OP_INSERT, Offset: offset, Length: int64(len(data)), Data: data})
+}
+
+// AppendReplace 用 data 替换旧数据 offset 处等长的内容
+func (b *PatchBuilder) AppendReplace(offset int64, data []byte) error {
+	return b.append(types.Patch{Op: types.OP_REPLACE, Offset: offset, Length: int64(len(data)), Data: data})
+}
+
+// AppendDelete 删除旧数据 offset 处的 length 字节
+func (b *PatchBuilder) AppendDelete(offset, length int64) error {
+	return b.append(types.Patch{Op: types.OP_DELETE, Offset: offset, Length: length})
+}
+
+// append 检查并追加操作，offset 之前未覆盖的旧数据隐式复制
+func (b *PatchBuilder) append(entry types.Patch) error {
+	i := len(b.patches)
+	oldSize := int64(len(b.oldData))
+	if entry.Offset < 0 || entry.Length < 0 {
+		return newPatchError(i, entry, "negative offset or length")
+	}
+	if entry.Offset < b.cursor {
+		return newPatchError(i, entry, "offset precedes current position %d", b.cursor)
+	}
+	if entry.Offset > oldSize {
+		return newPatchError(i, entry, "offset exceeds old data length %d", oldSize)
+	}
+	consumed := entry.Length
+	if entry.Op == types.OP_INSERT {
+		consumed = 0
+	}
+	if entry.Offset+consumed > oldSize {
+		return newPatchError(i, entry, "length exceeds old data length %d", oldSize)
+	}
+
+	if entry.Data != nil {
+		entry.Data = append([]byte(nil), entry.Data...)
+	}
+	b.patches = append(b.patches, entry)
+	b.cursor = entry.Offset + consumed
+	return nil
+}
+
+// Patches 返回已追加的操作
+func (b *PatchBuilder) Patches() []types.Patch {
+	return b.patches
+}
+
+// Build 生成补丁文件，计算新数据及两端哈希
+func (b *PatchBuilder) Build() (types.DiffFile, error) {
+	newData, err := Apply(b.oldData, b.patches, nil)
+	if err != nil {
+		return types.DiffFile{}, err
+	}
+	if err := checkFileSize(b.oldData, newData); err != nil {
+		return types.DiffFile{}, err
+	}
+
+	oldHash, err := ComputeHashWith(b.algo, b.oldData)
+	if err != nil {
+		return types.DiffFile{}, err
+	}
+	newHash, err := ComputeHashWith(b.algo, newData)
+	if err != nil {
+		return types.DiffFile{}, err
+	}
+
+	df := newDiffFile(b.algo, b.oldData, newData, oldHash, newHash)
+	df.OldFileNameLength = uint32(len(b.oldName))
+	df.FileName = []byte(b.oldName)
+	df.NewFileNameLength = uint32(len(b.newName))
+	df.NewFileName = []byte(b.newName)
+	df.DataLength = uint32(encodedSize(b.patches))
+	df.Diff = b.patches
+	return df, nil
+}
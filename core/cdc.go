@@ -0,0 +1,124 @@
+package core
+
+// 内容定义分块（FastCDC）的默认参数
+const (
+	DefaultChunkMin = 2 * 1024
+	DefaultChunkAvg = 8 * 1024
+	DefaultChunkMax = 64 * 1024
+)
+
+// ChunkOptions 内容定义分块参数，零值字段使用默认值
+type ChunkOptions struct {
+	MinSize int
+	AvgSize int // 向下取整为 2 的幂
+	MaxSize int
+}
+
+// gearTable FastCDC 使用的 256 项随机表，由固定种子生成以保证分块结果稳定
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	state := uint64(0x9E3779B97F4A7C15)
+	for i := range table {
+		// splitmix64
+		state += 0x9E3779B97F4A7C15
+		z := state
+		z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+		z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// ChunkBoundaries 按内容切分数据，返回每个块的结束位置。
+// 插入或删除只影响附近的块边界，相同内容区域在不同文件中得到相同的块
+func ChunkBoundaries(data []byte, options *ChunkOptions) []int {
+	minSize, avgSize, maxSize := chunkParams(options)
+
+	// 规范化分块：平均大小之前使用更严格的掩码，之后使用更宽松的掩码，使块大小更集中
+	bits := 0
+	for 1<<(bits+1) <= avgSize {
+		bits++
+	}
+	maskS := uint64(1)<<(bits+2) - 1
+	maskL := uint64(1)<<(bits-2) - 1
+	maskS <<= 64 - (bits + 2)
+	maskL <<= 64 - (bits - 2)
+
+	var boundaries []int
+	for start := 0; start < len(data); {
+		end := chunkEnd(data[start:], minSize, avgSize, maxSize, maskS, maskL)
+		start += end
+		boundaries = append(boundaries, start)
+	}
+	return boundaries
+}
+
+// Chunk 按内容切分数据，返回的块共享 data 的底层存储
+func Chunk(data []byte, options *ChunkOptions) [][]byte {
+	boundaries := ChunkBoundaries(data, options)
+	chunks := make([][]byte, 0, len(boundaries))
+	start := 0
+	for _, end := range boundaries {
+		chunks = append(chunks, data[start:end])
+		start = end
+	}
+	return chunks
+}
+
+// chunkEnd 返回第一个块的长度
+func chunkEnd(data []byte, minSize, avgSize, maxSize int, maskS, maskL uint64) int {
+	n := len(data)
+	if n <= minSize {
+		return n
+	}
+	if n > maxSize {
+		n = maxSize
+	}
+	normal := avgSize
+	if normal > n {
+		normal = n
+	}
+
+	var hash uint64
+	i := minSize
+	for ; i < normal; i++ {
+		hash = (hash << 1) + gearTable[data[i]]
+		if hash&maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		hash = (hash << 1) + gearTable[data[i]]
+		if hash&maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// chunkParams 返回生效的分块参数
+func chunkParams(options *ChunkOptions) (minSize, avgSize, maxSize int) {
+	minSize, avgSize, maxSize = DefaultChunkMin, DefaultChunkAvg, DefaultChunkMax
+	if options != nil {
+		if options.MinSize > 0 {
+			minSize = options.MinSize
+		}
+		if options.AvgSize > 0 {
+			avgSize = options.AvgSize
+		}
+		if options.MaxSize > 0 {
+			maxSize = options.MaxSize
+		}
+	}
+	// 掩码至少需要 4 位
+	if avgSize < 16 {
+		avgSize = 16
+	}
+	if minSize > avgSize {
+		minSize = avgSize
+	}
+	if maxSize < avgSize {
+		maxSize = avgSize
+	}
+	return minSize, avgSize, maxSize
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"bindiff/types"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// checksumSize 补丁文件尾部整体校验和的字节数
+const checksumSize = 4
+
+// checksumTable 整体校验和使用的 CRC32-C 表，多数平台上有硬件加速
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// hasChecksum 该版本的补丁文件是否以整体校验和结尾
+func hasChecksum(version uint32) bool {
+	return version >= 4
+}
+
+// newChecksum 创建整体校验和的哈希
+func newChecksum() hash.Hash32 {
+	return crc32.New(checksumTable)
+}
+
+// appendChecksum 追加 dst[start:] 的校验和
+func appendChecksum(dst []byte, start int) []byte {
+	return binary.LittleEndian.AppendUint32(dst, crc32.Checksum(dst[start:], checksumTable))
+}
+
+// compareChecksum 比较尾部记录的校验和与计算出的校验和
+func compareChecksum(stored, actual uint32) error {
+	if stored != actual {
+		return &ChecksumError{Stored: stored, Actual: actual}
+	}
+	return nil
+}
+
+// verifyChecksum 在解析头之前检查内存中完整补丁文件的整体校验和，只读取魔数与版本号；
+// 魔数不对、没有校验和的旧版本、不支持的新版本以及过短的数据交给头解析处理
+func verifyChecksum(data []byte) error {
+	le := binary.LittleEndian
+	if len(data) < 8 || le.Uint32(data) != types.PATCH_MAGIC {
+		return nil
+	}
+	if version := le.Uint32(data[4:]); !hasChecksum(version) || version > types.PATCH_VERSION {
+		return nil
+	}
+	if len(data) < 8+checksumSize {
+		return truncatedError(io.ErrUnexpectedEOF, "patch file")
+	}
+	n := len(data) - checksumSize
+	return compareChecksum(le.Uint32(data[n:]), crc32.Checksum(data[:n], checksumTable))
+}
+
+// VerifyDiffFileChecksum 从 r 顺序读取整个补丁文件（头、差分数据与尾部）并检查整体校验和，
+// 不解码操作，内存占用与补丁大小无关，返回读到的补丁头。版本 4 之前的补丁没有校验和，只读取头。
+// 校验和不一致时返回 *ChecksumError
+func VerifyDiffFileChecksum(r io.Reader) (types.DiffFile, error) {
+	sum := newChecksum()
+	df, err := ReadDiffHeader(io.TeeReader(r, sum))
+	if err != nil || !hasChecksum(df.Version) {
+		return df, err
+	}
+	if _, err := io.CopyN(sum, r, int64(df.DataLength)); err != nil {
+		return df, truncatedError(err, "patch data")
+	}
+	return df, readChecksum(r, sum)
+}
+
+// readChecksum 从 r 读取尾部的校验和并与 sum 比较
+func readChecksum(r io.Reader, sum hash.Hash32) error {
+	var footer [checksumSize]byte
+	if _, err := io.ReadFull(r, footer[:]); err != nil {
+		return truncatedError(err, "patch checksum")
+	}
+	return compareChecksum(binary.LittleEndian.Uint32(footer[:]), sum.Sum32())
+}
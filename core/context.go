@@ -0,0 +1,38 @@
+package core
+
+import (
+	"context"
+	"io"
+)
+
+const (
+	// ctxCheckInterval 字节循环中检查上下文的间隔
+	ctxCheckInterval = 64 * 1024
+	// ctxCheckEntries 补丁条目循环中检查上下文的间隔
+	ctxCheckEntries = 256
+)
+
+// checkContext 上下文已取消或超时时返回满足 ErrCancelled 的错误，
+// 同时可用 errors.Is 匹配 context.Canceled / context.DeadlineExceeded
+func checkContext(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return &cancelledError{cause: ctx.Err()}
+	default:
+		return nil
+	}
+}
+
+// contextReader 每次读取前检查上下文，用于长时间的 io.Copy
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read 实现 io.Reader
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := checkContext(c.ctx); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
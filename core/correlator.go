@@ -0,0 +1,73 @@
+package core
+
+import (
+	"bindiff/pkg/config"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// CorrelationBackend 对齐的互相关计算后端。默认在 CPU 上以实数 FFT 计算；
+// 以构建标签编译的 GPU 后端（如 -tags cuda）在 init 中注册，通过 Config.CorrelationBackend 选用
+type CorrelationBackend interface {
+	// Name 后端名称，与 Config.CorrelationBackend 对应
+	Name() string
+	// Convolve 计算 a 与 b 的 n 点循环卷积写入 out：out[i] = Σ_j a[j]·b[(i-j) mod n]。
+	// 三者长度均为 n（2 的幂），out 可以与 a 或 b 相同。可能被多个 goroutine 并发调用
+	Convolve(ctx context.Context, a, b, out []float64) error
+}
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]CorrelationBackend{}
+)
+
+// RegisterCorrelationBackend 注册互相关后端，同名的后端被替换
+func RegisterCorrelationBackend(backend CorrelationBackend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[backend.Name()] = backend
+}
+
+// CorrelationBackends 返回已注册的后端名称（不含内置的 cpu）
+func CorrelationBackends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// correlationBackend 按名称查找后端，空字符串与 cpu 返回 nil（使用内置的实数 FFT）
+func correlationBackend(cfg *config.Config) (CorrelationBackend, error) {
+	if cfg == nil || cfg.CorrelationBackend == "" || cfg.CorrelationBackend == config.CorrelationBackendCPU {
+		return nil, nil
+	}
+	backendsMu.RLock()
+	backend, ok := backends[cfg.CorrelationBackend]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s (not compiled in or no device available)",
+			ErrBackendUnavailable, cfg.CorrelationBackend)
+	}
+	return backend, nil
+}
+
+// convolve 计算旧序列与翻转后新序列的 n 点循环卷积，backend 为 nil 时在 CPU 上计算
+func convolve(ctx context.Context, backend CorrelationBackend, n int, fillOld, fillNew func(in []float64)) ([]float64, error) {
+	if backend == nil {
+		rfft := realFFTPlan(n)
+		return convolveCPU(ctx, rfft, newAlignBuffers(rfft), fillOld, fillNew)
+	}
+	a, b := make([]float64, n), make([]float64, n)
+	fillOld(a)
+	fillNew(b)
+	if err := backend.Convolve(ctx, a, b, a); err != nil {
+		return nil, fmt.Errorf("%s correlation backend: %w", backend.Name(), err)
+	}
+	return a, checkContext(ctx)
+}
@@ -0,0 +1,129 @@
+//go:build cuda
+
+package core
+
+/*
+#cgo LDFLAGS: -lcufft -lcudart
+#include <cuda_runtime.h>
+#include <cufft.h>
+*/
+import "C"
+
+import (
+	"bindiff/pkg/config"
+	"context"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// 有可用的 CUDA 设备时注册 cuda 后端
+func init() {
+	var count C.int
+	if C.cudaGetDeviceCount(&count) == C.cudaSuccess && count > 0 {
+		RegisterCorrelationBackend(&cudaBackend{plans: make(map[int]*cudaPlan)})
+	}
+}
+
+// cudaBackend 以 cuFFT 的双精度实数 FFT 计算循环卷积。频谱点乘在主机上完成，
+// 不需要编译 CUDA 内核；同一时刻只有一个卷积使用设备
+type cudaBackend struct {
+	mu    sync.Mutex
+	plans map[int]*cudaPlan
+}
+
+// cudaPlan 某个大小的 cuFFT 正变换与逆变换计划
+type cudaPlan struct {
+	forward, inverse C.cufftHandle
+}
+
+// Name 实现 CorrelationBackend
+func (b *cudaBackend) Name() string {
+	return config.CorrelationBackendCUDA
+}
+
+// Convolve 实现 CorrelationBackend
+func (b *cudaBackend) Convolve(ctx context.Context, a, bIn, out []float64) error {
+	n := len(a)
+	m := n/2 + 1
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	plan, err := b.plan(n)
+	if err != nil {
+		return err
+	}
+
+	// 设备缓冲区：n 个实数与两个半频谱
+	var samples, spec unsafe.Pointer
+	if err := cudaCheck(C.cudaMalloc(&samples, C.size_t(n*8))); err != nil {
+		return err
+	}
+	defer C.cudaFree(samples)
+	if err := cudaCheck(C.cudaMalloc(&spec, C.size_t(2*m*16))); err != nil {
+		return err
+	}
+	defer C.cudaFree(spec)
+
+	for i, in := range [][]float64{a, bIn} {
+		dst := unsafe.Add(spec, i*m*16)
+		if err := cudaCheck(C.cudaMemcpy(samples, unsafe.Pointer(&in[0]), C.size_t(n*8), C.cudaMemcpyHostToDevice)); err != nil {
+			return err
+		}
+		if err := cufftCheck(C.cufftExecD2Z(plan.forward, (*C.cufftDoubleReal)(samples), (*C.cufftDoubleComplex)(dst))); err != nil {
+			return err
+		}
+		if err := checkContext(ctx); err != nil {
+			return err
+		}
+	}
+
+	// 点乘并按 1/n 缩放，与 RealFFT.Inverse 一致
+	host := make([]complex128, 2*m)
+	if err := cudaCheck(C.cudaMemcpy(unsafe.Pointer(&host[0]), spec, C.size_t(2*m*16), C.cudaMemcpyDeviceToHost)); err != nil {
+		return err
+	}
+	scale := complex(1/float64(n), 0)
+	for i := 0; i < m; i++ {
+		host[i] *= host[m+i] * scale
+	}
+	if err := cudaCheck(C.cudaMemcpy(spec, unsafe.Pointer(&host[0]), C.size_t(m*16), C.cudaMemcpyHostToDevice)); err != nil {
+		return err
+	}
+	if err := cufftCheck(C.cufftExecZ2D(plan.inverse, (*C.cufftDoubleComplex)(spec), (*C.cufftDoubleReal)(samples))); err != nil {
+		return err
+	}
+	return cudaCheck(C.cudaMemcpy(unsafe.Pointer(&out[0]), samples, C.size_t(n*8), C.cudaMemcpyDeviceToHost))
+}
+
+// plan 返回大小为 n 的 cuFFT 计划，首次使用时创建，调用方持有 b.mu
+func (b *cudaBackend) plan(n int) (*cudaPlan, error) {
+	if p, ok := b.plans[n]; ok {
+		return p, nil
+	}
+	p := &cudaPlan{}
+	if err := cufftCheck(C.cufftPlan1d(&p.forward, C.int(n), C.CUFFT_D2Z, 1)); err != nil {
+		return nil, err
+	}
+	if err := cufftCheck(C.cufftPlan1d(&p.inverse, C.int(n), C.CUFFT_Z2D, 1)); err != nil {
+		C.cufftDestroy(p.forward)
+		return nil, err
+	}
+	b.plans[n] = p
+	return p, nil
+}
+
+// cudaCheck 把 CUDA 运行时的错误码转换为 error
+func cudaCheck(code C.cudaError_t) error {
+	if code == C.cudaSuccess {
+		return nil
+	}
+	return fmt.Errorf("cuda: %s", C.GoString(C.cudaGetErrorString(code)))
+}
+
+// cufftCheck 把 cuFFT 的错误码转换为 error
+func cufftCheck(code C.cufftResult) error {
+	if code == C.CUFFT_SUCCESS {
+		return nil
+	}
+	return fmt.Errorf("cufft: error %d", int(code))
+}
@@ -3,27 +3,22 @@ package core
 import (
 	"bindiff/pkg/config"
 	"bindiff/pkg/logger"
+	"bindiff/pkg/progress"
+	"bindiff/pkg/trace"
 	"bindiff/pkg/utils"
 	"bindiff/types"
 	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/binary"
+	"fmt"
 	"io"
-	"runtime"
 	"time"
 )
 
+// EqualBytes 比较两个字节切片是否相同（bytes.Equal 在常见平台上有汇编实现）
 func EqualBytes(a, b []byte) bool {
-	if len(a) != len(b) {
-		return false
-	}
-	for i := range a {
-		if a[i] != b[i] {
-			return false
-		}
-	}
-	return true
+	return bytes.Equal(a, b)
 }
 
 // NextPowerOfTwo 计算大于等于n的最小的2的幂
@@ -40,100 +35,166 @@ func NextPowerOfTwo(n int) int {
 	return n + 1
 }
 
+// EncodePatch 编码补丁，按编码后的大小一次分配
 func EncodePatch(p []types.Patch) []byte {
-	buf := new(bytes.Buffer)
-	for _, entry := range p {
-		buf.WriteByte(byte(entry.Op))
-		binary.Write(buf, binary.LittleEndian, entry.Offset)
-		binary.Write(buf, binary.LittleEndian, entry.Length)
-		if entry.Op == types.OP_INSERT || entry.Op == types.OP_REPLACE {
-			buf.Write(entry.Data)
-		}
-	}
-	return buf.Bytes()
+	return AppendPatch(make([]byte, 0, encodedSize(p)), p)
 }
 
+// DecodePatch 解码补丁，所有条目的数据存放在一次分配的缓冲区中
 func DecodePatch(b []byte) ([]types.Patch, error) {
-	r := bytes.NewReader(b)
-	var p []types.Patch
-	for r.Len() > 0 {
-		opByte, err := r.ReadByte()
-		if err != nil {
-			return p, err
-		}
-		op := types.Operator(opByte)
+	patches, _, err := decodePatchInto(b, nil, nil)
+	return patches, err
+}
 
-		var offset int64
-		var length int64
-		if err := binary.Read(r, binary.LittleEndian, &offset); err != nil {
-			return p, err
+// patchHeaderSize 单个补丁条目头长度：操作(1) + 偏移量(8) + 长度(8)
+const patchHeaderSize = 17
+
+// writePatch 编码单个补丁条目
+func writePatch(w io.Writer, entry types.Patch) error {
+	var header [patchHeaderSize]byte
+	header[0] = byte(entry.Op)
+	binary.LittleEndian.PutUint64(header[1:9], uint64(entry.Offset))
+	binary.LittleEndian.PutUint64(header[9:17], uint64(entry.Length))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if entry.Op == types.OP_INSERT || entry.Op == types.OP_REPLACE {
+		if _, err := w.Write(entry.Data); err != nil {
+			return err
 		}
-		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
-			return p, err
+	}
+	return nil
+}
+
+// readPatch 解码单个补丁条目，输入结束时返回 io.EOF
+func readPatch(r io.Reader) (types.Patch, error) {
+	return readPatchBuffer(r, nil)
+}
+
+// readPatchBuffer 解码单个补丁条目，容量足够时复用 buf 存放数据
+func readPatchBuffer(r io.Reader, buf []byte) (types.Patch, error) {
+	var header [patchHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:1]); err != nil {
+		return types.Patch{}, err
+	}
+	if _, err := io.ReadFull(r, header[1:]); err != nil {
+		return types.Patch{}, truncatedError(err, "entry header")
+	}
+	op := types.Operator(header[0])
+	offset := int64(binary.LittleEndian.Uint64(header[1:9]))
+	length := int64(binary.LittleEndian.Uint64(header[9:17]))
+
+	var data []byte
+	if op == types.OP_INSERT || op == types.OP_REPLACE {
+		var err error
+		if data, err = readBounded(r, length, buf); err != nil {
+			return types.Patch{}, truncatedError(err, "entry data")
 		}
+	}
 
-		var data []byte
-		if op == types.OP_INSERT || op == types.OP_REPLACE {
-			data = make([]byte, length)
-			if _, err := io.ReadFull(r, data); err != nil {
-				return p, err
-			}
+	return types.Patch{
+		Op:     op,
+		Offset: offset,
+		Length: length,
+		Data:   data,
+	}, nil
+}
+
+// maxPrealloc 读取长度字段指定的数据时一次预分配的上限，更长的数据随读入增长
+const maxPrealloc = 1 << 20
+
+// readBounded 读取长度字段指定的 n 字节，容量足够时复用 buf。
+// 分配不超过实际读入的数据，伪造的长度只会得到截断错误而不会导致过度分配
+func readBounded(r io.Reader, n int64, buf []byte) ([]byte, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("%w: negative length %d", ErrCorruptPatch, n)
+	}
+	if lr, ok := r.(interface{ Len() int }); ok && n > int64(lr.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	var data []byte
+	switch {
+	case buf != nil && n <= int64(cap(buf)):
+		data = buf[:n]
+	case n <= maxPrealloc:
+		data = make([]byte, n)
+	}
+	if data != nil {
+		_, err := io.ReadFull(r, data)
+		return data, err
+	}
+
+	var b bytes.Buffer
+	if m, err := io.CopyN(&b, r, n); m < n {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
 		}
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
 
-		p = append(p, types.Patch{
-			Op:     op,
-			Offset: offset,
-			Length: length,
-			Data:   data,
-		})
+// truncatedError 输入提前结束时返回 ErrCorruptPatch，其他读取错误原样返回
+func truncatedError(err error, what string) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: truncated %s", ErrCorruptPatch, what)
 	}
-	return p, nil
+	return err
 }
 
+// EncodeDiffFile 编码补丁文件，按编码后的大小一次分配
 func EncodeDiffFile(df types.DiffFile) []byte {
-	buf := new(bytes.Buffer)
-	binary.Write(buf, binary.LittleEndian, df.MagicNumber)
-	binary.Write(buf, binary.LittleEndian, df.Version)
-	binary.Write(buf, binary.LittleEndian, df.OldFileNameLength)
-	buf.Write(df.FileName)
-	binary.Write(buf, binary.LittleEndian, df.NewFileNameLength)
-	buf.Write(df.NewFileName)
-	binary.Write(buf, binary.LittleEndian, df.OldSize)
-	binary.Write(buf, binary.LittleEndian, df.NewSize)
-	buf.Write(df.OldHash)
-	buf.Write(df.NewHash)
-	binary.Write(buf, binary.LittleEndian, df.Offset)
-
-	diffBytes := EncodePatch(df.Diff)
-	binary.Write(buf, binary.LittleEndian, uint32(len(diffBytes)))
-	buf.Write(diffBytes)
-
-	return buf.Bytes()
+	size := int64(diffFileHeaderSize(&df)) + int64(len(df.Payload))
+	if df.Format == types.FORMAT_RAW {
+		size = int64(diffFileHeaderSize(&df)) + encodedSize(df.Diff)
+	}
+	if hasChecksum(df.Version) {
+		size += checksumSize
+	}
+	return AppendDiffFile(make([]byte, 0, size), df)
 }
 
+// DecodeDiffFile 解码补丁文件，版本 4 起先检查整体校验和，不一致时返回 *ChecksumError
 func DecodeDiffFile(data []byte) (types.DiffFile, error) {
+	return decodeDiffFile(data, nil)
+}
+
+// decodeDiffFile 解码补丁文件，arena 不为 nil 时操作序列存放在 arena 中
+func decodeDiffFile(data []byte, arena *PatchArena) (types.DiffFile, error) {
+	// 传输中损坏的补丁在解析之前就被拒绝，而不是表现为头错误或应用后的哈希不一致
+	if err := verifyChecksum(data); err != nil {
+		return types.DiffFile{}, err
+	}
 	r := bytes.NewReader(data)
-	df := types.DiffFile{}
-	binary.Read(r, binary.LittleEndian, &df.MagicNumber)
-	binary.Read(r, binary.LittleEndian, &df.Version)
-	binary.Read(r, binary.LittleEndian, &df.OldFileNameLength)
-	df.FileName = make([]byte, df.OldFileNameLength)
-	io.ReadFull(r, df.FileName)
-	binary.Read(r, binary.LittleEndian, &df.NewFileNameLength)
-	df.NewFileName = make([]byte, df.NewFileNameLength)
-	io.ReadFull(r, df.NewFileName)
-	binary.Read(r, binary.LittleEndian, &df.OldSize)
-	binary.Read(r, binary.LittleEndian, &df.NewSize)
-	df.OldHash = make([]byte, 32)
-	df.NewHash = make([]byte, 32)
-	io.ReadFull(r, df.OldHash)
-	io.ReadFull(r, df.NewHash)
-	binary.Read(r, binary.LittleEndian, &df.Offset)
-	binary.Read(r, binary.LittleEndian, &df.DataLength)
-	diffData := make([]byte, df.DataLength)
-	io.ReadFull(r, diffData)
-
-	patch, err := DecodePatch(diffData)
+	df, err := ReadDiffHeader(r)
+	if err != nil {
+		return df, err
+	}
+
+	remaining := int64(r.Len())
+	if hasChecksum(df.Version) {
+		remaining -= checksumSize
+		if int64(df.DataLength) < remaining {
+			return df, fmt.Errorf("%w: %d bytes between diff data and checksum", ErrCorruptPatch, remaining-int64(df.DataLength))
+		}
+	}
+	if int64(df.DataLength) > remaining {
+		return df, fmt.Errorf("%w: diff data length %d exceeds remaining %d bytes", ErrCorruptPatch, df.DataLength, remaining)
+	}
+	start := len(data) - r.Len()
+	diffData := data[start : start+int(df.DataLength)]
+	if df.Format != types.FORMAT_RAW {
+		// 其他格式的结果可能引用负载，负载总是单独复制
+		df.Payload = bytes.Clone(diffData)
+		return df, nil
+	}
+
+	var patch []types.Patch
+	if arena != nil {
+		patch, err = arena.DecodePatch(diffData)
+	} else {
+		patch, err = DecodePatch(diffData)
+	}
 	if err != nil {
 		return df, err
 	}
@@ -141,140 +202,165 @@ func DecodeDiffFile(data []byte) (types.DiffFile, error) {
 	return df, nil
 }
 
-// ComputeHash 计算数据哈希
-func ComputeHash(data []byte) []byte {
-	return utils.ComputeHash(data)
-}
-
-// ComputeHashWithProgress 带进度的哈希计算
-func ComputeHashWithProgress(data []byte, showProgress bool) []byte {
-	if !showProgress || len(data) < 1024*1024 { // 小于1MB不显示进度
-		return ComputeHash(data)
+// ReadDiffHeader 读取补丁文件头（到 DataLength 为止），r 停留在差分数据起始处，
+// 可配合 NewPatchIterator(io.LimitReader(r, int64(df.DataLength))) 逐条读取操作
+func ReadDiffHeader(r io.Reader) (types.DiffFile, error) {
+	hr := &headerReader{r: r}
+	df := types.DiffFile{}
+	hr.read(&df.MagicNumber)
+	if hr.err == nil && df.MagicNumber != types.PATCH_MAGIC {
+		return df, fmt.Errorf("%w: bad magic number 0x%08x", ErrCorruptPatch, df.MagicNumber)
 	}
-
-	progress := utils.NewProgressBar(int64(len(data)), "Computing hash", true)
-	defer progress.Finish()
-
-	hasher := sha256.New()
-	chunkSize := 64 * 1024 // 64KB chunks
-
-	for i := 0; i < len(data); i += chunkSize {
-		end := i + chunkSize
-		if end > len(data) {
-			end = len(data)
+	hr.read(&df.Version)
+	if hr.err == nil && df.Version > types.PATCH_VERSION {
+		return df, fmt.Errorf("%w %d", ErrUnsupportedVersion, df.Version)
+	}
+	if df.Version >= 2 {
+		hr.read(&df.HashAlgorithm)
+	}
+	if df.Version >= 3 {
+		hr.read(&df.Format)
+		if hr.err == nil && df.Format > types.FORMAT_DISK {
+			return df, fmt.Errorf("%w: unknown payload format %d", ErrUnsupportedVersion, df.Format)
 		}
-		hasher.Write(data[i:end])
-		progress.Set(i)
 	}
-
-	return hasher.Sum(nil)
+	hashSize := utils.HashSize(df.HashAlgorithm)
+	if hr.err == nil && hashSize == 0 {
+		return df, fmt.Errorf("%w %d", ErrUnsupportedHash, df.HashAlgorithm)
+	}
+	hr.read(&df.OldFileNameLength)
+	df.FileName = hr.bytes(int64(df.OldFileNameLength))
+	hr.read(&df.NewFileNameLength)
+	df.NewFileName = hr.bytes(int64(df.NewFileNameLength))
+	hr.read(&df.OldSize)
+	hr.read(&df.NewSize)
+	df.OldHash = hr.bytes(int64(hashSize))
+	df.NewHash = hr.bytes(int64(hashSize))
+	hr.read(&df.Offset)
+	if hasMerkle(df.Version) {
+		hr.read(&df.MerkleBlockSize)
+		if hr.err == nil && df.MerkleBlockSize > 0 {
+			// 叶子数由新文件大小决定，读取不超过实际读入的数据
+			blocks := merkleBlocks(int64(df.NewSize), int64(df.MerkleBlockSize))
+			df.MerkleLeaves = hr.bytes(blocks * int64(hashSize))
+			df.MerkleRoot = hr.bytes(int64(hashSize))
+		}
+	}
+	hr.read(&df.DataLength)
+	if hr.err != nil {
+		return df, fmt.Errorf("%w: failed to read patch header: %v", ErrCorruptPatch, hr.err)
+	}
+	return df, nil
 }
 
-// buildBlockIndex was removed as it was unused
-
-// findBestMatch and extendMatch were removed as they were unused
-
-// findNextMatchStart was removed as it was unused
+// headerReader 顺序读取头字段，记录第一个错误
+type headerReader struct {
+	r   io.Reader
+	err error
+}
 
-// optimizePatches 优化补丁序列
-func optimizePatches(patches []types.Patch) []types.Patch {
-	if len(patches) <= 1 {
-		return patches
+// read 读取定长小端字段
+func (h *headerReader) read(v interface{}) {
+	if h.err == nil {
+		h.err = binary.Read(h.r, binary.LittleEndian, v)
 	}
+}
 
-	var optimized []types.Patch
-	for i, patch := range patches {
-		if i == 0 {
-			optimized = append(optimized, patch)
-			continue
-		}
-
-		last := &optimized[len(optimized)-1]
-		// 合并相邻的相同类型操作
-		if canMergePatches(last, &patch) {
-			mergePatches(last, &patch)
-		} else {
-			optimized = append(optimized, patch)
-		}
+// bytes 读取长度字段指定的 n 字节，分配不超过实际读入的数据（见 readBounded）
+func (h *headerReader) bytes(n int64) []byte {
+	if h.err != nil {
+		return nil
 	}
-
-	return optimized
+	var b []byte
+	b, h.err = readBounded(h.r, n, nil)
+	return b
 }
 
-// canMergePatches 检查是否可以合并补丁
-func canMergePatches(p1, p2 *types.Patch) bool {
-	return p1.Op == p2.Op &&
-		p1.Op == types.OP_INSERT &&
-		p1.Offset+p1.Length == p2.Offset
+// ComputeHash 计算数据哈希
+func ComputeHash(data []byte) []byte {
+	return utils.ComputeHash(data)
 }
 
-// mergePatches 合并补丁
-func mergePatches(p1, p2 *types.Patch) {
-	p1.Length += p2.Length
-	p1.Data = append(p1.Data, p2.Data...)
+// ComputeHashWith 使用指定算法计算数据哈希
+func ComputeHashWith(algo types.HashAlgorithm, data []byte) ([]byte, error) {
+	return utils.ComputeHashWith(algo, data)
 }
 
-// parallelDiff 并发差分算法
-func parallelDiff(oldData, newData []byte, options *DiffOptions) []types.Patch {
-	numWorkers := options.Config.MaxWorkers
-	if numWorkers <= 1 {
-		return sequentialDiff(oldData, newData, options)
+// VerifyHash 使用指定算法校验数据哈希，不一致时返回错误并触发 OnVerify 钩子
+func VerifyHash(algo types.HashAlgorithm, data, expected []byte, hooks *Hooks) error {
+	actual, err := ComputeHashWith(algo, data)
+	if err != nil {
+		return err
 	}
+	return CheckHash(algo, actual, expected, hooks)
+}
 
-	// 将数据分割成块
-	chunkSize := len(newData) / numWorkers
-	if chunkSize < options.Config.BlockSize {
-		return sequentialDiff(oldData, newData, options)
+// CheckHash 比较计算出的哈希与期望值，触发 OnVerify 钩子
+func CheckHash(algo types.HashAlgorithm, actual, expected []byte, hooks *Hooks) error {
+	ok := utils.CompareHashes(actual, expected)
+	hooks.verify(algo, expected, actual, ok)
+	if !ok {
+		return fmt.Errorf("%w\nExpected: %x\nActual: %x", ErrHashMismatch, expected, actual)
 	}
-
-	// 为了简化，在这个版本中我们回退到串行处理
-	// 并发处理需要更复杂的协调逻辑
-	logger.Info("Parallel diff requested, using sequential for compatibility")
-	return sequentialDiff(oldData, newData, options)
+	return nil
 }
 
-// streamingDiff 流式差分算法（用于大文件）
-func streamingDiff(oldData, newData []byte, options *DiffOptions) []types.Patch {
-	logger.Info("Using streaming diff algorithm for large files")
-
-	// 分块处理大文件
-	chunkSize := options.Config.MaxMemoryMB * 1024 * 1024 / 4 // 使用1/4的内存限制作为块大小
-	if chunkSize <= 0 {
-		chunkSize = 64 * 1024 // 默认 64KB
+// ComputeHashWithProgress 带进度的哈希计算，showProgress 为 true 时按 --progress-format 输出进度
+//
+// Deprecated: 使用 ComputeHashWithReporter，由调用方决定进度的输出方式。
+func ComputeHashWithProgress(data []byte, showProgress bool) []byte {
+	var reporter ProgressReporter
+	if showProgress {
+		reporter = progress.Default()
 	}
+	return ComputeHashWithReporter(data, reporter)
+}
 
-	var patches []types.Patch
-
-	for offset := 0; offset < len(newData); offset += chunkSize {
-		end := offset + chunkSize
-		if end > len(newData) {
-			end = len(newData)
-		}
-
-		// 为当前块计算差分
-		chunkPatches := sequentialDiff(oldData, newData[offset:end], options)
+// ComputeHashWithReporter 计算 SHA256 哈希并向 reporter 报告进度，reporter 为 nil 时不报告
+func ComputeHashWithReporter(data []byte, reporter ProgressReporter) []byte {
+	if reporter == nil || len(data) < 1024*1024 { // 小于1MB不报告进度
+		return ComputeHash(data)
+	}
 
-		// 调整偏移量
-		for i := range chunkPatches {
-			chunkPatches[i].Offset += int64(offset)
-		}
+	progress := newProgressTracker(reporter, ProgressStageHash, int64(len(data)))
+	defer progress.finish()
 
-		patches = append(patches, chunkPatches...)
+	hasher := sha256.New()
+	chunkSize := 64 * 1024 // 64KB chunks
 
-		// 强制GC以释放内存
-		if offset > 0 && offset%chunkSize == 0 {
-			runtime.GC()
+	for i := 0; i < len(data); i += chunkSize {
+		end := i + chunkSize
+		if end > len(data) {
+			end = len(data)
 		}
+		hasher.Write(data[i:end])
+		progress.update(int64(end))
 	}
 
-	return optimizePatches(patches)
+	return hasher.Sum(nil)
 }
 
+// buildBlockIndex was removed as it was unused
+
+// findBestMatch and extendMatch were removed as they were unused
+
+// findNextMatchStart was removed as it was unused
+
 // DiffOptions 差分选项
 type DiffOptions struct {
-	Config       *config.Config
+	Config *config.Config
+	// ShowProgress 已不再绘制终端进度条，请通过 Progress 接收进度
 	ShowProgress bool
 	Context      context.Context
+	Progress     ProgressReporter
+	Hooks        *Hooks
+	// Logger 日志输出，nil 时不输出日志
+	Logger logger.Logger
+	// RenameThreshold 目录差分的重命名检测相似度阈值，0 使用默认值，负数禁用检测
+	RenameThreshold float64
+	// Strategy DiffPayload 的差分方式（config.StrategyAuto 等），为空时依次尝试各种感知差分。
+	// 目录差分按文件的配置档设置（见 WithProfile）
+	Strategy string
 }
 
 // DiffResult 差分结果
@@ -285,86 +371,191 @@ type DiffResult struct {
 	CompressionRatio float64
 	ProcessTime      time.Duration
 	Offset           int32
+	// AlignConfidence FFT 对齐的置信度（见 Alignment），未对齐时为 0
+	AlignConfidence float64
+	// Memory 差分期间采样到的内存峰值，可与 MaxMemoryMB 对照调整预算
+	Memory utils.MemoryPeak
 }
 
-// Diff 改进的差分算法
-func Diff(oldData, newData []byte) []types.Patch {
-	return DiffWithOptions(oldData, newData, &DiffOptions{
-		Config:       config.DefaultConfig(),
-		ShowProgress: false,
-		Context:      context.Background(),
-	})
-}
-
-// DiffWithOptions 使用选项的差分算法
-func DiffWithOptions(oldData, newData []byte, options *DiffOptions) []types.Patch {
+// DiffFull 计算差分并返回带统计信息的结果，启用 FFT 时同时计算对齐偏移量，
+// 置信度低于 MinAlignConfidence 时偏移量回退为 0；启用 AutoTune 时先抽样选择块匹配参数
+func DiffFull(oldData, newData []byte, options *DiffOptions) (*DiffResult, error) {
 	start := time.Now()
-	defer func() {
-		logger.Infof("Diff completed in %v", time.Since(start))
-	}()
-
-	if options == nil {
-		options = &DiffOptions{
-			Config:       config.DefaultConfig(),
-			ShowProgress: false,
-			Context:      context.Background(),
+	options = normalizeDiffOptions(options)
+	mem := utils.TrackMemory(0)
+	defer mem.Stop()
+
+	var align Alignment
+	if options.Config.EnableFFT && len(oldData) > 0 && len(newData) > 0 {
+		_, span := trace.Start(options.Context, "align")
+		var err error
+		align, err = ComputeAlignment(options.Context, oldData, newData, options.Config)
+		span.SetAttributes(trace.Int64("offset", int64(align.Offset)),
+			trace.Float64("confidence", align.Confidence))
+		span.RecordError(err)
+		span.End()
+		if err != nil {
+			return nil, err
+		}
+		if align.Confidence < MinAlignConfidence && align.Offset != 0 {
+			options.Logger.Infof("Alignment confidence %.2f below %.2f, using offset 0 instead of %d",
+				align.Confidence, MinAlignConfidence, align.Offset)
+			align.Offset = 0
 		}
 	}
 
-	// 内存使用检查
-	totalSize := int64(len(oldData) + len(newData))
-	maxMemory := int64(options.Config.MaxMemoryMB) * 1024 * 1024
-	if totalSize > maxMemory {
-		logger.Warnf("Data size (%s) exceeds memory limit (%s), using streaming mode",
-			utils.FormatBytes(totalSize), utils.FormatBytes(maxMemory))
-		return streamingDiff(oldData, newData, options)
+	if options.Config.AutoTune {
+		_, span := trace.Start(options.Context, "tune")
+		tuned, err := TuneParameters(oldData, newData, options)
+		span.SetAttributes(trace.Int64("block_size", int64(tuned.BlockSize)),
+			trace.Int64("min_match_length", int64(tuned.MinMatchLength)))
+		span.RecordError(err)
+		span.End()
+		if err != nil {
+			return nil, err
+		}
+		options.Logger.Infof("Auto-tuned block size %d, min match length %d (estimated patch %s)",
+			tuned.BlockSize, tuned.MinMatchLength, utils.FormatBytes(tuned.EstimatedSize))
+		cfg := *options.Config
+		cfg.BlockSize, cfg.MinMatchLength = tuned.BlockSize, tuned.MinMatchLength
+		options.Config = &cfg
 	}
 
-	// 使用并发或串行处理
-	if options.Config.UseParallel && len(oldData) > options.Config.BlockSize*10 {
-		return parallelDiff(oldData, newData, options)
+	_, span := trace.Start(options.Context, "match")
+	patches, err := DiffBytes(oldData, newData, options)
+	span.SetAttributes(trace.Int64("patches", int64(len(patches))))
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		return nil, err
 	}
 
-	return sequentialDiff(oldData, newData, options)
+	return &DiffResult{
+		Patches:          patches,
+		OldSize:          int64(len(oldData)),
+		NewSize:          int64(len(newData)),
+		CompressionRatio: CompressionRatio(patches, int64(len(newData))),
+		ProcessTime:      time.Since(start),
+		Offset:           int32(align.Offset),
+		AlignConfidence:  align.Confidence,
+		Memory:           mem.Stop(),
+	}, nil
 }
 
-// sequentialDiff 串行差分算法
-func sequentialDiff(oldData, newData []byte, options *DiffOptions) []types.Patch {
-	var patches []types.Patch
-	var progress *utils.ProgressBar
+// CompressionRatio 计算编码后补丁大小与新数据大小之比
+func CompressionRatio(patches []types.Patch, newSize int64) float64 {
+	if newSize == 0 {
+		return 0
+	}
+	return float64(encodedSize(patches)) / float64(newSize)
+}
 
-	if options.ShowProgress {
-		progress = utils.NewProgressBar(int64(len(newData)), "Computing diff", true)
-		defer progress.Finish()
+// defaultDiffOptions 返回默认差分选项
+func defaultDiffOptions() *DiffOptions {
+	return &DiffOptions{
+		Config:       config.DefaultConfig(),
+		ShowProgress: false,
+		Context:      context.Background(),
+		Logger:       logger.Nop(),
 	}
+}
 
-	// 简化的差分算法：直接比较字节
-	minLen := len(oldData)
-	if len(newData) < minLen {
-		minLen = len(newData)
+// normalizeDiffOptions 补全缺省字段，返回副本以免修改调用方的选项
+func normalizeDiffOptions(options *DiffOptions) *DiffOptions {
+	if options == nil {
+		return defaultDiffOptions()
+	}
+	normalized := *options
+	if normalized.Config == nil {
+		normalized.Config = config.DefaultConfig()
+	}
+	if normalized.Context == nil {
+		normalized.Context = context.Background()
+	}
+	if normalized.Logger == nil {
+		normalized.Logger = logger.Nop()
 	}
+	return &normalized
+}
 
-	i := 0
-	for i < minLen {
-		// 检查上下文取消
-		select {
-		case <-options.Context.Done():
-			logger.Warn("Diff operation cancelled")
-			return patches
-		default:
+// Diff 改进的差分算法，可传入函数式选项，如 Diff(old, new, WithWorkers(8))
+//
+// Deprecated: 使用 DiffWith 或 DiffBytes，它们会返回取消等错误而不是仅记录日志。
+func Diff(oldData, newData []byte, opts ...Option) []types.Patch {
+	return DiffWithOptions(oldData, newData, NewDiffOptions(opts...))
+}
+
+// DiffWithOptions 使用选项的差分算法
+//
+// Deprecated: 使用 DiffBytes，它会返回取消等错误而不是仅记录日志。
+func DiffWithOptions(oldData, newData []byte, options *DiffOptions) []types.Patch {
+	options = normalizeDiffOptions(options)
+	patches, err := DiffBytes(oldData, newData, options)
+	if err != nil {
+		options.Logger.Warnf("Diff operation failed: %v", err)
+	}
+	return patches
+}
+
+// DiffBytes 计算差分并返回错误（如上下文取消）
+func DiffBytes(oldData, newData []byte, options *DiffOptions) (patches []types.Patch, err error) {
+	start := time.Now()
+	options = normalizeDiffOptions(options)
+	options.Hooks.start(OperationDiff, int64(len(oldData)), int64(len(newData)))
+	defer func() {
+		options.Logger.Infof("Diff completed in %v", time.Since(start))
+		if err == nil {
+			for _, patch := range patches {
+				if patch.Op == types.OP_COPY || patch.Op == types.OP_MATCH {
+					options.Hooks.blockMatched(patch)
+				}
+			}
 		}
+		options.Hooks.complete(OperationDiff, start, err)
+	}()
 
-		// 更新进度
-		if progress != nil {
-			progress.Set(i)
+	if err := checkContext(options.Context); err != nil {
+		return nil, err
+	}
+
+	// 块匹配，块大小与并发按 MaxMemoryMB 预算确定
+	return blockDiff(oldData, newData, options)
+}
+
+// diffRange 逐字节比较 [from, to) 区间，相同区段记为 COPY，不同区段记为 REPLACE
+func diffRange(ctx context.Context, oldData, newData []byte, from, to int, progress *progressTracker) ([]types.Patch, error) {
+	var patches []types.Patch
+
+	i := from
+	nextCheck := from
+	for i < to {
+		start := i
+		equal := oldData[i] == newData[i]
+		for i < to {
+			// 定期检查上下文取消并更新进度
+			if i >= nextCheck {
+				if err := checkContext(ctx); err != nil {
+					return nil, err
+				}
+				progress.update(int64(i))
+				nextCheck = i + ctxCheckInterval
+			}
+			end := to
+			if nextCheck < end {
+				end = nextCheck
+			}
+			run := differingPrefix
+			if equal {
+				run = commonPrefix
+			}
+			i += run(oldData[i:end], newData[i:end])
+			if i < end {
+				break
+			}
 		}
 
-		if oldData[i] == newData[i] {
+		if equal {
 			// 相同的数据，记录 COPY 操作
-			start := i
-			for i < minLen && oldData[i] == newData[i] {
-				i++
-			}
 			patches = append(patches, types.Patch{
 				Op:     types.OP_COPY,
 				Offset: int64(start),
@@ -372,10 +563,6 @@ func sequentialDiff(oldData, newData []byte, options *DiffOptions) []types.Patch
 			})
 		} else {
 			// 不同的数据，记录 REPLACE 操作
-			start := i
-			for i < minLen && oldData[i] != newData[i] {
-				i++
-			}
 			patches = append(patches, types.Patch{
 				Op:     types.OP_REPLACE,
 				Offset: int64(start),
@@ -385,7 +572,11 @@ func sequentialDiff(oldData, newData []byte, options *DiffOptions) []types.Patch
 		}
 	}
 
-	// 处理尾部数据
+	return patches, nil
+}
+
+// appendTailPatch 处理公共长度之后的尾部数据
+func appendTailPatch(patches []types.Patch, oldData, newData []byte, minLen int) []types.Patch {
 	if len(newData) > minLen {
 		// 新数据更长，需要 INSERT
 		patches = append(patches, types.Patch{
@@ -402,7 +593,6 @@ func sequentialDiff(oldData, newData []byte, options *DiffOptions) []types.Patch
 			Length: int64(len(oldData) - minLen),
 		})
 	}
-
 	return patches
 }
 
@@ -447,6 +637,8 @@ func OptimizePatches(patches []types.Patch) []types.Patch {
 }
 
 // ApplyPatch 应用补丁（改进版本）
+//
+// Deprecated: 使用 Apply，它会返回无效补丁和取消错误而不是仅记录日志。
 func ApplyPatch(oldData []byte, patch []types.Patch) []byte {
 	return ApplyPatchWithOptions(oldData, patch, &ApplyOptions{
 		Config:       config.DefaultConfig(),
@@ -457,104 +649,232 @@ func ApplyPatch(oldData []byte, patch []types.Patch) []byte {
 
 // ApplyOptions 应用补丁选项
 type ApplyOptions struct {
-	Config       *config.Config
+	Config *config.Config
+	// ShowProgress 已不再绘制终端进度条，请通过 Progress 接收进度
 	ShowProgress bool
 	Context      context.Context
+	Progress     ProgressReporter
 	VerifyResult bool
+	// Lenient 为 true 时跳过无效条目并截断越界操作（旧行为），
+	// 默认严格模式遇到无效条目时返回 *PatchError
+	Lenient bool
+	Hooks   *Hooks
+	// Logger 日志输出，nil 时不输出日志
+	Logger logger.Logger
+}
+
+// defaultApplyOptions 返回默认应用选项
+func defaultApplyOptions() *ApplyOptions {
+	return &ApplyOptions{
+		Config:       config.DefaultConfig(),
+		ShowProgress: false,
+		Context:      context.Background(),
+		VerifyResult: true,
+		Logger:       logger.Nop(),
+	}
+}
+
+// normalizeApplyOptions 返回补全默认值的选项副本
+func normalizeApplyOptions(options *ApplyOptions) *ApplyOptions {
+	if options == nil {
+		return defaultApplyOptions()
+	}
+	normalized := *options
+	if normalized.Config == nil {
+		normalized.Config = config.DefaultConfig()
+	}
+	if normalized.Context == nil {
+		normalized.Context = context.Background()
+	}
+	if normalized.Logger == nil {
+		normalized.Logger = logger.Nop()
+	}
+	return &normalized
 }
 
 // ApplyPatchWithOptions 使用选项应用补丁
+//
+// Deprecated: 使用 Apply，它会返回无效补丁和取消错误而不是仅记录日志。
 func ApplyPatchWithOptions(oldData []byte, patches []types.Patch, options *ApplyOptions) []byte {
+	lenient := normalizeApplyOptions(options)
+	lenient.Lenient = true
+
+	newData, err := applyPatches(oldData, patches, lenient)
+	if err != nil {
+		lenient.Logger.Warnf("Patch application failed: %v", err)
+	}
+	return newData
+}
+
+// Apply 应用补丁并返回错误（无效条目、上下文取消等）
+// 除非设置 options.Lenient，否则无效条目会返回 *PatchError
+func Apply(oldData []byte, patches []types.Patch, options *ApplyOptions) ([]byte, error) {
+	newData, err := applyPatches(oldData, patches, options)
+	if err != nil {
+		return nil, err
+	}
+	return newData, nil
+}
+
+// ApplyInto 将补丁应用结果写入调用方提供的 dst，返回写入的字节数，
+// 不为结果分配内存；dst 不足以容纳结果时返回 io.ErrShortBuffer
+func ApplyInto(dst, oldData []byte, patches []types.Patch, options *ApplyOptions) (int, error) {
+	if dst == nil {
+		dst = []byte{}
+	}
+	newData, err := applyPatchesTo(dst, oldData, patches, options)
+	return len(newData), err
+}
+
+// applyPatches 应用补丁的公共实现，宽松模式下跳过无效补丁
+func applyPatches(oldData []byte, patches []types.Patch, options *ApplyOptions) ([]byte, error) {
+	return applyPatchesTo(nil, oldData, patches, options)
+}
+
+// applyPatchesTo 将结果追加到 dst；dst 为 nil 时按估算大小分配，
+// 否则结果不得超出 dst 的长度，超出时返回 io.ErrShortBuffer
+func applyPatchesTo(dst, oldData []byte, patches []types.Patch, options *ApplyOptions) (newData []byte, err error) {
 	start := time.Now()
+	options = normalizeApplyOptions(options)
+	options.Hooks.start(OperationApply, int64(len(oldData)), -1)
 	defer func() {
-		logger.Infof("Patch applied in %v", time.Since(start))
+		options.Logger.Infof("Patch applied in %v", time.Since(start))
+		options.Hooks.complete(OperationApply, start, err)
 	}()
+	ctx := options.Context
+	strict := !options.Lenient
 
-	if options == nil {
-		options = &ApplyOptions{
-			Config:       config.DefaultConfig(),
-			ShowProgress: false,
-			Context:      context.Background(),
-			VerifyResult: true,
-		}
+	// 资源上限在严格与宽松模式下都中止应用
+	limits := limitsOf(options.Config)
+	if err := limits.checkPatch(patches); err != nil {
+		return nil, err
 	}
 
-	// 估算结果大小
-	var estimatedSize int64
-	for _, p := range patches {
-		switch p.Op {
-		case types.OP_INSERT, types.OP_REPLACE:
-			estimatedSize += p.Length
-		case types.OP_COPY, types.OP_MATCH:
-			estimatedSize += p.Length
+	bounded := dst != nil
+	if bounded {
+		newData = dst[:0:len(dst)]
+	} else {
+		// 估算结果大小：插入的数据按实际长度计，复制的总量不超过旧数据，
+		// 伪造的 Length 不会导致过度分配
+		var inserted, copied int64
+		for _, p := range patches {
+			switch p.Op {
+			case types.OP_INSERT, types.OP_REPLACE:
+				inserted += int64(len(p.Data))
+			case types.OP_COPY, types.OP_MATCH:
+				if p.Length > 0 {
+					copied = min(copied+min(p.Length, int64(len(oldData))), int64(len(oldData)))
+				}
+			}
 		}
-	}
 
-	// 预分配结果缓冲区
-	newData := make([]byte, 0, estimatedSize)
-	var progress *utils.ProgressBar
-
-	if options.ShowProgress {
-		progress = utils.NewProgressBar(int64(len(patches)), "Applying patches", true)
-		defer progress.Finish()
+		// 预分配结果缓冲区
+		newData = make([]byte, 0, inserted+copied)
 	}
+	progress := newProgressTracker(options.Progress, ProgressStageApply, int64(len(patches)))
 
 	cursor := 0
 	for i, patch := range patches {
-		// 检查上下文取消
-		select {
-		case <-options.Context.Done():
-			logger.Warn("Patch application cancelled")
-			return newData
-		default:
-		}
-
-		// 更新进度
-		if progress != nil {
-			progress.Set(i)
+		// 定期检查上下文取消并更新进度
+		if i%ctxCheckEntries == 0 {
+			if err := checkContext(ctx); err != nil {
+				options.Logger.Warnf("Patch application cancelled")
+				return newData, err
+			}
+			progress.update(int64(i))
 		}
 
 		// 验证偏移量
-		if int(patch.Offset) > len(oldData) {
-			logger.Warnf("Patch offset %d exceeds old data length %d, skipping",
+		if patch.Offset < 0 || patch.Length < 0 {
+			if strict {
+				return newData, newPatchError(i, patch, "negative offset or length")
+			}
+			options.Logger.Warnf("Patch has negative offset %d or length %d, skipping", patch.Offset, patch.Length)
+			continue
+		}
+		if patch.Offset > int64(len(oldData)) {
+			if strict {
+				return newData, newPatchError(i, patch, "offset exceeds old data length %d", len(oldData))
+			}
+			options.Logger.Warnf("Patch offset %d exceeds old data length %d, skipping",
 				patch.Offset, len(oldData))
 			continue
 		}
 
 		// 复制中间的数据
 		if int(patch.Offset) > cursor {
-			newData = append(newData, oldData[cursor:patch.Offset]...)
+			if newData, err = appendOutput(newData, oldData[cursor:patch.Offset], bounded); err != nil {
+				return newData, err
+			}
 			cursor = int(patch.Offset)
 		}
 
 		// 应用操作
 		switch patch.Op {
 		case types.OP_INSERT:
-			newData = append(newData, patch.Data...)
-		case types.OP_REPLACE:
-			cursor += int(patch.Length)
-			newData = append(newData, patch.Data...)
-		case types.OP_DELETE:
+			if newData, err = appendOutput(newData, patch.Data, bounded); err != nil {
+				return newData, err
+			}
+		case types.OP_REPLACE, types.OP_DELETE:
+			if patch.Length > int64(len(oldData)-cursor) {
+				if strict {
+					return newData, newPatchError(i, patch, "length exceeds old data length %d", len(oldData))
+				}
+				patch.Length = int64(len(oldData) - cursor)
+			}
 			cursor += int(patch.Length)
+			if patch.Op == types.OP_REPLACE {
+				if newData, err = appendOutput(newData, patch.Data, bounded); err != nil {
+					return newData, err
+				}
+			}
 		case types.OP_COPY, types.OP_MATCH:
-			endPos := cursor + int(patch.Length)
-			if endPos > len(oldData) {
-				logger.Warnf("Copy operation exceeds old data bounds, truncating")
-				endPos = len(oldData)
+			endPos := len(oldData)
+			if patch.Length <= int64(len(oldData)-cursor) {
+				endPos = cursor + int(patch.Length)
+			} else {
+				if strict {
+					return newData, newPatchError(i, patch, "copy exceeds old data length %d", len(oldData))
+				}
+				options.Logger.Warnf("Copy operation exceeds old data bounds, truncating")
 			}
 			if cursor < len(oldData) && endPos > cursor {
-				newData = append(newData, oldData[cursor:endPos]...)
+				if newData, err = appendOutput(newData, oldData[cursor:endPos], bounded); err != nil {
+					return newData, err
+				}
 				cursor = endPos
 			}
 		default:
-			logger.Warnf("Unknown patch operation: %d", patch.Op)
+			if strict {
+				return newData, newPatchError(i, patch, "unknown operation")
+			}
+			options.Logger.Warnf("Unknown patch operation: %d", patch.Op)
+			continue
 		}
+		if err := limits.checkOutput(int64(len(newData))); err != nil {
+			return newData, err
+		}
+		options.Hooks.opApplied(i, patch)
 	}
 
 	// 复制剩余数据
 	if cursor < len(oldData) {
-		newData = append(newData, oldData[cursor:]...)
+		if err := limits.checkOutput(int64(len(newData) + len(oldData) - cursor)); err != nil {
+			return newData, err
+		}
+		if newData, err = appendOutput(newData, oldData[cursor:], bounded); err != nil {
+			return newData, err
+		}
 	}
 
-	return newData
+	progress.finish()
+	return newData, nil
+}
+
+// appendOutput 追加输出，bounded 时不超出 dst 的容量
+func appendOutput(dst, p []byte, bounded bool) ([]byte, error) {
+	if bounded && len(dst)+len(p) > cap(dst) {
+		return dst, fmt.Errorf("%w: output buffer of %d bytes is too small", io.ErrShortBuffer, cap(dst))
+	}
+	return append(dst, p...), nil
 }
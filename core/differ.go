@@ -0,0 +1,92 @@
+package core
+
+import (
+	"bindiff/pkg/config"
+	"bindiff/types"
+	"io"
+	"sync"
+)
+
+// Differ 可复用的差分器：复用流式缓冲区与对齐缓冲区（FFT 计划由包内缓存共享），
+// 可在多个 goroutine 中并发使用。通过 NewDiffer 绑定旧数据时可直接调用 WriteDiff
+type Differ struct {
+	old     io.ReaderAt
+	options *DiffOptions
+	chunks  sync.Pool
+	scratch sync.Map // FFT 大小 -> *sync.Pool（*alignBuffers）
+	// scratch32 单精度对齐的缓冲区池：FFT 大小 -> *sync.Pool（*alignBuffers32）
+	scratch32 sync.Map
+}
+
+// NewDiffer 创建差分器，old 为流式差分使用的旧数据，可为 nil
+func NewDiffer(old io.ReaderAt, options *DiffOptions) *Differ {
+	d := &Differ{
+		old:     old,
+		options: normalizeDiffOptions(options),
+	}
+	d.chunks.New = func() interface{} {
+		buf := make([]byte, streamBufferSize(d.options.Config))
+		return &buf
+	}
+	return d
+}
+
+// NewSharedDiffer 创建不绑定旧数据的差分器，供服务在大量调用间共享
+func NewSharedDiffer(options *DiffOptions) *Differ {
+	return NewDiffer(nil, options)
+}
+
+// Diff 计算内存数据的差分
+func (d *Differ) Diff(oldData, newData []byte) ([]types.Patch, error) {
+	return DiffBytes(oldData, newData, d.options)
+}
+
+// ComputeOffset 计算最佳对齐偏移量（精度见 Config.FFTPrecision，大文件使用分层对齐），
+// 复用缓存的 FFT 计划与缓冲区；配置了互相关后端时由该后端计算
+func (d *Differ) ComputeOffset(oldData, newData []byte) (int, error) {
+	backend, err := correlationBackend(d.options.Config)
+	if err != nil {
+		return 0, err
+	}
+	if backend != nil {
+		align, err := computeHierarchical(d.options.Context, oldData, newData, backend)
+		return align.Offset, err
+	}
+	n := NextPowerOfTwo(len(oldData) + len(newData) - 1)
+	if n > maxDirectFFTSize {
+		return ComputeOffsetHierarchical(d.options.Context, oldData, newData)
+	}
+	if d.options.Config.FFTPrecision == config.FFTPrecisionFloat32 {
+		rfft := realFFT32Plan(n)
+		pool := scratchPool(&d.scratch32, n, func() interface{} { return newAlignBuffers32(rfft) })
+		bufs := pool.Get().(*alignBuffers32)
+		defer pool.Put(bufs)
+		align, err := computeOffset32(d.options.Context, oldData, newData, rfft, bufs)
+		return align.Offset, err
+	}
+	rfft := realFFTPlan(n)
+	pool := scratchPool(&d.scratch, n, func() interface{} { return newAlignBuffers(rfft) })
+	bufs := pool.Get().(*alignBuffers)
+	defer pool.Put(bufs)
+	align, err := computeOffset(d.options.Context, oldData, newData, rfft, bufs)
+	return align.Offset, err
+}
+
+// scratchPool 从 pools 获取 FFT 大小为 n 的对齐缓冲区池，newBufs 分配新的缓冲区
+func scratchPool(pools *sync.Map, n int, newBufs func() interface{}) *sync.Pool {
+	if pool, ok := pools.Load(n); ok {
+		return pool.(*sync.Pool)
+	}
+	pool, _ := pools.LoadOrStore(n, &sync.Pool{New: newBufs})
+	return pool.(*sync.Pool)
+}
+
+// getChunk 从池中获取流式缓冲区
+func (d *Differ) getChunk() []byte {
+	return *d.chunks.Get().(*[]byte)
+}
+
+// putChunk 归还流式缓冲区
+func (d *Differ) putChunk(buf []byte) {
+	d.chunks.Put(&buf)
+}
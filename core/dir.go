@@ -0,0 +1,228 @@
+package core
+
+import (
+	"bindiff/pkg/utils"
+	"bindiff/types"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DiffDirs 比较两个磁盘目录
+func DiffDirs(oldDir, newDir string, options *DiffOptions) ([]types.FileDiff, error) {
+	return DiffFS(os.DirFS(oldDir), os.DirFS(newDir), options)
+}
+
+// DiffFS 比较两个文件系统中的常规文件，可用于 embed.FS、zip.Reader、fstest.MapFS 等，
+// 结果按路径排序。删除的文件与新增的文件足够相似时合并为一个 FILE_RENAMED 条目，
+// 补丁以原文件为基计算。每个文件按匹配的配置档调整块匹配参数（见 WithProfile）
+func DiffFS(oldFS, newFS fs.FS, options *DiffOptions) ([]types.FileDiff, error) {
+	options = normalizeDiffOptions(options)
+	threshold, blockSize, detectRenames := RenameDetection(options)
+
+	oldFiles, err := listFiles(oldFS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list old files: %w", err)
+	}
+	newFiles, err := listFiles(newFS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list new files: %w", err)
+	}
+
+	paths := make(map[string]bool)
+	for _, p := range oldFiles {
+		paths[p] = true
+	}
+	for _, p := range newFiles {
+		paths[p] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	oldSet := toSet(oldFiles)
+	newSet := toSet(newFiles)
+
+	// 新增与删除文件的指纹，用于重命名检测
+	removedPrints := make(map[string]*Fingerprint)
+	addedPrints := make(map[string]*Fingerprint)
+
+	var diffs []types.FileDiff
+	for _, p := range sorted {
+		if err := checkContext(options.Context); err != nil {
+			return nil, err
+		}
+
+		var oldData, newData []byte
+		if oldSet[p] {
+			if oldData, err = fs.ReadFile(oldFS, p); err != nil {
+				return nil, fmt.Errorf("failed to read old file %s: %w", p, err)
+			}
+		}
+		if newSet[p] {
+			if newData, err = fs.ReadFile(newFS, p); err != nil {
+				return nil, fmt.Errorf("failed to read new file %s: %w", p, err)
+			}
+		}
+
+		fd := types.FileDiff{
+			Path:    p,
+			OldSize: int64(len(oldData)),
+			NewSize: int64(len(newData)),
+		}
+		switch {
+		case !oldSet[p]:
+			fd.Kind = types.FILE_ADDED
+			if detectRenames {
+				addedPrints[p] = NewFingerprint(newData, blockSize)
+			}
+		case !newSet[p]:
+			fd.Kind = types.FILE_REMOVED
+			if detectRenames {
+				removedPrints[p] = NewFingerprint(oldData, blockSize)
+			}
+		case bytes.Equal(oldData, newData):
+			fd.Kind = types.FILE_UNCHANGED
+		default:
+			fd.Kind = types.FILE_MODIFIED
+		}
+
+		// 新增文件的补丁在重命名检测后计算
+		if fd.Kind == types.FILE_MODIFIED || fd.Kind == types.FILE_ADDED && !detectRenames {
+			if fd.Patches, err = DiffBytes(oldData, newData, WithProfile(options, p, oldData)); err != nil {
+				return nil, fmt.Errorf("failed to diff %s: %w", p, err)
+			}
+		}
+		diffs = append(diffs, fd)
+	}
+
+	if !detectRenames {
+		options.Logger.Infof("Directory diff: %d files compared", len(diffs))
+		return diffs, nil
+	}
+
+	renames := MatchRenames(removedPrints, addedPrints, threshold)
+	renamed := make(map[string]bool, len(renames))
+	for _, from := range renames {
+		renamed[from] = true
+	}
+
+	result := diffs[:0]
+	for _, fd := range diffs {
+		if fd.Kind == types.FILE_REMOVED && renamed[fd.Path] {
+			continue
+		}
+		if fd.Kind == types.FILE_ADDED {
+			if err := checkContext(options.Context); err != nil {
+				return nil, err
+			}
+			var oldData []byte
+			if from, ok := renames[fd.Path]; ok {
+				if oldData, err = fs.ReadFile(oldFS, from); err != nil {
+					return nil, fmt.Errorf("failed to read old file %s: %w", from, err)
+				}
+				fd.Kind = types.FILE_RENAMED
+				fd.OldPath = from
+				fd.OldSize = int64(len(oldData))
+			}
+			newData, err := fs.ReadFile(newFS, fd.Path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read new file %s: %w", fd.Path, err)
+			}
+			if fd.Patches, err = DiffBytes(oldData, newData, WithProfile(options, fd.Path, oldData)); err != nil {
+				return nil, fmt.Errorf("failed to diff %s: %w", fd.Path, err)
+			}
+		}
+		result = append(result, fd)
+	}
+
+	options.Logger.Infof("Directory diff: %d files compared, %d renames detected", len(result), len(renames))
+	return result, nil
+}
+
+// ApplyFS 将目录差分应用到 oldFS，结果写入磁盘目录 outDir。
+// 全部文件在一个事务中写入：任一文件失败时 outDir 保持不变，上次中断的应用先被回滚。
+// 路径必须是 fs.ValidPath 接受的相对路径，含 .. 或绝对路径的差分在写入任何文件前被拒绝
+func ApplyFS(oldFS fs.FS, diffs []types.FileDiff, outDir string, options *ApplyOptions) error {
+	for _, fd := range diffs {
+		if !validPath(fd.Path) {
+			return fmt.Errorf("%w: invalid path %q", ErrCorruptPatch, fd.Path)
+		}
+		if fd.Kind == types.FILE_RENAMED && !validPath(fd.OldPath) {
+			return fmt.Errorf("%w: invalid old path %q", ErrCorruptPatch, fd.OldPath)
+		}
+	}
+
+	if _, err := utils.RecoverTransactions(outDir); err != nil {
+		return err
+	}
+	txn := utils.NewTransaction(outDir)
+	defer txn.Rollback()
+
+	for _, fd := range diffs {
+		if fd.Kind == types.FILE_REMOVED {
+			continue
+		}
+
+		var oldData []byte
+		if fd.Kind != types.FILE_ADDED {
+			source := fd.Path
+			if fd.Kind == types.FILE_RENAMED {
+				source = fd.OldPath
+			}
+			var err error
+			if oldData, err = fs.ReadFile(oldFS, source); err != nil {
+				return fmt.Errorf("failed to read old file %s: %w", source, err)
+			}
+		}
+
+		newData := oldData
+		if fd.Kind != types.FILE_UNCHANGED {
+			var err error
+			if newData, err = Apply(oldData, fd.Patches, options); err != nil {
+				return fmt.Errorf("failed to apply patch to %s: %w", fd.Path, err)
+			}
+		}
+
+		target := filepath.Join(outDir, filepath.FromSlash(fd.Path))
+		if err := txn.Write(target, newData); err != nil {
+			return fmt.Errorf("failed to write %s: %w", target, err)
+		}
+	}
+	return txn.Commit()
+}
+
+// validPath 判断差分中的路径能否安全地写入输出目录：fs.ValidPath 接受的相对路径，
+// 且转换为本地路径后不越出目录（Windows 上 a\..\..\x 也是合法的 fs 路径）
+func validPath(p string) bool {
+	return fs.ValidPath(p) && p != "." && filepath.IsLocal(filepath.FromSlash(p))
+}
+
+// listFiles 列出文件系统中的常规文件路径
+func listFiles(fsys fs.FS) ([]string, error) {
+	var files []string
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// toSet 将路径列表转换为集合
+func toSet(paths []string) map[string]bool {
+	set := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		set[p] = true
+	}
+	return set
+}
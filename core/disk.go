@@ -0,0 +1,221 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// DefaultDiskBlockSize 分区内逐块比较的默认块大小（常见文件系统的块大小）
+const DefaultDiskBlockSize = 4096
+
+// ErrNotDiskImage 输入不是带有分区表的磁盘镜像
+var ErrNotDiskImage = errors.New("inputs are not partitioned disk images")
+
+// DiskLayout 磁盘镜像的分区布局
+type DiskLayout struct {
+	// Scheme 分区表类型："gpt" 或 "mbr"
+	Scheme     string
+	SectorSize int
+	Partitions []Partition
+}
+
+// Partition 一个分区在镜像中的位置
+type Partition struct {
+	// Name GPT 分区名，为空或重复时使用 "p<序号>"
+	Name   string
+	Offset int64
+	Size   int64
+}
+
+// ParseDiskImage 解析磁盘镜像的 GPT 或 MBR 分区表
+func ParseDiskImage(data []byte) (*DiskLayout, error) {
+	if len(data) < 512 || data[510] != 0x55 || data[511] != 0xAA {
+		return nil, ErrNotDiskImage
+	}
+	// 保护性 MBR 表示使用 GPT
+	if data[446+4] == 0xEE {
+		for _, sectorSize := range []int{512, 4096} {
+			if layout, err := parseGPT(data, sectorSize); err == nil {
+				return layout, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: protective MBR without a valid GPT header", ErrNotDiskImage)
+	}
+	return parseMBR(data)
+}
+
+// parseMBR 解析 MBR 主分区表，扩展分区作为一个整体
+func parseMBR(data []byte) (*DiskLayout, error) {
+	layout := &DiskLayout{Scheme: "mbr", SectorSize: 512}
+	for i := 0; i < 4; i++ {
+		entry := data[446+16*i : 446+16*(i+1)]
+		if entry[4] == 0 {
+			continue
+		}
+		start := int64(binary.LittleEndian.Uint32(entry[8:])) * 512
+		size := int64(binary.LittleEndian.Uint32(entry[12:])) * 512
+		layout.Partitions = append(layout.Partitions, Partition{
+			Name:   fmt.Sprintf("p%d", i+1),
+			Offset: start,
+			Size:   size,
+		})
+	}
+	if len(layout.Partitions) == 0 {
+		return nil, fmt.Errorf("%w: empty MBR partition table", ErrNotDiskImage)
+	}
+	return layout, nil
+}
+
+// parseGPT 以给定扇区大小解析 GPT 分区表
+func parseGPT(data []byte, sectorSize int) (*DiskLayout, error) {
+	if len(data) < 2*sectorSize {
+		return nil, ErrNotDiskImage
+	}
+	hdr := data[sectorSize:]
+	if !bytes.Equal(hdr[:8], []byte("EFI PART")) {
+		return nil, ErrNotDiskImage
+	}
+	entryLBA := binary.LittleEndian.Uint64(hdr[72:])
+	count := binary.LittleEndian.Uint32(hdr[80:])
+	entrySize := binary.LittleEndian.Uint32(hdr[84:])
+	if entrySize < 128 || count > 1024 || entryLBA > uint64(len(data)/sectorSize) {
+		return nil, fmt.Errorf("%w: bad GPT header", ErrNotDiskImage)
+	}
+	tableStart := entryLBA * uint64(sectorSize)
+	if tableStart+uint64(count)*uint64(entrySize) > uint64(len(data)) {
+		return nil, fmt.Errorf("%w: GPT partition table exceeds image", ErrNotDiskImage)
+	}
+
+	layout := &DiskLayout{Scheme: "gpt", SectorSize: sectorSize}
+	names := make(map[string]int)
+	for i := uint32(0); i < count; i++ {
+		entry := data[tableStart+uint64(i)*uint64(entrySize):][:entrySize]
+		if isZero(entry[:16]) {
+			continue
+		}
+		first := binary.LittleEndian.Uint64(entry[32:])
+		last := binary.LittleEndian.Uint64(entry[40:])
+		if last < first {
+			continue
+		}
+		units := make([]uint16, 36)
+		for k := range units {
+			units[k] = binary.LittleEndian.Uint16(entry[56+2*k:])
+		}
+		name := strings.TrimRight(string(utf16.Decode(units)), "\x00")
+		names[name]++
+		layout.Partitions = append(layout.Partitions, Partition{
+			Name:   name,
+			Offset: int64(first) * int64(sectorSize),
+			Size:   int64(last-first+1) * int64(sectorSize),
+		})
+	}
+	for i := range layout.Partitions {
+		if p := &layout.Partitions[i]; p.Name == "" || names[p.Name] > 1 {
+			p.Name = fmt.Sprintf("p%d", i+1)
+		}
+	}
+	if len(layout.Partitions) == 0 {
+		return nil, fmt.Errorf("%w: empty GPT partition table", ErrNotDiskImage)
+	}
+	return layout, nil
+}
+
+// DiffDiskImage 按分区比较两个磁盘镜像：分区按名称配对后各自以 blockSize 为单位逐块比较
+// （块边界相对分区起点，与文件系统块对齐），相同的块引用旧块，全零块不占用补丁数据。
+// 分区表、分区之间的空隙等其余区域按位置名称配对后同样逐块比较。
+// 某个分区大小变化不影响其后分区的对齐，blockSize 不大于 0 时使用 DefaultDiskBlockSize
+func DiffDiskImage(oldData, newData []byte, blockSize int, options *DiffOptions) (*ArchivePatch, error) {
+	options = normalizeDiffOptions(options)
+	if blockSize <= 0 {
+		blockSize = DefaultDiskBlockSize
+	}
+	oldLayout, err := ParseDiskImage(oldData)
+	if err != nil {
+		return nil, err
+	}
+	newLayout, err := ParseDiskImage(newData)
+	if err != nil {
+		return nil, err
+	}
+	if oldLayout.Scheme != newLayout.Scheme {
+		return nil, fmt.Errorf("%w: partition schemes differ (%s, %s)", ErrNotDiskImage, oldLayout.Scheme, newLayout.Scheme)
+	}
+
+	oldRegions := diskRegions(oldLayout, int64(len(oldData)))
+	byName := make(map[string]diskRegion, len(oldRegions))
+	for _, r := range oldRegions {
+		byName[r.name] = r
+	}
+
+	result := &ArchivePatch{}
+	var stats pageStats
+	for _, r := range diskRegions(newLayout, int64(len(newData))) {
+		// 没有对应旧区域的新分区仍按块处理，全零块不占用补丁数据
+		var old []byte
+		base, ok := byName[r.name]
+		if ok {
+			old = oldData[base.offset : base.offset+base.length]
+		}
+		s, err := diffPages(result, old, base.offset, newData[r.offset:r.offset+r.length], blockSize, nil, options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff region %s: %w", r.name, err)
+		}
+		stats.add(s)
+	}
+
+	options.Logger.Infof("Disk image diff (%s): %d partitions, %d moved, %d modified, %d zero, %d literal blocks",
+		newLayout.Scheme, len(newLayout.Partitions), stats.moved, stats.modified, stats.zero, stats.literal)
+	return result, nil
+}
+
+// diskRegion 磁盘镜像中的一个区域
+type diskRegion struct {
+	name   string
+	offset int64
+	length int64
+}
+
+// diskRegions 返回覆盖整个镜像的区域：分区按偏移排序（超出镜像的部分截断，重叠的分区跳过），
+// 分区之前、之间和之后的字节作为以前一个分区命名的区域
+func diskRegions(layout *DiskLayout, size int64) []diskRegion {
+	parts := append([]Partition(nil), layout.Partitions...)
+	sort.SliceStable(parts, func(i, j int) bool { return parts[i].Offset < parts[j].Offset })
+
+	var regions []diskRegion
+	add := func(name string, offset, length int64) {
+		if length > 0 {
+			regions = append(regions, diskRegion{name, offset, length})
+		}
+	}
+	var pos int64
+	gap := "<header>"
+	for _, p := range parts {
+		if p.Offset < pos || p.Offset >= size || p.Size <= 0 {
+			continue
+		}
+		length := p.Size
+		if length > size-p.Offset {
+			length = size - p.Offset
+		}
+		add(gap, pos, p.Offset-pos)
+		add(p.Name, p.Offset, length)
+		pos = p.Offset + length
+		gap = "<after " + p.Name + ">"
+	}
+	add(gap, pos, size-pos)
+	return regions
+}
+
+// add 累加统计
+func (s *pageStats) add(other pageStats) {
+	s.moved += other.moved
+	s.modified += other.modified
+	s.zero += other.zero
+	s.literal += other.literal
+}
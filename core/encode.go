@@ -0,0 +1,271 @@
+package core
+
+import (
+	"bindiff/types"
+	"encoding/binary"
+	"hash"
+	"io"
+	"sync"
+)
+
+const (
+	// writeBufferSize WritePatch/WriteDiffFile 攒够该大小后写出一次
+	writeBufferSize = 64 * 1024
+	// maxArenaSize Reset 时保留的 arena 缓冲区上限，超出的缓冲区交给 GC
+	maxArenaSize = 16 * 1024 * 1024
+)
+
+// writeBuffers WritePatch/WriteDiffFile 复用的编码缓冲区
+var writeBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, writeBufferSize)
+		return &buf
+	},
+}
+
+// EncodedPatchSize 返回 EncodePatch 编码结果的字节数，不进行编码
+func EncodedPatchSize(p []types.Patch) int64 {
+	return encodedSize(p)
+}
+
+// AppendPatch 把补丁的编码追加到 dst，调用方可复用 dst 避免每次分配
+func AppendPatch(dst []byte, p []types.Patch) []byte {
+	for _, entry := range p {
+		dst = appendPatchEntry(dst, entry)
+	}
+	return dst
+}
+
+// appendPatchEntry 追加单个补丁条目的编码，格式与 writePatch 相同
+func appendPatchEntry(dst []byte, entry types.Patch) []byte {
+	dst = appendPatchHeader(dst, entry)
+	if entry.Op == types.OP_INSERT || entry.Op == types.OP_REPLACE {
+		dst = append(dst, entry.Data...)
+	}
+	return dst
+}
+
+// appendPatchHeader 追加补丁条目头：操作、偏移量与长度
+func appendPatchHeader(dst []byte, entry types.Patch) []byte {
+	dst = append(dst, byte(entry.Op))
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(entry.Offset))
+	return binary.LittleEndian.AppendUint64(dst, uint64(entry.Length))
+}
+
+// diffFileHeaderSize 返回补丁文件头（含 DataLength）的字节数
+func diffFileHeaderSize(df *types.DiffFile) int {
+	size := 4 + 4 + 4 + len(df.FileName) + 4 + len(df.NewFileName) + 4 + 4 +
+		len(df.OldHash) + len(df.NewHash) + 4 + 4
+	if df.Version >= 2 {
+		size += 4
+	}
+	if df.Version >= 3 {
+		size += 4
+	}
+	if hasMerkle(df.Version) {
+		size += 4 + len(df.MerkleLeaves) + len(df.MerkleRoot)
+	}
+	return size
+}
+
+// appendDiffFileHeader 追加补丁文件头，dataLength 为随后的差分数据长度
+func appendDiffFileHeader(dst []byte, df *types.DiffFile, dataLength int64) []byte {
+	le := binary.LittleEndian
+	dst = le.AppendUint32(dst, df.MagicNumber)
+	dst = le.AppendUint32(dst, df.Version)
+	if df.Version >= 2 {
+		dst = le.AppendUint32(dst, uint32(df.HashAlgorithm))
+	}
+	if df.Version >= 3 {
+		dst = le.AppendUint32(dst, uint32(df.Format))
+	}
+	dst = le.AppendUint32(dst, df.OldFileNameLength)
+	dst = append(dst, df.FileName...)
+	dst = le.AppendUint32(dst, df.NewFileNameLength)
+	dst = append(dst, df.NewFileName...)
+	dst = le.AppendUint32(dst, df.OldSize)
+	dst = le.AppendUint32(dst, df.NewSize)
+	dst = append(dst, df.OldHash...)
+	dst = append(dst, df.NewHash...)
+	dst = le.AppendUint32(dst, uint32(df.Offset))
+	if hasMerkle(df.Version) {
+		dst = le.AppendUint32(dst, df.MerkleBlockSize)
+		dst = append(dst, df.MerkleLeaves...)
+		dst = append(dst, df.MerkleRoot...)
+	}
+	return le.AppendUint32(dst, uint32(dataLength))
+}
+
+// AppendDiffFile 把补丁文件的编码追加到 dst，结果与 EncodeDiffFile 相同
+func AppendDiffFile(dst []byte, df types.DiffFile) []byte {
+	start := len(dst)
+	if df.Format != types.FORMAT_RAW {
+		dst = appendDiffFileHeader(dst, &df, int64(len(df.Payload)))
+		dst = append(dst, df.Payload...)
+	} else {
+		dst = appendDiffFileHeader(dst, &df, encodedSize(df.Diff))
+		dst = AppendPatch(dst, df.Diff)
+	}
+	if hasChecksum(df.Version) {
+		dst = appendChecksum(dst, start)
+	}
+	return dst
+}
+
+// WritePatch 把补丁编码写入 w，使用池中的缓冲区，内存占用与补丁大小无关
+func WritePatch(w io.Writer, p []types.Patch) error {
+	bp := writeBuffers.Get().(*[]byte)
+	defer writeBuffers.Put(bp)
+	buf, err := writePatchEntries(w, (*bp)[:0], p)
+	if err == nil && len(buf) > 0 {
+		_, err = w.Write(buf)
+	}
+	*bp = buf[:0]
+	return err
+}
+
+// WriteDiffFile 把补丁文件编码写入 w，结果与 EncodeDiffFile 相同
+func WriteDiffFile(w io.Writer, df types.DiffFile) error {
+	bp := writeBuffers.Get().(*[]byte)
+	defer writeBuffers.Put(bp)
+	buf := *bp
+	defer func() { *bp = buf[:0] }()
+
+	// 带整体校验和的版本边写边计算，最后写出尾部
+	out := w
+	var sum hash.Hash32
+	if hasChecksum(df.Version) {
+		sum = newChecksum()
+		w = io.MultiWriter(out, sum)
+	}
+
+	var err error
+	if df.Format != types.FORMAT_RAW {
+		buf = appendDiffFileHeader(buf[:0], &df, int64(len(df.Payload)))
+		if _, err = w.Write(buf); err == nil {
+			_, err = w.Write(df.Payload)
+		}
+	} else {
+		buf = appendDiffFileHeader(buf[:0], &df, encodedSize(df.Diff))
+		if buf, err = writePatchEntries(w, buf, df.Diff); err == nil && len(buf) > 0 {
+			_, err = w.Write(buf)
+		}
+	}
+	if err != nil || sum == nil {
+		return err
+	}
+	_, err = out.Write(binary.LittleEndian.AppendUint32(nil, sum.Sum32()))
+	return err
+}
+
+// writePatchEntries 把条目编码到 buf，攒够 writeBufferSize 时写出；
+// 较大的条目数据直接写出而不复制。返回尚未写出的内容
+func writePatchEntries(w io.Writer, buf []byte, p []types.Patch) ([]byte, error) {
+	for _, entry := range p {
+		hasData := entry.Op == types.OP_INSERT || entry.Op == types.OP_REPLACE
+		if hasData && len(entry.Data) >= writeBufferSize {
+			buf = appendPatchHeader(buf, entry)
+			if _, err := w.Write(buf); err != nil {
+				return buf[:0], err
+			}
+			if _, err := w.Write(entry.Data); err != nil {
+				return buf[:0], err
+			}
+			buf = buf[:0]
+			continue
+		}
+		buf = appendPatchEntry(buf, entry)
+		if len(buf) >= writeBufferSize {
+			if _, err := w.Write(buf); err != nil {
+				return buf[:0], err
+			}
+			buf = buf[:0]
+		}
+	}
+	return buf, nil
+}
+
+// PatchArena 解码补丁时复用的内存：条目与数据存放在连续的缓冲区中，
+// 适合反复解码补丁的服务，每次解码的分配次数与条目数无关。
+// 再次解码或 Reset 之后，之前解码出的补丁不再有效。不能并发使用
+type PatchArena struct {
+	patches []types.Patch
+	data    []byte
+}
+
+// DecodePatch 解码补丁，结果在 arena 下次使用前有效
+func (a *PatchArena) DecodePatch(b []byte) ([]types.Patch, error) {
+	var err error
+	a.patches, a.data, err = decodePatchInto(b, a.patches[:0], a.data[:0])
+	return a.patches, err
+}
+
+// DecodeDiffFile 解码补丁文件，df.Diff 在 arena 下次使用前有效（df.Payload 不使用 arena）
+func (a *PatchArena) DecodeDiffFile(data []byte) (types.DiffFile, error) {
+	return decodeDiffFile(data, a)
+}
+
+// Reset 释放过大的缓冲区，保留其余缓冲区供下次解码
+func (a *PatchArena) Reset() {
+	if cap(a.data) > maxArenaSize {
+		a.data = nil
+	}
+	if cap(a.patches)*patchHeaderSize > maxArenaSize {
+		a.patches = nil
+	}
+	clear(a.patches[:cap(a.patches)])
+	a.patches, a.data = a.patches[:0], a.data[:0]
+}
+
+// decodePatchInto 解码补丁，条目追加到 patches，条目数据复制到 data 中连续存放。
+// 先扫描一遍条目头确定条目数与数据总长，每次解码最多分配两次。
+// 输入损坏时返回损坏之前的条目与 ErrCorruptPatch
+func decodePatchInto(b []byte, patches []types.Patch, data []byte) ([]types.Patch, []byte, error) {
+	count, dataSize, scanErr := scanPatch(b)
+	if need := len(patches) + count; cap(patches) < need {
+		patches = append(make([]types.Patch, 0, need), patches...)
+	}
+	if cap(data)-len(data) < dataSize {
+		data = make([]byte, 0, dataSize)
+	}
+
+	le := binary.LittleEndian
+	pos := 0
+	for i := 0; i < count; i++ {
+		entry := types.Patch{
+			Op:     types.Operator(b[pos]),
+			Offset: int64(le.Uint64(b[pos+1:])),
+			Length: int64(le.Uint64(b[pos+9:])),
+		}
+		pos += patchHeaderSize
+		if entry.Op == types.OP_INSERT || entry.Op == types.OP_REPLACE {
+			start := len(data)
+			data = append(data, b[pos:pos+int(entry.Length)]...)
+			// 限制容量，调用方追加 Data 时不会覆盖后面条目的数据
+			entry.Data = data[start:len(data):len(data)]
+			pos += int(entry.Length)
+		}
+		patches = append(patches, entry)
+	}
+	return patches, data, scanErr
+}
+
+// scanPatch 扫描条目头，返回完整条目的数量、数据总长度，以及遇到的损坏
+func scanPatch(b []byte) (count, dataSize int, err error) {
+	for pos := 0; pos < len(b); count++ {
+		if len(b)-pos < patchHeaderSize {
+			return count, dataSize, truncatedError(io.ErrUnexpectedEOF, "entry header")
+		}
+		op := types.Operator(b[pos])
+		length := binary.LittleEndian.Uint64(b[pos+9:])
+		pos += patchHeaderSize
+		if op == types.OP_INSERT || op == types.OP_REPLACE {
+			if length > uint64(len(b)-pos) {
+				return count, dataSize, truncatedError(io.ErrUnexpectedEOF, "entry data")
+			}
+			pos += int(length)
+			dataSize += int(length)
+		}
+	}
+	return count, dataSize, nil
+}
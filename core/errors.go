@@ -0,0 +1,132 @@
+package core
+
+import (
+	"bindiff/types"
+	"errors"
+	"fmt"
+)
+
+// 可通过 errors.Is 判断的错误类别
+var (
+	// ErrHashMismatch 数据哈希与补丁中记录的不一致
+	ErrHashMismatch = errors.New("hash mismatch")
+	// ErrCorruptPatch 补丁数据损坏：头或条目截断、魔数错误、条目无法应用（*PatchError）、
+	// 输出长度与新文件大小不一致（*SizeError）、整体校验和不一致（*ChecksumError）
+	ErrCorruptPatch = errors.New("corrupt patch")
+	// ErrUnsupportedVersion 补丁文件版本高于当前支持的版本
+	ErrUnsupportedVersion = errors.New("unsupported patch version")
+	// ErrUnsupportedHash 补丁使用了未知的哈希算法
+	ErrUnsupportedHash = errors.New("unsupported hash algorithm")
+	// ErrPatchTooLarge 数据超出补丁格式的大小限制
+	ErrPatchTooLarge = errors.New("patch too large")
+	// ErrNotStreamable 补丁负载格式不支持流式应用（只有 FORMAT_RAW 支持）
+	ErrNotStreamable = errors.New("patch format cannot be applied as a stream")
+	// ErrCancelled 操作被取消或超时，同时满足 errors.Is(err, ctx.Err())
+	ErrCancelled = errors.New("operation cancelled")
+	// ErrPatchChecksum 补丁文件的整体校验和不一致（*ChecksumError），通常是传输中损坏
+	ErrPatchChecksum = errors.New("patch checksum mismatch")
+	// ErrLimitExceeded 补丁超出配置的资源上限（limits.*，见 *LimitError）
+	ErrLimitExceeded = errors.New("resource limit exceeded")
+	// ErrBackendUnavailable 配置的互相关后端没有编译进当前程序
+	ErrBackendUnavailable = errors.New("correlation backend unavailable")
+)
+
+// PatchError 补丁条目无法应用时返回的错误，指明出错的条目
+type PatchError struct {
+	Index  int
+	Patch  types.Patch
+	Reason string
+}
+
+// Error 实现 error 接口
+func (e *PatchError) Error() string {
+	return fmt.Sprintf("patch entry %d (op=%d offset=%d length=%d): %s",
+		e.Index, e.Patch.Op, e.Patch.Offset, e.Patch.Length, e.Reason)
+}
+
+// Is 使 errors.Is(err, ErrCorruptPatch) 对条目错误成立
+func (e *PatchError) Is(target error) bool {
+	return target == ErrCorruptPatch
+}
+
+// SizeError 补丁输出的总长度与记录的新文件大小不一致
+type SizeError struct {
+	Actual   int64
+	Expected int64
+}
+
+// Error 实现 error 接口
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("patch produces %d bytes, expected new size %d", e.Actual, e.Expected)
+}
+
+// Is 使 errors.Is(err, ErrCorruptPatch) 对大小错误成立
+func (e *SizeError) Is(target error) bool {
+	return target == ErrCorruptPatch
+}
+
+// ChecksumError 补丁文件尾部记录的校验和与文件内容不一致
+type ChecksumError struct {
+	Stored uint32
+	Actual uint32
+}
+
+// Error 实现 error 接口
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%v: footer records crc32c %08x, file content has %08x; the patch file was corrupted or truncated in transfer",
+		ErrPatchChecksum, e.Stored, e.Actual)
+}
+
+// Is 使 errors.Is(err, ErrPatchChecksum) 与 errors.Is(err, ErrCorruptPatch) 成立
+func (e *ChecksumError) Is(target error) bool {
+	return target == ErrPatchChecksum || target == ErrCorruptPatch
+}
+
+// LimitError 补丁超出配置的资源上限时返回的错误
+type LimitError struct {
+	// Limit 配置项的键，如 limits.max_ops
+	Limit string
+	// What 超出上限的量，如 operation count
+	What  string
+	Value int64
+	Max   int64
+}
+
+// Error 实现 error 接口
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v: %s %d exceeds %s (%d)", ErrLimitExceeded, e.What, e.Value, e.Limit, e.Max)
+}
+
+// Is 使 errors.Is(err, ErrLimitExceeded) 成立
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// cancelledError 上下文取消错误，同时匹配 ErrCancelled 与原始的 context 错误
+type cancelledError struct {
+	cause error
+}
+
+// Error 实现 error 接口
+func (e *cancelledError) Error() string {
+	return e.cause.Error()
+}
+
+// Unwrap 返回 context.Canceled 或 context.DeadlineExceeded
+func (e *cancelledError) Unwrap() error {
+	return e.cause
+}
+
+// Is 使 errors.Is(err, ErrCancelled) 成立
+func (e *cancelledError) Is(target error) bool {
+	return target == ErrCancelled
+}
+
+// newPatchError 创建补丁条目错误
+func newPatchError(index int, patch types.Patch, format string, args ...interface{}) *PatchError {
+	return &PatchError{
+		Index:  index,
+		Patch:  patch,
+		Reason: fmt.Sprintf(format, args...),
+	}
+}
@@ -0,0 +1,117 @@
+package core
+
+import (
+	"bindiff/pkg/config"
+	"bindiff/types"
+)
+
+const (
+	// estimateSamples 抽样估算时的采样窗口数
+	estimateSamples = 64
+	// estimateWindow 每个采样窗口的大小
+	estimateWindow = 4096
+)
+
+// EstimatePatchSize 通过抽样比较快速估算编码后补丁大小（字节），
+// 数据较小时直接计算精确值。部署工具可据此在增量与全量下载之间选择
+func EstimatePatchSize(oldData, newData []byte, options *DiffOptions) (int64, error) {
+	options = normalizeDiffOptions(options)
+
+	minLen := len(oldData)
+	if len(newData) < minLen {
+		minLen = len(newData)
+	}
+
+	if minLen <= estimateSamples*estimateWindow {
+		patches, err := diffRange(options.Context, oldData, newData, 0, minLen, nil)
+		if err != nil {
+			return 0, err
+		}
+		patches = appendTailPatch(patches, oldData, newData, minLen)
+		return encodedSize(patches), nil
+	}
+
+	// 均匀抽取窗口，按抽样比例外推条目数与差异数据量
+	stride := (minLen - estimateWindow) / (estimateSamples - 1)
+	var sampled, entries, dataBytes int64
+	for i := 0; i < estimateSamples; i++ {
+		from := i * stride
+		patches, err := diffRange(options.Context, oldData, newData, from, from+estimateWindow, nil)
+		if err != nil {
+			return 0, err
+		}
+		for _, p := range patches {
+			if p.Op == types.OP_REPLACE {
+				entries++
+				dataBytes += p.Length
+			}
+		}
+		sampled += estimateWindow
+	}
+
+	scale := float64(minLen) / float64(sampled)
+	replaceEntries := int64(float64(entries) * scale)
+	// 每段差异前后各有一段 COPY
+	size := int64(float64(dataBytes)*scale) + (2*replaceEntries+1)*patchHeaderSize
+
+	// 尾部 INSERT/DELETE 可精确计算
+	if len(newData) > minLen {
+		size += patchHeaderSize + int64(len(newData)-minLen)
+	} else if len(oldData) > minLen {
+		size += patchHeaderSize
+	}
+	return size, nil
+}
+
+// EstimateMemory 估算对给定大小的数据执行差分时的峰值内存（字节）：
+// 输入数据、启用对齐时的 FFT 缓冲区或指纹、块索引与匹配记录，以及一份编码结果
+// （按补丁不超过新数据大小估算）。补丁条目引用新数据，不计入
+func EstimateMemory(oldLen, newLen int64, options *DiffOptions) int64 {
+	options = normalizeDiffOptions(options)
+
+	total := oldLen + newLen
+
+	if options.Config.EnableFFT && options.Config.AlignStrategy == config.AlignStrategyWinnow {
+		// 两份数据的指纹与索引，每个指纹约 64 字节
+		window := int64(winnowWindow(int(max(oldLen, newLen))))
+		total += (oldLen + newLen) * 2 / (window + 1) * 64
+	} else if options.Config.EnableFFT && oldLen > 0 && newLen > 0 {
+		n := int64(NextPowerOfTwo(int(oldLen + newLen - 1)))
+		single := options.Config.FFTPrecision == config.FFTPrecisionFloat32
+		samples, size := sampledParams(options.Config.AlignSamples, options.Config.AlignSampleSize)
+		if options.Config.AlignStrategy == config.AlignStrategySampled && oldLen > int64(samples*size) {
+			// 抽样对齐逐个窗口做相关，每次的 FFT 点数只与窗口大小有关，使用双精度
+			n, single = int64(NextPowerOfTwo((2*sampledSearchFactor+2)*size-1)), false
+		} else if n > maxDirectFFTSize {
+			// 分层对齐的两个阶段都不超过 coarseFFTSize 点，使用双精度
+			n, single = coarseFFTSize, false
+		}
+		if single {
+			// 实数输入（float32）+ 2 个半频谱（complex64）
+			// + n/2 点的单位根表与拆分旋转因子（各 n/4 个 complex64）、位反转表（int32）
+			total += n*4 + n*8 + n/4*(8+8) + n/2*4
+		} else {
+			// 实数输入（float64）+ 2 个半频谱（n/2 个 complex128）
+			// + n/2 点的单位根表、拆分旋转因子（complex128）与位反转表（int）
+			total += n*8 + n*16 + n/2*(16+16+8)
+		}
+	}
+
+	// 块大小按内存预算确定
+	total += planDiff(int(oldLen), int(newLen), options.Config).indexMemory
+
+	total += newLen
+	return total
+}
+
+// encodedSize 计算补丁编码后的字节数
+func encodedSize(patches []types.Patch) int64 {
+	var size int64
+	for _, p := range patches {
+		size += patchHeaderSize
+		if p.Op == types.OP_INSERT || p.Op == types.OP_REPLACE {
+			size += int64(len(p.Data))
+		}
+	}
+	return size
+}
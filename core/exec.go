@@ -0,0 +1,417 @@
+package core
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ExecFormat 可执行文件格式
+type ExecFormat uint8
+
+// 支持按节差分的可执行文件格式
+const (
+	ExecNone ExecFormat = iota
+	ExecELF
+	ExecPE
+	ExecMachO
+)
+
+// String 返回格式名称
+func (f ExecFormat) String() string {
+	switch f {
+	case ExecELF:
+		return "elf"
+	case ExecPE:
+		return "pe"
+	case ExecMachO:
+		return "macho"
+	default:
+		return "none"
+	}
+}
+
+// ErrNotExecutable 输入不是同一格式的可解析可执行文件
+var ErrNotExecutable = errors.New("inputs are not executables of the same supported format")
+
+// ExecPatch 按节差分的可执行文件补丁：Sections 为新旧文件的结构映射，
+// Patch 的片段按新文件字节顺序以对应旧区域为基还原新文件。
+// Pointers 不为 nil 时 Patch 还原的是分支目标归一化后的新文件，应用后再按映射还原
+type ExecPatch struct {
+	Format   ExecFormat
+	Sections []SectionMap
+	Patch    *ArchivePatch
+	Pointers *PointerMap
+}
+
+// SectionMap 一个区域（节或节之间的头部、填充）在新旧文件中的位置，
+// 新文件中不存在对应旧区域时 OldSize 为 0
+type SectionMap struct {
+	Name      string
+	OldOffset int64
+	OldSize   int64
+	NewOffset int64
+	NewSize   int64
+}
+
+// DetectExecutable 根据文件头识别可执行文件格式
+func DetectExecutable(data []byte) ExecFormat {
+	switch {
+	case len(data) >= 4 && bytes.Equal(data[:4], []byte(elf.ELFMAG)):
+		return ExecELF
+	case len(data) >= 64 && data[0] == 'M' && data[1] == 'Z':
+		return ExecPE
+	case len(data) >= 4:
+		switch binary.LittleEndian.Uint32(data) {
+		case macho.Magic32, macho.Magic64:
+			return ExecMachO
+		}
+		switch binary.BigEndian.Uint32(data) {
+		case macho.Magic32, macho.Magic64:
+			return ExecMachO
+		}
+	}
+	return ExecNone
+}
+
+// DiffExecutable 解析两个可执行文件的节表，按节名称配对后逐节差分，
+// 节之间的头部与填充以旧文件中位于同一节之后的区域为基差分。
+// .text 的修改不会影响其他节，节整体移动也不会产生大量替换操作。
+// x86 与 ARM 代码中的相对分支先归一化到旧文件的地址空间，插入函数导致的调用目标变化不进入补丁
+func DiffExecutable(oldData, newData []byte, options *DiffOptions) (*ExecPatch, error) {
+	options = normalizeDiffOptions(options)
+	format := DetectExecutable(oldData)
+	if format == ExecNone || DetectExecutable(newData) != format {
+		return nil, ErrNotExecutable
+	}
+	oldRegions, err := execRegions(format, oldData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: old file: %v", ErrNotExecutable, err)
+	}
+	newRegions, err := execRegions(format, newData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: new file: %v", ErrNotExecutable, err)
+	}
+
+	byName := make(map[string]archiveEntry, len(oldRegions))
+	for _, r := range oldRegions {
+		byName[r.name] = r
+	}
+	sectionOptions := &DiffOptions{Config: options.Config, Context: options.Context}
+
+	result := &ExecPatch{Format: format, Patch: &ArchivePatch{}}
+	normalized, err := normalizePointers(options.Context, format, oldData, newData)
+	if err != nil {
+		return nil, err
+	}
+	if normalized != nil {
+		options.Logger.Debugf("Normalized %s branches with %d equivalences",
+			normalized.pointers.Arch, len(normalized.pointers.Equivalences))
+		result.Pointers = normalized.pointers
+		newData = normalized.data
+	}
+	matched := 0
+	for _, r := range newRegions {
+		if err := checkContext(options.Context); err != nil {
+			return nil, err
+		}
+		m := SectionMap{Name: r.name, NewOffset: r.offset, NewSize: r.length}
+		region := newData[r.offset : r.offset+r.length]
+
+		base, ok := byName[r.name]
+		if !ok || base.length == 0 {
+			result.Patch.addLiteral(region)
+			result.Sections = append(result.Sections, m)
+			continue
+		}
+		// 归一化后的代码节按相同区间逐段差分，插入的代码不会使后续代码错位
+		if cm, ok := normalized.codeMatches(r); ok {
+			var pos int64
+			for _, c := range cm.ranges {
+				result.Patch.addLiteral(region[pos:c.newPos])
+				if err := result.Patch.addDiff(oldData, cm.oldOffset+c.oldPos, c.length, region[c.newPos:c.newPos+c.length], sectionOptions); err != nil {
+					return nil, fmt.Errorf("failed to diff section %s: %w", r.name, err)
+				}
+				pos = c.newPos + c.length
+			}
+			result.Patch.addLiteral(region[pos:])
+		} else if err := result.Patch.addDiff(oldData, base.offset, base.length, region, sectionOptions); err != nil {
+			return nil, fmt.Errorf("failed to diff section %s: %w", r.name, err)
+		}
+		m.OldOffset, m.OldSize = base.offset, base.length
+		result.Sections = append(result.Sections, m)
+		matched++
+	}
+
+	options.Logger.Infof("Executable diff (%s): %d regions, %d matched", format, len(newRegions), matched)
+	return result, nil
+}
+
+// codeMatches 返回与区域 r 完全重合的代码节的相同区间
+func (n *normalizedExec) codeMatches(r archiveEntry) (codeMatches, bool) {
+	if n == nil {
+		return codeMatches{}, false
+	}
+	cm, ok := n.matches[r.offset]
+	return cm, ok && cm.size == r.length
+}
+
+// addDiff 以旧数据 oldData[offset:offset+length] 为基差分 region
+func (p *ArchivePatch) addDiff(oldData []byte, offset, length int64, region []byte, options *DiffOptions) error {
+	patches, err := DiffBytes(oldData[offset:offset+length], region, options)
+	if err != nil {
+		return err
+	}
+	if len(patches) == 0 {
+		p.addCopy(offset, length)
+		return nil
+	}
+	p.Segments = append(p.Segments, ArchiveSegment{BaseOffset: offset, BaseLength: length, Patches: patches})
+	return nil
+}
+
+// ApplyExecutable 将按节差分的补丁应用到旧文件
+func ApplyExecutable(oldData []byte, patch *ExecPatch, options *ApplyOptions) ([]byte, error) {
+	newData, err := ApplyArchive(oldData, patch.Patch, options)
+	if err != nil || patch.Pointers == nil {
+		return newData, err
+	}
+	if err := patch.Pointers.Restore(newData); err != nil {
+		return nil, err
+	}
+	return newData, nil
+}
+
+// ValidateExecPatch 检查结构映射与片段是否一致
+func ValidateExecPatch(patch *ExecPatch, oldSize, newSize int64) error {
+	var pos int64
+	for _, s := range patch.Sections {
+		if s.NewOffset != pos || s.NewSize < 0 || s.OldSize < 0 ||
+			s.OldOffset < 0 || s.OldOffset > oldSize || s.OldSize > oldSize-s.OldOffset {
+			return fmt.Errorf("%w: invalid section map entry %q", ErrCorruptPatch, s.Name)
+		}
+		pos += s.NewSize
+	}
+	if pos != newSize {
+		return fmt.Errorf("%w: section map covers %d bytes, expected %d", ErrCorruptPatch, pos, newSize)
+	}
+	if patch.Pointers != nil {
+		if err := patch.Pointers.validate(newSize); err != nil {
+			return err
+		}
+		if _, err := newAddrMap(patch.Pointers.Arch, patch.Pointers.Equivalences); err != nil {
+			return err
+		}
+	}
+	return ValidateArchivePatch(patch.Patch, oldSize, newSize)
+}
+
+// execRegions 返回覆盖整个文件的区域列表：有文件内容的节按偏移排序，
+// 节之前、之间和之后的字节分别作为以前一节命名的区域
+func execRegions(format ExecFormat, data []byte) ([]archiveEntry, error) {
+	sections, err := execSections(format, data)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(sections, func(i, j int) bool { return sections[i].offset < sections[j].offset })
+
+	var regions []archiveEntry
+	seen := make(map[string]int)
+	add := func(name string, offset, length int64) {
+		if length <= 0 {
+			return
+		}
+		// 同名节（如多个 __text）按出现顺序编号
+		if n := seen[name]; n > 0 {
+			seen[name]++
+			name = fmt.Sprintf("%s#%d", name, n)
+		} else {
+			seen[name] = 1
+		}
+		regions = append(regions, archiveEntry{name: name, offset: offset, length: length})
+	}
+
+	var pos int64
+	gap := "<header>"
+	for _, s := range sections {
+		// 重叠的节只保留第一个
+		if s.offset < pos || s.offset+s.length > int64(len(data)) {
+			continue
+		}
+		add(gap, pos, s.offset-pos)
+		add(s.name, s.offset, s.length)
+		pos = s.offset + s.length
+		gap = "<after " + s.name + ">"
+	}
+	add(gap, pos, int64(len(data))-pos)
+	return regions, nil
+}
+
+// execSections 解析节表，返回在文件中有内容的节
+func execSections(format ExecFormat, data []byte) ([]archiveEntry, error) {
+	var sections []archiveEntry
+	add := func(name string, offset, size uint64) {
+		if size > 0 && offset <= uint64(len(data)) && size <= uint64(len(data))-offset {
+			sections = append(sections, archiveEntry{name: name, offset: int64(offset), length: int64(size)})
+		}
+	}
+
+	r := bytes.NewReader(data)
+	switch format {
+	case ExecELF:
+		f, err := elf.NewFile(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range f.Sections {
+			if s.Type != elf.SHT_NOBITS && s.Type != elf.SHT_NULL {
+				add(s.Name, s.Offset, s.FileSize)
+			}
+		}
+	case ExecPE:
+		f, err := pe.NewFile(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range f.Sections {
+			add(s.Name, uint64(s.Offset), uint64(s.Size))
+		}
+	case ExecMachO:
+		f, err := macho.NewFile(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range f.Sections {
+			// 零填充节在文件中没有内容
+			switch s.Flags & 0xff {
+			case 0x1, 0xc, 0x12:
+				continue
+			}
+			add(s.Seg+","+s.Name, uint64(s.Offset), s.Size)
+		}
+	}
+	if len(sections) == 0 {
+		return nil, errors.New("no sections with file content")
+	}
+	return sections, nil
+}
+
+// execPointersFlag 格式字节的最高位，表示映射条目之后有分支目标映射
+const execPointersFlag = 0x80
+
+// EncodeExecPatch 编码按节差分的补丁：格式(1) + 映射条目数(4)，
+// 每个条目为 名称长度(2) + 名称 + 旧偏移/旧大小/新偏移/新大小(各 8)；
+// 有分支目标映射时格式字节置最高位，随后为 指令集(1) + 代码区数(4) + 代码区(各 24) + 等价区间数(4) + 等价区间(各 24)，
+// 最后为归档补丁编码的片段
+func EncodeExecPatch(p *ExecPatch) []byte {
+	buf := new(bytes.Buffer)
+	format := byte(p.Format)
+	if p.Pointers != nil {
+		format |= execPointersFlag
+	}
+	buf.WriteByte(format)
+	binary.Write(buf, binary.LittleEndian, uint32(len(p.Sections)))
+	for _, s := range p.Sections {
+		binary.Write(buf, binary.LittleEndian, uint16(len(s.Name)))
+		buf.WriteString(s.Name)
+		binary.Write(buf, binary.LittleEndian, []int64{s.OldOffset, s.OldSize, s.NewOffset, s.NewSize})
+	}
+	if pm := p.Pointers; pm != nil {
+		buf.WriteByte(byte(pm.Arch))
+		binary.Write(buf, binary.LittleEndian, uint32(len(pm.Code)))
+		for _, c := range pm.Code {
+			binary.Write(buf, binary.LittleEndian, []uint64{uint64(c.Offset), uint64(c.Size), c.Addr})
+		}
+		binary.Write(buf, binary.LittleEndian, uint32(len(pm.Equivalences)))
+		for _, e := range pm.Equivalences {
+			binary.Write(buf, binary.LittleEndian, []uint64{e.Old, e.New, e.Length})
+		}
+	}
+	buf.Write(EncodeArchivePatch(p.Patch))
+	return buf.Bytes()
+}
+
+// DecodeExecPatch 解码按节差分的补丁
+func DecodeExecPatch(data []byte) (*ExecPatch, error) {
+	r := bytes.NewReader(data)
+	hr := &headerReader{r: r}
+	var format uint8
+	var count uint32
+	hr.read(&format)
+	hr.read(&count)
+	// 每个映射条目至少 34 字节，防止伪造的数量导致过度分配
+	if hr.err == nil && int64(count)*34 > int64(r.Len()) {
+		return nil, fmt.Errorf("%w: section count %d exceeds payload", ErrCorruptPatch, count)
+	}
+	hasPointers := format&execPointersFlag != 0
+	format &^= execPointersFlag
+	if hr.err == nil && (format == uint8(ExecNone) || format > uint8(ExecMachO)) {
+		return nil, fmt.Errorf("%w: unknown executable format %d", ErrCorruptPatch, format)
+	}
+
+	p := &ExecPatch{Format: ExecFormat(format), Sections: make([]SectionMap, 0, count)}
+	for i := uint32(0); i < count && hr.err == nil; i++ {
+		var nameLen uint16
+		hr.read(&nameLen)
+		s := SectionMap{Name: string(hr.bytes(int64(nameLen)))}
+		hr.read(&s.OldOffset)
+		hr.read(&s.OldSize)
+		hr.read(&s.NewOffset)
+		hr.read(&s.NewSize)
+		p.Sections = append(p.Sections, s)
+	}
+	if hasPointers && hr.err == nil {
+		pm, err := decodePointerMap(r, hr)
+		if err != nil {
+			return nil, err
+		}
+		p.Pointers = pm
+	}
+	if hr.err != nil {
+		return nil, fmt.Errorf("%w: truncated executable patch: %v", ErrCorruptPatch, hr.err)
+	}
+
+	patch, err := DecodeArchivePatch(hr.bytes(int64(r.Len())))
+	if err != nil {
+		return nil, err
+	}
+	p.Patch = patch
+	return p, nil
+}
+
+// decodePointerMap 解码分支目标映射
+func decodePointerMap(r *bytes.Reader, hr *headerReader) (*PointerMap, error) {
+	var arch uint8
+	var count uint32
+	hr.read(&arch)
+	hr.read(&count)
+	if hr.err == nil && int64(count)*24 > int64(r.Len()) {
+		return nil, fmt.Errorf("%w: code region count %d exceeds payload", ErrCorruptPatch, count)
+	}
+	pm := &PointerMap{Arch: PointerArch(arch), Code: make([]CodeRegion, 0, count)}
+	for i := uint32(0); i < count && hr.err == nil; i++ {
+		var c CodeRegion
+		hr.read(&c.Offset)
+		hr.read(&c.Size)
+		hr.read(&c.Addr)
+		pm.Code = append(pm.Code, c)
+	}
+	hr.read(&count)
+	if hr.err == nil && int64(count)*24 > int64(r.Len()) {
+		return nil, fmt.Errorf("%w: equivalence count %d exceeds payload", ErrCorruptPatch, count)
+	}
+	pm.Equivalences = make([]Equivalence, 0, count)
+	for i := uint32(0); i < count && hr.err == nil; i++ {
+		var e Equivalence
+		hr.read(&e.Old)
+		hr.read(&e.New)
+		hr.read(&e.Length)
+		pm.Equivalences = append(pm.Equivalences, e)
+	}
+	return pm, nil
+}
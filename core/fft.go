@@ -20,6 +20,8 @@ type FFTOptions struct {
 	EnableCache bool
 	Parallel    bool
 	Threshold   int // 并行阈值
+	// Logger 日志输出，nil 时不输出日志
+	Logger logger.Logger
 }
 
 // DefaultFFTOptions 默认 FFT 配置
@@ -38,8 +40,8 @@ func NewFFT(n int) *FFT {
 
 // NewFFTWithOptions 使用选项创建 FFT 实例
 func NewFFTWithOptions(n int, options *FFTOptions) *FFT {
-	if n <= 0 || (n&(n-1)) != 0 {
-		logger.Warnf("FFT size %d is not a power of 2, performance may be suboptimal", n)
+	if (n <= 0 || (n&(n-1)) != 0) && options != nil && options.Logger != nil {
+		options.Logger.Warnf("FFT size %d is not a power of 2, performance may be suboptimal", n)
 	}
 
 	fft := &FFT{
@@ -78,12 +80,26 @@ func (fft *FFT) Transform(input, output []complex128, inverse bool) {
 
 // iterativeFFT 迭代式 FFT 实现
 func (fft *FFT) iterativeFFT(input, output []complex128, inverse bool) {
-	n := fft.n
-
 	// 位反转重排
-	for i := 0; i < n; i++ {
+	for i := 0; i < fft.n; i++ {
 		output[i] = input[fft.bitReverse[i]]
 	}
+	fft.butterflies(output, inverse)
+}
+
+// transformInPlace 原地 FFT 变换，data 长度必须为 n
+func (fft *FFT) transformInPlace(data []complex128, inverse bool) {
+	for i, j := range fft.bitReverse {
+		if i < j {
+			data[i], data[j] = data[j], data[i]
+		}
+	}
+	fft.butterflies(data, inverse)
+}
+
+// butterflies 对已按位反转重排的数据逐级计算蝶形运算，逆变换时除以 n
+func (fft *FFT) butterflies(output []complex128, inverse bool) {
+	n := fft.n
 
 	// 迭代计算
 	for length := 2; length <= n; length <<= 1 {
@@ -230,8 +246,8 @@ func ConvolutionFFT(a, b []complex128) []complex128 {
 	copy(paddedA, a)
 	copy(paddedB, b)
 
-	// 创建 FFT 实例
-	fft := NewFFT(n)
+	// 获取缓存的 FFT 计划
+	fft := fftPlan(n)
 
 	// 正向 FFT
 	fftA := make([]complex128, n)
@@ -253,33 +269,127 @@ func ConvolutionFFT(a, b []complex128) []complex128 {
 	return result[:lenA+lenB-1]
 }
 
-// RealFFT 实数 FFT（更高效）
+// RealFFT 实数 FFT：把 n 个实数打包为 n/2 个复数做半长度的复数 FFT，再拆分出频谱，
+// 计算量与内存约为同长度复数 FFT 的一半。n 为 2 的幂。
+// Forward/Inverse 只读取预计算的数据，可并发使用；Transform 使用内部缓冲区，不能并发使用
 type RealFFT struct {
-	n    int
-	fft  *FFT
-	temp []complex128
+	n     int
+	fft   *FFT         // n/2 点复数 FFT
+	twist []complex128 // 拆分频谱的旋转因子 e^{2πik/n}，k < n/2
+	temp  []complex128
 }
 
 // NewRealFFT 创建实数 FFT
 func NewRealFFT(n int) *RealFFT {
-	return &RealFFT{
-		n:    n,
-		fft:  NewFFT(n),
-		temp: make([]complex128, n),
+	return newRealFFT(n, NewFFT)
+}
+
+// newRealFFT 创建实数 FFT，内部的 n/2 点复数 FFT 由 newFFT 提供
+func newRealFFT(n int, newFFT func(int) *FFT) *RealFFT {
+	rfft := &RealFFT{n: n}
+	if n < 2 {
+		return rfft
+	}
+	m := n / 2
+	rfft.fft = newFFT(m)
+	rfft.twist = make([]complex128, m)
+	angle := 2 * math.Pi / float64(n)
+	for k := range rfft.twist {
+		rfft.twist[k] = cmplx.Rect(1, float64(k)*angle)
+	}
+	return rfft
+}
+
+// SpectrumLen 返回 Forward 输出的半频谱长度 n/2+1，其余频率与之共轭对称
+func (rfft *RealFFT) SpectrumLen() int {
+	return rfft.n/2 + 1
+}
+
+// Forward 实数正向变换，output 为长度 SpectrumLen 的半频谱
+func (rfft *RealFFT) Forward(input []float64, output []complex128) {
+	if len(input) != rfft.n || len(output) != rfft.SpectrumLen() {
+		panic(fmt.Sprintf("input/output length (%d, %d) must match RealFFT size (%d, %d)",
+			len(input), len(output), rfft.n, rfft.SpectrumLen()))
+	}
+	if rfft.n < 2 {
+		output[0] = complex(input[0], 0)
+		return
+	}
+	m := rfft.n / 2
+
+	// 偶数位置作实部、奇数位置作虚部，原地做 n/2 点变换
+	for j := 0; j < m; j++ {
+		output[j] = complex(input[2*j], input[2*j+1])
+	}
+	rfft.fft.transformInPlace(output[:m], false)
+
+	// 由 Z[k] 与 Z[m-k] 拆分出偶、奇位置的频谱 E、O，X[k] = E[k] + w^k·O[k]，
+	// X[m-k] = conj(E[k] - w^k·O[k])
+	z0 := output[0]
+	output[0] = complex(real(z0)+imag(z0), 0)
+	output[m] = complex(real(z0)-imag(z0), 0)
+	for k := 1; k <= m/2; k++ {
+		a, b := output[k], cmplx.Conj(output[m-k])
+		even := (a + b) / 2
+		odd := (a - b) * complex(0, -0.5) * rfft.twist[k]
+		output[k] = even + odd
+		output[m-k] = cmplx.Conj(even - odd)
 	}
 }
 
-// Transform 实数变换
+// Inverse 实数逆向变换：input 为长度 SpectrumLen 的半频谱（会被覆盖），output 为 n 个实数
+func (rfft *RealFFT) Inverse(input []complex128, output []float64) {
+	if len(input) != rfft.SpectrumLen() || len(output) != rfft.n {
+		panic(fmt.Sprintf("input/output length (%d, %d) must match RealFFT size (%d, %d)",
+			len(input), len(output), rfft.SpectrumLen(), rfft.n))
+	}
+	if rfft.n < 2 {
+		output[0] = real(input[0])
+		return
+	}
+	m := rfft.n / 2
+
+	// Forward 拆分的逆过程：合并为 Z[k] = E[k] + i·O[k]
+	x0, xm := input[0], cmplx.Conj(input[m])
+	input[0] = (x0+xm)/2 + complex(0, 0.5)*(x0-xm)
+	for k := 1; k <= m/2; k++ {
+		a, b := input[k], cmplx.Conj(input[m-k])
+		even := (a + b) / 2
+		odd := (a - b) / 2 * cmplx.Conj(rfft.twist[k])
+		input[k] = even + complex(0, 1)*odd
+		input[m-k] = cmplx.Conj(even) + complex(0, 1)*cmplx.Conj(odd)
+	}
+	rfft.fft.transformInPlace(input[:m], true)
+
+	for j := 0; j < m; j++ {
+		output[2*j], output[2*j+1] = real(input[j]), imag(input[j])
+	}
+}
+
+// Transform 实数变换，output 为长度 n 的完整频谱
 func (rfft *RealFFT) Transform(input []float64, output []complex128, inverse bool) {
 	if len(input) != rfft.n {
 		panic("input length must match RealFFT size")
 	}
+	if len(output) != rfft.n {
+		panic("output length must match RealFFT size")
+	}
+	if rfft.temp == nil {
+		rfft.temp = make([]complex128, rfft.SpectrumLen())
+	}
 
-	// 将实数转换为复数
-	for i, val := range input {
-		rfft.temp[i] = complex(val, 0)
+	// 前半部分来自半频谱，后半部分由共轭对称补齐
+	rfft.Forward(input, rfft.temp)
+	copy(output, rfft.temp)
+	for k := len(rfft.temp); k < rfft.n; k++ {
+		output[k] = cmplx.Conj(output[rfft.n-k])
 	}
 
-	// 执行复数 FFT
-	rfft.fft.Transform(rfft.temp, output, inverse)
+	// 实数输入的逆变换等于正向变换的共轭除以 n
+	if inverse {
+		scale := complex(1.0/float64(rfft.n), 0)
+		for i := range output {
+			output[i] = cmplx.Conj(output[i]) * scale
+		}
+	}
 }
@@ -0,0 +1,157 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"math/cmplx"
+)
+
+// fft32 单精度复数 FFT，只用于对齐。旋转因子逐个查表而不递推，避免单精度下误差随点数累积
+type fft32 struct {
+	n          int
+	roots      []complex64 // e^{2πik/n}，k < n/2；逆变换取共轭
+	bitReverse []int32
+}
+
+// newFFT32 创建 n 点单精度 FFT，n 为 2 的幂
+func newFFT32(n int) *fft32 {
+	f := &fft32{
+		n:          n,
+		roots:      make([]complex64, n/2),
+		bitReverse: make([]int32, n),
+	}
+	angle := 2 * math.Pi / float64(n)
+	for i := range f.roots {
+		f.roots[i] = complex64(cmplx.Rect(1, float64(i)*angle))
+	}
+	logN := bits.TrailingZeros(uint(n))
+	for i := range f.bitReverse {
+		f.bitReverse[i] = int32(reverseBits(i, logN))
+	}
+	return f
+}
+
+// transformInPlace 原地 FFT 变换，data 长度必须为 n
+func (f *fft32) transformInPlace(data []complex64, inverse bool) {
+	n := f.n
+	for i, j := range f.bitReverse {
+		if i < int(j) {
+			data[i], data[j] = data[j], data[i]
+		}
+	}
+
+	for length := 2; length <= n; length <<= 1 {
+		half := length >> 1
+		step := n / length
+		for start := 0; start < n; start += length {
+			for j := 0; j < half; j++ {
+				w := f.roots[j*step]
+				if inverse {
+					w = conj64(w)
+				}
+				u := data[start+j]
+				v := data[start+j+half] * w
+				data[start+j] = u + v
+				data[start+j+half] = u - v
+			}
+		}
+	}
+
+	if inverse {
+		scale := complex(float32(1.0/float64(n)), 0)
+		for i := range data {
+			data[i] *= scale
+		}
+	}
+}
+
+// realFFT32 单精度实数 FFT，算法与 RealFFT 相同。构造后只读，可并发使用
+type realFFT32 struct {
+	n     int
+	fft   *fft32      // n/2 点复数 FFT
+	twist []complex64 // 拆分频谱的旋转因子 e^{2πik/n}，k <= n/4
+}
+
+// newRealFFT32 创建 n 点单精度实数 FFT，n 为 2 的幂
+func newRealFFT32(n int) *realFFT32 {
+	rfft := &realFFT32{n: n}
+	if n < 2 {
+		return rfft
+	}
+	m := n / 2
+	rfft.fft = newFFT32(m)
+	rfft.twist = make([]complex64, m/2+1)
+	angle := 2 * math.Pi / float64(n)
+	for k := range rfft.twist {
+		rfft.twist[k] = complex64(cmplx.Rect(1, float64(k)*angle))
+	}
+	return rfft
+}
+
+// spectrumLen 返回半频谱长度 n/2+1
+func (rfft *realFFT32) spectrumLen() int {
+	return rfft.n/2 + 1
+}
+
+// forward 实数正向变换，output 为长度 spectrumLen 的半频谱
+func (rfft *realFFT32) forward(input []float32, output []complex64) {
+	if len(input) != rfft.n || len(output) != rfft.spectrumLen() {
+		panic(fmt.Sprintf("input/output length (%d, %d) must match RealFFT size (%d, %d)",
+			len(input), len(output), rfft.n, rfft.spectrumLen()))
+	}
+	if rfft.n < 2 {
+		output[0] = complex(input[0], 0)
+		return
+	}
+	m := rfft.n / 2
+
+	for j := 0; j < m; j++ {
+		output[j] = complex(input[2*j], input[2*j+1])
+	}
+	rfft.fft.transformInPlace(output[:m], false)
+
+	z0 := output[0]
+	output[0] = complex(real(z0)+imag(z0), 0)
+	output[m] = complex(real(z0)-imag(z0), 0)
+	for k := 1; k <= m/2; k++ {
+		a, b := output[k], conj64(output[m-k])
+		even := (a + b) / 2
+		odd := (a - b) * complex(0, -0.5) * rfft.twist[k]
+		output[k] = even + odd
+		output[m-k] = conj64(even - odd)
+	}
+}
+
+// inverse 实数逆向变换：input 为长度 spectrumLen 的半频谱（会被覆盖），output 为 n 个实数
+func (rfft *realFFT32) inverse(input []complex64, output []float32) {
+	if len(input) != rfft.spectrumLen() || len(output) != rfft.n {
+		panic(fmt.Sprintf("input/output length (%d, %d) must match RealFFT size (%d, %d)",
+			len(input), len(output), rfft.spectrumLen(), rfft.n))
+	}
+	if rfft.n < 2 {
+		output[0] = real(input[0])
+		return
+	}
+	m := rfft.n / 2
+
+	x0, xm := input[0], conj64(input[m])
+	input[0] = (x0+xm)/2 + complex(0, 0.5)*(x0-xm)
+	for k := 1; k <= m/2; k++ {
+		a, b := input[k], conj64(input[m-k])
+		even := (a + b) / 2
+		odd := (a - b) / 2 * conj64(rfft.twist[k])
+		input[k] = even + complex(0, 1)*odd
+		input[m-k] = conj64(even) + complex(0, 1)*conj64(odd)
+	}
+	rfft.fft.transformInPlace(input[:m], true)
+
+	for j := 0; j < m; j++ {
+		output[2*j], output[2*j+1] = real(input[j]), imag(input[j])
+	}
+}
+
+// conj64 返回单精度复数的共轭
+func conj64(x complex64) complex64 {
+	return complex(real(x), -imag(x))
+}
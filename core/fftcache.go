@@ -0,0 +1,48 @@
+package core
+
+import "sync"
+
+// maxCachedFFTSize 缓存的 FFT 计划的最大点数，更大的计划每次重新构造，不常驻内存
+const maxCachedFFTSize = 1 << 22
+
+// fftPlans 按点数缓存的复数 FFT 计划（*FFT），realFFTPlans 与 realFFT32Plans
+// 缓存双精度与单精度的实数 FFT 计划（*RealFFT、*realFFT32）。
+// 计划构造后只读，可在多个 goroutine 中并发使用
+var fftPlans, realFFTPlans, realFFT32Plans sync.Map
+
+// fftPlan 获取 n 点复数 FFT 计划，相近大小的数据反复计算时复用单位根与位反转表
+func fftPlan(n int) *FFT {
+	if n > maxCachedFFTSize {
+		return NewFFT(n)
+	}
+	if fft, ok := fftPlans.Load(n); ok {
+		return fft.(*FFT)
+	}
+	fft, _ := fftPlans.LoadOrStore(n, NewFFT(n))
+	return fft.(*FFT)
+}
+
+// realFFTPlan 获取 n 点实数 FFT 计划，内部的 n/2 点复数 FFT 同样来自缓存。
+// 缓存的计划只能使用 Forward/Inverse，Transform 使用内部缓冲区，不能并发调用
+func realFFTPlan(n int) *RealFFT {
+	if n > maxCachedFFTSize {
+		return NewRealFFT(n)
+	}
+	if rfft, ok := realFFTPlans.Load(n); ok {
+		return rfft.(*RealFFT)
+	}
+	rfft, _ := realFFTPlans.LoadOrStore(n, newRealFFT(n, fftPlan))
+	return rfft.(*RealFFT)
+}
+
+// realFFT32Plan 获取 n 点单精度实数 FFT 计划
+func realFFT32Plan(n int) *realFFT32 {
+	if n > maxCachedFFTSize {
+		return newRealFFT32(n)
+	}
+	if rfft, ok := realFFT32Plans.Load(n); ok {
+		return rfft.(*realFFT32)
+	}
+	rfft, _ := realFFT32Plans.LoadOrStore(n, newRealFFT32(n))
+	return rfft.(*realFFT32)
+}
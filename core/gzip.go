@@ -0,0 +1,265 @@
+package core
+
+import (
+	"bindiff/types"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// ErrNotRecompressible 输入不是单成员 gzip，或无法用已知参数逐字节重新压缩
+var ErrNotRecompressible = errors.New("input is not a bit-exact recompressible gzip stream")
+
+// gzipLevels 重新压缩时依次尝试的压缩级别（默认级别最常见，放在最前）
+var gzipLevels = []int{
+	flate.DefaultCompression, flate.BestCompression, flate.BestSpeed,
+	2, 3, 4, 5, 7, 8, flate.NoCompression, flate.HuffmanOnly,
+}
+
+// GzipPatch 压缩感知的补丁：在解压后的数据上差分，应用时按记录的参数重新压缩
+type GzipPatch struct {
+	// Header 新文件的 gzip 头原始字节（包含 mtime、文件名、OS 等）
+	Header []byte
+	// Level 重现新文件 deflate 流的压缩级别，flate.HuffmanOnly 表示仅霍夫曼编码策略
+	Level int
+	// OldRawSize/NewRawSize 解压后的数据长度
+	OldRawSize int64
+	NewRawSize int64
+	// Patches 解压后旧数据到解压后新数据的补丁
+	Patches []types.Patch
+}
+
+// gzipMember 解析后的单成员 gzip 流
+type gzipMember struct {
+	header  []byte
+	deflate []byte
+	raw     []byte
+}
+
+// IsGzip 根据文件头判断是否为 gzip 数据
+func IsGzip(data []byte) bool {
+	return len(data) >= 10 && data[0] == 0x1f && data[1] == 0x8b && data[2] == 8
+}
+
+// DiffGzip 解压两个 gzip 输入并比较解压后的数据，同时确认新文件能以某个压缩级别逐字节重现。
+// 输入不是单成员 gzip 或新文件无法重现时返回 ErrNotRecompressible，调用方应回退到原始差分
+func DiffGzip(oldData, newData []byte, options *DiffOptions) (*GzipPatch, error) {
+	options = normalizeDiffOptions(options)
+	if !IsGzip(oldData) || !IsGzip(newData) {
+		return nil, ErrNotRecompressible
+	}
+
+	oldMember, err := parseGzip(oldData, -1)
+	if err != nil {
+		return nil, fmt.Errorf("%w: old file: %v", ErrNotRecompressible, err)
+	}
+	newMember, err := parseGzip(newData, -1)
+	if err != nil {
+		return nil, fmt.Errorf("%w: new file: %v", ErrNotRecompressible, err)
+	}
+
+	level, ok := findGzipLevel(newMember.raw, newMember.deflate)
+	if !ok {
+		return nil, fmt.Errorf("%w: no known compression parameters reproduce the new file", ErrNotRecompressible)
+	}
+	options.Logger.Infof("Gzip diff: %d -> %d uncompressed bytes, level %d", len(oldMember.raw), len(newMember.raw), level)
+
+	patches, err := DiffBytes(oldMember.raw, newMember.raw, options)
+	if err != nil {
+		return nil, err
+	}
+	return &GzipPatch{
+		Header:     newMember.header,
+		Level:      level,
+		OldRawSize: int64(len(oldMember.raw)),
+		NewRawSize: int64(len(newMember.raw)),
+		Patches:    patches,
+	}, nil
+}
+
+// ApplyGzip 解压旧文件、应用补丁并按记录的参数重新压缩
+func ApplyGzip(oldData []byte, patch *GzipPatch, options *ApplyOptions) (out []byte, err error) {
+	start := time.Now()
+	options = normalizeApplyOptions(options)
+	options.Hooks.start(OperationApply, int64(len(oldData)), -1)
+	defer func() {
+		options.Hooks.complete(OperationApply, start, err)
+	}()
+
+	// 解压的旧数据与重建的新数据都受输出上限约束
+	limits := limitsOf(options.Config)
+	if err := limits.checkOutput(patch.OldRawSize); err != nil {
+		return nil, err
+	}
+	if err := limits.checkOutput(patch.NewRawSize); err != nil {
+		return nil, err
+	}
+
+	old, err := parseGzip(oldData, patch.OldRawSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress old file: %w", err)
+	}
+	if int64(len(old.raw)) != patch.OldRawSize {
+		return nil, fmt.Errorf("%w: old file decompresses to %d bytes, expected %d",
+			ErrCorruptPatch, len(old.raw), patch.OldRawSize)
+	}
+
+	raw, err := Apply(old.raw, patch.Patches, &ApplyOptions{
+		Config:  options.Config,
+		Context: options.Context,
+		Lenient: options.Lenient,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(append([]byte(nil), patch.Header...))
+	w, err := flate.NewWriter(buf, patch.Level)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptPatch, err)
+	}
+	w.Write(raw)
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	binary.Write(buf, binary.LittleEndian, crc32.ChecksumIEEE(raw))
+	binary.Write(buf, binary.LittleEndian, uint32(len(raw)))
+	return buf.Bytes(), nil
+}
+
+// ValidateGzipPatch 检查 gzip 补丁结构
+func ValidateGzipPatch(patch *GzipPatch) error {
+	if !IsGzip(patch.Header) {
+		return fmt.Errorf("%w: invalid gzip header", ErrCorruptPatch)
+	}
+	if patch.Level < flate.HuffmanOnly || patch.Level > flate.BestCompression {
+		return fmt.Errorf("%w: invalid compression level %d", ErrCorruptPatch, patch.Level)
+	}
+	return ValidatePatch(patch.Patches, patch.OldRawSize, patch.NewRawSize)
+}
+
+// parseGzip 解析单成员 gzip 流，limit 不小于 0 时解压数据超过 limit 即停止
+func parseGzip(data []byte, limit int64) (*gzipMember, error) {
+	r := bytes.NewReader(data)
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	zr.Multistream(false)
+	headerLen := len(data) - r.Len()
+
+	var src io.Reader = zr
+	if limit >= 0 {
+		src = io.LimitReader(zr, limit+1)
+	}
+	raw, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	if limit >= 0 && int64(len(raw)) > limit {
+		return &gzipMember{raw: raw}, nil
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("trailing data after first gzip member")
+	}
+	return &gzipMember{
+		header:  data[:headerLen],
+		deflate: data[headerLen : len(data)-8],
+		raw:     raw,
+	}, nil
+}
+
+// findGzipLevel 寻找能逐字节重现 deflate 流的压缩级别
+func findGzipLevel(raw, deflated []byte) (int, bool) {
+	for _, level := range gzipLevels {
+		m := &matchWriter{want: deflated}
+		w, err := flate.NewWriter(m, level)
+		if err != nil {
+			continue
+		}
+		if _, err := w.Write(raw); err != nil {
+			continue
+		}
+		if err := w.Close(); err == nil && m.pos == len(deflated) {
+			return level, true
+		}
+	}
+	return 0, false
+}
+
+// errMismatch 重新压缩的输出与原始数据不一致
+var errMismatch = errors.New("recompressed output differs")
+
+// matchWriter 将写入内容与期望数据比较，出现差异时立即失败
+type matchWriter struct {
+	want []byte
+	pos  int
+}
+
+func (m *matchWriter) Write(p []byte) (int, error) {
+	if len(p) > len(m.want)-m.pos || !bytes.Equal(p, m.want[m.pos:m.pos+len(p)]) {
+		return 0, errMismatch
+	}
+	m.pos += len(p)
+	return len(p), nil
+}
+
+// EncodeGzipPatch 编码 gzip 补丁：头长度(4) + 头 + 级别(4) + 旧/新解压长度(8+8) + 补丁长度(4) + 补丁数据
+func EncodeGzipPatch(p *GzipPatch) []byte {
+	buf := new(bytes.Buffer)
+	data := EncodePatch(p.Patches)
+	binary.Write(buf, binary.LittleEndian, uint32(len(p.Header)))
+	buf.Write(p.Header)
+	binary.Write(buf, binary.LittleEndian, int32(p.Level))
+	binary.Write(buf, binary.LittleEndian, p.OldRawSize)
+	binary.Write(buf, binary.LittleEndian, p.NewRawSize)
+	binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+// DecodeGzipPatch 解码 gzip 补丁
+func DecodeGzipPatch(data []byte) (*GzipPatch, error) {
+	r := bytes.NewReader(data)
+	hr := &headerReader{r: r}
+	p := &GzipPatch{}
+
+	var headerLen, patchLen uint32
+	var level int32
+	hr.read(&headerLen)
+	if hr.err == nil && int64(headerLen) > int64(r.Len()) {
+		return nil, fmt.Errorf("%w: gzip header length exceeds payload", ErrCorruptPatch)
+	}
+	p.Header = hr.bytes(int64(headerLen))
+	hr.read(&level)
+	hr.read(&p.OldRawSize)
+	hr.read(&p.NewRawSize)
+	hr.read(&patchLen)
+	if hr.err == nil && int64(patchLen) > int64(r.Len()) {
+		return nil, fmt.Errorf("%w: patch length exceeds payload", ErrCorruptPatch)
+	}
+	patchData := hr.bytes(int64(patchLen))
+	if hr.err != nil {
+		return nil, fmt.Errorf("%w: truncated gzip patch: %v", ErrCorruptPatch, hr.err)
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes in gzip patch", ErrCorruptPatch, r.Len())
+	}
+	if p.OldRawSize < 0 || p.NewRawSize < 0 {
+		return nil, fmt.Errorf("%w: negative uncompressed size", ErrCorruptPatch)
+	}
+
+	patches, err := DecodePatch(patchData)
+	if err != nil {
+		return nil, err
+	}
+	p.Level = int(level)
+	p.Patches = patches
+	return p, nil
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"context"
+	"slices"
+)
+
+const (
+	// maxDirectFFTSize 直接对整个数据做相关的最大 FFT 点数，更大时使用分层对齐
+	maxDirectFFTSize = 1 << 23
+	// coarseFFTSize 分层对齐粗略阶段的最大 FFT 点数
+	coarseFFTSize = 1 << 22
+	// refineWindow 精细阶段旧数据窗口的最大长度
+	refineWindow = 1 << 20
+)
+
+// ComputeOffsetHierarchical 由粗到细计算对齐偏移量：先把两份数据按块取平均降采样，
+// 对降采样序列做相关得到粗略偏移量，再取重叠区域中间的一段窗口在其附近逐字节相关修正。
+// FFT 大小与数据大小无关，可对齐 GB 级的文件；数据较小时与 ComputeOffsetWithContext 相同
+func ComputeOffsetHierarchical(ctx context.Context, oldData, newData []byte) (int, error) {
+	align, err := computeHierarchical(ctx, oldData, newData, nil)
+	return align.Offset, err
+}
+
+// computeHierarchical 分层对齐，置信度取两个阶段中较低的一个
+func computeHierarchical(ctx context.Context, oldData, newData []byte, backend CorrelationBackend) (Alignment, error) {
+	total := len(oldData) + len(newData)
+	if NextPowerOfTwo(total-1) <= maxDirectFFTSize {
+		return computeAlignment(ctx, oldData, newData, backend)
+	}
+	factor := total/(coarseFFTSize-2) + 1
+	coarse, err := coarseOffset(ctx, oldData, newData, factor, backend)
+	if err != nil {
+		return Alignment{}, err
+	}
+	// 粗略偏移量的误差在一两个块之内
+	fine, err := refineOffset(ctx, oldData, newData, coarse.Offset, 4*factor, backend)
+	fine.Confidence = min(fine.Confidence, coarse.Confidence)
+	return fine, err
+}
+
+// coarseOffset 对每 factor 字节的平均值组成的序列做相关，返回以字节计的粗略偏移量
+func coarseOffset(ctx context.Context, oldData, newData []byte, factor int, backend CorrelationBackend) (Alignment, error) {
+	lenA := (len(oldData) + factor - 1) / factor
+	lenB := (len(newData) + factor - 1) / factor
+	corr, err := convolve(ctx, backend, NextPowerOfTwo(lenA+lenB-1), func(in []float64) {
+		downsample(in[:lenA], oldData, factor)
+	}, func(in []float64) {
+		downsample(in[:lenB], newData, factor)
+		slices.Reverse(in[:lenB])
+	})
+	if err != nil {
+		return Alignment{}, err
+	}
+	align := peakAlignment(corr, lenA, lenB)
+	align.Offset *= factor
+	return align, nil
+}
+
+// downsample 把 data 每 factor 字节的平均值减去整体平均值后写入 out。
+// 去掉平均值后相关值不再随重叠长度增长，降采样序列上不会偏向重叠最多的位置
+func downsample(out []float64, data []byte, factor int) {
+	var total float64
+	for k := range out {
+		block := data[k*factor : min((k+1)*factor, len(data))]
+		sum := 0
+		for _, v := range block {
+			sum += int(v)
+		}
+		out[k] = float64(sum) / float64(len(block))
+		total += float64(sum)
+	}
+	mean := total / float64(len(data))
+	for k := range out {
+		out[k] -= mean
+	}
+}
+
+// refineOffset 在粗略偏移量 coarse 的 ±radius 范围内修正：取重叠区域中间最多 refineWindow 字节的旧数据，
+// 与新数据中对应位置两侧各放宽 radius 的窗口逐字节做相关
+func refineOffset(ctx context.Context, oldData, newData []byte, coarse, radius int, backend CorrelationBackend) (Alignment, error) {
+	// 旧数据的位置 j 对应新数据的 j-coarse，重叠区域为 [lo, hi)
+	lo, hi := max(0, coarse), min(len(oldData), len(newData)+coarse)
+	if hi <= lo {
+		return Alignment{Offset: coarse}, nil
+	}
+	w := min(refineWindow, hi-lo)
+	p := lo + (hi-lo-w)/2
+	q := max(0, p-coarse-radius)
+	qEnd := min(len(newData), p-coarse+w+radius)
+	align, err := computeAlignment(ctx, oldData[p:p+w], newData[q:qEnd], backend)
+	align.Offset += p - q
+	return align, err
+}
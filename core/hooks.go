@@ -0,0 +1,62 @@
+package core
+
+import (
+	"bindiff/types"
+	"time"
+)
+
+// 钩子中的操作名称
+const (
+	OperationDiff  = "diff"
+	OperationApply = "apply"
+)
+
+// Hooks 操作生命周期钩子，嵌入方可借此收集指标、驱动界面或实现审计。
+// 所有字段均可为 nil；钩子在调用方的 goroutine 中同步执行，应尽快返回
+type Hooks struct {
+	// OnStart 操作开始，大小未知时为 -1
+	OnStart func(op string, oldSize, newSize int64)
+	// OnBlockMatched 差分找到一段可从旧数据复制的区域
+	OnBlockMatched func(patch types.Patch)
+	// OnOpApplied 应用完一个补丁条目
+	OnOpApplied func(index int, patch types.Patch)
+	// OnVerify 完成一次哈希校验
+	OnVerify func(algo types.HashAlgorithm, expected, actual []byte, ok bool)
+	// OnComplete 操作结束，err 为 nil 表示成功
+	OnComplete func(op string, elapsed time.Duration, err error)
+}
+
+// start 触发 OnStart
+func (h *Hooks) start(op string, oldSize, newSize int64) {
+	if h != nil && h.OnStart != nil {
+		h.OnStart(op, oldSize, newSize)
+	}
+}
+
+// blockMatched 触发 OnBlockMatched
+func (h *Hooks) blockMatched(patch types.Patch) {
+	if h != nil && h.OnBlockMatched != nil {
+		h.OnBlockMatched(patch)
+	}
+}
+
+// opApplied 触发 OnOpApplied
+func (h *Hooks) opApplied(index int, patch types.Patch) {
+	if h != nil && h.OnOpApplied != nil {
+		h.OnOpApplied(index, patch)
+	}
+}
+
+// verify 触发 OnVerify
+func (h *Hooks) verify(algo types.HashAlgorithm, expected, actual []byte, ok bool) {
+	if h != nil && h.OnVerify != nil {
+		h.OnVerify(algo, expected, actual, ok)
+	}
+}
+
+// complete 触发 OnComplete
+func (h *Hooks) complete(op string, start time.Time, err error) {
+	if h != nil && h.OnComplete != nil {
+		h.OnComplete(op, time.Since(start), err)
+	}
+}
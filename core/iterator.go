@@ -0,0 +1,72 @@
+package core
+
+import (
+	"bindiff/types"
+	"bufio"
+	"io"
+)
+
+// PatchIterator 从编码补丁（EncodePatch 格式）中逐条读取操作，
+// 不会物化整个 []types.Patch。用法与 bufio.Scanner 相同：
+//
+//	it := NewPatchIterator(r)
+//	for it.Next() {
+//		p := it.Patch()
+//	}
+//	if err := it.Err(); err != nil { ... }
+type PatchIterator struct {
+	r     *bufio.Reader
+	entry types.Patch
+	buf   []byte
+	index int
+	err   error
+}
+
+// NewPatchIterator 创建补丁迭代器
+func NewPatchIterator(r io.Reader) *PatchIterator {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &PatchIterator{r: br, index: -1}
+}
+
+// Next 读取下一条操作，结束或出错时返回 false
+func (it *PatchIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	entry, err := readPatchBuffer(it.r, it.buf)
+	if err != nil {
+		it.err = err
+		it.entry = types.Patch{}
+		return false
+	}
+
+	// 复用数据缓冲区，避免每条操作单独分配
+	if cap(entry.Data) > cap(it.buf) {
+		it.buf = entry.Data[:0]
+	}
+	it.entry = entry
+	it.index++
+	return true
+}
+
+// Patch 返回当前操作，Data 仅在下一次调用 Next 之前有效
+func (it *PatchIterator) Patch() types.Patch {
+	return it.entry
+}
+
+// Index 返回当前操作的序号
+func (it *PatchIterator) Index() int {
+	return it.index
+}
+
+// Err 返回迭代过程中的错误，正常结束时为 nil
+func (it *PatchIterator) Err() error {
+	if it.err == io.EOF {
+		return nil
+	}
+	return it.err
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"bindiff/pkg/config"
+	"bindiff/types"
+	"fmt"
+)
+
+// applyLimits 以字节计的应用资源上限（见 config.LimitsConfig），0 表示不限制
+type applyLimits struct {
+	maxOutput int64
+	maxOp     int64
+	maxOps    int64
+}
+
+// limitsOf 返回配置中的资源上限
+func limitsOf(cfg *config.Config) applyLimits {
+	if cfg == nil {
+		return applyLimits{}
+	}
+	return applyLimits{
+		maxOutput: int64(cfg.Limits.MaxOutputMB) << 20,
+		maxOp:     int64(cfg.Limits.MaxOpMB) << 20,
+		maxOps:    int64(cfg.Limits.MaxOps),
+	}
+}
+
+// checkOutput 检查重建或解压得到的数据大小
+func (l applyLimits) checkOutput(size int64) error {
+	if l.maxOutput > 0 && size > l.maxOutput {
+		return &LimitError{Limit: "limits.max_output_mb", What: "output size", Value: size, Max: l.maxOutput}
+	}
+	return nil
+}
+
+// checkOps 检查操作数
+func (l applyLimits) checkOps(n int64) error {
+	if l.maxOps > 0 && n > l.maxOps {
+		return &LimitError{Limit: "limits.max_ops", What: "operation count", Value: n, Max: l.maxOps}
+	}
+	return nil
+}
+
+// checkOp 检查单个操作的长度，插入与替换的数据长度也计入
+func (l applyLimits) checkOp(p types.Patch) error {
+	if l.maxOp <= 0 {
+		return nil
+	}
+	if n := max(p.Length, int64(len(p.Data))); n > l.maxOp {
+		return &LimitError{Limit: "limits.max_op_mb", What: "operation length", Value: n, Max: l.maxOp}
+	}
+	return nil
+}
+
+// checkPatch 在应用之前检查整个补丁的操作数与各操作的长度
+func (l applyLimits) checkPatch(patches []types.Patch) error {
+	if err := l.checkOps(int64(len(patches))); err != nil {
+		return err
+	}
+	for i, p := range patches {
+		if err := l.checkOp(p); err != nil {
+			return fmt.Errorf("patch entry %d: %w", i, err)
+		}
+	}
+	return nil
+}
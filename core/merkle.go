@@ -0,0 +1,355 @@
+package core
+
+import (
+	"bindiff/pkg/utils"
+	"bindiff/types"
+	"bytes"
+	"fmt"
+	"hash"
+	"math"
+	"strings"
+)
+
+// Merkle 树哈希的域分隔前缀，叶子与内部节点的哈希不会相同（同 RFC 6962）
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// maxMerkleRanges MerkleError 信息中最多列出的区间数
+const maxMerkleRanges = 8
+
+// hasMerkle 该版本的补丁文件头是否带有 Merkle 树字段
+func hasMerkle(version uint32) bool {
+	return version >= 5
+}
+
+// merkleBlocks 返回 size 字节的数据按 blockSize 分块的块数
+func merkleBlocks(size, blockSize int64) int64 {
+	if size <= 0 || blockSize <= 0 {
+		return 0
+	}
+	return (size + blockSize - 1) / blockSize
+}
+
+// MerkleTree 新文件按固定大小分块的哈希树：叶子为各块（加前缀 0x00）的哈希，
+// 内部节点为两个子节点（加前缀 0x01）的哈希，某层为奇数个节点时最后一个直接提升到上一层。
+// 补丁中保存全部叶子与根，读取时由叶子重新计算根并与保存的根比较，因此认证了根（如另行分发或签名）
+// 也就认证了每一块；可以逐块指出结果中出错的区域，也可以只校验重建的部分块
+type MerkleTree struct {
+	Algorithm types.HashAlgorithm
+	BlockSize int64
+	// Size 数据的总长度，最后一块可能不满
+	Size int64
+	// levels[0] 为叶子，最后一层只有根（没有块时为空串的哈希）
+	levels [][][]byte
+}
+
+// BuildMerkleTree 按 blockSize 对 data 分块并构造 Merkle 树
+func BuildMerkleTree(algo types.HashAlgorithm, data []byte, blockSize int64) (*MerkleTree, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("merkle block size must be positive, got %d", blockSize)
+	}
+	h, err := utils.NewHasher(algo)
+	if err != nil {
+		return nil, err
+	}
+	n := merkleBlocks(int64(len(data)), blockSize)
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		start := int64(i) * blockSize
+		leaves[i] = merkleLeaf(h, data[start:min(start+blockSize, int64(len(data)))])
+	}
+	return newMerkleTree(h, algo, blockSize, int64(len(data)), leaves), nil
+}
+
+// NewMerkleTree 由补丁中保存的叶子（依次相连）重建 Merkle 树，叶子数须与 size、blockSize 一致，
+// 计算出的根须与 root 相同，否则返回 ErrCorruptPatch
+func NewMerkleTree(algo types.HashAlgorithm, blockSize, size int64, leaves, root []byte) (*MerkleTree, error) {
+	h, err := utils.NewHasher(algo)
+	if err != nil {
+		return nil, err
+	}
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("%w: merkle block size %d", ErrCorruptPatch, blockSize)
+	}
+	hashSize := int64(h.Size())
+	n := merkleBlocks(size, blockSize)
+	if int64(len(leaves)) != n*hashSize {
+		return nil, fmt.Errorf("%w: %d bytes of merkle leaves, expected %d blocks of %d bytes",
+			ErrCorruptPatch, len(leaves), n, hashSize)
+	}
+	split := make([][]byte, n)
+	for i := range split {
+		split[i] = leaves[int64(i)*hashSize : int64(i+1)*hashSize]
+	}
+	t := newMerkleTree(h, algo, blockSize, size, split)
+	if !bytes.Equal(t.Root(), root) {
+		return nil, fmt.Errorf("%w: merkle leaves do not match the root", ErrCorruptPatch)
+	}
+	return t, nil
+}
+
+// newMerkleTree 由叶子逐层计算内部节点与根
+func newMerkleTree(h hash.Hash, algo types.HashAlgorithm, blockSize, size int64, leaves [][]byte) *MerkleTree {
+	t := &MerkleTree{Algorithm: algo, BlockSize: blockSize, Size: size, levels: [][][]byte{leaves}}
+	if len(leaves) == 0 {
+		// 同 RFC 6962，空树的根为空串的哈希
+		h.Reset()
+		t.levels = append(t.levels, [][]byte{h.Sum(nil)})
+		return t
+	}
+	for level := leaves; len(level) > 1; {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i+1 < len(level); i += 2 {
+			next = append(next, merkleNode(h, level[i], level[i+1]))
+		}
+		if len(level)%2 == 1 {
+			next = append(next, level[len(level)-1])
+		}
+		t.levels = append(t.levels, next)
+		level = next
+	}
+	return t
+}
+
+// merkleLeaf 计算叶子哈希
+func merkleLeaf(h hash.Hash, block []byte) []byte {
+	h.Reset()
+	h.Write([]byte{merkleLeafPrefix})
+	h.Write(block)
+	return h.Sum(nil)
+}
+
+// merkleNode 计算内部节点哈希
+func merkleNode(h hash.Hash, left, right []byte) []byte {
+	h.Reset()
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// Blocks 返回块数
+func (t *MerkleTree) Blocks() int {
+	return len(t.levels[0])
+}
+
+// Root 返回根哈希
+func (t *MerkleTree) Root() []byte {
+	return t.levels[len(t.levels)-1][0]
+}
+
+// Leaves 返回依次相连的叶子哈希，即补丁中保存的形式
+func (t *MerkleTree) Leaves() []byte {
+	return bytes.Join(t.levels[0], nil)
+}
+
+// BlockRange 返回第 i 块在数据中的区间 [start, end)
+func (t *MerkleTree) BlockRange(i int) (start, end int64) {
+	start = int64(i) * t.BlockSize
+	return start, min(start+t.BlockSize, t.Size)
+}
+
+// Verify 逐块校验完整的数据，长度不一致时多出或缺少的块都记为出错；不一致时返回 *MerkleError
+func (t *MerkleTree) Verify(data []byte) error {
+	v := t.NewVerifier()
+	v.Write(data)
+	return v.Finish()
+}
+
+// VerifyRange 只校验从 offset 开始的一段数据覆盖的块，适合随机访问时校验重建的部分。
+// offset 须与块对齐，data 须由整块组成，或延伸到数据末尾；不一致时返回 *MerkleError
+func (t *MerkleTree) VerifyRange(offset int64, data []byte) error {
+	end := offset + int64(len(data))
+	if offset < 0 || offset%t.BlockSize != 0 || end > t.Size || (end%t.BlockSize != 0 && end != t.Size) {
+		return fmt.Errorf("range [%d, %d) is not aligned to %d-byte merkle blocks of %d bytes of data",
+			offset, end, t.BlockSize, t.Size)
+	}
+	h, err := utils.NewHasher(t.Algorithm)
+	if err != nil {
+		return err
+	}
+	var bad []int
+	first := int(offset / t.BlockSize)
+	for i := first; int64(i)*t.BlockSize < end; i++ {
+		start, stop := t.BlockRange(i)
+		if !bytes.Equal(merkleLeaf(h, data[start-offset:stop-offset]), t.levels[0][i]) {
+			bad = append(bad, i)
+		}
+	}
+	return t.mismatch(bad, nil)
+}
+
+// mismatch 有出错的块时返回 *MerkleError
+func (t *MerkleTree) mismatch(bad []int, cause error) error {
+	if len(bad) == 0 {
+		return cause
+	}
+	return &MerkleError{BlockSize: t.BlockSize, Size: t.Size, Total: t.Blocks(), Blocks: bad, Err: cause}
+}
+
+// MerkleVerifier 边写边按块校验数据，用于流式应用时定位结果中出错的区域
+type MerkleVerifier struct {
+	tree   *MerkleTree
+	hasher hash.Hash
+	block  int
+	filled int64
+	bad    []int
+	extra  bool
+}
+
+// NewVerifier 创建按顺序写入完整数据的校验器
+func (t *MerkleTree) NewVerifier() *MerkleVerifier {
+	h, _ := utils.NewHasher(t.Algorithm)
+	v := &MerkleVerifier{tree: t, hasher: h}
+	v.hasher.Write([]byte{merkleLeafPrefix})
+	return v
+}
+
+// Write 实现 io.Writer，总是写入全部数据
+func (v *MerkleVerifier) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if v.block >= v.tree.Blocks() {
+			// 超出树覆盖的长度
+			v.extra = true
+			return n, nil
+		}
+		_, end := v.tree.BlockRange(v.block)
+		want := end - int64(v.block)*v.tree.BlockSize - v.filled
+		chunk := p[:min(int64(len(p)), want)]
+		v.hasher.Write(chunk)
+		v.filled += int64(len(chunk))
+		p = p[len(chunk):]
+		if int64(len(chunk)) == want {
+			v.finishBlock()
+		}
+	}
+	return n, nil
+}
+
+// finishBlock 比较当前块的哈希并开始下一块
+func (v *MerkleVerifier) finishBlock() {
+	if !bytes.Equal(v.hasher.Sum(nil), v.tree.levels[0][v.block]) {
+		v.bad = append(v.bad, v.block)
+	}
+	v.block++
+	v.filled = 0
+	v.hasher.Reset()
+	v.hasher.Write([]byte{merkleLeafPrefix})
+}
+
+// Finish 结束校验：没有写满的块记为出错；不一致时返回 *MerkleError，
+// 数据比树覆盖的长度更长时错误中包含这一点
+func (v *MerkleVerifier) Finish() error {
+	bad := v.bad
+	for i := v.block; i < v.tree.Blocks(); i++ {
+		bad = append(bad, i)
+	}
+	var cause error
+	if v.extra {
+		cause = fmt.Errorf("%w: data is longer than the %d bytes covered by the merkle tree", ErrHashMismatch, v.tree.Size)
+	}
+	return v.tree.mismatch(bad, cause)
+}
+
+// MerkleError 数据与 Merkle 树不一致，指明出错的块；Err 为同时发现的整体哈希错误
+type MerkleError struct {
+	BlockSize int64
+	Size      int64
+	Total     int
+	Blocks    []int
+	Err       error
+}
+
+// Ranges 返回出错的数据区间 [start, end)，相邻的块合并为一个区间
+func (e *MerkleError) Ranges() [][2]int64 {
+	var ranges [][2]int64
+	for _, b := range e.Blocks {
+		start := int64(b) * e.BlockSize
+		end := min(start+e.BlockSize, e.Size)
+		if n := len(ranges); n > 0 && ranges[n-1][1] == start {
+			ranges[n-1][1] = end
+			continue
+		}
+		ranges = append(ranges, [2]int64{start, end})
+	}
+	return ranges
+}
+
+// Error 实现 error 接口
+func (e *MerkleError) Error() string {
+	ranges := e.Ranges()
+	parts := make([]string, 0, min(len(ranges), maxMerkleRanges)+1)
+	for i, r := range ranges {
+		if i == maxMerkleRanges {
+			parts = append(parts, fmt.Sprintf("and %d more", len(ranges)-i))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%d-%d", r[0], r[1]-1))
+	}
+	msg := fmt.Sprintf("%d of %d blocks (%d bytes each) are wrong at bytes %s",
+		len(e.Blocks), e.Total, e.BlockSize, strings.Join(parts, ", "))
+	if e.Err != nil {
+		return e.Err.Error() + "\n" + msg
+	}
+	return fmt.Sprintf("%v: %s", ErrHashMismatch, msg)
+}
+
+// Unwrap 返回整体哈希错误
+func (e *MerkleError) Unwrap() error {
+	return e.Err
+}
+
+// Is 使 errors.Is(err, ErrHashMismatch) 成立
+func (e *MerkleError) Is(target error) bool {
+	return target == ErrHashMismatch
+}
+
+// AddMerkleTree 按 blockSize 对新数据分块，把 Merkle 树的叶子与根写入补丁文件，
+// 补丁版本低于 5 时升级到当前版本
+func AddMerkleTree(df *types.DiffFile, newData []byte, blockSize int64) error {
+	if blockSize <= 0 || blockSize > math.MaxUint32 {
+		return fmt.Errorf("merkle block size must be between 1 and %d, got %d", uint32(math.MaxUint32), blockSize)
+	}
+	tree, err := BuildMerkleTree(df.HashAlgorithm, newData, blockSize)
+	if err != nil {
+		return err
+	}
+	if !hasMerkle(df.Version) {
+		df.Version = types.PATCH_VERSION
+	}
+	df.MerkleBlockSize = uint32(blockSize)
+	df.MerkleLeaves = tree.Leaves()
+	df.MerkleRoot = tree.Root()
+	return nil
+}
+
+// DiffFileMerkleTree 返回补丁文件中保存的 Merkle 树，没有时返回 nil；叶子与根不符时返回 ErrCorruptPatch
+func DiffFileMerkleTree(df types.DiffFile) (*MerkleTree, error) {
+	if df.MerkleBlockSize == 0 {
+		return nil, nil
+	}
+	return NewMerkleTree(df.HashAlgorithm, int64(df.MerkleBlockSize), int64(df.NewSize), df.MerkleLeaves, df.MerkleRoot)
+}
+
+// VerifyDiffFileResult 校验应用结果的哈希，不一致且补丁带有 Merkle 树时返回 *MerkleError，
+// 指明结果中出错的区域
+func VerifyDiffFileResult(df types.DiffFile, newData []byte, hooks *Hooks) error {
+	err := VerifyHash(df.HashAlgorithm, newData, df.NewHash, hooks)
+	if err == nil {
+		return nil
+	}
+	tree, treeErr := DiffFileMerkleTree(df)
+	if tree == nil || treeErr != nil {
+		return err
+	}
+	if blockErr := tree.Verify(newData); blockErr != nil {
+		if merkleErr, ok := blockErr.(*MerkleError); ok {
+			merkleErr.Err = err
+			return merkleErr
+		}
+	}
+	return err
+}
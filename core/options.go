@@ -0,0 +1,150 @@
+package core
+
+import (
+	"bindiff/pkg/config"
+	"bindiff/pkg/logger"
+	"bindiff/types"
+	"context"
+)
+
+// Option 函数式选项，同时适用于差分与应用接口
+type Option func(*settings)
+
+// settings 函数式选项收集的设置
+type settings struct {
+	config   *config.Config
+	ctx      context.Context
+	progress ProgressReporter
+	hooks    *Hooks
+	logger   logger.Logger
+	lenient  bool
+}
+
+// newSettings 应用选项，未指定的字段使用默认值
+func newSettings(opts []Option) *settings {
+	s := &settings{
+		config: config.DefaultConfig(),
+		ctx:    context.Background(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithConfig 以给定配置的副本为基础，应放在其他配置类选项之前
+func WithConfig(cfg *config.Config) Option {
+	return func(s *settings) {
+		if cfg != nil {
+			copied := *cfg
+			s.config = &copied
+		}
+	}
+}
+
+// WithBlockSize 设置匹配块大小
+func WithBlockSize(size int) Option {
+	return func(s *settings) {
+		s.config.BlockSize = size
+	}
+}
+
+// WithMinMatchLength 设置最小匹配长度
+func WithMinMatchLength(length int) Option {
+	return func(s *settings) {
+		s.config.MinMatchLength = length
+	}
+}
+
+// WithWorkers 设置工作协程数，大于 1 时启用并行处理
+func WithWorkers(workers int) Option {
+	return func(s *settings) {
+		s.config.MaxWorkers = workers
+		s.config.UseParallel = workers > 1
+	}
+}
+
+// WithFFT 启用或禁用 FFT 对齐
+func WithFFT(enabled bool) Option {
+	return func(s *settings) {
+		s.config.EnableFFT = enabled
+	}
+}
+
+// WithMaxMemoryMB 设置差分的内存预算（MB），决定块大小与并发数，0 表示不限制
+func WithMaxMemoryMB(mb int) Option {
+	return func(s *settings) {
+		s.config.MaxMemoryMB = mb
+	}
+}
+
+// WithContext 设置上下文，用于取消和超时
+func WithContext(ctx context.Context) Option {
+	return func(s *settings) {
+		s.ctx = ctx
+	}
+}
+
+// WithProgress 设置进度报告器
+func WithProgress(reporter ProgressReporter) Option {
+	return func(s *settings) {
+		s.progress = reporter
+	}
+}
+
+// WithHooks 设置生命周期钩子
+func WithHooks(hooks *Hooks) Option {
+	return func(s *settings) {
+		s.hooks = hooks
+	}
+}
+
+// WithLogger 设置日志输出，默认不输出日志
+func WithLogger(l logger.Logger) Option {
+	return func(s *settings) {
+		s.logger = l
+	}
+}
+
+// WithLenient 应用补丁时跳过无效条目（仅对应用接口有效）
+func WithLenient() Option {
+	return func(s *settings) {
+		s.lenient = true
+	}
+}
+
+// NewDiffOptions 由函数式选项构造 DiffOptions
+func NewDiffOptions(opts ...Option) *DiffOptions {
+	s := newSettings(opts)
+	return &DiffOptions{
+		Config:   s.config,
+		Context:  s.ctx,
+		Progress: s.progress,
+		Hooks:    s.hooks,
+		Logger:   s.logger,
+	}
+}
+
+// NewApplyOptions 由函数式选项构造 ApplyOptions
+func NewApplyOptions(opts ...Option) *ApplyOptions {
+	s := newSettings(opts)
+	return &ApplyOptions{
+		Config:       s.config,
+		Context:      s.ctx,
+		Progress:     s.progress,
+		VerifyResult: true,
+		Lenient:      s.lenient,
+		Hooks:        s.hooks,
+		Logger:       s.logger,
+	}
+}
+
+// DiffWith 使用函数式选项计算差分
+func DiffWith(oldData, newData []byte, opts ...Option) ([]types.Patch, error) {
+	return DiffBytes(oldData, newData, NewDiffOptions(opts...))
+}
+
+// ApplyWith 使用函数式选项应用补丁
+func ApplyWith(oldData []byte, patches []types.Patch, opts ...Option) ([]byte, error) {
+	return Apply(oldData, patches, NewApplyOptions(opts...))
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"bytes"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// pageStats 逐页差分的统计
+type pageStats struct {
+	moved, modified, zero, literal int
+}
+
+// diffPages 按固定大小的页比较 old 与 newData，将片段追加到 result。
+// old 位于旧文件的 oldBase 偏移处，片段的基偏移使用旧文件中的绝对位置。
+// 内容相同的页无论移动到何处都直接引用旧页，全零页不占用补丁数据，
+// 修改过的页以同一下标的旧页为基差分（skip 中的旧页不作为差分基），
+// 末尾不足一页的数据以旧区域的同一位置为基差分
+func diffPages(result *ArchivePatch, old []byte, oldBase int64, newData []byte, pageSize int, skip map[int]bool, options *DiffOptions) (pageStats, error) {
+	var stats pageStats
+	oldPages := len(old) / pageSize
+	byHash := make(map[uint64][]int, oldPages)
+	for i := 0; i < oldPages; i++ {
+		h := xxhash.Sum64(old[i*pageSize : (i+1)*pageSize])
+		byHash[h] = append(byHash[h], i)
+	}
+	pageOptions := &DiffOptions{Config: options.Config, Context: options.Context}
+
+	for start := 0; start < len(newData); start += pageSize {
+		if err := checkContext(options.Context); err != nil {
+			return stats, err
+		}
+		i := start / pageSize
+		end := start + pageSize
+		if end > len(newData) {
+			end = len(newData)
+		}
+		page := newData[start:end]
+
+		if len(page) == pageSize {
+			if j, ok := samePage(old, page, pageSize, i, byHash[xxhash.Sum64(page)]); ok {
+				if j != i {
+					stats.moved++
+				}
+				result.addCopy(oldBase+int64(j*pageSize), int64(pageSize))
+				continue
+			}
+		}
+		if isZero(page) {
+			stats.zero++
+			result.addZero(int64(len(page)))
+			continue
+		}
+
+		if start < len(old) && !skip[i] {
+			baseEnd := start + pageSize
+			if baseEnd > len(old) {
+				baseEnd = len(old)
+			}
+			patches, err := DiffBytes(old[start:baseEnd], page, pageOptions)
+			if err != nil {
+				return stats, err
+			}
+			if encodedSize(patches) < int64(len(page)) {
+				stats.modified++
+				result.Segments = append(result.Segments, ArchiveSegment{
+					BaseOffset: oldBase + int64(start),
+					BaseLength: int64(baseEnd - start),
+					Patches:    patches,
+				})
+				continue
+			}
+		}
+		stats.literal++
+		result.addLiteral(page)
+	}
+	return stats, nil
+}
+
+// samePage 在候选旧页中寻找与 page 内容相同的页，优先同一页号
+func samePage(oldData, page []byte, pageSize, index int, candidates []int) (int, bool) {
+	if len(candidates) == 0 {
+		return 0, false
+	}
+	if (index+1)*pageSize <= len(oldData) && bytes.Equal(oldData[index*pageSize:(index+1)*pageSize], page) {
+		return index, true
+	}
+	for _, j := range candidates {
+		if bytes.Equal(oldData[j*pageSize:(j+1)*pageSize], page) {
+			return j, true
+		}
+	}
+	return 0, false
+}
+
+// addCopy 追加整段复制旧数据的片段，与前一个相邻的复制片段合并
+func (p *ArchivePatch) addCopy(offset, length int64) {
+	if n := len(p.Segments); n > 0 {
+		last := &p.Segments[n-1]
+		if last.BaseLength > 0 && len(last.Patches) == 0 && !last.transformed() && last.BaseOffset+last.BaseLength == offset {
+			last.BaseLength += length
+			return
+		}
+	}
+	p.Segments = append(p.Segments, ArchiveSegment{BaseOffset: offset, BaseLength: length})
+}
+
+// addZero 追加输出全零字节的片段，与前一个全零片段合并
+func (p *ArchivePatch) addZero(length int64) {
+	if n := len(p.Segments); n > 0 && p.Segments[n-1].Zero {
+		p.Segments[n-1].Size += length
+		return
+	}
+	p.Segments = append(p.Segments, ArchiveSegment{Zero: true, Size: length})
+}
+
+// isZero 判断数据是否全为零
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
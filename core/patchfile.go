@@ -0,0 +1,147 @@
+package core
+
+import (
+	"bindiff/pkg/trace"
+	"bindiff/pkg/utils"
+	"bindiff/types"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// CreateDiffFile 计算 oldData 到 newData 的差分，返回补丁文件结构与差分结果。
+// 两端哈希按配置项 hash_algorithm（options.Config.HashAlgorithm）在后台计算，与差分同时进行；
+// 数据超出补丁头能记录的大小（types.MAX_FILE_SIZE）时返回 ErrPatchTooLarge
+func CreateDiffFile(oldData, newData []byte, options *DiffOptions) (types.DiffFile, *DiffResult, error) {
+	options = normalizeDiffOptions(options)
+	if err := checkFileSize(oldData, newData); err != nil {
+		return types.DiffFile{}, nil, err
+	}
+	algo, err := utils.ParseHashAlgorithm(options.Config.HashAlgorithm)
+	if err != nil {
+		return types.DiffFile{}, nil, err
+	}
+	oldHashing := utils.HashAsync(algo, oldData)
+	defer oldHashing.Wait()
+	newHashing := utils.HashAsync(algo, newData)
+	defer newHashing.Wait()
+
+	format, result, payload, err := DiffPayload(oldData, newData, options)
+	if err != nil {
+		return types.DiffFile{}, nil, err
+	}
+	if err := options.Context.Err(); err != nil {
+		return types.DiffFile{}, nil, err
+	}
+	oldHash, err := oldHashing.Wait()
+	if err != nil {
+		return types.DiffFile{}, nil, fmt.Errorf("failed to hash old data: %w", err)
+	}
+	newHash, err := newHashing.Wait()
+	if err != nil {
+		return types.DiffFile{}, nil, fmt.Errorf("failed to hash new data: %w", err)
+	}
+
+	df := newDiffFile(algo, oldData, newData, oldHash, newHash)
+	df.Format = format
+	df.Offset = result.Offset
+	df.Diff = result.Patches
+	df.Payload = payload
+	return df, result, nil
+}
+
+// CreatePatchFile 同 CreateDiffFile，返回编码后的补丁文件
+func CreatePatchFile(oldData, newData []byte, options *DiffOptions) ([]byte, error) {
+	options = normalizeDiffOptions(options)
+	df, _, err := CreateDiffFile(oldData, newData, options)
+	if err != nil {
+		return nil, err
+	}
+	_, span := trace.Start(options.Context, "encode")
+	defer span.End()
+	return EncodeDiffFile(df), nil
+}
+
+// ApplyPatchFile 解码补丁文件并检查结构，校验旧数据哈希后应用，再校验结果哈希
+// （补丁带 Merkle 树时指出出错的输出区间）。两端哈希总是校验，与 options.VerifyResult 无关
+func ApplyPatchFile(oldData, patch []byte, options *ApplyOptions) ([]byte, error) {
+	options = normalizeApplyOptions(options)
+	ctx := options.Context
+	arena := arenas.Get().(*PatchArena)
+	defer func() {
+		arena.Reset()
+		arenas.Put(arena)
+	}()
+
+	df, err := decodeTraced(ctx, arena, patch)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyTraced(ctx, "old", func() error {
+		return VerifyHash(df.HashAlgorithm, oldData, df.OldHash, options.Hooks)
+	}); err != nil {
+		return nil, err
+	}
+	newData, err := ApplyDiffFile(oldData, df, options)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyTraced(ctx, "new", func() error {
+		return VerifyDiffFileResult(df, newData, options.Hooks)
+	}); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return newData, nil
+}
+
+// arenas ApplyPatchFile 解码补丁复用的内存，应用完成后归还
+var arenas = sync.Pool{
+	New: func() interface{} { return new(PatchArena) },
+}
+
+// decodeTraced 在 decode 跨度中解码并检查补丁结构，补丁数据存放在 arena 中
+func decodeTraced(ctx context.Context, arena *PatchArena, patch []byte) (df types.DiffFile, err error) {
+	_, span := trace.Start(ctx, "decode", trace.Int64("bytes", int64(len(patch))))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+	if df, err = arena.DecodeDiffFile(patch); err != nil {
+		return df, err
+	}
+	return df, ValidateDiffFile(df)
+}
+
+// verifyTraced 在 verify 跨度中校验 which（old 或 new）一端的哈希
+func verifyTraced(ctx context.Context, which string, verify func() error) error {
+	_, span := trace.Start(ctx, "verify", trace.String("file", which))
+	err := verify()
+	span.RecordError(err)
+	span.End()
+	return err
+}
+
+// checkFileSize 检查两端大小能否记录在补丁头中
+func checkFileSize(oldData, newData []byte) error {
+	if int64(len(oldData)) > types.MAX_FILE_SIZE || int64(len(newData)) > types.MAX_FILE_SIZE {
+		return fmt.Errorf("%w: data larger than %d bytes cannot be recorded in the patch header",
+			ErrPatchTooLarge, int64(types.MAX_FILE_SIZE))
+	}
+	return nil
+}
+
+// newDiffFile 返回当前版本、记录两端大小与哈希的补丁文件结构，调用方已检查大小
+func newDiffFile(algo types.HashAlgorithm, oldData, newData, oldHash, newHash []byte) types.DiffFile {
+	return types.DiffFile{
+		MagicNumber:   types.PATCH_MAGIC,
+		Version:       types.PATCH_VERSION,
+		HashAlgorithm: algo,
+		OldSize:       uint32(len(oldData)),
+		NewSize:       uint32(len(newData)),
+		OldHash:       oldHash,
+		NewHash:       newHash,
+	}
+}
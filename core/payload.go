@@ -0,0 +1,234 @@
+package core
+
+import (
+	"bindiff/pkg/config"
+	"bindiff/pkg/trace"
+	"bindiff/pkg/utils"
+	"bindiff/types"
+	"errors"
+	"fmt"
+)
+
+// formatNames 负载格式在追踪属性中的名称
+var formatNames = map[types.PatchFormat]string{
+	types.FORMAT_RAW:     "raw",
+	types.FORMAT_ARCHIVE: "archive",
+	types.FORMAT_GZIP:    "gzip",
+	types.FORMAT_SQLITE:  "sqlite",
+	types.FORMAT_EXEC:    "exec",
+	types.FORMAT_DISK:    "disk",
+}
+
+// DiffPayload 依次尝试 gzip 重新压缩感知、SQLite 逐页、磁盘镜像逐分区、可执行文件逐节与归档感知差分，都不适用时计算原始差分。
+// DiffOptions.Strategy 限定只尝试其中一种（raw 时都不尝试）。
+// 返回负载格式、差分结果（原始格式时包含补丁）与非原始格式的负载数据
+func DiffPayload(oldData, newData []byte, options *DiffOptions) (format types.PatchFormat, result *DiffResult, payload []byte, err error) {
+	options = normalizeDiffOptions(options)
+	mem := utils.TrackMemory(0)
+	ctx, span := trace.Start(options.Context, "diff",
+		trace.Int64("old.size", int64(len(oldData))), trace.Int64("new.size", int64(len(newData))))
+	defer func() {
+		peak := mem.Stop()
+		if err == nil {
+			result.Memory = peak
+			span.SetAttributes(trace.String("format", formatNames[format]),
+				trace.Int64("memory.peak_heap", int64(peak.HeapBytes)))
+		}
+		span.RecordError(err)
+		span.End()
+	}()
+	options.Context = ctx
+	// attempt 判断 Strategy 是否允许尝试某种感知差分
+	attempt := func(strategy string) bool {
+		return options.Strategy == "" || options.Strategy == config.StrategyAuto || options.Strategy == strategy
+	}
+	ratio := func(payload []byte) *DiffResult {
+		return &DiffResult{
+			OldSize:          int64(len(oldData)),
+			NewSize:          int64(len(newData)),
+			CompressionRatio: float64(len(payload)) / float64(max(len(newData), 1)),
+		}
+	}
+
+	if attempt(config.StrategyGzip) && IsGzip(oldData) && IsGzip(newData) {
+		options.Logger.Infof("Computing recompression-aware gzip diff...")
+		patch, err := DiffGzip(oldData, newData, options)
+		switch {
+		case err == nil:
+			payload := EncodeGzipPatch(patch)
+			return types.FORMAT_GZIP, ratio(payload), payload, nil
+		case errors.Is(err, ErrNotRecompressible):
+			options.Logger.Warnf("Falling back from gzip diff: %v", err)
+		default:
+			return 0, nil, nil, err
+		}
+	}
+
+	if attempt(config.StrategySQLite) && SQLitePageSize(oldData) > 0 {
+		options.Logger.Infof("Computing page-level SQLite diff...")
+		patch, err := DiffSQLite(oldData, newData, options)
+		switch {
+		case err == nil:
+			payload := EncodeArchivePatch(patch)
+			return types.FORMAT_SQLITE, ratio(payload), payload, nil
+		case errors.Is(err, ErrNotSQLite):
+			options.Logger.Warnf("Falling back from SQLite diff: %v", err)
+		default:
+			return 0, nil, nil, err
+		}
+	}
+
+	if _, err := ParseDiskImage(oldData); attempt(config.StrategyDisk) && err == nil {
+		options.Logger.Infof("Computing partition-aware disk image diff...")
+		patch, err := DiffDiskImage(oldData, newData, 0, options)
+		switch {
+		case err == nil:
+			payload := EncodeArchivePatch(patch)
+			return types.FORMAT_DISK, ratio(payload), payload, nil
+		case errors.Is(err, ErrNotDiskImage):
+			options.Logger.Warnf("Falling back from disk image diff: %v", err)
+		default:
+			return 0, nil, nil, err
+		}
+	}
+
+	if attempt(config.StrategyExec) && DetectExecutable(oldData) != ExecNone {
+		options.Logger.Infof("Computing section-aware executable diff...")
+		patch, err := DiffExecutable(oldData, newData, options)
+		switch {
+		case err == nil:
+			payload := EncodeExecPatch(patch)
+			return types.FORMAT_EXEC, ratio(payload), payload, nil
+		case errors.Is(err, ErrNotExecutable):
+			options.Logger.Warnf("Falling back from executable diff: %v", err)
+		default:
+			return 0, nil, nil, err
+		}
+	}
+
+	if attempt(config.StrategyArchive) && DetectArchive(oldData) != ArchiveNone {
+		options.Logger.Infof("Computing archive-aware diff...")
+		patch, err := DiffArchive(oldData, newData, options)
+		switch {
+		case err == nil:
+			payload := EncodeArchivePatch(patch)
+			return types.FORMAT_ARCHIVE, ratio(payload), payload, nil
+		case errors.Is(err, ErrNotArchive):
+			options.Logger.Warnf("Falling back from archive diff: %v", err)
+		default:
+			return 0, nil, nil, err
+		}
+	}
+
+	result, err = DiffFull(oldData, newData, options)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return types.FORMAT_RAW, result, nil, nil
+}
+
+// ApplyDiffFile 按补丁文件的负载格式将其应用到旧数据，不校验哈希
+func ApplyDiffFile(oldData []byte, df types.DiffFile, options *ApplyOptions) (newData []byte, err error) {
+	options = normalizeApplyOptions(options)
+	ctx, span := trace.Start(options.Context, "apply",
+		trace.String("format", formatNames[df.Format]), trace.Int64("new.size", int64(df.NewSize)))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+	options.Context = ctx
+
+	// 按记录的新文件大小先检查输出上限，不为超限的补丁分配内存
+	if err := limitsOf(options.Config).checkOutput(int64(df.NewSize)); err != nil {
+		return nil, err
+	}
+
+	switch df.Format {
+	case types.FORMAT_RAW:
+		// 先检查整个补丁的结构，不产生需要靠最终哈希才能发现的错误输出
+		if !options.Lenient {
+			if err := ValidatePatch(df.Diff, int64(len(oldData)), int64(df.NewSize)); err != nil {
+				return nil, err
+			}
+		}
+		return Apply(oldData, df.Diff, options)
+	case types.FORMAT_ARCHIVE, types.FORMAT_SQLITE, types.FORMAT_DISK:
+		patch, err := DecodeArchivePatch(df.Payload)
+		if err != nil {
+			return nil, err
+		}
+		// 先检查片段输出长度，避免伪造的全零片段导致过度分配
+		if err := ValidateArchivePatch(patch, int64(len(oldData)), int64(df.NewSize)); err != nil {
+			return nil, err
+		}
+		return ApplyArchive(oldData, patch, options)
+	case types.FORMAT_GZIP:
+		patch, err := DecodeGzipPatch(df.Payload)
+		if err != nil {
+			return nil, err
+		}
+		return ApplyGzip(oldData, patch, options)
+	case types.FORMAT_EXEC:
+		patch, err := DecodeExecPatch(df.Payload)
+		if err != nil {
+			return nil, err
+		}
+		return ApplyExecutable(oldData, patch, options)
+	default:
+		return nil, fmt.Errorf("%w: unknown payload format %d", ErrUnsupportedVersion, df.Format)
+	}
+}
+
+// ValidateDiffFile 按负载格式检查补丁文件结构，不需要旧数据
+func ValidateDiffFile(df types.DiffFile) error {
+	switch df.Format {
+	case types.FORMAT_RAW:
+		return ValidatePatch(df.Diff, int64(df.OldSize), int64(df.NewSize))
+	case types.FORMAT_ARCHIVE, types.FORMAT_SQLITE, types.FORMAT_DISK:
+		patch, err := DecodeArchivePatch(df.Payload)
+		if err != nil {
+			return err
+		}
+		return ValidateArchivePatch(patch, int64(df.OldSize), int64(df.NewSize))
+	case types.FORMAT_GZIP:
+		patch, err := DecodeGzipPatch(df.Payload)
+		if err != nil {
+			return err
+		}
+		return ValidateGzipPatch(patch)
+	case types.FORMAT_EXEC:
+		patch, err := DecodeExecPatch(df.Payload)
+		if err != nil {
+			return err
+		}
+		return ValidateExecPatch(patch, int64(df.OldSize), int64(df.NewSize))
+	default:
+		return fmt.Errorf("%w: unknown payload format %d", ErrUnsupportedVersion, df.Format)
+	}
+}
+
+// PatchCount 返回补丁文件中的操作条目数
+func PatchCount(df types.DiffFile) int {
+	switch df.Format {
+	case types.FORMAT_ARCHIVE, types.FORMAT_SQLITE, types.FORMAT_DISK:
+		patch, err := DecodeArchivePatch(df.Payload)
+		if err != nil {
+			return 0
+		}
+		return patch.patchCount()
+	case types.FORMAT_GZIP:
+		patch, err := DecodeGzipPatch(df.Payload)
+		if err != nil {
+			return 0
+		}
+		return len(patch.Patches)
+	case types.FORMAT_EXEC:
+		patch, err := DecodeExecPatch(df.Payload)
+		if err != nil {
+			return 0
+		}
+		return patch.Patch.patchCount()
+	default:
+		return len(df.Diff)
+	}
+}
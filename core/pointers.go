@@ -0,0 +1,539 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// PointerArch 分支目标归一化支持的指令集
+type PointerArch uint8
+
+// 支持的指令集
+const (
+	ArchNone  PointerArch = iota
+	ArchX86               // x86 与 x86-64：E8/E9 rel32 的 call/jmp
+	ArchARM64             // AArch64：B/BL imm26
+	ArchARM               // AArch32 (A32)：无条件 B/BL imm24
+)
+
+// String 返回指令集名称
+func (a PointerArch) String() string {
+	switch a {
+	case ArchX86:
+		return "x86"
+	case ArchARM64:
+		return "arm64"
+	case ArchARM:
+		return "arm"
+	default:
+		return "none"
+	}
+}
+
+// PointerMap 分支目标归一化信息（Courgette/Zucchini 的简化做法）：
+// 新文件代码区中每条相对分支的目标被映射到旧文件的地址空间，函数整体移动后调用点的字节与旧文件相同，
+// 差分只需记录真正修改的代码；应用时按同一映射的逆映射还原
+type PointerMap struct {
+	Arch PointerArch
+	// Code 新文件中需要还原的代码区
+	Code []CodeRegion
+	// Equivalences 新旧文件中内容相同（忽略分支目标）的代码区间，定义地址映射
+	Equivalences []Equivalence
+}
+
+// CodeRegion 代码区在新文件中的位置与加载地址
+type CodeRegion struct {
+	Offset int64
+	Size   int64
+	Addr   uint64
+}
+
+// Equivalence 旧文件地址 Old 开始的 Length 字节与新文件地址 New 开始的内容对应
+type Equivalence struct {
+	Old    uint64
+	New    uint64
+	Length uint64
+}
+
+// archSpec 指令集的分支编码：地址以 unit 字节为单位，目标按 bits 位取模
+type archSpec struct {
+	unit uint64
+	bits uint
+}
+
+var archSpecs = map[PointerArch]archSpec{
+	ArchX86:   {unit: 1, bits: 32},
+	ArchARM64: {unit: 4, bits: 26},
+	ArchARM:   {unit: 4, bits: 24},
+}
+
+// execCode 可执行文件的代码节
+type execCode struct {
+	name   string
+	offset int64
+	size   int64
+	addr   uint64
+}
+
+// execCodeSections 解析指令集与代码节，不支持的指令集返回 ArchNone
+func execCodeSections(format ExecFormat, data []byte) (PointerArch, []execCode, error) {
+	var arch PointerArch
+	var code []execCode
+	add := func(name string, offset, size, addr uint64) {
+		if size > 0 && offset <= uint64(len(data)) && size <= uint64(len(data))-offset {
+			code = append(code, execCode{name: name, offset: int64(offset), size: int64(size), addr: addr})
+		}
+	}
+
+	r := bytes.NewReader(data)
+	switch format {
+	case ExecELF:
+		f, err := elf.NewFile(r)
+		if err != nil {
+			return ArchNone, nil, err
+		}
+		switch f.Machine {
+		case elf.EM_386, elf.EM_X86_64:
+			arch = ArchX86
+		case elf.EM_AARCH64:
+			arch = ArchARM64
+		case elf.EM_ARM:
+			arch = ArchARM
+		}
+		for _, s := range f.Sections {
+			if s.Type == elf.SHT_PROGBITS && s.Flags&elf.SHF_EXECINSTR != 0 {
+				add(s.Name, s.Offset, s.FileSize, s.Addr)
+			}
+		}
+	case ExecPE:
+		f, err := pe.NewFile(r)
+		if err != nil {
+			return ArchNone, nil, err
+		}
+		switch f.Machine {
+		case pe.IMAGE_FILE_MACHINE_I386, pe.IMAGE_FILE_MACHINE_AMD64:
+			arch = ArchX86
+		case pe.IMAGE_FILE_MACHINE_ARM64:
+			arch = ArchARM64
+		}
+		for _, s := range f.Sections {
+			if s.Characteristics&(pe.IMAGE_SCN_CNT_CODE|pe.IMAGE_SCN_MEM_EXECUTE) != 0 {
+				// 使用相对虚拟地址，两个文件的映像基址不影响相对分支
+				size := s.Size
+				if s.VirtualSize > 0 && s.VirtualSize < size {
+					size = s.VirtualSize
+				}
+				add(s.Name, uint64(s.Offset), uint64(size), uint64(s.VirtualAddress))
+			}
+		}
+	case ExecMachO:
+		f, err := macho.NewFile(r)
+		if err != nil {
+			return ArchNone, nil, err
+		}
+		switch f.Cpu {
+		case macho.Cpu386, macho.CpuAmd64:
+			arch = ArchX86
+		case macho.CpuArm64:
+			arch = ArchARM64
+		case macho.CpuArm:
+			arch = ArchARM
+		}
+		for _, s := range f.Sections {
+			// S_ATTR_PURE_INSTRUCTIONS 或 S_ATTR_SOME_INSTRUCTIONS
+			if s.Flags&0x80000400 != 0 {
+				add(s.Seg+","+s.Name, uint64(s.Offset), s.Size, s.Addr)
+			}
+		}
+	}
+	return arch, code, nil
+}
+
+// scanBranches 按地址顺序调用 fn(pos)，pos 为分支指令在 code 中的位置。
+// 判断只依赖操作码字节，不依赖分支目标，因此归一化前后找到的位置相同
+func scanBranches(arch PointerArch, code []byte, addr uint64, fn func(pos int)) {
+	switch arch {
+	case ArchX86:
+		for i := 0; i+5 <= len(code); {
+			if code[i] == 0xe8 || code[i] == 0xe9 {
+				fn(i)
+				i += 5
+			} else {
+				i++
+			}
+		}
+	case ArchARM64, ArchARM:
+		// 跳过到 4 字节对齐的地址
+		start := int((4 - addr%4) % 4)
+		for i := start; i+4 <= len(code); i += 4 {
+			w := binary.LittleEndian.Uint32(code[i:])
+			if arch == ArchARM64 && w&0x7c000000 == 0x14000000 ||
+				arch == ArchARM && w&0xfe000000 == 0xea000000 {
+				fn(i)
+			}
+		}
+	}
+}
+
+// branchOperand 读取 pos 处分支的目标偏移与分支基准地址（均以指令集的单位计，未取模）
+func branchOperand(arch PointerArch, code []byte, pos int, addr uint64) (rel, base uint64) {
+	switch arch {
+	case ArchX86:
+		return uint64(binary.LittleEndian.Uint32(code[pos+1:])), addr + uint64(pos) + 5
+	case ArchARM64:
+		return uint64(binary.LittleEndian.Uint32(code[pos:]) & 0x03ffffff), (addr + uint64(pos)) / 4
+	default:
+		return uint64(binary.LittleEndian.Uint32(code[pos:]) & 0x00ffffff), (addr + uint64(pos) + 8) / 4
+	}
+}
+
+// setBranchOperand 写回分支的目标偏移，保留操作码位
+func setBranchOperand(arch PointerArch, code []byte, pos int, rel uint64) {
+	switch arch {
+	case ArchX86:
+		binary.LittleEndian.PutUint32(code[pos+1:], uint32(rel))
+	case ArchARM64:
+		w := binary.LittleEndian.Uint32(code[pos:])
+		binary.LittleEndian.PutUint32(code[pos:], w&^0x03ffffff|uint32(rel)&0x03ffffff)
+	default:
+		w := binary.LittleEndian.Uint32(code[pos:])
+		binary.LittleEndian.PutUint32(code[pos:], w&^0x00ffffff|uint32(rel)&0x00ffffff)
+	}
+}
+
+// maskBranches 返回分支目标清零后的代码副本，用于寻找忽略分支目标的相同代码
+func maskBranches(arch PointerArch, code []byte, addr uint64) []byte {
+	masked := append([]byte(nil), code...)
+	scanBranches(arch, masked, addr, func(pos int) {
+		setBranchOperand(arch, masked, pos, 0)
+	})
+	return masked
+}
+
+// addrRange 以单位计的地址区间
+type addrRange struct {
+	start, length uint64
+	// prefix 排序后之前所有区间的总长度
+	prefix uint64
+	// peer 对应区间在另一侧的序号
+	peer int
+}
+
+// addrMap 新地址空间到旧地址空间的双射：等价区间内按区间平移，
+// 其余地址按在区间之外的序号保序对应，因此任意取值都可以精确还原
+type addrMap struct {
+	modulus    uint64
+	news, olds []addrRange
+}
+
+// newAddrMap 由等价区间构造映射，区间未按单位对齐、越界或相互重叠时返回错误
+func newAddrMap(arch PointerArch, eqs []Equivalence) (*addrMap, error) {
+	spec, ok := archSpecs[arch]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown pointer architecture %d", ErrCorruptPatch, arch)
+	}
+	m := &addrMap{modulus: 1 << spec.bits}
+	m.news = make([]addrRange, len(eqs))
+	m.olds = make([]addrRange, len(eqs))
+	for i, e := range eqs {
+		if e.Old%spec.unit != 0 || e.New%spec.unit != 0 || e.Length%spec.unit != 0 || e.Length == 0 {
+			return nil, fmt.Errorf("%w: misaligned pointer equivalence", ErrCorruptPatch)
+		}
+		n, o, l := e.New/spec.unit%m.modulus, e.Old/spec.unit%m.modulus, e.Length/spec.unit
+		if l > m.modulus-n || l > m.modulus-o {
+			return nil, fmt.Errorf("%w: pointer equivalence wraps the address space", ErrCorruptPatch)
+		}
+		m.news[i] = addrRange{start: n, length: l, peer: i}
+		m.olds[i] = addrRange{start: o, length: l, peer: i}
+	}
+
+	// 两侧分别排序，peer 改为指向排序后的位置
+	sort.Slice(m.news, func(i, j int) bool { return m.news[i].start < m.news[j].start })
+	sort.Slice(m.olds, func(i, j int) bool { return m.olds[i].start < m.olds[j].start })
+	newIndex := make([]int, len(eqs))
+	for i, r := range m.news {
+		newIndex[r.peer] = i
+	}
+	for j := range m.olds {
+		i := newIndex[m.olds[j].peer]
+		m.olds[j].peer, m.news[i].peer = i, j
+	}
+	for _, ranges := range [][]addrRange{m.news, m.olds} {
+		for i := 1; i < len(ranges); i++ {
+			end := ranges[i-1].start + ranges[i-1].length
+			if ranges[i].start < end {
+				return nil, fmt.Errorf("%w: overlapping pointer equivalences", ErrCorruptPatch)
+			}
+			ranges[i].prefix = ranges[i-1].prefix + ranges[i-1].length
+		}
+	}
+	return m, nil
+}
+
+// lookup 返回 x 所在区间的序号（不在任何区间内时为 -1）以及起点不大于 x 的区间数
+func lookup(ranges []addrRange, x uint64) (int, int) {
+	k := sort.Search(len(ranges), func(i int) bool { return ranges[i].start > x })
+	if k > 0 && x-ranges[k-1].start < ranges[k-1].length {
+		return k - 1, k
+	}
+	return -1, k
+}
+
+// rank 返回区间之外的地址 x 在所有区间之外地址中的序号，k 为起点不大于 x 的区间数
+func rank(ranges []addrRange, x uint64, k int) uint64 {
+	if k == 0 {
+		return x
+	}
+	return x - ranges[k-1].prefix - ranges[k-1].length
+}
+
+// unrank 返回区间之外序号为 r 的地址
+func unrank(ranges []addrRange, r uint64) uint64 {
+	// 区间 i 之前的区间外地址数 start - prefix 单调不减
+	k := sort.Search(len(ranges), func(i int) bool { return ranges[i].start-ranges[i].prefix > r })
+	if k == 0 {
+		return r
+	}
+	return r + ranges[k-1].prefix + ranges[k-1].length
+}
+
+// translate 把 from 侧的地址映射到 to 侧
+func translate(from, to []addrRange, x uint64) uint64 {
+	i, k := lookup(from, x)
+	if i >= 0 {
+		return to[from[i].peer].start + x - from[i].start
+	}
+	return unrank(to, rank(from, x, k))
+}
+
+// rebase 以 from→to 的映射改写分支：目标 T = base + rel 映射后，
+// 新的偏移相对映射后的 base 计算，全部按地址空间大小取模
+func (m *addrMap) rebase(from, to []addrRange, rel, base uint64) uint64 {
+	mask := m.modulus - 1
+	base &= mask
+	target := translate(from, to, (base+rel)&mask)
+	return (target - translate(from, to, base)) & mask
+}
+
+// codeMatch 新旧代码节中忽略分支目标后内容相同的区间，位置相对各自代码节
+type codeMatch struct {
+	oldPos, newPos, length int64
+}
+
+// codeChunkOptions 在代码中寻找相同区间使用的分块参数，函数通常只有几十到几百字节
+var codeChunkOptions = &ChunkOptions{MinSize: 32, AvgSize: 128, MaxSize: 1024}
+
+// matchCode 以内容定义分块为锚点查找相同区间，命中后向两侧逐字节扩展，
+// 返回的区间按新位置排序且在新代码中互不重叠
+func matchCode(oldCode, newCode []byte) []codeMatch {
+	index := make(map[string]int)
+	start := 0
+	for _, end := range ChunkBoundaries(oldCode, codeChunkOptions) {
+		if _, ok := index[string(oldCode[start:end])]; !ok {
+			index[string(oldCode[start:end])] = start
+		}
+		start = end
+	}
+
+	var matches []codeMatch
+	var covered int
+	start = 0
+	for _, end := range ChunkBoundaries(newCode, codeChunkOptions) {
+		chunkStart := start
+		start = end
+		if chunkStart < covered {
+			continue
+		}
+		oldPos, ok := index[string(newCode[chunkStart:end])]
+		if !ok {
+			continue
+		}
+		back := commonSuffix(oldCode[:oldPos], newCode[covered:chunkStart])
+		o, n := oldPos-back, chunkStart-back
+		length := end - n
+		length += commonPrefix(oldCode[o+length:], newCode[n+length:])
+		matches = append(matches, codeMatch{oldPos: int64(o), newPos: int64(n), length: int64(length)})
+		covered = n + length
+	}
+	return matches
+}
+
+// equivalences 把相同区间转换为按单位对齐的地址等价区间
+func equivalences(unit uint64, oc, nc execCode, matches []codeMatch) []Equivalence {
+	var eqs []Equivalence
+	for _, m := range matches {
+		oldAddr, newAddr, length := oc.addr+uint64(m.oldPos), nc.addr+uint64(m.newPos), uint64(m.length)
+		if oldAddr%unit != newAddr%unit {
+			continue
+		}
+		skip := (unit - oldAddr%unit) % unit
+		if length <= skip {
+			continue
+		}
+		length = (length - skip) / unit * unit
+		if length > 0 {
+			eqs = append(eqs, Equivalence{Old: oldAddr + skip, New: newAddr + skip, Length: length})
+		}
+	}
+	return eqs
+}
+
+// dropOverlaps 按新地址排序，裁去在任一侧与之前保留的区间重叠的部分（按 unit 对齐），
+// 裁剪后为空的区间被丢弃
+func dropOverlaps(unit uint64, eqs []Equivalence) []Equivalence {
+	sort.Slice(eqs, func(i, j int) bool { return eqs[i].New < eqs[j].New })
+	kept := eqs[:0]
+	// olds 按旧地址排序的已保留区间
+	var olds []Equivalence
+	var newEnd uint64
+	trimFront := func(e *Equivalence, end uint64) {
+		if cut := (end - e.Old + unit - 1) / unit * unit; cut < e.Length {
+			e.Old, e.New, e.Length = e.Old+cut, e.New+cut, e.Length-cut
+		} else {
+			e.Length = 0
+		}
+	}
+	for _, e := range eqs {
+		if e.New < newEnd {
+			trimFront(&e, e.Old+newEnd-e.New)
+		}
+		k := sort.Search(len(olds), func(i int) bool { return olds[i].Old >= e.Old })
+		if k > 0 && olds[k-1].Old+olds[k-1].Length > e.Old {
+			trimFront(&e, olds[k-1].Old+olds[k-1].Length)
+			k = sort.Search(len(olds), func(i int) bool { return olds[i].Old >= e.Old })
+		}
+		if k < len(olds) && e.Old+e.Length > olds[k].Old {
+			e.Length = (olds[k].Old - e.Old) / unit * unit
+		}
+		if e.Length == 0 {
+			continue
+		}
+		olds = append(olds, Equivalence{})
+		copy(olds[k+1:], olds[k:])
+		olds[k] = e
+		kept = append(kept, e)
+		newEnd = e.New + e.Length
+	}
+	return kept
+}
+
+// normalizedExec 分支目标归一化的结果
+type normalizedExec struct {
+	pointers *PointerMap
+	// data 归一化后的新文件
+	data []byte
+	// matches 按新文件中代码节的偏移索引的相同区间
+	matches map[int64]codeMatches
+}
+
+// codeMatches 一个代码节的相同区间，oldOffset 为对应旧代码节的文件偏移
+type codeMatches struct {
+	oldOffset, size int64
+	ranges          []codeMatch
+}
+
+// normalizePointers 计算新文件的分支目标映射并改写新文件，
+// 指令集不受支持或找不到相同代码时返回 nil
+func normalizePointers(ctx context.Context, format ExecFormat, oldData, newData []byte) (*normalizedExec, error) {
+	arch, oldCode, err := execCodeSections(format, oldData)
+	if err != nil || arch == ArchNone {
+		return nil, err
+	}
+	newArch, newCode, err := execCodeSections(format, newData)
+	if err != nil || newArch != arch {
+		return nil, err
+	}
+	olds := make(map[string]execCode, len(oldCode))
+	for _, c := range oldCode {
+		if _, ok := olds[c.name]; !ok {
+			olds[c.name] = c
+		}
+	}
+
+	result := &normalizedExec{matches: make(map[int64]codeMatches)}
+	pm := &PointerMap{Arch: arch}
+	var eqs []Equivalence
+	var end int64
+	sort.SliceStable(newCode, func(i, j int) bool { return newCode[i].offset < newCode[j].offset })
+	for _, nc := range newCode {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		// 重叠的代码节只处理第一个，还原时每个字节最多改写一次
+		oc, ok := olds[nc.name]
+		if !ok || nc.offset < end {
+			continue
+		}
+		end = nc.offset + nc.size
+		matches := matchCode(maskBranches(arch, oldData[oc.offset:oc.offset+oc.size], oc.addr),
+			maskBranches(arch, newData[nc.offset:nc.offset+nc.size], nc.addr))
+		result.matches[nc.offset] = codeMatches{oldOffset: oc.offset, size: nc.size, ranges: matches}
+		eqs = append(eqs, equivalences(archSpecs[arch].unit, oc, nc, matches)...)
+		pm.Code = append(pm.Code, CodeRegion{Offset: nc.offset, Size: nc.size, Addr: nc.addr})
+	}
+	pm.Equivalences = dropOverlaps(archSpecs[arch].unit, eqs)
+	if len(pm.Equivalences) == 0 {
+		return nil, nil
+	}
+
+	m, err := newAddrMap(arch, pm.Equivalences)
+	if err != nil {
+		return nil, err
+	}
+	result.pointers = pm
+	result.data = append([]byte(nil), newData...)
+	pm.rewrite(result.data, func(rel, base uint64) uint64 { return m.rebase(m.news, m.olds, rel, base) })
+	return result, nil
+}
+
+// rewrite 对每个代码区中的分支调用 fn 改写目标偏移
+func (pm *PointerMap) rewrite(data []byte, fn func(rel, base uint64) uint64) {
+	for _, c := range pm.Code {
+		code := data[c.Offset : c.Offset+c.Size]
+		scanBranches(pm.Arch, code, c.Addr, func(pos int) {
+			rel, base := branchOperand(pm.Arch, code, pos, c.Addr)
+			setBranchOperand(pm.Arch, code, pos, fn(rel, base))
+		})
+	}
+}
+
+// Restore 把归一化后的分支目标还原为新文件中的原值
+func (pm *PointerMap) Restore(data []byte) error {
+	if err := pm.validate(int64(len(data))); err != nil {
+		return err
+	}
+	m, err := newAddrMap(pm.Arch, pm.Equivalences)
+	if err != nil {
+		return err
+	}
+	pm.rewrite(data, func(rel, base uint64) uint64 { return m.rebase(m.olds, m.news, rel, m.forward(base)) })
+	return nil
+}
+
+// forward 新地址映射到旧地址空间
+func (m *addrMap) forward(x uint64) uint64 {
+	return translate(m.news, m.olds, x&(m.modulus-1))
+}
+
+// validate 检查代码区位于文件范围内且互不重叠
+func (pm *PointerMap) validate(size int64) error {
+	if _, ok := archSpecs[pm.Arch]; !ok {
+		return fmt.Errorf("%w: unknown pointer architecture %d", ErrCorruptPatch, pm.Arch)
+	}
+	regions := append([]CodeRegion(nil), pm.Code...)
+	sort.Slice(regions, func(i, j int) bool { return regions[i].Offset < regions[j].Offset })
+	var end int64
+	for _, c := range regions {
+		if c.Offset < end || c.Size < 0 || c.Size > size-c.Offset {
+			return fmt.Errorf("%w: pointer code region %d+%d out of range", ErrCorruptPatch, c.Offset, c.Size)
+		}
+		end = c.Offset + c.Size
+	}
+	return nil
+}
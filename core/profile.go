@@ -0,0 +1,72 @@
+package core
+
+import (
+	"bindiff/pkg/config"
+	"path"
+	"strings"
+)
+
+// DetectType 按内容检测文件类型，对应 config.Profile 中 type: 匹配条件的类型名，未识别时返回空字符串
+func DetectType(data []byte) string {
+	switch {
+	case IsGzip(data):
+		return config.StrategyGzip
+	case SQLitePageSize(data) > 0:
+		return config.StrategySQLite
+	case DetectExecutable(data) != ExecNone:
+		return config.StrategyExec
+	case DetectArchive(data) != ArchiveNone:
+		return config.StrategyArchive
+	}
+	if _, err := ParseDiskImage(data); err == nil {
+		return config.StrategyDisk
+	}
+	return ""
+}
+
+// ProfileFor 返回与文件 name 匹配的第一个配置档：依次查 cfg.Profiles 与 config.DefaultProfiles，
+// 文件名模式只与 name 的最后一个元素比较，type: 条件按 data（旧文件内容）检测
+func ProfileFor(cfg *config.Config, name string, data []byte) (config.Profile, bool) {
+	base := path.Base(name)
+	detected, detectedOK := "", false
+	for _, p := range append(append([]config.Profile{}, cfg.Profiles...), config.DefaultProfiles()...) {
+		if t, ok := strings.CutPrefix(p.Match, "type:"); ok {
+			if !detectedOK {
+				detected, detectedOK = DetectType(data), true
+			}
+			if t == detected {
+				return p, true
+			}
+		} else if ok, _ := path.Match(p.Match, base); ok {
+			return p, true
+		}
+	}
+	return config.Profile{}, false
+}
+
+// WithProfile 返回按文件 name 匹配的配置档调整后的差分选项副本，不修改 options；没有匹配时只补全缺省字段
+func WithProfile(options *DiffOptions, name string, data []byte) *DiffOptions {
+	options = normalizeDiffOptions(options)
+	p, ok := ProfileFor(options.Config, name, data)
+	if !ok {
+		return options
+	}
+	cfg := *options.Config
+	if p.BlockSize > 0 {
+		cfg.BlockSize = p.BlockSize
+		cfg.MinMatchLength = min(cfg.MinMatchLength, p.BlockSize)
+	}
+	if p.MinMatchLength > 0 {
+		cfg.MinMatchLength = p.MinMatchLength
+	}
+	if p.AlignStrategy != "" {
+		cfg.AlignStrategy = p.AlignStrategy
+	}
+	cfg.AutoTune = cfg.AutoTune || p.AutoTune
+	options.Config = &cfg
+	if p.Strategy != "" {
+		options.Strategy = p.Strategy
+	}
+	options.Logger.Debugf("Profile %s (strategy %s) applied to %s", p.Match, options.Strategy, name)
+	return options
+}
@@ -0,0 +1,68 @@
+package core
+
+// 进度阶段名称
+const (
+	ProgressStageDiff  = "Computing diff"
+	ProgressStageApply = "Applying patches"
+	ProgressStageHash  = "Computing hash"
+)
+
+// ProgressReporter 进度报告接口，嵌入方（GUI、服务）可实现该接口获取进度
+type ProgressReporter interface {
+	// Report 报告某阶段的进度，current == total 表示该阶段完成
+	Report(stage string, current, total int64)
+}
+
+// ProgressFunc 函数形式的进度回调
+type ProgressFunc func(stage string, current, total int64)
+
+// Report 实现 ProgressReporter
+func (f ProgressFunc) Report(stage string, current, total int64) {
+	f(stage, current, total)
+}
+
+// progressTracker 节流进度报告，每前进约 1% 才回调一次
+type progressTracker struct {
+	reporter ProgressReporter
+	stage    string
+	total    int64
+	step     int64
+	last     int64
+	done     bool
+}
+
+// newProgressTracker 创建进度跟踪器，reporter 为 nil 时返回 nil
+func newProgressTracker(reporter ProgressReporter, stage string, total int64) *progressTracker {
+	if reporter == nil {
+		return nil
+	}
+	step := total / 100
+	if step == 0 {
+		step = 1
+	}
+	reporter.Report(stage, 0, total)
+	return &progressTracker{
+		reporter: reporter,
+		stage:    stage,
+		total:    total,
+		step:     step,
+	}
+}
+
+// update 更新当前进度
+func (p *progressTracker) update(current int64) {
+	if p == nil || p.done || current-p.last < p.step || current >= p.total {
+		return
+	}
+	p.last = current
+	p.reporter.Report(p.stage, current, p.total)
+}
+
+// finish 报告阶段完成
+func (p *progressTracker) finish() {
+	if p == nil || p.done {
+		return
+	}
+	p.done = true
+	p.reporter.Report(p.stage, p.total, p.total)
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"sort"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// DefaultRenameThreshold 默认的重命名相似度阈值
+const DefaultRenameThreshold = 0.5
+
+// Fingerprint 文件按固定大小分块的块哈希指纹，用于估计两个文件的相似度
+type Fingerprint struct {
+	blocks map[uint64]int
+	total  int
+}
+
+// NewFingerprint 计算数据的块哈希指纹，blockSize 不大于 0 时使用默认块大小
+func NewFingerprint(data []byte, blockSize int) *Fingerprint {
+	if blockSize <= 0 {
+		blockSize = 1024
+	}
+	f := &Fingerprint{blocks: make(map[uint64]int)}
+	for i := 0; i < len(data); i += blockSize {
+		end := i + blockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		f.blocks[xxhash.Sum64(data[i:end])]++
+		f.total++
+	}
+	return f
+}
+
+// Similarity 返回共有块数占较大文件块数的比例（0 到 1），空文件与任何文件的相似度为 0
+func (f *Fingerprint) Similarity(other *Fingerprint) float64 {
+	if f.total == 0 || other.total == 0 {
+		return 0
+	}
+	shared := 0
+	for h, n := range f.blocks {
+		if m := other.blocks[h]; m < n {
+			shared += m
+		} else {
+			shared += n
+		}
+	}
+	larger := f.total
+	if other.total > larger {
+		larger = other.total
+	}
+	return float64(shared) / float64(larger)
+}
+
+// MatchRenames 为新增文件在删除文件中寻找相似度不低于 threshold 的对应文件，
+// 按相似度从高到低贪心匹配，每个删除文件至多匹配一次。返回 新路径 -> 原路径
+func MatchRenames(removed, added map[string]*Fingerprint, threshold float64) map[string]string {
+	type candidate struct {
+		from, to string
+		score    float64
+	}
+
+	var candidates []candidate
+	for to, fa := range added {
+		for from, fr := range removed {
+			if score := fr.Similarity(fa); score >= threshold && score > 0 {
+				candidates = append(candidates, candidate{from, to, score})
+			}
+		}
+	}
+	// 分数相同时按路径排序，保证结果确定
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if a.to != b.to {
+			return a.to < b.to
+		}
+		return a.from < b.from
+	})
+
+	renames := make(map[string]string)
+	used := make(map[string]bool)
+	for _, c := range candidates {
+		if _, ok := renames[c.to]; ok || used[c.from] {
+			continue
+		}
+		renames[c.to] = c.from
+		used[c.from] = true
+	}
+	return renames
+}
+
+// RenameDetection 返回选项生效的重命名阈值与块大小，ok 为 false 时不检测重命名
+func RenameDetection(options *DiffOptions) (threshold float64, blockSize int, ok bool) {
+	options = normalizeDiffOptions(options)
+	if options.RenameThreshold < 0 {
+		return 0, 0, false
+	}
+	threshold = options.RenameThreshold
+	if threshold == 0 {
+		threshold = DefaultRenameThreshold
+	}
+	return threshold, options.Config.BlockSize, true
+}
@@ -0,0 +1,42 @@
+package core
+
+// Rabin-Karp 滚动哈希参数（与 librsync 相同），rkAdjust 为 rkMult - 1
+const (
+	rkSeed   = 1
+	rkMult   = 0x08104225
+	rkAdjust = 0x08104224
+)
+
+// rollingHash 固定窗口的多项式滚动哈希：窗口前移一个字节只需常数时间，
+// 用作块匹配的弱校验，候选块再以强哈希确认
+type rollingHash struct {
+	hash uint32
+	// mult 为 rkMult 的窗口长度次幂
+	mult uint32
+}
+
+// reset 以 window 重新计算哈希
+func (r *rollingHash) reset(window []byte) {
+	r.hash, r.mult = rkSeed, 1
+	for _, c := range window {
+		r.hash = r.hash*rkMult + uint32(c)
+		r.mult *= rkMult
+	}
+}
+
+// roll 窗口前移一个字节：移出 out，移入 in
+func (r *rollingHash) roll(out, in byte) {
+	r.hash = r.hash*rkMult + uint32(in) - r.mult*(uint32(out)+rkAdjust)
+}
+
+// sum 返回当前窗口的哈希
+func (r *rollingHash) sum() uint32 {
+	return r.hash
+}
+
+// weakSum 计算一个窗口的滚动哈希
+func weakSum(window []byte) uint32 {
+	var r rollingHash
+	r.reset(window)
+	return r.sum()
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"context"
+	"sort"
+)
+
+const (
+	// defaultAlignSamples 抽样对齐默认的窗口数
+	defaultAlignSamples = 16
+	// defaultAlignSampleSize 抽样对齐默认的窗口大小
+	defaultAlignSampleSize = 64 << 10
+	// sampledSearchFactor 新数据中搜索窗口向两侧各放宽的窗口大小倍数，决定可找到的最大偏移量
+	sampledSearchFactor = 4
+)
+
+// ComputeOffsetSampled 只对均匀抽取的 samples 个 size 字节的旧数据窗口做相关：每个窗口与新数据中
+// 同一位置两侧各放宽 sampledSearchFactor*size 的范围逐字节相关，再按置信度对各窗口的偏移量投票。
+// FFT 工作量与文件大小无关，也不读取窗口以外的数据；只能找到绝对值不超过搜索范围的偏移量。
+// samples 或 size 不大于 0 时使用默认值（16 个 64 KB 的窗口），数据不超过所有窗口的总大小时对整个数据做相关
+func ComputeOffsetSampled(ctx context.Context, oldData, newData []byte, samples, size int) (int, error) {
+	align, err := computeSampled(ctx, oldData, newData, samples, size, nil)
+	return align.Offset, err
+}
+
+// sampledParams 返回抽样窗口数与窗口大小，不大于 0 时使用默认值
+func sampledParams(samples, size int) (int, int) {
+	if samples <= 0 {
+		samples = defaultAlignSamples
+	}
+	if size <= 0 {
+		size = defaultAlignSampleSize
+	}
+	return samples, size
+}
+
+// computeSampled 抽样对齐，置信度取支持所选偏移量的窗口中最高的一个
+func computeSampled(ctx context.Context, oldData, newData []byte, samples, size int, backend CorrelationBackend) (Alignment, error) {
+	samples, size = sampledParams(samples, size)
+	if len(oldData) <= samples*size || len(newData) == 0 {
+		return computeHierarchical(ctx, oldData, newData, backend)
+	}
+
+	radius := sampledSearchFactor * size
+	aligns := make([]Alignment, 0, samples)
+	for i := 0; i < samples; i++ {
+		// 窗口位于把旧数据等分为 samples 段后各段的中间
+		p := int(int64(len(oldData)-size) * int64(2*i+1) / int64(2*samples))
+		// 旧数据的位置 j 对应新数据的 j-offset，偏移量为 0 时窗口位于 [p, p+size)
+		q := min(max(0, p-radius), len(newData))
+		qEnd := min(len(newData), p+size+radius)
+		if qEnd <= q {
+			continue
+		}
+		align, err := computeAlignment(ctx, oldData[p:p+size], newData[q:qEnd], backend)
+		if err != nil {
+			return Alignment{}, err
+		}
+		align.Offset += p - q
+		aligns = append(aligns, align)
+	}
+	return voteAlignments(aligns), nil
+}
+
+// voteAlignments 对置信度不低于 MinAlignConfidence 的结果按偏移量累加置信度，取总和最大的偏移量
+// （相同时取绝对值较小的）；都不可信时返回置信度最高的一个，由调用方回退
+func voteAlignments(aligns []Alignment) Alignment {
+	votes := make(map[int]float64)
+	best := make(map[int]float64)
+	var top Alignment
+	for _, a := range aligns {
+		if a.Confidence > top.Confidence {
+			top = a
+		}
+		if a.Confidence < MinAlignConfidence {
+			continue
+		}
+		votes[a.Offset] += a.Confidence
+		best[a.Offset] = max(best[a.Offset], a.Confidence)
+	}
+	if len(votes) == 0 {
+		return top
+	}
+	offsets := make([]int, 0, len(votes))
+	for offset := range votes {
+		offsets = append(offsets, offset)
+	}
+	abs := func(x int) int {
+		if x < 0 {
+			return -x
+		}
+		return x
+	}
+	sort.Slice(offsets, func(i, j int) bool {
+		a, b := offsets[i], offsets[j]
+		if votes[a] != votes[b] {
+			return votes[a] > votes[b]
+		}
+		if abs(a) != abs(b) {
+			return abs(a) < abs(b)
+		}
+		return a < b
+	})
+	return Alignment{Offset: offsets[0], Confidence: best[offsets[0]]}
+}
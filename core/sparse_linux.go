@@ -0,0 +1,24 @@
+package core
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// fallocate 标志（linux/falloc.h）
+const (
+	fallocFlKeepSize  = 0x01
+	fallocFlPunchHole = 0x02
+)
+
+// holePuncher 返回目标文件的打洞函数，不支持时返回 nil
+func holePuncher(dst io.WriterAt) func(offset, length int64) error {
+	f, ok := dst.(*os.File)
+	if !ok {
+		return nil
+	}
+	return func(offset, length int64) error {
+		return syscall.Fallocate(int(f.Fd()), fallocFlPunchHole|fallocFlKeepSize, offset, length)
+	}
+}
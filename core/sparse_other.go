@@ -0,0 +1,10 @@
+//go:build !linux
+
+package core
+
+import "io"
+
+// holePuncher 非 Linux 平台不支持打洞，稀疏输出依赖跳过写入
+func holePuncher(dst io.WriterAt) func(offset, length int64) error {
+	return nil
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// sqliteMagic SQLite 数据库文件头
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+// ErrNotSQLite 输入不是页大小相同的 SQLite 数据库
+var ErrNotSQLite = errors.New("inputs are not SQLite databases with the same page size")
+
+// SQLitePageSize 根据文件头返回 SQLite 数据库的页大小，不是完整的 SQLite 数据库时返回 0
+func SQLitePageSize(data []byte) int {
+	if len(data) < 100 || !bytes.Equal(data[:16], sqliteMagic) {
+		return 0
+	}
+	size := int(binary.BigEndian.Uint16(data[16:18]))
+	if size == 1 {
+		size = 65536
+	}
+	if size < 512 || size&(size-1) != 0 || len(data)%size != 0 {
+		return 0
+	}
+	return size
+}
+
+// DiffSQLite 按页比较两个 SQLite 数据库：内容相同的页无论移动到何处都直接引用旧页，
+// 修改过的页以旧数据库中同一页号的页为基差分，旧数据库的空闲页不作为差分基。
+// 结果使用归档补丁的片段编码，逐字节还原新数据库
+func DiffSQLite(oldData, newData []byte, options *DiffOptions) (*ArchivePatch, error) {
+	options = normalizeDiffOptions(options)
+	pageSize := SQLitePageSize(oldData)
+	if pageSize == 0 || SQLitePageSize(newData) != pageSize {
+		return nil, ErrNotSQLite
+	}
+	result := &ArchivePatch{}
+
+	stats, err := diffPages(result, oldData, 0, newData, pageSize, sqliteFreePages(oldData, pageSize), options)
+	if err != nil {
+		return nil, err
+	}
+	options.Logger.Infof("SQLite diff: page size %d, %d moved, %d modified, %d literal pages",
+		pageSize, stats.moved, stats.modified, stats.literal)
+	return result, nil
+}
+
+// sqliteFreePages 解析空闲页链表，返回空闲页的下标（页号减一）。
+// 链表损坏时返回已解析的部分
+func sqliteFreePages(data []byte, pageSize int) map[int]bool {
+	pages := len(data) / pageSize
+	free := make(map[int]bool)
+	trunk := int(binary.BigEndian.Uint32(data[32:36]))
+	for visited := 0; trunk > 0 && trunk <= pages && visited < pages; visited++ {
+		if free[trunk-1] {
+			break
+		}
+		free[trunk-1] = true
+		page := data[(trunk-1)*pageSize : trunk*pageSize]
+		count := int(binary.BigEndian.Uint32(page[4:8]))
+		if count > pageSize/4-2 {
+			break
+		}
+		for k := 0; k < count; k++ {
+			leaf := int(binary.BigEndian.Uint32(page[8+4*k:]))
+			if leaf > 0 && leaf <= pages {
+				free[leaf-1] = true
+			}
+		}
+		trunk = int(binary.BigEndian.Uint32(page[0:4]))
+	}
+	return free
+}
@@ -0,0 +1,621 @@
+package core
+
+import (
+	"bindiff/pkg/config"
+	"bindiff/pkg/utils"
+	"bindiff/types"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+const (
+	// streamChunkSize 流式处理时每次读取的块大小（未设置 IO.ReadBufferKB 时）
+	streamChunkSize = 64 * 1024
+	// streamFlushSize INSERT/REPLACE 数据超过该大小时提前输出，限制内存占用
+	streamFlushSize = 1024 * 1024
+	// cloneThreshold 不小于该长度的复制区间在文件之间直接复制
+	cloneThreshold = 64 * 1024
+)
+
+// WriteDiff 从 newData 流式读取新数据，将编码后的补丁（EncodePatch 格式）写入 out
+func (d *Differ) WriteDiff(newData io.Reader, out io.Writer) error {
+	if d.old == nil {
+		return errors.New("differ has no old data, use WriteDiffFrom")
+	}
+	return d.WriteDiffFrom(d.old, newData, out)
+}
+
+// WriteDiffFrom 与 WriteDiff 相同，但使用给定的旧数据，适用于共享差分器
+func (d *Differ) WriteDiffFrom(old io.ReaderAt, newData io.Reader, out io.Writer) (err error) {
+	start := time.Now()
+	d.options.Hooks.start(OperationDiff, -1, -1)
+	defer func() {
+		d.options.Logger.Infof("Streaming diff completed in %v", time.Since(start))
+		d.options.Hooks.complete(OperationDiff, start, err)
+	}()
+
+	ctx := d.options.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	w := &patchRunWriter{out: bufio.NewWriterSize(out, streamBufferSize(d.options.Config)), hooks: d.options.Hooks}
+	newBuf := d.getChunk()
+	defer d.putChunk(newBuf)
+	oldBuf := d.getChunk()
+	defer d.putChunk(oldBuf)
+
+	var pos int64
+	oldSize := int64(-1) // 旧数据结束位置，未知时为 -1
+	for {
+		if err := checkContext(ctx); err != nil {
+			d.options.Logger.Warnf("Streaming diff cancelled")
+			return err
+		}
+
+		n, err := io.ReadFull(newData, newBuf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+
+		m := 0
+		if oldSize < 0 {
+			var rerr error
+			m, rerr = old.ReadAt(oldBuf[:n], pos)
+			if rerr != nil && rerr != io.EOF {
+				return rerr
+			}
+			if m < n {
+				oldSize = pos + int64(m)
+			}
+		}
+
+		for i := 0; i < m; {
+			op, run := types.OP_COPY, commonPrefix
+			if oldBuf[i] != newBuf[i] {
+				op, run = types.OP_REPLACE, differingPrefix
+			}
+			j := i + run(oldBuf[i:m], newBuf[i:m])
+			if err := w.add(op, pos+int64(i), newBuf[i:j]); err != nil {
+				return err
+			}
+			i = j
+		}
+
+		// 超出旧数据的部分作为 INSERT
+		if m < n {
+			if err := w.add(types.OP_INSERT, oldSize, newBuf[m:n]); err != nil {
+				return err
+			}
+		}
+
+		pos += int64(n)
+		if n < len(newBuf) {
+			break
+		}
+	}
+
+	// 新数据较短时删除旧数据尾部
+	if oldSize < 0 {
+		size, err := readerAtSize(old, pos)
+		if err != nil {
+			return err
+		}
+		oldSize = size
+	}
+	if oldSize > pos {
+		if err := w.flush(); err != nil {
+			return err
+		}
+		w.op = types.OP_DELETE
+		w.start = pos
+		w.length = oldSize - pos
+	}
+
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.out.Flush()
+}
+
+// patchRunWriter 合并连续的同类操作并按条目写出
+type patchRunWriter struct {
+	out    *bufio.Writer
+	hooks  *Hooks
+	op     types.Operator
+	start  int64
+	length int64
+	data   []byte
+}
+
+// add 追加一段操作，与当前操作同类时合并
+func (w *patchRunWriter) add(op types.Operator, offset int64, data []byte) error {
+	if w.length > 0 && w.op == op {
+		if op == types.OP_INSERT || w.start+w.length == offset {
+			w.length += int64(len(data))
+			if op != types.OP_COPY {
+				w.data = append(w.data, data...)
+			}
+			if len(w.data) >= streamFlushSize {
+				return w.flush()
+			}
+			return nil
+		}
+	}
+
+	if err := w.flush(); err != nil {
+		return err
+	}
+	w.op = op
+	w.start = offset
+	w.length = int64(len(data))
+	if op != types.OP_COPY {
+		w.data = append(w.data[:0], data...)
+	}
+	return nil
+}
+
+// flush 写出当前操作
+func (w *patchRunWriter) flush() error {
+	if w.length == 0 {
+		return nil
+	}
+	entry := types.Patch{
+		Op:     w.op,
+		Offset: w.start,
+		Length: w.length,
+	}
+	if w.op == types.OP_INSERT || w.op == types.OP_REPLACE {
+		entry.Data = w.data
+	}
+	if w.op == types.OP_COPY {
+		w.hooks.blockMatched(entry)
+	}
+	err := writePatch(w.out, entry)
+	w.length = 0
+	w.data = w.data[:0]
+	return err
+}
+
+// readerAtSize 从 from 开始探测 io.ReaderAt 的数据长度
+func readerAtSize(r io.ReaderAt, from int64) (int64, error) {
+	if sized, ok := r.(interface{ Size() int64 }); ok {
+		return sized.Size(), nil
+	}
+
+	buf := make([]byte, streamChunkSize)
+	pos := from
+	for {
+		n, err := r.ReadAt(buf, pos)
+		pos += int64(n)
+		if err == io.EOF {
+			return pos, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// ApplyStream 流式应用补丁，旧数据按需读取，结果直接写入 out
+func ApplyStream(old io.ReaderAt, patch io.Reader, out io.Writer) error {
+	return ApplyStreamWithOptions(old, patch, out, nil)
+}
+
+// ApplyStreamWithOptions 使用选项流式应用补丁
+func ApplyStreamWithOptions(old io.ReaderAt, patch io.Reader, out io.Writer, options *ApplyOptions) error {
+	return ApplyIterator(old, NewPatchIterator(patch), out, options)
+}
+
+// ApplyIterator 逐条消费补丁迭代器并应用，结果直接写入 out
+func ApplyIterator(old io.ReaderAt, it *PatchIterator, out io.Writer, options *ApplyOptions) (err error) {
+	start := time.Now()
+	options = normalizeApplyOptions(options)
+	options.Hooks.start(OperationApply, -1, -1)
+	defer func() {
+		options.Logger.Infof("Streaming patch applied in %v", time.Since(start))
+		options.Hooks.complete(OperationApply, start, err)
+	}()
+	ctx := options.Context
+
+	bw := bufio.NewWriterSize(out, streamBufferSize(options.Config))
+	// 输出支持时，较大的复制区间在文件之间直接复制，先写出缓冲的数据保持顺序
+	cloner, _ := out.(*progressWriter)
+	copyOld := func(offset, length int64) error {
+		if cloner != nil && cloner.clone != nil && length >= cloneThreshold {
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+			n, err := cloner.cloneRange(ctx, offset, length)
+			if err != nil {
+				return err
+			}
+			offset, length = offset+n, length-n
+			if length == 0 {
+				return nil
+			}
+		}
+		return copyOldRange(ctx, bw, old, offset, length)
+	}
+
+	// outSize 为已产生的输出长度，用于检查输出上限
+	limits := limitsOf(options.Config)
+	var cursor, outSize int64
+	for it.Next() {
+		if err := checkContext(ctx); err != nil {
+			options.Logger.Warnf("Streaming patch application cancelled")
+			return err
+		}
+
+		i, entry := it.Index(), it.Patch()
+		if entry.Offset < 0 || entry.Length < 0 {
+			return newPatchError(i, entry, "negative offset or length")
+		}
+		if err := limits.checkOps(int64(i) + 1); err != nil {
+			return err
+		}
+		if err := limits.checkOp(entry); err != nil {
+			return fmt.Errorf("patch entry %d: %w", i, err)
+		}
+		if entry.Offset > cursor {
+			outSize += entry.Offset - cursor
+		}
+		switch entry.Op {
+		case types.OP_INSERT, types.OP_REPLACE:
+			outSize += int64(len(entry.Data))
+		case types.OP_COPY, types.OP_MATCH:
+			outSize += entry.Length
+		}
+		if err := limits.checkOutput(outSize); err != nil {
+			return err
+		}
+
+		// 复制中间的数据
+		if entry.Offset > cursor {
+			if err := copyOld(cursor, entry.Offset-cursor); err != nil {
+				if err == errShortOldData {
+					return newPatchError(i, entry, "offset exceeds old data")
+				}
+				return err
+			}
+			cursor = entry.Offset
+		}
+
+		switch entry.Op {
+		case types.OP_INSERT:
+			if _, err := bw.Write(entry.Data); err != nil {
+				return err
+			}
+		case types.OP_REPLACE, types.OP_DELETE:
+			if entry.Length > 0 {
+				var probe [1]byte
+				if n, _ := old.ReadAt(probe[:], cursor+entry.Length-1); n < 1 {
+					return newPatchError(i, entry, "length exceeds old data")
+				}
+			}
+			cursor += entry.Length
+			if entry.Op == types.OP_REPLACE {
+				if _, err := bw.Write(entry.Data); err != nil {
+					return err
+				}
+			}
+		case types.OP_COPY, types.OP_MATCH:
+			if err := copyOld(cursor, entry.Length); err != nil {
+				if err == errShortOldData {
+					return newPatchError(i, entry, "copy exceeds old data")
+				}
+				return err
+			}
+			cursor += entry.Length
+		default:
+			return newPatchError(i, entry, "unknown operation")
+		}
+		options.Hooks.opApplied(i, entry)
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	// 复制剩余数据
+	if cloner != nil && cloner.clone != nil && cloner.clone.srcSize > cursor {
+		outSize += cloner.clone.srcSize - cursor
+		if err := limits.checkOutput(outSize); err != nil {
+			return err
+		}
+		if err := copyOld(cursor, cloner.clone.srcSize-cursor); err != nil {
+			return err
+		}
+		cursor = cloner.clone.srcSize
+	}
+	tail := &contextReader{ctx: ctx, r: io.NewSectionReader(old, cursor, math.MaxInt64-cursor)}
+	if limits.maxOutput > 0 {
+		// 剩余数据最多复制到上限之后一个字节，超出即中止
+		remaining := max(limits.maxOutput-outSize, 0)
+		n, err := io.CopyN(bw, tail, remaining+1)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err := limits.checkOutput(outSize + n); err != nil {
+			return err
+		}
+	} else if _, err := io.Copy(bw, tail); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// ApplyDiffFileStream 流式应用补丁文件：从 patch 依次读取补丁头与操作，旧数据按需读取，
+// 结果直接写入 out 而不在内存中缓冲，内存占用与文件大小无关。旧数据的大小与哈希在后台协程中
+// 与应用同时校验；VerifyResult 为 true 时结果哈希在另一个协程中边写边计算。
+// old 与 out 都是 *os.File 时，较大的复制区间以 copy_file_range 在内核中复制（见 utils.CopyFileRange），
+// 支持 reflink 的文件系统上只共享数据块，只有改动的区域真正写入。
+// patch 可以定位时先检查整体校验和（见 VerifyDiffFileChecksum）与整个补丁的结构（见 ValidatePatchStream），
+// 这些错误在写出之前返回；不能定位时校验和边读边计算，在应用结束时检查并优先于其他错误报告。
+// 其他错误返回时 out 中已写入的内容应丢弃。只支持 FORMAT_RAW，其他格式返回 ErrNotStreamable
+func ApplyDiffFileStream(old io.ReaderAt, patch io.Reader, out io.Writer, options *ApplyOptions) (types.DiffFile, error) {
+	options = normalizeApplyOptions(options)
+	src := patch
+	sum, err := prechecksumStream(patch)
+	if err != nil {
+		return types.DiffFile{}, err
+	}
+	if sum != nil {
+		patch = io.TeeReader(patch, sum)
+	}
+	df, err := ReadDiffHeader(patch)
+	if err != nil {
+		return df, err
+	}
+	if df.Format != types.FORMAT_RAW {
+		return df, fmt.Errorf("%w: format %d", ErrNotStreamable, df.Format)
+	}
+	limits := limitsOf(options.Config)
+	if err := limits.checkOutput(int64(df.NewSize)); err != nil {
+		return df, err
+	}
+	if err := prevalidateStream(patch, &df, limits); err != nil {
+		return df, err
+	}
+
+	// 旧数据在后台校验，不匹配时取消应用
+	applyOptions := *options
+	ctx, cancel := context.WithCancel(options.Context)
+	defer cancel()
+	applyOptions.Context = ctx
+	type oldResult struct {
+		sum []byte
+		err error
+	}
+	oldCheck := make(chan oldResult, 1)
+	go func() {
+		sum, err := hashOldData(options.Context, old, &df, streamBufferSize(options.Config))
+		if err != nil || !utils.CompareHashes(sum, df.OldHash) {
+			cancel()
+		}
+		oldCheck <- oldResult{sum, err}
+	}()
+
+	w := &progressWriter{
+		w:        out,
+		progress: newProgressTracker(options.Progress, ProgressStageApply, int64(df.NewSize)),
+		clone:    newFileClone(old, out),
+	}
+	var newHasher *utils.HashWriter
+	var blocks *MerkleVerifier
+	if options.VerifyResult {
+		if newHasher, err = utils.NewHashWriter(df.HashAlgorithm); err != nil {
+			return df, err
+		}
+		defer newHasher.Close()
+		// 带有 Merkle 树时同时逐块校验，结果哈希不一致时指出出错的区域
+		var result io.Writer = newHasher
+		tree, err := DiffFileMerkleTree(df)
+		if err != nil {
+			return df, err
+		}
+		if tree != nil {
+			blocks = tree.NewVerifier()
+			result = io.MultiWriter(newHasher, blocks)
+		}
+		w.w = io.MultiWriter(out, result)
+		if w.clone != nil {
+			w.clone.hash = result
+		}
+	}
+	data := io.LimitReader(patch, int64(df.DataLength))
+	applyErr := ApplyIterator(old, NewPatchIterator(data), w, &applyOptions)
+
+	// 读完剩余的差分数据后检查尾部的校验和，传输中的损坏不表现为应用或哈希错误
+	if sum != nil && hasChecksum(df.Version) && options.Context.Err() == nil {
+		if _, err := io.Copy(io.Discard, data); err != nil {
+			return df, truncatedError(err, "patch data")
+		}
+		if err := readChecksum(src, sum); err != nil {
+			return df, err
+		}
+	}
+
+	// 旧数据不匹配时应用的错误没有意义，优先报告校验结果
+	check := <-oldCheck
+	if check.err != nil {
+		return df, check.err
+	}
+	if err := CheckHash(df.HashAlgorithm, check.sum, df.OldHash, options.Hooks); err != nil {
+		return df, err
+	}
+	if applyErr != nil {
+		return df, applyErr
+	}
+	if w.n != int64(df.NewSize) {
+		return df, &SizeError{Actual: w.n, Expected: int64(df.NewSize)}
+	}
+	w.progress.finish()
+	if newHasher != nil {
+		if err := CheckHash(df.HashAlgorithm, newHasher.Sum(), df.NewHash, options.Hooks); err != nil {
+			if blocks != nil {
+				if merkleErr, ok := blocks.Finish().(*MerkleError); ok {
+					merkleErr.Err = err
+					return df, merkleErr
+				}
+			}
+			return df, err
+		}
+	}
+	return df, nil
+}
+
+// prechecksumStream patch 可以定位时先读一遍检查整体校验和，再回到起始处，返回 nil；
+// 不能定位时返回用于边读边计算的哈希
+func prechecksumStream(patch io.Reader) (hash.Hash32, error) {
+	if seeker, ok := patch.(io.Seeker); ok {
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			if _, err := VerifyDiffFileChecksum(patch); err != nil {
+				return nil, err
+			}
+			_, err = seeker.Seek(start, io.SeekStart)
+			return nil, err
+		}
+	}
+	return newChecksum(), nil
+}
+
+// prevalidateStream patch 可以定位（如 *os.File）时，在写出任何结果之前先读一遍操作检查整个补丁的结构与资源上限，
+// 再回到操作的起始处；不能定位时由应用过程逐条检查，错误在写出部分结果之后才能发现
+func prevalidateStream(patch io.Reader, df *types.DiffFile, limits applyLimits) error {
+	seeker, ok := patch.(io.Seeker)
+	if !ok {
+		return nil
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		// 管道等不能定位的文件
+		return nil
+	}
+	v := patchValidator{oldSize: int64(df.OldSize), newSize: int64(df.NewSize), limits: limits}
+	if err := validatePatchStream(io.LimitReader(patch, int64(df.DataLength)), v); err != nil {
+		return err
+	}
+	_, err = seeker.Seek(start, io.SeekStart)
+	return err
+}
+
+// hashOldData 以 bufSize 大小的缓冲区流式计算旧数据的哈希，并检查旧数据恰好为 OldSize 字节
+func hashOldData(ctx context.Context, old io.ReaderAt, df *types.DiffFile, bufSize int) ([]byte, error) {
+	hasher, err := utils.NewHasher(df.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	r := &contextReader{ctx: ctx, r: io.NewSectionReader(old, 0, int64(df.OldSize))}
+	n, err := io.CopyBuffer(hasher, r, make([]byte, bufSize))
+	if err != nil {
+		return nil, err
+	}
+	var probe [1]byte
+	if m, _ := old.ReadAt(probe[:], int64(df.OldSize)); n != int64(df.OldSize) || m > 0 {
+		return nil, fmt.Errorf("%w: old data size differs from %d bytes", ErrHashMismatch, df.OldSize)
+	}
+	return hasher.Sum(nil), nil
+}
+
+// progressWriter 统计写出的字节数并报告进度
+type progressWriter struct {
+	w        io.Writer
+	n        int64
+	progress *progressTracker
+	// clone 非 nil 时较大的复制区间直接在文件之间复制
+	clone *fileClone
+}
+
+// fileClone 旧数据与输出都是文件时，以 utils.CopyFileRange 复制区间
+type fileClone struct {
+	src, dst *os.File
+	srcSize  int64
+	// old 读取旧数据（O_DIRECT 打开的文件需经 utils.InputFile 对齐读取）
+	old io.ReaderAt
+	// hash 非 nil 时复制的区间还要读出计算结果哈希
+	hash io.Writer
+}
+
+// newFileClone 旧数据（*os.File 或 utils.InputFile）与输出都是普通文件时返回 fileClone，否则返回 nil
+func newFileClone(old io.ReaderAt, out io.Writer) *fileClone {
+	src, _ := old.(*os.File)
+	if in, ok := old.(interface{ File() *os.File }); ok {
+		src = in.File()
+	}
+	dst, ok := out.(*os.File)
+	if src == nil || !ok {
+		return nil
+	}
+	info, err := src.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	return &fileClone{src: src, dst: dst, srcSize: info.Size(), old: old}
+}
+
+// cloneRange 把旧数据 [offset, offset+length) 尽量直接复制到输出，返回已复制的字节数，
+// 其余部分由调用方读出再写入。文件系统不支持时此后不再尝试
+func (p *progressWriter) cloneRange(ctx context.Context, offset, length int64) (int64, error) {
+	if p.clone == nil || length < cloneThreshold {
+		return 0, nil
+	}
+	n, err := utils.CopyFileRange(p.clone.dst, p.clone.src, offset, length)
+	if n == 0 && errors.Is(err, errors.ErrUnsupported) {
+		p.clone = nil
+		return 0, nil
+	}
+	// 部分复制后出错（如 O_DIRECT 文件未对齐的尾部）时，剩余部分回退为读出再写入
+	if n == 0 && err != nil {
+		return 0, err
+	}
+	if p.clone.hash != nil {
+		if err := copyOldRange(ctx, p.clone.hash, p.clone.old, offset, n); err != nil {
+			return n, err
+		}
+	}
+	p.n += n
+	p.progress.update(p.n)
+	return n, nil
+}
+
+// Write 实现 io.Writer
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.n += int64(n)
+	p.progress.update(p.n)
+	return n, err
+}
+
+// streamBufferSize 返回流式读写的缓冲区大小（IO.ReadBufferKB），未设置时为 streamChunkSize
+func streamBufferSize(cfg *config.Config) int {
+	if cfg == nil || cfg.IO.ReadBufferKB <= 0 {
+		return streamChunkSize
+	}
+	return cfg.IO.ReadBufferKB * 1024
+}
+
+// errShortOldData 旧数据不足以完成复制
+var errShortOldData = errors.New("old data too short")
+
+// copyOldRange 将旧数据 [offset, offset+length) 复制到 w，复制过程中检查上下文
+func copyOldRange(ctx context.Context, w io.Writer, old io.ReaderAt, offset, length int64) error {
+	n, err := io.Copy(w, &contextReader{ctx: ctx, r: io.NewSectionReader(old, offset, length)})
+	if err != nil {
+		return err
+	}
+	if n < length {
+		return errShortOldData
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"bindiff/pkg/logger"
+	"bindiff/types"
+)
+
+const (
+	// tuneSamples 自动调参时抽样的新数据区域数
+	tuneSamples = 8
+	// tuneRegion 每个抽样区域的大小
+	tuneRegion = 64 << 10
+	// tuneMargin 旧数据窗口向抽样区域两侧各放宽的字节数，能找到的移动距离不超过该值
+	tuneMargin = 4 * tuneRegion
+)
+
+// tuneBlockSizes 自动调参尝试的块大小，从大到小，补丁大小相同时取较大的块
+var tuneBlockSizes = []int{4096, 2048, 1024, 512, 256, 128, 64}
+
+// TuneResult 自动调参的结果
+type TuneResult struct {
+	BlockSize      int
+	MinMatchLength int
+	// EstimatedSize 按抽样比例外推的编码后补丁大小
+	EstimatedSize int64
+	// MatchedRatio 抽样区域中被 COPY 覆盖的比例
+	MatchedRatio float64
+}
+
+// TuneParameters 抽样选择块大小与最小匹配长度：从新数据中均匀抽取 tuneSamples 个区域，
+// 与旧数据中同一位置附近的窗口以各组候选参数做块匹配差分，取编码后补丁最小的一组
+// （相同时保留配置的参数，其次取较大的块与较长的最小匹配）。数据较小时直接对整个数据尝试
+func TuneParameters(oldData, newData []byte, options *DiffOptions) (TuneResult, error) {
+	options = normalizeDiffOptions(options)
+	current := options.Config
+
+	type region struct{ oldFrom, oldTo, newFrom, newTo int }
+	var regions []region
+	sampled := len(newData)
+	if len(newData) <= tuneSamples*tuneRegion {
+		regions = []region{{0, len(oldData), 0, len(newData)}}
+	} else {
+		sampled = tuneSamples * tuneRegion
+		for i := 0; i < tuneSamples; i++ {
+			p := int(int64(len(newData)-tuneRegion) * int64(2*i+1) / int64(2*tuneSamples))
+			regions = append(regions, region{
+				oldFrom: min(max(0, p-tuneMargin), len(oldData)),
+				oldTo:   min(len(oldData), p+tuneRegion+tuneMargin),
+				newFrom: p,
+				newTo:   p + tuneRegion,
+			})
+		}
+	}
+
+	// 候选参数：配置的参数在前，每个块大小再尝试整块、1/2 与 1/4 的最小匹配长度
+	candidates := [][2]int{{current.BlockSize, current.MinMatchLength}}
+	for _, b := range tuneBlockSizes {
+		for _, m := range []int{b, b / 2, b / 4} {
+			candidates = append(candidates, [2]int{b, m})
+		}
+	}
+
+	best := TuneResult{BlockSize: current.BlockSize, MinMatchLength: current.MinMatchLength, EstimatedSize: -1}
+	for _, c := range candidates {
+		if c[0] <= 0 || c[1] <= 0 || c[1] > c[0] {
+			continue
+		}
+		cfg := *current
+		cfg.BlockSize, cfg.MinMatchLength = c[0], c[1]
+		cfg.UseParallel = false
+		trial := &DiffOptions{Config: &cfg, Context: options.Context, Logger: logger.Nop()}
+
+		var size, matched int64
+		for _, r := range regions {
+			patches, err := blockDiff(oldData[r.oldFrom:r.oldTo], newData[r.newFrom:r.newTo], trial)
+			if err != nil {
+				return TuneResult{}, err
+			}
+			size += encodedSize(patches)
+			matched += copiedBytes(patches)
+		}
+		if sampled > 0 {
+			size = int64(float64(size) * float64(len(newData)) / float64(sampled))
+		}
+		if best.EstimatedSize < 0 || size < best.EstimatedSize {
+			best = TuneResult{BlockSize: c[0], MinMatchLength: c[1], EstimatedSize: size}
+			if sampled > 0 {
+				best.MatchedRatio = float64(matched) / float64(sampled)
+			}
+		}
+	}
+	return best, nil
+}
+
+// copiedBytes 统计补丁中 COPY 条目覆盖的字节数
+func copiedBytes(patches []types.Patch) int64 {
+	var n int64
+	for _, p := range patches {
+		if p.Op == types.OP_COPY {
+			n += p.Length
+		}
+	}
+	return n
+}
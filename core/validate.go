@@ -0,0 +1,111 @@
+package core
+
+import (
+	"bindiff/types"
+	"fmt"
+	"io"
+)
+
+// ValidatePatch 在不应用的情况下检查补丁的结构不变量：
+// 偏移量有序、操作不越过旧数据边界、数据长度一致、输出不超出 newSize，且输出总长度等于 newSize。
+// 条目错误为 *PatchError，总长度不一致为 *SizeError，两者都满足 errors.Is(err, ErrCorruptPatch)
+func ValidatePatch(patch []types.Patch, oldSize, newSize int64) error {
+	v := patchValidator{oldSize: oldSize, newSize: newSize}
+	for i, entry := range patch {
+		if err := v.check(i, entry); err != nil {
+			return err
+		}
+	}
+	return v.finish()
+}
+
+// ValidatePatchStream 与 ValidatePatch 相同，但从编码补丁（EncodePatch 格式）中逐条读取操作，
+// 不物化整个补丁，用于流式应用之前检查补丁
+func ValidatePatchStream(r io.Reader, oldSize, newSize int64) error {
+	return validatePatchStream(r, patchValidator{oldSize: oldSize, newSize: newSize})
+}
+
+// validatePatchStream 以给定的校验器逐条检查编码补丁
+func validatePatchStream(r io.Reader, v patchValidator) error {
+	it := NewPatchIterator(r)
+	for it.Next() {
+		if err := v.check(it.Index(), it.Patch()); err != nil {
+			return err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	return v.finish()
+}
+
+// patchValidator 按应用模型逐条检查操作：cursor 为旧数据的读取位置，outSize 为已产生的输出长度；
+// limits 不为零值时同时检查资源上限
+type patchValidator struct {
+	oldSize, newSize int64
+	cursor, outSize  int64
+	limits           applyLimits
+}
+
+// check 检查一条操作并推进读取位置与输出长度
+func (v *patchValidator) check(i int, entry types.Patch) error {
+	if err := v.limits.checkOps(int64(i) + 1); err != nil {
+		return err
+	}
+	if err := v.limits.checkOp(entry); err != nil {
+		return fmt.Errorf("patch entry %d: %w", i, err)
+	}
+	if entry.Offset < 0 || entry.Length < 0 {
+		return newPatchError(i, entry, "negative offset or length")
+	}
+	if entry.Offset < v.cursor {
+		return newPatchError(i, entry, "offset precedes current position %d", v.cursor)
+	}
+	if entry.Offset > v.oldSize {
+		return newPatchError(i, entry, "offset exceeds old data length %d", v.oldSize)
+	}
+
+	// 中间的数据隐式复制
+	v.outSize += entry.Offset - v.cursor
+	v.cursor = entry.Offset
+
+	switch entry.Op {
+	case types.OP_INSERT, types.OP_REPLACE:
+		if int64(len(entry.Data)) != entry.Length {
+			return newPatchError(i, entry, "data length %d does not match length", len(entry.Data))
+		}
+		if entry.Op == types.OP_REPLACE {
+			if entry.Length > v.oldSize-v.cursor {
+				return newPatchError(i, entry, "length exceeds old data length %d", v.oldSize)
+			}
+			v.cursor += entry.Length
+		}
+		v.outSize += entry.Length
+	case types.OP_DELETE:
+		if entry.Length > v.oldSize-v.cursor {
+			return newPatchError(i, entry, "length exceeds old data length %d", v.oldSize)
+		}
+		v.cursor += entry.Length
+	case types.OP_COPY, types.OP_MATCH:
+		if entry.Length > v.oldSize-v.cursor {
+			return newPatchError(i, entry, "copy exceeds old data length %d", v.oldSize)
+		}
+		v.cursor += entry.Length
+		v.outSize += entry.Length
+	default:
+		return newPatchError(i, entry, "unknown operation")
+	}
+
+	if v.outSize > v.newSize {
+		return newPatchError(i, entry, "output exceeds new size %d", v.newSize)
+	}
+	return nil
+}
+
+// finish 计入剩余的隐式复制，检查输出总长度
+func (v *patchValidator) finish() error {
+	if outSize := v.outSize + v.oldSize - v.cursor; outSize != v.newSize {
+		return &SizeError{Actual: outSize, Expected: v.newSize}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+const (
+	// winnowK 指纹的 k-gram 长度
+	winnowK = 32
+	// winnowMinWindow 筛选窗口的最小长度：每个窗口至少取一个指纹，不短于 winnowK+winnowMinWindow-1 的相同内容一定能找到
+	winnowMinWindow = 64
+	// winnowMaxFingerprints 每份数据大约保留的最大指纹数，更大的数据按比例加大筛选窗口
+	winnowMaxFingerprints = 1 << 21
+	// winnowBase k-gram 多项式哈希的乘数
+	winnowBase = 0x100000001b3
+)
+
+// fingerprint 筛选出的 k-gram 指纹：哈希与起始位置
+type fingerprint struct {
+	hash uint64
+	pos  int
+}
+
+// LocalAlignment 一段局部对齐：新数据 [NewPos, NewPos+Length) 与旧数据 [OldPos, OldPos+Length)
+// 的指纹依次一致，偏移量为 OldPos-NewPos
+type LocalAlignment struct {
+	OldPos, NewPos, Length int
+	// Anchors 支持该段的指纹数
+	Anchors int
+}
+
+// LocalAlignments 以筛选（winnowing）的 k-gram 指纹找出新旧数据间的局部对齐，按新位置排序。
+// 只使用在两份数据中都只出现一次的指纹作为锚点，重复内容不会产生歧义的对齐；
+// 指纹只比较内容而不比较数值大小，压缩等高熵区域同样能对齐
+func LocalAlignments(ctx context.Context, oldData, newData []byte) ([]LocalAlignment, error) {
+	window := winnowWindow(max(len(oldData), len(newData)))
+	oldPrints, err := winnow(ctx, oldData, window)
+	if err != nil {
+		return nil, err
+	}
+	newPrints, err := winnow(ctx, newData, window)
+	if err != nil {
+		return nil, err
+	}
+
+	// 旧数据中只出现一次的指纹位置，重复的记为 -1
+	oldPos := make(map[uint64]int, len(oldPrints))
+	for _, fp := range oldPrints {
+		if _, dup := oldPos[fp.hash]; dup {
+			oldPos[fp.hash] = -1
+		} else {
+			oldPos[fp.hash] = fp.pos
+		}
+	}
+	newCount := make(map[uint64]int, len(newPrints))
+	for _, fp := range newPrints {
+		newCount[fp.hash]++
+	}
+
+	// 按新位置依次连接同一对角线上相邻的锚点
+	var aligns []LocalAlignment
+	for _, fp := range newPrints {
+		pos, ok := oldPos[fp.hash]
+		if !ok || pos < 0 || newCount[fp.hash] > 1 {
+			continue
+		}
+		if n := len(aligns); n > 0 {
+			last := &aligns[n-1]
+			if last.OldPos-last.NewPos == pos-fp.pos {
+				last.Length = fp.pos + winnowK - last.NewPos
+				last.Anchors++
+				continue
+			}
+		}
+		aligns = append(aligns, LocalAlignment{OldPos: pos, NewPos: fp.pos, Length: winnowK, Anchors: 1})
+	}
+	return aligns, nil
+}
+
+// computeWinnow 以局部对齐计算整体偏移量：取锚点最多的偏移量（相同时取绝对值较小的），
+// 置信度为 log2(锚点数+1)，只有一个锚点时为 1，低于 MinAlignConfidence
+func computeWinnow(ctx context.Context, oldData, newData []byte) (Alignment, error) {
+	aligns, err := LocalAlignments(ctx, oldData, newData)
+	if err != nil || len(aligns) == 0 {
+		return Alignment{}, err
+	}
+	votes := make(map[int]int)
+	for _, a := range aligns {
+		votes[a.OldPos-a.NewPos] += a.Anchors
+	}
+	offsets := make([]int, 0, len(votes))
+	for offset := range votes {
+		offsets = append(offsets, offset)
+	}
+	abs := func(x int) int {
+		if x < 0 {
+			return -x
+		}
+		return x
+	}
+	sort.Slice(offsets, func(i, j int) bool {
+		a, b := offsets[i], offsets[j]
+		if votes[a] != votes[b] {
+			return votes[a] > votes[b]
+		}
+		if abs(a) != abs(b) {
+			return abs(a) < abs(b)
+		}
+		return a < b
+	})
+	best := offsets[0]
+	return Alignment{Offset: best, Confidence: math.Log2(float64(votes[best] + 1))}, nil
+}
+
+// winnowWindow 按数据大小确定筛选窗口，使指纹数不超过约 winnowMaxFingerprints
+func winnowWindow(size int) int {
+	// 筛选出的指纹密度约为 2/(window+1)
+	return max(winnowMinWindow, 2*size/winnowMaxFingerprints)
+}
+
+// winnow 计算 data 的筛选指纹：每 window 个相邻 k-gram 中取哈希最小的一个（相同时取最右边的），
+// 相邻窗口选中同一个 k-gram 时只记录一次
+func winnow(ctx context.Context, data []byte, window int) ([]fingerprint, error) {
+	count := len(data) - winnowK + 1
+	if count <= 0 {
+		return nil, nil
+	}
+	window = min(window, count)
+
+	var pow uint64 = 1 // winnowBase 的 winnowK 次幂
+	var h uint64
+	for _, c := range data[:winnowK] {
+		h = h*winnowBase + uint64(c)
+		pow *= winnowBase
+	}
+
+	hashes := make([]uint64, window) // 最近 window 个 k-gram 的哈希，按位置取模存放
+	queue := make([]int, 0, window)  // 窗口内可能成为最小值的位置，哈希递增
+	head := 0
+	prints := make([]fingerprint, 0, 2*count/(window+1)+1)
+	selected := -1
+	nextCheck := 0
+	for pos := 0; pos < count; pos++ {
+		if pos >= nextCheck {
+			if err := checkContext(ctx); err != nil {
+				return nil, err
+			}
+			nextCheck = pos + ctxCheckInterval
+		}
+		if pos > 0 {
+			h = h*winnowBase + uint64(data[pos+winnowK-1]) - pow*uint64(data[pos-1])
+		}
+		m := mix64(h)
+		hashes[pos%window] = m
+
+		for len(queue) > head && hashes[queue[len(queue)-1]%window] >= m {
+			queue = queue[:len(queue)-1]
+		}
+		queue = append(queue, pos)
+		if queue[head] <= pos-window {
+			head++
+		}
+		if head > window {
+			queue = append(queue[:0], queue[head:]...)
+			head = 0
+		}
+
+		if pos >= window-1 && queue[head] != selected {
+			selected = queue[head]
+			prints = append(prints, fingerprint{hash: hashes[selected%window], pos: selected})
+		}
+	}
+	return prints, nil
+}
+
+// mix64 打散多项式哈希的各位（MurmurHash3 的终结函数），使最小值的选取接近随机
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,223 @@
+package core
+
+import (
+	"bindiff/types"
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+// sparseBlockSize 稀疏输出检测全零块的粒度
+const sparseBlockSize = 4096
+
+// zeroBlock 用于比较全零块
+var zeroBlock = make([]byte, streamChunkSize)
+
+// WriterAtOptions 基于 io.WriterAt 的应用选项
+type WriterAtOptions struct {
+	ApplyOptions
+	// InPlace 目标与旧数据为同一份数据（如原地修补 VM 镜像）：
+	// 位置不变的 COPY 区域直接跳过，输出写入不得超前于尚未读取的旧数据
+	InPlace bool
+	// Sparse 全零块不写入：支持打洞的文件系统上执行打洞，
+	// 否则要求目标在这些区域本来就是零（新建文件）
+	Sparse bool
+}
+
+// ApplyToWriterAt 逐条应用补丁并通过 io.WriterAt 写出，返回输出总长度。
+// 目标实现 Truncate(int64) error（如 *os.File）时最后截断为输出长度
+func ApplyToWriterAt(old io.ReaderAt, it *PatchIterator, dst io.WriterAt, options *WriterAtOptions) (size int64, err error) {
+	start := time.Now()
+	if options == nil {
+		options = &WriterAtOptions{}
+	}
+	options = &WriterAtOptions{
+		ApplyOptions: *normalizeApplyOptions(&options.ApplyOptions),
+		InPlace:      options.InPlace,
+		Sparse:       options.Sparse,
+	}
+	options.Hooks.start(OperationApply, -1, -1)
+	defer func() {
+		options.Logger.Infof("Patch applied through WriterAt in %v", time.Since(start))
+		options.Hooks.complete(OperationApply, start, err)
+	}()
+	ctx := options.Context
+
+	oldSize, err := readerAtSize(old, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	w := &sparseWriter{
+		dst:     dst,
+		sparse:  options.Sparse,
+		inPlace: options.InPlace,
+		punch:   holePuncher(dst),
+	}
+	buf := make([]byte, streamChunkSize)
+
+	var cursor, outPos int64
+	// copyOld 复制旧数据 [cursor, cursor+length) 到 outPos
+	copyOld := func(length int64) error {
+		if cursor+length > oldSize {
+			return errShortOldData
+		}
+		if options.InPlace && outPos == cursor {
+			cursor += length
+			outPos += length
+			return nil
+		}
+		for length > 0 {
+			if err := checkContext(ctx); err != nil {
+				return err
+			}
+			n := int64(len(buf))
+			if n > length {
+				n = length
+			}
+			if _, err := old.ReadAt(buf[:n], cursor); err != nil && err != io.EOF {
+				return err
+			}
+			if err := w.writeAt(buf[:n], outPos); err != nil {
+				return err
+			}
+			cursor += n
+			outPos += n
+			length -= n
+		}
+		return nil
+	}
+
+	for it.Next() {
+		if err := checkContext(ctx); err != nil {
+			options.Logger.Warnf("WriterAt patch application cancelled")
+			return outPos, err
+		}
+
+		i, entry := it.Index(), it.Patch()
+
+		// 复制中间的数据
+		if entry.Offset > cursor {
+			if err := copyOld(entry.Offset - cursor); err != nil {
+				if err == errShortOldData {
+					return outPos, newPatchError(i, entry, "offset exceeds old data length %d", oldSize)
+				}
+				return outPos, err
+			}
+		}
+
+		switch entry.Op {
+		case types.OP_INSERT, types.OP_REPLACE:
+			if entry.Op == types.OP_REPLACE {
+				if cursor+entry.Length > oldSize {
+					return outPos, newPatchError(i, entry, "length exceeds old data length %d", oldSize)
+				}
+				cursor += entry.Length
+			}
+			if options.InPlace && outPos+int64(len(entry.Data)) > cursor && cursor < oldSize {
+				return outPos, newPatchError(i, entry, "output overtakes unread old data, cannot apply in place")
+			}
+			if err := w.writeAt(entry.Data, outPos); err != nil {
+				return outPos, err
+			}
+			outPos += int64(len(entry.Data))
+		case types.OP_DELETE:
+			if cursor+entry.Length > oldSize {
+				return outPos, newPatchError(i, entry, "length exceeds old data length %d", oldSize)
+			}
+			cursor += entry.Length
+		case types.OP_COPY, types.OP_MATCH:
+			if err := copyOld(entry.Length); err != nil {
+				if err == errShortOldData {
+					return outPos, newPatchError(i, entry, "copy exceeds old data length %d", oldSize)
+				}
+				return outPos, err
+			}
+		default:
+			return outPos, newPatchError(i, entry, "unknown operation")
+		}
+		options.Hooks.opApplied(i, entry)
+	}
+	if err := it.Err(); err != nil {
+		return outPos, err
+	}
+
+	// 复制剩余数据
+	if cursor < oldSize {
+		if err := copyOld(oldSize - cursor); err != nil {
+			return outPos, err
+		}
+	}
+
+	if t, ok := dst.(interface{ Truncate(size int64) error }); ok {
+		if err := t.Truncate(outPos); err != nil {
+			return outPos, fmt.Errorf("failed to truncate output: %w", err)
+		}
+	}
+
+	return outPos, nil
+}
+
+// sparseWriter 写入时跳过或打洞全零块
+type sparseWriter struct {
+	dst     io.WriterAt
+	sparse  bool
+	inPlace bool
+	punch   func(offset, length int64) error
+}
+
+// writeAt 写出 p，稀疏模式下全零块合并为空洞
+func (w *sparseWriter) writeAt(p []byte, off int64) error {
+	if !w.sparse {
+		_, err := w.dst.WriteAt(p, off)
+		return err
+	}
+
+	for len(p) > 0 {
+		// 按块对齐划分，收集连续的全零或非零段
+		zero := isZeroSegment(p, off)
+		n := 0
+		for n < len(p) {
+			seg := sparseBlockSize - int((off+int64(n))%sparseBlockSize)
+			if seg > len(p)-n {
+				seg = len(p) - n
+			}
+			if isZeroSegment(p[n:], off+int64(n)) != zero {
+				break
+			}
+			n += seg
+		}
+
+		if err := w.writeRun(p[:n], off, zero); err != nil {
+			return err
+		}
+		p = p[n:]
+		off += int64(n)
+	}
+	return nil
+}
+
+// writeRun 写出一段连续数据，全零时尽量打洞
+func (w *sparseWriter) writeRun(p []byte, off int64, zero bool) error {
+	if zero {
+		if w.punch != nil && w.punch(off, int64(len(p))) == nil {
+			return nil
+		}
+		if !w.inPlace {
+			// 新建目标在该区域本来就是零
+			return nil
+		}
+	}
+	_, err := w.dst.WriteAt(p, off)
+	return err
+}
+
+// isZeroSegment 检查从 off 开始到下一个块边界的数据是否全零
+func isZeroSegment(p []byte, off int64) bool {
+	n := sparseBlockSize - int(off%sparseBlockSize)
+	if n > len(p) {
+		n = len(p)
+	}
+	return bytes.Equal(p[:n], zeroBlock[:n])
+}
@@ -3,11 +3,16 @@ package main
 import (
 	"bindiff/cmd"
 	"bindiff/pkg/config"
+	"bindiff/pkg/i18n"
 	"bindiff/pkg/logger"
+	"bindiff/pkg/progress"
+	"bindiff/pkg/utils"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/spf13/cobra"
 )
@@ -15,6 +20,8 @@ import (
 var (
 	// 全局配置
 	cfg *config.Config
+	// 每个配置项有效值的来源
+	origins config.Origins
 
 	// 命令行选项
 	configFile   string
@@ -25,6 +32,11 @@ var (
 	maxWorkers   int
 	useParallel  bool
 	enableFFT    bool
+	progressFmt  string
+	noColor      bool
+	lang         string
+	profileDir   string
+	profileTrace bool
 )
 
 func main() {
@@ -50,15 +62,49 @@ func main() {
 	rootCmd.PersistentFlags().IntVar(&maxWorkers, "workers", 4, "Maximum number of workers for parallel processing")
 	rootCmd.PersistentFlags().BoolVar(&useParallel, "parallel", true, "Enable parallel processing")
 	rootCmd.PersistentFlags().BoolVar(&enableFFT, "fft", true, "Enable FFT-based alignment")
+	rootCmd.PersistentFlags().StringVar(&progressFmt, "progress-format", "bar", "Progress output on stderr: bar (only on a terminal), jsonl or none")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable colored output (also honours NO_COLOR)")
+	rootCmd.PersistentFlags().StringVar(&lang, "lang", "", "Output language: en or zh (default: from LC_ALL, LC_MESSAGES or LANG)")
+	rootCmd.PersistentFlags().StringVar(&profileDir, "profile-dir", "", "Write CPU and heap profiles of the command to this directory")
+	rootCmd.PersistentFlags().BoolVar(&profileTrace, "profile-trace", false, "Also write an execution trace to --profile-dir")
 
 	// 添加子命令
-	rootCmd.AddCommand(cmd.DiffCommand())
-	rootCmd.AddCommand(cmd.ApplyCommand())
+	rootCmd.AddCommand(cmd.DiffCommand(func() *config.Config { return cfg }))
+	rootCmd.AddCommand(cmd.ApplyCommand(func() *config.Config { return cfg }))
+	rootCmd.AddCommand(cmd.VerifyCommand())
+	rootCmd.AddCommand(cmd.AuditCommand(func() *config.Config { return cfg }))
+	rootCmd.AddCommand(cmd.RestoreCommand())
+	rootCmd.AddCommand(cmd.RepoCommand(func() *config.Config { return cfg }))
+	rootCmd.AddCommand(cmd.OCICommand(func() *config.Config { return cfg }))
+	rootCmd.AddCommand(cmd.DirCommand(func() *config.Config { return cfg }))
+	rootCmd.AddCommand(cmd.SignatureCommand())
+	rootCmd.AddCommand(cmd.DeltaCommand())
+	rootCmd.AddCommand(cmd.PatchCommand())
+	rootCmd.AddCommand(cmd.ZsyncCommand(func() *config.Config { return cfg }))
+	rootCmd.AddCommand(cmd.ZchunkCommand(func() *config.Config { return cfg }))
+	rootCmd.AddCommand(cmd.GraphCommand())
+	rootCmd.AddCommand(cmd.GitDeltaCommand())
+	rootCmd.AddCommand(cmd.OSTreeCommand(func() *config.Config { return cfg }))
+	rootCmd.AddCommand(cmd.DebDeltaCommand(func() *config.Config { return cfg }))
+	rootCmd.AddCommand(cmd.DoctorCommand(func() *config.Config { return cfg }))
+	rootCmd.AddCommand(cmd.SelfUpdateCommand())
+	rootCmd.AddCommand(cmd.GRPCServeCommand(func() *config.Config { return cfg }))
+	rootCmd.AddCommand(cmd.ServeCommand(func() *config.Config { return cfg }))
 	rootCmd.AddCommand(createConfigCommand())
 	rootCmd.AddCommand(createBenchmarkCommand())
 	rootCmd.AddCommand(createVersionCommand())
 
-	if err := rootCmd.Execute(); err != nil {
+	// SIGINT/SIGTERM 取消命令的上下文，清理未写完的文件后以 130/143 退出
+	ctx := handleSignals()
+	err := rootCmd.ExecuteContext(ctx)
+	if sig := interruptSignal(ctx); sig != nil {
+		exitInterrupted(sig)
+	}
+	if err != nil {
+		// 出错时不会执行 cleanupApp，在退出前写完性能分析
+		if perr := stopProfiling(); perr != nil {
+			log.Printf("%v", perr)
+		}
 		if logger.Sugar != nil {
 			logger.Fatalf("Command execution failed: %v", err)
 		} else {
@@ -71,38 +117,52 @@ func main() {
 func initializeApp(cmd *cobra.Command, args []string) error {
 	// 1. 加载配置
 	var err error
-	cfg, err = config.LoadConfig(configFile)
+	cfg, origins, err = config.LoadLayeredConfig(configFile)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	// 2. 命令行选项覆盖配置文件
-	if cmd.Flag("repo").Changed {
-		cfg.RepoDir = repoDir
-	}
-	if cmd.Flag("log-level").Changed {
-		cfg.LogLevel = logLevel
-	}
-	if cmd.Flag("progress").Changed {
-		cfg.ShowProgress = showProgress
+	// 2. 命令行选项覆盖配置文件与环境变量
+	overrides := []struct {
+		flag, key string
+		apply     func()
+	}{
+		{"repo", "repo_dir", func() { cfg.RepoDir = repoDir }},
+		{"log-level", "log_level", func() { cfg.LogLevel = logLevel }},
+		{"progress", "show_progress", func() { cfg.ShowProgress = showProgress }},
+		{"verbose", "verbose", func() { cfg.Verbose = verbose }},
+		{"workers", "max_workers", func() { cfg.MaxWorkers = maxWorkers }},
+		{"parallel", "use_parallel", func() { cfg.UseParallel = useParallel }},
+		{"fft", "enable_fft", func() { cfg.EnableFFT = enableFFT }},
+		{"progress-format", "progress_format", func() { cfg.ProgressFormat = progressFmt }},
+		{"lang", "lang", func() { cfg.Lang = lang }},
 	}
-	if cmd.Flag("verbose").Changed {
-		cfg.Verbose = verbose
-	}
-	if cmd.Flag("workers").Changed {
-		cfg.MaxWorkers = maxWorkers
-	}
-	if cmd.Flag("parallel").Changed {
-		cfg.UseParallel = useParallel
+	for _, o := range overrides {
+		if cmd.Flag(o.flag).Changed {
+			o.apply()
+			origins[o.key] = "flag:--" + o.flag
+		}
 	}
-	if cmd.Flag("fft").Changed {
-		cfg.EnableFFT = enableFFT
+
+	// 3. 选择输出语言，之后的结果与日志按该语言输出
+	if err := i18n.SetLanguage(cfg.Lang); err != nil {
+		return err
 	}
 
-	// 3. 初始化日志系统
+	// 4. 初始化日志系统
 	loggerConfig := logger.LoggerConfig{
 		Level:      cfg.LogLevel,
 		OutputPath: "", // 只输出到控制台
+		MaxSize:    cfg.LogFile.MaxSizeMB,
+		MaxAge:     cfg.LogFile.MaxAgeDays,
+		MaxBackups: cfg.LogFile.MaxBackups,
+		Compress:   cfg.LogFile.Compress,
+		NoColor:    noColor,
+	}
+
+	// 命令以 --json 把结果写到标准输出时，日志改写到标准错误
+	if f := cmd.Flags().Lookup("json"); f != nil && f.Changed {
+		loggerConfig.ConsoleStderr = true
 	}
 
 	if cfg.Verbose {
@@ -115,14 +175,32 @@ func initializeApp(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to initialize logger: %w", err)
 	}
 
-	// 4. 设置全局配置
+	// 5. 设置全局配置
 	cmd.SetContext(cmd.Context())
+	utils.SetDurableWrites(cfg.IO.Fsync)
+	format := cfg.ProgressFormat
+	if format == "" {
+		format = progress.FormatBar
+	}
+	if !cfg.ShowProgress {
+		format = progress.FormatNone
+	}
+	if err := progress.SetFormat(format); err != nil {
+		return err
+	}
+	if profileDir != "" {
+		if err := startProfiling(profileDir, cmd.Name(), profileTrace); err != nil {
+			return err
+		}
+	} else if profileTrace {
+		return fmt.Errorf("--profile-trace requires --profile-dir")
+	}
 
-	// 5. 输出启动信息
+	// 6. 输出启动信息
 	logger.Infof("BindDiff v2.0 started with config: workers=%d, fft=%t, parallel=%t",
 		cfg.MaxWorkers, cfg.EnableFFT, cfg.UseParallel)
 
-	// 6. 创建仓库目录
+	// 7. 创建仓库目录
 	if err := os.MkdirAll(cfg.RepoDir, 0755); err != nil {
 		return fmt.Errorf("failed to create repo directory: %w", err)
 	}
@@ -132,6 +210,9 @@ func initializeApp(cmd *cobra.Command, args []string) error {
 
 // cleanupApp 清理应用程序
 func cleanupApp(cmd *cobra.Command, args []string) {
+	if err := stopProfiling(); err != nil {
+		logger.Warnf("%v", err)
+	}
 	logger.Info("BindDiff operation completed")
 	logger.Close()
 }
@@ -165,27 +246,105 @@ func createConfigCommand() *cobra.Command {
 	})
 
 	// 显示当前配置
-	cmd.AddCommand(&cobra.Command{
+	var showOrigin bool
+	show := &cobra.Command{
 		Use:   "show",
 		Short: "Show current configuration",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			fmt.Printf("Current Configuration:\n")
-			fmt.Printf("  Block Size: %d bytes\n", cfg.BlockSize)
-			fmt.Printf("  Min Match Length: %d bytes\n", cfg.MinMatchLength)
-			fmt.Printf("  Max Memory: %d MB\n", cfg.MaxMemoryMB)
-			fmt.Printf("  Max Workers: %d\n", cfg.MaxWorkers)
-			fmt.Printf("  Enable FFT: %t\n", cfg.EnableFFT)
-			fmt.Printf("  Use Parallel: %t\n", cfg.UseParallel)
-			fmt.Printf("  Show Progress: %t\n", cfg.ShowProgress)
-			fmt.Printf("  Log Level: %s\n", cfg.LogLevel)
-			fmt.Printf("  Repo Dir: %s\n", cfg.RepoDir)
+			if showOrigin {
+				printConfigOrigins()
+				return nil
+			}
+			i18n.Printf("Current Configuration:\n")
+			i18n.Printf("  Block Size: %d bytes\n", cfg.BlockSize)
+			i18n.Printf("  Min Match Length: %d bytes\n", cfg.MinMatchLength)
+			i18n.Printf("  Max Memory: %d MB\n", cfg.MaxMemoryMB)
+			i18n.Printf("  Auto Tune: %t\n", cfg.AutoTune)
+			i18n.Printf("  Max Workers: %d\n", cfg.MaxWorkers)
+			i18n.Printf("  Enable FFT: %t\n", cfg.EnableFFT)
+			i18n.Printf("  FFT Precision: %s\n", cfg.FFTPrecision)
+			i18n.Printf("  Align Strategy: %s\n", cfg.AlignStrategy)
+			i18n.Printf("  Align Samples: %d x %d bytes\n", cfg.AlignSamples, cfg.AlignSampleSize)
+			i18n.Printf("  Correlation Backend: %s\n", cfg.CorrelationBackend)
+			i18n.Printf("  Use Parallel: %t\n", cfg.UseParallel)
+			i18n.Printf("  Show Progress: %t (%s)\n", cfg.ShowProgress, cfg.ProgressFormat)
+			i18n.Printf("  Log Level: %s\n", cfg.LogLevel)
+			i18n.Printf("  Repo Dir: %s\n", cfg.RepoDir)
+			i18n.Printf("  Repo Snapshot Interval: %d\n", cfg.RepoSnapshotInterval)
+			i18n.Printf("  Repo Chunking: %t\n", cfg.RepoChunking)
+			i18n.Printf("  Hash Algorithm: %s\n", cfg.HashAlgorithm)
+			i18n.Printf("  Language: %s\n", i18n.Language())
+			i18n.Printf("  Durable Writes (fsync): %t\n", cfg.IO.Fsync)
+			i18n.Printf("  Audit: enabled=%t path=%s syslog=%t\n", cfg.Audit.Enabled, cfg.AuditPath(), cfg.Audit.Syslog)
+			i18n.Printf("  Log File Rotation: %d MB, %d days, %d backups, compress=%t\n",
+				cfg.LogFile.MaxSizeMB, cfg.LogFile.MaxAgeDays, cfg.LogFile.MaxBackups, cfg.LogFile.Compress)
+			i18n.Printf("  Apply Limits: output=%d MB op=%d MB ops=%d (0 = unlimited)\n",
+				cfg.Limits.MaxOutputMB, cfg.Limits.MaxOpMB, cfg.Limits.MaxOps)
+			i18n.Printf("  Backups: original=%t keep=%d max_age_days=%d\n", cfg.BackupOriginal, cfg.Backup.Keep, cfg.Backup.MaxAgeDays)
+			for _, p := range cfg.Profiles {
+				i18n.Printf("  Profile %s: strategy=%s block_size=%d min_match_length=%d align=%s auto_tune=%t\n",
+					p.Match, p.Strategy, p.BlockSize, p.MinMatchLength, p.AlignStrategy, p.AutoTune)
+			}
 			return nil
 		},
+	}
+	show.Flags().BoolVar(&showOrigin, "origin", false, "Show every effective setting and where it came from (default, config file, env or flag)")
+	cmd.AddCommand(show)
+
+	// 导出 JSON Schema，供编辑器补全与 CI 校验。schema 与 validate 不使用有效配置，
+	// 跳过 initializeApp：当前目录的配置文件无效时也能运行，标准输出中也没有日志
+	noInit := func(cmd *cobra.Command, args []string) error { return nil }
+	cmd.AddCommand(&cobra.Command{
+		Use:               "schema",
+		Short:             "Print the JSON Schema of the configuration file",
+		Args:              cobra.NoArgs,
+		PersistentPreRunE: noInit,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(config.JSONSchema())
+		},
+	})
+
+	// 校验配置文件：未知键与无效取值
+	cmd.AddCommand(&cobra.Command{
+		Use:               "validate FILE",
+		Short:             "Check a configuration file for unknown keys and invalid values",
+		Args:              cobra.ExactArgs(1),
+		PersistentPreRunE: noInit,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := config.ValidateFile(args[0])
+			if err == nil {
+				fmt.Printf("%s: ok\n", args[0])
+				return nil
+			}
+			problems := config.FieldErrors(err)
+			if len(problems) == 0 {
+				return err
+			}
+			for _, p := range problems {
+				fmt.Printf("%s: %s\n", args[0], p.Message)
+			}
+			return fmt.Errorf("%s: %d problem(s) found", args[0], len(problems))
+		},
 	})
 
 	return cmd
 }
 
+// printConfigOrigins 按键名输出每个配置项的有效值及其来源
+func printConfigOrigins() {
+	settings := cfg.Settings()
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("%s = %v (%s)\n", k, settings[k], origins[k])
+	}
+}
+
 // createBenchmarkCommand 创建基准测试命令
 func createBenchmarkCommand() *cobra.Command {
 	return &cobra.Command{
@@ -205,13 +364,13 @@ func createVersionCommand() *cobra.Command {
 		Use:   "version",
 		Short: "Show version information",
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("BindDiff v2.0 - Enhanced Binary Diff Tool")
-			fmt.Println("Features:")
-			fmt.Println("  - FFT-based alignment optimization")
-			fmt.Println("  - Parallel processing support")
-			fmt.Println("  - Advanced hash-based matching")
-			fmt.Println("  - Progress tracking and logging")
-			fmt.Println("  - Configurable compression")
+			i18n.Println("BindDiff v2.0 - Enhanced Binary Diff Tool")
+			i18n.Println("Features:")
+			i18n.Println("  - FFT-based alignment optimization")
+			i18n.Println("  - Parallel processing support")
+			i18n.Println("  - Advanced hash-based matching")
+			i18n.Println("  - Progress tracking and logging")
+			i18n.Println("  - Configurable compression")
 		},
 	}
 }
@@ -0,0 +1,276 @@
+// Package audit 把每次补丁应用记录到只追加的审计文件（JSON Lines）。每条记录包含上一条记录的哈希，
+// 删除、修改或重排记录都会使 Verify 失败，为受监管环境提供防篡改的二进制修改记录
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+// 操作类型
+const (
+	OperationApply = "apply"
+)
+
+// 操作结果
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// DefaultFileName 仓库目录下审计文件的默认文件名
+const DefaultFileName = "audit.log"
+
+// ErrTampered 审计文件的哈希链不完整
+var ErrTampered = errors.New("audit log has been tampered with")
+
+// Entry 一条审计记录。哈希均为文件内容的 SHA-256（十六进制），文件不可读时为空
+type Entry struct {
+	// Seq 从 1 开始的序号
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Host      string    `json:"host,omitempty"`
+	Operation string    `json:"operation"`
+	// OperationID 本次操作的 ID，与日志中的 op_id 相同
+	OperationID string `json:"op_id,omitempty"`
+	// Source、Patch、Result 为绝对路径；原地更新时 Source 与 Result 相同，SourceHash 为更新前的内容
+	Source     string `json:"source"`
+	SourceHash string `json:"source_hash,omitempty"`
+	Patch      string `json:"patch"`
+	PatchHash  string `json:"patch_hash,omitempty"`
+	Result     string `json:"result,omitempty"`
+	ResultHash string `json:"result_hash,omitempty"`
+	Outcome    string `json:"outcome"`
+	Error      string `json:"error,omitempty"`
+	// Prev 上一条记录的 Hash，第一条为空
+	Prev string `json:"prev,omitempty"`
+	// Hash 本条记录（Hash 字段为空时的 JSON 编码）的 SHA-256
+	Hash string `json:"hash"`
+}
+
+// digest 计算记录的哈希
+func (e Entry) digest() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log 一个审计文件
+type Log struct {
+	path   string
+	syslog io.WriteCloser
+}
+
+// New 返回写入 path 的审计日志，目录不存在时在第一次追加时创建
+func New(path string) *Log {
+	return &Log{path: path}
+}
+
+// Path 返回审计文件路径
+func (l *Log) Path() string {
+	return l.path
+}
+
+// EnableSyslog 每条记录同时以一行 JSON 发送到本机 syslog，平台不支持时返回错误
+func (l *Log) EnableSyslog() error {
+	w, err := openSyslog()
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	l.syslog = w
+	return nil
+}
+
+// Close 关闭 syslog 连接
+func (l *Log) Close() error {
+	if l.syslog == nil {
+		return nil
+	}
+	err := l.syslog.Close()
+	l.syslog = nil
+	return err
+}
+
+// Append 填写 e 的序号、时间（为零时）、用户（为空时）与哈希链后追加到审计文件并刷盘。
+// 追加期间持有文件锁，多个进程同时应用补丁时记录依次串联
+func (l *Log) Append(e *Entry) error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create audit directory: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+	if err := lockFileHandle(f); err != nil {
+		return fmt.Errorf("failed to lock audit log: %w", err)
+	}
+	defer unlockFile(f)
+
+	last, err := lastEntry(f)
+	if err != nil {
+		return err
+	}
+	if last != nil {
+		e.Seq, e.Prev = last.Seq+1, last.Hash
+	} else {
+		e.Seq, e.Prev = 1, ""
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC().Round(0)
+	if e.User == "" {
+		e.User = CurrentUser()
+	}
+	if e.Host == "" {
+		e.Host, _ = os.Hostname()
+	}
+	if e.Hash, err = e.digest(); err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+
+	if l.syslog != nil {
+		if _, err := l.syslog.Write(line); err != nil {
+			return fmt.Errorf("failed to write audit entry to syslog: %w", err)
+		}
+	}
+	return nil
+}
+
+// lastEntry 读取文件最后一条记录，文件为空时返回 nil
+func lastEntry(f *os.File) (*Entry, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat audit log: %w", err)
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil, nil
+	}
+
+	// 从末尾向前读，直到包含完整的最后一行
+	var tail []byte
+	for chunk := int64(4096); ; chunk *= 2 {
+		off := max(size-chunk, 0)
+		tail = make([]byte, size-off)
+		if _, err := f.ReadAt(tail, off); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+		trimmed := bytes.TrimRight(tail, "\n")
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 || off == 0 {
+			tail = trimmed[i+1:]
+			break
+		}
+	}
+
+	var e Entry
+	if err := json.Unmarshal(tail, &e); err != nil {
+		return nil, fmt.Errorf("%w: last entry is not valid JSON: %v", ErrTampered, err)
+	}
+	return &e, nil
+}
+
+// Read 读取审计文件中的全部记录，文件不存在时返回空列表
+func Read(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%w: line %d is not valid JSON: %v", ErrTampered, line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// Verify 检查记录的序号连续、每条记录的哈希正确且指向上一条记录，
+// 发现问题时返回包装 ErrTampered 的错误，指出第一条有问题的记录
+func Verify(entries []Entry) error {
+	prev := ""
+	for i, e := range entries {
+		if e.Seq != uint64(i)+1 {
+			return fmt.Errorf("%w: entry %d has sequence number %d", ErrTampered, i+1, e.Seq)
+		}
+		if e.Prev != prev {
+			return fmt.Errorf("%w: entry %d does not follow entry %d", ErrTampered, e.Seq, e.Seq-1)
+		}
+		digest, err := e.digest()
+		if err != nil {
+			return err
+		}
+		if digest != e.Hash {
+			return fmt.Errorf("%w: entry %d has been modified", ErrTampered, e.Seq)
+		}
+		prev = e.Hash
+	}
+	return nil
+}
+
+// HashFile 返回文件内容的 SHA-256（十六进制）
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CurrentUser 返回当前用户名，无法获取时使用 USER 或 USERNAME 环境变量
+func CurrentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
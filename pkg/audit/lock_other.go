@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package audit
+
+import "os"
+
+// lockFileHandle 平台不支持文件锁，同时追加的进程可能使哈希链分叉
+func lockFileHandle(f *os.File) error {
+	return nil
+}
+
+// unlockFile 平台不支持文件锁
+func unlockFile(f *os.File) error {
+	return nil
+}
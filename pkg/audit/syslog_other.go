@@ -0,0 +1,13 @@
+//go:build !unix
+
+package audit
+
+import (
+	"errors"
+	"io"
+)
+
+// openSyslog 平台没有 syslog
+func openSyslog() (io.WriteCloser, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
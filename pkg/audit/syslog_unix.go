@@ -0,0 +1,13 @@
+//go:build unix
+
+package audit
+
+import (
+	"io"
+	"log/syslog"
+)
+
+// openSyslog 连接本机 syslog（LOG_AUTH 设施，标签 bindiff）
+func openSyslog() (io.WriteCloser, error) {
+	return syslog.New(syslog.LOG_AUTH|syslog.LOG_INFO, "bindiff")
+}
@@ -0,0 +1,496 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bindiff/core"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// stagingPrefix 目标目录中暂存区的名称前缀
+const stagingPrefix = ".bindiff-staging-"
+
+// Read 读取增量包，返回清单与补丁文件
+func Read(r io.Reader) (*Manifest, map[string][]byte, error) {
+	files := make(map[string][]byte)
+	var manifest *Manifest
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+		if manifest != nil {
+			return nil, nil, fmt.Errorf("%w: unexpected entry %s after manifest", ErrInvalidBundle, hdr.Name)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+		if name := path.Clean(hdr.Name); name == ManifestName {
+			manifest = &Manifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return nil, nil, fmt.Errorf("%w: bad manifest: %v", ErrInvalidBundle, err)
+			}
+		} else {
+			files[name] = data
+		}
+	}
+
+	switch {
+	case manifest == nil:
+		return nil, nil, fmt.Errorf("%w: missing manifest (truncated bundle?)", ErrInvalidBundle)
+	case manifest.Version != manifestVersion:
+		return nil, nil, fmt.Errorf("%w: unsupported manifest version %d", ErrInvalidBundle, manifest.Version)
+	}
+	if err := manifest.validate(files); err != nil {
+		return nil, nil, err
+	}
+	return manifest, files, nil
+}
+
+// validate 检查清单中的路径、类型、补丁与硬链接引用，拒绝越出目标目录的路径，
+// 包括位于清单中符号链接之下的路径
+func (m *Manifest) validate(files map[string][]byte) error {
+	entries := make(map[string]*FileEntry, len(m.Files))
+	for i := range m.Files {
+		f := &m.Files[i]
+		if !fs.ValidPath(f.Path) || f.Path == "." || entries[f.Path] != nil {
+			return fmt.Errorf("%w: invalid or duplicate path %q", ErrInvalidBundle, f.Path)
+		}
+		entries[f.Path] = f
+		if f.Type != "" && f.Type != TypeSymlink && f.Type != TypeDir {
+			return fmt.Errorf("%w: %s: unknown type %q", ErrInvalidBundle, f.Path, f.Type)
+		}
+		switch f.Kind {
+		case KindUnchanged, KindRemoved:
+		case KindRenamed:
+			if f.Type != "" || !fs.ValidPath(f.OldPath) || f.OldPath == "." {
+				return fmt.Errorf("%w: invalid old path %q", ErrInvalidBundle, f.OldPath)
+			}
+			fallthrough
+		case KindAdded, KindModified:
+			if _, ok := files[f.Patch]; !ok && f.Type == "" && f.Link == "" {
+				return fmt.Errorf("%w: %s: missing patch %q", ErrInvalidBundle, f.Path, f.Patch)
+			}
+		default:
+			return fmt.Errorf("%w: %s: unknown kind %q", ErrInvalidBundle, f.Path, f.Kind)
+		}
+	}
+
+	// 符号链接之下的条目在应用时会跟随链接写到目标目录之外
+	for _, f := range m.Files {
+		for parent := path.Dir(f.Path); parent != "."; parent = path.Dir(parent) {
+			if e := entries[parent]; e != nil && e.Type == TypeSymlink {
+				return fmt.Errorf("%w: %s is under the symbolic link %s", ErrInvalidBundle, f.Path, parent)
+			}
+		}
+	}
+
+	// 硬链接指向同一清单中内容相同、自身不是链接的普通文件
+	for _, f := range m.Files {
+		if f.Link == "" {
+			continue
+		}
+		primary := entries[f.Link]
+		if f.Type != "" || f.Kind == KindRemoved || primary == nil || primary.Type != "" ||
+			primary.Kind == KindRemoved || primary.Link != "" || primary.Hash != f.Hash {
+			return fmt.Errorf("%w: %s: invalid hard link to %q", ErrInvalidBundle, f.Path, f.Link)
+		}
+	}
+	return nil
+}
+
+// Apply 将增量包原地应用到目录 dir，整体成功或整体失败：
+// 所有新文件先在 dir 内的暂存区生成并按清单摘要校验，全部通过后逐个以原子重命名替换，
+// 随后创建硬链接、删除不再需要的目录并设置目录权限；
+// 替换过程中出错时，已完成的修改按相反顺序全部撤销。
+// 生成增量包时的旧条目与 dir 中的不一致时返回 ErrBaseMismatch，目录保持不变
+func Apply(dir string, r io.Reader, options *core.ApplyOptions) (*Manifest, error) {
+	manifest, files, err := Read(r)
+	if err != nil {
+		return nil, err
+	}
+
+	staging, err := os.MkdirTemp(dir, stagingPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging area: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	tx := &transaction{dir: dir, staging: staging}
+	if err := tx.stage(manifest, files, options); err != nil {
+		return nil, err
+	}
+	if err := tx.commit(); err != nil {
+		if rerr := tx.rollback(); rerr != nil {
+			return nil, fmt.Errorf("%w (rollback failed: %v)", err, rerr)
+		}
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// transaction 一次目录更新：按顺序执行的修改，以及提交过程中已完成修改的撤销函数。
+// 不使用 utils.Transaction：后者只暂存普通文件的内容，不能表示符号链接、硬链接、
+// 目录删除与权限、空洞，这些修改需要与文件替换在同一次撤销中回滚
+type transaction struct {
+	dir     string
+	staging string
+	ops     []fileOp
+	undo    []func() error
+}
+
+// opKind 对目标目录的一种修改
+type opKind int
+
+const (
+	opReplace   opKind = iota // 以暂存文件替换，staged 为空时删除
+	opSymlink                 // 以符号链接替换
+	opLink                    // 以指向 source 的硬链接替换
+	opRemoveDir               // 删除空目录
+	opChmod                   // 设置目录权限
+)
+
+// fileOp 对目标目录中一个路径的修改
+type fileOp struct {
+	kind   opKind
+	path   string
+	staged string
+	// source 符号链接的目标或硬链接指向的清单路径
+	source string
+	mode   fs.FileMode
+}
+
+// stage 校验目录中的旧条目，在暂存区生成所有新文件并校验摘要，按提交顺序排列修改：
+// 文件与符号链接、硬链接、删除目录（由深到浅）、目录权限
+func (tx *transaction) stage(manifest *Manifest, files map[string][]byte, options *core.ApplyOptions) error {
+	written := make(map[string]bool, len(manifest.Files))
+	for _, f := range manifest.Files {
+		if f.Kind != KindRemoved {
+			written[f.Path] = true
+		}
+	}
+
+	var links, dirs []fileOp
+	for i, f := range manifest.Files {
+		target := tx.target(f.Path)
+		if err := tx.checkParents(f.Path); err != nil {
+			return err
+		}
+		var oldData []byte
+		if f.Kind != KindAdded && f.OldHash != "" {
+			source := f.Path
+			if f.Kind == KindRenamed {
+				source = f.OldPath
+			}
+			if err := tx.checkParents(source); err != nil {
+				return err
+			}
+			var err error
+			if oldData, err = readEntry(tx.target(source)); err != nil {
+				return fmt.Errorf("%w: %s: %v", ErrBaseMismatch, source, err)
+			}
+			if Digest(oldData) != f.OldHash {
+				return fmt.Errorf("%w: %s has been modified", ErrBaseMismatch, source)
+			}
+		}
+
+		switch {
+		case f.Kind == KindRemoved && f.Type == TypeDir:
+			dirs = append(dirs, fileOp{kind: opRemoveDir, path: f.Path})
+			continue
+		case f.Kind == KindRemoved:
+			tx.ops = append(tx.ops, fileOp{path: f.Path})
+			continue
+		case f.Type == TypeDir:
+			dirs = append(dirs, fileOp{kind: opChmod, path: f.Path, mode: f.Mode})
+			continue
+		case f.Type == TypeSymlink:
+			if Digest([]byte(f.Target)) != f.Hash {
+				return fmt.Errorf("%w: %s does not match the manifest", ErrInvalidBundle, f.Path)
+			}
+			if current, err := os.Readlink(target); err != nil || current != f.Target {
+				tx.ops = append(tx.ops, fileOp{kind: opSymlink, path: f.Path, source: f.Target})
+			}
+			continue
+		case f.Link != "":
+			links = append(links, fileOp{kind: opLink, path: f.Path, source: f.Link})
+			continue
+		}
+		if f.Kind == KindRenamed && !written[f.OldPath] {
+			tx.ops = append(tx.ops, fileOp{path: f.OldPath})
+		}
+
+		newData := oldData
+		if f.Patch != "" {
+			df, err := core.DecodeDiffFile(files[f.Patch])
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.Path, err)
+			}
+			if newData, err = core.ApplyDiffFile(oldData, df, options); err != nil {
+				return fmt.Errorf("%s: %w", f.Path, err)
+			}
+		}
+		if int64(len(newData)) != f.Size || Digest(newData) != f.Hash {
+			return fmt.Errorf("%w: %s does not match the manifest", ErrInvalidBundle, f.Path)
+		}
+		if err := validateHoles(f.Holes, newData); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidBundle, f.Path, err)
+		}
+
+		// 内容、类型与权限都未变化的文件不需要替换
+		if f.Kind == KindUnchanged && sameFile(target, f) {
+			continue
+		}
+		staged := filepath.Join(tx.staging, fmt.Sprintf("new-%06d", i))
+		if err := writeStaged(staged, newData, f.Holes, f.Mode); err != nil {
+			return fmt.Errorf("failed to stage %s: %w", f.Path, err)
+		}
+		tx.ops = append(tx.ops, fileOp{path: f.Path, staged: staged})
+	}
+
+	// 指向未被替换的文件且已经是同一文件的硬链接不需要重建
+	replaced := make(map[string]bool, len(tx.ops))
+	for _, op := range tx.ops {
+		replaced[op.path] = true
+	}
+	for _, op := range links {
+		if !replaced[op.source] && sameInode(tx.target(op.path), tx.target(op.source)) {
+			continue
+		}
+		tx.ops = append(tx.ops, op)
+	}
+
+	// 目录删除由深到浅，权限最后设置，避免只读目录阻止其中文件的替换
+	sort.SliceStable(dirs, func(i, j int) bool {
+		if dirs[i].kind != dirs[j].kind {
+			return dirs[i].kind < dirs[j].kind
+		}
+		if dirs[i].kind == opRemoveDir {
+			return dirs[i].path > dirs[j].path
+		}
+		return false
+	})
+	tx.ops = append(tx.ops, dirs...)
+	return nil
+}
+
+// readEntry 读取旧条目用于校验：符号链接返回其目标，不跟随链接
+func readEntry(p string) ([]byte, error) {
+	info, err := os.Lstat(p)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(p)
+		return []byte(target), err
+	}
+	return os.ReadFile(p)
+}
+
+// sameFile 判断目标位置是否已是权限与空洞都与清单一致的普通文件（内容已校验）
+func sameFile(target string, f FileEntry) bool {
+	info, err := os.Lstat(target)
+	if err != nil || !info.Mode().IsRegular() || info.Mode()&modeMask != f.Mode {
+		return false
+	}
+	file, err := os.Open(target)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	current := fileHoles(file, info.Size())
+	if len(current) != len(f.Holes) {
+		return false
+	}
+	for i := range current {
+		if current[i] != f.Holes[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sameInode 判断两个路径是否为同一文件的硬链接
+func sameInode(a, b string) bool {
+	ia, err := os.Lstat(a)
+	if err != nil {
+		return false
+	}
+	ib, err := os.Lstat(b)
+	return err == nil && os.SameFile(ia, ib)
+}
+
+// writeStaged 写出暂存文件：空洞范围不写入，最后截断到完整长度并设置权限
+func writeStaged(p string, data []byte, holes []Extent, mode fs.FileMode) error {
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	var pos int64
+	for _, h := range holes {
+		if _, err := f.WriteAt(data[pos:h.Offset], pos); err != nil {
+			f.Close()
+			return err
+		}
+		pos = h.Offset + h.Length
+	}
+	if _, err := f.WriteAt(data[pos:], pos); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Truncate(int64(len(data))); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// 在 Close 之后设置，setuid/setgid 不会因写入被清除
+	return os.Chmod(p, mode)
+}
+
+// commit 按顺序执行所有修改，每完成一步记录对应的撤销函数；
+// 每一步之前重新检查上级目录，之前的步骤创建的符号链接同样不能被跟随
+func (tx *transaction) commit() error {
+	for i, op := range tx.ops {
+		target := tx.target(op.path)
+		err := tx.checkParents(op.path)
+		if err == nil && op.kind == opLink {
+			err = tx.checkParents(op.source)
+		}
+		if err != nil {
+			return err
+		}
+		switch op.kind {
+		case opRemoveDir:
+			err = tx.removeDir(target)
+		case opChmod:
+			err = tx.chmodDir(target, op.mode)
+		default:
+			err = tx.replace(i, op, target)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", op.path, err)
+		}
+	}
+	return nil
+}
+
+// replace 将原条目移入暂存区，再放入新文件、符号链接或硬链接
+func (tx *transaction) replace(i int, op fileOp, target string) error {
+	if _, err := os.Lstat(target); err == nil {
+		backup := filepath.Join(tx.staging, fmt.Sprintf("old-%06d", i))
+		if err := os.Rename(target, backup); err != nil {
+			return err
+		}
+		tx.undo = append(tx.undo, func() error { return os.Rename(backup, target) })
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if op.kind == opReplace && op.staged == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	var err error
+	switch op.kind {
+	case opSymlink:
+		err = os.Symlink(op.source, target)
+	case opLink:
+		err = os.Link(tx.target(op.source), target)
+	default:
+		err = os.Rename(op.staged, target)
+	}
+	if err != nil {
+		return err
+	}
+	tx.undo = append(tx.undo, func() error { return os.Remove(target) })
+	return nil
+}
+
+// removeDir 删除目录，目录中还有清单之外的条目时保留
+func (tx *transaction) removeDir(target string) error {
+	info, err := os.Lstat(target)
+	if err != nil || !info.IsDir() {
+		return nil
+	}
+	if err := os.Remove(target); err != nil {
+		return nil
+	}
+	tx.undo = append(tx.undo, func() error { return os.Mkdir(target, info.Mode().Perm()) })
+	return nil
+}
+
+// chmodDir 创建缺失的目录并设置权限
+func (tx *transaction) chmodDir(target string, mode fs.FileMode) error {
+	info, err := os.Lstat(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		if err := os.Mkdir(target, 0700); err != nil {
+			return err
+		}
+		tx.undo = append(tx.undo, func() error { return os.Remove(target) })
+	} else if err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("not a directory")
+	} else if info.Mode()&modeMask == mode {
+		return nil
+	} else {
+		old := info.Mode() & modeMask
+		tx.undo = append(tx.undo, func() error { return os.Chmod(target, old) })
+	}
+	return os.Chmod(target, mode)
+}
+
+// rollback 逆序撤销已完成的修改，恢复原条目
+func (tx *transaction) rollback() error {
+	var errs []error
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		if err := tx.undo[i](); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkParents 由浅到深检查清单路径 p 在目标目录中的上级目录，任何一级是符号链接时返回 ErrUnsafePath；
+// 包括目标目录中原有的符号链接
+func (tx *transaction) checkParents(p string) error {
+	var parents []string
+	for parent := path.Dir(p); parent != "."; parent = path.Dir(parent) {
+		parents = append(parents, parent)
+	}
+	for i := len(parents) - 1; i >= 0; i-- {
+		info, err := os.Lstat(tx.target(parents[i]))
+		if errors.Is(err, fs.ErrNotExist) {
+			// 更深的目录也不存在，提交时创建
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %s is under the symbolic link %s", ErrUnsafePath, p, parents[i])
+		}
+	}
+	return nil
+}
+
+// target 返回清单路径在目标目录中的位置
+func (tx *transaction) target(p string) string {
+	return filepath.Join(tx.dir, filepath.FromSlash(p))
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package bundle
+
+import "io/fs"
+
+// fileID 平台不提供 inode，硬链接按独立文件记录
+func fileID(info fs.FileInfo) ([2]uint64, bool) {
+	return [2]uint64{}, false
+}
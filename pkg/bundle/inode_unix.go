@@ -0,0 +1,17 @@
+//go:build unix
+
+package bundle
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileID 返回硬链接数大于 1 的文件的 (设备, inode)
+func fileID(info fs.FileInfo) ([2]uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink <= 1 {
+		return [2]uint64{}, false
+	}
+	return [2]uint64{uint64(st.Dev), uint64(st.Ino)}, true
+}
@@ -0,0 +1,250 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bindiff/core"
+	"bindiff/types"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"time"
+)
+
+// 增量包中的条目名称，清单最后写入，缺失时说明增量包被截断
+const (
+	ManifestName = "manifest.json"
+	patchDir     = "patches/"
+)
+
+// manifestVersion 清单格式版本
+const manifestVersion = 1
+
+// 清单中文件的变化类型
+const (
+	KindUnchanged = "unchanged"
+	KindAdded     = "added"
+	KindRemoved   = "removed"
+	KindModified  = "modified"
+	KindRenamed   = "renamed"
+)
+
+// ErrInvalidBundle 增量包不完整或已损坏
+var ErrInvalidBundle = errors.New("invalid directory bundle")
+
+// ErrBaseMismatch 目标目录中的文件与生成增量包时的旧目录不一致
+var ErrBaseMismatch = errors.New("directory does not match the bundle base")
+
+// ErrUnsafePath 目标目录中的路径经过符号链接，写入会越出目标目录
+var ErrUnsafePath = errors.New("path leaves the target directory")
+
+// Manifest 目录增量包清单：新目录的完整文件列表以及每个文件的还原方式
+type Manifest struct {
+	Version int         `json:"version"`
+	Files   []FileEntry `json:"files"`
+	Created int64       `json:"created"`
+}
+
+// FileEntry 清单中的一个条目（普通文件、符号链接或目录），Path 使用 '/' 分隔
+type FileEntry struct {
+	Path string `json:"path"`
+	// OldPath Kind 为 KindRenamed 时的原路径，补丁以原文件为基
+	OldPath string `json:"old_path,omitempty"`
+	Kind    string `json:"kind"`
+	// Type 条目类型：普通文件为空，或 TypeSymlink、TypeDir
+	Type string `json:"type,omitempty"`
+	// Mode 新条目的权限位（含 setuid、setgid、sticky），KindRemoved 与符号链接为 0
+	Mode fs.FileMode `json:"mode,omitempty"`
+	Size int64       `json:"size"`
+	// Hash 新文件内容（符号链接为目标）的摘要，OldHash 作为基的旧条目的摘要，均为 "sha256:<hex>"
+	Hash    string `json:"hash,omitempty"`
+	OldHash string `json:"old_hash,omitempty"`
+	// Patch 增量包中补丁文件（.bdf）的条目名称，新增文件以空文件为基
+	Patch string `json:"patch,omitempty"`
+	// Target 符号链接的目标，原样记录，不跟随链接
+	Target string `json:"target,omitempty"`
+	// Link 与清单中另一普通文件属于同一硬链接组时为该文件的路径，应用时创建硬链接而不是复制
+	Link string `json:"link,omitempty"`
+	// Holes 稀疏文件中的空洞，应用时不写入这些范围
+	Holes []Extent `json:"holes,omitempty"`
+}
+
+// Digest 计算数据的 sha256 摘要
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// kindNames 目录差分结果到清单类型的映射
+var kindNames = map[types.FileChangeKind]string{
+	types.FILE_UNCHANGED: KindUnchanged,
+	types.FILE_ADDED:     KindAdded,
+	types.FILE_REMOVED:   KindRemoved,
+	types.FILE_MODIFIED:  KindModified,
+	types.FILE_RENAMED:   KindRenamed,
+}
+
+// Diff 比较两个目录并将增量包写入 w：每个新增、修改或重命名的普通文件对应一个补丁文件，
+// 清单记录新目录所有条目的权限与摘要、符号链接目标、硬链接组、稀疏空洞以及删除的条目，最后写入。
+// 符号链接不被跟随；硬链接组内只有第一个文件携带补丁。每个文件按匹配的配置档
+// （Config.Profiles 与 config.DefaultProfiles）选择差分方式与参数
+func Diff(oldFS, newFS fs.FS, w io.Writer, options *core.DiffOptions) (*Manifest, error) {
+	diffs, err := core.DiffFS(oldFS, newFS, options)
+	if err != nil {
+		return nil, err
+	}
+	oldTree, err := scanTree(oldFS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan old directory: %w", err)
+	}
+	newTree, err := scanTree(newFS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan new directory: %w", err)
+	}
+	links := hardlinks(newTree)
+
+	manifest := &Manifest{Version: manifestVersion, Created: time.Now().Unix()}
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	for i, fd := range diffs {
+		// 普通文件变为符号链接或目录，由下面的非普通条目记录
+		if n := newTree[fd.Path]; fd.Kind == types.FILE_REMOVED && n != nil && n.typ != "" {
+			continue
+		}
+		entry := FileEntry{Path: fd.Path, OldPath: fd.OldPath, Kind: kindNames[fd.Kind]}
+
+		var oldData, newData []byte
+		if fd.Kind != types.FILE_ADDED {
+			source := fd.Path
+			if fd.Kind == types.FILE_RENAMED {
+				source = fd.OldPath
+			}
+			if oldData, err = fs.ReadFile(oldFS, source); err != nil {
+				return nil, fmt.Errorf("failed to read old file %s: %w", source, err)
+			}
+			entry.OldHash = Digest(oldData)
+		}
+		if fd.Kind != types.FILE_REMOVED {
+			if newData, err = fs.ReadFile(newFS, fd.Path); err != nil {
+				return nil, fmt.Errorf("failed to read new file %s: %w", fd.Path, err)
+			}
+			n := newTree[fd.Path]
+			entry.Mode = n.mode
+			entry.Holes = n.holes
+			entry.Size = int64(len(newData))
+			entry.Hash = Digest(newData)
+			entry.Link = links[fd.Path]
+		}
+
+		if entry.Link == "" && (fd.Kind == types.FILE_ADDED || fd.Kind == types.FILE_MODIFIED || fd.Kind == types.FILE_RENAMED) {
+			detect := oldData
+			if len(detect) == 0 {
+				detect = newData
+			}
+			data, err := core.CreatePatchFile(oldData, newData, core.WithProfile(options, fd.Path, detect))
+			if err != nil {
+				return nil, fmt.Errorf("failed to diff %s: %w", fd.Path, err)
+			}
+			entry.Patch = fmt.Sprintf("%s%06d.bdf", patchDir, i)
+			if err := writeEntry(tw, entry.Patch, data, now); err != nil {
+				return nil, err
+			}
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	special, err := specialEntries(oldFS, oldTree, newTree)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Files = append(manifest.Files, special...)
+	sort.SliceStable(manifest.Files, func(i, j int) bool { return manifest.Files[i].Path < manifest.Files[j].Path })
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEntry(tw, ManifestName, data, now); err != nil {
+		return nil, err
+	}
+	return manifest, tw.Close()
+}
+
+// specialEntries 生成符号链接与目录的清单条目，包括被删除或被普通文件取代的旧条目
+func specialEntries(oldFS fs.FS, oldTree, newTree map[string]*node) ([]FileEntry, error) {
+	var entries []FileEntry
+	for p, n := range newTree {
+		if n.typ == "" {
+			continue
+		}
+		entry := FileEntry{Path: p, Kind: KindAdded, Type: n.typ}
+		if n.typ == TypeSymlink {
+			entry.Target = n.target
+			entry.Size = int64(len(n.target))
+			entry.Hash = Digest([]byte(n.target))
+		} else {
+			entry.Mode = n.mode
+		}
+		if o := oldTree[p]; o != nil {
+			oldHash, err := nodeDigest(oldFS, p, o)
+			if err != nil {
+				return nil, err
+			}
+			entry.OldHash = oldHash
+			entry.Kind = KindModified
+			if o.typ == n.typ && o.target == n.target {
+				entry.Kind = KindUnchanged
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	// 旧目录中的符号链接与目录在新目录中不存在，且没有被普通文件取代
+	for p, o := range oldTree {
+		if o.typ == "" || newTree[p] != nil {
+			continue
+		}
+		oldHash, err := nodeDigest(oldFS, p, o)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, FileEntry{Path: p, Kind: KindRemoved, Type: o.typ, OldHash: oldHash})
+	}
+	return entries, nil
+}
+
+// nodeDigest 计算旧条目的摘要：普通文件为内容，符号链接为目标，目录没有摘要
+func nodeDigest(fsys fs.FS, p string, n *node) (string, error) {
+	switch n.typ {
+	case TypeDir:
+		return "", nil
+	case TypeSymlink:
+		return Digest([]byte(n.target)), nil
+	}
+	data, err := fs.ReadFile(fsys, p)
+	if err != nil {
+		return "", fmt.Errorf("failed to read old file %s: %w", p, err)
+	}
+	return Digest(data), nil
+}
+
+// writeEntry 写入一个常规文件条目
+func writeEntry(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write bundle entry %s: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write bundle entry %s: %w", name, err)
+	}
+	return nil
+}
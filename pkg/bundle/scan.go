@@ -0,0 +1,131 @@
+package bundle
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+// 清单条目类型，普通文件的 Type 为空
+const (
+	TypeSymlink = "symlink"
+	TypeDir     = "dir"
+)
+
+// modeMask 清单记录的权限位：rwx 以及 setuid、setgid、sticky
+const modeMask = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+
+// Extent 文件中的一段字节范围
+type Extent struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// readLinkFS 可以读取符号链接目标的文件系统（os.DirFS、fstest.MapFS 等）
+type readLinkFS interface {
+	ReadLink(name string) (string, error)
+}
+
+// node 目录树中的一个条目，不跟随符号链接
+type node struct {
+	typ    string
+	mode   fs.FileMode
+	target string
+	// id 硬链接数大于 1 的普通文件的 (设备, inode)
+	id     [2]uint64
+	linked bool
+	holes  []Extent
+}
+
+// scanTree 遍历文件系统，记录所有条目的类型、权限、链接目标、硬链接与稀疏空洞。
+// 根目录本身不记录，设备文件等其他类型忽略
+func scanTree(fsys fs.FS) (map[string]*node, error) {
+	nodes := make(map[string]*node)
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == "." {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		n := &node{mode: info.Mode() & modeMask}
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			rl, ok := fsys.(readLinkFS)
+			if !ok {
+				return fmt.Errorf("symlink %s: file system cannot read links", p)
+			}
+			n.typ = TypeSymlink
+			if n.target, err = rl.ReadLink(p); err != nil {
+				return err
+			}
+		case d.IsDir():
+			n.typ = TypeDir
+		case d.Type().IsRegular():
+			n.id, n.linked = fileID(info)
+			if n.holes, err = holes(fsys, p, info.Size()); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+		nodes[p] = n
+		return nil
+	})
+	return nodes, err
+}
+
+// holes 返回普通文件中的空洞，文件系统不支持时返回 nil
+func holes(fsys fs.FS, p string, size int64) ([]Extent, error) {
+	f, err := fsys.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return fileHoles(f, size), nil
+}
+
+// hardlinks 将新目录中属于同一硬链接组的普通文件映射到组内路径最小的文件
+func hardlinks(nodes map[string]*node) map[string]string {
+	var paths []string
+	for p, n := range nodes {
+		if n.linked {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	primary := make(map[[2]uint64]string)
+	links := make(map[string]string)
+	for _, p := range paths {
+		id := nodes[p].id
+		if first, ok := primary[id]; ok {
+			links[p] = first
+		} else {
+			primary[id] = p
+		}
+	}
+	return links
+}
+
+// validateHoles 检查空洞按偏移排序、互不重叠且位于文件内，并且对应的数据全为零
+func validateHoles(holes []Extent, data []byte) error {
+	var end int64
+	for _, h := range holes {
+		if h.Offset < end || h.Length <= 0 || h.Length > int64(len(data))-h.Offset {
+			return errors.New("invalid hole list")
+		}
+		for _, b := range data[h.Offset : h.Offset+h.Length] {
+			if b != 0 {
+				return errors.New("hole contains data")
+			}
+		}
+		end = h.Offset + h.Length
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package bundle
+
+import (
+	"io/fs"
+	"os"
+)
+
+// lseek 的 whence 取值（linux/fs.h）
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// fileHoles 使用 SEEK_HOLE/SEEK_DATA 查找文件中的空洞，不是磁盘文件时返回 nil
+func fileHoles(f fs.File, size int64) []Extent {
+	osf, ok := f.(*os.File)
+	if !ok {
+		return nil
+	}
+	var holes []Extent
+	for pos := int64(0); pos < size; {
+		hole, err := osf.Seek(pos, seekHole)
+		if err != nil || hole >= size {
+			break
+		}
+		// 空洞之后没有数据时 SEEK_DATA 返回 ENXIO
+		data, err := osf.Seek(hole, seekData)
+		if err != nil || data > size {
+			data = size
+		}
+		holes = append(holes, Extent{Offset: hole, Length: data - hole})
+		pos = data
+	}
+	return holes
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package bundle
+
+import "io/fs"
+
+// fileHoles 非 Linux 平台不检测空洞，文件按完整内容记录
+func fileHoles(f fs.File, size int64) []Extent {
+	return nil
+}
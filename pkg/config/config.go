@@ -1,11 +1,43 @@
 package config
 
 import (
+	"bindiff/pkg/utils"
+	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+)
+
+// FFT 对齐的浮点精度
+const (
+	FFTPrecisionFloat64 = "float64"
+	FFTPrecisionFloat32 = "float32"
+)
+
+// 对齐方式
+const (
+	AlignStrategyFFT     = "fft"
+	AlignStrategyWinnow  = "winnow"
+	AlignStrategySampled = "sampled"
+)
+
+// 互相关计算后端
+const (
+	CorrelationBackendCPU  = "cpu"
+	CorrelationBackendCUDA = "cuda"
+)
 
-	"github.com/spf13/viper"
+// 差分方式：auto 依次尝试各种感知差分，raw 只做原始差分，其余只尝试对应的一种
+const (
+	StrategyAuto    = "auto"
+	StrategyRaw     = "raw"
+	StrategyGzip    = "gzip"
+	StrategySQLite  = "sqlite"
+	StrategyDisk    = "disk"
+	StrategyExec    = "exec"
+	StrategyArchive = "archive"
 )
 
 // Config 应用配置结构
@@ -14,123 +46,323 @@ type Config struct {
 	BlockSize      int `mapstructure:"block_size"`
 	MinMatchLength int `mapstructure:"min_match_length"`
 	MaxMemoryMB    int `mapstructure:"max_memory_mb"`
+	// AutoTune 差分前抽样选择 BlockSize 与 MinMatchLength（见 core.TuneParameters）
+	AutoTune bool `mapstructure:"auto_tune"`
 
 	// 性能配置
 	MaxWorkers  int  `mapstructure:"max_workers"`
 	EnableFFT   bool `mapstructure:"enable_fft"`
 	UseParallel bool `mapstructure:"use_parallel"`
+	// FFTPrecision FFT 对齐的浮点精度：float64 或 float32（缓冲区减半，为空时使用 float64）
+	FFTPrecision string `mapstructure:"fft_precision"`
+	// AlignStrategy 对齐方式（EnableFFT 开启时生效）：fft 为互相关，winnow 为筛选的 k-gram 指纹，
+	// 后者适合含大段压缩等高熵数据的文件；sampled 只对抽样的窗口做相关，适合 GB 级的文件（为空时使用 fft）
+	AlignStrategy string `mapstructure:"align_strategy"`
+	// AlignSamples、AlignSampleSize sampled 对齐的窗口数与窗口大小（字节，0 使用默认的 16 个 64 KB）
+	AlignSamples    int `mapstructure:"align_samples"`
+	AlignSampleSize int `mapstructure:"align_sample_size"`
+	// CorrelationBackend FFT 对齐的互相关后端：cpu，或以 -tags cuda 构建时的 cuda（为空时使用 cpu）
+	CorrelationBackend string `mapstructure:"correlation_backend"`
 
 	// 输出配置
-	ShowProgress bool   `mapstructure:"show_progress"`
-	Verbose      bool   `mapstructure:"verbose"`
-	LogLevel     string `mapstructure:"log_level"`
+	ShowProgress bool `mapstructure:"show_progress"`
+	// ProgressFormat 进度输出格式：bar（标准错误不是终端时不显示）、jsonl 或 none，为空时使用 bar
+	ProgressFormat string `mapstructure:"progress_format"`
+	Verbose        bool   `mapstructure:"verbose"`
+	LogLevel       string `mapstructure:"log_level"`
+	// Lang 命令行输出与日志的语言：en 或 zh，为空时按 LC_ALL、LC_MESSAGES、LANG 检测
+	Lang string `mapstructure:"lang"`
 
 	// 文件配置
 	RepoDir        string `mapstructure:"repo_dir"`
 	TempDir        string `mapstructure:"temp_dir"`
 	BackupOriginal bool   `mapstructure:"backup_original"`
+	// RepoSnapshotInterval 仓库增量链的最大长度，达到后存储完整快照（0 使用默认值）
+	RepoSnapshotInterval int `mapstructure:"repo_snapshot_interval"`
+	// RepoChunking 完整快照按内容定义分块存储，跨文件、跨版本的相同区域只存一份
+	RepoChunking bool `mapstructure:"repo_chunking"`
 
 	// 安全配置
-	VerifyChecksums  bool `mapstructure:"verify_checksums"`
-	CompressionLevel int  `mapstructure:"compression_level"`
+	VerifyChecksums  bool   `mapstructure:"verify_checksums"`
+	CompressionLevel int    `mapstructure:"compression_level"`
+	HashAlgorithm    string `mapstructure:"hash_algorithm"`
+
+	// Storage 仓库对象与服务端补丁的存放位置，URL 为空时使用本地目录
+	Storage StorageConfig `mapstructure:"storage"`
+
+	// Webhooks serve 与 grpc-serve 的任务事件通知
+	Webhooks WebhookConfig `mapstructure:"webhooks"`
+
+	// IO 流式读取输入文件时的 IO 提示
+	IO IOConfig `mapstructure:"io"`
+
+	// Audit 补丁应用的审计记录
+	Audit AuditConfig `mapstructure:"audit"`
+
+	// Backup apply --backup 生成的原文件备份的保留策略
+	Backup BackupConfig `mapstructure:"backup"`
+
+	// LogFile verbose 模式下文件日志（RepoDir/logs/bindiff.log）的轮转
+	LogFile LogFileConfig `mapstructure:"log_file"`
+
+	// Limits 应用补丁时的资源上限，防止恶意补丁耗尽内存
+	Limits LimitsConfig `mapstructure:"limits"`
+
+	// Profiles 目录差分按文件类型选用的配置档，按顺序匹配，都不匹配时再查 DefaultProfiles
+	Profiles []Profile `mapstructure:"profiles"`
 }
 
-// DefaultConfig 返回默认配置
-func DefaultConfig() *Config {
-	return &Config{
-		BlockSize:        1024,
-		MinMatchLength:   64,
-		MaxMemoryMB:      512,
-		MaxWorkers:       4,
-		EnableFFT:        true,
-		UseParallel:      true,
-		ShowProgress:     true,
-		Verbose:          false,
-		LogLevel:         "info",
-		RepoDir:          ".bindiff",
-		TempDir:          os.TempDir(),
-		BackupOriginal:   false,
-		VerifyChecksums:  true,
-		CompressionLevel: 6,
-	}
-}
-
-// LoadConfig 加载配置文件
-func LoadConfig(configPath string) (*Config, error) {
-	config := DefaultConfig()
-
-	viper.SetDefault("block_size", config.BlockSize)
-	viper.SetDefault("min_match_length", config.MinMatchLength)
-	viper.SetDefault("max_memory_mb", config.MaxMemoryMB)
-	viper.SetDefault("max_workers", config.MaxWorkers)
-	viper.SetDefault("enable_fft", config.EnableFFT)
-	viper.SetDefault("use_parallel", config.UseParallel)
-	viper.SetDefault("show_progress", config.ShowProgress)
-	viper.SetDefault("verbose", config.Verbose)
-	viper.SetDefault("log_level", config.LogLevel)
-	viper.SetDefault("repo_dir", config.RepoDir)
-	viper.SetDefault("temp_dir", config.TempDir)
-	viper.SetDefault("backup_original", config.BackupOriginal)
-	viper.SetDefault("verify_checksums", config.VerifyChecksums)
-	viper.SetDefault("compression_level", config.CompressionLevel)
-
-	// 设置配置文件路径
-	if configPath != "" {
-		viper.SetConfigFile(configPath)
-	} else {
-		// 查找配置文件
-		viper.SetConfigName("bindiff")
-		viper.SetConfigType("yaml")
-		viper.AddConfigPath(".")
-		viper.AddConfigPath("$HOME/.bindiff")
-		viper.AddConfigPath("/etc/bindiff")
-	}
-
-	// 环境变量支持
-	viper.SetEnvPrefix("BINDIFF")
-	viper.AutomaticEnv()
-
-	// 读取配置文件
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return nil, fmt.Errorf("failed to read config file: %w", err)
-		}
+// Profile 按文件名或检测到的类型覆盖的差分配置，零值字段沿用全局配置
+type Profile struct {
+	// Match 文件名模式（path.Match 语法，只与文件名比较，如 *.gz），
+	// 或 type:<类型> 按旧文件内容检测到的类型匹配（gzip、sqlite、disk、exec、archive）
+	Match string `mapstructure:"match"`
+	// Strategy 差分方式，为空时使用 auto
+	Strategy       string `mapstructure:"strategy"`
+	BlockSize      int    `mapstructure:"block_size"`
+	MinMatchLength int    `mapstructure:"min_match_length"`
+	AlignStrategy  string `mapstructure:"align_strategy"`
+	// AutoTune 对匹配的文件启用自动调参
+	AutoTune bool `mapstructure:"auto_tune"`
+}
+
+// DefaultProfiles 内置的配置档，在 Config.Profiles 之后匹配
+func DefaultProfiles() []Profile {
+	return []Profile{
+		{Match: "*.gz", Strategy: StrategyGzip},
+		{Match: "*.tgz", Strategy: StrategyGzip},
+		{Match: "*.so", Strategy: StrategyExec},
+		{Match: "*.so.*", Strategy: StrategyExec},
+		{Match: "*.dll", Strategy: StrategyExec},
+		{Match: "*.exe", Strategy: StrategyExec},
+		{Match: "*.dylib", Strategy: StrategyExec},
+		{Match: "*.db", Strategy: StrategySQLite},
+		{Match: "*.sqlite", Strategy: StrategySQLite},
+		{Match: "*.sqlite3", Strategy: StrategySQLite},
+		{Match: "*.img", Strategy: StrategyDisk},
+		{Match: "*.zip", Strategy: StrategyArchive},
+		{Match: "*.jar", Strategy: StrategyArchive},
+		{Match: "*.apk", Strategy: StrategyArchive},
+		{Match: "*.tar", Strategy: StrategyArchive},
 	}
+}
+
+// IOConfig 流式路径与服务端读取输入文件的 IO 提示，以及写入文件的持久性
+type IOConfig struct {
+	// ReadBufferKB 流式读写的缓冲区大小（KB），0 使用默认的 64 KB
+	ReadBufferKB int `mapstructure:"read_buffer_kb"`
+	// Sequential 以 POSIX_FADV_SEQUENTIAL 提示内核加大预读
+	Sequential bool `mapstructure:"sequential"`
+	// DropCache 读完后以 POSIX_FADV_DONTNEED 释放页缓存，批量差分时不挤占其他数据的缓存
+	DropCache bool `mapstructure:"drop_cache"`
+	// DirectIO 以 O_DIRECT 读取输入文件，绕过页缓存；文件系统不支持时回退为普通读取
+	DirectIO bool `mapstructure:"direct_io"`
+	// Fsync 补丁、结果文件与仓库索引在报告成功前刷盘（文件与所在目录），关闭后更快但崩溃时可能丢失刚写入的文件
+	Fsync bool `mapstructure:"fsync"`
+}
 
-	// 解析配置
-	if err := viper.Unmarshal(config); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+// Hints 返回对应的 utils.IOHints
+func (c IOConfig) Hints() utils.IOHints {
+	return utils.IOHints{
+		BufferSize: c.ReadBufferKB * 1024,
+		Sequential: c.Sequential,
+		DropCache:  c.DropCache,
+		Direct:     c.DirectIO,
 	}
+}
+
+// AuditConfig 审计记录配置
+type AuditConfig struct {
+	// Enabled 记录每次 apply（时间、用户、源文件、补丁与结果的哈希、结果）
+	Enabled bool `mapstructure:"enabled"`
+	// Path 审计文件路径，为空时使用 RepoDir/audit.log
+	Path string `mapstructure:"path"`
+	// Syslog 同时发送到本机 syslog（Windows 上不支持）
+	Syslog bool `mapstructure:"syslog"`
+}
 
-	// 验证配置
-	if err := config.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid config: %w", err)
+// AuditPath 返回审计文件路径
+func (c *Config) AuditPath() string {
+	if c.Audit.Path != "" {
+		return c.Audit.Path
 	}
+	return filepath.Join(c.RepoDir, "audit.log")
+}
+
+// LogFileConfig 文件日志的轮转参数，0 表示不按该条件轮转或清理
+type LogFileConfig struct {
+	// MaxSizeMB 日志文件超过该大小（MB）时轮转为带时间戳的备份
+	MaxSizeMB int `mapstructure:"max_size_mb"`
+	// MaxAgeDays 删除早于该天数的备份
+	MaxAgeDays int `mapstructure:"max_age_days"`
+	// MaxBackups 最多保留的备份数
+	MaxBackups int `mapstructure:"max_backups"`
+	// Compress 以 gzip 压缩备份
+	Compress bool `mapstructure:"compress"`
+}
+
+// LimitsConfig 应用补丁时的资源上限，0 表示不限制；应用不可信补丁的服务端应设置
+type LimitsConfig struct {
+	// MaxOutputMB 重建或解压得到的数据（结果文件、归档段、gzip 原始流）的最大大小（MB）
+	MaxOutputMB int `mapstructure:"max_output_mb"`
+	// MaxOpMB 单个操作的最大长度（MB）
+	MaxOpMB int `mapstructure:"max_op_mb"`
+	// MaxOps 补丁的最大操作数
+	MaxOps int `mapstructure:"max_ops"`
+}
+
+// BackupConfig 原文件备份（FILE.backup.<时间>）的保留策略，每次备份后清理，0 表示不按该条件清理
+type BackupConfig struct {
+	// Keep 每个文件最多保留的备份数
+	Keep int `mapstructure:"keep"`
+	// MaxAgeDays 删除早于该天数的备份
+	MaxAgeDays int `mapstructure:"max_age_days"`
+}
+
+// StorageConfig 远程存储配置。未设置的凭据从各服务的标准环境变量读取
+// （AWS_ACCESS_KEY_ID、GOOGLE_OAUTH_ACCESS_TOKEN、AZURE_STORAGE_KEY 等）
+type StorageConfig struct {
+	// URL 本地目录、file:///dir、s3://bucket/prefix、gs://bucket/prefix 或 azure://account/container/prefix
+	URL string `mapstructure:"url"`
+	// Endpoint 覆盖服务地址（如 MinIO 等 S3 兼容服务，此时使用路径风格的地址）
+	Endpoint string `mapstructure:"endpoint"`
+	// Region S3 区域
+	Region string `mapstructure:"region"`
+	// AccessKey 与 SecretKey 为 S3 访问密钥或 GCS HMAC 密钥；Azure 只使用 SecretKey（账户密钥）
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+	// Token S3 会话令牌、GCS OAuth 访问令牌或 Azure SAS 令牌
+	Token string `mapstructure:"token"`
+}
+
+// WebhookConfig 任务事件通知配置
+type WebhookConfig struct {
+	// URLs 接收事件的 http(s) 地址
+	URLs []string `mapstructure:"urls"`
+	// Secret HMAC-SHA256 签名密钥，为空时读取 BINDIFF_WEBHOOK_SECRET
+	Secret string `mapstructure:"secret"`
+	// Events 只发送这些事件（job.queued、job.started、job.completed、job.failed），为空时发送全部
+	Events []string `mapstructure:"events"`
+}
+
+// DefaultConfig 返回默认配置
+func DefaultConfig() *Config {
+	return &Config{
+		BlockSize:            1024,
+		MinMatchLength:       64,
+		MaxMemoryMB:          512,
+		MaxWorkers:           4,
+		EnableFFT:            true,
+		UseParallel:          true,
+		FFTPrecision:         FFTPrecisionFloat64,
+		AlignStrategy:        AlignStrategyFFT,
+		CorrelationBackend:   CorrelationBackendCPU,
+		AlignSamples:         16,
+		AlignSampleSize:      64 << 10,
+		ShowProgress:         true,
+		ProgressFormat:       "bar",
+		Verbose:              false,
+		LogLevel:             "info",
+		RepoDir:              ".bindiff",
+		TempDir:              os.TempDir(),
+		BackupOriginal:       false,
+		RepoSnapshotInterval: 16,
+		VerifyChecksums:      true,
+		CompressionLevel:     6,
+		HashAlgorithm:        "sha256",
+		IO: IOConfig{
+			Fsync: true,
+		},
+		Audit: AuditConfig{
+			Enabled: true,
+		},
+		Backup: BackupConfig{
+			Keep: 5,
+		},
+		LogFile: LogFileConfig{
+			MaxSizeMB:  100,
+			MaxAgeDays: 30,
+			MaxBackups: 5,
+			Compress:   true,
+		},
+	}
+}
 
-	return config, nil
+// FieldError 单个配置项的校验错误
+type FieldError struct {
+	// Field 配置项的键，如 block_size、io.read_buffer_kb、profiles[0]
+	Field   string
+	Message string
 }
 
-// Validate 验证配置参数
+// Error 实现 error 接口
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+// Validate 验证配置参数，检查所有配置项后以 errors.Join 返回全部问题，
+// 每个问题是一个 *FieldError，可用 errors.As 或 FieldErrors 取出
 func (c *Config) Validate() error {
+	var errs []error
+	fail := func(field, format string, args ...interface{}) {
+		errs = append(errs, &FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
 	if c.BlockSize <= 0 || c.BlockSize > 1024*1024 {
-		return fmt.Errorf("block_size must be between 1 and 1048576, got %d", c.BlockSize)
+		fail("block_size", "block_size must be between 1 and 1048576, got %d", c.BlockSize)
 	}
 
-	if c.MinMatchLength <= 0 || c.MinMatchLength > c.BlockSize {
-		return fmt.Errorf("min_match_length must be between 1 and block_size(%d), got %d",
+	// 块大小本身无效时只检查下限，不重复报告
+	if c.MinMatchLength <= 0 || c.BlockSize > 0 && c.MinMatchLength > c.BlockSize {
+		fail("min_match_length", "min_match_length must be between 1 and block_size(%d), got %d",
 			c.BlockSize, c.MinMatchLength)
 	}
 
 	if c.MaxMemoryMB <= 0 {
-		return fmt.Errorf("max_memory_mb must be positive, got %d", c.MaxMemoryMB)
+		fail("max_memory_mb", "max_memory_mb must be positive, got %d", c.MaxMemoryMB)
 	}
 
 	if c.MaxWorkers <= 0 {
-		return fmt.Errorf("max_workers must be positive, got %d", c.MaxWorkers)
+		fail("max_workers", "max_workers must be positive, got %d", c.MaxWorkers)
+	}
+
+	if c.RepoSnapshotInterval < 0 {
+		fail("repo_snapshot_interval", "repo_snapshot_interval must not be negative, got %d", c.RepoSnapshotInterval)
+	}
+
+	if c.IO.ReadBufferKB < 0 || c.IO.ReadBufferKB > 64*1024 {
+		fail("io.read_buffer_kb", "io.read_buffer_kb must be between 0 and 65536, got %d", c.IO.ReadBufferKB)
+	}
+
+	if c.LogFile.MaxSizeMB < 0 {
+		fail("log_file.max_size_mb", "log_file.max_size_mb must not be negative, got %d", c.LogFile.MaxSizeMB)
+	}
+	if c.LogFile.MaxAgeDays < 0 {
+		fail("log_file.max_age_days", "log_file.max_age_days must not be negative, got %d", c.LogFile.MaxAgeDays)
+	}
+	if c.LogFile.MaxBackups < 0 {
+		fail("log_file.max_backups", "log_file.max_backups must not be negative, got %d", c.LogFile.MaxBackups)
+	}
+
+	if c.Limits.MaxOutputMB < 0 {
+		fail("limits.max_output_mb", "limits.max_output_mb must not be negative, got %d", c.Limits.MaxOutputMB)
+	}
+	if c.Limits.MaxOpMB < 0 {
+		fail("limits.max_op_mb", "limits.max_op_mb must not be negative, got %d", c.Limits.MaxOpMB)
+	}
+	if c.Limits.MaxOps < 0 {
+		fail("limits.max_ops", "limits.max_ops must not be negative, got %d", c.Limits.MaxOps)
+	}
+
+	if c.Backup.Keep < 0 {
+		fail("backup.keep", "backup.keep must not be negative, got %d", c.Backup.Keep)
+	}
+	if c.Backup.MaxAgeDays < 0 {
+		fail("backup.max_age_days", "backup.max_age_days must not be negative, got %d", c.Backup.MaxAgeDays)
 	}
 
 	if c.CompressionLevel < 0 || c.CompressionLevel > 9 {
-		return fmt.Errorf("compression_level must be between 0 and 9, got %d", c.CompressionLevel)
+		fail("compression_level", "compression_level must be between 0 and 9, got %d", c.CompressionLevel)
 	}
 
 	// 验证日志级别
@@ -138,35 +370,87 @@ func (c *Config) Validate() error {
 		"debug": true, "info": true, "warn": true, "error": true,
 	}
 	if !validLogLevels[c.LogLevel] {
-		return fmt.Errorf("invalid log_level: %s", c.LogLevel)
+		fail("log_level", "invalid log_level: %s", c.LogLevel)
 	}
 
-	return nil
-}
+	// 验证进度格式（为空时使用 bar）
+	validProgressFormats := map[string]bool{
+		"": true, "bar": true, "jsonl": true, "none": true,
+	}
+	if !validProgressFormats[c.ProgressFormat] {
+		fail("progress_format", "invalid progress_format: %s", c.ProgressFormat)
+	}
 
-// SaveConfig 保存配置到文件
-func (c *Config) SaveConfig(configPath string) error {
-	viper.Set("block_size", c.BlockSize)
-	viper.Set("min_match_length", c.MinMatchLength)
-	viper.Set("max_memory_mb", c.MaxMemoryMB)
-	viper.Set("max_workers", c.MaxWorkers)
-	viper.Set("enable_fft", c.EnableFFT)
-	viper.Set("use_parallel", c.UseParallel)
-	viper.Set("show_progress", c.ShowProgress)
-	viper.Set("verbose", c.Verbose)
-	viper.Set("log_level", c.LogLevel)
-	viper.Set("repo_dir", c.RepoDir)
-	viper.Set("temp_dir", c.TempDir)
-	viper.Set("backup_original", c.BackupOriginal)
-	viper.Set("verify_checksums", c.VerifyChecksums)
-	viper.Set("compression_level", c.CompressionLevel)
+	// 验证语言（为空时按环境变量检测）
+	validLangs := map[string]bool{"": true, "en": true, "zh": true}
+	if !validLangs[c.Lang] {
+		fail("lang", "invalid lang: %s", c.Lang)
+	}
+
+	// 验证哈希算法（为空时使用 sha256）
+	validHashAlgorithms := map[string]bool{
+		"": true, "sha256": true, "blake3": true, "xxhash": true,
+	}
+	if !validHashAlgorithms[c.HashAlgorithm] {
+		fail("hash_algorithm", "invalid hash_algorithm: %s", c.HashAlgorithm)
+	}
 
-	// 确保目录存在
-	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
+	// 验证 FFT 精度（为空时使用 float64）
+	validPrecisions := map[string]bool{
+		"": true, FFTPrecisionFloat64: true, FFTPrecisionFloat32: true,
+	}
+	if !validPrecisions[c.FFTPrecision] {
+		fail("fft_precision", "invalid fft_precision: %s", c.FFTPrecision)
+	}
+	validStrategies := map[string]bool{
+		"": true, AlignStrategyFFT: true, AlignStrategyWinnow: true, AlignStrategySampled: true,
+	}
+	if !validStrategies[c.AlignStrategy] {
+		fail("align_strategy", "invalid align_strategy: %s", c.AlignStrategy)
+	}
+	if c.AlignSamples < 0 {
+		fail("align_samples", "align_samples must be non-negative, got %d", c.AlignSamples)
+	}
+	if c.AlignSampleSize < 0 {
+		fail("align_sample_size", "align_sample_size must be non-negative, got %d", c.AlignSampleSize)
+	}
+	for i, p := range c.Profiles {
+		if err := p.validate(); err != nil {
+			field := fmt.Sprintf("profiles[%d]", i)
+			fail(field, "invalid %s: %v", field, err)
+		}
+	}
+	// 后端是否编译进程序在对齐时检查
+	validBackends := map[string]bool{
+		"": true, CorrelationBackendCPU: true, CorrelationBackendCUDA: true,
+	}
+	if !validBackends[c.CorrelationBackend] {
+		fail("correlation_backend", "invalid correlation_backend: %s", c.CorrelationBackend)
 	}
 
-	return viper.WriteConfigAs(configPath)
+	// 验证存储地址的协议（本地路径不带协议）
+	if scheme, _, ok := strings.Cut(c.Storage.URL, "://"); ok {
+		validSchemes := map[string]bool{"file": true, "s3": true, "gs": true, "azure": true}
+		if !validSchemes[scheme] {
+			fail("storage.url", "invalid storage.url scheme: %s", scheme)
+		}
+	}
+
+	for _, u := range c.Webhooks.URLs {
+		if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+			fail("webhooks.urls", "invalid webhooks.urls entry: %s", u)
+		}
+	}
+	validEvents := map[string]bool{
+		"job.queued": true, "job.started": true, "job.completed": true, "job.failed": true,
+	}
+	for _, e := range c.Webhooks.Events {
+		if !validEvents[e] {
+			fail("webhooks.events", "invalid webhooks.events entry: %s", e)
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
 // GetConfigPath 获取配置文件路径
@@ -192,3 +476,52 @@ func GetConfigPath() string {
 
 	return ""
 }
+
+// FieldErrors 取出 Validate（或包装了它的错误，如 LoadConfig 的返回值）中的各个配置项错误
+func FieldErrors(err error) []*FieldError {
+	if fe, ok := err.(*FieldError); ok {
+		return []*FieldError{fe}
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var fields []*FieldError
+		for _, e := range joined.Unwrap() {
+			fields = append(fields, FieldErrors(e)...)
+		}
+		return fields
+	}
+	if inner := errors.Unwrap(err); inner != nil {
+		return FieldErrors(inner)
+	}
+	return nil
+}
+
+// validate 检查配置档的匹配条件与覆盖的取值
+func (p Profile) validate() error {
+	validTypes := map[string]bool{
+		StrategyGzip: true, StrategySQLite: true, StrategyDisk: true, StrategyExec: true, StrategyArchive: true,
+	}
+	if t, ok := strings.CutPrefix(p.Match, "type:"); ok {
+		if !validTypes[t] {
+			return fmt.Errorf("unknown file type: %s", t)
+		}
+	} else if p.Match == "" {
+		return fmt.Errorf("match must not be empty")
+	} else if _, err := path.Match(p.Match, ""); err != nil {
+		return fmt.Errorf("bad match pattern %q: %w", p.Match, err)
+	}
+	if p.Strategy != "" && p.Strategy != StrategyAuto && p.Strategy != StrategyRaw && !validTypes[p.Strategy] {
+		return fmt.Errorf("invalid strategy: %s", p.Strategy)
+	}
+	if p.BlockSize < 0 || p.MinMatchLength < 0 {
+		return fmt.Errorf("block_size and min_match_length must be non-negative")
+	}
+	if p.MinMatchLength > 0 && p.BlockSize > 0 && p.MinMatchLength > p.BlockSize {
+		return fmt.Errorf("min_match_length must not exceed block_size(%d), got %d", p.BlockSize, p.MinMatchLength)
+	}
+	switch p.AlignStrategy {
+	case "", AlignStrategyFFT, AlignStrategyWinnow, AlignStrategySampled:
+	default:
+		return fmt.Errorf("invalid align_strategy: %s", p.AlignStrategy)
+	}
+	return nil
+}
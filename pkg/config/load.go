@@ -0,0 +1,372 @@
+//go:build !js
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// 配置文件的读写依赖 viper，不编译进 WebAssembly 构建（cmd/wasm）以减小体积
+
+// 配置值来源中的默认值，其余来源为配置文件路径、env:BINDIFF_* 或 flag:--*
+const OriginDefault = "default"
+
+// Origins 每个配置项（如 block_size、storage.url）有效值的来源
+type Origins map[string]string
+
+// configDirs 按优先级从低到高查找配置文件的目录：系统、用户、当前项目
+var configDirs = []string{"/etc/bindiff", "$HOME/.bindiff", "."}
+
+// configExts 配置文件支持的扩展名，同一目录中取第一个存在的
+var configExts = []string{"yaml", "yml", "json", "toml"}
+
+// LoadConfig 加载配置：configPath 为空时合并所有层级的配置文件（见 LoadLayeredConfig）
+func LoadConfig(configPath string) (*Config, error) {
+	config, _, err := LoadLayeredConfig(configPath)
+	return config, err
+}
+
+// LoadLayeredConfig 按优先级从低到高合并默认值、ConfigLayers 中的配置文件与 BINDIFF_* 环境变量，
+// 同时返回每个配置项的来源；命令行选项由调用方在其后覆盖并记录来源。
+// configPath 非空时只使用该文件，文件不存在时返回错误
+func LoadLayeredConfig(configPath string) (*Config, Origins, error) {
+	if configPath == "" {
+		return LoadLayers(ConfigLayers())
+	}
+	if _, err := os.Stat(configPath); err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return LoadLayers([]string{configPath})
+}
+
+// ConfigLayers 返回存在的各层配置文件，按优先级从低到高：/etc/bindiff、~/.bindiff 与当前目录下的
+// bindiff.yaml（或 .yml、.json、.toml）
+func ConfigLayers() []string {
+	var layers []string
+	for _, dir := range configDirs {
+		for _, ext := range configExts {
+			path := filepath.Join(os.ExpandEnv(dir), "bindiff."+ext)
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				layers = append(layers, path)
+				break
+			}
+		}
+	}
+	return layers
+}
+
+// LoadLayers 依次合并 paths 中的配置文件（后面的覆盖前面的，不存在的跳过），再应用环境变量并校验
+func LoadLayers(paths []string) (*Config, Origins, error) {
+	config := DefaultConfig()
+	// 每次使用新的 viper 实例，之前 SaveConfig 设置的值不会覆盖环境变量
+	v := viper.New()
+
+	v.SetDefault("block_size", config.BlockSize)
+	v.SetDefault("min_match_length", config.MinMatchLength)
+	v.SetDefault("max_memory_mb", config.MaxMemoryMB)
+	v.SetDefault("auto_tune", config.AutoTune)
+	v.SetDefault("max_workers", config.MaxWorkers)
+	v.SetDefault("enable_fft", config.EnableFFT)
+	v.SetDefault("use_parallel", config.UseParallel)
+	v.SetDefault("fft_precision", config.FFTPrecision)
+	v.SetDefault("align_strategy", config.AlignStrategy)
+	v.SetDefault("align_samples", config.AlignSamples)
+	v.SetDefault("align_sample_size", config.AlignSampleSize)
+	v.SetDefault("correlation_backend", config.CorrelationBackend)
+	v.SetDefault("show_progress", config.ShowProgress)
+	v.SetDefault("progress_format", config.ProgressFormat)
+	v.SetDefault("verbose", config.Verbose)
+	v.SetDefault("log_level", config.LogLevel)
+	v.SetDefault("lang", config.Lang)
+	v.SetDefault("repo_dir", config.RepoDir)
+	v.SetDefault("temp_dir", config.TempDir)
+	v.SetDefault("backup_original", config.BackupOriginal)
+	v.SetDefault("repo_snapshot_interval", config.RepoSnapshotInterval)
+	v.SetDefault("repo_chunking", config.RepoChunking)
+	v.SetDefault("verify_checksums", config.VerifyChecksums)
+	v.SetDefault("compression_level", config.CompressionLevel)
+	v.SetDefault("hash_algorithm", config.HashAlgorithm)
+	v.SetDefault("storage.url", config.Storage.URL)
+	v.SetDefault("io.read_buffer_kb", config.IO.ReadBufferKB)
+	v.SetDefault("io.sequential", config.IO.Sequential)
+	v.SetDefault("io.drop_cache", config.IO.DropCache)
+	v.SetDefault("io.direct_io", config.IO.DirectIO)
+	v.SetDefault("io.fsync", config.IO.Fsync)
+	v.SetDefault("audit.enabled", config.Audit.Enabled)
+	v.SetDefault("audit.syslog", config.Audit.Syslog)
+	v.SetDefault("log_file.max_size_mb", config.LogFile.MaxSizeMB)
+	v.SetDefault("log_file.max_age_days", config.LogFile.MaxAgeDays)
+	v.SetDefault("log_file.max_backups", config.LogFile.MaxBackups)
+	v.SetDefault("log_file.compress", config.LogFile.Compress)
+	v.SetDefault("limits.max_output_mb", config.Limits.MaxOutputMB)
+	v.SetDefault("limits.max_op_mb", config.Limits.MaxOpMB)
+	v.SetDefault("limits.max_ops", config.Limits.MaxOps)
+	v.SetDefault("backup.keep", config.Backup.Keep)
+	v.SetDefault("backup.max_age_days", config.Backup.MaxAgeDays)
+
+	keys := configKeys(reflect.TypeOf(Config{}), "")
+	origins := make(Origins, len(keys))
+	for _, k := range keys {
+		origins[k.name] = OriginDefault
+	}
+
+	for _, path := range paths {
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		layer := viper.New()
+		layer.SetConfigFile(path)
+		if err := layer.ReadInConfig(); err != nil {
+			return nil, nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+		}
+		if err := v.MergeConfigMap(layer.AllSettings()); err != nil {
+			return nil, nil, fmt.Errorf("failed to merge config file %s: %w", path, err)
+		}
+		for _, k := range layer.AllKeys() {
+			origins[k] = path
+		}
+	}
+
+	// 环境变量支持：BINDIFF_ 前缀，嵌套键中的 . 替换为 _（如 BINDIFF_STORAGE_URL）。
+	// 显式绑定每个键：AutomaticEnv 只对 viper 已知的键生效，没有默认值、也不在配置文件中的键
+	// （如 storage.endpoint）需要绑定后 Unmarshal 才能读到。结构体列表（profiles）只能在配置文件中设置
+	v.SetEnvPrefix("BINDIFF")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	for _, k := range keys {
+		if !k.env {
+			continue
+		}
+		v.BindEnv(k.name)
+		if name := EnvName(k.name); os.Getenv(name) != "" {
+			origins[k.name] = "env:" + name
+		}
+	}
+
+	// 解析配置
+	if err := v.Unmarshal(config); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	// 验证配置
+	if err := config.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return config, origins, nil
+}
+
+// EnvName 返回配置项对应的环境变量名，如 storage.url 对应 BINDIFF_STORAGE_URL
+func EnvName(key string) string {
+	return "BINDIFF_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// configKey 配置结构中的一个配置项
+type configKey struct {
+	name string
+	// env 可以由环境变量设置（结构体列表不行）
+	env bool
+}
+
+// configKeys 按 mapstructure 标签列出配置结构中的所有配置项，嵌套结构以 . 连接
+func configKeys(t reflect.Type, prefix string) []configKey {
+	var keys []configKey
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := f.Tag.Get("mapstructure")
+		if key == "" || key == "-" {
+			continue
+		}
+		key = prefix + key
+		switch {
+		case f.Type.Kind() == reflect.Struct:
+			keys = append(keys, configKeys(f.Type, key+".")...)
+		case f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.Struct:
+			keys = append(keys, configKey{name: key})
+		default:
+			keys = append(keys, configKey{name: key, env: true})
+		}
+	}
+	return keys
+}
+
+// Settings 按配置项列出有效值，键与 Origins 相同
+func (c *Config) Settings() map[string]interface{} {
+	settings := make(map[string]interface{})
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			key := f.Tag.Get("mapstructure")
+			if key == "" || key == "-" {
+				continue
+			}
+			if f.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), prefix+key+".")
+				continue
+			}
+			settings[prefix+key] = v.Field(i).Interface()
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "")
+	return settings
+}
+
+// ValidateFile 检查单个配置文件（不合并其他层与环境变量）：配置结构中不存在的键（viper 加载时会静默忽略）
+// 与无效的取值都以 *FieldError 报告，以 errors.Join 返回；文件无法读取或类型不符时直接返回错误
+func ValidateFile(path string) error {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var errs []error
+	for _, key := range unknownKeys(v.AllSettings(), reflect.TypeOf(Config{}), "") {
+		errs = append(errs, &FieldError{Field: key, Message: fmt.Sprintf("unknown key: %s", key)})
+	}
+
+	config := DefaultConfig()
+	if err := v.Unmarshal(config); err != nil {
+		return fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// unknownKeys 返回 settings 中在类型 t 里没有对应 mapstructure 标签的键（排序），逐层检查嵌套结构与结构体列表
+func unknownKeys(settings map[string]interface{}, t reflect.Type, prefix string) []string {
+	var unknown []string
+	for key, value := range settings {
+		field, ok := fieldByTag(t, key)
+		if !ok {
+			unknown = append(unknown, prefix+key)
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.Struct:
+			if m, ok := value.(map[string]interface{}); ok {
+				unknown = append(unknown, unknownKeys(m, field.Type, prefix+key+".")...)
+			}
+		case reflect.Slice:
+			items, _ := value.([]interface{})
+			if field.Type.Elem().Kind() != reflect.Struct {
+				continue
+			}
+			for i, item := range items {
+				if m, ok := item.(map[string]interface{}); ok {
+					unknown = append(unknown, unknownKeys(m, field.Type.Elem(), fmt.Sprintf("%s%s[%d].", prefix, key, i))...)
+				}
+			}
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// fieldByTag 按 mapstructure 标签查找字段，与 viper 一样不区分大小写
+func fieldByTag(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if tag := f.Tag.Get("mapstructure"); tag != "" && tag != "-" && strings.EqualFold(tag, key) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// SaveConfig 保存配置到文件
+func (c *Config) SaveConfig(configPath string) error {
+	v := viper.New()
+	v.Set("block_size", c.BlockSize)
+	v.Set("min_match_length", c.MinMatchLength)
+	v.Set("max_memory_mb", c.MaxMemoryMB)
+	v.Set("auto_tune", c.AutoTune)
+	v.Set("max_workers", c.MaxWorkers)
+	v.Set("enable_fft", c.EnableFFT)
+	v.Set("use_parallel", c.UseParallel)
+	v.Set("fft_precision", c.FFTPrecision)
+	v.Set("align_strategy", c.AlignStrategy)
+	v.Set("align_samples", c.AlignSamples)
+	v.Set("align_sample_size", c.AlignSampleSize)
+	v.Set("correlation_backend", c.CorrelationBackend)
+	v.Set("show_progress", c.ShowProgress)
+	v.Set("progress_format", c.ProgressFormat)
+	v.Set("verbose", c.Verbose)
+	v.Set("log_level", c.LogLevel)
+	v.Set("lang", c.Lang)
+	v.Set("repo_dir", c.RepoDir)
+	v.Set("temp_dir", c.TempDir)
+	v.Set("backup_original", c.BackupOriginal)
+	v.Set("repo_snapshot_interval", c.RepoSnapshotInterval)
+	v.Set("repo_chunking", c.RepoChunking)
+	v.Set("verify_checksums", c.VerifyChecksums)
+	v.Set("compression_level", c.CompressionLevel)
+	v.Set("hash_algorithm", c.HashAlgorithm)
+	v.Set("storage.url", c.Storage.URL)
+	v.Set("storage.endpoint", c.Storage.Endpoint)
+	v.Set("storage.region", c.Storage.Region)
+	v.Set("io.read_buffer_kb", c.IO.ReadBufferKB)
+	v.Set("io.sequential", c.IO.Sequential)
+	v.Set("io.drop_cache", c.IO.DropCache)
+	v.Set("io.direct_io", c.IO.DirectIO)
+	v.Set("io.fsync", c.IO.Fsync)
+	v.Set("audit.enabled", c.Audit.Enabled)
+	v.Set("audit.syslog", c.Audit.Syslog)
+	v.Set("audit.path", c.Audit.Path)
+	v.Set("log_file.max_size_mb", c.LogFile.MaxSizeMB)
+	v.Set("log_file.max_age_days", c.LogFile.MaxAgeDays)
+	v.Set("log_file.max_backups", c.LogFile.MaxBackups)
+	v.Set("log_file.compress", c.LogFile.Compress)
+	v.Set("limits.max_output_mb", c.Limits.MaxOutputMB)
+	v.Set("limits.max_op_mb", c.Limits.MaxOpMB)
+	v.Set("limits.max_ops", c.Limits.MaxOps)
+	v.Set("backup.keep", c.Backup.Keep)
+	v.Set("backup.max_age_days", c.Backup.MaxAgeDays)
+	if len(c.Profiles) > 0 {
+		profiles := make([]map[string]any, len(c.Profiles))
+		for i, p := range c.Profiles {
+			profiles[i] = p.settings()
+		}
+		v.Set("profiles", profiles)
+	}
+
+	// 确保目录存在
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	return v.WriteConfigAs(configPath)
+}
+
+// settings 返回配置档写入配置文件的键值，省略沿用全局配置的零值字段
+func (p Profile) settings() map[string]any {
+	m := map[string]any{"match": p.Match}
+	if p.Strategy != "" {
+		m["strategy"] = p.Strategy
+	}
+	if p.BlockSize != 0 {
+		m["block_size"] = p.BlockSize
+	}
+	if p.MinMatchLength != 0 {
+		m["min_match_length"] = p.MinMatchLength
+	}
+	if p.AlignStrategy != "" {
+		m["align_strategy"] = p.AlignStrategy
+	}
+	if p.AutoTune {
+		m["auto_tune"] = true
+	}
+	return m
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"reflect"
+)
+
+// Schema 配置文件的 JSON Schema（draft 2020-12 的子集）
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 string             `json:"type"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Maximum              *int               `json:"maximum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+}
+
+// schemaRule 与 Validate 一致的取值约束，键与 Origins 相同，列表元素以 [] 结尾
+type schemaRule struct {
+	required []string
+	enum     []string
+	pattern  string
+	min, max *int
+}
+
+func intp(n int) *int { return &n }
+
+var schemaRules = map[string]schemaRule{
+	"block_size":             {min: intp(1), max: intp(1024 * 1024)},
+	"min_match_length":       {min: intp(1), max: intp(1024 * 1024)},
+	"max_memory_mb":          {min: intp(1)},
+	"max_workers":            {min: intp(1)},
+	"align_samples":          {min: intp(0)},
+	"align_sample_size":      {min: intp(0)},
+	"repo_snapshot_interval": {min: intp(0)},
+	"compression_level":      {min: intp(0), max: intp(9)},
+	"io.read_buffer_kb":      {min: intp(0), max: intp(64 * 1024)},
+	"log_file.max_size_mb":   {min: intp(0)},
+	"log_file.max_age_days":  {min: intp(0)},
+	"log_file.max_backups":   {min: intp(0)},
+	"limits.max_output_mb":   {min: intp(0)},
+	"limits.max_op_mb":       {min: intp(0)},
+	"limits.max_ops":         {min: intp(0)},
+	"backup.keep":            {min: intp(0)},
+	"backup.max_age_days":    {min: intp(0)},
+	"log_level":              {enum: []string{"debug", "info", "warn", "error"}},
+	"hash_algorithm":         {enum: []string{"", "sha256", "blake3", "xxhash"}},
+	"progress_format":        {enum: []string{"", "bar", "jsonl", "none"}},
+	"lang":                   {enum: []string{"", "en", "zh"}},
+	"fft_precision":          {enum: []string{"", FFTPrecisionFloat64, FFTPrecisionFloat32}},
+	"align_strategy":         {enum: alignStrategies},
+	"correlation_backend":    {enum: []string{"", CorrelationBackendCPU, CorrelationBackendCUDA}},
+	"webhooks.urls[]":        {pattern: `^https?://`},
+	"webhooks.events[]":      {enum: []string{"job.queued", "job.started", "job.completed", "job.failed"}},
+	"profiles[]":             {required: []string{"match"}},
+	"profiles[].strategy": {enum: []string{"", StrategyAuto, StrategyRaw, StrategyGzip,
+		StrategySQLite, StrategyDisk, StrategyExec, StrategyArchive}},
+	"profiles[].align_strategy":   {enum: alignStrategies},
+	"profiles[].block_size":       {min: intp(0), max: intp(1024 * 1024)},
+	"profiles[].min_match_length": {min: intp(0)},
+}
+
+var alignStrategies = []string{"", AlignStrategyFFT, AlignStrategyWinnow, AlignStrategySampled}
+
+// JSONSchema 返回配置文件的 JSON Schema，默认值取自 DefaultConfig，未知键不允许出现
+func JSONSchema() *Schema {
+	s := schemaFor(reflect.TypeOf(Config{}), reflect.ValueOf(*DefaultConfig()), "")
+	s.Schema = "https://json-schema.org/draft/2020-12/schema"
+	s.Title = "bindiff configuration"
+	return s
+}
+
+// schemaFor 按 mapstructure 标签生成类型 t 的 Schema；def 为默认值，无效时不输出 default
+func schemaFor(t reflect.Type, def reflect.Value, key string) *Schema {
+	var s *Schema
+	switch t.Kind() {
+	case reflect.Struct:
+		s = &Schema{Type: "object", Properties: make(map[string]*Schema), AdditionalProperties: new(bool)}
+		prefix := key
+		if prefix != "" {
+			prefix += "."
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := f.Tag.Get("mapstructure")
+			if name == "" || name == "-" {
+				continue
+			}
+			var fieldDef reflect.Value
+			if def.IsValid() {
+				fieldDef = def.Field(i)
+			}
+			s.Properties[name] = schemaFor(f.Type, fieldDef, prefix+name)
+		}
+		s.Required = schemaRules[key].required
+		return s
+	case reflect.Slice:
+		s = &Schema{Type: "array", Items: schemaFor(t.Elem(), reflect.Value{}, key+"[]")}
+	case reflect.Bool:
+		s = &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s = &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		s = &Schema{Type: "number"}
+	default:
+		s = &Schema{Type: "string"}
+	}
+
+	rule := schemaRules[key]
+	s.Enum, s.Pattern, s.Minimum, s.Maximum = rule.enum, rule.pattern, rule.min, rule.max
+	// 临时目录的默认值取决于运行环境，不写入 Schema
+	if def.IsValid() && t.Kind() != reflect.Slice && key != "temp_dir" {
+		s.Default = def.Interface()
+	}
+	return s
+}
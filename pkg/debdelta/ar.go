@@ -0,0 +1,74 @@
+package debdelta
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ar 归档格式（.deb 与 .debdelta 的外层容器）
+const (
+	arMagic      = "!<arch>\n"
+	arHeaderSize = 60
+)
+
+// arMember 归档中的一个成员
+type arMember struct {
+	Name string
+	Data []byte
+}
+
+// readAr 解析 ar 归档，成员名同时接受 dpkg 的空格填充与 GNU ar 的 "/" 结尾两种写法
+func readAr(data []byte) ([]arMember, error) {
+	if !bytes.HasPrefix(data, []byte(arMagic)) {
+		return nil, fmt.Errorf("missing ar magic")
+	}
+	var members []arMember
+	pos := len(arMagic)
+	for pos < len(data) {
+		if len(data)-pos < arHeaderSize {
+			return nil, fmt.Errorf("truncated ar header at offset %d", pos)
+		}
+		hdr := data[pos : pos+arHeaderSize]
+		if string(hdr[58:60]) != "`\n" {
+			return nil, fmt.Errorf("bad ar header at offset %d", pos)
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil || size < 0 || size > int64(len(data)-pos-arHeaderSize) {
+			return nil, fmt.Errorf("bad ar member size at offset %d", pos)
+		}
+		pos += arHeaderSize
+		name := strings.TrimSuffix(strings.TrimRight(string(hdr[:16]), " "), "/")
+		members = append(members, arMember{Name: name, Data: data[pos : pos+int(size)]})
+		pos += int(size)
+		if size%2 == 1 && pos < len(data) {
+			pos++
+		}
+	}
+	return members, nil
+}
+
+// writeAr 写入 GNU ar 格式的归档，时间戳、属主固定为 0，输出只取决于成员内容
+func writeAr(members []arMember) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(arMagic)
+	for _, m := range members {
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", m.Name+"/", 0, 0, 0, 0100644, len(m.Data))
+		buf.Write(m.Data)
+		if len(m.Data)%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+// findMember 返回名称满足 match 的第一个成员
+func findMember(members []arMember, match func(string) bool) *arMember {
+	for i := range members {
+		if match(members[i].Name) {
+			return &members[i]
+		}
+	}
+	return nil
+}
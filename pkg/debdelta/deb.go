@@ -0,0 +1,121 @@
+package debdelta
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidPackage 输入不是 .deb 软件包
+var ErrInvalidPackage = errors.New("invalid Debian package")
+
+// Package 软件包的标识与校验信息，对应 debdelta info 中的 OLD/ 与 NEW/ 字段
+type Package struct {
+	Name         string
+	Version      string
+	Architecture string
+	Size         int64
+	MD5          string
+}
+
+// ParsePackage 从 .deb 的 control 成员读取包名、版本与架构。
+// control 成员不是 gzip 压缩或未压缩的 tar 时（如 control.tar.xz），从 name_version_arch.deb 形式的文件名推断
+func ParsePackage(data []byte, filename string) (*Package, error) {
+	members, err := readAr(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+	if len(members) == 0 || members[0].Name != "debian-binary" {
+		return nil, fmt.Errorf("%w: first member is not debian-binary", ErrInvalidPackage)
+	}
+	sum := md5.Sum(data)
+	p := &Package{Size: int64(len(data)), MD5: hex.EncodeToString(sum[:])}
+
+	control := findMember(members, func(name string) bool { return strings.HasPrefix(name, "control.tar") })
+	if control == nil {
+		return nil, fmt.Errorf("%w: missing control member", ErrInvalidPackage)
+	}
+	fields, err := readControl(control)
+	if err != nil {
+		return nil, err
+	}
+	if fields != nil {
+		p.Name, p.Version, p.Architecture = fields["Package"], fields["Version"], fields["Architecture"]
+	} else {
+		p.Name, p.Version, p.Architecture = nameFields(filename)
+	}
+	if p.Name == "" || p.Version == "" || p.Architecture == "" {
+		return nil, fmt.Errorf("%w: cannot read package fields from %s (%s) or from the file name", ErrInvalidPackage, control.Name, filename)
+	}
+	return p, nil
+}
+
+// readControl 解析 control 成员中的 control 文件，压缩格式不受支持时返回 nil
+func readControl(m *arMember) (map[string]string, error) {
+	var r io.Reader
+	switch m.Name {
+	case "control.tar":
+		r = bytes.NewReader(m.Data)
+	case "control.tar.gz":
+		zr, err := gzip.NewReader(bytes.NewReader(m.Data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidPackage, m.Name, err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, nil
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%w: %s has no control file", ErrInvalidPackage, m.Name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidPackage, m.Name, err)
+		}
+		if path.Clean(strings.TrimPrefix(hdr.Name, "./")) == "control" {
+			return parseFields(tr)
+		}
+	}
+}
+
+// parseFields 解析 deb822 格式的单个段落，只保留单行字段
+func parseFields(r io.Reader) (map[string]string, error) {
+	fields := make(map[string]string)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			break
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			fields[key] = strings.TrimSpace(value)
+		}
+	}
+	return fields, sc.Err()
+}
+
+// nameFields 从 name_version_arch.deb 形式的文件名中取出字段，版本中的 %3a 还原为冒号
+func nameFields(filename string) (name, version, arch string) {
+	base := strings.TrimSuffix(filepath.Base(filename), ".deb")
+	parts := strings.Split(base, "_")
+	if len(parts) != 3 {
+		return "", "", ""
+	}
+	return parts[0], strings.ReplaceAll(parts[1], "%3a", ":"), parts[2]
+}
@@ -0,0 +1,190 @@
+// Package debdelta 把 bindiff 补丁封装为 debdelta 兼容的增量包，
+// 发行版镜像可以像发布 debdelta 生成的增量一样发布 bdiff 计算的增量
+package debdelta
+
+import (
+	"bindiff/core"
+	"bindiff/types"
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// debdelta 增量包的成员：info 记录新旧软件包，debpatch 在解包目录中以 sh -e 执行 patch.sh，
+// 脚本由 OLD.file 与 PATCH/ 下的其他成员生成 NEW.file
+const (
+	infoMember   = "info"
+	scriptMember = "patch.sh"
+	patchMember  = "patch.bdf"
+)
+
+// patchScript 调用目标系统上的 bdiff 还原新软件包，debpatch 随后按 info 中的 NEW/MD5sum 校验结果
+const patchScript = `#!/bin/sh -e
+# generated by bindiff; requires bdiff on the target system
+bdiff apply OLD.file PATCH/` + patchMember + ` -o NEW.file --progress=false
+`
+
+// ErrInvalidDelta 增量包不完整、已损坏或与旧软件包不匹配
+var ErrInvalidDelta = errors.New("invalid debdelta")
+
+// Info 增量包的 info 成员
+type Info struct {
+	Old, New Package
+}
+
+// Name 返回 debdelta 的命名约定 name_oldversion_newversion_arch.debdelta，版本中的冒号写作 %3a
+func (info *Info) Name() string {
+	escape := func(v string) string { return strings.ReplaceAll(v, ":", "%3a") }
+	return fmt.Sprintf("%s_%s_%s_%s.debdelta", info.New.Name, escape(info.Old.Version), escape(info.New.Version), info.New.Architecture)
+}
+
+// encode 写出 info 成员
+func (info *Info) encode() []byte {
+	var buf bytes.Buffer
+	for _, side := range []struct {
+		prefix string
+		p      *Package
+	}{{"OLD", &info.Old}, {"NEW", &info.New}} {
+		fmt.Fprintf(&buf, "%s/Package: %s\n", side.prefix, side.p.Name)
+		fmt.Fprintf(&buf, "%s/Version: %s\n", side.prefix, side.p.Version)
+		fmt.Fprintf(&buf, "%s/Architecture: %s\n", side.prefix, side.p.Architecture)
+		fmt.Fprintf(&buf, "%s/Size: %d\n", side.prefix, side.p.Size)
+		fmt.Fprintf(&buf, "%s/MD5sum: %s\n", side.prefix, side.p.MD5)
+	}
+	// 补丁以完整的旧 .deb 为基，不能从已安装的文件重建
+	buf.WriteString("needs-old\n")
+	return buf.Bytes()
+}
+
+// parseInfo 解析 info 成员
+func parseInfo(data []byte) (*Info, error) {
+	info := &Info{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), ": ")
+		if !ok {
+			continue
+		}
+		var p *Package
+		switch {
+		case strings.HasPrefix(key, "OLD/"):
+			p = &info.Old
+		case strings.HasPrefix(key, "NEW/"):
+			p = &info.New
+		default:
+			continue
+		}
+		var err error
+		switch key[4:] {
+		case "Package":
+			p.Name = value
+		case "Version":
+			p.Version = value
+		case "Architecture":
+			p.Architecture = value
+		case "Size":
+			p.Size, err = strconv.ParseInt(value, 10, 64)
+		case "MD5sum":
+			p.MD5 = value
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad %s: %v", ErrInvalidDelta, key, err)
+		}
+	}
+	if info.Old.MD5 == "" || info.New.MD5 == "" {
+		return nil, fmt.Errorf("%w: info lacks OLD/MD5sum or NEW/MD5sum", ErrInvalidDelta)
+	}
+	return info, nil
+}
+
+// Create 计算从 oldDeb 到 newDeb 的 bindiff 补丁并封装为 debdelta 增量包。
+// oldName 与 newName 为软件包文件名，control 成员无法解析时用于推断包名、版本与架构
+func Create(oldDeb, newDeb []byte, oldName, newName string, options *core.DiffOptions) ([]byte, *Info, error) {
+	oldPkg, err := ParsePackage(oldDeb, oldName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", oldName, err)
+	}
+	newPkg, err := ParsePackage(newDeb, newName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", newName, err)
+	}
+	if oldPkg.Name != newPkg.Name || oldPkg.Architecture != newPkg.Architecture {
+		return nil, nil, fmt.Errorf("cannot delta %s/%s against %s/%s", newPkg.Name, newPkg.Architecture, oldPkg.Name, oldPkg.Architecture)
+	}
+	patch, err := core.CreatePatchFile(oldDeb, newDeb, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := &Info{Old: *oldPkg, New: *newPkg}
+	return writeAr([]arMember{
+		{Name: infoMember, Data: info.encode()},
+		{Name: scriptMember, Data: []byte(patchScript)},
+		{Name: patchMember, Data: patch},
+	}), info, nil
+}
+
+// Apply 把增量包应用到旧软件包，功能上等同于 debpatch，但不需要执行 patch.sh。
+// 旧软件包与结果都按 info 中的大小与 MD5 校验
+func Apply(oldDeb, delta []byte, options *core.ApplyOptions) ([]byte, *Info, error) {
+	info, df, err := readDelta(delta)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !matches(oldDeb, info.Old) {
+		return nil, nil, fmt.Errorf("%w: old package is not %s %s (size or MD5 differs)", ErrInvalidDelta, info.Old.Name, info.Old.Version)
+	}
+	newDeb, err := core.ApplyDiffFile(oldDeb, df, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !matches(newDeb, info.New) {
+		return nil, nil, fmt.Errorf("%w: result does not match NEW/MD5sum", ErrInvalidDelta)
+	}
+	return newDeb, info, nil
+}
+
+// Inspect 读取增量包的 info 成员并检查内嵌补丁的结构
+func Inspect(delta []byte) (*Info, error) {
+	info, _, err := readDelta(delta)
+	return info, err
+}
+
+// readDelta 拆分增量包并解码内嵌的补丁文件
+func readDelta(delta []byte) (*Info, types.DiffFile, error) {
+	members, err := readAr(delta)
+	if err != nil {
+		return nil, types.DiffFile{}, fmt.Errorf("%w: %v", ErrInvalidDelta, err)
+	}
+	infoData := findMember(members, func(name string) bool { return name == infoMember })
+	patchData := findMember(members, func(name string) bool { return name == patchMember })
+	if infoData == nil || patchData == nil {
+		return nil, types.DiffFile{}, fmt.Errorf("%w: missing %s or %s (not generated by bindiff?)", ErrInvalidDelta, infoMember, patchMember)
+	}
+	info, err := parseInfo(infoData.Data)
+	if err != nil {
+		return nil, types.DiffFile{}, err
+	}
+	df, err := core.DecodeDiffFile(patchData.Data)
+	if err != nil {
+		return nil, types.DiffFile{}, fmt.Errorf("%w: %v", ErrInvalidDelta, err)
+	}
+	if err := core.ValidateDiffFile(df); err != nil {
+		return nil, types.DiffFile{}, fmt.Errorf("%w: %v", ErrInvalidDelta, err)
+	}
+	if int64(df.OldSize) != info.Old.Size || int64(df.NewSize) != info.New.Size {
+		return nil, types.DiffFile{}, fmt.Errorf("%w: patch sizes do not match info", ErrInvalidDelta)
+	}
+	return info, df, nil
+}
+
+// matches 检查数据的大小与 MD5 是否与 p 一致
+func matches(data []byte, p Package) bool {
+	sum := md5.Sum(data)
+	return int64(len(data)) == p.Size && hex.EncodeToString(sum[:]) == p.MD5
+}
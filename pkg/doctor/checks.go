@@ -0,0 +1,250 @@
+package doctor
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"bindiff/pkg/utils"
+	"bindiff/types"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// 黄金向量：goldenOld 经下列操作得到 goldenNew，编码结果的 SHA-256 固定。
+// 编码格式变化时需同时更新 goldenEncodedSHA256，旧版本写出的补丁可能无法再读取
+const (
+	goldenOld           = "The quick brown fox jumps over the lazy dog"
+	goldenNew           = "The sleek brown fox jumps over the lazy cat!"
+	goldenEncodedSHA256 = "75d36e7edf2a073a84951c92f57eea1142225aec6cefb181186270230e8ad785"
+)
+
+// goldenPatch 构造黄金向量的补丁文件
+func goldenPatch() (types.DiffFile, error) {
+	b := core.NewPatchBuilder([]byte(goldenOld)).SetNames("old.txt", "new.txt")
+	steps := []func() error{
+		func() error { return b.AppendCopy(0, 4) },
+		func() error { return b.AppendReplace(4, []byte("sleek")) },
+		func() error { return b.AppendCopy(9, 31) },
+		func() error { return b.AppendDelete(40, 3) },
+		func() error { return b.AppendInsert(43, []byte("cat!")) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return types.DiffFile{}, err
+		}
+	}
+	return b.Build()
+}
+
+// checkPatchFormat 编码黄金向量并与固定的摘要对照，再解码、重新编码确认往返一致
+func checkPatchFormat(ctx context.Context) (string, error) {
+	df, err := goldenPatch()
+	if err != nil {
+		return "", fmt.Errorf("failed to build golden patch: %w", err)
+	}
+	encoded := core.EncodeDiffFile(df)
+	sum := sha256.Sum256(encoded)
+	if got := hex.EncodeToString(sum[:]); got != goldenEncodedSHA256 {
+		return "", fmt.Errorf("golden patch encodes to sha256 %s, want %s", got, goldenEncodedSHA256)
+	}
+
+	decoded, err := core.DecodeDiffFile(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode golden patch: %w", err)
+	}
+	if err := core.ValidateDiffFile(decoded); err != nil {
+		return "", fmt.Errorf("decoded golden patch is invalid: %w", err)
+	}
+	if !bytes.Equal(core.EncodeDiffFile(decoded), encoded) {
+		return "", fmt.Errorf("golden patch changes after a decode/encode round trip")
+	}
+	return fmt.Sprintf("golden patch v%d, %d operations, %d bytes", decoded.Version, len(decoded.Diff), len(encoded)), nil
+}
+
+// pseudoRandom 与平台和 Go 版本无关的确定性伪随机数据（xorshift）
+func pseudoRandom(seed uint32, n int) []byte {
+	data := make([]byte, n)
+	x := seed
+	for i := range data {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		data[i] = byte(x)
+	}
+	return data
+}
+
+// applyVectors 生成差分与应用的输入：原地修改、头部插入（需要对齐）与截断
+func applyVectors() []struct {
+	name     string
+	old, new []byte
+} {
+	base := pseudoRandom(1, 256*1024)
+	edited := bytes.Clone(base)
+	for _, pos := range []int{100, 40000, 65535, 65536, 200000} {
+		copy(edited[pos:], "edited")
+	}
+	return []struct {
+		name     string
+		old, new []byte
+	}{
+		{"edited", base, edited},
+		{"shifted", base, append(pseudoRandom(2, 1000), base...)},
+		{"truncated", base, edited[:180000]},
+	}
+}
+
+// checkApply 应用黄金向量，再用当前配置对生成的数据差分、编解码并应用，结果须与新数据一致
+func checkApply(ctx context.Context, cfg *config.Config) (string, error) {
+	df, err := goldenPatch()
+	if err != nil {
+		return "", fmt.Errorf("failed to build golden patch: %w", err)
+	}
+	got, err := core.Apply([]byte(goldenOld), df.Diff, &core.ApplyOptions{Context: ctx})
+	if err != nil {
+		return "", fmt.Errorf("failed to apply golden patch: %w", err)
+	}
+	if string(got) != goldenNew {
+		return "", fmt.Errorf("golden patch produced %q, want %q", got, goldenNew)
+	}
+	if err := core.VerifyHash(df.HashAlgorithm, got, df.NewHash, nil); err != nil {
+		return "", fmt.Errorf("golden patch result: %w", err)
+	}
+
+	if cfg == nil {
+		cfg = config.DefaultConfig()
+	}
+	vectors := applyVectors()
+	for _, v := range vectors {
+		result, err := core.DiffFull(v.old, v.new, &core.DiffOptions{Config: cfg, Context: ctx})
+		if err != nil {
+			return "", fmt.Errorf("%s: diff failed: %w", v.name, err)
+		}
+		patches, err := core.DecodePatch(core.EncodePatch(result.Patches))
+		if err != nil {
+			return "", fmt.Errorf("%s: failed to decode patch: %w", v.name, err)
+		}
+		out, err := core.Apply(v.old, patches, &core.ApplyOptions{Config: cfg, Context: ctx})
+		if err != nil {
+			return "", fmt.Errorf("%s: apply failed: %w", v.name, err)
+		}
+		if !bytes.Equal(out, v.new) {
+			return "", fmt.Errorf("%s: applied output differs from the new data (%d vs %d bytes)", v.name, len(out), len(v.new))
+		}
+	}
+	return fmt.Sprintf("golden patch and %d generated vectors reproduce their output", len(vectors)), nil
+}
+
+// fftShift checkFFT 在旧数据前插入的字节数
+const fftShift = 100
+
+// checkFFT 检查实数 FFT 的往返误差，以及对齐能找到已知的偏移量
+func checkFFT(ctx context.Context, cfg *config.Config) (string, error) {
+	const n = 4096
+	input := make([]float64, n)
+	for i, b := range pseudoRandom(3, n) {
+		input[i] = float64(b)
+	}
+	rfft := core.NewRealFFT(n)
+	spectrum := make([]complex128, rfft.SpectrumLen())
+	rfft.Forward(input, spectrum)
+	recovered := make([]float64, n)
+	rfft.Inverse(spectrum, recovered)
+	maxErr := 0.0
+	for i := range input {
+		maxErr = math.Max(maxErr, math.Abs(recovered[i]-input[i]))
+	}
+	if maxErr > 1e-6 {
+		return "", fmt.Errorf("FFT round trip error %g exceeds 1e-6", maxErr)
+	}
+
+	oldData := pseudoRandom(4, 64*1024)
+	newData := append(pseudoRandom(5, fftShift), oldData...)
+	offset, err := core.ComputeOffsetWithContext(ctx, oldData, newData)
+	if err != nil {
+		return "", err
+	}
+	if offset != -fftShift {
+		return "", fmt.Errorf("FFT alignment found offset %d, want %d", offset, -fftShift)
+	}
+	detail := fmt.Sprintf("round trip error %.1e, offset %d recovered", maxErr, offset)
+
+	if cfg == nil || !cfg.EnableFFT {
+		return detail, warnf("alignment is disabled (enable_fft=false)")
+	}
+	align, err := core.ComputeAlignment(ctx, oldData, newData, cfg)
+	if err != nil {
+		return detail, fmt.Errorf("configured alignment failed: %w", err)
+	}
+	if align.Offset != -fftShift {
+		return detail, fmt.Errorf("configured alignment found offset %d, want %d", align.Offset, -fftShift)
+	}
+	return detail + fmt.Sprintf(", configured alignment confidence %.1f", align.Confidence), nil
+}
+
+// checkConfig 校验当前配置，并提示可能影响性能的设置
+func checkConfig(cfg *config.Config) (string, error) {
+	if cfg == nil {
+		return "", fmt.Errorf("no configuration loaded")
+	}
+	if err := cfg.Validate(); err != nil {
+		return "", err
+	}
+	detail := fmt.Sprintf("valid (workers=%d, block_size=%d, max_memory=%d MB)", cfg.MaxWorkers, cfg.BlockSize, cfg.MaxMemoryMB)
+	if cpus := runtime.NumCPU(); cfg.MaxWorkers > cpus {
+		return detail, warnf("max_workers %d exceeds the %d available CPUs", cfg.MaxWorkers, cpus)
+	}
+	if !cfg.IO.Fsync {
+		return detail, warnf("io.fsync is off, files written just before a crash may be lost")
+	}
+	return detail, nil
+}
+
+// checkFilesystem 在 dir 中确认临时文件能原子地重命名覆盖已有文件、目录能刷盘，
+// 且多文件事务能提交；检查文件在结束时删除
+func checkFilesystem(dir string) (string, error) {
+	if err := utils.EnsureDir(dir); err != nil {
+		return "", err
+	}
+	base := filepath.Join(dir, fmt.Sprintf(".doctor-%d", os.Getpid()))
+	defer os.Remove(base)
+	defer os.Remove(base + ".a")
+	defer os.Remove(base + ".b")
+
+	for _, content := range []string{"first", "second"} {
+		if err := utils.SafeWrite(base, []byte(content)); err != nil {
+			return "", fmt.Errorf("atomic write failed: %w", err)
+		}
+	}
+	if got, err := os.ReadFile(base); err != nil || string(got) != "second" {
+		return "", fmt.Errorf("rename over an existing file did not replace it (read %q, %v)", got, err)
+	}
+
+	txn := utils.NewTransaction(dir)
+	defer txn.Rollback()
+	for _, name := range []string{base + ".a", base + ".b"} {
+		if err := txn.Write(name, []byte(name)); err != nil {
+			return "", err
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		return "", fmt.Errorf("transaction commit failed: %w", err)
+	}
+	for _, name := range []string{base + ".a", base + ".b"} {
+		if got, err := os.ReadFile(name); err != nil || string(got) != name {
+			return "", fmt.Errorf("transaction did not write %s", name)
+		}
+	}
+
+	detail := "atomic rename and transactions work in " + dir
+	if err := utils.SyncDir(dir); err != nil {
+		return detail, warnf("directory sync not supported, renames may not survive a crash: %v", err)
+	}
+	return detail, nil
+}
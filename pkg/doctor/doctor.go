@@ -0,0 +1,152 @@
+// Package doctor 运行内置的自检：补丁编解码与应用的黄金向量、FFT 对齐、配置与运行环境、
+// 文件系统的原子重命名，用于快速排除环境问题
+package doctor
+
+import (
+	"bindiff/pkg/config"
+	"bindiff/pkg/i18n"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Status 检查结果
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+// Check 一项自检，Run 返回结果说明；返回 *Warning 时结果为警告
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) (string, error)
+}
+
+// Warning 检查通过但需要注意的情况
+type Warning struct {
+	Msg string
+}
+
+func (w *Warning) Error() string {
+	return w.Msg
+}
+
+// warnf 创建警告
+func warnf(format string, args ...interface{}) error {
+	return &Warning{Msg: fmt.Sprintf(format, args...)}
+}
+
+// Result 一项检查的结果
+type Result struct {
+	Name     string        `json:"name"`
+	Status   Status        `json:"status"`
+	Detail   string        `json:"detail,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Environment 运行环境
+type Environment struct {
+	GoVersion  string `json:"go_version"`
+	OS         string `json:"os"`
+	Arch       string `json:"arch"`
+	CPUs       int    `json:"cpus"`
+	GOMAXPROCS int    `json:"gomaxprocs"`
+	Language   string `json:"language"`
+	WorkDir    string `json:"work_dir"`
+	TempDir    string `json:"temp_dir"`
+	// ConfigFiles 按优先级从低到高找到的配置文件
+	ConfigFiles []string `json:"config_files"`
+	// EnvVars 已设置的 BINDIFF_* 环境变量名（不含值，避免泄露令牌）
+	EnvVars []string `json:"env_vars"`
+}
+
+// Report 自检报告
+type Report struct {
+	Environment Environment `json:"environment"`
+	Results     []Result    `json:"results"`
+}
+
+// Failed 返回失败的检查数
+func (r *Report) Failed() int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Status == StatusFail {
+			n++
+		}
+	}
+	return n
+}
+
+// DetectEnvironment 收集运行环境
+func DetectEnvironment() Environment {
+	env := Environment{
+		GoVersion:   runtime.Version(),
+		OS:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+		CPUs:        runtime.NumCPU(),
+		GOMAXPROCS:  runtime.GOMAXPROCS(0),
+		Language:    i18n.Language(),
+		TempDir:     os.TempDir(),
+		ConfigFiles: config.ConfigLayers(),
+	}
+	env.WorkDir, _ = os.Getwd()
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, "BINDIFF_") {
+			env.EnvVars = append(env.EnvVars, name)
+		}
+	}
+	sort.Strings(env.EnvVars)
+	return env
+}
+
+// Checks 返回全部内置检查，cfg 为当前配置，dir 为测试原子重命名的目录（通常是仓库目录）
+func Checks(cfg *config.Config, dir string) []Check {
+	return []Check{
+		{Name: "patch-format", Run: checkPatchFormat},
+		{Name: "apply", Run: func(ctx context.Context) (string, error) { return checkApply(ctx, cfg) }},
+		{Name: "fft", Run: func(ctx context.Context) (string, error) { return checkFFT(ctx, cfg) }},
+		{Name: "config", Run: func(ctx context.Context) (string, error) { return checkConfig(cfg) }},
+		{Name: "filesystem", Run: func(ctx context.Context) (string, error) { return checkFilesystem(dir) }},
+	}
+}
+
+// Run 依次运行检查并生成报告，检查中的 panic 记为失败，上下文取消后其余检查记为失败
+func Run(ctx context.Context, checks []Check) *Report {
+	report := &Report{Environment: DetectEnvironment()}
+	for _, c := range checks {
+		start := time.Now()
+		detail, err := runCheck(ctx, c)
+		res := Result{Name: c.Name, Status: StatusPass, Detail: detail, Duration: time.Since(start)}
+		var w *Warning
+		switch {
+		case errors.As(err, &w):
+			res.Status, res.Error = StatusWarn, w.Msg
+		case err != nil:
+			res.Status, res.Error = StatusFail, err.Error()
+		}
+		report.Results = append(report.Results, res)
+	}
+	return report
+}
+
+// runCheck 运行一项检查，把 panic 转为错误
+func runCheck(ctx context.Context, c Check) (detail string, err error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return c.Run(ctx)
+}
@@ -0,0 +1,263 @@
+package gitdelta
+
+import (
+	"bindiff/core"
+	"bindiff/types"
+	"errors"
+	"fmt"
+)
+
+// git 增量指令的限制
+const (
+	maxInsert = 0x7f     // 插入指令一次最多携带的字节数
+	maxCopy   = 0xffffff // 复制指令的长度最多 3 字节
+	maxOffset = 0xffffffff
+)
+
+// ErrInvalidDelta git 增量数据格式错误
+var ErrInvalidDelta = errors.New("invalid git delta")
+
+// encoder 生成 git 增量指令，相邻的复制与插入在写出前合并
+type encoder struct {
+	out        []byte
+	pending    []byte
+	copyOffset int
+	copyLen    int
+}
+
+// FromDiffFile 将 bindiff 补丁转换为 git 增量（OBJ_OFS_DELTA/OBJ_REF_DELTA 对象的内容）。
+// RAW 格式的操作直接转换为复制与插入指令；归档、gzip 等格式的补丁不以旧文件的字节区间描述新文件，
+// 先应用补丁得到新文件，再按字节重新差分。结果在返回前应用一次并与补丁中的新文件哈希比对
+func FromDiffFile(oldData []byte, df types.DiffFile, options *core.ApplyOptions) ([]byte, error) {
+	if err := core.VerifyHash(df.HashAlgorithm, oldData, df.OldHash, nil); err != nil {
+		return nil, fmt.Errorf("input file does not match patch source: %w", err)
+	}
+	if len(oldData) > maxOffset {
+		return nil, fmt.Errorf("%w: base larger than 4 GB", core.ErrPatchTooLarge)
+	}
+
+	patches := df.Diff
+	if df.Format != types.FORMAT_RAW {
+		newData, err := core.ApplyDiffFile(oldData, df, options)
+		if err != nil {
+			return nil, err
+		}
+		diffOptions := &core.DiffOptions{}
+		if options != nil {
+			diffOptions.Config, diffOptions.Context, diffOptions.Logger = options.Config, options.Context, options.Logger
+		}
+		if patches, err = core.DiffBytes(oldData, newData, diffOptions); err != nil {
+			return nil, err
+		}
+	}
+
+	delta, err := Encode(oldData, patches)
+	if err != nil {
+		return nil, err
+	}
+	newData, err := Apply(oldData, delta)
+	if err != nil {
+		return nil, err
+	}
+	if err := core.VerifyDiffFileResult(df, newData, nil); err != nil {
+		return nil, fmt.Errorf("converted delta does not reproduce the patch result: %w", err)
+	}
+	return delta, nil
+}
+
+// Encode 将 RAW 补丁操作转换为 git 增量，语义与 core.Apply 的严格模式相同：
+// 操作之间未覆盖的旧数据隐式复制，最后剩余的旧数据复制到结尾
+func Encode(oldData []byte, patches []types.Patch) ([]byte, error) {
+	var body encoder
+	cursor, newSize := 0, 0
+	copyOld := func(end int) {
+		if end > cursor {
+			body.copy(cursor, end-cursor)
+			newSize += end - cursor
+			cursor = end
+		}
+	}
+
+	for i, p := range patches {
+		if p.Offset < 0 || p.Length < 0 || int(p.Offset) > len(oldData) {
+			return nil, fmt.Errorf("%w: patch %d offset %d out of range", core.ErrCorruptPatch, i, p.Offset)
+		}
+		copyOld(int(p.Offset))
+		end := cursor + int(p.Length)
+		switch p.Op {
+		case types.OP_INSERT:
+			body.insert(p.Data)
+			newSize += len(p.Data)
+		case types.OP_REPLACE, types.OP_DELETE:
+			if end > len(oldData) {
+				return nil, fmt.Errorf("%w: patch %d length exceeds old data", core.ErrCorruptPatch, i)
+			}
+			cursor = end
+			if p.Op == types.OP_REPLACE {
+				body.insert(p.Data)
+				newSize += len(p.Data)
+			}
+		case types.OP_COPY, types.OP_MATCH:
+			if end > len(oldData) {
+				return nil, fmt.Errorf("%w: patch %d copy exceeds old data", core.ErrCorruptPatch, i)
+			}
+			copyOld(end)
+		default:
+			return nil, fmt.Errorf("%w: patch %d has unknown operation %d", core.ErrCorruptPatch, i, p.Op)
+		}
+	}
+	copyOld(len(oldData))
+	body.flush()
+
+	out := appendSize(nil, uint64(len(oldData)))
+	out = appendSize(out, uint64(newSize))
+	return append(out, body.out...), nil
+}
+
+// insert 记录插入的数据
+func (e *encoder) insert(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	e.flushCopy()
+	e.pending = append(e.pending, data...)
+}
+
+// copy 记录复制，与上一个复制相邻时合并
+func (e *encoder) copy(offset, length int) {
+	e.flushInsert()
+	if e.copyLen > 0 && e.copyOffset+e.copyLen == offset {
+		e.copyLen += length
+		return
+	}
+	e.flushCopy()
+	e.copyOffset, e.copyLen = offset, length
+}
+
+func (e *encoder) flush() {
+	e.flushInsert()
+	e.flushCopy()
+}
+
+// flushInsert 以最多 127 字节一条写出插入指令
+func (e *encoder) flushInsert() {
+	for len(e.pending) > 0 {
+		n := min(len(e.pending), maxInsert)
+		e.out = append(e.out, byte(n))
+		e.out = append(e.out, e.pending[:n]...)
+		e.pending = e.pending[n:]
+	}
+	e.pending = e.pending[:0]
+}
+
+// flushCopy 写出复制指令：操作码的低 4 位标记偏移的非零字节，随后 3 位标记长度的非零字节
+func (e *encoder) flushCopy() {
+	for e.copyLen > 0 {
+		n := min(e.copyLen, maxCopy)
+		cmd := len(e.out)
+		e.out = append(e.out, 0x80)
+		for i := 0; i < 4; i++ {
+			if b := byte(e.copyOffset >> (8 * i)); b != 0 {
+				e.out[cmd] |= 1 << i
+				e.out = append(e.out, b)
+			}
+		}
+		for i := 0; i < 3; i++ {
+			if b := byte(n >> (8 * i)); b != 0 {
+				e.out[cmd] |= 0x10 << i
+				e.out = append(e.out, b)
+			}
+		}
+		e.copyOffset += n
+		e.copyLen -= n
+	}
+}
+
+// appendSize 追加增量头中的大小：小端序 7 位一组，最高位表示后续还有字节
+func appendSize(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// readSize 读取增量头中的大小
+func readSize(delta []byte) (uint64, []byte, error) {
+	var v uint64
+	for shift := 0; shift < 64; shift += 7 {
+		if len(delta) == 0 {
+			break
+		}
+		c := delta[0]
+		delta = delta[1:]
+		v |= uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return v, delta, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("%w: truncated size header", ErrInvalidDelta)
+}
+
+// Apply 将 git 增量应用到 base，与 git 的 patch_delta 相同地检查所有边界
+func Apply(base, delta []byte) ([]byte, error) {
+	srcSize, delta, err := readSize(delta)
+	if err != nil {
+		return nil, err
+	}
+	if srcSize != uint64(len(base)) {
+		return nil, fmt.Errorf("%w: base is %d bytes, delta expects %d", ErrInvalidDelta, len(base), srcSize)
+	}
+	dstSize, delta, err := readSize(delta)
+	if err != nil {
+		return nil, err
+	}
+	// 结果不会超过每个指令字节产生的最大输出，防止伪造的大小导致过度分配
+	if dstSize > uint64(len(delta))*maxCopy {
+		return nil, fmt.Errorf("%w: result size %d is implausible", ErrInvalidDelta, dstSize)
+	}
+
+	out := make([]byte, 0, dstSize)
+	for len(delta) > 0 {
+		cmd := delta[0]
+		delta = delta[1:]
+		switch {
+		case cmd&0x80 != 0:
+			var offset, size uint64
+			for i := 0; i < 7; i++ {
+				if cmd&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, fmt.Errorf("%w: truncated copy instruction", ErrInvalidDelta)
+				}
+				if i < 4 {
+					offset |= uint64(delta[0]) << (8 * i)
+				} else {
+					size |= uint64(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) || uint64(len(out))+size > dstSize {
+				return nil, fmt.Errorf("%w: copy of %d bytes at %d out of range", ErrInvalidDelta, size, offset)
+			}
+			out = append(out, base[offset:offset+size]...)
+		case cmd != 0:
+			n := int(cmd)
+			if n > len(delta) || uint64(len(out)+n) > dstSize {
+				return nil, fmt.Errorf("%w: truncated insert instruction", ErrInvalidDelta)
+			}
+			out = append(out, delta[:n]...)
+			delta = delta[n:]
+		default:
+			return nil, fmt.Errorf("%w: reserved opcode 0", ErrInvalidDelta)
+		}
+	}
+	if uint64(len(out)) != dstSize {
+		return nil, fmt.Errorf("%w: result is %d bytes, delta declares %d", ErrInvalidDelta, len(out), dstSize)
+	}
+	return out, nil
+}
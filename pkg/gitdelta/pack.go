@@ -0,0 +1,76 @@
+package gitdelta
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+)
+
+// git 打包文件中的对象类型
+const (
+	objBlob     = 3
+	objOfsDelta = 6
+)
+
+// appendObjectHeader 追加打包对象头：首字节含类型与大小的低 4 位，之后每字节 7 位
+func appendObjectHeader(b []byte, typ byte, size uint64) []byte {
+	c := typ<<4 | byte(size&0x0f)
+	size >>= 4
+	for size > 0 {
+		b = append(b, c|0x80)
+		c = byte(size & 0x7f)
+		size >>= 7
+	}
+	return append(b, c)
+}
+
+// appendOfsOffset 追加 OBJ_OFS_DELTA 的基对象距离（git 的偏移编码：高位在前，每个后续字节隐含加 1）
+func appendOfsOffset(b []byte, distance uint64) []byte {
+	var buf [10]byte
+	pos := len(buf) - 1
+	buf[pos] = byte(distance & 0x7f)
+	for distance >>= 7; distance > 0; distance >>= 7 {
+		distance--
+		pos--
+		buf[pos] = byte(distance&0x7f) | 0x80
+	}
+	return append(b, buf[pos:]...)
+}
+
+// deflate 以 zlib 压缩对象内容
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// OfsDeltaEntry 返回打包文件中的一个 OBJ_OFS_DELTA 对象：对象头、与基对象起始位置的距离以及 zlib 压缩的增量
+func OfsDeltaEntry(distance uint64, delta []byte) []byte {
+	b := appendObjectHeader(nil, objOfsDelta, uint64(len(delta)))
+	b = appendOfsOffset(b, distance)
+	return append(b, deflate(delta)...)
+}
+
+// WritePack 写出包含两个对象的 git 打包文件（版本 2）：基文件作为 blob，新文件作为指向它的 OBJ_OFS_DELTA。
+// 可以用 git index-pack 建立索引后放入任意仓库的 objects/pack 目录
+func WritePack(w io.Writer, base, delta []byte) error {
+	pack := []byte("PACK")
+	pack = binary.BigEndian.AppendUint32(pack, 2)
+	pack = binary.BigEndian.AppendUint32(pack, 2)
+
+	baseStart := len(pack)
+	pack = appendObjectHeader(pack, objBlob, uint64(len(base)))
+	pack = append(pack, deflate(base)...)
+	pack = append(pack, OfsDeltaEntry(uint64(len(pack)-baseStart), delta)...)
+
+	sum := sha1.Sum(pack)
+	if _, err := w.Write(pack); err != nil {
+		return err
+	}
+	_, err := w.Write(sum[:])
+	return err
+}
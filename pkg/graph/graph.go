@@ -0,0 +1,244 @@
+// Package graph 维护版本图清单：发布的各版本（可整包下载）与版本之间可用的补丁。
+// Plan 根据客户端当前文件的哈希与目标版本求总下载量最小的补丁链，或判断整包下载更省
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// ErrUnknownVersion 版本不存在
+var ErrUnknownVersion = errors.New("unknown version")
+
+// Version 一个发布的版本
+type Version struct {
+	Name string `json:"name"`
+	// SHA256 文件内容的 SHA-256（十六进制），客户端以此说明当前版本
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	// URL 整包下载地址，为空时该版本不能整包下载
+	URL string `json:"url,omitempty"`
+}
+
+// Patch 从 From 版本到 To 版本的补丁
+type Patch struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Size int64  `json:"size"`
+	URL  string `json:"url,omitempty"`
+}
+
+// Graph 版本图，Versions 按发布顺序排列，最后一个为最新版本
+type Graph struct {
+	Versions []Version `json:"versions"`
+	Patches  []Patch   `json:"patches"`
+}
+
+// PlanOptions 求解选项
+type PlanOptions struct {
+	// StepCost 每多下载一个文件额外计入的字节数，用于在总量相近时偏向较短的补丁链
+	StepCost int64
+}
+
+// Plan 更新方案：Full 为 true 时整包下载 Target，否则依次应用 Steps
+type Plan struct {
+	// From 客户端当前的版本，当前哈希不在图中时为空
+	From   string  `json:"from,omitempty"`
+	Target Version `json:"target"`
+	Full   bool    `json:"full"`
+	Steps  []Patch `json:"steps,omitempty"`
+	// Size 需要下载的总字节数
+	Size int64 `json:"size"`
+}
+
+// Load 读取版本图，文件不存在时返回空图
+func Load(path string) (*Graph, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Graph{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Read 解析并校验版本图
+func Read(r io.Reader) (*Graph, error) {
+	var g Graph
+	if err := json.NewDecoder(r).Decode(&g); err != nil {
+		return nil, fmt.Errorf("invalid version graph: %w", err)
+	}
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// Validate 检查版本名与哈希唯一、补丁引用的版本存在
+func (g *Graph) Validate() error {
+	names := map[string]bool{}
+	hashes := map[string]bool{}
+	for _, v := range g.Versions {
+		if v.Name == "" || len(v.SHA256) != 64 || v.Size < 0 {
+			return fmt.Errorf("invalid version graph: bad version %q", v.Name)
+		}
+		if names[v.Name] || hashes[strings.ToLower(v.SHA256)] {
+			return fmt.Errorf("invalid version graph: duplicate version %q", v.Name)
+		}
+		names[v.Name] = true
+		hashes[strings.ToLower(v.SHA256)] = true
+	}
+	for _, p := range g.Patches {
+		if !names[p.From] || !names[p.To] || p.From == p.To || p.Size < 0 {
+			return fmt.Errorf("invalid version graph: bad patch %s -> %s", p.From, p.To)
+		}
+	}
+	return nil
+}
+
+// Save 写出版本图
+func (g *Graph) Save(w io.Writer) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Version 按名称查找版本，name 为空或 "latest" 时返回最新版本
+func (g *Graph) Version(name string) (Version, error) {
+	if (name == "" || name == "latest") && len(g.Versions) > 0 {
+		return g.Versions[len(g.Versions)-1], nil
+	}
+	for _, v := range g.Versions {
+		if v.Name == name {
+			return v, nil
+		}
+	}
+	return Version{}, fmt.Errorf("%w: %q", ErrUnknownVersion, name)
+}
+
+// ByHash 按文件哈希查找版本
+func (g *Graph) ByHash(sha256 string) (Version, bool) {
+	for _, v := range g.Versions {
+		if strings.EqualFold(v.SHA256, sha256) {
+			return v, true
+		}
+	}
+	return Version{}, false
+}
+
+// AddVersion 添加版本，同名版本已存在时替换
+func (g *Graph) AddVersion(v Version) error {
+	for i := range g.Versions {
+		if g.Versions[i].Name == v.Name {
+			g.Versions[i] = v
+			return g.Validate()
+		}
+	}
+	g.Versions = append(g.Versions, v)
+	return g.Validate()
+}
+
+// AddPatch 添加补丁，同一对版本的补丁已存在时替换
+func (g *Graph) AddPatch(p Patch) error {
+	for i := range g.Patches {
+		if g.Patches[i].From == p.From && g.Patches[i].To == p.To {
+			g.Patches[i] = p
+			return g.Validate()
+		}
+	}
+	g.Patches = append(g.Patches, p)
+	return g.Validate()
+}
+
+// Plan 求从哈希为 fromHash 的文件更新到 target 版本的方案：在补丁图上以下载字节数（加 StepCost）
+// 为边权求最短路径，与整包下载比较取较小者。当前哈希不在图中时只能整包下载；
+// 已是目标版本时返回没有步骤的方案
+func (g *Graph) Plan(fromHash, target string, opts *PlanOptions) (*Plan, error) {
+	if opts == nil {
+		opts = &PlanOptions{}
+	}
+	to, err := g.Version(target)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{Target: to}
+	from, ok := g.ByHash(fromHash)
+	if ok {
+		plan.From = from.Name
+		if from.Name == to.Name {
+			return plan, nil
+		}
+		if steps := g.shortest(from.Name, to.Name, opts); steps != nil {
+			plan.Steps = steps
+			for _, p := range steps {
+				plan.Size += p.Size
+			}
+		}
+	}
+
+	fullCost := int64(math.MaxInt64)
+	if to.URL != "" {
+		fullCost = to.Size + opts.StepCost
+	}
+	if plan.Steps == nil || fullCost <= plan.Size+int64(len(plan.Steps))*opts.StepCost {
+		if to.URL == "" {
+			return nil, fmt.Errorf("no patch chain to %s and no full download available", to.Name)
+		}
+		return &Plan{From: plan.From, Target: to, Full: true, Size: to.Size}, nil
+	}
+	return plan, nil
+}
+
+// shortest 以 Dijkstra 求 from 到 to 代价最小的补丁链，不可达时返回 nil
+func (g *Graph) shortest(from, to string, opts *PlanOptions) []Patch {
+	type state struct {
+		cost int64
+		via  int // 到达该版本的补丁下标
+		done bool
+	}
+	states := map[string]*state{from: {via: -1}}
+	for {
+		// 版本数量不大，线性查找未完成的最小代价版本
+		var cur string
+		var best *state
+		for name, s := range states {
+			if !s.done && (best == nil || s.cost < best.cost) {
+				cur, best = name, s
+			}
+		}
+		if best == nil {
+			return nil
+		}
+		if cur == to {
+			break
+		}
+		best.done = true
+		for i, p := range g.Patches {
+			if p.From != cur {
+				continue
+			}
+			cost := best.cost + p.Size + opts.StepCost
+			if s, ok := states[p.To]; !ok || (!s.done && cost < s.cost) {
+				states[p.To] = &state{cost: cost, via: i}
+			}
+		}
+	}
+
+	var chain []Patch
+	for name := to; name != from; {
+		p := g.Patches[states[name].via]
+		chain = append([]Patch{p}, chain...)
+		name = p.From
+	}
+	return chain
+}
@@ -0,0 +1,94 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Handler 以 REST 回答更新方案查询，版本图文件修改后自动重新加载：
+//
+//	GET /v1/versions                           返回版本图
+//	GET /v1/plan?from=<sha256>&to=<version>    返回 Plan，to 省略时为最新版本
+//
+// 可选参数 step_cost 覆盖 Options.StepCost
+type Handler struct {
+	// Path 版本图文件
+	Path    string
+	Options PlanOptions
+
+	mu      sync.Mutex
+	graph   *Graph
+	modTime time.Time
+}
+
+// Graph 返回当前的版本图，文件修改时间变化时重新读取
+func (h *Handler) Graph() (*Graph, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fi, err := os.Stat(h.Path)
+	if err != nil {
+		return nil, err
+	}
+	if h.graph == nil || !fi.ModTime().Equal(h.modTime) {
+		g, err := Load(h.Path)
+		if err != nil {
+			return nil, err
+		}
+		h.graph, h.modTime = g, fi.ModTime()
+	}
+	return h.graph, nil
+}
+
+// ServeHTTP 分派查询，错误以 {"error": "..."} 返回
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	g, err := h.Graph()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	switch r.URL.Path {
+	case "/v1/versions":
+		writeJSON(w, http.StatusOK, g)
+	case "/v1/plan":
+		q := r.URL.Query()
+		opts := h.Options
+		if v := q.Get("step_cost"); v != "" {
+			if opts.StepCost, err = strconv.ParseInt(v, 10, 64); err != nil || opts.StepCost < 0 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid step_cost %q", v))
+				return
+			}
+		}
+		plan, err := g.Plan(q.Get("from"), q.Get("to"), &opts)
+		switch {
+		case errors.Is(err, ErrUnknownVersion):
+			writeError(w, http.StatusNotFound, err)
+		case err != nil:
+			writeError(w, http.StatusUnprocessableEntity, err)
+		default:
+			writeJSON(w, http.StatusOK, plan)
+		}
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown path %s", r.URL.Path))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,130 @@
+// Package i18n 提供命令行输出的消息目录。消息以英文原文为键（与 gettext 相同），
+// 当前语言没有译文时原样输出英文。错误信息与机器可读输出（--json、JSONL 进度）不翻译
+package i18n
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// 支持的语言
+const (
+	English = "en"
+	Chinese = "zh"
+)
+
+// Languages 支持的语言
+var Languages = []string{English, Chinese}
+
+// catalogs 各语言的译文，英文没有目录
+var catalogs = map[string]map[string]string{
+	Chinese: zh,
+}
+
+// current 当前语言
+var current = struct {
+	sync.RWMutex
+	lang string
+}{lang: English}
+
+// SetLanguage 设置输出语言。lang 为空时按环境变量检测（见 Detect），
+// 也接受 zh_CN.UTF-8 这类区域设置；不支持的语言返回错误
+func SetLanguage(lang string) error {
+	if lang == "" {
+		lang = Detect()
+	}
+	normalized, ok := normalize(lang)
+	if !ok {
+		return fmt.Errorf("unsupported language %q (%s)", lang, strings.Join(Languages, ", "))
+	}
+	current.Lock()
+	current.lang = normalized
+	current.Unlock()
+	return nil
+}
+
+// Language 返回当前语言
+func Language() string {
+	current.RLock()
+	defer current.RUnlock()
+	return current.lang
+}
+
+// Detect 按 LC_ALL、LC_MESSAGES、LANG 的顺序（与 POSIX 相同）检测语言，
+// 未设置、为 C/POSIX 或不支持时返回英文
+func Detect() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		if lang, ok := normalize(value); ok {
+			return lang
+		}
+		return English
+	}
+	return English
+}
+
+// normalize 把 zh_CN.UTF-8、zh-Hans、EN 这类写法归一为支持的语言代码
+func normalize(locale string) (string, bool) {
+	lang := strings.ToLower(locale)
+	if i := strings.IndexAny(lang, "_-.@"); i >= 0 {
+		lang = lang[:i]
+	}
+	switch lang {
+	case "c", "posix":
+		return English, true
+	case English, Chinese:
+		return lang, true
+	}
+	return "", false
+}
+
+// T 返回消息在当前语言下的译文
+func T(msg string) string {
+	current.RLock()
+	catalog := catalogs[current.lang]
+	current.RUnlock()
+	if s, ok := catalog[msg]; ok {
+		return s
+	}
+	return msg
+}
+
+// Catalog 返回语言的译文副本（英文原文到译文），英文或不支持的语言返回空表
+func Catalog(lang string) map[string]string {
+	catalog := make(map[string]string, len(catalogs[lang]))
+	for k, v := range catalogs[lang] {
+		catalog[k] = v
+	}
+	return catalog
+}
+
+// Sprintf 翻译格式串后格式化
+func Sprintf(format string, args ...interface{}) string {
+	return fmt.Sprintf(T(format), args...)
+}
+
+// Printf 翻译格式串后写到标准输出
+func Printf(format string, args ...interface{}) {
+	fmt.Printf(T(format), args...)
+}
+
+// Println 翻译消息后写到标准输出并换行
+func Println(msg string) {
+	fmt.Println(T(msg))
+}
+
+// Fprintf 翻译格式串后写到 w
+func Fprintf(w io.Writer, format string, args ...interface{}) {
+	fmt.Fprintf(w, T(format), args...)
+}
+
+// Fprintln 翻译消息后写到 w 并换行
+func Fprintln(w io.Writer, msg string) {
+	fmt.Fprintln(w, T(msg))
+}
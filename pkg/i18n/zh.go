@@ -0,0 +1,275 @@
+package i18n
+
+// zh 简体中文译文，键为英文原文（含格式动词与换行），动词顺序不同时使用 %[n] 写法
+var zh = map[string]string{
+	// diff、apply 与 verify
+	"\n✓ Patch file generated: %s\n":           "\n✓ 补丁文件已生成: %s\n",
+	"\n✓ Patch applied successfully: %s\n":     "\n✓ 补丁应用成功: %s\n",
+	"\n✓ Patch is valid: %s\n":                 "\n✓ 补丁有效: %s\n",
+	"  Original size: %s\n":                    "  原始大小: %s\n",
+	"  Result size: %s\n":                      "  结果大小: %s\n",
+	"  Patch size: %s\n":                       "  补丁大小: %s\n",
+	"  Compression: %.2f%%\n":                  "  压缩率: %.2f%%\n",
+	"  Processing time: %s\n":                  "  处理时间: %s\n",
+	"  Patches generated: %d\n":                "  生成补丁数: %d\n",
+	"  Patches applied: %d\n":                  "  应用补丁数: %d\n",
+	"  Patch entries: %d\n":                    "  补丁条目: %d\n",
+	"  Peak memory: %s heap, %s RSS\n":         "  内存峰值: 堆 %s, RSS %s\n",
+	"  Operation ID: %s\n":                     "  操作 ID: %s\n",
+	"  ✓ Hash verification: PASSED\n":          "  ✓ 哈希校验: 通过\n",
+	"  ✓ Source hash: PASSED\n":                "  ✓ 源文件哈希: 通过\n",
+	"  ✓ Result hash: PASSED\n":                "  ✓ 结果文件哈希: 通过\n",
+	"  Version: %d\n":                          "  版本: %d\n",
+	"  Hash algorithm: %s\n":                   "  哈希算法: %s\n",
+	"  Format: archive (entry-by-entry)\n":     "  格式: 归档（逐条目）\n",
+	"  Format: disk image (partition-aware)\n": "  格式: 磁盘镜像（按分区）\n",
+	"  Format: sqlite (page-level)\n":          "  格式: SQLite（页级）\n",
+	"  Format: %s executable (%d regions)\n":   "  格式: %s 可执行文件（%d 个区域）\n",
+	"  Format: gzip (recompression-aware)\n":   "  格式: gzip（重新压缩）\n",
+	"  Merkle tree: %d blocks of %s\n":         "  Merkle 树: %d 块，每块 %s\n",
+	"  Merkle root: %x\n":                      "  Merkle 根: %x\n",
+
+	// repo
+	"✓ %d file(s) changed\n": "✓ %d 个文件有变化\n",
+	"version %d  %s\n":       "版本 %d  %s\n",
+	"  Date: %s\n":           "  日期: %s\n",
+	"  Size: %s\n":           "  大小: %s\n",
+	"  Stored as: %s\n":      "  存储方式: %s\n",
+	"  Object size: %s\n":    "  对象大小: %s\n",
+	"  Chain depth: %d\n":    "  链深度: %d\n",
+	"\n%d versions: %d full, %d delta, max chain depth %d\n": "\n%d 个版本: %d 个完整, %d 个增量, 最大链深度 %d\n",
+	"Stored %s for %s of content\n":                          "以 %s 存储了 %s 的内容\n",
+	"✓ Restored %s (%s)\n":                                   "✓ 已恢复 %s (%s)\n",
+	"Checked %d file(s), %d version(s), %d object(s)\n":      "已检查 %d 个文件, %d 个版本, %d 个对象\n",
+	"%d unreferenced object(s)\n":                            "%d 个未引用的对象\n",
+	"✓ Repository is consistent":                             "✓ 仓库一致",
+	"✓ Working tree matches the repository":                  "✓ 工作目录与仓库一致",
+	"  %d operation(s), +%s -%s, delta %s\n":                 "  %d 个操作, +%s -%s, 增量 %s\n",
+	"✓ Exported %d file(s) to %s\n":                          "✓ 已导出 %d 个文件到 %s\n",
+	"✓ Imported %d file(s) from %s\n":                        "✓ 已从 %[2]s 导入 %[1]d 个文件\n",
+	"✓ Deleted tag %s\n":                                     "✓ 已删除标签 %s\n",
+	"✓ Tagged %d file(s) as %s\n":                            "✓ 已将 %d 个文件标记为 %s\n",
+	"✓ Channel %s now points to %s\n":                        "✓ 通道 %s 现在指向 %s\n",
+
+	// restore 与 audit
+	"✓ Restored %s from %s\n":               "✓ 已从 %[2]s 恢复 %[1]s\n",
+	"No backups of %s\n":                    "%s 没有备份\n",
+	"✓ %s: %d records, hash chain intact\n": "✓ %s: %d 条记录, 哈希链完整\n",
+
+	// 其他格式与服务
+	"✓ Signature written: %s (%d bytes)\n":                                                 "✓ 签名已写入: %s (%d 字节)\n",
+	"✓ Delta written: %s (%d bytes)\n":                                                     "✓ 增量已写入: %s (%d 字节)\n",
+	"✓ Patched file written: %s (%d bytes)\n":                                              "✓ 更新后的文件已写入: %s (%d 字节)\n",
+	"✓ Git delta written: %s (%s)\n":                                                       "✓ Git 增量已写入: %s (%s)\n",
+	"✓ Packfile written: %s (%s)\n":                                                        "✓ Packfile 已写入: %s (%s)\n",
+	"✓ Index written: %s (%d blocks, %d bytes)\n":                                          "✓ 索引已写入: %s (%d 个块, %d 字节)\n",
+	"✓ %s reconstructed (%d bytes reused, %d bytes downloaded in %d request(s))\n":         "✓ %s 已重建 (复用 %d 字节, 通过 %[4]d 次请求下载 %[3]d 字节)\n",
+	"✓ Bundle written: %s (%d added, %d modified, %d renamed, %d removed, %d unchanged)\n": "✓ 增量包已写入: %s (新增 %d, 修改 %d, 重命名 %d, 删除 %d, 未变 %d)\n",
+	"✓ %s updated (%d file(s) in manifest)\n":                                              "✓ %s 已更新 (清单中 %d 个文件)\n",
+	"✓ Serving bindiff.v1.BinDiff on %s\n":                                                 "✓ 在 %s 上提供 bindiff.v1.BinDiff 服务\n",
+	"✓ Serving REST API on %s\n":                                                           "✓ 在 %s 上提供 REST API\n",
+	"✓ Debdelta written: %s (%s, new package %s)\n":                                        "✓ Debdelta 已写入: %s (%s, 新包 %s)\n",
+	"✓ %s %s written: %s (%s)\n":                                                           "✓ %s %s 已写入: %s (%s)\n",
+	"✓ Static delta written: %s (%s, %d part(s), %d object(s), %d sent as patches)\n":      "✓ 静态增量已写入: %s (%s, %d 个分片, %d 个对象, %d 个以补丁发送)\n",
+	"✓ Commit %s imported (%d object(s))\n":                                                "✓ 提交 %s 已导入 (%d 个对象)\n",
+	"✓ Bundle written: %s (%d layer(s), %s of %s)\n":                                       "✓ 增量包已写入: %s (%d 层, %s / %s)\n",
+	"✓ Image %s written to %s\n":                                                           "✓ 镜像 %s 已写入 %s\n",
+	"✓ Key pair written: %s, %s\n":                                                         "✓ 密钥对已写入: %s, %s\n",
+	"✓ Signature written: %s\n":                                                            "✓ 签名已写入: %s\n",
+	"✓ %s updated: %s -> %s (patch %s)\n":                                                  "✓ %s 已更新: %s -> %s (补丁 %s)\n",
+	"✓ Version %s added (%s)\n":                                                            "✓ 已添加版本 %s (%s)\n",
+	"✓ Patch %s -> %s added (%s)\n":                                                        "✓ 已添加补丁 %s -> %s (%s)\n",
+	"✓ Full download of %s: %s\n":                                                          "✓ 完整下载 %s: %s\n",
+	"✓ Already at %s\n":                                                                    "✓ 已是 %s\n",
+	"✓ %s -> %s in %d patch(es): %s (full download %s)\n":                                  "✓ %s -> %s 需要 %d 个补丁: %s (完整下载 %s)\n",
+	"✓ Manifest written: %s/%s%s (%d chunks)\n":                                            "✓ 清单已写入: %s/%s%s (%d 个块)\n",
+	"  Uploaded: %d chunks (%s), already present: %d\n":                                    "  已上传: %d 个块 (%s), 已存在: %d\n",
+	"✓ %s reconstructed (%s reused, %d chunk(s) downloaded, %s)\n":                         "✓ %s 已重建 (复用 %s, 下载 %d 个块, %s)\n",
+	"  From peers: %s\n":                                                                   "  来自对等节点: %s\n",
+	"✓ Seeding %d chunks on %s\n":                                                          "✓ 在 %[2]s 上提供 %[1]d 个块\n",
+
+	// config show 与 version
+	"Current Configuration:\n":                "当前配置:\n",
+	"  Block Size: %d bytes\n":                "  块大小: %d 字节\n",
+	"  Min Match Length: %d bytes\n":          "  最小匹配长度: %d 字节\n",
+	"  Max Memory: %d MB\n":                   "  内存上限: %d MB\n",
+	"  Auto Tune: %t\n":                       "  自动调优: %t\n",
+	"  Max Workers: %d\n":                     "  最大工作线程: %d\n",
+	"  Enable FFT: %t\n":                      "  启用 FFT: %t\n",
+	"  FFT Precision: %s\n":                   "  FFT 精度: %s\n",
+	"  Align Strategy: %s\n":                  "  对齐策略: %s\n",
+	"  Align Samples: %d x %d bytes\n":        "  对齐采样: %d x %d 字节\n",
+	"  Correlation Backend: %s\n":             "  相关性计算后端: %s\n",
+	"  Use Parallel: %t\n":                    "  并行处理: %t\n",
+	"  Show Progress: %t (%s)\n":              "  显示进度: %t (%s)\n",
+	"  Log Level: %s\n":                       "  日志级别: %s\n",
+	"  Repo Dir: %s\n":                        "  仓库目录: %s\n",
+	"  Repo Snapshot Interval: %d\n":          "  仓库快照间隔: %d\n",
+	"  Repo Chunking: %t\n":                   "  仓库分块: %t\n",
+	"  Hash Algorithm: %s\n":                  "  哈希算法: %s\n",
+	"  Durable Writes (fsync): %t\n":          "  持久写入 (fsync): %t\n",
+	"  Language: %s\n":                        "  语言: %s\n",
+	"  Audit: enabled=%t path=%s syslog=%t\n": "  审计: enabled=%t path=%s syslog=%t\n",
+	"  Log File Rotation: %d MB, %d days, %d backups, compress=%t\n":                      "  日志文件轮转: %d MB, %d 天, %d 个备份, compress=%t\n",
+	"  Apply Limits: output=%d MB op=%d MB ops=%d (0 = unlimited)\n":                      "  应用上限: 输出 %d MB, 单个操作 %d MB, 操作数 %d（0 表示不限制）\n",
+	"  Backups: original=%t keep=%d max_age_days=%d\n":                                    "  备份: original=%t keep=%d max_age_days=%d\n",
+	"  Profile %s: strategy=%s block_size=%d min_match_length=%d align=%s auto_tune=%t\n": "  配置档 %s: strategy=%s block_size=%d min_match_length=%d align=%s auto_tune=%t\n",
+	"BindDiff v2.0 - Enhanced Binary Diff Tool":                                           "BindDiff v2.0 - 增强型二进制差分工具",
+	"Features:":                            "功能:",
+	"  - FFT-based alignment optimization": "  - 基于 FFT 的对齐优化",
+	"  - Parallel processing support":      "  - 并行处理",
+	"  - Advanced hash-based matching":     "  - 基于哈希的高级匹配",
+	"  - Progress tracking and logging":    "  - 进度跟踪与日志",
+	"  - Configurable compression":         "  - 可配置的压缩",
+
+	// doctor
+	"Environment:\n": "运行环境:\n",
+	"  Go: %s %s/%s, %d CPUs (GOMAXPROCS %d)\n": "  Go: %s %s/%s, %d 个 CPU (GOMAXPROCS %d)\n",
+	"  Working directory: %s\n":                 "  工作目录: %s\n",
+	"  Temp directory: %s\n":                    "  临时目录: %s\n",
+	"  Config files: %s\n":                      "  配置文件: %s\n",
+	"  Environment variables: %s\n":             "  环境变量: %s\n",
+	"\nChecks:\n":                               "\n检查项:\n",
+	"\n✓ All %d checks passed\n":                "\n✓ 全部 %d 项检查通过\n",
+	"none":                                      "无",
+
+	// 日志
+	"BindDiff v2.0 started with config: workers=%d, fft=%t, parallel=%t": "BindDiff v2.0 已启动，配置: workers=%d, fft=%t, parallel=%t",
+	"Command execution failed: %v":                                       "命令执行失败: %v",
+	"Default configuration saved to %s":                                  "默认配置已保存到 %s",
+	"Starting diff operation: %s -> %s":                                  "开始 diff 操作: %s -> %s",
+	"Starting apply operation: %s + %s":                                  "开始 apply 操作: %s + %s",
+	"File sizes: old=%s, new=%s":                                         "文件大小: 旧=%s, 新=%s",
+	"File sizes: original=%s, patch=%s":                                  "文件大小: 原始=%s, 补丁=%s",
+	"Diff completed in %v":                                               "差分完成，用时 %v",
+	"Diff operation completed in %v":                                     "diff 操作完成，用时 %v",
+	"Apply operation completed in %v":                                    "apply 操作完成，用时 %v",
+	"Streaming diff completed in %v":                                     "流式差分完成，用时 %v",
+	"Patch applied in %v":                                                "补丁应用完成，用时 %v",
+	"Patch applied through WriterAt in %v":                               "补丁通过 WriterAt 应用完成，用时 %v",
+	"Streaming patch applied in %v":                                      "流式补丁应用完成，用时 %v",
+	"Compression ratio: %.2f%%":                                          "压缩率: %.2f%%",
+	"Generated %d patches, offset=%d (confidence %.2f)":                  "生成 %d 个补丁，偏移=%d (置信度 %.2f)",
+	"Patch info: %d patches, offset=%d":                                  "补丁信息: %d 个补丁，偏移=%d",
+	"Patch info: %s patch data, hash %s":                                 "补丁信息: %s 补丁数据，哈希 %s",
+	"Verification hash: %s":                                              "校验哈希: %s",
+	"Verifying original file hash (%s)...":                               "正在校验原始文件哈希 (%s)...",
+	"Verifying patch %s":                                                 "正在校验补丁 %s",
+	"Writing result to %s":                                               "正在写入结果到 %s",
+	"Streaming result to %s":                                             "正在流式写入结果到 %s",
+	"Original file backed up to %s":                                      "原始文件已备份到 %s",
+	"Current file backed up to %s":                                       "当前文件已备份到 %s",
+	"Restored %s from %s":                                                "已从 %[2]s 恢复 %[1]s",
+	"Removed partial output %s":                                          "已删除不完整的输出 %s",
+	"Alignment confidence %.2f below %.2f, using offset 0 instead of %d": "对齐置信度 %.2f 低于 %.2f，使用偏移 0 而不是 %d",
+	"Auto-tuned block size %d, min match length %d (estimated patch %s)": "自动调优: 块大小 %d，最小匹配长度 %d (预计补丁 %s)",
+	"Memory budget %s: block size %d, %d workers":                        "内存预算 %s: 块大小 %d，%d 个工作线程",
+	"Computing archive-aware diff...":                                    "正在计算归档感知差分...",
+	"Computing page-level SQLite diff...":                                "正在计算 SQLite 页级差分...",
+	"Computing partition-aware disk image diff...":                       "正在计算按分区的磁盘镜像差分...",
+	"Computing recompression-aware gzip diff...":                         "正在计算重新压缩感知的 gzip 差分...",
+	"Computing section-aware executable diff...":                         "正在计算按节的可执行文件差分...",
+	"Archive diff: %d entries, %d matched, %d segments":                  "归档差分: %d 个条目，%d 个匹配，%d 个片段",
+	"Disk image diff (%s): %d partitions, %d moved, %d modified, %d zero, %d literal blocks": "磁盘镜像差分 (%s): %d 个分区，%d 个移动，%d 个修改，%d 个零块，%d 个字面块",
+	"Executable diff (%s): %d regions, %d matched":                                           "可执行文件差分 (%s): %d 个区域，%d 个匹配",
+	"Gzip diff: %d -> %d uncompressed bytes, level %d":                                       "gzip 差分: 解压后 %d -> %d 字节，级别 %d",
+	"SQLite diff: page size %d, %d moved, %d modified, %d literal pages":                     "SQLite 差分: 页大小 %d，%d 个移动，%d 个修改，%d 个字面页",
+	"Directory diff: %d files compared":                                                      "目录差分: 比较了 %d 个文件",
+	"Directory diff: %d files compared, %d renames detected":                                 "目录差分: 比较了 %d 个文件，检测到 %d 个重命名",
+	"Committed %s (%s object %s)":                                                            "已提交 %s (%s 对象 %s)",
+	"%s from %s completed in %v":                                                             "%s (来自 %s) 完成，用时 %v",
+	"%s from %s failed: %v":                                                                  "%s (来自 %s) 失败: %v",
+	"Job %s (%s) succeeded in %v":                                                            "任务 %s (%s) 成功，用时 %v",
+	"Job %s (%s) failed: %v":                                                                 "任务 %s (%s) 失败: %v",
+	"Resuming %d unfinished job(s)":                                                          "恢复 %d 个未完成的任务",
+	"Skipping unreadable job %s: %v":                                                         "跳过无法读取的任务 %s: %v",
+	"REST API listening on %s, jobs in %s":                                                   "REST API 监听 %s，任务目录 %s",
+	"gRPC service listening on %s":                                                           "gRPC 服务监听 %s",
+	"Metrics listening on %s":                                                                "指标服务监听 %s",
+	"Metrics listener on %s stopped: %v":                                                     "指标服务 %s 已停止: %v",
+	"Exporting traces to %s":                                                                 "正在导出追踪数据到 %s",
+	"Failed to export remaining spans: %v":                                                   "导出剩余的 span 失败: %v",
+	"Seeding %d chunks on %s":                                                                "在 %[2]s 上提供 %[1]d 个块",
+	"Sending job events to %d webhook(s)":                                                    "任务事件发送到 %d 个 webhook",
+	"Shutting down...":                                                                       "正在关闭...",
+	"Audit: %v":                                                                              "审计: %v",
+	"Block index needs %s, more than the %s memory budget":                                   "块索引需要 %s，超过 %s 的内存预算",
+	"Heap use above the %s memory budget, reducing diff concurrency":                         "堆内存超过 %s 的预算，降低差分并发度",
+	"Copy operation exceeds old data bounds, truncating":                                     "复制操作超出旧数据范围，已截断",
+	"Patch offset %d exceeds old data length %d, skipping":                                   "补丁偏移 %d 超出旧数据长度 %d，已跳过",
+	"Patch has negative offset %d or length %d, skipping":                                    "补丁的偏移 %d 或长度 %d 为负数，已跳过",
+	"Unknown patch operation: %d":                                                            "未知的补丁操作: %d",
+	"FFT size %d is not a power of 2, performance may be suboptimal":                         "FFT 大小 %d 不是 2 的幂，性能可能不理想",
+	"Diff operation cancelled":                                                               "diff 操作已取消",
+	"Diff operation failed: %v":                                                              "diff 操作失败: %v",
+	"Streaming diff cancelled":                                                               "流式差分已取消",
+	"Patch application cancelled":                                                            "补丁应用已取消",
+	"Patch application failed: %v":                                                           "补丁应用失败: %v",
+	"Streaming patch application cancelled":                                                  "流式补丁应用已取消",
+	"WriterAt patch application cancelled":                                                   "WriterAt 补丁应用已取消",
+	"Failed to backup original file: %v":                                                     "备份原始文件失败: %v",
+	"Failed to prune old backups: %v":                                                        "清理旧备份失败: %v",
+	"Failed to record failed apply in audit log: %v":                                         "未能在审计日志中记录失败的应用: %v",
+	"Falling back from SQLite diff: %v":                                                      "放弃 SQLite 差分: %v",
+	"Falling back from archive diff: %v":                                                     "放弃归档差分: %v",
+	"Falling back from disk image diff: %v":                                                  "放弃磁盘镜像差分: %v",
+	"Falling back from executable diff: %v":                                                  "放弃可执行文件差分: %v",
+	"Falling back from gzip diff: %v":                                                        "放弃 gzip 差分: %v",
+	"Interrupted by %v":                                                                      "被 %v 中断",
+	"Received %v, stopping (press Ctrl+C again to exit immediately)":                         "收到 %v，正在停止（再按一次 Ctrl+C 立即退出）",
+	"Operation did not stop within %s":                                                       "操作未在 %s 内停止",
+	"Profiles written to %s-*":                                                               "性能分析已写入 %s-*",
+	"No token configured, the service accepts unauthenticated requests":                      "未配置令牌，服务接受未认证的请求",
+	"No webhook secret configured, job events are sent unsigned":                             "未配置 webhook 密钥，任务事件不签名发送",
+	"Some job events were not delivered: %v":                                                 "部分任务事件未送达: %v",
+	"Webhook %s for job %s not delivered to %s: %v":                                          "任务 %[2]s 的 webhook %[1]s 未送达 %[3]s: %[4]v",
+	"Webhook queue full, dropping %s event for job %s":                                       "webhook 队列已满，丢弃任务 %[2]s 的 %[1]s 事件",
+	"Failed to encode webhook event: %v":                                                     "编码 webhook 事件失败: %v",
+
+	// test-report
+	"🚀 BindDiff test report generator\n":             "🚀 BindDiff 测试报告生成器启动\n",
+	"📋 Project: %s v%s\n":                            "📋 项目: %s v%s\n",
+	"📁 Output directory: %s\n":                       "📁 输出目录: %s\n",
+	"📄 Report formats: %v\n":                         "📄 报告格式: %v\n",
+	"🧪 Running %s...\n":                              "🧪 正在执行%s...\n",
+	"unit tests":                                     "单元测试",
+	"coverage tests":                                 "覆盖率测试",
+	"benchmarks":                                     "基准测试",
+	"profiling":                                      "性能分析",
+	"✅ %s report generated\n":                        "✅ %s 报告已生成\n",
+	"📋 Test report summary":                          "📋 测试报告摘要",
+	"📊 Total tests: %d\n":                            "📊 总测试数: %d\n",
+	"✅ Passed: %d\n":                                 "✅ 通过数: %d\n",
+	"❌ Failed: %d\n":                                 "❌ 失败数: %d\n",
+	"⏭️  Skipped: %d\n":                              "⏭️  跳过数: %d\n",
+	"📈 Coverage: %.1f%%\n":                           "📈 覆盖率: %.1f%%\n",
+	"⚠️  Some tests failed, see the detailed report": "⚠️  存在失败的测试用例，请检查详细报告",
+	"🎉 All tests passed!":                            "🎉 所有测试均通过！",
+	"Warning: cannot load config file %s: %v":        "警告: 无法加载配置文件 %s: %v",
+	"Warning: failed to create subdirectory %s: %v":  "警告: 创建子目录 %s 失败: %v",
+	"Warning: %s failed: %v":                         "警告: %s失败: %v",
+	"Warning: go test: %v":                           "测试执行警告: %v",
+	"Configuration failed: %v":                       "配置初始化失败: %v",
+	"Failed to set up the output directory: %v":      "设置输出目录失败: %v",
+	"Test run failed: %v":                            "测试执行失败: %v",
+	"Errors while generating reports: %v":            "报告生成过程中出现错误: %v",
+	"CPU profiling failed: %v":                       "CPU性能分析失败: %v",
+	"Memory profiling failed: %v":                    "内存性能分析失败: %v",
+	"High-performance binary diff tool":              "高性能二进制差异分析工具",
+	"BindDiff Test Report":                           "BindDiff 测试报告",
+	"Generated at":                                   "生成时间",
+	"Overview":                                       "测试概览",
+	"Total tests":                                    "测试总数",
+	"Passed":                                         "通过测试",
+	"Failed":                                         "失败测试",
+	"Coverage":                                       "代码覆盖率",
+	"Coverage details":                               "覆盖率详情",
+	"Current coverage":                               "当前覆盖率",
+	"Excellent":                                      "优秀",
+	"Good":                                           "良好",
+	"Needs improvement":                              "需要改进",
+	"Test results":                                   "测试结果",
+	"Detailed coverage":                              "详细覆盖率",
+	"Benchmark results":                              "基准测试结果",
+	"Test report generator":                          "测试报告生成器 - 让测试结果一目了然",
+}
@@ -0,0 +1,98 @@
+package ignore
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+)
+
+// filterFS 隐藏被忽略路径的文件系统视图
+type filterFS struct {
+	fsys fs.FS
+	m    *Matcher
+}
+
+// Filter 返回 fsys 的只读视图，被 m 忽略的文件与目录不出现在目录列表中，打开时返回 fs.ErrNotExist。
+// 未被忽略的条目保持原样（fs.DirEntry 的 Info、Open 返回的文件），符号链接可通过 ReadLink 读取
+func Filter(fsys fs.FS, m *Matcher) fs.FS {
+	if m == nil || len(m.rules) == 0 {
+		return fsys
+	}
+	return &filterFS{fsys: fsys, m: m}
+}
+
+// hidden 判断路径是否被忽略，只匹配目录的规则需要查询路径类型
+func (f *filterFS) hidden(name string) bool {
+	if name == "." {
+		return false
+	}
+	if f.m.Ignored(name, false) {
+		return true
+	}
+	if !f.m.Ignored(name, true) {
+		return false
+	}
+	info, err := fs.Stat(f.fsys, name)
+	return err == nil && info.IsDir()
+}
+
+// Open 打开未被忽略的路径
+func (f *filterFS) Open(name string) (fs.File, error) {
+	if f.hidden(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return f.fsys.Open(name)
+}
+
+// Stat 返回未被忽略的路径的信息
+func (f *filterFS) Stat(name string) (fs.FileInfo, error) {
+	if f.hidden(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return fs.Stat(f.fsys, name)
+}
+
+// ReadFile 读取未被忽略的文件
+func (f *filterFS) ReadFile(name string) ([]byte, error) {
+	if f.hidden(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return fs.ReadFile(f.fsys, name)
+}
+
+// ReadDir 列出目录中未被忽略的条目
+func (f *filterFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if f.hidden(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	entries, err := fs.ReadDir(f.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	visible := entries[:0]
+	for _, e := range entries {
+		p := e.Name()
+		if name != "." {
+			p = path.Join(name, p)
+		}
+		// 上级目录已确认未被忽略，只需匹配条目本身
+		if !f.m.Match(p, e.IsDir()) {
+			visible = append(visible, e)
+		}
+	}
+	return visible, nil
+}
+
+// ReadLink 读取未被忽略的符号链接的目标
+func (f *filterFS) ReadLink(name string) (string, error) {
+	if f.hidden(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrNotExist}
+	}
+	rl, ok := f.fsys.(interface {
+		ReadLink(name string) (string, error)
+	})
+	if !ok {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: errors.ErrUnsupported}
+	}
+	return rl.ReadLink(name)
+}
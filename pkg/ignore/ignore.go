@@ -0,0 +1,170 @@
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// FileName 目录根部的忽略规则文件
+const FileName = ".bindiffignore"
+
+// Matcher 按 gitignore 语法匹配路径，后出现的规则优先
+type Matcher struct {
+	rules []rule
+}
+
+// rule 一条忽略规则
+type rule struct {
+	// segs 按 '/' 拆分的模式，"**" 匹配任意层目录
+	segs    []string
+	negate  bool
+	dirOnly bool
+}
+
+// New 解析 gitignore 语法的规则，每个元素为一行
+func New(patterns ...string) (*Matcher, error) {
+	m := &Matcher{}
+	if err := m.Add(patterns...); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Load 读取 fsys 根部的 .bindiffignore（不存在时忽略），再追加 patterns（如命令行的 --exclude），
+// 追加的规则优先于文件中的规则
+func Load(fsys fs.FS, patterns ...string) (*Matcher, error) {
+	m := &Matcher{}
+	data, err := fs.ReadFile(fsys, FileName)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		if err := m.Add(scanner.Text()); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", FileName, line, err)
+		}
+	}
+	if err := m.Add(patterns...); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Add 追加规则：空行与 # 开头的行被忽略，! 取反，结尾的 / 只匹配目录，
+// 开头或中间含有 / 的模式相对根目录，否则匹配任意层级的名称
+func (m *Matcher) Add(patterns ...string) error {
+	for _, p := range patterns {
+		r, ok, err := parseRule(p)
+		if err != nil {
+			return err
+		}
+		if ok {
+			m.rules = append(m.rules, r)
+		}
+	}
+	return nil
+}
+
+// parseRule 解析一行规则，空行与注释返回 false
+func parseRule(line string) (rule, bool, error) {
+	line = strings.TrimSuffix(line, "\r")
+	// 末尾未转义的空格被忽略
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || line[0] == '#' {
+		return rule{}, false, nil
+	}
+
+	var r rule
+	if line[0] == '!' {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return rule{}, false, nil
+	}
+
+	if !anchored {
+		r.segs = append(r.segs, "**")
+	}
+	for _, seg := range strings.Split(line, "/") {
+		if seg == "**" && len(r.segs) > 0 && r.segs[len(r.segs)-1] == "**" {
+			continue
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return rule{}, false, fmt.Errorf("bad ignore pattern %q: %w", line, err)
+		}
+		r.segs = append(r.segs, seg)
+	}
+	return r, true, nil
+}
+
+// Match 判断路径本身是否被忽略（不检查上级目录），路径使用 '/' 分隔
+func (m *Matcher) Match(p string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	parts := strings.Split(p, "/")
+	ignored := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if matchSegs(r.segs, parts) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// Ignored 判断路径或它的任一上级目录是否被忽略。与 git 相同，被忽略目录中的路径无法被 ! 规则重新包含
+func (m *Matcher) Ignored(p string, isDir bool) bool {
+	if m == nil || len(m.rules) == 0 {
+		return false
+	}
+	for i := 0; i < len(p); i++ {
+		if p[i] == '/' && m.Match(p[:i], true) {
+			return true
+		}
+	}
+	return m.Match(p, isDir)
+}
+
+// matchSegs 逐段匹配，"**" 匹配零个或多个目录，位于末尾时匹配其中的所有内容
+func matchSegs(pat, parts []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			if len(pat) == 1 {
+				return len(parts) > 0
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegs(pat[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], parts[0]); !ok {
+			return false
+		}
+		pat, parts = pat[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
@@ -0,0 +1,194 @@
+package jobs
+
+import (
+	"bindiff/pkg/logger"
+	"bindiff/pkg/storage"
+	"bindiff/pkg/trace"
+	"bindiff/pkg/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Handler 任务队列的 REST API：
+//
+//	POST   /v1/jobs/diff         multipart 表单，文件字段 old、new，返回 202 与任务
+//	POST   /v1/jobs/apply        multipart 表单，文件字段 old、patch
+//	GET    /v1/jobs              列出任务
+//	GET    /v1/jobs/{id}         查询任务状态与进度
+//	GET    /v1/jobs/{id}/result  下载结果（补丁或新文件）
+//	DELETE /v1/jobs/{id}         中断并删除任务
+type Handler struct {
+	Queue *Queue
+	// Token 非空时要求请求携带 "Authorization: Bearer <Token>"
+	Token string
+	// MaxInputSize 单个输入文件的大小上限，0 表示不限制
+	MaxInputSize int64
+}
+
+// ServeHTTP 分派 REST 请求，错误以 {"error": "..."} 返回
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !utils.BearerAuthorized(r, h.Token) {
+		writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+		return
+	}
+
+	rest, ok := strings.CutPrefix(r.URL.Path, "/v1/jobs")
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown path %s", r.URL.Path))
+		return
+	}
+	parts := strings.Split(strings.Trim(rest, "/"), "/")
+	switch {
+	case rest == "" || rest == "/":
+		h.route(w, r, map[string]http.HandlerFunc{http.MethodGet: h.list})
+	case len(parts) == 1 && (parts[0] == KindDiff || parts[0] == KindApply):
+		h.route(w, r, map[string]http.HandlerFunc{http.MethodPost: func(w http.ResponseWriter, r *http.Request) {
+			h.submit(w, r, parts[0])
+		}})
+	case len(parts) == 1:
+		h.route(w, r, map[string]http.HandlerFunc{
+			http.MethodGet:    func(w http.ResponseWriter, r *http.Request) { h.get(w, parts[0]) },
+			http.MethodDelete: func(w http.ResponseWriter, r *http.Request) { h.delete(w, parts[0]) },
+		})
+	case len(parts) == 2 && parts[1] == "result":
+		h.route(w, r, map[string]http.HandlerFunc{http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+			h.result(w, r, parts[0])
+		}})
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown path %s", r.URL.Path))
+	}
+}
+
+// route 按请求方法分派，不支持的方法返回 405
+func (h *Handler) route(w http.ResponseWriter, r *http.Request, methods map[string]http.HandlerFunc) {
+	if fn, ok := methods[r.Method]; ok {
+		fn(w, r)
+		return
+	}
+	allowed := make([]string, 0, len(methods))
+	for m := range methods {
+		allowed = append(allowed, m)
+	}
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+}
+
+// submit 流式读取 multipart 表单中的输入文件并提交任务
+func (h *Handler) submit(w http.ResponseWriter, r *http.Request, kind string) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	upload, err := h.Queue.NewUpload(kind)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	upload.SetTraceParent(r.Header.Get(trace.TraceparentHeader))
+	upload.SetOperationID(r.Header.Get(logger.OperationIDHeader))
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = upload.Add(part.FormName(), part, h.MaxInputSize)
+			part.Close()
+		}
+		if err != nil {
+			upload.Abort()
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	job, err := upload.Submit()
+	switch {
+	case errors.Is(err, ErrQueueFull), errors.Is(err, ErrClosed):
+		upload.Abort()
+		writeError(w, http.StatusServiceUnavailable, err)
+	case err != nil:
+		upload.Abort()
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		w.Header().Set("Location", "/v1/jobs/"+job.ID)
+		w.Header().Set(logger.OperationIDHeader, job.OperationID)
+		writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string][]Job{"jobs": h.Queue.List()})
+}
+
+func (h *Handler) get(w http.ResponseWriter, id string) {
+	job, err := h.Queue.Get(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if job.OperationID != "" {
+		w.Header().Set(logger.OperationIDHeader, job.OperationID)
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, id string) {
+	if err := h.Queue.Delete(id); errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// result 下载结果文件，支持 Range 请求
+func (h *Handler) result(w http.ResponseWriter, r *http.Request, id string) {
+	f, err := h.Queue.Result(r.Context(), id)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeError(w, http.StatusNotFound, err)
+		return
+	case errors.Is(err, ErrNotFinished):
+		writeError(w, http.StatusConflict, err)
+		return
+	case errors.Is(err, os.ErrNotExist), errors.Is(err, storage.ErrNotFound):
+		writeError(w, http.StatusNotFound, ErrNotFound)
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer f.Close()
+
+	job, _ := h.Queue.Get(id)
+	if job.OperationID != "" {
+		w.Header().Set(logger.OperationIDHeader, job.OperationID)
+	}
+	name := id + ".bdf"
+	if job.Kind == KindApply {
+		name = id + ".bin"
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeContent(w, r, name, time.Time{}, f)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,564 @@
+package jobs
+
+import (
+	"bindiff/pkg/config"
+	"bindiff/pkg/logger"
+	"bindiff/pkg/metrics"
+	"bindiff/pkg/storage"
+	"bindiff/pkg/trace"
+	"bindiff/pkg/utils"
+	"bindiff/pkg/webhook"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 任务类型
+const (
+	KindDiff  = "diff"
+	KindApply = "apply"
+)
+
+// 任务状态
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// 任务目录中的文件
+const (
+	jobFile    = "job.json"
+	resultFile = "result"
+)
+
+var (
+	// ErrNotFound 任务不存在
+	ErrNotFound = errors.New("job not found")
+	// ErrQueueFull 排队的任务数已达上限
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrNotFinished 任务尚未成功完成，没有结果
+	ErrNotFinished = errors.New("job has no result")
+	// ErrClosed 队列已关闭
+	ErrClosed = errors.New("job queue is closed")
+)
+
+// inputs 每种任务需要的输入文件
+var inputs = map[string][]string{
+	KindDiff:  {"old", "new"},
+	KindApply: {"old", "patch"},
+}
+
+// Progress 运行中任务的进度
+type Progress struct {
+	Stage   string `json:"stage"`
+	Current int64  `json:"current"`
+	Total   int64  `json:"total"`
+}
+
+// Job 任务状态，持久化为任务目录中的 job.json
+type Job struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	Created    time.Time  `json:"created"`
+	Started    *time.Time `json:"started,omitempty"`
+	Finished   *time.Time `json:"finished,omitempty"`
+	ResultSize int64      `json:"result_size,omitempty"`
+	// OperationID 提交请求的 X-Operation-ID（没有时随机生成），附加到任务的日志、跨度与 Webhook 事件
+	OperationID string `json:"operation_id,omitempty"`
+	// TraceParent 提交请求的 traceparent，任务运行时的跨度以它为父跨度
+	TraceParent string `json:"trace_parent,omitempty"`
+	// Progress 只在内存中更新，不持久化
+	Progress *Progress `json:"progress,omitempty"`
+}
+
+// Options 队列选项
+type Options struct {
+	Config *config.Config
+	// Workers 同时运行的任务数，不大于 0 时为 1
+	Workers int
+	// MaxQueued 排队任务数上限，0 表示不限制
+	MaxQueued int
+	// Timeout 单个任务的最长运行时间，0 表示不限制
+	Timeout time.Duration
+	// Logger 日志输出，nil 时不输出日志
+	Logger logger.Logger
+	// Storage 结果的存储后端，键为 <任务 ID>/result；为空时结果保存在任务目录中。
+	// 输入与状态始终保存在本地
+	Storage storage.Backend
+	// Metrics 记录任务的操作指标与队列深度，nil 时不记录
+	Metrics *metrics.Metrics
+	// Tracer 记录任务各阶段的跨度，nil 时不记录
+	Tracer *trace.Tracer
+	// Webhooks 发送任务的生命周期事件，nil 时不发送
+	Webhooks *webhook.Notifier
+}
+
+// Queue 持久化的任务队列：每个任务一个目录，保存输入、状态与结果；
+// 由固定数量的工作协程执行，重启后未完成的任务重新排队
+type Queue struct {
+	dir  string
+	opts Options
+	log  logger.Logger
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	jobs    map[string]*Job
+	pending []string
+	cancels map[string]context.CancelFunc
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// Open 打开 dir 中的任务队列并启动工作协程。排队中与运行中（上次退出时被中断）的任务按创建时间重新排队，
+// 没有 job.json 的目录是未完成的上传，直接删除
+func Open(dir string, opts Options) (*Queue, error) {
+	if err := utils.EnsureDir(dir); err != nil {
+		return nil, err
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.Config == nil {
+		opts.Config = config.DefaultConfig()
+	}
+	q := &Queue{
+		dir:     dir,
+		opts:    opts,
+		log:     opts.Logger,
+		jobs:    make(map[string]*Job),
+		cancels: make(map[string]context.CancelFunc),
+	}
+	if q.log == nil {
+		q.log = logger.Nop()
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var requeue []*Job
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		// 先处理中断的提交：结果与状态要么都已写入，要么都没有写入
+		if _, err := utils.RecoverTransactions(filepath.Join(dir, e.Name())); err != nil {
+			q.log.Warnf("Skipping unreadable job %s: %v", e.Name(), err)
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name(), jobFile))
+		if errors.Is(err, os.ErrNotExist) {
+			os.RemoveAll(filepath.Join(dir, e.Name()))
+			continue
+		}
+		var job Job
+		if err == nil {
+			err = json.Unmarshal(data, &job)
+		}
+		if err != nil || job.ID != e.Name() {
+			q.log.Warnf("Skipping unreadable job %s: %v", e.Name(), err)
+			continue
+		}
+		q.jobs[job.ID] = &job
+		if job.Status == StatusQueued || job.Status == StatusRunning {
+			requeue = append(requeue, &job)
+		}
+	}
+	sort.Slice(requeue, func(i, j int) bool { return requeue[i].Created.Before(requeue[j].Created) })
+	for _, job := range requeue {
+		job.Status, job.Started = StatusQueued, nil
+		if err := q.save(job, nil); err != nil {
+			return nil, err
+		}
+		q.pending = append(q.pending, job.ID)
+	}
+	if len(requeue) > 0 {
+		q.log.Infof("Resuming %d unfinished job(s)", len(requeue))
+	}
+
+	for i := 0; i < opts.Workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+	return q, nil
+}
+
+// Close 停止接收任务并等待工作协程退出，运行中的任务被中断并保持排队状态，下次打开时重新执行
+func (q *Queue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	for _, cancel := range q.cancels {
+		cancel()
+	}
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+// Upload 任务输入的暂存区，Submit 之前任务不可见
+type Upload struct {
+	q     *Queue
+	job   *Job
+	dir   string
+	added map[string]bool
+}
+
+// NewUpload 为 kind 类型的任务创建暂存区
+func (q *Queue) NewUpload(kind string) (*Upload, error) {
+	if _, ok := inputs[kind]; !ok {
+		return nil, fmt.Errorf("unknown job kind %q", kind)
+	}
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	job := &Job{ID: hex.EncodeToString(id[:]), Kind: kind, Status: StatusQueued, OperationID: logger.NewOperationID()}
+	dir := filepath.Join(q.dir, job.ID)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Upload{q: q, job: job, dir: dir, added: make(map[string]bool)}, nil
+}
+
+// Inputs 返回该类型任务需要的输入名称
+func (u *Upload) Inputs() []string {
+	return inputs[u.job.Kind]
+}
+
+// Add 写入一个输入，最多读取 limit 字节（不大于 0 时不限制）
+func (u *Upload) Add(name string, r io.Reader, limit int64) error {
+	valid := false
+	for _, in := range inputs[u.job.Kind] {
+		valid = valid || in == name
+	}
+	if !valid {
+		return fmt.Errorf("unexpected input %q for %s job", name, u.job.Kind)
+	}
+	if u.added[name] {
+		return fmt.Errorf("duplicate input %q", name)
+	}
+	f, err := os.Create(filepath.Join(u.dir, name))
+	if err != nil {
+		return err
+	}
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if limit > 0 && n > limit {
+		return fmt.Errorf("input %q exceeds the %d byte limit", name, limit)
+	}
+	u.added[name] = true
+	return nil
+}
+
+// SetTraceParent 记录提交请求的 traceparent 头，无效的值被忽略
+func (u *Upload) SetTraceParent(traceparent string) {
+	if _, err := trace.ParseTraceparent(traceparent); err == nil {
+		u.job.TraceParent = traceparent
+	}
+}
+
+// SetOperationID 使用调用方提供的操作 ID，无效的值被忽略
+func (u *Upload) SetOperationID(id string) {
+	if logger.ValidOperationID(id) {
+		u.job.OperationID = id
+	}
+}
+
+// Submit 检查输入齐全后持久化任务并加入队列
+func (u *Upload) Submit() (*Job, error) {
+	for _, name := range inputs[u.job.Kind] {
+		if !u.added[name] {
+			return nil, fmt.Errorf("missing input %q for %s job", name, u.job.Kind)
+		}
+	}
+	q := u.q
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, ErrClosed
+	}
+	if q.opts.MaxQueued > 0 && len(q.pending) >= q.opts.MaxQueued {
+		return nil, ErrQueueFull
+	}
+	u.job.Created = time.Now().UTC()
+	if err := q.save(u.job, nil); err != nil {
+		return nil, err
+	}
+	q.jobs[u.job.ID] = u.job
+	q.pending = append(q.pending, u.job.ID)
+	q.cond.Signal()
+	job := *u.job
+	q.notify(&job, webhook.EventQueued)
+	return &job, nil
+}
+
+// Abort 丢弃暂存区
+func (u *Upload) Abort() {
+	os.RemoveAll(u.dir)
+}
+
+// Pending 返回排队中（尚未开始运行）的任务数
+func (q *Queue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Get 返回任务状态的副本
+func (q *Queue) Get(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return q.snapshot(job), nil
+}
+
+// List 按创建时间返回所有任务
+func (q *Queue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := make([]Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		list = append(list, q.snapshot(job))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list
+}
+
+// snapshot 复制任务状态，调用方持有锁
+func (q *Queue) snapshot(job *Job) Job {
+	c := *job
+	if job.Progress != nil {
+		p := *job.Progress
+		c.Progress = &p
+	}
+	return c
+}
+
+// ResultPath 返回成功任务的结果文件路径，结果保存在 Storage 中时使用 Result
+func (q *Queue) ResultPath(id string) (string, error) {
+	job, err := q.Get(id)
+	if err != nil {
+		return "", err
+	}
+	if job.Status != StatusSucceeded {
+		return "", ErrNotFinished
+	}
+	if q.opts.Storage != nil {
+		return "", fmt.Errorf("result of job %s is kept in remote storage", id)
+	}
+	return filepath.Join(q.dir, id, resultFile), nil
+}
+
+// Result 打开成功任务的结果，结果保存在本地目录或 Storage 中
+func (q *Queue) Result(ctx context.Context, id string) (io.ReadSeekCloser, error) {
+	job, err := q.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != StatusSucceeded {
+		return nil, ErrNotFinished
+	}
+	if q.opts.Storage == nil {
+		return os.Open(filepath.Join(q.dir, id, resultFile))
+	}
+	data, err := q.opts.Storage.Get(ctx, resultKey(id))
+	if err != nil {
+		return nil, err
+	}
+	return nopCloser{bytes.NewReader(data)}, nil
+}
+
+// nopCloser 为内存中的结果提供 Close
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
+
+// resultKey 返回结果在 Storage 中的键
+func resultKey(id string) string {
+	return id + "/" + resultFile
+}
+
+// Delete 删除任务及其文件，运行中的任务先被中断
+func (q *Queue) Delete(id string) error {
+	q.mu.Lock()
+	if _, ok := q.jobs[id]; !ok {
+		q.mu.Unlock()
+		return ErrNotFound
+	}
+	delete(q.jobs, id)
+	for i, p := range q.pending {
+		if p == id {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			break
+		}
+	}
+	if cancel, ok := q.cancels[id]; ok {
+		cancel()
+	}
+	q.mu.Unlock()
+	if q.opts.Storage != nil {
+		if err := q.opts.Storage.Delete(context.Background(), resultKey(id)); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(filepath.Join(q.dir, id))
+}
+
+// save 持久化任务状态，与 txn 中暂存的结果在同一事务中提交，txn 为空时只写入状态。
+// 调用方持有锁或独占该任务
+func (q *Queue) save(job *Job, txn *utils.Transaction) error {
+	if txn == nil {
+		txn = utils.NewTransaction(filepath.Join(q.dir, job.ID))
+	}
+	defer txn.Rollback()
+	c := *job
+	c.Progress = nil
+	data, err := json.MarshalIndent(&c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := txn.Write(filepath.Join(q.dir, job.ID, jobFile), data); err != nil {
+		return err
+	}
+	return txn.Commit()
+}
+
+// persist 保存任务状态（txn 见 save），失败时记录错误、把任务标记为失败并发送失败事件，返回是否保存成功：
+// 状态没有写入磁盘的任务在重启后会丢失或停在旧的状态。调用方持有锁
+func (q *Queue) persist(job *Job, txn *utils.Transaction) bool {
+	err := q.save(job, txn)
+	if err == nil {
+		return true
+	}
+	log := logger.WithOperationID(q.log, job.OperationID)
+	log.Errorf("Failed to save job %s (%s): %v", job.ID, job.Kind, err)
+	if job.Status != StatusFailed {
+		now := time.Now().UTC()
+		job.Status, job.Error, job.ResultSize = StatusFailed, fmt.Sprintf("failed to save job state: %v", err), 0
+		job.Finished, job.Progress = &now, nil
+		// 尽量记录失败状态，磁盘空间可能已经释放
+		q.save(job, nil)
+	}
+	q.notify(job, webhook.EventFailed)
+	return false
+}
+
+// worker 从队列中取出任务并执行，直到队列关闭
+func (q *Queue) worker() {
+	defer q.wg.Done()
+	for {
+		q.mu.Lock()
+		for len(q.pending) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		id := q.pending[0]
+		q.pending = q.pending[1:]
+		job := q.jobs[id]
+		var ctx context.Context
+		var cancel context.CancelFunc
+		if q.opts.Timeout > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), q.opts.Timeout)
+		} else {
+			ctx, cancel = context.WithCancel(context.Background())
+		}
+		q.cancels[id] = cancel
+		now := time.Now().UTC()
+		job.Status, job.Started = StatusRunning, &now
+		if !q.persist(job, nil) {
+			cancel()
+			delete(q.cancels, id)
+			q.mu.Unlock()
+			continue
+		}
+		q.notify(job, webhook.EventStarted)
+		q.mu.Unlock()
+
+		// 结果暂存在事务中，与任务的最终状态一起提交
+		txn := utils.NewTransaction(filepath.Join(q.dir, id))
+		size, err := q.run(ctx, job, txn)
+
+		q.mu.Lock()
+		cancel()
+		delete(q.cancels, id)
+		switch {
+		case q.jobs[id] != job:
+			// 任务已被删除
+		case q.closed && ctx.Err() == context.Canceled:
+			// 队列关闭中断的任务保持排队，下次打开时重新执行
+			job.Status, job.Started, job.Progress = StatusQueued, nil, nil
+			q.persist(job, nil)
+		default:
+			now := time.Now().UTC()
+			job.Finished, job.Progress = &now, nil
+			log := logger.WithOperationID(q.log, job.OperationID)
+			event := webhook.EventCompleted
+			if err != nil {
+				job.Status, job.Error = StatusFailed, err.Error()
+				log.Warnf("Job %s (%s) failed: %v", id, job.Kind, err)
+				event = webhook.EventFailed
+			} else {
+				job.Status, job.ResultSize = StatusSucceeded, size
+				log.Infof("Job %s (%s) succeeded in %v", id, job.Kind, now.Sub(*job.Started))
+			}
+			// 保存失败时 persist 已发送失败事件
+			if q.persist(job, txn) {
+				q.notify(job, event)
+			}
+		}
+		// 没有提交的结果（任务被删除或中断）在这里丢弃
+		txn.Rollback()
+		q.mu.Unlock()
+	}
+}
+
+// notify 发送任务事件，调用方持有锁或独占该任务
+func (q *Queue) notify(job *Job, event string) {
+	e := webhook.Event{Type: event, Source: "rest", JobID: job.ID, OperationID: job.OperationID, Kind: job.Kind,
+		Error: job.Error, ResultSize: job.ResultSize}
+	if job.Kind == KindDiff {
+		e.PatchSize = job.ResultSize
+	}
+	if job.Started != nil && job.Finished != nil {
+		e.DurationSeconds = job.Finished.Sub(*job.Started).Seconds()
+	}
+	q.opts.Webhooks.Send(e)
+}
+
+// setProgress 更新运行中任务的进度
+func (q *Queue) setProgress(job *Job, stage string, current, total int64) {
+	q.mu.Lock()
+	job.Progress = &Progress{Stage: stage, Current: current, Total: total}
+	q.mu.Unlock()
+}
@@ -0,0 +1,108 @@
+package jobs
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/logger"
+	"bindiff/pkg/metrics"
+	"bindiff/pkg/trace"
+	"bindiff/pkg/utils"
+	"context"
+	"errors"
+	"path/filepath"
+	"time"
+)
+
+// run 执行任务，返回结果大小。本地结果文件暂存在 txn 中，由调用方与任务状态一起提交
+func (q *Queue) run(ctx context.Context, job *Job, txn *utils.Transaction) (size int64, err error) {
+	ctx = trace.ContextWithTracer(ctx, q.opts.Tracer)
+	if sc, err := trace.ParseTraceparent(job.TraceParent); err == nil {
+		ctx = trace.ContextWithRemoteParent(ctx, sc)
+	}
+	ctx, span := trace.StartKind(ctx, "job "+job.Kind, trace.KindServer, trace.String("job.id", job.ID),
+		trace.String("operation.id", job.OperationID))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	dir := filepath.Join(q.dir, job.ID)
+	first, second, err := readInputs(ctx, dir, inputs[job.Kind], q.opts.Config.IO.Hints())
+	if err != nil {
+		return 0, err
+	}
+	progress := core.ProgressFunc(q.opts.Metrics.StageTimer(func(stage string, current, total int64) {
+		q.setProgress(job, stage, current, total)
+	}))
+
+	start := time.Now()
+	log := logger.WithOperationID(q.opts.Logger, job.OperationID)
+	var result []byte
+	if job.Kind == KindDiff {
+		result, err = q.diff(ctx, first, second, progress, log)
+	} else {
+		result, err = q.apply(ctx, first, second, progress, log)
+	}
+	// 队列关闭中断的任务会重新执行，不计入指标
+	if !errors.Is(err, context.Canceled) {
+		op := metrics.OpApply
+		if job.Kind == KindDiff {
+			op = metrics.OpDiff
+		}
+		q.opts.Metrics.Observe(op, int64(len(first)+len(second)), int64(len(result)), start, err)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	_, writeSpan := trace.Start(ctx, "write", trace.Int64("bytes", int64(len(result))))
+	if q.opts.Storage != nil {
+		err = q.opts.Storage.Put(ctx, resultKey(job.ID), result)
+	} else {
+		err = txn.Write(filepath.Join(dir, resultFile), result)
+	}
+	writeSpan.RecordError(err)
+	writeSpan.End()
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(result)), nil
+}
+
+// readInputs 按配置的 IO 提示读取任务目录中的两个输入
+func readInputs(ctx context.Context, dir string, names []string, hints utils.IOHints) (first, second []byte, err error) {
+	_, span := trace.Start(ctx, "read")
+	defer func() {
+		span.SetAttributes(trace.Int64("bytes", int64(len(first)+len(second))))
+		span.RecordError(err)
+		span.End()
+	}()
+	if first, err = utils.ReadFileHinted(filepath.Join(dir, names[0]), hints); err != nil {
+		return nil, nil, err
+	}
+	if second, err = utils.ReadFileHinted(filepath.Join(dir, names[1]), hints); err != nil {
+		return nil, nil, err
+	}
+	return first, second, nil
+}
+
+// diff 生成补丁文件，校验哈希按配置项 hash_algorithm 计算
+func (q *Queue) diff(ctx context.Context, oldData, newData []byte, progress core.ProgressReporter, log logger.Logger) ([]byte, error) {
+	return core.CreatePatchFile(oldData, newData, &core.DiffOptions{
+		Config:   q.opts.Config,
+		Context:  ctx,
+		Progress: progress,
+		Logger:   log,
+	})
+}
+
+// apply 校验两端哈希并应用补丁
+func (q *Queue) apply(ctx context.Context, oldData, patch []byte, progress core.ProgressReporter, log logger.Logger) ([]byte, error) {
+	return core.ApplyPatchFile(oldData, patch, &core.ApplyOptions{
+		Config:   q.opts.Config,
+		Context:  ctx,
+		Progress: progress,
+		Logger:   log,
+	})
+}
@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"bindiff/pkg/i18n"
+	"bindiff/pkg/utils"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -13,16 +15,24 @@ var (
 	// 全局日志实例
 	Log   *zap.Logger
 	Sugar *zap.SugaredLogger
+
+	// logFile 文件输出，Close 时关闭
+	logFile *RotatingFile
 )
 
 // LoggerConfig 日志配置
 type LoggerConfig struct {
 	Level      string `json:"level"`
 	OutputPath string `json:"output_path"`
-	MaxSize    int    `json:"max_size"` // MB
-	MaxAge     int    `json:"max_age"`  // days
-	MaxBackups int    `json:"max_backups"`
-	Compress   bool   `json:"compress"`
+	// ConsoleStderr 控制台日志写到标准错误，标准输出留给命令的结果（如 --json）
+	ConsoleStderr bool `json:"console_stderr"`
+	// NoColor 控制台日志不着色。未设置时只在控制台是终端且没有 NO_COLOR 环境变量时着色
+	NoColor bool `json:"no_color"`
+	// 文件输出的轮转参数（见 RotatingFile），0 表示不按该条件轮转或清理
+	MaxSize    int  `json:"max_size"` // MB
+	MaxAge     int  `json:"max_age"`  // days
+	MaxBackups int  `json:"max_backups"`
+	Compress   bool `json:"compress"`
 }
 
 // InitLogger 初始化日志系统
@@ -51,11 +61,19 @@ func InitLogger(config LoggerConfig) error {
 	// 创建核心配置
 	var cores []zapcore.Core
 
-	// 控制台输出
-	consoleEncoder := zapcore.NewConsoleEncoder(encoderConfig)
+	// 控制台输出，终端上按级别着色
+	console := os.Stdout
+	if config.ConsoleStderr {
+		console = os.Stderr
+	}
+	consoleEncoderConfig := encoderConfig
+	if !config.NoColor && utils.ColorEnabled(console) {
+		consoleEncoderConfig.EncodeLevel = zapcore.LowercaseColorLevelEncoder
+	}
+	consoleEncoder := zapcore.NewConsoleEncoder(consoleEncoderConfig)
 	consoleCore := zapcore.NewCore(
 		consoleEncoder,
-		zapcore.AddSync(os.Stdout),
+		zapcore.AddSync(console),
 		level,
 	)
 	cores = append(cores, consoleCore)
@@ -67,17 +85,21 @@ func InitLogger(config LoggerConfig) error {
 			return fmt.Errorf("failed to create log directory: %w", err)
 		}
 
-		// 创建文件输出
-		fileWriter, err := os.OpenFile(config.OutputPath,
-			os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		// 创建文件输出，按大小轮转
+		fileWriter, err := OpenRotatingFile(config)
 		if err != nil {
-			return fmt.Errorf("failed to open log file: %w", err)
+			return err
 		}
+		// 重复初始化时关闭之前的文件
+		if logFile != nil {
+			logFile.Close()
+		}
+		logFile = fileWriter
 
 		fileEncoder := zapcore.NewJSONEncoder(encoderConfig)
 		fileCore := zapcore.NewCore(
 			fileEncoder,
-			zapcore.AddSync(fileWriter),
+			fileWriter,
 			level,
 		)
 		cores = append(cores, fileCore)
@@ -96,6 +118,10 @@ func Close() {
 	if Log != nil {
 		Log.Sync()
 	}
+	if logFile != nil {
+		logFile.Close()
+		logFile = nil
+	}
 }
 
 // WithField 添加字段
@@ -151,34 +177,34 @@ func Fatal(msg string, fields ...zap.Field) {
 	}
 }
 
-// 格式化日志方法
+// 格式化日志方法，模板按当前语言翻译（见 i18n 包）
 func Debugf(template string, args ...interface{}) {
 	if Sugar != nil {
-		Sugar.Debugf(template, args...)
+		Sugar.Debugf(i18n.T(template), args...)
 	}
 }
 
 func Infof(template string, args ...interface{}) {
 	if Sugar != nil {
-		Sugar.Infof(template, args...)
+		Sugar.Infof(i18n.T(template), args...)
 	}
 }
 
 func Warnf(template string, args ...interface{}) {
 	if Sugar != nil {
-		Sugar.Warnf(template, args...)
+		Sugar.Warnf(i18n.T(template), args...)
 	}
 }
 
 func Errorf(template string, args ...interface{}) {
 	if Sugar != nil {
-		Sugar.Errorf(template, args...)
+		Sugar.Errorf(i18n.T(template), args...)
 	}
 }
 
 func Fatalf(template string, args ...interface{}) {
 	if Sugar != nil {
-		Sugar.Fatalf(template, args...)
+		Sugar.Fatalf(i18n.T(template), args...)
 	}
 }
 
@@ -187,8 +213,11 @@ type Performance struct {
 	logger *zap.Logger
 }
 
-// NewPerformance 创建性能日志记录器
+// NewPerformance 创建性能日志记录器，全局实例未初始化时不输出
 func NewPerformance() *Performance {
+	if Log == nil {
+		return &Performance{}
+	}
 	return &Performance{
 		logger: Log.Named("performance"),
 	}
@@ -216,3 +245,77 @@ func (p *Performance) LogMemoryUsage(operation string, memoryMB float64) {
 			zap.Float64("memory_mb", memoryMB))
 	}
 }
+
+// LogPeakMemory 记录一次操作的内存峰值（见 utils.TrackMemory）
+func (p *Performance) LogPeakMemory(operation string, peak utils.MemoryPeak) {
+	if p.logger != nil {
+		p.logger.Info("memory_peak",
+			zap.String("operation", operation),
+			zap.Uint64("peak_heap_bytes", peak.HeapBytes),
+			zap.Uint64("peak_rss_bytes", peak.RSSBytes))
+	}
+}
+
+// Logger 可注入的日志接口，*zap.SugaredLogger 满足该接口。
+// 嵌入 bindiff 的程序可通过选项传入自己的日志实现，而不依赖全局实例
+type Logger interface {
+	Debugf(template string, args ...interface{})
+	Infof(template string, args ...interface{})
+	Warnf(template string, args ...interface{})
+	Errorf(template string, args ...interface{})
+}
+
+// Nop 返回丢弃所有日志的 Logger
+func Nop() Logger {
+	return zap.NewNop().Sugar()
+}
+
+// FromZap 将 *zap.Logger 适配为 Logger，nil 时返回 Nop
+func FromZap(l *zap.Logger) Logger {
+	if l == nil {
+		return Nop()
+	}
+	return l.Sugar()
+}
+
+// Global 返回转发到全局日志实例的 Logger，供命令行程序使用，消息按当前语言翻译；全局实例未初始化时不输出
+func Global() Logger {
+	return globalLogger{}
+}
+
+// globalLogger 在调用时转发到全局 Sugar，fields 为附加的键值对（见 WithOperationID）
+type globalLogger struct {
+	fields []interface{}
+}
+
+// sugar 返回附加了 fields 的全局 Sugar，未初始化时返回 nil
+func (g globalLogger) sugar() *zap.SugaredLogger {
+	if Sugar == nil || len(g.fields) == 0 {
+		return Sugar
+	}
+	return Sugar.With(g.fields...)
+}
+
+func (g globalLogger) Debugf(template string, args ...interface{}) {
+	if s := g.sugar(); s != nil {
+		s.Debugf(i18n.T(template), args...)
+	}
+}
+
+func (g globalLogger) Infof(template string, args ...interface{}) {
+	if s := g.sugar(); s != nil {
+		s.Infof(i18n.T(template), args...)
+	}
+}
+
+func (g globalLogger) Warnf(template string, args ...interface{}) {
+	if s := g.sugar(); s != nil {
+		s.Warnf(i18n.T(template), args...)
+	}
+}
+
+func (g globalLogger) Errorf(template string, args ...interface{}) {
+	if s := g.sugar(); s != nil {
+		s.Errorf(i18n.T(template), args...)
+	}
+}
@@ -0,0 +1,94 @@
+package logger
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// OperationIDField 日志中操作 ID 的字段名
+	OperationIDField = "op_id"
+	// OperationIDHeader 服务端接收与返回操作 ID 的 HTTP 头（gRPC 元数据为 x-operation-id）
+	OperationIDHeader = "X-Operation-ID"
+	// maxOperationIDLength 调用方提供的操作 ID 的最大长度
+	maxOperationIDLength = 128
+)
+
+// NewOperationID 生成随机的操作 ID（16 个十六进制字符）
+func NewOperationID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// ValidOperationID 报告调用方提供的操作 ID 是否可以使用：1 到 128 个字母、数字或 . _ : -
+func ValidOperationID(id string) bool {
+	if id == "" || len(id) > maxOperationIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.' || c == '_' || c == ':' || c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// StartOperation 为命令行程序的一次操作设置操作 ID：之后全局日志实例的每一行都带有 op_id 字段。
+// id 为空时生成新的 ID；返回使用的 ID
+func StartOperation(id string) (string, error) {
+	if id == "" {
+		id = NewOperationID()
+	} else if !ValidOperationID(id) {
+		return "", fmt.Errorf("invalid operation ID %q: use up to %d letters, digits or . _ : -", id, maxOperationIDLength)
+	}
+	if Log != nil {
+		Log = Log.With(zap.String(OperationIDField, id))
+		Sugar = Log.Sugar()
+	}
+	return id, nil
+}
+
+// WithOperationID 返回每行日志都带有 op_id 字段的 Logger。*zap.SugaredLogger 与 Global 以 zap 字段附加，
+// 其他实现在消息前加上 [op_id=...]
+func WithOperationID(l Logger, id string) Logger {
+	if id == "" {
+		return l
+	}
+	switch l := l.(type) {
+	case nil:
+		return Nop()
+	case *zap.SugaredLogger:
+		return l.With(OperationIDField, id)
+	case globalLogger:
+		return globalLogger{fields: append(append([]interface{}(nil), l.fields...), OperationIDField, id)}
+	default:
+		return prefixLogger{l: l, prefix: "[" + OperationIDField + "=" + strings.ReplaceAll(id, "%", "%%") + "] "}
+	}
+}
+
+// prefixLogger 在每条消息前加上固定前缀
+type prefixLogger struct {
+	l      Logger
+	prefix string
+}
+
+func (p prefixLogger) Debugf(template string, args ...interface{}) {
+	p.l.Debugf(p.prefix+template, args...)
+}
+func (p prefixLogger) Infof(template string, args ...interface{}) {
+	p.l.Infof(p.prefix+template, args...)
+}
+func (p prefixLogger) Warnf(template string, args ...interface{}) {
+	p.l.Warnf(p.prefix+template, args...)
+}
+func (p prefixLogger) Errorf(template string, args ...interface{}) {
+	p.l.Errorf(p.prefix+template, args...)
+}
@@ -0,0 +1,220 @@
+package logger
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 备份文件名中的时间格式（UTC）：bindiff-2006-01-02T15-04-05.000.log
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotatingFile 按大小轮转的日志文件：超过 MaxSize 时重命名为带时间戳的备份并重新打开，
+// 超过 MaxBackups 个或早于 MaxAge 的备份被删除，Compress 时备份以 gzip 压缩
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	compress   bool
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenRotatingFile 以 config 中的轮转参数打开日志文件（追加写入），
+// MaxSize 为 0 时不轮转，MaxAge、MaxBackups 为 0 时不按该条件清理
+func OpenRotatingFile(config LoggerConfig) (*RotatingFile, error) {
+	r := &RotatingFile{
+		path:       config.OutputPath,
+		maxSize:    int64(config.MaxSize) << 20,
+		maxAge:     time.Duration(config.MaxAge) * 24 * time.Hour,
+		maxBackups: config.MaxBackups,
+		compress:   config.Compress,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	// 清理上次运行留下的过期备份
+	r.cleanup()
+	return r, nil
+}
+
+// open 打开（或创建）当前日志文件
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	r.file, r.size = f, info.Size()
+	return nil
+}
+
+// Write 实现 io.Writer，写入后超过大小上限的内容留到下一次写入前轮转，单条日志不会被拆开
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Sync 实现 zapcore.WriteSyncer
+func (r *RotatingFile) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Sync()
+}
+
+// Close 关闭当前日志文件
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// rotate 把当前文件重命名为备份，打开新文件并清理旧备份
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	r.file = nil
+	// 同一毫秒内多次轮转时顺延时间戳，不覆盖已有的备份（包括已压缩的）
+	t := time.Now().UTC()
+	for exists(r.backupName(t)) || exists(r.backupName(t)+".gz") {
+		t = t.Add(time.Millisecond)
+	}
+	if err := os.Rename(r.path, r.backupName(t)); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.cleanup()
+	return nil
+}
+
+// exists 报告 path 是否存在
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return !errors.Is(err, fs.ErrNotExist)
+}
+
+// backupName 返回 t 时刻轮转出的备份路径
+func (r *RotatingFile) backupName(t time.Time) string {
+	dir, base := filepath.Split(r.path)
+	ext := filepath.Ext(base)
+	return filepath.Join(dir, strings.TrimSuffix(base, ext)+"-"+t.Format(backupTimeFormat)+ext)
+}
+
+// logBackup 一个备份文件及其轮转时间
+type logBackup struct {
+	path string
+	time time.Time
+}
+
+// backups 列出当前日志文件的备份（含压缩的），按时间从新到旧
+func (r *RotatingFile) backups() []logBackup {
+	dir, base := filepath.Split(r.path)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var list []logBackup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		t, err := time.Parse(backupTimeFormat, strings.TrimPrefix(stamp, prefix))
+		if err != nil {
+			continue
+		}
+		list = append(list, logBackup{path: filepath.Join(dir, name), time: t})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].time.After(list[j].time) })
+	return list
+}
+
+// cleanup 删除多余与过期的备份，并压缩剩余未压缩的备份。清理失败不影响写日志
+func (r *RotatingFile) cleanup() {
+	cutoff := time.Now().Add(-r.maxAge)
+	for i, b := range r.backups() {
+		if r.maxBackups > 0 && i >= r.maxBackups || r.maxAge > 0 && b.time.Before(cutoff) {
+			os.Remove(b.path)
+			continue
+		}
+		if r.compress && !strings.HasSuffix(b.path, ".gz") {
+			compressFile(b.path)
+		}
+	}
+}
+
+// compressFile 把 path 压缩为 path.gz 后删除原文件
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
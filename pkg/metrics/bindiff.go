@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// 操作名，作为 op 标签的取值
+const (
+	OpDiff  = "diff"
+	OpApply = "apply"
+)
+
+// Metrics 差分服务的指标集合，nil 时各方法不做任何事，服务可以不启用指标
+type Metrics struct {
+	Registry *Registry
+
+	operations    *Counter   // bindiff_operations_total{op,result}
+	failures      *Counter   // bindiff_apply_failures_total
+	bytes         *Counter   // bindiff_bytes_processed_total{op}
+	patchSize     *Histogram // bindiff_patch_size_bytes
+	duration      *Histogram // bindiff_operation_duration_seconds{op}
+	stageDuration *Histogram // bindiff_stage_duration_seconds{stage}
+}
+
+// New 在 reg 中注册差分服务的指标，reg 为 nil 时新建注册表
+func New(reg *Registry) *Metrics {
+	if reg == nil {
+		reg = NewRegistry()
+	}
+	return &Metrics{
+		Registry: reg,
+		operations: reg.NewCounter("bindiff_operations_total",
+			"Diff and apply operations completed, by result.", "op", "result"),
+		failures: reg.NewCounter("bindiff_apply_failures_total",
+			"Patch applications that failed, including hash mismatches and corrupt patches."),
+		bytes: reg.NewCounter("bindiff_bytes_processed_total",
+			"Input bytes processed by diff and apply operations.", "op"),
+		patchSize: reg.NewHistogram("bindiff_patch_size_bytes",
+			"Size of the patch files produced by diff operations.", SizeBuckets),
+		duration: reg.NewHistogram("bindiff_operation_duration_seconds",
+			"Time taken by diff and apply operations.", DefBuckets, "op"),
+		stageDuration: reg.NewHistogram("bindiff_stage_duration_seconds",
+			"Time taken by each progress stage of diff and apply operations.", DefBuckets, "stage"),
+	}
+}
+
+// QueueDepth 注册任务队列深度的仪表，fn 返回排队中的任务数
+func (m *Metrics) QueueDepth(fn func() int) {
+	if m == nil {
+		return
+	}
+	m.Registry.NewGaugeFunc("bindiff_job_queue_depth", "Jobs waiting in the queue.", func() float64 { return float64(fn()) })
+}
+
+// Observe 记录一次操作：op 为 OpDiff 或 OpApply，input 为输入的总字节数，
+// patchSize 为差分生成的补丁大小（应用时忽略），err 非空表示失败
+func (m *Metrics) Observe(op string, input, patchSize int64, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.duration.Observe(time.Since(start).Seconds(), op)
+	m.bytes.Add(float64(input), op)
+	if err != nil {
+		m.operations.Inc(op, "error")
+		if op == OpApply {
+			m.failures.Inc()
+		}
+		return
+	}
+	m.operations.Inc(op, "success")
+	if op == OpDiff {
+		m.patchSize.Observe(float64(patchSize))
+	}
+}
+
+// StageTimer 返回记录各进度阶段耗时的 ProgressFunc 形式回调：阶段以 current == 0 开始，
+// 以 current == total 结束。next 不为 nil 时同时转发进度
+func (m *Metrics) StageTimer(next func(stage string, current, total int64)) func(stage string, current, total int64) {
+	if m == nil {
+		return next
+	}
+	var mu sync.Mutex
+	started := map[string]time.Time{}
+	return func(stage string, current, total int64) {
+		mu.Lock()
+		if t, ok := started[stage]; !ok {
+			if current == 0 {
+				started[stage] = time.Now()
+			}
+		} else if current >= total {
+			m.stageDuration.Observe(time.Since(t).Seconds(), stage)
+			delete(started, stage)
+		}
+		mu.Unlock()
+		if next != nil {
+			next(stage, current, total)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+// Package metrics 提供计数器、仪表与直方图，并以 Prometheus 文本格式（0.0.4）导出，供服务暴露 /metrics
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets 默认的延迟直方图分桶，单位秒
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// SizeBuckets 字节大小直方图的分桶：1 KB 到 1 GB，按 4 倍递增
+var SizeBuckets = []float64{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20, 256 << 20, 1 << 30}
+
+// collector 一个指标族
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry 指标注册表，实现 http.Handler 输出全部指标
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]collector
+}
+
+// NewRegistry 创建空的注册表
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]collector{}}
+}
+
+// register 注册指标族，名称重复时 panic
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[c.name()]; ok {
+		panic("metrics: duplicate metric " + c.name())
+	}
+	r.metrics[c.name()] = c
+}
+
+// WriteTo 以 Prometheus 文本格式写出全部指标，按名称排序
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	list := make([]collector, 0, len(r.metrics))
+	for _, c := range r.metrics {
+		list = append(list, c)
+	}
+	r.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].name() < list[j].name() })
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range list {
+		c.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP 实现 http.Handler
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if req.Method == http.MethodHead {
+		return
+	}
+	r.WriteTo(w)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// desc 指标族的名称、说明与标签名
+type desc struct {
+	metricName string
+	help       string
+	typ        string
+	labels     []string
+}
+
+func (d *desc) name() string { return d.metricName }
+
+// header 写出 HELP 与 TYPE 行
+func (d *desc) header(w *bufio.Writer) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.metricName, help, d.metricName, d.typ)
+}
+
+// key 把标签值拼接为序列的键，数量与标签名不符时 panic
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.metricName, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelPairs 把序列的键还原为 {name="value",...}，extra 追加在末尾（用于 le）
+func (d *desc) labelPairs(key string, extra ...string) string {
+	var pairs []string
+	if len(d.labels) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			pairs = append(pairs, d.labels[i]+`="`+escapeLabel(v)+`"`)
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// formatFloat 按 Prometheus 的约定格式化数值
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedKeys 返回按字典序排列的序列键
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Counter 只增不减的计数器，可带标签
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter 在注册表中创建计数器，labels 为标签名
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{name, help, "counter", labels}, values: map[string]float64{}}
+	if len(labels) == 0 {
+		c.values[""] = 0
+	}
+	r.register(c)
+	return c
+}
+
+// Inc 计数加一，labelValues 与创建时的标签名一一对应
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add 计数增加 v，v 为负数时 panic
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counter " + c.metricName + " cannot decrease")
+	}
+	k := c.key(labelValues)
+	c.mu.Lock()
+	c.values[k] += v
+	c.mu.Unlock()
+}
+
+// Value 返回带 labelValues 标签的当前值
+func (c *Counter) Value(labelValues ...string) float64 {
+	k := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[k]
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.header(w)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, c.labelPairs(k), formatFloat(c.values[k]))
+	}
+}
+
+// Gauge 可增可减的仪表，可带标签
+type Gauge struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewGauge 在注册表中创建仪表
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{desc: desc{name, help, "gauge", labels}, values: map[string]float64{}}
+	if len(labels) == 0 {
+		g.values[""] = 0
+	}
+	r.register(g)
+	return g
+}
+
+// Set 设置当前值
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	k := g.key(labelValues)
+	g.mu.Lock()
+	g.values[k] = v
+	g.mu.Unlock()
+}
+
+// Add 当前值增加 v，v 可以为负数
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	k := g.key(labelValues)
+	g.mu.Lock()
+	g.values[k] += v
+	g.mu.Unlock()
+}
+
+// Value 返回带 labelValues 标签的当前值
+func (g *Gauge) Value(labelValues ...string) float64 {
+	k := g.key(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.values[k]
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.header(w)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, k := range sortedKeys(g.values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.metricName, g.labelPairs(k), formatFloat(g.values[k]))
+	}
+}
+
+// gaugeFunc 输出时调用函数取值的仪表
+type gaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc 在注册表中创建仪表，每次输出时调用 fn 取值，fn 须可并发调用
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&gaugeFunc{desc: desc{metricName: name, help: help, typ: "gauge"}, fn: fn})
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	g.header(w)
+	fmt.Fprintf(w, "%s %s\n", g.metricName, formatFloat(g.fn()))
+}
+
+// Histogram 分桶统计观测值的分布，可带标签
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // 每个分桶（不累计）的观测次数，最后一个为 +Inf
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram 在注册表中创建直方图，buckets 为递增的分桶上界，为空时使用 DefBuckets
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: histogram " + name + " buckets must be sorted")
+	}
+	h := &Histogram{desc: desc{name, help, "histogram", labels}, buckets: buckets, series: map[string]*histogramSeries{}}
+	r.register(h)
+	return h
+}
+
+// Observe 记录一次观测值
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	k := h.key(labelValues)
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[k]
+	if s == nil {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[k] = s
+	}
+	s.counts[i]++
+	s.sum += v
+	s.count++
+}
+
+// Count 返回带 labelValues 标签的观测次数
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	k := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s := h.series[k]; s != nil {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.header(w)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, k := range sortedKeys(h.series) {
+		s := h.series[k]
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelPairs(k, "le", formatFloat(le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelPairs(k, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, h.labelPairs(k), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, h.labelPairs(k), s.count)
+	}
+}
@@ -0,0 +1,311 @@
+package oci
+
+import (
+	"archive/tar"
+	"bindiff/core"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 增量包中的条目名称，bundle.json 最后写入，缺失时说明增量包被截断
+const (
+	bundleManifest = "bundle.json"
+	bundleLayers   = "layers/"
+)
+
+// bundleVersion 增量包格式版本
+const bundleVersion = 1
+
+// 层的传输方式
+const (
+	LayerUnchanged = "unchanged" // 旧镜像中已有相同的层
+	LayerDelta     = "delta"     // 以旧镜像中的某一层为基的补丁（.bdf）
+	LayerFull      = "full"      // 没有合适的基，完整传输
+)
+
+// ErrInvalidBundle 增量包不完整或与旧镜像不匹配
+var ErrInvalidBundle = errors.New("invalid OCI delta bundle")
+
+// Bundle 增量包清单
+type Bundle struct {
+	Version int `json:"version"`
+	// BaseManifest 生成增量时旧镜像清单的摘要
+	BaseManifest string `json:"base_manifest"`
+	// Target 新镜像清单的描述符，清单与配置随增量包完整传输
+	Target  Descriptor   `json:"target"`
+	Config  Descriptor   `json:"config"`
+	Layers  []LayerEntry `json:"layers"`
+	Created int64        `json:"created"`
+}
+
+// LayerEntry 新镜像中一个层的传输方式
+type LayerEntry struct {
+	Descriptor
+	Kind string `json:"kind"`
+	// Base Kind 为 LayerDelta 时作为基的旧层摘要
+	Base string `json:"base,omitempty"`
+	// Transferred 增量包中该层占用的字节数
+	Transferred int64 `json:"transferred"`
+}
+
+// Diff 配对两个镜像的层并将增量包写入 w：
+// 旧镜像中已有的层不传输，其余的层优先以旧镜像相同位置的层为基计算补丁，补丁不比原层小时完整传输
+func Diff(oldImg, newImg *Image, w io.Writer, options *core.DiffOptions) (*Bundle, error) {
+	manifestData, err := newImg.Blob(newImg.ManifestDescriptor)
+	if err != nil {
+		return nil, err
+	}
+	configData, err := newImg.Blob(newImg.Manifest.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	oldLayers := make(map[string]bool)
+	for _, l := range oldImg.Manifest.Layers {
+		oldLayers[l.Digest] = true
+	}
+
+	bundle := &Bundle{
+		Version:      bundleVersion,
+		BaseManifest: oldImg.ManifestDescriptor.Digest,
+		Target:       newImg.ManifestDescriptor,
+		Config:       newImg.Manifest.Config,
+		Created:      time.Now().Unix(),
+	}
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	if err := writeEntry(tw, "manifest.json", manifestData, now); err != nil {
+		return nil, err
+	}
+	if err := writeEntry(tw, "config.json", configData, now); err != nil {
+		return nil, err
+	}
+
+	written := make(map[string]bool)
+	for i, layer := range newImg.Manifest.Layers {
+		entry := LayerEntry{Descriptor: layer, Kind: LayerUnchanged}
+		if oldLayers[layer.Digest] || written[layer.Digest] {
+			bundle.Layers = append(bundle.Layers, entry)
+			continue
+		}
+
+		newData, err := newImg.Blob(layer)
+		if err != nil {
+			return nil, err
+		}
+		data, base, err := layerDelta(oldImg, i, newData, options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff layer %s: %w", layer.Digest, err)
+		}
+		entry.Kind, entry.Base = LayerDelta, base
+		if data == nil {
+			entry.Kind, data = LayerFull, newData
+		}
+		entry.Transferred = int64(len(data))
+		if err := writeEntry(tw, bundleLayers+layerName(layer.Digest), data, now); err != nil {
+			return nil, err
+		}
+		written[layer.Digest] = true
+		bundle.Layers = append(bundle.Layers, entry)
+	}
+
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEntry(tw, bundleManifest, data, now); err != nil {
+		return nil, err
+	}
+	return bundle, tw.Close()
+}
+
+// layerDelta 以旧镜像第 i 层（不存在时为最后一层）为基计算补丁文件，
+// 旧镜像没有层、层超出补丁头能记录的大小或补丁不比新层小时返回 nil
+func layerDelta(oldImg *Image, i int, newData []byte, options *core.DiffOptions) ([]byte, string, error) {
+	layers := oldImg.Manifest.Layers
+	if len(layers) == 0 {
+		return nil, "", nil
+	}
+	if i >= len(layers) {
+		i = len(layers) - 1
+	}
+	base := layers[i]
+	oldData, err := oldImg.Blob(base)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := core.CreatePatchFile(oldData, newData, options)
+	if errors.Is(err, core.ErrPatchTooLarge) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) >= len(newData) {
+		return nil, "", nil
+	}
+	return data, base.Digest, nil
+}
+
+// Apply 将增量包应用到旧镜像，在 dir 中写出新镜像的 OCI 镜像布局。
+// 所有层在写出前按摘要校验
+func Apply(oldImg *Image, r io.Reader, dir string, options *core.ApplyOptions) (*Bundle, error) {
+	files := make(map[string][]byte)
+	var bundle *Bundle
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+		if bundle != nil {
+			return nil, fmt.Errorf("%w: unexpected entry %s after bundle manifest", ErrInvalidBundle, hdr.Name)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+		if name := path.Clean(hdr.Name); name == bundleManifest {
+			bundle = &Bundle{}
+			if err := json.Unmarshal(data, bundle); err != nil {
+				return nil, fmt.Errorf("%w: bad bundle manifest: %v", ErrInvalidBundle, err)
+			}
+		} else {
+			files[name] = data
+		}
+	}
+
+	switch {
+	case bundle == nil:
+		return nil, fmt.Errorf("%w: missing bundle manifest (truncated bundle?)", ErrInvalidBundle)
+	case bundle.Version != bundleVersion:
+		return nil, fmt.Errorf("%w: unsupported bundle version %d", ErrInvalidBundle, bundle.Version)
+	case bundle.BaseManifest != oldImg.ManifestDescriptor.Digest:
+		return nil, fmt.Errorf("%w: bundle was built against %s, image is %s",
+			ErrInvalidBundle, bundle.BaseManifest, oldImg.ManifestDescriptor.Digest)
+	}
+
+	blobs := make(map[string][]byte)
+	verified := func(d Descriptor, data []byte) error {
+		if int64(len(data)) != d.Size || Digest(data) != d.Digest {
+			return fmt.Errorf("%w: %s does not match its descriptor", ErrInvalidBundle, d.Digest)
+		}
+		blobs[d.Digest] = data
+		return nil
+	}
+	if err := verified(bundle.Target, files["manifest.json"]); err != nil {
+		return nil, err
+	}
+	if err := verified(bundle.Config, files["config.json"]); err != nil {
+		return nil, err
+	}
+
+	oldLayers := make(map[string]Descriptor)
+	for _, l := range oldImg.Manifest.Layers {
+		oldLayers[l.Digest] = l
+	}
+	for _, layer := range bundle.Layers {
+		if _, ok := blobs[layer.Digest]; ok {
+			continue
+		}
+		var data []byte
+		switch layer.Kind {
+		case LayerUnchanged:
+			old, ok := oldLayers[layer.Digest]
+			if !ok {
+				return nil, fmt.Errorf("%w: layer %s is not in the old image", ErrInvalidBundle, layer.Digest)
+			}
+			var err error
+			if data, err = oldImg.Blob(old); err != nil {
+				return nil, err
+			}
+		case LayerFull:
+			data = files[bundleLayers+layerName(layer.Digest)]
+		case LayerDelta:
+			base, ok := oldLayers[layer.Base]
+			if !ok {
+				return nil, fmt.Errorf("%w: base layer %s is not in the old image", ErrInvalidBundle, layer.Base)
+			}
+			oldData, err := oldImg.Blob(base)
+			if err != nil {
+				return nil, err
+			}
+			df, err := core.DecodeDiffFile(files[bundleLayers+layerName(layer.Digest)])
+			if err != nil {
+				return nil, fmt.Errorf("layer %s: %w", layer.Digest, err)
+			}
+			if data, err = core.ApplyDiffFile(oldData, df, options); err != nil {
+				return nil, fmt.Errorf("layer %s: %w", layer.Digest, err)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown layer kind %q", ErrInvalidBundle, layer.Kind)
+		}
+		if err := verified(layer.Descriptor, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return bundle, writeLayout(dir, bundle.Target, blobs)
+}
+
+// writeLayout 写出只包含一个镜像的 OCI 镜像布局
+func writeLayout(dir string, target Descriptor, blobs map[string][]byte) error {
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+		return err
+	}
+	for digest, data := range blobs {
+		name, err := blobPath(digest)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), data, 0644); err != nil {
+			return err
+		}
+	}
+
+	index, err := json.MarshalIndent(Index{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeImageIndex,
+		Manifests:     []Descriptor{target},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), index, 0644); err != nil {
+		return err
+	}
+	layout := fmt.Sprintf(`{"imageLayoutVersion":%q}`, imageLayoutVersion)
+	return os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(layout), 0644)
+}
+
+// layerName 增量包中层条目的文件名
+func layerName(digest string) string {
+	return strings.TrimPrefix(digest, "sha256:")
+}
+
+// writeEntry 写入一个常规文件条目
+func writeEntry(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write bundle entry %s: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write bundle entry %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+// Package oci 实现 OCI 镜像的逐层增量：配对新旧镜像的层，生成可离线分发的增量包
+package oci
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// 镜像布局中使用的媒体类型
+const (
+	MediaTypeImageIndex    = "application/vnd.oci.image.index.v1+json"
+	MediaTypeImageManifest = "application/vnd.oci.image.manifest.v1+json"
+	// Docker 格式的清单与 OCI 清单结构相同
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// imageLayoutVersion oci-layout 文件中的布局版本
+const imageLayoutVersion = "1.0.0"
+
+// ErrInvalidImage 镜像布局不完整或内容与摘要不一致
+var ErrInvalidImage = errors.New("invalid OCI image")
+
+// Descriptor OCI 内容描述符
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Index OCI 镜像索引（index.json）
+type Index struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// Manifest OCI 镜像清单，只解析增量需要的字段
+type Manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        Descriptor   `json:"config"`
+	Layers        []Descriptor `json:"layers"`
+}
+
+// Image 一个 OCI 镜像布局中的单平台镜像
+type Image struct {
+	// ManifestDescriptor 索引中指向清单的描述符
+	ManifestDescriptor Descriptor
+	Manifest           Manifest
+	read               func(name string) ([]byte, error)
+}
+
+// Open 打开 OCI 镜像：目录按镜像布局读取，文件按（可 gzip 压缩的）oci-archive tar 读取
+func Open(name string) (*Image, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return OpenFS(os.DirFS(name))
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return OpenArchive(f)
+}
+
+// OpenFS 从镜像布局文件系统打开镜像
+func OpenFS(fsys fs.FS) (*Image, error) {
+	return load(func(name string) ([]byte, error) {
+		return fs.ReadFile(fsys, name)
+	})
+}
+
+// OpenArchive 从 tar 格式的镜像布局打开镜像，所有条目读入内存
+func OpenArchive(r io.Reader) (*Image, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		files[path.Clean(strings.TrimPrefix(hdr.Name, "./"))] = data
+	}
+	return load(func(name string) ([]byte, error) {
+		data, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+		}
+		return data, nil
+	})
+}
+
+// load 读取布局版本、索引与镜像清单
+func load(read func(name string) ([]byte, error)) (*Image, error) {
+	data, err := read("oci-layout")
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing oci-layout: %v", ErrInvalidImage, err)
+	}
+	var layout struct {
+		Version string `json:"imageLayoutVersion"`
+	}
+	if err := json.Unmarshal(data, &layout); err != nil || layout.Version != imageLayoutVersion {
+		return nil, fmt.Errorf("%w: unsupported image layout version %q", ErrInvalidImage, layout.Version)
+	}
+
+	data, err = read("index.json")
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing index.json: %v", ErrInvalidImage, err)
+	}
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("%w: bad index.json: %v", ErrInvalidImage, err)
+	}
+
+	img := &Image{read: read}
+	var manifests []Descriptor
+	for _, d := range index.Manifests {
+		if d.MediaType == MediaTypeImageManifest || d.MediaType == mediaTypeDockerManifest {
+			manifests = append(manifests, d)
+		}
+	}
+	switch len(manifests) {
+	case 0:
+		return nil, fmt.Errorf("%w: index.json contains no image manifest (multi-platform indexes are not supported)", ErrInvalidImage)
+	case 1:
+		img.ManifestDescriptor = manifests[0]
+	default:
+		return nil, fmt.Errorf("%w: index.json contains %d image manifests, expected one", ErrInvalidImage, len(manifests))
+	}
+
+	data, err = img.Blob(img.ManifestDescriptor)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &img.Manifest); err != nil {
+		return nil, fmt.Errorf("%w: bad manifest: %v", ErrInvalidImage, err)
+	}
+	return img, nil
+}
+
+// Blob 读取描述符指向的内容并校验大小与摘要
+func (img *Image) Blob(d Descriptor) ([]byte, error) {
+	name, err := blobPath(d.Digest)
+	if err != nil {
+		return nil, err
+	}
+	data, err := img.read(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing blob %s: %v", ErrInvalidImage, d.Digest, err)
+	}
+	if int64(len(data)) != d.Size || Digest(data) != d.Digest {
+		return nil, fmt.Errorf("%w: blob %s does not match its descriptor", ErrInvalidImage, d.Digest)
+	}
+	return data, nil
+}
+
+// Digest 计算数据的 sha256 摘要（"sha256:<hex>"）
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// blobPath 返回摘要在镜像布局中的路径，只支持 sha256
+func blobPath(digest string) (string, error) {
+	hexPart, ok := strings.CutPrefix(digest, "sha256:")
+	if !ok || len(hexPart) != sha256.Size*2 {
+		return "", fmt.Errorf("%w: unsupported digest %q", ErrInvalidImage, digest)
+	}
+	if _, err := hex.DecodeString(hexPart); err != nil {
+		return "", fmt.Errorf("%w: unsupported digest %q", ErrInvalidImage, digest)
+	}
+	return "blobs/sha256/" + hexPart, nil
+}
@@ -0,0 +1,688 @@
+package ostree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"bindiff/core"
+	"bindiff/pkg/utils"
+	"bindiff/types"
+)
+
+// 静态增量的 GVariant 类型（ostree-repo-static-delta-private.h）
+const (
+	superblockType  = "(a{sv}tayay" + commitType + "aya(uayttay)a(yaytt))"
+	metaEntryType   = "(uayttay)"
+	partPayloadType = "(a(uuu)aa(ayay)ayay)"
+)
+
+// 部分文件第一个字节的压缩类型，只生成未压缩的部分
+const (
+	compressionNone = '0'
+	compressionLZMA = 'x'
+)
+
+// 部分中的操作码
+const (
+	opOpenSpliceAndClose = 'S'
+	opOpen               = 'o'
+	opWrite              = 'w'
+	opSetReadSource      = 'r'
+	opUnsetReadSource    = 'R'
+	opClose              = 'c'
+)
+
+// 默认参数
+const (
+	DefaultMaxPartSize  = 32 << 20
+	DefaultMinFuzzySize = 1024
+)
+
+// ErrInvalidDelta 静态增量不完整、损坏或使用了不支持的特性
+var ErrInvalidDelta = errors.New("invalid OSTree static delta")
+
+// DeltaOptions 静态增量生成选项
+type DeltaOptions struct {
+	// MaxPartSize 单个部分负载与操作的大小上限，0 使用 DefaultMaxPartSize
+	MaxPartSize int64
+	// MinFuzzySize 小于该大小的修改文件整体写入，0 使用 DefaultMinFuzzySize
+	MinFuzzySize int64
+	// Diff 以旧文件为基差分修改文件时的选项
+	Diff *core.DiffOptions
+}
+
+// Delta 生成或应用的静态增量概况
+type Delta struct {
+	// Dir 增量目录（superblock 与各部分）
+	Dir      string
+	From, To string
+	Parts    int
+	Objects  int
+	// Fuzzy 以旧提交中同一路径的文件为基差分的文件对象数
+	Fuzzy int
+	// Size superblock 与各部分的总大小
+	Size int64
+}
+
+// DeltaPath 返回仓库中从 from 到 to 的增量目录的相对路径，from 为空时为完整增量：
+// deltas/<from 前两位>/<from 其余部分>-<to>，校验和使用 OSTree 的修改版 base64（'/' 替换为 '_'）
+func DeltaPath(from, to string) (string, error) {
+	toName, err := checksumB64(to)
+	if err != nil {
+		return "", err
+	}
+	if from == "" {
+		return filepath.Join("deltas", toName[:2], toName[2:]), nil
+	}
+	fromName, err := checksumB64(from)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join("deltas", fromName[:2], fromName[2:]+"-"+toName), nil
+}
+
+// checksumB64 把十六进制校验和转换为无填充、'/' 替换为 '_' 的 base64
+func checksumB64(checksum string) (string, error) {
+	raw, err := hex.DecodeString(checksum)
+	if err != nil || len(raw) != sha256.Size {
+		return "", fmt.Errorf("invalid checksum %q", checksum)
+	}
+	return strings.ReplaceAll(base64.RawStdEncoding.EncodeToString(raw), "/", "_"), nil
+}
+
+// GenerateDelta 生成从提交 from 到 to 的静态增量并写入仓库的 deltas 目录，from 为空时生成完整增量。
+// 旧提交中已有的对象不进入增量；同一路径的文件被修改时以旧文件为读取源，只写入差异部分
+func GenerateDelta(r *Repo, from, to string, options *DeltaOptions) (*Delta, error) {
+	if options == nil {
+		options = &DeltaOptions{}
+	}
+	maxPart, minFuzzy := options.MaxPartSize, options.MinFuzzySize
+	if maxPart <= 0 {
+		maxPart = DefaultMaxPartSize
+	}
+	if minFuzzy <= 0 {
+		minFuzzy = DefaultMinFuzzySize
+	}
+
+	commitData, err := r.ReadMetadata(to, ObjectCommit)
+	if err != nil {
+		return nil, err
+	}
+	_, toTree, err := r.walk(to)
+	if err != nil {
+		return nil, err
+	}
+	have := make(map[Object]bool)
+	sources := make(map[string]string)
+	if from != "" {
+		_, fromTree, err := r.walk(from)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range fromTree.objects {
+			have[o] = true
+		}
+		// 新文件对象以旧提交中同一路径的文件为读取源，路径排序保证结果稳定
+		paths := make([]string, 0, len(toTree.files))
+		for p := range toTree.files {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			sum := toTree.files[p]
+			if old, ok := fromTree.files[p]; ok && old != sum && sources[sum] == "" {
+				sources[sum] = old
+			}
+		}
+	}
+
+	rel, err := DeltaPath(from, to)
+	if err != nil {
+		return nil, err
+	}
+	delta := &Delta{Dir: filepath.Join(r.Path, rel), From: from, To: to}
+	var entries [][]byte
+	part := newPartBuilder()
+	flush := func() error {
+		if len(part.objects) == 0 {
+			return nil
+		}
+		entry, size, err := part.write(filepath.Join(delta.Dir, strconv.Itoa(len(entries))))
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		delta.Size += size
+		part = newPartBuilder()
+		return nil
+	}
+
+	for _, o := range toTree.objects {
+		if have[o] {
+			continue
+		}
+		var err error
+		if o.Type == ObjectFile {
+			var fuzzy bool
+			fuzzy, err = part.addContent(r, o.Checksum, sources[o.Checksum], minFuzzy, options.Diff)
+			if fuzzy {
+				delta.Fuzzy++
+			}
+		} else {
+			err = part.addMetadata(r, o)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s.%s: %w", o.Checksum, o.Type, err)
+		}
+		delta.Objects++
+		if part.size() >= maxPart {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	delta.Parts = len(entries)
+
+	superblock := encodeSuperblock(from, to, commitData, entries)
+	if err := utils.SafeWrite(filepath.Join(delta.Dir, "superblock"), superblock); err != nil {
+		return nil, err
+	}
+	delta.Size += int64(len(superblock))
+	return delta, nil
+}
+
+// encodeSuperblock 序列化 superblock：元数据、时间戳、起止提交、目标提交对象、依赖（空）、部分列表与回退对象（空）
+func encodeSuperblock(from, to string, commit []byte, entries [][]byte) []byte {
+	var fromRaw []byte
+	if from != "" {
+		fromRaw, _ = hex.DecodeString(from)
+	}
+	toRaw, _ := hex.DecodeString(to)
+	// 声明小端序，libostree 据此解读负载中的数值
+	endianness := encodeTuple("{sv}", encodeString("ostree.endianness"), append([]byte{'l', 0}, 'y'))
+	metadata := encodeArray("{sv}", [][]byte{endianness})
+	return encodeTuple(superblockType, metadata, beUint64(uint64(time.Now().Unix())), fromRaw, toRaw, commit,
+		nil, encodeArray(metaEntryType, entries), nil)
+}
+
+// partBuilder 一个部分的负载、操作与所写对象
+type partBuilder struct {
+	modes    map[[3]uint32]uint64
+	modeList [][]byte
+	payload  []byte
+	ops      []byte
+	objects  []byte
+}
+
+func newPartBuilder() *partBuilder {
+	return &partBuilder{modes: make(map[[3]uint32]uint64)}
+}
+
+// size 返回当前负载与操作的大小
+func (p *partBuilder) size() int64 {
+	return int64(len(p.payload) + len(p.ops))
+}
+
+// op 追加操作码与 varint 参数
+func (p *partBuilder) op(code byte, args ...uint64) {
+	p.ops = append(p.ops, code)
+	for _, a := range args {
+		p.ops = binary.AppendUvarint(p.ops, a)
+	}
+}
+
+// appendPayload 追加负载数据，返回其偏移
+func (p *partBuilder) appendPayload(data []byte) uint64 {
+	off := uint64(len(p.payload))
+	p.payload = append(p.payload, data...)
+	return off
+}
+
+// addObject 记录部分写出的下一个对象
+func (p *partBuilder) addObject(t ObjectType, checksum string) {
+	raw, _ := hex.DecodeString(checksum)
+	p.objects = append(append(p.objects, byte(t)), raw...)
+}
+
+// modeIndex 返回 (uid, gid, mode) 在模式表中的序号
+func (p *partBuilder) modeIndex(c *Content) uint64 {
+	key := [3]uint32{c.UID, c.GID, c.Mode}
+	if i, ok := p.modes[key]; ok {
+		return i
+	}
+	i := uint64(len(p.modeList))
+	p.modes[key] = i
+	p.modeList = append(p.modeList, encodeTuple("(uuu)", beUint32(c.UID), beUint32(c.GID), beUint32(c.Mode)))
+	return i
+}
+
+// addMetadata 以负载中的数据整体写入元数据对象
+func (p *partBuilder) addMetadata(r *Repo, o Object) error {
+	data, err := r.ReadMetadata(o.Checksum, o.Type)
+	if err != nil {
+		return err
+	}
+	p.addObject(o.Type, o.Checksum)
+	p.op(opOpenSpliceAndClose, uint64(len(data)), p.appendPayload(data))
+	return nil
+}
+
+// addContent 写入文件对象。有读取源且差分能省下至少四分之一时以旧文件为源复制相同部分，返回是否使用了读取源
+func (p *partBuilder) addContent(r *Repo, checksum, source string, minFuzzy int64, options *core.DiffOptions) (bool, error) {
+	c, err := r.ReadContent(checksum)
+	if err != nil {
+		return false, err
+	}
+	p.addObject(ObjectFile, checksum)
+	mode := p.modeIndex(c)
+
+	if source != "" && !c.IsSymlink() && int64(len(c.Data)) >= minFuzzy {
+		old, err := r.ReadContent(source)
+		if err != nil {
+			return false, err
+		}
+		if !old.IsSymlink() {
+			chunks, literal, err := deltaChunks(old.Data, c.Data, options)
+			if err != nil {
+				return false, err
+			}
+			if literal*4 <= len(c.Data)*3 {
+				p.op(opOpen, mode, 0, uint64(len(c.Data)))
+				raw, _ := hex.DecodeString(source)
+				sourceOffset := p.appendPayload(raw)
+				reading := false
+				for _, ch := range chunks {
+					if ch.data == nil {
+						if !reading {
+							p.op(opSetReadSource, sourceOffset)
+							reading = true
+						}
+						p.op(opWrite, uint64(ch.length), uint64(ch.offset))
+						continue
+					}
+					if reading {
+						p.op(opUnsetReadSource)
+						reading = false
+					}
+					p.op(opWrite, uint64(len(ch.data)), p.appendPayload(ch.data))
+				}
+				if reading {
+					p.op(opUnsetReadSource)
+				}
+				p.op(opClose)
+				return true, nil
+			}
+		}
+	}
+
+	p.op(opOpenSpliceAndClose, mode, 0, uint64(len(c.Data)), p.appendPayload(c.Data))
+	return false, nil
+}
+
+// chunk 新文件的一段：data 为 nil 时复制旧文件 [offset, offset+length)
+type chunk struct {
+	offset, length int
+	data           []byte
+}
+
+// deltaChunks 差分旧文件与新文件，按 Apply 的语义展开为复制与字面数据，返回字面数据总长度
+func deltaChunks(oldData, newData []byte, options *core.DiffOptions) ([]chunk, int, error) {
+	patches, err := core.DiffBytes(oldData, newData, options)
+	if err != nil {
+		return nil, 0, err
+	}
+	var chunks []chunk
+	literal, cursor := 0, 0
+	copyOld := func(end int) {
+		if end <= cursor {
+			return
+		}
+		if n := len(chunks); n > 0 && chunks[n-1].data == nil && chunks[n-1].offset+chunks[n-1].length == cursor {
+			chunks[n-1].length += end - cursor
+		} else {
+			chunks = append(chunks, chunk{offset: cursor, length: end - cursor})
+		}
+		cursor = end
+	}
+	insert := func(data []byte) {
+		if len(data) == 0 {
+			return
+		}
+		literal += len(data)
+		if n := len(chunks); n > 0 && chunks[n-1].data != nil {
+			chunks[n-1].data = append(chunks[n-1].data, data...)
+		} else {
+			chunks = append(chunks, chunk{data: append([]byte(nil), data...)})
+		}
+	}
+
+	for i, p := range patches {
+		if p.Offset < 0 || p.Length < 0 || int(p.Offset) > len(oldData) {
+			return nil, 0, fmt.Errorf("%w: patch %d offset %d out of range", core.ErrCorruptPatch, i, p.Offset)
+		}
+		copyOld(int(p.Offset))
+		end := cursor + int(p.Length)
+		switch p.Op {
+		case types.OP_INSERT:
+			insert(p.Data)
+		case types.OP_REPLACE, types.OP_DELETE:
+			if end > len(oldData) {
+				return nil, 0, fmt.Errorf("%w: patch %d length exceeds old data", core.ErrCorruptPatch, i)
+			}
+			cursor = end
+			if p.Op == types.OP_REPLACE {
+				insert(p.Data)
+			}
+		case types.OP_COPY, types.OP_MATCH:
+			if end > len(oldData) {
+				return nil, 0, fmt.Errorf("%w: patch %d copy exceeds old data", core.ErrCorruptPatch, i)
+			}
+			copyOld(end)
+		default:
+			return nil, 0, fmt.Errorf("%w: patch %d has unknown operation %d", core.ErrCorruptPatch, i, p.Op)
+		}
+	}
+	copyOld(len(oldData))
+	return chunks, literal, nil
+}
+
+// write 写出未压缩的部分文件，返回 superblock 中的部分条目与文件大小
+func (p *partBuilder) write(name string) ([]byte, int64, error) {
+	payload := encodeTuple(partPayloadType, encodeArray("(uuu)", p.modeList),
+		encodeArray("a(ayay)", [][]byte{nil}), p.payload, p.ops)
+	data := append([]byte{compressionNone}, payload...)
+	if err := utils.SafeWrite(name, data); err != nil {
+		return nil, 0, err
+	}
+	sum := sha256.Sum256(data)
+	entry := encodeTuple(metaEntryType, beUint32(0), sum[:], beUint64(uint64(len(data))),
+		beUint64(uint64(len(payload))), p.objects)
+	return entry, int64(len(data)), nil
+}
+
+// ApplyDelta 把 dir 中的静态增量应用到 archive 模式仓库：读取源取自仓库中已有的对象，
+// 每个对象写入前校验校验和，最后写入目标提交。不更新引用
+func ApplyDelta(r *Repo, dir string) (*Delta, error) {
+	if r.Mode != ModeArchive {
+		return nil, fmt.Errorf("%w: deltas can only be applied to archive repositories", ErrInvalidRepo)
+	}
+	superblock, err := os.ReadFile(filepath.Join(dir, "superblock"))
+	if err != nil {
+		return nil, err
+	}
+	fields, err := splitTuple(superblock, superblockType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: superblock: %v", ErrInvalidDelta, err)
+	}
+	if len(fields[3]) != sha256.Size || (len(fields[2]) != 0 && len(fields[2]) != sha256.Size) {
+		return nil, fmt.Errorf("%w: bad commit checksums in superblock", ErrInvalidDelta)
+	}
+	if len(fields[5]) != 0 || len(fields[7]) != 0 {
+		return nil, fmt.Errorf("%w: dependent deltas and fallback objects are not supported", ErrInvalidDelta)
+	}
+	delta := &Delta{Dir: dir, From: hex.EncodeToString(fields[2]), To: hex.EncodeToString(fields[3])}
+	if len(fields[2]) == 0 {
+		delta.From = ""
+	}
+	if sum := sha256.Sum256(fields[4]); hex.EncodeToString(sum[:]) != delta.To {
+		return nil, fmt.Errorf("%w: commit object does not match %s", ErrInvalidDelta, delta.To)
+	}
+	if from := delta.From; from != "" {
+		if _, err := os.Stat(r.objectPath(from, ObjectCommit)); err != nil {
+			return nil, fmt.Errorf("delta base commit %s is not in the repository: %w", from, err)
+		}
+	}
+
+	entries, err := splitArray(fields[6], metaEntryType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDelta, err)
+	}
+	for i, entry := range entries {
+		n, err := applyPart(r, filepath.Join(dir, strconv.Itoa(i)), entry)
+		if err != nil {
+			return nil, fmt.Errorf("part %d: %w", i, err)
+		}
+		delta.Objects += n
+	}
+	delta.Parts = len(entries)
+	if _, err := r.writeMetadata(ObjectCommit, fields[4]); err != nil {
+		return nil, err
+	}
+	return delta, nil
+}
+
+// applyPart 校验并执行一个部分，返回写入的对象数
+func applyPart(r *Repo, name string, entry []byte) (int, error) {
+	meta, err := splitTuple(entry, metaEntryType)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidDelta, err)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return 0, err
+	}
+	if sum := sha256.Sum256(data); !bytes.Equal(sum[:], meta[1]) {
+		return 0, fmt.Errorf("%w: part checksum mismatch", ErrInvalidDelta)
+	}
+	if len(data) > 0 && data[0] == compressionLZMA {
+		return 0, fmt.Errorf("%w: LZMA-compressed parts are not supported", ErrInvalidDelta)
+	}
+	if len(data) == 0 || data[0] != compressionNone {
+		return 0, fmt.Errorf("%w: unknown part compression", ErrInvalidDelta)
+	}
+	payloadFields, err := splitTuple(data[1:], partPayloadType)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidDelta, err)
+	}
+	modes, err := splitArray(payloadFields[0], "(uuu)")
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidDelta, err)
+	}
+	objects := meta[4]
+	if len(objects)%(1+sha256.Size) != 0 {
+		return 0, fmt.Errorf("%w: malformed object list", ErrInvalidDelta)
+	}
+
+	x := &partExecutor{repo: r, payload: payloadFields[2], ops: payloadFields[3], modes: modes, objects: objects}
+	if err := x.run(); err != nil {
+		return 0, err
+	}
+	return len(objects) / (1 + sha256.Size), nil
+}
+
+// partExecutor 依次执行部分中的操作，每个对象完成时校验并写入仓库
+type partExecutor struct {
+	repo    *Repo
+	payload []byte
+	ops     []byte
+	modes   [][]byte
+	objects []byte
+	pc      int
+
+	// 正在写入的文件对象与读取源
+	current *Content
+	size    uint64
+	source  *Content
+}
+
+// arg 读取一个 varint 参数
+func (x *partExecutor) arg() (uint64, error) {
+	v, n := binary.Uvarint(x.ops[x.pc:])
+	if n <= 0 {
+		return 0, fmt.Errorf("%w: truncated operation arguments", ErrInvalidDelta)
+	}
+	x.pc += n
+	return v, nil
+}
+
+// args 读取 n 个 varint 参数
+func (x *partExecutor) args(n int) ([]uint64, error) {
+	out := make([]uint64, n)
+	for i := range out {
+		v, err := x.arg()
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// slice 返回 data[off:off+size]，越界时报错
+func slice(data []byte, off, size uint64) ([]byte, error) {
+	if off > uint64(len(data)) || size > uint64(len(data))-off {
+		return nil, fmt.Errorf("%w: range %d+%d exceeds %d bytes", ErrInvalidDelta, off, size, len(data))
+	}
+	return data[off : off+size], nil
+}
+
+// next 返回下一个要写出的对象
+func (x *partExecutor) next() (ObjectType, string, error) {
+	if len(x.objects) == 0 {
+		return 0, "", fmt.Errorf("%w: more objects written than listed", ErrInvalidDelta)
+	}
+	t, sum := ObjectType(x.objects[0]), hex.EncodeToString(x.objects[1:1+sha256.Size])
+	x.objects = x.objects[1+sha256.Size:]
+	return t, sum, nil
+}
+
+// open 按模式表序号创建文件对象
+func (x *partExecutor) open(modeIndex uint64) error {
+	if modeIndex >= uint64(len(x.modes)) {
+		return fmt.Errorf("%w: mode index %d out of range", ErrInvalidDelta, modeIndex)
+	}
+	m := x.modes[modeIndex]
+	x.current = &Content{
+		UID:  binary.BigEndian.Uint32(m[0:]),
+		GID:  binary.BigEndian.Uint32(m[4:]),
+		Mode: binary.BigEndian.Uint32(m[8:]),
+	}
+	return nil
+}
+
+// closeContent 校验并写入当前文件对象
+func (x *partExecutor) closeContent() error {
+	t, sum, err := x.next()
+	if err != nil {
+		return err
+	}
+	if t != ObjectFile || uint64(len(x.current.Data)) != x.size {
+		return fmt.Errorf("%w: content object %s is incomplete", ErrInvalidDelta, sum)
+	}
+	if got := ContentChecksum(x.current); got != sum {
+		return fmt.Errorf("%w: content object %s has checksum %s", ErrInvalidDelta, sum, got)
+	}
+	_, err = x.repo.writeContent(x.current)
+	x.current = nil
+	return err
+}
+
+func (x *partExecutor) run() error {
+	for x.pc < len(x.ops) {
+		code := x.ops[x.pc]
+		x.pc++
+		switch code {
+		case opOpenSpliceAndClose:
+			if len(x.objects) > 0 && ObjectType(x.objects[0]) != ObjectFile {
+				a, err := x.args(2)
+				if err != nil {
+					return err
+				}
+				data, err := slice(x.payload, a[1], a[0])
+				if err != nil {
+					return err
+				}
+				t, sum, _ := x.next()
+				if got, err := x.repo.writeMetadata(t, data); err != nil {
+					return err
+				} else if got != sum {
+					return fmt.Errorf("%w: %s object %s has checksum %s", ErrInvalidDelta, t, sum, got)
+				}
+				continue
+			}
+			a, err := x.args(4)
+			if err != nil {
+				return err
+			}
+			if err := x.open(a[0]); err != nil {
+				return err
+			}
+			data, err := slice(x.payload, a[3], a[2])
+			if err != nil {
+				return err
+			}
+			x.current.Data, x.size = data, a[2]
+			if err := x.closeContent(); err != nil {
+				return err
+			}
+		case opOpen:
+			a, err := x.args(3)
+			if err != nil {
+				return err
+			}
+			if err := x.open(a[0]); err != nil {
+				return err
+			}
+			x.size = a[2]
+			x.current.Data = make([]byte, 0, min(a[2], uint64(len(x.payload))+1<<20))
+		case opWrite:
+			a, err := x.args(2)
+			if err != nil {
+				return err
+			}
+			src := x.payload
+			if x.source != nil {
+				src = x.source.Data
+			}
+			data, err := slice(src, a[1], a[0])
+			if err != nil {
+				return err
+			}
+			if x.current == nil || uint64(len(x.current.Data))+a[0] > x.size {
+				return fmt.Errorf("%w: write outside an open object", ErrInvalidDelta)
+			}
+			x.current.Data = append(x.current.Data, data...)
+		case opSetReadSource:
+			off, err := x.arg()
+			if err != nil {
+				return err
+			}
+			raw, err := slice(x.payload, off, sha256.Size)
+			if err != nil {
+				return err
+			}
+			if x.source, err = x.repo.ReadContent(hex.EncodeToString(raw)); err != nil {
+				return fmt.Errorf("failed to read delta source: %w", err)
+			}
+		case opUnsetReadSource:
+			x.source = nil
+		case opClose:
+			if x.current == nil {
+				return fmt.Errorf("%w: close without an open object", ErrInvalidDelta)
+			}
+			if err := x.closeContent(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: unsupported operation %q", ErrInvalidDelta, code)
+		}
+	}
+	if len(x.objects) > 0 || x.current != nil {
+		return fmt.Errorf("%w: part ends before all objects are written", ErrInvalidDelta)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package ostree
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// GVariant 序列化格式（glib gvariant-serialiser）的最小实现，只覆盖 OSTree 对象与静态增量用到的类型。
+// 数值按小端序存放，OSTree 写入的整数字段本身已转换为大端序，由调用方处理
+
+// gvType 类型的对齐要求与定长大小，size 为 0 表示变长
+type gvType struct {
+	align int
+	size  int
+}
+
+// parseType 解析 sig 开头的一个完整类型，返回类型信息与剩余部分
+func parseType(sig string) (gvType, string) {
+	switch sig[0] {
+	case 'y', 'b':
+		return gvType{1, 1}, sig[1:]
+	case 'n', 'q':
+		return gvType{2, 2}, sig[1:]
+	case 'i', 'u', 'h':
+		return gvType{4, 4}, sig[1:]
+	case 'x', 't', 'd':
+		return gvType{8, 8}, sig[1:]
+	case 's', 'o', 'g':
+		return gvType{1, 0}, sig[1:]
+	case 'v':
+		return gvType{8, 0}, sig[1:]
+	case 'a':
+		elem, rest := parseType(sig[1:])
+		return gvType{elem.align, 0}, rest
+	case '(', '{':
+		t, rest := gvType{align: 1}, sig[1:]
+		fixed, size := true, 0
+		for rest[0] != ')' && rest[0] != '}' {
+			var m gvType
+			m, rest = parseType(rest)
+			t.align = max(t.align, m.align)
+			if m.size == 0 {
+				fixed = false
+			} else {
+				size = alignUp(size, m.align) + m.size
+			}
+		}
+		if fixed {
+			// 空元组占一个字节，定长元组的大小补齐到对齐边界
+			t.size = max(alignUp(size, t.align), 1)
+		}
+		return t, rest[1:]
+	}
+	panic("ostree: unsupported GVariant type " + sig)
+}
+
+// memberTypes 拆分元组类型的成员类型
+func memberTypes(sig string) []string {
+	var members []string
+	rest := sig[1 : len(sig)-1]
+	for rest != "" {
+		_, next := parseType(rest)
+		members = append(members, rest[:len(rest)-len(next)])
+		rest = next
+	}
+	return members
+}
+
+func alignUp(n, align int) int {
+	return (n + align - 1) &^ (align - 1)
+}
+
+// offsetSize 容器总大小为 n 时 framing offset 的字节数
+func offsetSize(n int) int {
+	switch {
+	case n == 0:
+		return 0
+	case n <= 0xff:
+		return 1
+	case n <= 0xffff:
+		return 2
+	case uint64(n) <= 0xffffffff:
+		return 4
+	default:
+		return 8
+	}
+}
+
+// readOffset 读取 w 字节的小端 framing offset
+func readOffset(b []byte, w int) int {
+	var v uint64
+	for i := w - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return int(v)
+}
+
+// splitTuple 按元组类型 sig 拆分 data，返回各成员的序列化数据
+func splitTuple(data []byte, sig string) ([][]byte, error) {
+	members := memberTypes(sig)
+	w := offsetSize(len(data))
+	out := make([][]byte, len(members))
+	pos, offEnd := 0, len(data)
+	for i, m := range members {
+		t, _ := parseType(m)
+		pos = alignUp(pos, t.align)
+		var end int
+		switch {
+		case t.size > 0:
+			end = pos + t.size
+		case i == len(members)-1:
+			end = offEnd
+		default:
+			// 除最后一个成员外，变长成员的结束位置从末尾逆序读取
+			offEnd -= w
+			if w == 0 || offEnd < pos {
+				return nil, fmt.Errorf("%w: truncated %s", ErrInvalidObject, sig)
+			}
+			end = readOffset(data[offEnd:], w)
+		}
+		if end < pos || end > offEnd {
+			return nil, fmt.Errorf("%w: bad framing in %s", ErrInvalidObject, sig)
+		}
+		out[i] = data[pos:end]
+		pos = end
+	}
+	return out, nil
+}
+
+// splitArray 拆分元素类型为 elem 的数组
+func splitArray(data []byte, elem string) ([][]byte, error) {
+	t, _ := parseType(elem)
+	var out [][]byte
+	if t.size > 0 {
+		if len(data)%t.size != 0 {
+			return nil, fmt.Errorf("%w: array of %s has %d bytes", ErrInvalidObject, elem, len(data))
+		}
+		for pos := 0; pos < len(data); pos += t.size {
+			out = append(out, data[pos:pos+t.size])
+		}
+		return out, nil
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	w := offsetSize(len(data))
+	start := readOffset(data[len(data)-w:], w)
+	if start > len(data) || (len(data)-start)%w != 0 {
+		return nil, fmt.Errorf("%w: bad framing in array of %s", ErrInvalidObject, elem)
+	}
+	pos := 0
+	for off := start; off < len(data); off += w {
+		end := readOffset(data[off:], w)
+		pos = alignUp(pos, t.align)
+		if end < pos || end > start {
+			return nil, fmt.Errorf("%w: bad framing in array of %s", ErrInvalidObject, elem)
+		}
+		out = append(out, data[pos:end])
+		pos = end
+	}
+	return out, nil
+}
+
+// parseString 解析以 NUL 结尾的字符串
+func parseString(data []byte) (string, error) {
+	if len(data) == 0 || data[len(data)-1] != 0 {
+		return "", fmt.Errorf("%w: unterminated string", ErrInvalidObject)
+	}
+	return string(data[:len(data)-1]), nil
+}
+
+// encodeTuple 序列化元组，members 为各成员已序列化的数据
+func encodeTuple(sig string, members ...[]byte) []byte {
+	types := memberTypes(sig)
+	var buf []byte
+	var offsets []int
+	for i, m := range members {
+		t, _ := parseType(types[i])
+		buf = pad(buf, t.align)
+		buf = append(buf, m...)
+		if t.size == 0 && i < len(members)-1 {
+			offsets = append(offsets, len(buf))
+		}
+	}
+	if t, _ := parseType(sig); t.size > 0 {
+		return pad(buf, t.size)
+	}
+	for i, j := 0, len(offsets)-1; i < j; i, j = i+1, j-1 {
+		offsets[i], offsets[j] = offsets[j], offsets[i]
+	}
+	return appendOffsets(buf, offsets)
+}
+
+// encodeArray 序列化元素类型为 elem 的数组
+func encodeArray(elem string, elems [][]byte) []byte {
+	t, _ := parseType(elem)
+	var buf []byte
+	var offsets []int
+	for _, e := range elems {
+		buf = pad(buf, t.align)
+		buf = append(buf, e...)
+		if t.size == 0 {
+			offsets = append(offsets, len(buf))
+		}
+	}
+	return appendOffsets(buf, offsets)
+}
+
+// encodeString 序列化字符串
+func encodeString(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+// beUint32 以大端序存放的 u 字段
+func beUint32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+// beUint64 以大端序存放的 t 字段
+func beUint64(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
+
+// pad 补零到 align 的整数倍
+func pad(buf []byte, align int) []byte {
+	for len(buf)%align != 0 {
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+// appendOffsets 追加 framing offset，宽度取能容纳整个容器大小的最小值
+func appendOffsets(buf []byte, offsets []int) []byte {
+	if len(offsets) == 0 {
+		return buf
+	}
+	w := 1
+	for w < 8 && offsetSize(len(buf)+len(offsets)*w) > w {
+		w *= 2
+	}
+	for _, off := range offsets {
+		for i := 0; i < w; i++ {
+			buf = append(buf, byte(off>>(8*i)))
+		}
+	}
+	return buf
+}
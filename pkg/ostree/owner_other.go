@@ -0,0 +1,10 @@
+//go:build !unix
+
+package ostree
+
+import "io/fs"
+
+// fileOwner 无法读取所有者的平台上按 root 所有处理
+func fileOwner(info fs.FileInfo, mode uint32) (uid, gid, stMode uint32) {
+	return 0, 0, mode
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package ostree
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileOwner 返回 bare 模式对象文件的所有者与完整的 st_mode
+func fileOwner(info fs.FileInfo, mode uint32) (uid, gid, stMode uint32) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Uid, st.Gid, uint32(st.Mode)
+	}
+	return 0, 0, mode
+}
@@ -0,0 +1,635 @@
+// Package ostree 读取 OSTree 仓库并生成静态增量（static delta），
+// 供已基于 OSTree 的嵌入式 Linux OTA 系统直接拉取
+package ostree
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"bindiff/pkg/utils"
+)
+
+// ObjectType OSTree 对象类型（与 libostree 的 OstreeObjectType 取值相同）
+type ObjectType uint8
+
+// 对象类型
+const (
+	ObjectFile    ObjectType = 1
+	ObjectDirTree ObjectType = 2
+	ObjectDirMeta ObjectType = 3
+	ObjectCommit  ObjectType = 4
+)
+
+// String 返回对象文件的扩展名
+func (t ObjectType) String() string {
+	switch t {
+	case ObjectFile:
+		return "file"
+	case ObjectDirTree:
+		return "dirtree"
+	case ObjectDirMeta:
+		return "dirmeta"
+	case ObjectCommit:
+		return "commit"
+	default:
+		return fmt.Sprintf("objtype(%d)", uint8(t))
+	}
+}
+
+// 仓库模式
+const (
+	ModeArchive      = "archive"
+	ModeBare         = "bare"
+	ModeBareUserOnly = "bare-user-only"
+)
+
+// 文件类型位（stat.h），OSTree 在对象中记录完整的 st_mode
+const (
+	modeTypeMask = 0170000
+	modeDir      = 0040000
+	modeRegular  = 0100000
+	modeSymlink  = 0120000
+)
+
+// GVariant 类型
+const (
+	commitType     = "(a{sv}aya(say)sstayay)"
+	dirTreeType    = "(a(say)a(sayay))"
+	dirMetaType    = "(uuua(ayay))"
+	fileHeaderType = "(uuuusa(ayay))"
+	// archive 模式的 .filez 头部，比 fileHeaderType 多一个内容长度字段
+	archiveHeaderType = "(tuuuusa(ayay))"
+)
+
+// 错误定义
+var (
+	// ErrInvalidRepo 目录不是可读取的 OSTree 仓库
+	ErrInvalidRepo = errors.New("invalid OSTree repository")
+	// ErrInvalidObject 对象内容不符合 OSTree 格式或与校验和不一致
+	ErrInvalidObject = errors.New("invalid OSTree object")
+)
+
+// Repo 一个本地 OSTree 仓库
+type Repo struct {
+	Path string
+	Mode string
+}
+
+// Content 文件对象：所有者、完整的 st_mode 与内容，符号链接的内容为链接目标
+type Content struct {
+	UID, GID, Mode uint32
+	Data           []byte
+}
+
+// IsSymlink 判断是否为符号链接
+func (c *Content) IsSymlink() bool {
+	return c.Mode&modeTypeMask == modeSymlink
+}
+
+// Open 打开仓库并读取 config 中的模式，支持 archive（archive-z2）、bare 与 bare-user-only
+func Open(dir string) (*Repo, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "config"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRepo, err)
+	}
+	mode, section := "", ""
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "[") {
+			section = strings.Trim(line, "[]")
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok && section == "core" && strings.TrimSpace(key) == "mode" {
+			mode = strings.TrimSpace(value)
+		}
+	}
+	switch mode {
+	case "", ModeBare:
+		mode = ModeBare
+	case ModeArchive, "archive-z2":
+		mode = ModeArchive
+	case ModeBareUserOnly:
+	default:
+		return nil, fmt.Errorf("%w: unsupported repository mode %q", ErrInvalidRepo, mode)
+	}
+	return &Repo{Path: dir, Mode: mode}, nil
+}
+
+// Init 创建 archive 模式的空仓库
+func Init(dir string) (*Repo, error) {
+	for _, d := range []string{"objects", "refs/heads", "refs/remotes", "refs/mirrors", "tmp", "state", "extensions"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			return nil, err
+		}
+	}
+	config := "[core]\nrepo_version=1\nmode=archive-z2\n"
+	if err := os.WriteFile(filepath.Join(dir, "config"), []byte(config), 0644); err != nil {
+		return nil, err
+	}
+	return &Repo{Path: dir, Mode: ModeArchive}, nil
+}
+
+// Resolve 把引用名（refs/heads 或 refs/remotes 下的分支）或 64 位十六进制校验和解析为提交校验和
+func (r *Repo) Resolve(rev string) (string, error) {
+	if isChecksum(rev) {
+		if _, err := os.Stat(r.objectPath(rev, ObjectCommit)); err != nil {
+			return "", fmt.Errorf("commit %s not found: %w", rev, err)
+		}
+		return rev, nil
+	}
+	for _, dir := range []string{"refs/heads", "refs/remotes"} {
+		data, err := os.ReadFile(filepath.Join(r.Path, dir, filepath.FromSlash(rev)))
+		if err == nil {
+			if checksum := strings.TrimSpace(string(data)); isChecksum(checksum) {
+				return checksum, nil
+			}
+			return "", fmt.Errorf("%w: ref %s does not hold a checksum", ErrInvalidRepo, rev)
+		}
+	}
+	return "", fmt.Errorf("ref %s not found in %s", rev, r.Path)
+}
+
+// isChecksum 判断是否为小写十六进制的 SHA-256
+func isChecksum(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil && strings.ToLower(s) == s
+}
+
+// objectPath 返回对象文件路径
+func (r *Repo) objectPath(checksum string, t ObjectType) string {
+	ext := t.String()
+	if t == ObjectFile && r.Mode == ModeArchive {
+		ext = "filez"
+	}
+	return filepath.Join(r.Path, "objects", checksum[:2], checksum[2:]+"."+ext)
+}
+
+// ReadMetadata 读取元数据对象（提交、目录树、目录元数据）并校验校验和
+func (r *Repo) ReadMetadata(checksum string, t ObjectType) ([]byte, error) {
+	data, err := os.ReadFile(r.objectPath(checksum, t))
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != checksum {
+		return nil, fmt.Errorf("%w: %s.%s checksum mismatch", ErrInvalidObject, checksum, t)
+	}
+	return data, nil
+}
+
+// ReadContent 读取文件对象。bare 模式从文件系统读取所有者与权限；不读取扩展属性
+func (r *Repo) ReadContent(checksum string) (*Content, error) {
+	p := r.objectPath(checksum, ObjectFile)
+	if r.Mode == ModeArchive {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		return parseArchiveContent(data)
+	}
+
+	info, err := os.Lstat(p)
+	if err != nil {
+		return nil, err
+	}
+	c := &Content{Mode: modeRegular | uint32(info.Mode().Perm())}
+	if r.Mode == ModeBare {
+		c.UID, c.GID, c.Mode = fileOwner(info, c.Mode)
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(p)
+		if err != nil {
+			return nil, err
+		}
+		c.Mode = modeSymlink | 0777
+		c.Data = []byte(target)
+		return c, nil
+	}
+	if c.Data, err = os.ReadFile(p); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseArchiveContent 解析 .filez：带长度前缀的头部与 raw deflate 压缩的内容
+func parseArchiveContent(data []byte) (*Content, error) {
+	header, body, err := readSizedVariant(data)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := splitTuple(header, archiveHeaderType)
+	if err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint64(fields[0])
+	c := &Content{
+		UID:  binary.BigEndian.Uint32(fields[1]),
+		GID:  binary.BigEndian.Uint32(fields[2]),
+		Mode: binary.BigEndian.Uint32(fields[3]),
+	}
+	if c.IsSymlink() {
+		target, err := parseString(fields[5])
+		if err != nil {
+			return nil, err
+		}
+		c.Data = []byte(target)
+		return c, nil
+	}
+	zr := flate.NewReader(bytes.NewReader(body))
+	defer zr.Close()
+	if c.Data, err = io.ReadAll(io.LimitReader(zr, int64(size)+1)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidObject, err)
+	}
+	if uint64(len(c.Data)) != size {
+		return nil, fmt.Errorf("%w: content is %d bytes, header says %d", ErrInvalidObject, len(c.Data), size)
+	}
+	return c, nil
+}
+
+// readSizedVariant 读取 4 字节大端长度、4 字节填充后的 GVariant，返回该值与其后的数据
+func readSizedVariant(data []byte) ([]byte, []byte, error) {
+	if len(data) < 8 {
+		return nil, nil, fmt.Errorf("%w: truncated header", ErrInvalidObject)
+	}
+	n := binary.BigEndian.Uint32(data)
+	if uint64(n) > uint64(len(data)-8) {
+		return nil, nil, fmt.Errorf("%w: header size %d exceeds object", ErrInvalidObject, n)
+	}
+	return data[8 : 8+n], data[8+n:], nil
+}
+
+// sizedVariant 以 4 字节大端长度与 4 字节填充为前缀
+func sizedVariant(v []byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, uint32(len(v)))
+	return append(append(out, 0, 0, 0, 0), v...)
+}
+
+// ContentChecksum 计算文件对象的校验和：带长度前缀的文件头与内容的 SHA-256
+func ContentChecksum(c *Content) string {
+	h := sha256.New()
+	h.Write(sizedVariant(fileHeader(c)))
+	if !c.IsSymlink() {
+		h.Write(c.Data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fileHeader 序列化校验和使用的文件头（不含扩展属性）
+func fileHeader(c *Content) []byte {
+	var target string
+	if c.IsSymlink() {
+		target = string(c.Data)
+	}
+	return encodeTuple(fileHeaderType, beUint32(c.UID), beUint32(c.GID), beUint32(c.Mode), beUint32(0),
+		encodeString(target), nil)
+}
+
+// Commit 提交对象中静态增量需要的字段
+type Commit struct {
+	Parent    string
+	Subject   string
+	Timestamp time.Time
+	RootTree  string
+	RootMeta  string
+}
+
+// ParseCommit 解析提交对象
+func ParseCommit(data []byte) (*Commit, error) {
+	fields, err := splitTuple(data, commitType)
+	if err != nil {
+		return nil, err
+	}
+	subject, err := parseString(fields[3])
+	if err != nil {
+		return nil, err
+	}
+	if len(fields[6]) != sha256.Size || len(fields[7]) != sha256.Size {
+		return nil, fmt.Errorf("%w: commit has malformed root checksums", ErrInvalidObject)
+	}
+	c := &Commit{
+		Subject:   subject,
+		Timestamp: time.Unix(int64(binary.BigEndian.Uint64(fields[5])), 0).UTC(),
+		RootTree:  hex.EncodeToString(fields[6]),
+		RootMeta:  hex.EncodeToString(fields[7]),
+	}
+	if len(fields[1]) == sha256.Size {
+		c.Parent = hex.EncodeToString(fields[1])
+	}
+	return c, nil
+}
+
+// Object 对象类型与校验和
+type Object struct {
+	Type     ObjectType
+	Checksum string
+}
+
+// tree 一个提交可达的全部对象（不含提交本身）以及按路径索引的文件对象
+type tree struct {
+	objects []Object
+	files   map[string]string
+}
+
+// walk 遍历提交可达的目录树，对象按首次出现的顺序排列且不重复
+func (r *Repo) walk(commit string) (*Commit, *tree, error) {
+	data, err := r.ReadMetadata(commit, ObjectCommit)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := ParseCommit(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t := &tree{files: make(map[string]string)}
+	seen := make(map[Object]bool)
+	add := func(o Object) bool {
+		if seen[o] {
+			return false
+		}
+		seen[o] = true
+		t.objects = append(t.objects, o)
+		return true
+	}
+	var visit func(dir, treeSum, metaSum string) error
+	visit = func(dir, treeSum, metaSum string) error {
+		add(Object{ObjectDirMeta, metaSum})
+		if !add(Object{ObjectDirTree, treeSum}) {
+			// 相同的目录树已遍历过，只需补充路径索引
+			return r.indexTree(t, dir, treeSum)
+		}
+		files, dirs, err := r.readDirTree(treeSum)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			t.files[path.Join(dir, f.name)] = f.checksum
+			add(Object{ObjectFile, f.checksum})
+		}
+		for _, d := range dirs {
+			if err := visit(path.Join(dir, d.name), d.checksum, d.meta); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := visit("/", c.RootTree, c.RootMeta); err != nil {
+		return nil, nil, err
+	}
+	return c, t, nil
+}
+
+// indexTree 只记录目录树中文件的路径
+func (r *Repo) indexTree(t *tree, dir, treeSum string) error {
+	files, dirs, err := r.readDirTree(treeSum)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		t.files[path.Join(dir, f.name)] = f.checksum
+	}
+	for _, d := range dirs {
+		if err := r.indexTree(t, path.Join(dir, d.name), d.checksum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// treeEntry 目录树条目，目录条目的 meta 为目录元数据的校验和
+type treeEntry struct {
+	name     string
+	checksum string
+	meta     string
+}
+
+// readDirTree 读取并解析目录树对象
+func (r *Repo) readDirTree(checksum string) (files, dirs []treeEntry, err error) {
+	data, err := r.ReadMetadata(checksum, ObjectDirTree)
+	if err != nil {
+		return nil, nil, err
+	}
+	fields, err := splitTuple(data, dirTreeType)
+	if err != nil {
+		return nil, nil, err
+	}
+	fileEntries, err := splitArray(fields[0], "(say)")
+	if err != nil {
+		return nil, nil, err
+	}
+	dirEntries, err := splitArray(fields[1], "(sayay)")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range fileEntries {
+		entry, err := parseTreeEntry(e, "(say)")
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, entry)
+	}
+	for _, e := range dirEntries {
+		entry, err := parseTreeEntry(e, "(sayay)")
+		if err != nil {
+			return nil, nil, err
+		}
+		dirs = append(dirs, entry)
+	}
+	return files, dirs, nil
+}
+
+// parseTreeEntry 解析目录树条目，名称不能包含路径分隔符
+func parseTreeEntry(data []byte, sig string) (treeEntry, error) {
+	fields, err := splitTuple(data, sig)
+	if err != nil {
+		return treeEntry{}, err
+	}
+	name, err := parseString(fields[0])
+	if err != nil {
+		return treeEntry{}, err
+	}
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return treeEntry{}, fmt.Errorf("%w: bad tree entry name %q", ErrInvalidObject, name)
+	}
+	entry := treeEntry{name: name}
+	for i, sum := range fields[1:] {
+		if len(sum) != sha256.Size {
+			return treeEntry{}, fmt.Errorf("%w: bad checksum for %q", ErrInvalidObject, name)
+		}
+		if i == 0 {
+			entry.checksum = hex.EncodeToString(sum)
+		} else {
+			entry.meta = hex.EncodeToString(sum)
+		}
+	}
+	return entry, nil
+}
+
+// CommitDir 把目录 dir 提交到 archive 模式仓库的分支 branch（所有者记为 0），返回提交校验和。
+// 分支已存在时以其当前提交为父提交
+func (r *Repo) CommitDir(dir, branch, subject string, timestamp time.Time) (string, error) {
+	if r.Mode != ModeArchive {
+		return "", fmt.Errorf("%w: commits can only be written to archive repositories", ErrInvalidRepo)
+	}
+	treeSum, metaSum, err := r.writeDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var parent []byte
+	if prev, err := r.Resolve(branch); err == nil {
+		parent, _ = hex.DecodeString(prev)
+	}
+	treeRaw, _ := hex.DecodeString(treeSum)
+	metaRaw, _ := hex.DecodeString(metaSum)
+	commit := encodeTuple(commitType, nil, parent, nil, encodeString(subject), encodeString(""),
+		beUint64(uint64(timestamp.Unix())), treeRaw, metaRaw)
+	checksum, err := r.writeMetadata(ObjectCommit, commit)
+	if err != nil {
+		return "", err
+	}
+	if err := r.SetRef(branch, checksum); err != nil {
+		return "", err
+	}
+	return checksum, nil
+}
+
+// SetRef 把分支 branch（refs/heads 下）指向提交 checksum
+func (r *Repo) SetRef(branch, checksum string) error {
+	if !isChecksum(checksum) {
+		return fmt.Errorf("invalid checksum %q", checksum)
+	}
+	if branch == "" || strings.Contains("/"+branch+"/", "/../") {
+		return fmt.Errorf("invalid ref name %q", branch)
+	}
+	return utils.SafeWrite(filepath.Join(r.Path, "refs", "heads", filepath.FromSlash(branch)), []byte(checksum+"\n"))
+}
+
+// writeDir 递归写入目录的文件、目录树与目录元数据对象
+func (r *Repo) writeDir(dir string) (treeSum, metaSum string, err error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", "", err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", err
+	}
+	// 目录树中的文件与子目录分别按名称字节序排列
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var files, dirs [][]byte
+	for _, e := range entries {
+		p := filepath.Join(dir, e.Name())
+		if e.IsDir() {
+			sub, subMeta, err := r.writeDir(p)
+			if err != nil {
+				return "", "", err
+			}
+			subRaw, _ := hex.DecodeString(sub)
+			subMetaRaw, _ := hex.DecodeString(subMeta)
+			dirs = append(dirs, encodeTuple("(sayay)", encodeString(e.Name()), subRaw, subMetaRaw))
+			continue
+		}
+		c, err := readLocalFile(p)
+		if err != nil {
+			return "", "", err
+		}
+		if c == nil {
+			continue
+		}
+		sum, err := r.writeContent(c)
+		if err != nil {
+			return "", "", err
+		}
+		raw, _ := hex.DecodeString(sum)
+		files = append(files, encodeTuple("(say)", encodeString(e.Name()), raw))
+	}
+
+	dirMeta := encodeTuple(dirMetaType, beUint32(0), beUint32(0), beUint32(modeDir|uint32(info.Mode().Perm())), nil)
+	if metaSum, err = r.writeMetadata(ObjectDirMeta, dirMeta); err != nil {
+		return "", "", err
+	}
+	dirTree := encodeTuple(dirTreeType, encodeArray("(say)", files), encodeArray("(sayay)", dirs))
+	if treeSum, err = r.writeMetadata(ObjectDirTree, dirTree); err != nil {
+		return "", "", err
+	}
+	return treeSum, metaSum, nil
+}
+
+// readLocalFile 读取普通文件或符号链接，其他类型返回 nil
+func readLocalFile(p string) (*Content, error) {
+	info, err := os.Lstat(p)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case info.Mode().IsRegular():
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		return &Content{Mode: modeRegular | uint32(info.Mode().Perm()), Data: data}, nil
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(p)
+		if err != nil {
+			return nil, err
+		}
+		return &Content{Mode: modeSymlink | 0777, Data: []byte(target)}, nil
+	}
+	return nil, nil
+}
+
+// writeMetadata 写入元数据对象，返回校验和
+func (r *Repo) writeMetadata(t ObjectType, data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	return checksum, r.writeObject(checksum, t, data)
+}
+
+// writeContent 以 archive 格式写入文件对象，返回校验和
+func (r *Repo) writeContent(c *Content) (string, error) {
+	checksum := ContentChecksum(c)
+	var target string
+	var size uint64
+	if c.IsSymlink() {
+		target = string(c.Data)
+	} else {
+		size = uint64(len(c.Data))
+	}
+	header := encodeTuple(archiveHeaderType, beUint64(size), beUint32(c.UID), beUint32(c.GID), beUint32(c.Mode),
+		beUint32(0), encodeString(target), nil)
+
+	buf := bytes.NewBuffer(sizedVariant(header))
+	if !c.IsSymlink() {
+		zw, _ := flate.NewWriter(buf, flate.DefaultCompression)
+		zw.Write(c.Data)
+		zw.Close()
+	}
+	return checksum, r.writeObject(checksum, ObjectFile, buf.Bytes())
+}
+
+// writeObject 写入对象文件，已存在时跳过
+func (r *Repo) writeObject(checksum string, t ObjectType, data []byte) error {
+	p := r.objectPath(checksum, t)
+	if _, err := os.Stat(p); err == nil {
+		return nil
+	}
+	return utils.SafeWrite(p, data)
+}
@@ -0,0 +1,182 @@
+// Package p2p 在局域网内的节点之间分享 zchunk 块：已有文件的节点以 Seeder 提供块，
+// 更新的节点以 Peers 作为 zchunk.ChunkSource 先向对等节点获取块，取不到的再回退到 HTTP 块目录。
+// 块按清单的 SHA-256 校验，对等节点无需受信任
+package p2p
+
+import (
+	"bindiff/core"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChunkPath 块的请求路径前缀，后接十六进制 SHA-256
+const ChunkPath = "/p2p/v1/chunks/"
+
+// DefaultMaxUploads Seeder 默认同时提供的块数
+const DefaultMaxUploads = 16
+
+// ErrNoPeer 没有对等节点能提供该块
+var ErrNoPeer = errors.New("no peer has the chunk")
+
+// Seeder 以 HTTP 提供本地文件中的块，块以未压缩内容的 SHA-256 寻址
+type Seeder struct {
+	// MaxUploads 同时提供的块数上限，超出时返回 503 让客户端换一个节点，不大于 0 时为 DefaultMaxUploads
+	MaxUploads int
+
+	mu     sync.RWMutex
+	chunks map[string][]byte
+	once   sync.Once
+	slots  chan struct{}
+}
+
+// NewSeeder 创建空的 Seeder
+func NewSeeder() *Seeder {
+	return &Seeder{chunks: map[string][]byte{}}
+}
+
+// Add 以 opts（应与清单的分块参数一致）切分 data 并提供其中的块，返回新增的块数。
+// 块引用 data 的内存，调用方之后不能修改 data
+func (s *Seeder) Add(data []byte, opts *core.ChunkOptions) int {
+	added := 0
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range core.Chunk(data, opts) {
+		sum := sha256.Sum256(c)
+		hash := hex.EncodeToString(sum[:])
+		if _, ok := s.chunks[hash]; !ok {
+			s.chunks[hash] = c
+			added++
+		}
+	}
+	return added
+}
+
+// Len 返回提供的块数
+func (s *Seeder) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.chunks)
+}
+
+// ServeHTTP 处理 GET/HEAD ChunkPath<hash>
+func (s *Seeder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	hash, ok := strings.CutPrefix(r.URL.Path, ChunkPath)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.RLock()
+	data, ok := s.chunks[strings.ToLower(hash)]
+	s.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.once.Do(func() {
+		n := s.MaxUploads
+		if n <= 0 {
+			n = DefaultMaxUploads
+		}
+		s.slots = make(chan struct{}, n)
+	})
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	default:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "too many uploads", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+// Peers 依次向对等节点请求块，实现 zchunk.ChunkSource
+type Peers struct {
+	// Addrs 对等节点地址（host:port 或 http(s) URL）
+	Addrs []string
+	// Client 为空时使用超时 10 秒的客户端
+	Client *http.Client
+}
+
+// NewPeers 创建 Peers，addrs 中没有协议的地址视为 http
+func NewPeers(addrs []string) *Peers {
+	p := &Peers{Client: &http.Client{Timeout: 10 * time.Second}}
+	for _, a := range addrs {
+		if a = strings.TrimSpace(a); a == "" {
+			continue
+		}
+		if !strings.Contains(a, "://") {
+			a = "http://" + a
+		}
+		p.Addrs = append(p.Addrs, strings.TrimSuffix(a, "/"))
+	}
+	return p
+}
+
+// GetChunk 从对等节点获取块。起始节点按哈希选取，使各节点分担请求；
+// 节点没有该块、繁忙或出错时尝试下一个，都失败时返回 ErrNoPeer
+func (p *Peers) GetChunk(ctx context.Context, hash string, size int64) ([]byte, error) {
+	if len(p.Addrs) == 0 || len(hash) < 8 {
+		return nil, ErrNoPeer
+	}
+	start, _ := strconv.ParseUint(hash[:8], 16, 32)
+	for i := range p.Addrs {
+		addr := p.Addrs[(int(start)+i)%len(p.Addrs)]
+		data, err := p.get(ctx, addr+ChunkPath+hash, size)
+		if err == nil {
+			return data, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, ErrNoPeer
+}
+
+// get 向一个节点请求块，最多读取 size 字节
+func (p *Peers) get(ctx context.Context, url string, size int64) ([]byte, error) {
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, size+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != size {
+		return nil, fmt.Errorf("GET %s: got %d bytes, expected %d", url, len(data), size)
+	}
+	return data, nil
+}
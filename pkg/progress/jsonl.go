@@ -0,0 +1,81 @@
+package progress
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// DefaultJSONInterval JSONL 进度记录的默认最小间隔
+const DefaultJSONInterval = 500 * time.Millisecond
+
+// Record 一条 JSONL 进度记录
+type Record struct {
+	Stage   string  `json:"stage"`
+	Current int64   `json:"current"`
+	Total   int64   `json:"total"`
+	Percent float64 `json:"percent"`
+	// BytesPerSecond 本阶段开始以来的平均速度
+	BytesPerSecond float64 `json:"bytes_per_second"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	// ETASeconds 按平均速度估计的剩余时间，速度未知时省略
+	ETASeconds *float64 `json:"eta_seconds,omitempty"`
+	// Done 本阶段已完成
+	Done bool `json:"done,omitempty"`
+}
+
+// JSONL 以每行一个 JSON 对象输出进度，供 GUI 等包装程序解析。
+// 每个阶段的开始与完成各输出一条，其间至多每 Interval 输出一条；实现 core.ProgressReporter
+type JSONL struct {
+	// Interval 两条记录的最小间隔，0 使用 DefaultJSONInterval
+	Interval time.Duration
+
+	mu    sync.Mutex
+	enc   *json.Encoder
+	stage string
+	start time.Time
+	last  time.Time
+	now   func() time.Time
+}
+
+// NewJSONL 创建写到 w 的 JSONL 进度报告器
+func NewJSONL(w io.Writer) *JSONL {
+	return &JSONL{enc: json.NewEncoder(w), now: time.Now}
+}
+
+// Report 报告阶段进度
+func (j *JSONL) Report(stage string, current, total int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := j.now()
+	interval := j.Interval
+	if interval <= 0 {
+		interval = DefaultJSONInterval
+	}
+	done := current >= total
+	if stage != j.stage {
+		j.stage, j.start = stage, now
+	} else if !done && now.Sub(j.last) < interval {
+		return
+	}
+	j.last = now
+
+	r := Record{Stage: stage, Current: current, Total: total, Done: done}
+	if total > 0 {
+		r.Percent = float64(current) * 100 / float64(total)
+	}
+	elapsed := now.Sub(j.start).Seconds()
+	r.ElapsedSeconds = elapsed
+	if elapsed > 0 && current > 0 {
+		r.BytesPerSecond = float64(current) / elapsed
+		eta := float64(total-current) / r.BytesPerSecond
+		r.ETASeconds = &eta
+	}
+	j.enc.Encode(r)
+	if done {
+		// 同名阶段可能再次开始
+		j.stage = ""
+	}
+}
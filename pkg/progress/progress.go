@@ -0,0 +1,153 @@
+package progress
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+	"golang.org/x/term"
+)
+
+// 本包不依赖 pkg/utils：utils 中保留了转发到这里的 ProgressBar
+
+// 进度输出格式
+const (
+	// FormatBar 标准错误上的进度条，标准错误不是终端时不显示
+	FormatBar = "bar"
+	// FormatJSONL 在标准错误上定期输出 JSON 进度记录（见 Record）
+	FormatJSONL = "jsonl"
+	// FormatNone 不输出进度
+	FormatNone = "none"
+)
+
+// Formats 支持的进度输出格式
+var Formats = []string{FormatBar, FormatJSONL, FormatNone}
+
+// Reporter 进度报告接口，与 core.ProgressReporter 相同
+type Reporter interface {
+	Report(stage string, current, total int64)
+}
+
+// format Default 使用的格式
+var format = struct {
+	sync.Mutex
+	name string
+}{name: FormatBar}
+
+// SetFormat 设置 Default 使用的进度格式，命令行程序启动时按 --progress-format 调用
+func SetFormat(name string) error {
+	switch name {
+	case FormatBar, FormatJSONL, FormatNone:
+	default:
+		return fmt.Errorf("invalid progress format %q (bar, jsonl, none)", name)
+	}
+	format.Lock()
+	format.name = name
+	format.Unlock()
+	return nil
+}
+
+// Default 按 SetFormat 设置的格式返回写到标准错误的进度报告器，不输出进度时返回 nil
+func Default() Reporter {
+	format.Lock()
+	name := format.name
+	format.Unlock()
+
+	switch {
+	case name == FormatJSONL:
+		return NewJSONL(os.Stderr)
+	case name == FormatBar && term.IsTerminal(int(os.Stderr.Fd())):
+		return NewTerminal()
+	default:
+		return nil
+	}
+}
+
+// ProgressBar 进度条管理器
+type ProgressBar struct {
+	bar     *progressbar.ProgressBar
+	enabled bool
+}
+
+// NewProgressBar 创建进度条
+func NewProgressBar(max int64, description string, enabled bool) *ProgressBar {
+	if !enabled {
+		return &ProgressBar{enabled: false}
+	}
+
+	bar := progressbar.NewOptions64(max,
+		progressbar.OptionSetDescription(description),
+		progressbar.OptionSetWriter(os.Stderr),
+		progressbar.OptionShowBytes(true),
+		progressbar.OptionSetWidth(10),
+		progressbar.OptionThrottle(65*time.Millisecond),
+		progressbar.OptionShowCount(),
+		progressbar.OptionOnCompletion(func() {
+			fmt.Fprint(os.Stderr, "\n")
+		}),
+		progressbar.OptionSpinnerType(14),
+		progressbar.OptionFullWidth(),
+		progressbar.OptionSetRenderBlankState(true),
+	)
+
+	return &ProgressBar{
+		bar:     bar,
+		enabled: true,
+	}
+}
+
+// Add 更新进度
+func (p *ProgressBar) Add(num int) {
+	if p.enabled && p.bar != nil {
+		p.bar.Add(num)
+	}
+}
+
+// Set 设置进度
+func (p *ProgressBar) Set(num int) {
+	if p.enabled && p.bar != nil {
+		p.bar.Set(num)
+	}
+}
+
+// Finish 完成进度条
+func (p *ProgressBar) Finish() {
+	if p.enabled && p.bar != nil {
+		p.bar.Finish()
+	}
+}
+
+// Terminal 终端进度报告器，为每个阶段创建一个进度条
+// 实现 core.ProgressReporter
+type Terminal struct {
+	mu    sync.Mutex
+	stage string
+	bar   *ProgressBar
+}
+
+// NewTerminal 创建终端进度报告器
+func NewTerminal() *Terminal {
+	return &Terminal{}
+}
+
+// Report 报告阶段进度，阶段变化时切换进度条
+func (t *Terminal) Report(stage string, current, total int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.bar == nil || t.stage != stage {
+		if t.bar != nil {
+			t.bar.Finish()
+		}
+		t.stage = stage
+		t.bar = NewProgressBar(total, stage, true)
+	}
+
+	t.bar.Set(int(current))
+	if current >= total {
+		t.bar.Finish()
+		t.bar = nil
+	}
+}
@@ -0,0 +1,173 @@
+package rdiff
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// 增量命令的操作码（librsync prototab.h）
+const (
+	opEnd       = 0x00
+	opLiteral1  = 0x01 // 0x01-0x40：长度即操作码的字面量
+	opLiteralN1 = 0x41 // 0x41-0x44：长度参数为 1/2/4/8 字节的字面量
+	opCopyN1N1  = 0x45 // 0x45-0x54：偏移与长度参数各为 1/2/4/8 字节的复制
+	opReserved  = 0x55
+)
+
+// WriteDelta 以签名为基准计算新文件的增量并写出 librsync 增量文件，连续命中的块合并为一个复制命令
+func WriteDelta(sig *Signature, newData []byte, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	e := &deltaEncoder{w: bw}
+	binary.Write(bw, binary.BigEndian, uint32(DeltaMagic))
+
+	literal := 0
+	sig.Search(newData, func(block, offset, length int) {
+		e.literal(newData[literal:offset])
+		e.copy(int64(block)*int64(sig.BlockLen), int64(length))
+		literal = offset + length
+	})
+	e.literal(newData[literal:])
+	e.flushCopy()
+	bw.WriteByte(opEnd)
+	return bw.Flush()
+}
+
+// Search 在 data 中查找内容与签名中某一块相同的区域，按偏移顺序对每个不重叠的命中调用 fn。
+// 弱校验在 data 上逐字节滚动，命中后以强校验确认；内容相同的多个块只报告序号最小的一个
+func (s *Signature) Search(data []byte, fn func(block, offset, length int)) {
+	bl := s.BlockLen
+	index := make(map[uint32][]int, len(s.Blocks))
+	for i, b := range s.Blocks {
+		index[b.Weak] = append(index[b.Weak], i)
+	}
+	// match 返回与 window 内容相同的块，没有时返回 -1
+	match := func(window []byte, candidates []int) int {
+		var strong []byte
+		for _, i := range candidates {
+			if strong == nil {
+				strong = s.Magic.strongSum(window, s.StrongLen)
+			}
+			if bytes.Equal(strong, s.Blocks[i].Strong) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	weak := s.Magic.weakSum()
+	pos, end := 0, 0
+	if len(data) >= bl {
+		weak.reset(data[:bl])
+	}
+	for pos+bl <= len(data) {
+		if candidates := index[weak.digest()]; len(candidates) > 0 {
+			if i := match(data[pos:pos+bl], candidates); i >= 0 {
+				fn(i, pos, bl)
+				pos += bl
+				end = pos
+				if pos+bl <= len(data) {
+					weak.reset(data[pos : pos+bl])
+				}
+				continue
+			}
+		}
+		if pos+bl < len(data) {
+			weak.rotate(data[pos], data[pos+bl])
+		}
+		pos++
+	}
+
+	// 签名不记录基准文件长度，最后一块可能不足块长度：由短到长比较 data 末尾的每个后缀
+	if last := len(s.Blocks) - 1; last >= 0 {
+		weak.reset(nil)
+		for size := 1; size < bl && end+size <= len(data); size++ {
+			tail := data[len(data)-size:]
+			weak.prepend(tail[0])
+			if weak.digest() == s.Blocks[last].Weak && match(tail, []int{last}) == last {
+				fn(last, len(data)-size, size)
+				break
+			}
+		}
+	}
+}
+
+// deltaEncoder 写出增量命令，相邻的复制合并后再写出
+type deltaEncoder struct {
+	w                   *bufio.Writer
+	copyOffset, copyLen int64
+}
+
+// literal 写出字面量命令
+func (e *deltaEncoder) literal(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	e.flushCopy()
+	if len(data) <= 64 {
+		e.w.WriteByte(byte(opLiteral1 + len(data) - 1))
+	} else {
+		n := intLen(int64(len(data)))
+		e.w.WriteByte(byte(opLiteralN1 + widthIndex(n)))
+		writeInt(e.w, int64(len(data)), n)
+	}
+	e.w.Write(data)
+}
+
+// copy 记录复制命令，与上一个复制相邻时合并
+func (e *deltaEncoder) copy(offset, length int64) {
+	if e.copyLen > 0 && e.copyOffset+e.copyLen == offset {
+		e.copyLen += length
+		return
+	}
+	e.flushCopy()
+	e.copyOffset, e.copyLen = offset, length
+}
+
+// flushCopy 写出待合并的复制命令
+func (e *deltaEncoder) flushCopy() {
+	if e.copyLen == 0 {
+		return
+	}
+	on, ln := intLen(e.copyOffset), intLen(e.copyLen)
+	e.w.WriteByte(byte(opCopyN1N1 + widthIndex(on)*4 + widthIndex(ln)))
+	writeInt(e.w, e.copyOffset, on)
+	writeInt(e.w, e.copyLen, ln)
+	e.copyLen = 0
+}
+
+// intLen 返回能容纳 v 的最小参数宽度（1、2、4 或 8 字节）
+func intLen(v int64) int {
+	switch {
+	case v&^0xff == 0:
+		return 1
+	case v&^0xffff == 0:
+		return 2
+	case v&^0xffffffff == 0:
+		return 4
+	default:
+		return 8
+	}
+}
+
+// widthIndex 参数宽度在操作码表中的序号
+func widthIndex(n int) int {
+	switch n {
+	case 1:
+		return 0
+	case 2:
+		return 1
+	case 4:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// writeInt 以 n 字节大端序写出 v
+func writeInt(w *bufio.Writer, v int64, n int) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(v))
+	w.Write(buf[8-n:])
+}
@@ -0,0 +1,70 @@
+package rdiff
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Patch 将 librsync 增量文件应用到基准文件，新文件写入 w
+func Patch(base io.ReaderAt, delta io.Reader, w io.Writer) error {
+	br := bufio.NewReader(delta)
+	var magic uint32
+	if err := binary.Read(br, binary.BigEndian, &magic); err != nil || Magic(magic) != DeltaMagic {
+		return fmt.Errorf("%w: not a delta file", ErrFormat)
+	}
+	bw := bufio.NewWriter(w)
+	readInt := func(n int) (int64, error) {
+		var buf [8]byte
+		if _, err := io.ReadFull(br, buf[8-n:]); err != nil {
+			return 0, fmt.Errorf("%w: truncated command", ErrFormat)
+		}
+		v := binary.BigEndian.Uint64(buf[:])
+		if v > 1<<62 {
+			return 0, fmt.Errorf("%w: command parameter out of range", ErrFormat)
+		}
+		return int64(v), nil
+	}
+	widths := [4]int{1, 2, 4, 8}
+
+	for {
+		op, err := br.ReadByte()
+		if err != nil {
+			return fmt.Errorf("%w: missing end command", ErrFormat)
+		}
+		switch {
+		case op == opEnd:
+			return bw.Flush()
+		case op < opLiteralN1:
+			if _, err := io.CopyN(bw, br, int64(op)); err != nil {
+				return fmt.Errorf("%w: truncated literal", ErrFormat)
+			}
+		case op < opCopyN1N1:
+			n, err := readInt(widths[op-opLiteralN1])
+			if err != nil {
+				return err
+			}
+			if _, err := io.CopyN(bw, br, n); err != nil {
+				return fmt.Errorf("%w: truncated literal", ErrFormat)
+			}
+		case op < opReserved:
+			k := int(op - opCopyN1N1)
+			offset, err := readInt(widths[k/4])
+			if err != nil {
+				return err
+			}
+			length, err := readInt(widths[k%4])
+			if err != nil {
+				return err
+			}
+			if n, err := io.Copy(bw, io.NewSectionReader(base, offset, length)); err != nil {
+				return err
+			} else if n != length {
+				return fmt.Errorf("%w: copy of %d bytes at %d exceeds the base file", ErrFormat, length, offset)
+			}
+		default:
+			return fmt.Errorf("%w: unknown command %#x", ErrFormat, op)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package rdiff
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/md4"
+)
+
+// Magic librsync 文件头的魔数（大端序）
+type Magic uint32
+
+// librsync 定义的魔数，签名的魔数同时决定弱校验与强校验算法
+const (
+	DeltaMagic       Magic = 0x72730236 // "rs\x026" 增量文件
+	MD4SigMagic      Magic = 0x72730136 // rollsum + MD4
+	Blake2SigMagic   Magic = 0x72730137 // rollsum + BLAKE2b
+	RKMD4SigMagic    Magic = 0x72730146 // Rabin-Karp + MD4
+	RKBlake2SigMagic Magic = 0x72730147 // Rabin-Karp + BLAKE2b（librsync 2.3 默认）
+)
+
+// DefaultBlockLen 默认块长度（与 librsync 的 RS_DEFAULT_BLOCK_LEN 相同）
+const DefaultBlockLen = 2048
+
+// 强校验的最大长度与块长度上限
+const (
+	maxBlake2SumLen = 32
+	maxMD4SumLen    = 16
+	maxBlockLen     = 1 << 30
+)
+
+// ErrFormat 签名或增量文件不符合 librsync 格式
+var ErrFormat = errors.New("invalid librsync file")
+
+// strongLen 返回魔数对应强校验的最大长度，不是签名魔数时返回 0
+func (m Magic) strongLen() int {
+	switch m {
+	case MD4SigMagic, RKMD4SigMagic:
+		return maxMD4SumLen
+	case Blake2SigMagic, RKBlake2SigMagic:
+		return maxBlake2SumLen
+	}
+	return 0
+}
+
+// strongSum 计算强校验并截断为 n 字节
+func (m Magic) strongSum(block []byte, n int) []byte {
+	if m == MD4SigMagic || m == RKMD4SigMagic {
+		h := md4.New()
+		h.Write(block)
+		return h.Sum(nil)[:n]
+	}
+	// librsync 的 BLAKE2 签名以 32 字节输出的 BLAKE2b 作为强校验
+	sum := blake2b.Sum256(block)
+	return sum[:n]
+}
+
+// weakSum 返回魔数对应的弱校验（滚动校验）
+func (m Magic) weakSum() weakSum {
+	if m == RKMD4SigMagic || m == RKBlake2SigMagic {
+		return &rabinKarp{}
+	}
+	return &rollsum{}
+}
+
+// BlockSum 一个基准块的弱校验与强校验
+type BlockSum struct {
+	Weak   uint32
+	Strong []byte
+}
+
+// Signature librsync 签名：魔数、块长度、强校验长度以及每个块的校验和，最后一块可能不足块长度
+type Signature struct {
+	Magic     Magic
+	BlockLen  int
+	StrongLen int
+	Blocks    []BlockSum
+}
+
+// WriteSignature 读取基准文件并写出签名文件。blockLen 不大于 0 时使用 DefaultBlockLen，
+// strongLen 不大于 0 时使用魔数对应强校验的完整长度
+func WriteSignature(base io.Reader, w io.Writer, magic Magic, blockLen, strongLen int) error {
+	maxStrong := magic.strongLen()
+	if maxStrong == 0 {
+		return fmt.Errorf("unsupported signature magic %#x", uint32(magic))
+	}
+	if blockLen <= 0 {
+		blockLen = DefaultBlockLen
+	}
+	if strongLen <= 0 {
+		strongLen = maxStrong
+	}
+	if blockLen > maxBlockLen || strongLen > maxStrong {
+		return fmt.Errorf("invalid signature parameters: block length %d, strong sum length %d", blockLen, strongLen)
+	}
+
+	bw := bufio.NewWriter(w)
+	binary.Write(bw, binary.BigEndian, [3]uint32{uint32(magic), uint32(blockLen), uint32(strongLen)})
+	block := make([]byte, blockLen)
+	weak := magic.weakSum()
+	for {
+		n, err := io.ReadFull(base, block)
+		if n > 0 {
+			weak.reset(block[:n])
+			binary.Write(bw, binary.BigEndian, weak.digest())
+			bw.Write(magic.strongSum(block[:n], strongLen))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadSignature 读取签名文件
+func ReadSignature(r io.Reader) (*Signature, error) {
+	br := bufio.NewReader(r)
+	var hdr [3]uint32
+	if err := binary.Read(br, binary.BigEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("%w: truncated signature header", ErrFormat)
+	}
+	sig := &Signature{Magic: Magic(hdr[0]), BlockLen: int(hdr[1]), StrongLen: int(hdr[2])}
+	maxStrong := sig.Magic.strongLen()
+	if maxStrong == 0 {
+		return nil, fmt.Errorf("%w: unknown signature magic %#x", ErrFormat, hdr[0])
+	}
+	if sig.BlockLen <= 0 || sig.BlockLen > maxBlockLen || sig.StrongLen <= 0 || sig.StrongLen > maxStrong {
+		return nil, fmt.Errorf("%w: bad block length %d or strong sum length %d", ErrFormat, sig.BlockLen, sig.StrongLen)
+	}
+
+	for {
+		var weak [4]byte
+		if _, err := io.ReadFull(br, weak[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: truncated block signature", ErrFormat)
+		}
+		strong := make([]byte, sig.StrongLen)
+		if _, err := io.ReadFull(br, strong); err != nil {
+			return nil, fmt.Errorf("%w: truncated block signature", ErrFormat)
+		}
+		sig.Blocks = append(sig.Blocks, BlockSum{Weak: binary.BigEndian.Uint32(weak[:]), Strong: strong})
+	}
+	return sig, nil
+}
+
+// weakSum 可滚动的弱校验
+type weakSum interface {
+	// reset 以 block 重新计算
+	reset(block []byte)
+	// rotate 窗口前移一个字节：移出 out，移入 in
+	rotate(out, in byte)
+	// prepend 在窗口前端加入一个字节
+	prepend(in byte)
+	digest() uint32
+}
+
+// rollsumOffset librsync rollsum 对每个字节加上的偏移
+const rollsumOffset = 31
+
+// rollsum rsync 风格的 Adler 校验（librsync rollsum.h）
+type rollsum struct {
+	count  uint32
+	s1, s2 uint32
+}
+
+func (r *rollsum) reset(block []byte) {
+	r.count, r.s1, r.s2 = uint32(len(block)), 0, 0
+	for _, c := range block {
+		r.s1 += uint32(c) + rollsumOffset
+		r.s2 += r.s1
+	}
+}
+
+func (r *rollsum) rotate(out, in byte) {
+	r.s1 += uint32(in) - uint32(out)
+	r.s2 += r.s1 - r.count*(uint32(out)+rollsumOffset)
+}
+
+func (r *rollsum) prepend(in byte) {
+	r.count++
+	r.s1 += uint32(in) + rollsumOffset
+	r.s2 += r.count * (uint32(in) + rollsumOffset)
+}
+
+func (r *rollsum) digest() uint32 {
+	return r.s2<<16 | r.s1&0xffff
+}
+
+// Rabin-Karp 校验参数（librsync rabinkarp.h），rkAdjust 为 rkMult - 1
+const (
+	rkSeed   = 1
+	rkMult   = 0x08104225
+	rkAdjust = 0x08104224
+)
+
+// rabinKarp 多项式滚动哈希
+type rabinKarp struct {
+	hash uint32
+	// mult 为 rkMult 的窗口长度次幂
+	mult uint32
+}
+
+func (r *rabinKarp) reset(block []byte) {
+	r.hash, r.mult = rkSeed, 1
+	for _, c := range block {
+		r.hash = r.hash*rkMult + uint32(c)
+		r.mult *= rkMult
+	}
+}
+
+func (r *rabinKarp) rotate(out, in byte) {
+	r.hash = r.hash*rkMult + uint32(in) - r.mult*(uint32(out)+rkAdjust)
+}
+
+func (r *rabinKarp) prepend(in byte) {
+	r.hash += r.mult * (uint32(in) + rkAdjust*rkSeed)
+	r.mult *= rkMult
+}
+
+func (r *rabinKarp) digest() uint32 {
+	return r.hash
+}
+
+// WriteTo 写出签名文件
+func (s *Signature) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	binary.Write(bw, binary.BigEndian, [3]uint32{uint32(s.Magic), uint32(s.BlockLen), uint32(s.StrongLen)})
+	for _, b := range s.Blocks {
+		binary.Write(bw, binary.BigEndian, b.Weak)
+		bw.Write(b.Strong)
+	}
+	n := int64(12 + len(s.Blocks)*(4+s.StrongLen))
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
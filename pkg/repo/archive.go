@@ -0,0 +1,188 @@
+package repo
+
+import (
+	"archive/tar"
+	"bindiff/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// 归档中的条目名称
+const (
+	archiveIndex    = "index.json"
+	archiveObjects  = "objects/"
+	archiveManifest = "MANIFEST.json"
+)
+
+// archiveVersion 归档格式版本
+const archiveVersion = 1
+
+// ErrRepositoryNotEmpty 导入目标仓库已有跟踪文件
+var ErrRepositoryNotEmpty = errors.New("repository is not empty")
+
+// ErrInvalidArchive 归档不完整或内容与清单不一致
+var ErrInvalidArchive = errors.New("invalid repository archive")
+
+// manifest 归档清单，作为最后一个条目写入，缺失时说明归档被截断
+type manifest struct {
+	Version   int    `json:"version"`
+	Objects   int    `json:"objects"`
+	IndexHash string `json:"index_hash"`
+	Created   int64  `json:"created"`
+}
+
+// Export 将仓库索引与所有对象写为 tar 归档，压缩由调用方处理。
+// 写出前逐个校验对象，不会导出已损坏的数据
+func (r *Repository) Export(w io.Writer) error {
+	index, err := json.Marshal(r.index)
+	if err != nil {
+		return fmt.Errorf("failed to encode repository index: %w", err)
+	}
+	ids, err := r.store.List()
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	if err := writeTarEntry(tw, archiveIndex, index, now); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		data, err := r.store.Get(id)
+		if err != nil {
+			return err
+		}
+		if err := writeTarEntry(tw, archiveObjects+id, data, now); err != nil {
+			return err
+		}
+	}
+
+	m, err := json.Marshal(manifest{
+		Version:   archiveVersion,
+		Objects:   len(ids),
+		IndexHash: ObjectID(index),
+		Created:   now.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeTarEntry(tw, archiveManifest, m, now); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// Import 从 Export 生成的 tar 归档恢复仓库，目标仓库必须没有跟踪文件。
+// 每个对象按其 ID 校验，索引按清单中的哈希校验，且所有版本引用的对象都必须存在
+func (r *Repository) Import(rd io.Reader) error {
+	if len(r.index.Files) > 0 {
+		return ErrRepositoryNotEmpty
+	}
+
+	var (
+		index   []byte
+		m       *manifest
+		objects int
+	)
+	r.begin()
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if m != nil {
+			return fmt.Errorf("%w: unexpected entry %s after manifest", ErrInvalidArchive, hdr.Name)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+
+		switch name := path.Clean(hdr.Name); {
+		case name == archiveIndex:
+			index = data
+		case name == archiveManifest:
+			m = &manifest{}
+			if err := json.Unmarshal(data, m); err != nil {
+				return fmt.Errorf("%w: bad manifest: %v", ErrInvalidArchive, err)
+			}
+		case strings.HasPrefix(name, archiveObjects):
+			id := strings.TrimPrefix(name, archiveObjects)
+			if ObjectID(data) != id {
+				return fmt.Errorf("%w: object %s does not match its content", ErrInvalidArchive, id)
+			}
+			if _, err := r.store.Put(data); err != nil {
+				return err
+			}
+			objects++
+		default:
+			return fmt.Errorf("%w: unknown entry %s", ErrInvalidArchive, hdr.Name)
+		}
+	}
+
+	switch {
+	case m == nil:
+		return fmt.Errorf("%w: missing manifest (truncated archive?)", ErrInvalidArchive)
+	case m.Version != archiveVersion:
+		return fmt.Errorf("%w: unsupported archive version %d", ErrInvalidArchive, m.Version)
+	case index == nil || ObjectID(index) != m.IndexHash:
+		return fmt.Errorf("%w: index does not match manifest", ErrInvalidArchive)
+	case objects != m.Objects:
+		return fmt.Errorf("%w: expected %d objects, found %d", ErrInvalidArchive, m.Objects, objects)
+	}
+
+	imported := &types.RepositoryIndex{}
+	if err := json.Unmarshal(index, imported); err != nil {
+		return fmt.Errorf("%w: bad index: %v", ErrInvalidArchive, err)
+	}
+	if imported.Files == nil {
+		imported.Files = make(map[string]types.IndexEntry)
+	}
+	for name, entry := range imported.Files {
+		for _, v := range entry.Versions {
+			objects := []string{v.Object}
+			if v.Kind == types.OBJECT_CHUNKED {
+				chunks, err := r.chunkRefs(v.Object)
+				if err != nil {
+					return fmt.Errorf("%w: %s: %v", ErrInvalidArchive, name, err)
+				}
+				objects = append(objects, chunks...)
+			}
+			for _, id := range objects {
+				if !r.store.Has(id) {
+					return fmt.Errorf("%w: %s references missing object %s", ErrInvalidArchive, name, id)
+				}
+			}
+		}
+	}
+
+	r.index = imported
+	return r.Save()
+}
+
+// writeTarEntry 写入一个常规文件条目
+func writeTarEntry(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write archive entry %s: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write archive entry %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package repo
+
+import (
+	"bindiff/core"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// putChunked 按内容定义分块存储数据，返回分块清单对象的 ID
+func (r *Repository) putChunked(data []byte) (string, error) {
+	var manifest bytes.Buffer
+	for _, chunk := range core.Chunk(data, nil) {
+		id, err := r.store.Put(chunk)
+		if err != nil {
+			return "", err
+		}
+		manifest.WriteString(id)
+		manifest.WriteByte('\n')
+	}
+	return r.store.Put(manifest.Bytes())
+}
+
+// readChunked 按分块清单拼接数据
+func (r *Repository) readChunked(manifest []byte) ([]byte, error) {
+	ids, err := parseChunkManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	for _, id := range ids {
+		chunk, err := r.store.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+	return data, nil
+}
+
+// chunkRefs 返回分块清单对象引用的块 ID
+func (r *Repository) chunkRefs(object string) ([]string, error) {
+	manifest, err := r.store.Get(object)
+	if err != nil {
+		return nil, err
+	}
+	return parseChunkManifest(manifest)
+}
+
+// parseChunkManifest 解析分块清单
+func parseChunkManifest(manifest []byte) ([]string, error) {
+	ids := strings.Fields(string(manifest))
+	for _, id := range ids {
+		if len(id) != 64 {
+			return nil, fmt.Errorf("%w: malformed chunk manifest", ErrCorruptObject)
+		}
+	}
+	return ids, nil
+}
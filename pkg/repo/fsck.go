@@ -0,0 +1,196 @@
+package repo
+
+import (
+	"bindiff/types"
+	"fmt"
+)
+
+// Problem 完整性检查发现的问题
+type Problem struct {
+	Path     string // 文件路径，与具体文件无关时为空
+	Version  int    // 版本序号，与具体版本无关时为 -1
+	Object   string
+	Err      error
+	Repaired bool
+}
+
+// String 返回问题描述
+func (p Problem) String() string {
+	status := ""
+	if p.Repaired {
+		status = " (repaired)"
+	}
+	switch {
+	case p.Object == "" && p.Path == "":
+		return fmt.Sprintf("%v%s", p.Err, status)
+	case p.Object == "":
+		return fmt.Sprintf("%s: %v%s", p.Path, p.Err, status)
+	case p.Path == "":
+		return fmt.Sprintf("object %s: %v%s", p.Object, p.Err, status)
+	}
+	return fmt.Sprintf("%s@%d (object %s): %v%s", p.Path, p.Version, p.Object, p.Err, status)
+}
+
+// FsckReport 完整性检查结果
+type FsckReport struct {
+	Files    int
+	Versions int
+	Objects  int
+	Problems []Problem
+	// Unreferenced 未被任何版本引用的对象，不影响检出
+	Unreferenced []string
+}
+
+// Unrepaired 返回未修复的问题数
+func (r *FsckReport) Unrepaired() int {
+	n := 0
+	for _, p := range r.Problems {
+		if !p.Repaired {
+			n++
+		}
+	}
+	return n
+}
+
+// Fsck 检查仓库完整性：逐个版本读取对象、沿增量链重建内容并校验哈希与大小。
+// repair 为 true 时，若其他路径或版本中存在相同内容且可以完整重建，
+// 则以其内容重写损坏版本为完整快照并保存索引
+func (r *Repository) Fsck(repair bool) (*FsckReport, error) {
+	report := &FsckReport{}
+	referenced := make(map[string]bool)
+	repaired := false
+
+	for _, name := range r.Files() {
+		entry := r.index.Files[name]
+		report.Files++
+
+		// 按版本顺序检查，使基版本先于依赖它的增量被修复
+		for i, v := range entry.Versions {
+			report.Versions++
+			referenced[v.Object] = true
+			if v.Kind == types.OBJECT_CHUNKED {
+				// 清单损坏时无法得知引用的块，问题由下面的重建检查报告
+				chunks, _ := r.chunkRefs(v.Object)
+				for _, id := range chunks {
+					referenced[id] = true
+				}
+			}
+
+			err := r.verifyVersion(entry.Versions, i)
+			if err == nil {
+				continue
+			}
+
+			problem := Problem{Path: name, Version: i, Object: v.Object, Err: err}
+			if repair {
+				if data, ok := r.recoverContent(v.Hash); ok {
+					fixed, ferr := r.rewriteFull(v, data)
+					if ferr != nil {
+						return report, ferr
+					}
+					entry.Versions[i] = fixed
+					referenced[fixed.Object] = true
+					problem.Repaired = true
+					repaired = true
+				}
+			}
+			report.Problems = append(report.Problems, problem)
+		}
+
+		if n := len(entry.Versions); n > 0 && entry.Hash != entry.Versions[n-1].Hash {
+			report.Problems = append(report.Problems, Problem{
+				Path:    name,
+				Version: n - 1,
+				Object:  entry.Versions[n-1].Object,
+				Err:     fmt.Errorf("index hash %s does not match latest version", entry.Hash),
+			})
+		}
+	}
+
+	for _, name := range r.Tags() {
+		for p, hash := range r.index.Tags[name].Files {
+			if findVersion(r.index.Files[p].Versions, hash) < 0 {
+				report.Problems = append(report.Problems, Problem{
+					Path:    p,
+					Version: -1,
+					Err:     fmt.Errorf("tag %s references unknown version %s", name, hash),
+				})
+			}
+		}
+	}
+	for channel, tag := range r.index.Channels {
+		if _, ok := r.index.Tags[tag]; !ok {
+			report.Problems = append(report.Problems, Problem{
+				Version: -1,
+				Err:     fmt.Errorf("channel %s points to missing tag %s", channel, tag),
+			})
+		}
+	}
+
+	ids, err := r.store.List()
+	if err != nil {
+		return report, err
+	}
+	report.Objects = len(ids)
+	for _, id := range ids {
+		if !referenced[id] {
+			report.Unreferenced = append(report.Unreferenced, id)
+		}
+	}
+
+	if repaired {
+		if err := r.Save(); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// verifyVersion 重建第 i 个版本并校验内容
+func (r *Repository) verifyVersion(versions []types.FileVersion, i int) error {
+	data, err := r.checkout(versions, i)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != versions[i].Size {
+		return fmt.Errorf("size %d does not match recorded size %d", len(data), versions[i].Size)
+	}
+	return nil
+}
+
+// recoverContent 在整个仓库中查找可完整重建的同内容版本
+func (r *Repository) recoverContent(hash string) ([]byte, bool) {
+	for _, name := range r.Files() {
+		versions := r.index.Files[name].Versions
+		for i, v := range versions {
+			if v.Hash != hash {
+				continue
+			}
+			if data, err := r.checkout(versions, i); err == nil {
+				return data, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// rewriteFull 以完整内容重写版本，删除原有的损坏对象
+func (r *Repository) rewriteFull(v types.FileVersion, data []byte) (types.FileVersion, error) {
+	id := ObjectID(data)
+	// 同内容的完整对象也可能已损坏，Put 不会覆盖已存在的对象
+	for _, stale := range []string{v.Object, id} {
+		if _, err := r.store.Get(stale); err != nil {
+			if err := r.store.Remove(stale); err != nil {
+				return v, err
+			}
+		}
+	}
+
+	if _, err := r.store.Put(data); err != nil {
+		return v, err
+	}
+	v.Object = id
+	v.Kind = types.OBJECT_FULL
+	v.Base = ""
+	return v, nil
+}
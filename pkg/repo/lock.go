@@ -0,0 +1,72 @@
+package repo
+
+import (
+	"bindiff/pkg/utils"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// lockFile 仓库目录下的锁文件名
+const lockFile = "lock"
+
+// ErrAlreadyLocked 当前 Repository 已持有锁
+var ErrAlreadyLocked = errors.New("repository already locked")
+
+// Lock 获取仓库的排他咨询锁（阻塞等待），并重新加载索引，
+// 使读取-修改-保存在多个进程之间串行执行。修改索引或对象存储前调用，完成后 Unlock
+func (r *Repository) Lock() error {
+	return r.acquire(true)
+}
+
+// RLock 获取仓库的共享咨询锁并重新加载索引，只读操作期间阻止其他进程修改
+func (r *Repository) RLock() error {
+	return r.acquire(false)
+}
+
+// Unlock 释放仓库锁，未持有锁时不做任何操作
+func (r *Repository) Unlock() error {
+	if r.lock == nil {
+		return nil
+	}
+	f := r.lock
+	r.lock = nil
+	err := unlockFile(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unlock repository: %w", err)
+	}
+	return nil
+}
+
+// acquire 打开锁文件并加锁，成功后重新加载索引
+func (r *Repository) acquire(exclusive bool) error {
+	if r.lock != nil {
+		return ErrAlreadyLocked
+	}
+	f, err := os.OpenFile(filepath.Join(r.dir, lockFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open repository lock: %w", err)
+	}
+	if err := lockFileHandle(f, exclusive); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to lock repository: %w", err)
+	}
+	r.lock = f
+
+	// 处理中断的提交会修改对象与索引，只在持有排他锁时进行
+	if exclusive {
+		if _, err := utils.RecoverTransactions(r.dir); err != nil {
+			r.Unlock()
+			return err
+		}
+	}
+	if err := r.load(); err != nil {
+		r.Unlock()
+		return err
+	}
+	return nil
+}
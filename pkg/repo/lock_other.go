@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package repo
+
+import "os"
+
+// lockFileHandle 平台不支持文件锁，仅依赖原子写入
+func lockFileHandle(f *os.File, exclusive bool) error {
+	return nil
+}
+
+// unlockFile 平台不支持文件锁
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package repo
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFileHandle 使用 flock 加锁
+func lockFileHandle(f *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// unlockFile 释放 flock 锁
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
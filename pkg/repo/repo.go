@@ -0,0 +1,372 @@
+package repo
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/storage"
+	"bindiff/pkg/utils"
+	"bindiff/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// indexVersion 仓库索引格式版本
+const indexVersion = 1
+
+// ErrFileNotTracked 文件不在仓库中
+var ErrFileNotTracked = errors.New("file not tracked")
+
+// defaultSnapshotInterval 默认的最大增量链长度
+const defaultSnapshotInterval = 16
+
+// Options 仓库选项
+type Options struct {
+	// Diff 计算增量时使用的差分选项
+	Diff *core.DiffOptions
+	// SnapshotInterval 增量链的最大长度，达到后存储完整快照，保证检出成本有界
+	SnapshotInterval int
+	// Chunking 完整快照按内容定义分块存储，相同区域在不同文件和版本间只存一份
+	Chunking bool
+	// Storage 对象存储后端，为空时使用仓库下的 objects 目录；索引与锁始终保存在本地
+	Storage storage.Backend
+}
+
+// Repository 版本仓库：RepositoryIndex 记录路径到版本历史的映射，
+// 各版本内容以完整对象或增量对象存放在 BlobStore 中
+type Repository struct {
+	dir     string
+	store   *BlobStore
+	index   *types.RepositoryIndex
+	options Options
+	lock    *os.File           // 持有锁时的锁文件
+	txn     *utils.Transaction // 未保存的提交：本地对象存储中暂存的新对象
+}
+
+// Open 打开仓库目录，不存在时创建
+func Open(dir string, options *Options) (*Repository, error) {
+	if err := utils.EnsureDir(filepath.Join(dir, "objects")); err != nil {
+		return nil, err
+	}
+
+	r := &Repository{
+		dir: dir,
+		index: &types.RepositoryIndex{
+			Version: indexVersion,
+			Files:   make(map[string]types.IndexEntry),
+		},
+	}
+
+	if options != nil {
+		r.options = *options
+	}
+	if r.options.Storage != nil {
+		r.store = NewBackendStore(r.options.Storage)
+	} else {
+		r.store = NewBlobStore(filepath.Join(dir, "objects"))
+	}
+	if r.options.SnapshotInterval <= 0 {
+		r.options.SnapshotInterval = defaultSnapshotInterval
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load 从磁盘读取仓库索引，索引不存在时保留空索引
+func (r *Repository) load() error {
+	data, err := os.ReadFile(r.indexPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read repository index: %w", err)
+	}
+	index := &types.RepositoryIndex{}
+	if err := json.Unmarshal(data, index); err != nil {
+		return fmt.Errorf("failed to parse repository index: %w", err)
+	}
+	if index.Files == nil {
+		index.Files = make(map[string]types.IndexEntry)
+	}
+	r.index = index
+	return nil
+}
+
+// Store 返回仓库的对象存储
+func (r *Repository) Store() *BlobStore {
+	return r.store
+}
+
+// Index 返回仓库索引
+func (r *Repository) Index() *types.RepositoryIndex {
+	return r.index
+}
+
+// Save 写入仓库索引，与 Commit 暂存的新对象在同一事务中提交：
+// 要么对象与索引全部写入，要么都不写入（进程中途退出时由下次 Lock 回滚）
+func (r *Repository) Save() error {
+	data, err := json.MarshalIndent(r.index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode repository index: %w", err)
+	}
+	txn := r.begin()
+	r.txn = nil
+	r.store.stageIn(nil)
+	if err := txn.Write(r.indexPath(), data); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("failed to write repository index: %w", err)
+	}
+	return txn.Commit()
+}
+
+// begin 返回当前提交的事务，没有时开始新的事务，之后写入本地对象存储的对象暂存在其中
+func (r *Repository) begin() *utils.Transaction {
+	if r.txn == nil {
+		r.txn = utils.NewTransaction(r.dir)
+		r.store.stageIn(r.txn)
+	}
+	return r.txn
+}
+
+// Files 返回已跟踪的文件路径（已排序）
+func (r *Repository) Files() []string {
+	files := make([]string, 0, len(r.index.Files))
+	for p := range r.index.Files {
+		files = append(files, p)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// History 返回文件的版本历史，最早的版本在前
+func (r *Repository) History(name string) ([]types.FileVersion, error) {
+	entry, ok := r.index.Files[cleanPath(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotTracked, name)
+	}
+	return entry.Versions, nil
+}
+
+// Commit 记录文件的新版本，内容与最新版本相同时不产生新版本。
+// 增量小于完整内容且增量链未达到 SnapshotInterval 时以上一版本为基存储增量，
+// 否则存储完整快照
+func (r *Repository) Commit(name string, data []byte) (types.FileVersion, bool, error) {
+	name = cleanPath(name)
+	entry := r.index.Files[name]
+	hash := ObjectID(data)
+
+	if n := len(entry.Versions); n > 0 && entry.Versions[n-1].Hash == hash {
+		return entry.Versions[n-1], false, nil
+	}
+	r.begin()
+
+	version := types.FileVersion{
+		Hash:      hash,
+		Size:      int64(len(data)),
+		Timestamp: time.Now().Unix(),
+		Kind:      types.OBJECT_FULL,
+	}
+	object := data
+
+	if n := len(entry.Versions); n > 0 && ChainDepth(entry.Versions, n-1) < r.options.SnapshotInterval {
+		base := entry.Versions[n-1]
+		baseData, err := r.checkout(entry.Versions, n-1)
+		if err != nil {
+			return version, false, err
+		}
+		patches, err := core.DiffBytes(baseData, data, r.options.Diff)
+		if err != nil {
+			return version, false, err
+		}
+		if delta := core.EncodePatch(patches); len(delta) < len(data) {
+			object = delta
+			version.Kind = types.OBJECT_DELTA
+			version.Base = base.Hash
+		}
+	}
+
+	var id string
+	var err error
+	if version.Kind == types.OBJECT_FULL && r.options.Chunking {
+		version.Kind = types.OBJECT_CHUNKED
+		id, err = r.putChunked(data)
+	} else {
+		id, err = r.store.Put(object)
+	}
+	if err != nil {
+		return version, false, err
+	}
+	version.Object = id
+
+	entry.Path = name
+	entry.Size = len(data)
+	entry.Hash = hash
+	entry.Timestamp = version.Timestamp
+	entry.Versions = append(entry.Versions, version)
+	r.index.Files[name] = entry
+	return version, true, nil
+}
+
+// CommitFS 提交文件系统中的所有常规文件，返回产生新版本的文件数
+func (r *Repository) CommitFS(fsys fs.FS) (int, error) {
+	changed := 0
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", p, err)
+		}
+		_, ok, err := r.Commit(p, data)
+		if ok {
+			changed++
+		}
+		return err
+	})
+	return changed, err
+}
+
+// Checkout 读取文件的指定版本（从 0 开始），version 为负数时读取最新版本
+func (r *Repository) Checkout(name string, version int) ([]byte, error) {
+	versions, err := r.History(name)
+	if err != nil {
+		return nil, err
+	}
+	if version < 0 {
+		version = len(versions) - 1
+	}
+	if version >= len(versions) {
+		return nil, fmt.Errorf("version %d of %s does not exist", version, name)
+	}
+	return r.checkout(versions, version)
+}
+
+// ChainDepth 返回第 i 个版本所在增量链的长度，完整快照为 0
+func ChainDepth(versions []types.FileVersion, i int) int {
+	depth := 0
+	for i >= 0 && versions[i].Kind == types.OBJECT_DELTA {
+		depth++
+		i = baseIndex(versions, i)
+	}
+	return depth
+}
+
+// baseIndex 查找第 i 个增量版本的基版本序号，找不到时返回 -1
+func baseIndex(versions []types.FileVersion, i int) int {
+	for j := i - 1; j >= 0; j-- {
+		if versions[j].Hash == versions[i].Base {
+			return j
+		}
+	}
+	return -1
+}
+
+// checkout 沿增量链重建版本内容并校验哈希
+func (r *Repository) checkout(versions []types.FileVersion, i int) ([]byte, error) {
+	v := versions[i]
+	object, err := r.store.Get(v.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	data := object
+	switch v.Kind {
+	case types.OBJECT_CHUNKED:
+		if data, err = r.readChunked(object); err != nil {
+			return nil, err
+		}
+	case types.OBJECT_DELTA:
+		base := baseIndex(versions, i)
+		if base < 0 {
+			return nil, fmt.Errorf("base version %s of delta %s not found", v.Base, v.Object)
+		}
+		baseData, err := r.checkout(versions, base)
+		if err != nil {
+			return nil, err
+		}
+		patches, err := core.DecodePatch(object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode delta %s: %w", v.Object, err)
+		}
+		if data, err = core.Apply(baseData, patches, nil); err != nil {
+			return nil, fmt.Errorf("failed to apply delta %s: %w", v.Object, err)
+		}
+	}
+
+	if ObjectID(data) != v.Hash {
+		return nil, fmt.Errorf("%w: version %s reconstructs to different content", core.ErrHashMismatch, v.Hash)
+	}
+	return data, nil
+}
+
+// indexPath 返回索引文件路径
+func (r *Repository) indexPath() string {
+	return filepath.Join(r.dir, types.INDEX_FILE)
+}
+
+// cleanPath 统一为 '/' 分隔的相对路径
+func cleanPath(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
+
+// ChainStats 文件版本历史的存储统计
+type ChainStats struct {
+	Versions    int
+	Full        int
+	Delta       int
+	MaxDepth    int
+	LogicalSize int64 // 所有版本内容大小之和
+	StoredSize  int64 // 去重后对象占用的存储大小
+}
+
+// Stats 统计文件的增量链情况
+func (r *Repository) Stats(name string) (ChainStats, error) {
+	var stats ChainStats
+	versions, err := r.History(name)
+	if err != nil {
+		return stats, err
+	}
+
+	seen := make(map[string]bool)
+	for i, v := range versions {
+		stats.Versions++
+		if v.Kind == types.OBJECT_DELTA {
+			stats.Delta++
+		} else {
+			stats.Full++
+		}
+		if depth := ChainDepth(versions, i); depth > stats.MaxDepth {
+			stats.MaxDepth = depth
+		}
+		stats.LogicalSize += v.Size
+		objects := []string{v.Object}
+		if v.Kind == types.OBJECT_CHUNKED {
+			chunks, err := r.chunkRefs(v.Object)
+			if err != nil {
+				return stats, err
+			}
+			objects = append(objects, chunks...)
+		}
+		for _, id := range objects {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			size, err := r.store.Size(id)
+			if err != nil {
+				return stats, err
+			}
+			stats.StoredSize += size
+		}
+	}
+	return stats, nil
+}
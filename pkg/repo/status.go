@@ -0,0 +1,200 @@
+package repo
+
+import (
+	"bindiff/core"
+	"bindiff/types"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+// FileStatus 工作区文件相对于最新提交版本的状态
+type FileStatus struct {
+	Path string
+	// OldPath FILE_RENAMED 时已跟踪的原路径
+	OldPath string
+	// Kind FILE_ADDED 表示未跟踪的新文件，FILE_REMOVED 表示已跟踪但缺失，
+	// 缺失文件与新文件足够相似时合并为 FILE_RENAMED
+	Kind    types.FileChangeKind
+	OldSize int64
+	NewSize int64
+	// EstimatedDelta 估算的增量大小（字节），仅在 StatusOptions.Estimate 时计算
+	EstimatedDelta int64
+}
+
+// StatusOptions 状态检查选项
+type StatusOptions struct {
+	// Estimate 为修改过的文件估算增量大小，新文件按完整大小计
+	Estimate bool
+	// Ignore 返回 true 的路径（及目录下的所有文件）不参与比较
+	Ignore func(path string) bool
+}
+
+// Status 比较文件系统中的文件与各自最新提交的版本，返回有变化的文件（按路径排序）。
+// 已跟踪路径不是合法 fs.FS 路径（如位于工作区之外）时跳过
+func (r *Repository) Status(fsys fs.FS, options *StatusOptions) ([]FileStatus, error) {
+	if options == nil {
+		options = &StatusOptions{}
+	}
+	ignored := func(p string) bool {
+		return options.Ignore != nil && options.Ignore(p)
+	}
+
+	var result []FileStatus
+	seen := make(map[string]bool)
+
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != "." && ignored(p) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		seen[p] = true
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", p, err)
+		}
+
+		entry, tracked := r.index.Files[p]
+		if !tracked || len(entry.Versions) == 0 {
+			result = append(result, FileStatus{
+				Path:           p,
+				Kind:           types.FILE_ADDED,
+				NewSize:        int64(len(data)),
+				EstimatedDelta: estimateFull(options, data),
+			})
+			return nil
+		}
+
+		latest := entry.Versions[len(entry.Versions)-1]
+		if ObjectID(data) == latest.Hash {
+			return nil
+		}
+		status := FileStatus{
+			Path:    p,
+			Kind:    types.FILE_MODIFIED,
+			OldSize: latest.Size,
+			NewSize: int64(len(data)),
+		}
+		if options.Estimate {
+			old, err := r.checkout(entry.Versions, len(entry.Versions)-1)
+			if err != nil {
+				return err
+			}
+			if status.EstimatedDelta, err = core.EstimatePatchSize(old, data, r.options.Diff); err != nil {
+				return err
+			}
+		}
+		result = append(result, status)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range r.Files() {
+		if seen[name] || !fs.ValidPath(name) || ignored(name) {
+			continue
+		}
+		if _, err := fs.Stat(fsys, name); err == nil || !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		versions := r.index.Files[name].Versions
+		if len(versions) == 0 {
+			continue
+		}
+		result = append(result, FileStatus{
+			Path:    name,
+			Kind:    types.FILE_REMOVED,
+			OldSize: versions[len(versions)-1].Size,
+		})
+	}
+
+	if result, err = r.detectRenames(fsys, result, options); err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result, nil
+}
+
+// detectRenames 将相似的缺失文件与新文件合并为重命名
+func (r *Repository) detectRenames(fsys fs.FS, statuses []FileStatus, options *StatusOptions) ([]FileStatus, error) {
+	threshold, blockSize, ok := core.RenameDetection(r.options.Diff)
+	if !ok {
+		return statuses, nil
+	}
+
+	removed := make(map[string]*core.Fingerprint)
+	added := make(map[string]*core.Fingerprint)
+	for _, s := range statuses {
+		switch s.Kind {
+		case types.FILE_REMOVED:
+			versions := r.index.Files[s.Path].Versions
+			data, err := r.checkout(versions, len(versions)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed[s.Path] = core.NewFingerprint(data, blockSize)
+		case types.FILE_ADDED:
+			data, err := fs.ReadFile(fsys, s.Path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", s.Path, err)
+			}
+			added[s.Path] = core.NewFingerprint(data, blockSize)
+		}
+	}
+	if len(removed) == 0 || len(added) == 0 {
+		return statuses, nil
+	}
+
+	renames := core.MatchRenames(removed, added, threshold)
+	renamed := make(map[string]bool, len(renames))
+	for _, from := range renames {
+		renamed[from] = true
+	}
+
+	result := statuses[:0]
+	for _, s := range statuses {
+		if s.Kind == types.FILE_REMOVED && renamed[s.Path] {
+			continue
+		}
+		if from, ok := renames[s.Path]; ok && s.Kind == types.FILE_ADDED {
+			versions := r.index.Files[from].Versions
+			s.Kind = types.FILE_RENAMED
+			s.OldPath = from
+			s.OldSize = versions[len(versions)-1].Size
+			if options.Estimate {
+				old, err := r.checkout(versions, len(versions)-1)
+				if err != nil {
+					return nil, err
+				}
+				data, err := fs.ReadFile(fsys, s.Path)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read %s: %w", s.Path, err)
+				}
+				if s.EstimatedDelta, err = core.EstimatePatchSize(old, data, r.options.Diff); err != nil {
+					return nil, err
+				}
+			}
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// estimateFull 新文件没有基版本，增量即完整内容
+func estimateFull(options *StatusOptions, data []byte) int64 {
+	if !options.Estimate {
+		return 0
+	}
+	return int64(len(data))
+}
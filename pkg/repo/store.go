@@ -0,0 +1,166 @@
+package repo
+
+import (
+	"bindiff/pkg/storage"
+	"bindiff/pkg/utils"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrObjectNotFound 对象不存在
+var ErrObjectNotFound = errors.New("object not found")
+
+// ErrCorruptObject 对象内容与其 ID 不一致
+var ErrCorruptObject = errors.New("corrupt object")
+
+// BlobStore 内容寻址的对象存储，对象以其内容的 SHA256 命名，
+// 键为 <前两位>/<其余部分>，默认存放在仓库的 objects 目录
+type BlobStore struct {
+	backend storage.Backend
+	// txn 不为空时新对象暂存在事务中，由 Repository.Save 与索引一起提交
+	txn *utils.Transaction
+	// staged 已暂存对象的大小
+	staged map[string]int64
+}
+
+// NewBlobStore 创建对象存储，dir 为 objects 目录
+func NewBlobStore(dir string) *BlobStore {
+	return &BlobStore{backend: storage.NewFS(dir)}
+}
+
+// NewBackendStore 创建存放在任意存储后端（如 S3 存储桶）上的对象存储
+func NewBackendStore(backend storage.Backend) *BlobStore {
+	return &BlobStore{backend: backend}
+}
+
+// ObjectID 计算数据的对象 ID
+func ObjectID(data []byte) string {
+	return hex.EncodeToString(utils.ComputeHash(data))
+}
+
+// stageIn 让之后写入的对象暂存在 txn 中，txn 为空时结束暂存。
+// 只有本地目录后端支持暂存：远程后端上的对象直接写入，对象以内容寻址，未被索引引用时不影响仓库
+func (s *BlobStore) stageIn(txn *utils.Transaction) {
+	s.txn, s.staged = nil, nil
+	if _, ok := s.backend.(*storage.FS); ok && txn != nil {
+		s.txn, s.staged = txn, make(map[string]int64)
+	}
+}
+
+// stagedPath 返回已暂存对象的目标路径
+func (s *BlobStore) stagedPath(id string) (string, bool) {
+	if _, ok := s.staged[id]; !ok {
+		return "", false
+	}
+	p, err := s.backend.(*storage.FS).Path(objectKey(id))
+	return p, err == nil
+}
+
+// Put 写入对象并返回 ID，对象已存在时不重复写入
+func (s *BlobStore) Put(data []byte) (string, error) {
+	id := ObjectID(data)
+	if s.Has(id) {
+		return id, nil
+	}
+	if s.txn != nil {
+		p, err := s.backend.(*storage.FS).Path(objectKey(id))
+		if err == nil {
+			err = s.txn.Write(p, data)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to stage object %s: %w", id, err)
+		}
+		s.staged[id] = int64(len(data))
+		return id, nil
+	}
+	if err := s.backend.Put(context.Background(), objectKey(id), data); err != nil {
+		return "", fmt.Errorf("failed to store object %s: %w", id, err)
+	}
+	return id, nil
+}
+
+// Get 读取对象并校验内容
+func (s *BlobStore) Get(id string) ([]byte, error) {
+	var data []byte
+	var err error
+	if p, ok := s.stagedPath(id); ok {
+		data, err = s.txn.ReadFile(p)
+	} else {
+		data, err = s.backend.Get(context.Background(), objectKey(id))
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to read object %s: %w", id, err)
+	}
+	if ObjectID(data) != id {
+		return nil, fmt.Errorf("%w: %s", ErrCorruptObject, id)
+	}
+	return data, nil
+}
+
+// Has 检查对象是否存在
+func (s *BlobStore) Has(id string) bool {
+	if _, ok := s.staged[id]; ok {
+		return true
+	}
+	_, err := s.backend.Stat(context.Background(), objectKey(id))
+	return err == nil
+}
+
+// Size 返回对象占用的存储大小
+func (s *BlobStore) Size(id string) (int64, error) {
+	if size, ok := s.staged[id]; ok {
+		return size, nil
+	}
+	size, err := s.backend.Stat(context.Background(), objectKey(id))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return 0, fmt.Errorf("%w: %s", ErrObjectNotFound, id)
+		}
+		return 0, err
+	}
+	return size, nil
+}
+
+// objectKey 返回对象在后端中的键
+func objectKey(id string) string {
+	if len(id) < 3 {
+		return id
+	}
+	return id[:2] + "/" + id[2:]
+}
+
+// Remove 删除对象，对象不存在时不报错
+func (s *BlobStore) Remove(id string) error {
+	if err := s.backend.Delete(context.Background(), objectKey(id)); err != nil {
+		return fmt.Errorf("failed to remove object %s: %w", id, err)
+	}
+	return nil
+}
+
+// List 返回存储中所有对象的 ID，包括已暂存的对象
+func (s *BlobStore) List() ([]string, error) {
+	keys, err := s.backend.List(context.Background(), "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	var ids []string
+	for id := range s.staged {
+		ids = append(ids, id)
+	}
+	for _, key := range keys {
+		id := strings.ReplaceAll(key, "/", "")
+		// 跳过非对象文件
+		if _, err := hex.DecodeString(id); err == nil && len(id) == 64 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
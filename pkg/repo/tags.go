@@ -0,0 +1,184 @@
+package repo
+
+import (
+	"bindiff/core"
+	"bindiff/types"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrRefNotFound 标签或通道不存在
+var ErrRefNotFound = errors.New("ref not found")
+
+// ErrRefExists 标签或通道名称已被使用
+var ErrRefExists = errors.New("ref already exists")
+
+// Tag 为所有文件的最新版本创建标签
+func (r *Repository) Tag(name string) error {
+	if err := r.checkRefName(name); err != nil {
+		return err
+	}
+
+	tag := types.Tag{
+		Timestamp: time.Now().Unix(),
+		Files:     make(map[string]string, len(r.index.Files)),
+	}
+	for p, entry := range r.index.Files {
+		if n := len(entry.Versions); n > 0 {
+			tag.Files[p] = entry.Versions[n-1].Hash
+		}
+	}
+	if r.index.Tags == nil {
+		r.index.Tags = make(map[string]types.Tag)
+	}
+	r.index.Tags[name] = tag
+	return nil
+}
+
+// DeleteTag 删除标签，仍有通道指向该标签时返回错误
+func (r *Repository) DeleteTag(name string) error {
+	if _, ok := r.index.Tags[name]; !ok {
+		return fmt.Errorf("%w: tag %s", ErrRefNotFound, name)
+	}
+	for channel, tag := range r.index.Channels {
+		if tag == name {
+			return fmt.Errorf("tag %s is used by channel %s", name, channel)
+		}
+	}
+	delete(r.index.Tags, name)
+	return nil
+}
+
+// Tags 返回所有标签名（已排序）
+func (r *Repository) Tags() []string {
+	names := make([]string, 0, len(r.index.Tags))
+	for name := range r.index.Tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetChannel 将通道指向标签，通道不存在时创建
+func (r *Repository) SetChannel(channel, tag string) error {
+	if _, ok := r.index.Channels[channel]; !ok {
+		if err := r.checkRefName(channel); err != nil {
+			return err
+		}
+	}
+	if _, ok := r.index.Tags[tag]; !ok {
+		return fmt.Errorf("%w: tag %s", ErrRefNotFound, tag)
+	}
+	if r.index.Channels == nil {
+		r.index.Channels = make(map[string]string)
+	}
+	r.index.Channels[channel] = tag
+	return nil
+}
+
+// Channels 返回通道到标签的映射
+func (r *Repository) Channels() map[string]string {
+	channels := make(map[string]string, len(r.index.Channels))
+	for channel, tag := range r.index.Channels {
+		channels[channel] = tag
+	}
+	return channels
+}
+
+// Resolve 将标签名或通道名解析为对应的标签
+func (r *Repository) Resolve(ref string) (types.Tag, error) {
+	if tag, ok := r.index.Channels[ref]; ok {
+		ref = tag
+	}
+	tag, ok := r.index.Tags[ref]
+	if !ok {
+		return types.Tag{}, fmt.Errorf("%w: %s", ErrRefNotFound, ref)
+	}
+	return tag, nil
+}
+
+// CheckoutRef 读取文件在标签或通道中的版本
+func (r *Repository) CheckoutRef(name, ref string) ([]byte, error) {
+	versions, i, err := r.refVersion(name, ref)
+	if err != nil {
+		return nil, err
+	}
+	return r.checkout(versions, i)
+}
+
+// DeltaTo 计算从客户端已有内容（以内容哈希标识，空字符串表示没有该文件）
+// 到标签或通道中版本的补丁
+func (r *Repository) DeltaTo(name, fromHash, ref string) ([]types.Patch, error) {
+	versions, target, err := r.refVersion(name, ref)
+	if err != nil {
+		return nil, err
+	}
+	if versions[target].Hash == fromHash {
+		return nil, nil
+	}
+
+	var from []byte
+	if fromHash != "" {
+		i := findVersion(versions, fromHash)
+		if i < 0 {
+			return nil, fmt.Errorf("version %s of %s not found", fromHash, name)
+		}
+		if from, err = r.checkout(versions, i); err != nil {
+			return nil, err
+		}
+	}
+	to, err := r.checkout(versions, target)
+	if err != nil {
+		return nil, err
+	}
+	return core.DiffBytes(from, to, r.options.Diff)
+}
+
+// refVersion 查找文件在标签或通道中的版本序号
+func (r *Repository) refVersion(name, ref string) ([]types.FileVersion, int, error) {
+	tag, err := r.Resolve(ref)
+	if err != nil {
+		return nil, 0, err
+	}
+	name = cleanPath(name)
+	hash, ok := tag.Files[name]
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %s in %s", ErrFileNotTracked, name, ref)
+	}
+	versions, err := r.History(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	i := findVersion(versions, hash)
+	if i < 0 {
+		return nil, 0, fmt.Errorf("version %s of %s referenced by %s not found", hash, name, ref)
+	}
+	return versions, i, nil
+}
+
+// findVersion 返回内容哈希对应的最后一个版本序号，找不到时返回 -1
+func findVersion(versions []types.FileVersion, hash string) int {
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].Hash == hash {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkRefName 检查新标签或通道名是否合法且未被占用，标签与通道共用命名空间
+func (r *Repository) checkRefName(name string) error {
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return fmt.Errorf("invalid ref name %q", name)
+	}
+	if _, ok := r.index.Tags[name]; ok {
+		return fmt.Errorf("%w: tag %s", ErrRefExists, name)
+	}
+	if _, ok := r.index.Channels[name]; ok {
+		return fmt.Errorf("%w: channel %s", ErrRefExists, name)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package rpc
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/trace"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client 差分服务的客户端
+type Client struct {
+	// URL 服务地址，如 https://diff.example.com:9443
+	URL string
+	// HTTPClient 必须支持 HTTP/2，为空时使用 http.DefaultClient（TLS 时自动协商 HTTP/2）
+	HTTPClient *http.Client
+	// Token 非空时以 bearer token 认证
+	Token string
+}
+
+// ComputeDiff 在服务端计算 oldData 到 newData 的补丁，progress 非空时接收服务端进度
+func (c *Client) ComputeDiff(ctx context.Context, oldData, newData []byte, progress core.ProgressReporter) ([]byte, error) {
+	return c.call(ctx, MethodComputeDiff, oldData, newData, progress)
+}
+
+// ApplyPatch 在服务端将补丁应用到 oldData，返回新文件
+func (c *Client) ApplyPatch(ctx context.Context, oldData, patch []byte, progress core.ProgressReporter) ([]byte, error) {
+	return c.call(ctx, MethodApplyPatch, oldData, patch, progress)
+}
+
+// call 发起一次双向流调用：依次流式发送 first 与 second，拼接响应中的数据分块
+func (c *Client) call(ctx context.Context, method string, first, second []byte, progress core.ProgressReporter) ([]byte, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(sendChunks(pw, first, second))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.URL, "/")+method, pr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set("Grpc-Timeout", formatTimeout(time.Until(deadline)))
+	}
+	// 传播 ctx 中的追踪上下文，服务端的跨度成为调用方跨度的子跨度
+	trace.Inject(ctx, req.Header)
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected HTTP status %s", method, resp.Status)
+	}
+
+	var out bytes.Buffer
+	for {
+		frame, err := readFrame(resp.Body, maxMessageSize)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var msg responseMessage
+		if err := msg.unmarshal(frame); err != nil {
+			return nil, err
+		}
+		if msg.progress != nil && progress != nil {
+			progress.Report(msg.progress.stage, msg.progress.current, msg.progress.total)
+		}
+		out.Write(msg.chunk)
+	}
+
+	// 只有状态没有消息时服务端可能把状态放在响应头中
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return nil, fmt.Errorf("%s: missing grpc-status", method)
+	}
+	if Code(code) != OK {
+		return nil, &StatusError{Code: Code(code), Message: decodeMessage(message)}
+	}
+	return out.Bytes(), nil
+}
+
+// sendChunks 把两路数据切分为请求消息写出
+func sendChunks(w io.Writer, first, second []byte) error {
+	for len(first) > 0 || len(second) > 0 {
+		var msg chunkMessage
+		n := min(len(first), chunkSize)
+		msg.first, first = first[:n], first[n:]
+		if n < chunkSize {
+			m := min(len(second), chunkSize-n)
+			msg.second, second = second[:m], second[m:]
+		}
+		if err := writeFrame(w, msg.marshal()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
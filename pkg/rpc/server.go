@@ -0,0 +1,338 @@
+package rpc
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"bindiff/pkg/logger"
+	"bindiff/pkg/metrics"
+	"bindiff/pkg/trace"
+	"bindiff/pkg/utils"
+	"bindiff/pkg/webhook"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 服务的完整方法名
+const (
+	MethodComputeDiff = "/bindiff.v1.BinDiff/ComputeDiff"
+	MethodApplyPatch  = "/bindiff.v1.BinDiff/ApplyPatch"
+)
+
+const (
+	// DefaultMaxInputSize 单次调用默认接收的数据总量上限
+	DefaultMaxInputSize = 1 << 30
+	// maxMessageSize 单个消息的上限，与 gRPC 的默认值相同
+	maxMessageSize = 4 << 20
+	// chunkSize 服务端返回数据时每个消息携带的字节数
+	chunkSize = 64 << 10
+)
+
+// Server gRPC 差分服务，实现 http.Handler。gRPC 要求 HTTP/2，需要通过 TLS 提供服务
+type Server struct {
+	Config *config.Config
+	// Token 非空时要求请求携带 "authorization: Bearer <Token>"
+	Token string
+	// MaxInputSize 单次调用接收的数据总量上限，0 使用 DefaultMaxInputSize
+	MaxInputSize int64
+	// MaxTimeout 单次调用的最长时间，客户端通过 grpc-timeout 设置的截止时间更早时以客户端为准，0 表示不限制
+	MaxTimeout time.Duration
+	// Logger 日志输出，nil 时不输出日志
+	Logger logger.Logger
+	// Metrics 记录调用的操作指标，nil 时不记录
+	Metrics *metrics.Metrics
+	// Tracer 记录调用各阶段的跨度，请求元数据中的 traceparent 作为父跨度；nil 时不记录
+	Tracer *trace.Tracer
+	// Webhooks 发送每次调用的开始与结束事件（没有 job.queued），nil 时不发送
+	Webhooks *webhook.Notifier
+}
+
+// ServeHTTP 处理一次 gRPC 调用，状态码与错误信息在 trailer 中返回
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC over HTTP/2 required", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+
+	// 客户端在元数据 x-operation-id 中提供的操作 ID，没有时生成，在响应头中返回
+	opID := r.Header.Get(logger.OperationIDHeader)
+	if !logger.ValidOperationID(opID) {
+		opID = logger.NewOperationID()
+	}
+	w.Header().Set(logger.OperationIDHeader, opID)
+
+	start := time.Now()
+	st := s.serve(w, r, opID)
+	if st == nil {
+		st = &StatusError{Code: OK}
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(int(st.Code)))
+	if st.Message != "" {
+		w.Header().Set("Grpc-Message", encodeMessage(st.Message))
+	}
+	if log := logger.WithOperationID(s.logger(), opID); st.Code == OK {
+		log.Infof("%s from %s completed in %v", r.URL.Path, r.RemoteAddr, time.Since(start))
+	} else {
+		log.Warnf("%s from %s failed: %v", r.URL.Path, r.RemoteAddr, st)
+	}
+}
+
+func (s *Server) logger() logger.Logger {
+	if s.Logger == nil {
+		return logger.Nop()
+	}
+	return s.Logger
+}
+
+// serve 校验身份与截止时间后分派到具体方法
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, opID string) *StatusError {
+	if !utils.BearerAuthorized(r, s.Token) {
+		return statusf(Unauthenticated, "missing or invalid bearer token")
+	}
+
+	ctx := r.Context()
+	timeout := s.MaxTimeout
+	if v := r.Header.Get("Grpc-Timeout"); v != "" {
+		d, err := parseTimeout(v)
+		if err != nil {
+			return statusf(InvalidArgument, "%v", err)
+		}
+		if timeout <= 0 || d < timeout {
+			timeout = d
+		}
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	// 截止时间到达时中断正在进行的读取
+	stop := context.AfterFunc(ctx, func() { r.Body.Close() })
+	defer stop()
+
+	ctx = trace.Extract(trace.ContextWithTracer(ctx, s.Tracer), r.Header)
+	ctx, span := trace.StartKind(ctx, strings.TrimPrefix(r.URL.Path, "/"), trace.KindServer,
+		trace.String("rpc.system", "grpc"), trace.String("net.peer.addr", r.RemoteAddr),
+		trace.String("operation.id", opID))
+	defer span.End()
+
+	stream := &serverStream{w: w, opID: opID, log: logger.WithOperationID(s.Logger, opID)}
+	var err error
+	switch r.URL.Path {
+	case MethodComputeDiff:
+		err = s.computeDiff(ctx, r.Body, stream)
+	case MethodApplyPatch:
+		err = s.applyPatch(ctx, r.Body, stream)
+	default:
+		err = statusf(Unimplemented, "unknown method %s", r.URL.Path)
+	}
+	if err != nil {
+		st := toStatus(ctx, err)
+		span.SetAttributes(trace.Int64("rpc.grpc.status_code", int64(st.Code)))
+		span.RecordError(st)
+		return st
+	}
+	return nil
+}
+
+// receive 读取客户端流中的全部请求消息，按字段拼接两路数据
+func (s *Server) receive(ctx context.Context, body io.Reader) (first, second []byte, err error) {
+	_, span := trace.Start(ctx, "read")
+	defer func() {
+		span.SetAttributes(trace.Int64("bytes", int64(len(first)+len(second))))
+		span.RecordError(err)
+		span.End()
+	}()
+	limit := s.MaxInputSize
+	if limit <= 0 {
+		limit = DefaultMaxInputSize
+	}
+	for {
+		frame, err := readFrame(body, maxMessageSize)
+		if err == io.EOF {
+			return first, second, nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, nil, ctx.Err()
+			}
+			if errors.Is(err, errMalformed) {
+				return nil, nil, err
+			}
+			return nil, nil, statusf(ResourceExhausted, "%v", err)
+		}
+		var msg chunkMessage
+		if err := msg.unmarshal(frame); err != nil {
+			return nil, nil, err
+		}
+		if int64(len(first)+len(second)+len(msg.first)+len(msg.second)) > limit {
+			return nil, nil, statusf(ResourceExhausted, "input exceeds the %d byte limit", limit)
+		}
+		first = append(first, msg.first...)
+		second = append(second, msg.second...)
+	}
+}
+
+// computeDiff 接收旧文件与新文件，返回补丁文件
+func (s *Server) computeDiff(ctx context.Context, body io.Reader, stream *serverStream) error {
+	oldData, newData, err := s.receive(ctx, body)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	done := s.notify("diff", stream.opID)
+	patch, err := s.diff(ctx, oldData, newData, stream)
+	s.Metrics.Observe(metrics.OpDiff, int64(len(oldData)+len(newData)), int64(len(patch)), start, err)
+	done(int64(len(patch)), err)
+	if err != nil {
+		return err
+	}
+	return stream.sendData(ctx, patch)
+}
+
+// diff 生成补丁文件，校验哈希按配置项 hash_algorithm 计算
+func (s *Server) diff(ctx context.Context, oldData, newData []byte, stream *serverStream) ([]byte, error) {
+	return core.CreatePatchFile(oldData, newData, &core.DiffOptions{
+		Config:   s.Config,
+		Context:  ctx,
+		Progress: core.ProgressFunc(s.Metrics.StageTimer(stream.Report)),
+		Logger:   stream.log,
+	})
+}
+
+// notify 发送调用开始事件，返回在调用结束时发送完成或失败事件的函数
+func (s *Server) notify(kind, opID string) func(size int64, err error) {
+	if s.Webhooks == nil {
+		return func(int64, error) {}
+	}
+	var id [16]byte
+	rand.Read(id[:])
+	e := webhook.Event{Type: webhook.EventStarted, Source: "grpc", JobID: hex.EncodeToString(id[:]), OperationID: opID, Kind: kind}
+	s.Webhooks.Send(e)
+	start := time.Now()
+	return func(size int64, err error) {
+		e.Type, e.DurationSeconds = webhook.EventCompleted, time.Since(start).Seconds()
+		if err != nil {
+			e.Type, e.Error = webhook.EventFailed, err.Error()
+		} else {
+			e.ResultSize = size
+			if kind == "diff" {
+				e.PatchSize = size
+			}
+		}
+		s.Webhooks.Send(e)
+	}
+}
+
+// applyPatch 接收旧文件与补丁文件，校验两端哈希后返回新文件
+func (s *Server) applyPatch(ctx context.Context, body io.Reader, stream *serverStream) error {
+	oldData, patch, err := s.receive(ctx, body)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	done := s.notify("apply", stream.opID)
+	newData, err := s.apply(ctx, oldData, patch, stream)
+	s.Metrics.Observe(metrics.OpApply, int64(len(oldData)+len(patch)), 0, start, err)
+	done(int64(len(newData)), err)
+	if err != nil {
+		return err
+	}
+	return stream.sendData(ctx, newData)
+}
+
+// apply 校验两端哈希并应用补丁
+func (s *Server) apply(ctx context.Context, oldData, patch []byte, stream *serverStream) ([]byte, error) {
+	return core.ApplyPatchFile(oldData, patch, &core.ApplyOptions{
+		Config:   s.Config,
+		Context:  ctx,
+		Progress: core.ProgressFunc(s.Metrics.StageTimer(stream.Report)),
+		Logger:   stream.log,
+	})
+}
+
+// serverStream 服务端的响应流，进度回调可能来自多个协程
+type serverStream struct {
+	mu  sync.Mutex
+	w   http.ResponseWriter
+	err error
+	// opID 本次调用的操作 ID，log 为附加了该 ID 的日志
+	opID string
+	log  logger.Logger
+}
+
+// send 写出一个响应消息并立即刷新
+func (s *serverStream) send(msg *responseMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if s.err = writeFrame(s.w, msg.marshal()); s.err == nil {
+		s.err = http.NewResponseController(s.w).Flush()
+	}
+	return s.err
+}
+
+// Report 实现 core.ProgressReporter，将进度作为响应消息发送
+func (s *serverStream) Report(stage string, current, total int64) {
+	s.send(&responseMessage{progress: &progressMessage{stage: stage, current: current, total: total}})
+}
+
+// sendData 分块发送结果数据
+func (s *serverStream) sendData(ctx context.Context, data []byte) (err error) {
+	_, span := trace.Start(ctx, "write", trace.Int64("bytes", int64(len(data))))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+	for len(data) > 0 {
+		n := min(len(data), chunkSize)
+		if err := s.send(&responseMessage{chunk: data[:n]}); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// parseTimeout 解析 grpc-timeout：最多 8 位数字加单位 H、M、S、m、u、n
+func parseTimeout(v string) (time.Duration, error) {
+	if len(v) < 2 || len(v) > 9 {
+		return 0, errors.New("malformed grpc-timeout " + strconv.Quote(v))
+	}
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("malformed grpc-timeout " + strconv.Quote(v))
+	}
+	units := map[byte]time.Duration{
+		'H': time.Hour, 'M': time.Minute, 'S': time.Second,
+		'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond,
+	}
+	unit, ok := units[v[len(v)-1]]
+	if !ok {
+		return 0, errors.New("malformed grpc-timeout " + strconv.Quote(v))
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// formatTimeout 将剩余时间编码为 grpc-timeout，按毫秒向上取整
+func formatTimeout(d time.Duration) string {
+	ms := (d + time.Millisecond - 1) / time.Millisecond
+	if ms < 1 {
+		ms = 1
+	}
+	if ms <= 99999999 {
+		return strconv.FormatInt(int64(ms), 10) + "m"
+	}
+	return strconv.FormatInt(int64(d/time.Second)+1, 10) + "S"
+}
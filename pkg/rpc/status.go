@@ -0,0 +1,106 @@
+package rpc
+
+import (
+	"bindiff/core"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Code gRPC 状态码
+type Code int
+
+// 服务使用的 gRPC 状态码
+const (
+	OK                 Code = 0
+	Canceled           Code = 1
+	Unknown            Code = 2
+	InvalidArgument    Code = 3
+	DeadlineExceeded   Code = 4
+	ResourceExhausted  Code = 8
+	FailedPrecondition Code = 9
+	Unimplemented      Code = 12
+	Internal           Code = 13
+	Unauthenticated    Code = 16
+)
+
+var codeNames = map[Code]string{
+	OK:                 "OK",
+	Canceled:           "Canceled",
+	Unknown:            "Unknown",
+	InvalidArgument:    "InvalidArgument",
+	DeadlineExceeded:   "DeadlineExceeded",
+	ResourceExhausted:  "ResourceExhausted",
+	FailedPrecondition: "FailedPrecondition",
+	Unimplemented:      "Unimplemented",
+	Internal:           "Internal",
+	Unauthenticated:    "Unauthenticated",
+}
+
+func (c Code) String() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Code(%d)", int(c))
+}
+
+// StatusError 调用以非 OK 状态结束
+type StatusError struct {
+	Code    Code
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("rpc error: code = %s desc = %s", e.Code, e.Message)
+}
+
+// statusf 创建 StatusError
+func statusf(code Code, format string, args ...interface{}) *StatusError {
+	return &StatusError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// toStatus 将处理过程中的错误映射为 gRPC 状态
+func toStatus(ctx context.Context, err error) *StatusError {
+	var st *StatusError
+	var patchErr *core.PatchError
+	switch {
+	case errors.As(err, &st):
+		return st
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return statusf(DeadlineExceeded, "deadline exceeded")
+	case ctx.Err() != nil || errors.Is(err, core.ErrCancelled):
+		return statusf(Canceled, "call cancelled")
+	case errors.Is(err, core.ErrHashMismatch):
+		return statusf(FailedPrecondition, "%v", err)
+	case errors.Is(err, core.ErrPatchTooLarge), errors.Is(err, core.ErrLimitExceeded):
+		return statusf(ResourceExhausted, "%v", err)
+	case errors.Is(err, errMalformed), errors.Is(err, core.ErrCorruptPatch), errors.Is(err, core.ErrUnsupportedVersion),
+		errors.Is(err, core.ErrUnsupportedHash), errors.As(err, &patchErr):
+		return statusf(InvalidArgument, "%v", err)
+	}
+	return statusf(Internal, "%v", err)
+}
+
+// encodeMessage 按 gRPC 规范对 grpc-message 做百分号编码
+func encodeMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= 0x20 && c <= 0x7e && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// decodeMessage 解码 grpc-message，格式错误时原样返回
+func decodeMessage(msg string) string {
+	if s, err := url.PathUnescape(msg); err == nil {
+		return s
+	}
+	return msg
+}
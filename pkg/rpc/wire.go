@@ -0,0 +1,193 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// errMalformed 消息帧或 protobuf 编码错误
+var errMalformed = errors.New("malformed message")
+
+// chunkMessage 对应 bindiff.proto 中的请求消息：字段 1、2 均为 bytes
+type chunkMessage struct {
+	first, second []byte
+}
+
+// progressMessage 对应 bindiff.proto 中的 Progress
+type progressMessage struct {
+	stage          string
+	current, total int64
+}
+
+// responseMessage 对应 bindiff.proto 中的响应消息：字段 1 为 Progress，字段 2 为 bytes
+type responseMessage struct {
+	progress *progressMessage
+	chunk    []byte
+}
+
+// protobuf 线格式类型
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func appendVarint(b []byte, v uint64) []byte {
+	return binary.AppendUvarint(b, v)
+}
+
+// appendBytesField 追加长度前缀字段，空值按 proto3 规则省略
+func appendBytesField(b []byte, field int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = appendVarint(b, uint64(field)<<3|wireBytes)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendVarintField(b []byte, field int, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendVarint(b, uint64(field)<<3|wireVarint)
+	return appendVarint(b, uint64(v))
+}
+
+func (m *chunkMessage) marshal() []byte {
+	b := appendBytesField(nil, 1, m.first)
+	return appendBytesField(b, 2, m.second)
+}
+
+func (m *responseMessage) marshal() []byte {
+	var b []byte
+	if m.progress != nil {
+		var p []byte
+		p = appendBytesField(p, 1, []byte(m.progress.stage))
+		p = appendVarintField(p, 2, m.progress.current)
+		p = appendVarintField(p, 3, m.progress.total)
+		// 空的 Progress 也要写出字段以区分消息类型
+		b = appendVarint(b, 1<<3|wireBytes)
+		b = appendVarint(b, uint64(len(p)))
+		b = append(b, p...)
+	}
+	return appendBytesField(b, 2, m.chunk)
+}
+
+// parseFields 遍历 protobuf 消息的字段，未知字段跳过
+func parseFields(b []byte, fn func(field int, wire int, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errMalformed
+		}
+		b = b[n:]
+		field, wire := int(tag>>3), int(tag&7)
+		switch wire {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return errMalformed
+			}
+			b = b[n:]
+			if err := fn(field, wire, v, nil); err != nil {
+				return err
+			}
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || l > uint64(len(b)-n) {
+				return errMalformed
+			}
+			data := b[n : n+int(l)]
+			b = b[n+int(l):]
+			if err := fn(field, wire, 0, data); err != nil {
+				return err
+			}
+		case 1: // fixed64
+			if len(b) < 8 {
+				return errMalformed
+			}
+			b = b[8:]
+		case 5: // fixed32
+			if len(b) < 4 {
+				return errMalformed
+			}
+			b = b[4:]
+		default:
+			return fmt.Errorf("%w: wire type %d", errMalformed, wire)
+		}
+	}
+	return nil
+}
+
+func (m *chunkMessage) unmarshal(b []byte) error {
+	return parseFields(b, func(field, wire int, _ uint64, data []byte) error {
+		switch {
+		case field == 1 && wire == wireBytes:
+			m.first = data
+		case field == 2 && wire == wireBytes:
+			m.second = data
+		}
+		return nil
+	})
+}
+
+func (m *responseMessage) unmarshal(b []byte) error {
+	return parseFields(b, func(field, wire int, _ uint64, data []byte) error {
+		switch {
+		case field == 1 && wire == wireBytes:
+			p := &progressMessage{}
+			m.progress = p
+			return parseFields(data, func(field, wire int, v uint64, data []byte) error {
+				switch {
+				case field == 1 && wire == wireBytes:
+					p.stage = string(data)
+				case field == 2 && wire == wireVarint:
+					p.current = int64(v)
+				case field == 3 && wire == wireVarint:
+					p.total = int64(v)
+				}
+				return nil
+			})
+		case field == 2 && wire == wireBytes:
+			m.chunk = data
+		}
+		return nil
+	})
+}
+
+// readFrame 读取一个 gRPC 消息帧：1 字节压缩标志、4 字节大端长度、消息体。
+// 流结束时返回 io.EOF，消息超过 maxSize 时返回错误
+func readFrame(r io.Reader, maxSize int) ([]byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("%w: truncated frame header", errMalformed)
+		}
+		return nil, err
+	}
+	if hdr[0] != 0 {
+		return nil, fmt.Errorf("%w: compressed messages are not supported", errMalformed)
+	}
+	size := binary.BigEndian.Uint32(hdr[1:])
+	if uint64(size) > uint64(maxSize) {
+		return nil, fmt.Errorf("message of %d bytes exceeds the %d byte limit", size, maxSize)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("%w: truncated frame", errMalformed)
+	}
+	return msg, nil
+}
+
+// writeFrame 写出一个未压缩的 gRPC 消息帧
+func writeFrame(w io.Writer, msg []byte) error {
+	var hdr [5]byte
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(msg)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// azureAPIVersion Blob REST API 版本
+const azureAPIVersion = "2020-10-02"
+
+// AzureOptions Azure Blob 连接选项
+type AzureOptions struct {
+	// Endpoint 自定义服务地址（如 Azurite 的 http://127.0.0.1:10000/devstoreaccount1）
+	Endpoint string
+	// AccountKey base64 编码的账户密钥，用于 SharedKey 签名
+	AccountKey string
+	// SASToken 共享访问签名，设置后不再使用账户密钥
+	SASToken string
+	// Client 为空时使用 http.DefaultClient
+	Client *http.Client
+}
+
+// Azure 基于 Blob REST API 的后端，对象保存为块 Blob
+type Azure struct {
+	account   string
+	container string
+	opts      AzureOptions
+	base      string
+	key       []byte
+}
+
+// NewAzure 创建 Azure Blob 后端
+func NewAzure(account, container string, opts AzureOptions) *Azure {
+	a := &Azure{account: account, container: container, opts: opts}
+	if opts.Endpoint != "" {
+		a.base = strings.TrimSuffix(opts.Endpoint, "/")
+	} else {
+		a.base = fmt.Sprintf("https://%s.blob.core.windows.net", account)
+	}
+	if opts.SASToken == "" && opts.AccountKey != "" {
+		// 密钥格式错误时在请求中以 403 暴露
+		a.key, _ = base64.StdEncoding.DecodeString(opts.AccountKey)
+	}
+	return a
+}
+
+// blobURL 返回 Blob 地址，query 为已编码的查询串
+func (a *Azure) blobURL(key, query string) string {
+	u := a.base + "/" + uriEncode(a.container, true)
+	if key != "" {
+		u += "/" + uriEncode(key, false)
+	}
+	if sas := strings.TrimPrefix(a.opts.SASToken, "?"); sas != "" {
+		if query != "" {
+			query += "&"
+		}
+		query += sas
+	}
+	if query != "" {
+		u += "?" + query
+	}
+	return u
+}
+
+// do 签名并发送请求，暂时性故障时重试（见 sendWithRetry）
+func (a *Azure) do(ctx context.Context, method, rawURL string, body []byte, header http.Header) (*http.Response, error) {
+	return sendWithRetry(ctx, func(ctx context.Context) (*http.Response, error) {
+		return a.send(ctx, method, rawURL, body, header)
+	})
+}
+
+// send 签名并发送一次请求，每次重试都重新签名
+func (a *Azure) send(ctx context.Context, method, rawURL string, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	if body == nil {
+		req.Body = http.NoBody
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("X-Ms-Date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("X-Ms-Version", azureAPIVersion)
+	if a.key != nil {
+		req.Header.Set("Authorization", "SharedKey "+a.account+":"+a.sign(req))
+	}
+	client := a.opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// sign 计算 SharedKey 签名
+func (a *Azure) sign(req *http.Request) string {
+	length := ""
+	if req.ContentLength > 0 {
+		length = strconv.FormatInt(req.ContentLength, 10)
+	}
+	h := req.Header
+	var b strings.Builder
+	for _, v := range []string{
+		req.Method,
+		h.Get("Content-Encoding"), h.Get("Content-Language"), length,
+		h.Get("Content-MD5"), h.Get("Content-Type"), h.Get("Date"),
+		h.Get("If-Modified-Since"), h.Get("If-Match"), h.Get("If-None-Match"),
+		h.Get("If-Unmodified-Since"), h.Get("Range"),
+	} {
+		b.WriteString(v + "\n")
+	}
+
+	// 规范化的 x-ms- 头
+	var names []string
+	for k := range h {
+		if lk := strings.ToLower(k); strings.HasPrefix(lk, "x-ms-") {
+			names = append(names, lk)
+		}
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		b.WriteString(k + ":" + strings.TrimSpace(h.Get(k)) + "\n")
+	}
+
+	// 规范化的资源：账户、路径与排序后的查询参数
+	b.WriteString("/" + a.account + req.URL.EscapedPath())
+	query := req.URL.Query()
+	params := make([]string, 0, len(query))
+	for k := range query {
+		params = append(params, k)
+	}
+	sort.Strings(params)
+	for _, k := range params {
+		values := query[k]
+		sort.Strings(values)
+		b.WriteString("\n" + strings.ToLower(k) + ":" + strings.Join(values, ","))
+	}
+
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(b.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (a *Azure) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	resp, err := a.do(ctx, http.MethodGet, a.blobURL(key, ""), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp, key)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (a *Azure) GetRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	if length <= 0 {
+		return nil, nil
+	}
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)}}
+	resp, err := a.do(ctx, http.MethodGet, a.blobURL(key, ""), nil, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return readRange(resp, key, offset, length)
+}
+
+func (a *Azure) Put(ctx context.Context, key string, data []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	header := http.Header{
+		"Content-Type":   {"application/octet-stream"},
+		"X-Ms-Blob-Type": {"BlockBlob"},
+	}
+	resp, err := a.do(ctx, http.MethodPut, a.blobURL(key, ""), data, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return responseError(resp, key)
+	}
+	return nil
+}
+
+func (a *Azure) Stat(ctx context.Context, key string) (int64, error) {
+	if err := checkKey(key); err != nil {
+		return 0, err
+	}
+	resp, err := a.do(ctx, http.MethodHead, a.blobURL(key, ""), nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, responseError(resp, key)
+	}
+	return contentLength(resp), nil
+}
+
+func (a *Azure) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	resp, err := a.do(ctx, http.MethodDelete, a.blobURL(key, ""), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNotFound {
+		return responseError(resp, key)
+	}
+	return nil
+}
+
+// enumerationResults List Blobs 响应
+type enumerationResults struct {
+	Blobs []struct {
+		Name string `xml:"Name"`
+	} `xml:"Blobs>Blob"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+func (a *Azure) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	marker := ""
+	for {
+		params := map[string]string{"restype": "container", "comp": "list", "prefix": prefix}
+		if marker != "" {
+			params["marker"] = marker
+		}
+		resp, err := a.do(ctx, http.MethodGet, a.blobURL("", encodeQuery(params)), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result enumerationResults
+		if resp.StatusCode != http.StatusOK {
+			err = responseError(resp, prefix)
+		} else {
+			err = xml.NewDecoder(resp.Body).Decode(&result)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", a.container, err)
+		}
+		for _, b := range result.Blobs {
+			keys = append(keys, b.Name)
+		}
+		if result.NextMarker == "" {
+			return keys, nil
+		}
+		marker = result.NextMarker
+	}
+}
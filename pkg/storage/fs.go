@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"bindiff/pkg/utils"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FS 本地目录后端，键映射为目录下的相对路径
+type FS struct {
+	dir string
+}
+
+// NewFS 创建以 dir 为根的本地后端
+func NewFS(dir string) *FS {
+	return &FS{dir: dir}
+}
+
+// Dir 返回根目录
+func (f *FS) Dir() string {
+	return f.dir
+}
+
+// Path 返回键对应的文件路径
+func (f *FS) Path(key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(f.dir, filepath.FromSlash(key)), nil
+}
+
+func (f *FS) Get(ctx context.Context, key string) ([]byte, error) {
+	p, err := f.Path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return data, err
+}
+
+func (f *FS) GetRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	p, err := f.Path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return nil, err
+	}
+	defer file.Close()
+	buf := make([]byte, length)
+	n, err := file.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func (f *FS) Put(ctx context.Context, key string, data []byte) error {
+	p, err := f.Path(key)
+	if err != nil {
+		return err
+	}
+	return utils.SafeWrite(p, data)
+}
+
+func (f *FS) Stat(ctx context.Context, key string) (int64, error) {
+	p, err := f.Path(key)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (f *FS) Delete(ctx context.Context, key string) error {
+	p, err := f.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *FS) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(f.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(f.dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		// 跳过 SafeWrite 遗留的临时文件
+		if strings.HasPrefix(key, prefix) && !strings.HasSuffix(key, ".tmp") {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to list %s: %w", f.dir, err)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
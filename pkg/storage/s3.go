@@ -0,0 +1,405 @@
+package storage
+
+import (
+	"bindiff/pkg/utils"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// emptyPayloadHash 空请求体的 SHA256
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Options S3 兼容服务的连接选项
+type S3Options struct {
+	// Endpoint 自定义服务地址（MinIO、Ceph 等），设置后使用路径风格寻址
+	Endpoint string
+	// Region 签名使用的区域
+	Region string
+	// AccessKey、SecretKey 用于 SigV4 签名，为空时匿名访问
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// BearerToken 设置后以 OAuth 令牌代替 SigV4 签名（GCS）
+	BearerToken string
+	// Client 为空时使用 http.DefaultClient
+	Client *http.Client
+}
+
+// S3 基于 S3 REST API 的后端，GCS 通过其 XML API 复用同一实现
+type S3 struct {
+	bucket    string
+	opts      S3Options
+	base      string
+	pathStyle bool
+}
+
+// NewS3 创建 S3 后端
+func NewS3(bucket string, opts S3Options) *S3 {
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	s := &S3{bucket: bucket, opts: opts}
+	if opts.Endpoint != "" {
+		s.base = strings.TrimSuffix(opts.Endpoint, "/")
+		s.pathStyle = true
+	} else {
+		s.base = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, opts.Region)
+	}
+	return s
+}
+
+// NewGCS 创建 Google Cloud Storage 后端（XML API，HMAC 密钥或 OAuth 令牌）
+func NewGCS(bucket string, opts S3Options) *S3 {
+	if opts.Endpoint == "" {
+		opts.Endpoint = "https://storage.googleapis.com"
+	}
+	// GCS 的 HMAC 签名使用 auto 区域
+	opts.Region = "auto"
+	return NewS3(bucket, opts)
+}
+
+// objectURL 返回对象地址
+func (s *S3) objectURL(key string) string {
+	p := "/" + uriEncode(key, false)
+	if s.pathStyle {
+		p = "/" + uriEncode(s.bucket, true) + p
+	}
+	return s.base + p
+}
+
+// do 签名并发送请求，暂时性故障时重试（见 sendWithRetry）
+func (s *S3) do(ctx context.Context, method, rawURL string, body []byte, header http.Header) (*http.Response, error) {
+	return sendWithRetry(ctx, func(ctx context.Context) (*http.Response, error) {
+		return s.send(ctx, method, rawURL, body, header)
+	})
+}
+
+// send 签名并发送一次请求，每次重试都重新签名
+func (s *S3) send(ctx context.Context, method, rawURL string, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	if body == nil {
+		req.Body = http.NoBody
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	switch {
+	case s.opts.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+s.opts.BearerToken)
+	case s.opts.AccessKey != "":
+		payloadHash := emptyPayloadHash
+		if len(body) > 0 {
+			sum := sha256.Sum256(body)
+			payloadHash = hex.EncodeToString(sum[:])
+		}
+		if s.opts.SessionToken != "" {
+			req.Header.Set("X-Amz-Security-Token", s.opts.SessionToken)
+		}
+		SignV4(req, payloadHash, s.opts.AccessKey, s.opts.SecretKey, s.opts.Region, "s3", time.Now())
+	}
+	client := s.opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+func (s *S3) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, s.objectURL(key), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp, key)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (s *S3) GetRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	if length <= 0 {
+		return nil, nil
+	}
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)}}
+	resp, err := s.do(ctx, http.MethodGet, s.objectURL(key), nil, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return readRange(resp, key, offset, length)
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	resp, err := s.do(ctx, http.MethodPut, s.objectURL(key), data, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp, key)
+	}
+	return nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (int64, error) {
+	if err := checkKey(key); err != nil {
+		return 0, err
+	}
+	resp, err := s.do(ctx, http.MethodHead, s.objectURL(key), nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, responseError(resp, key)
+	}
+	return contentLength(resp), nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, s.objectURL(key), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return responseError(resp, key)
+	}
+	return nil
+}
+
+// listBucketResult ListObjectsV2 响应
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		params := map[string]string{"list-type": "2", "prefix": prefix}
+		if token != "" {
+			params["continuation-token"] = token
+		}
+		rawURL := s.base + "/"
+		if s.pathStyle {
+			rawURL += uriEncode(s.bucket, true)
+		}
+		resp, err := s.do(ctx, http.MethodGet, rawURL+"?"+encodeQuery(params), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		if resp.StatusCode != http.StatusOK {
+			err = responseError(resp, prefix)
+		} else {
+			err = xml.NewDecoder(resp.Body).Decode(&result)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", s.bucket, err)
+		}
+		for _, c := range result.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// SignV4 以 AWS Signature Version 4 签名请求，设置 X-Amz-Date、X-Amz-Content-Sha256 与 Authorization
+func SignV4(req *http.Request, payloadHash, accessKey, secretKey, region, service string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// 规范请求：签名 Host 与请求中的全部头
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := map[string]string{}
+	for k, v := range req.URL.Query() {
+		query[k] = v[0]
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		encodeQuery(query),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 计算 HMAC-SHA256
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode 按 RFC 3986 编码，保留非保留字符；encodeSlash 为 false 时保留 "/"
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// encodeQuery 按参数名排序并编码查询串
+func encodeQuery(params map[string]string) string {
+	names := make([]string, 0, len(params))
+	for k := range params {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, k := range names {
+		parts[i] = uriEncode(k, true) + "=" + uriEncode(params[k], true)
+	}
+	return strings.Join(parts, "&")
+}
+
+// readRange 读取范围请求的响应，服务端忽略 Range 返回整个对象时自行截取
+func readRange(resp *http.Response, key string, offset, length int64) ([]byte, error) {
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return io.ReadAll(io.LimitReader(resp.Body, length))
+	case http.StatusOK:
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, length))
+	case http.StatusRequestedRangeNotSatisfiable:
+		return nil, nil
+	}
+	return nil, responseError(resp, key)
+}
+
+// serviceError S3 与 Azure 共用的 XML 错误响应
+type serviceError struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// responseError 把非成功响应转换为错误，404 返回 ErrNotFound
+func responseError(resp *http.Response, key string) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var e serviceError
+	if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+		return fmt.Errorf("%s: %s: %s (%s)", key, resp.Status, e.Code, e.Message)
+	}
+	return fmt.Errorf("%s: unexpected status %s", key, resp.Status)
+}
+
+// contentLength 解析响应头中的对象大小
+func contentLength(resp *http.Response) int64 {
+	if resp.ContentLength >= 0 {
+		return resp.ContentLength
+	}
+	n, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	return n
+}
+
+// sendWithRetry 发送请求，连接失败或返回可重试的状态码（429、5xx 等）时按 utils.RetryWithContext 退避重试。
+// 重试用尽时返回最后一个响应，由调用方按状态码转换为错误
+func sendWithRetry(ctx context.Context, send func(ctx context.Context) (*http.Response, error)) (*http.Response, error) {
+	var resp *http.Response
+	err := utils.RetryWithContext(ctx, utils.RetryOptions{}, func(ctx context.Context) error {
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+			resp = nil
+		}
+		r, err := send(ctx)
+		if err != nil {
+			return err
+		}
+		resp = r
+		if utils.RetryableStatus(r.StatusCode) {
+			return utils.NewStatusError(r)
+		}
+		return nil
+	})
+	if resp != nil {
+		return resp, nil
+	}
+	return nil, err
+}
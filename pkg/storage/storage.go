@@ -0,0 +1,231 @@
+// Package storage 定义补丁与仓库对象的存储后端：本地目录、S3（及 S3 兼容服务）、GCS 与 Azure Blob，
+// 由配置中的 storage 段选择
+package storage
+
+import (
+	"bindiff/pkg/config"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("object not found")
+
+// Backend 以键寻址的对象存储，键使用 "/" 分隔
+type Backend interface {
+	// Get 读取整个对象
+	Get(ctx context.Context, key string) ([]byte, error)
+	// GetRange 读取对象 [offset, offset+length) 的内容
+	GetRange(ctx context.Context, key string, offset, length int64) ([]byte, error)
+	// Put 写入对象，已存在时覆盖
+	Put(ctx context.Context, key string, data []byte) error
+	// Stat 返回对象大小
+	Stat(ctx context.Context, key string) (int64, error)
+	// Delete 删除对象，对象不存在时不报错
+	Delete(ctx context.Context, key string) error
+	// List 返回以 prefix 开头的所有键
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Location 解析后的存储地址
+type Location struct {
+	Scheme string // file、s3、gs 或 azure
+	// Account Azure 存储账户名
+	Account string
+	// Bucket S3/GCS 存储桶或 Azure 容器，file 时为目录
+	Bucket string
+	// Prefix 存储桶内的键前缀，不以 "/" 开头或结尾
+	Prefix string
+}
+
+// IsURL 判断 s 是否为远程存储地址（s3://、gs:// 或 azure://）
+func IsURL(s string) bool {
+	for _, scheme := range []string{"s3://", "gs://", "azure://"} {
+		if strings.HasPrefix(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseURL 解析存储地址，没有协议的地址视为本地目录
+func ParseURL(raw string) (*Location, error) {
+	if !strings.Contains(raw, "://") {
+		return &Location{Scheme: "file", Bucket: raw}, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage URL %q: %w", raw, err)
+	}
+	loc := &Location{Scheme: u.Scheme}
+	p := strings.Trim(u.Path, "/")
+	switch u.Scheme {
+	case "file":
+		loc.Bucket = filepath.FromSlash(u.Host + u.Path)
+		return loc, nil
+	case "s3", "gs":
+		loc.Bucket, loc.Prefix = u.Host, p
+	case "azure":
+		loc.Account = u.Host
+		loc.Bucket, loc.Prefix, _ = strings.Cut(p, "/")
+	default:
+		return nil, fmt.Errorf("unsupported storage URL scheme %q", u.Scheme)
+	}
+	if loc.Bucket == "" {
+		return nil, fmt.Errorf("storage URL %q has no bucket or container", raw)
+	}
+	return loc, nil
+}
+
+// Open 按配置打开存储后端，cfg.URL 为存储根地址
+func Open(cfg config.StorageConfig) (Backend, error) {
+	loc, err := ParseURL(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	return openLocation(cfg, loc)
+}
+
+// OpenObject 打开指向单个对象的地址（如 s3://bucket/dir/file.bin），返回其所在存储桶的后端与对象键
+func OpenObject(cfg config.StorageConfig, raw string) (Backend, string, error) {
+	loc, err := ParseURL(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	if loc.Scheme == "file" {
+		dir, name := filepath.Split(loc.Bucket)
+		loc.Bucket = dir
+		b, err := openLocation(cfg, loc)
+		return b, name, err
+	}
+	if loc.Prefix == "" {
+		return nil, "", fmt.Errorf("storage URL %q does not name an object", raw)
+	}
+	key := loc.Prefix
+	loc.Prefix = ""
+	b, err := openLocation(cfg, loc)
+	return b, key, err
+}
+
+// openLocation 创建 loc 对应的后端，带前缀时包装为 Prefixed
+func openLocation(cfg config.StorageConfig, loc *Location) (Backend, error) {
+	var b Backend
+	switch loc.Scheme {
+	case "file":
+		dir := loc.Bucket
+		if dir == "" {
+			dir = "."
+		}
+		return NewFS(dir), nil
+	case "s3":
+		b = NewS3(loc.Bucket, s3Credentials(cfg))
+	case "gs":
+		b = NewGCS(loc.Bucket, gcsCredentials(cfg))
+	case "azure":
+		b = NewAzure(loc.Account, loc.Bucket, azureCredentials(cfg))
+	}
+	if loc.Prefix != "" {
+		b = Prefixed(b, loc.Prefix)
+	}
+	return b, nil
+}
+
+// firstNonEmpty 返回第一个非空值，用于配置与环境变量的回退
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// s3Credentials 合并配置与 AWS 标准环境变量
+func s3Credentials(cfg config.StorageConfig) S3Options {
+	return S3Options{
+		Endpoint:     firstNonEmpty(cfg.Endpoint, os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL")),
+		Region:       firstNonEmpty(cfg.Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1"),
+		AccessKey:    firstNonEmpty(cfg.AccessKey, os.Getenv("AWS_ACCESS_KEY_ID")),
+		SecretKey:    firstNonEmpty(cfg.SecretKey, os.Getenv("AWS_SECRET_ACCESS_KEY")),
+		SessionToken: firstNonEmpty(cfg.Token, os.Getenv("AWS_SESSION_TOKEN")),
+	}
+}
+
+// gcsCredentials GCS 使用 HMAC 密钥（SigV4）或 OAuth 访问令牌，都未设置时匿名访问
+func gcsCredentials(cfg config.StorageConfig) S3Options {
+	return S3Options{
+		Endpoint:    cfg.Endpoint,
+		AccessKey:   cfg.AccessKey,
+		SecretKey:   cfg.SecretKey,
+		BearerToken: firstNonEmpty(cfg.Token, os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")),
+	}
+}
+
+// azureCredentials 合并配置与 Azure 标准环境变量
+func azureCredentials(cfg config.StorageConfig) AzureOptions {
+	return AzureOptions{
+		Endpoint:   cfg.Endpoint,
+		AccountKey: firstNonEmpty(cfg.SecretKey, os.Getenv("AZURE_STORAGE_KEY")),
+		SASToken:   firstNonEmpty(cfg.Token, os.Getenv("AZURE_STORAGE_SAS_TOKEN")),
+	}
+}
+
+// prefixed 在所有键前加上固定前缀
+type prefixed struct {
+	b      Backend
+	prefix string
+}
+
+// Prefixed 返回在 b 中以 prefix 为根的后端
+func Prefixed(b Backend, prefix string) Backend {
+	return &prefixed{b: b, prefix: strings.Trim(prefix, "/") + "/"}
+}
+
+func (p *prefixed) Get(ctx context.Context, key string) ([]byte, error) {
+	return p.b.Get(ctx, p.prefix+key)
+}
+
+func (p *prefixed) GetRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	return p.b.GetRange(ctx, p.prefix+key, offset, length)
+}
+
+func (p *prefixed) Put(ctx context.Context, key string, data []byte) error {
+	return p.b.Put(ctx, p.prefix+key, data)
+}
+
+func (p *prefixed) Stat(ctx context.Context, key string) (int64, error) {
+	return p.b.Stat(ctx, p.prefix+key)
+}
+
+func (p *prefixed) Delete(ctx context.Context, key string) error {
+	return p.b.Delete(ctx, p.prefix+key)
+}
+
+func (p *prefixed) List(ctx context.Context, prefix string) ([]string, error) {
+	keys, err := p.b.List(ctx, p.prefix+prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i, k := range keys {
+		keys[i] = strings.TrimPrefix(k, p.prefix)
+	}
+	return keys, nil
+}
+
+// checkKey 拒绝空键与包含 ".." 段的键
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return fmt.Errorf("invalid object key %q", key)
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == ".." {
+			return fmt.Errorf("invalid object key %q", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultBatchSize 缓冲的跨度达到该数量时立即导出
+	defaultBatchSize = 512
+	// defaultInterval 定时导出的间隔
+	defaultInterval = 5 * time.Second
+	// maxBuffered 导出失败或过慢时缓冲的跨度上限，超出的跨度被丢弃
+	maxBuffered = 8192
+)
+
+// OTLPOptions OTLP/HTTP 导出器选项
+type OTLPOptions struct {
+	// Endpoint 完整的导出地址，如 http://collector:4318/v1/traces
+	Endpoint string
+	// ServiceName 资源属性 service.name，为空时为 "bindiff"
+	ServiceName string
+	// Headers 附加的请求头（如认证）
+	Headers map[string]string
+	// Interval 定时导出的间隔，0 使用 5 秒
+	Interval time.Duration
+	// Client 发送请求的 HTTP 客户端，nil 时使用带 10 秒超时的客户端
+	Client *http.Client
+	// OnError 导出失败时调用，nil 时忽略错误
+	OnError func(error)
+}
+
+// OTLPExporter 以 OTLP/HTTP JSON 编码批量导出跨度，可直接发送到 OpenTelemetry Collector
+// 或支持 OTLP 的追踪后端（Jaeger、Tempo 等）
+type OTLPExporter struct {
+	opts OTLPOptions
+
+	mu      sync.Mutex
+	buf     []SpanData
+	flushMu sync.Mutex
+	kick    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewOTLPExporter 创建导出器并启动后台导出协程，使用完毕后调用 Shutdown
+func NewOTLPExporter(opts OTLPOptions) *OTLPExporter {
+	if opts.ServiceName == "" {
+		opts.ServiceName = "bindiff"
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	e := &OTLPExporter{
+		opts:    opts,
+		kick:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go e.loop()
+	return e
+}
+
+// ExportSpans 缓冲跨度，由后台协程批量发送
+func (e *OTLPExporter) ExportSpans(spans []SpanData) {
+	e.mu.Lock()
+	if len(e.buf)+len(spans) <= maxBuffered {
+		e.buf = append(e.buf, spans...)
+	}
+	full := len(e.buf) >= defaultBatchSize
+	e.mu.Unlock()
+	if full {
+		select {
+		case e.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Shutdown 停止后台协程并导出剩余的跨度
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.once.Do(func() { close(e.done) })
+	select {
+	case <-e.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return e.Flush(ctx)
+}
+
+func (e *OTLPExporter) loop() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(e.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+		case <-e.kick:
+		}
+		if err := e.Flush(context.Background()); err != nil && e.opts.OnError != nil {
+			e.opts.OnError(err)
+		}
+	}
+}
+
+// Flush 立即发送缓冲的跨度
+func (e *OTLPExporter) Flush(ctx context.Context) error {
+	e.flushMu.Lock()
+	defer e.flushMu.Unlock()
+	for {
+		e.mu.Lock()
+		n := min(len(e.buf), defaultBatchSize)
+		batch := e.buf[:n:n]
+		e.buf = e.buf[n:]
+		e.mu.Unlock()
+		if n == 0 {
+			return nil
+		}
+		if err := e.send(ctx, batch); err != nil {
+			return err
+		}
+	}
+}
+
+// send 发送一批跨度
+func (e *OTLPExporter) send(ctx context.Context, spans []SpanData) error {
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.opts.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.opts.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export spans: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to export spans: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// OTLP JSON 编码（opentelemetry/proto/collector/trace/v1 ExportTraceServiceRequest），
+// 按 OTLP 的 JSON 映射，ID 为十六进制字符串，64 位整数为十进制字符串
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	}
+)
+
+// encode 构造导出请求
+func (e *OTLPExporter) encode(spans []SpanData) *otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.Context.TraceID[:]),
+			SpanID:            hex.EncodeToString(s.Context.SpanID[:]),
+			Name:              s.Name,
+			Kind:              int(s.Kind),
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		}
+		if s.Parent != (SpanID{}) {
+			span.ParentSpanID = hex.EncodeToString(s.Parent[:])
+		}
+		for _, a := range s.Attrs {
+			span.Attributes = append(span.Attributes, keyValue(a))
+		}
+		if s.Err != "" {
+			// STATUS_CODE_ERROR
+			span.Status = otlpStatus{Code: 2, Message: s.Err}
+		}
+		out = append(out, span)
+	}
+	return &otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpKeyValue{keyValue(String("service.name", e.opts.ServiceName))}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "bindiff"}, Spans: out}},
+	}}}
+}
+
+// keyValue 把属性编码为 OTLP 的 AnyValue
+func keyValue(a Attr) otlpKeyValue {
+	var v map[string]interface{}
+	switch x := a.Value.(type) {
+	case string:
+		v = map[string]interface{}{"stringValue": x}
+	case int64:
+		v = map[string]interface{}{"intValue": strconv.FormatInt(x, 10)}
+	case int:
+		v = map[string]interface{}{"intValue": strconv.Itoa(x)}
+	case float64:
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			v = map[string]interface{}{"stringValue": strconv.FormatFloat(x, 'g', -1, 64)}
+		} else {
+			v = map[string]interface{}{"doubleValue": x}
+		}
+	case bool:
+		v = map[string]interface{}{"boolValue": x}
+	default:
+		v = map[string]interface{}{"stringValue": fmt.Sprint(x)}
+	}
+	return otlpKeyValue{Key: a.Key, Value: v}
+}
+
+// EndpointFromEnv 按 OpenTelemetry 的约定读取导出地址：OTEL_EXPORTER_OTLP_TRACES_ENDPOINT 原样使用，
+// 否则在 OTEL_EXPORTER_OTLP_ENDPOINT 后追加 /v1/traces；都未设置时返回空字符串
+func EndpointFromEnv() string {
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); v != "" {
+		return v
+	}
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); v != "" {
+		return strings.TrimSuffix(v, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// HeadersFromEnv 解析 OTEL_EXPORTER_OTLP_HEADERS（逗号分隔的 key=value）
+func HeadersFromEnv() map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if ok && strings.TrimSpace(k) != "" {
+			headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return headers
+}
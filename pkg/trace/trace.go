@@ -0,0 +1,266 @@
+// Package trace 为差分与应用流水线记录 OpenTelemetry 兼容的跨度（span）：
+// 通过 W3C traceparent 头接收与传播追踪上下文，并以 OTLP/HTTP 导出到现有的追踪系统。
+// 上下文中没有 Tracer 时 Start 返回 nil 跨度，各方法不做任何事，未启用追踪的调用方没有额外开销
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader W3C Trace Context 的请求头
+const TraceparentHeader = "traceparent"
+
+// TraceID 16 字节的追踪 ID
+type TraceID [16]byte
+
+// SpanID 8 字节的跨度 ID
+type SpanID [8]byte
+
+// SpanContext 跨进程传播的追踪上下文
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid 追踪 ID 与跨度 ID 都不全为零时有效
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent 编码为 traceparent 头的值（版本 00）
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceparent 解析 traceparent 头。未知的更高版本按 00 的前缀解析
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' || (len(s) > 55 && (s[:2] == "00" || s[55] != '-')) {
+		return sc, fmt.Errorf("malformed traceparent %q", s)
+	}
+	version, err := hex.DecodeString(s[:2])
+	if err != nil || version[0] == 0xff {
+		return sc, fmt.Errorf("malformed traceparent %q", s)
+	}
+	flags, err := hex.DecodeString(s[53:55])
+	if err != nil {
+		return sc, fmt.Errorf("malformed traceparent %q", s)
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(s[3:35])); err != nil {
+		return sc, fmt.Errorf("malformed traceparent %q", s)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(s[36:52])); err != nil {
+		return sc, fmt.Errorf("malformed traceparent %q", s)
+	}
+	if !sc.IsValid() {
+		return sc, errors.New("traceparent with all-zero trace or span id")
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// SpanKind 跨度类型，取值与 OTLP 相同
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+)
+
+// Attr 跨度属性，值为 string、int64、float64 或 bool
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+// String 字符串属性
+func String(key, value string) Attr { return Attr{key, value} }
+
+// Int64 整数属性
+func Int64(key string, value int64) Attr { return Attr{key, value} }
+
+// Float64 浮点数属性
+func Float64(key string, value float64) Attr { return Attr{key, value} }
+
+// Bool 布尔属性
+func Bool(key string, value bool) Attr { return Attr{key, value} }
+
+// SpanData 已结束的跨度，交给 Exporter 导出
+type SpanData struct {
+	Name       string
+	Kind       SpanKind
+	Context    SpanContext
+	Parent     SpanID
+	Start, End time.Time
+	Attrs      []Attr
+	// Err 非空表示跨度以错误结束
+	Err string
+}
+
+// Exporter 跨度导出器
+type Exporter interface {
+	// ExportSpans 导出一批已结束的跨度，须可并发调用
+	ExportSpans(spans []SpanData)
+	// Shutdown 导出剩余的跨度并停止
+	Shutdown(ctx context.Context) error
+}
+
+// Tracer 创建跨度并把结束的跨度交给导出器
+type Tracer struct {
+	exporter Exporter
+}
+
+// NewTracer 创建把跨度交给 exporter 的 Tracer
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// Shutdown 导出剩余的跨度，t 为 nil 时什么都不做
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.exporter.Shutdown(ctx)
+}
+
+type tracerKey struct{}
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithTracer 返回携带 t 的上下文，其中的 Start 调用记录跨度；t 为 nil 时原样返回
+func ContextWithTracer(ctx context.Context, t *Tracer) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// ContextWithRemoteParent 返回以 sc（来自其他进程）为父跨度的上下文；sc 无效时原样返回
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// Extract 从请求头的 traceparent 取得父跨度，头缺失或无效时原样返回 ctx
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, err := ParseTraceparent(h.Get(TraceparentHeader))
+	if err != nil {
+		return ctx
+	}
+	return ContextWithRemoteParent(ctx, sc)
+}
+
+// Inject 把 ctx 中当前跨度的上下文写入请求头的 traceparent
+func Inject(ctx context.Context, h http.Header) {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		h.Set(TraceparentHeader, sc.Traceparent())
+	}
+}
+
+// SpanContextFromContext 返回 ctx 中当前跨度（或远程父跨度）的上下文
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s, ok := ctx.Value(spanKey{}).(*Span); ok {
+		return s.data.Context
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// Start 以 ctx 中的当前跨度为父跨度开始名为 name 的内部跨度，返回携带新跨度的上下文。
+// ctx 中没有 Tracer，或远程父跨度未被采样时返回 nil 跨度
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return StartKind(ctx, name, KindInternal, attrs...)
+}
+
+// StartKind 与 Start 相同，但指定跨度类型，服务端处理请求的根跨度使用 KindServer
+func StartKind(ctx context.Context, name string, kind SpanKind, attrs ...Attr) (context.Context, *Span) {
+	t, _ := ctx.Value(tracerKey{}).(*Tracer)
+	if t == nil {
+		return ctx, nil
+	}
+	parent := SpanContextFromContext(ctx)
+	if parent.IsValid() && !parent.Sampled {
+		return ctx, nil
+	}
+	s := &Span{tracer: t, data: SpanData{
+		Name:  name,
+		Kind:  kind,
+		Start: time.Now(),
+		Attrs: attrs,
+	}}
+	s.data.Context.Sampled = true
+	if parent.IsValid() {
+		s.data.Context.TraceID, s.data.Parent = parent.TraceID, parent.SpanID
+	} else {
+		rand.Read(s.data.Context.TraceID[:])
+	}
+	rand.Read(s.data.Context.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Span 进行中的跨度，nil 跨度的方法不做任何事
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+// SpanContext 返回跨度的上下文，nil 跨度返回无效的上下文
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.Context
+}
+
+// SetAttributes 添加属性
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Attrs = append(s.data.Attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// RecordError 把跨度标记为失败，err 为 nil 时什么都不做
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Err = err.Error()
+	s.mu.Unlock()
+}
+
+// End 结束跨度并交给导出器，重复调用无效
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	s.tracer.exporter.ExportSpans([]SpanData{data})
+}
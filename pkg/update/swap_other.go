@@ -0,0 +1,16 @@
+//go:build !windows
+
+package update
+
+import (
+	"fmt"
+	"os"
+)
+
+// swap 以原子重命名用 newPath 替换 target，正在运行的旧可执行文件不受影响
+func swap(newPath, target, _ string) error {
+	if err := os.Rename(newPath, target); err != nil {
+		return fmt.Errorf("failed to replace executable: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package update
+
+import (
+	"fmt"
+	"os"
+)
+
+// swap 替换 target。Windows 不能覆盖正在运行的可执行文件，但可以重命名它：
+// 先把 target 移到 oldPath，再把新文件移入；失败时移回原文件。oldPath 在下次更新时清理
+func swap(newPath, target, oldPath string) error {
+	os.Remove(oldPath)
+	if err := os.Rename(target, oldPath); err != nil {
+		return fmt.Errorf("failed to move executable aside: %w", err)
+	}
+	if err := os.Rename(newPath, target); err != nil {
+		os.Rename(oldPath, target)
+		return fmt.Errorf("failed to replace executable: %w", err)
+	}
+	// 旧文件仍在运行时删除失败，留待下次
+	os.Remove(oldPath)
+	return nil
+}
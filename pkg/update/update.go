@@ -0,0 +1,240 @@
+// Package update 为 Go 程序提供基于 bindiff 补丁的自更新：下载签名的补丁，
+// 校验签名与当前可执行文件的哈希，应用补丁并以原子重命名替换可执行文件
+package update
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/utils"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultMaxPatchSize 下载补丁的默认大小上限
+const DefaultMaxPatchSize = 256 * 1024 * 1024
+
+// 错误定义
+var (
+	// ErrSignature 补丁签名缺失或与公钥不匹配
+	ErrSignature = errors.New("invalid patch signature")
+	// ErrNotApplicable 补丁的旧文件哈希与当前可执行文件不一致（已更新或版本不对）
+	ErrNotApplicable = errors.New("patch does not apply to this executable")
+)
+
+// Options 自更新选项
+type Options struct {
+	// PublicKey 发布者的 Ed25519 公钥，必须设置
+	PublicKey ed25519.PublicKey
+	// SignatureURL 签名的地址，为空时使用补丁地址加 ".sig"
+	SignatureURL string
+	// TargetPath 要替换的文件，为空时使用当前进程的可执行文件
+	TargetPath string
+	// Client 为空时使用 http.DefaultClient
+	Client *http.Client
+	// MaxPatchSize 补丁大小上限，0 使用 DefaultMaxPatchSize
+	MaxPatchSize int64
+	// Apply 应用补丁的选项
+	Apply *core.ApplyOptions
+}
+
+// Result 更新结果
+type Result struct {
+	Path      string
+	OldSize   int64
+	NewSize   int64
+	PatchSize int64
+}
+
+// Apply 下载 patchURL 处的补丁与签名并更新可执行文件
+func Apply(ctx context.Context, patchURL string, opts *Options) (*Result, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	limit := opts.MaxPatchSize
+	if limit <= 0 {
+		limit = DefaultMaxPatchSize
+	}
+	sigURL := opts.SignatureURL
+	if sigURL == "" {
+		sigURL = patchURL + ".sig"
+	}
+
+	patch, err := download(ctx, opts.Client, patchURL, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download patch: %w", err)
+	}
+	sig, err := download(ctx, opts.Client, sigURL, 1024)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download signature: %w", err)
+	}
+	return ApplyPatch(patch, sig, opts)
+}
+
+// ApplyPatch 校验并应用已下载的补丁，适用于 HTTP 以外的传输方式。
+// 签名为原始 64 字节或其 base64 文本
+func ApplyPatch(patch, sig []byte, opts *Options) (*Result, error) {
+	if opts == nil || len(opts.PublicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: no public key configured", ErrSignature)
+	}
+	if len(sig) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+		if err != nil || len(decoded) != ed25519.SignatureSize {
+			return nil, fmt.Errorf("%w: malformed signature", ErrSignature)
+		}
+		sig = decoded
+	}
+	if !ed25519.Verify(opts.PublicKey, patch, sig) {
+		return nil, ErrSignature
+	}
+
+	target := opts.TargetPath
+	if target == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate executable: %w", err)
+		}
+		if target, err = filepath.EvalSymlinks(exe); err != nil {
+			return nil, fmt.Errorf("failed to locate executable: %w", err)
+		}
+	}
+
+	df, err := core.DecodeDiffFile(patch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode patch: %w", err)
+	}
+	if err := core.ValidateDiffFile(df); err != nil {
+		return nil, fmt.Errorf("invalid patch: %w", err)
+	}
+	oldData, err := os.ReadFile(target)
+	if err != nil {
+		return nil, err
+	}
+	if err := core.VerifyHash(df.HashAlgorithm, oldData, df.OldHash, nil); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotApplicable, err)
+	}
+	newData, err := core.ApplyDiffFile(oldData, df, opts.Apply)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply patch: %w", err)
+	}
+	if err := core.VerifyDiffFileResult(df, newData, nil); err != nil {
+		return nil, fmt.Errorf("patch application failed: %w", err)
+	}
+
+	if err := replace(target, newData); err != nil {
+		return nil, err
+	}
+	return &Result{
+		Path:      target,
+		OldSize:   int64(len(oldData)),
+		NewSize:   int64(len(newData)),
+		PatchSize: int64(len(patch)),
+	}, nil
+}
+
+// Sign 以发布者私钥签名补丁，返回写入 .sig 文件的原始签名
+func Sign(key ed25519.PrivateKey, patch []byte) []byte {
+	return ed25519.Sign(key, patch)
+}
+
+// ParsePublicKey 解析 base64 编码的公钥，便于把公钥以字符串常量编译进程序
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid Ed25519 public key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// ParsePrivateKey 解析 base64 编码的私钥（64 字节，或 32 字节的种子）
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Ed25519 private key")
+	}
+	switch len(key) {
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	}
+	return nil, fmt.Errorf("invalid Ed25519 private key")
+}
+
+// download 下载 url 的内容，超过 limit 字节时返回错误；连接失败或服务暂时不可用时重试
+func download(ctx context.Context, client *http.Client, url string, limit int64) ([]byte, error) {
+	var data []byte
+	err := utils.RetryWithContext(ctx, utils.RetryOptions{}, func(ctx context.Context) (err error) {
+		data, err = downloadOnce(ctx, client, url, limit)
+		return err
+	})
+	return data, err
+}
+
+// downloadOnce 下载一次
+func downloadOnce(ctx context.Context, client *http.Client, url string, limit int64) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, utils.NewStatusError(resp)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s: %w: exceeds %d bytes", url, core.ErrPatchTooLarge, limit)
+	}
+	return data, nil
+}
+
+// replace 在 target 所在目录写入新文件（保留原权限）并替换 target
+func replace(target string, data []byte) (err error) {
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	dir, name := filepath.Split(target)
+	tmp := filepath.Join(dir, "."+name+".new")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to create new executable: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write new executable: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write new executable: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write new executable: %w", err)
+	}
+	// umask 可能去掉了可执行位
+	if err := os.Chmod(tmp, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return swap(tmp, target, filepath.Join(dir, "."+name+".old"))
+}
@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// BearerAuthorized 检查请求是否携带 "Authorization: Bearer <token>"，以常数时间比较令牌；
+// token 为空时不要求认证
+func BearerAuthorized(r *http.Request, token string) bool {
+	if token == "" {
+		return true
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
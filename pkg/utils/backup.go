@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupSuffix 备份文件名中原文件名之后的部分，其后为本地时间
+const backupSuffix = ".backup."
+
+// backupTimeFormat 备份文件名中的时间格式
+const backupTimeFormat = "20060102-150405"
+
+// Backup BackupFile 生成的一个备份
+type Backup struct {
+	Path string
+	Time time.Time
+	Size int64
+}
+
+// BackupFile 把文件复制为同目录下的 filename.backup.<时间>，保留权限并刷盘，返回备份路径。
+// 同一秒内多次备份时时间依次加一秒，不覆盖已有备份
+func BackupFile(filename string) (string, error) {
+	src, err := os.Open(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to open source file: %w", err)
+	}
+
+	t := time.Now()
+	backupName := filename + backupSuffix + t.Format(backupTimeFormat)
+	for {
+		if _, err := os.Lstat(backupName); os.IsNotExist(err) {
+			break
+		}
+		t = t.Add(time.Second)
+		backupName = filename + backupSuffix + t.Format(backupTimeFormat)
+	}
+
+	if err := copyToFile(backupName, src, info.Mode().Perm()); err != nil {
+		return "", fmt.Errorf("failed to create backup file: %w", err)
+	}
+	return backupName, nil
+}
+
+// ListBackups 列出 filename 的备份，按时间从新到旧
+func ListBackups(filename string) ([]Backup, error) {
+	prefix := filepath.Base(filename) + backupSuffix
+	entries, err := os.ReadDir(filepath.Dir(filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var backups []Backup
+	for _, e := range entries {
+		stamp, ok := strings.CutPrefix(e.Name(), prefix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		t, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue // 临时文件或其他同名前缀的文件
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{
+			Path: filepath.Join(filepath.Dir(filename), e.Name()),
+			Time: t,
+			Size: info.Size(),
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.After(backups[j].Time) })
+	return backups, nil
+}
+
+// PruneBackups 按保留策略删除 filename 的旧备份：只保留最新的 keep 个，并删除早于 maxAge 的备份。
+// keep 或 maxAge 为 0 表示不按该条件删除；返回被删除的备份路径
+func PruneBackups(filename string, keep int, maxAge time.Duration) ([]string, error) {
+	backups, err := ListBackups(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	cutoff := time.Now().Add(-maxAge)
+	for i, b := range backups {
+		if (keep <= 0 || i < keep) && (maxAge <= 0 || !b.Time.Before(cutoff)) {
+			continue
+		}
+		if err := os.Remove(b.Path); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("failed to remove backup: %w", err)
+		}
+		removed = append(removed, b.Path)
+	}
+	return removed, nil
+}
+
+// RestoreBackup 以备份的内容原子替换 filename，并恢复备份的权限
+func RestoreBackup(backup, filename string) error {
+	src, err := os.Open(backup)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	if err := copyToFile(filename, src, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to restore backup: %w", err)
+	}
+	return nil
+}
+
+// copyToFile 以 SafeWriteFunc 把 src 复制到 filename 并设置权限
+func copyToFile(filename string, src io.Reader, perm os.FileMode) error {
+	err := SafeWriteFunc(filename, func(w io.Writer) error {
+		_, err := io.Copy(w, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return os.Chmod(filename, perm)
+}
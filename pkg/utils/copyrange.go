@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"errors"
+	"os"
+)
+
+// CopyFileRange 把 src 中从 off 开始的 n 字节复制到 dst 的当前位置并移动该位置。
+// 复制由内核完成，不经过用户空间；在支持 reflink 的文件系统（XFS、Btrfs）上只共享数据块，
+// 不实际读写数据。src 提前结束时返回较少的字节数。平台或文件系统不支持时
+// 不复制任何数据并返回 errors.ErrUnsupported，调用方应回退为读出再写入
+func CopyFileRange(dst, src *os.File, off, n int64) (int64, error) {
+	copied, err := copyFileRange(dst, src, off, n)
+	if err != nil && copied == 0 && !errors.Is(err, errors.ErrUnsupported) && isCopyRangeUnsupported(err) {
+		return 0, errors.Join(errors.ErrUnsupported, err)
+	}
+	return copied, err
+}
@@ -0,0 +1,43 @@
+//go:build linux
+
+package utils
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxCopyRangeChunk 单次 copy_file_range 调用复制的上限
+const maxCopyRangeChunk = 1 << 30
+
+// copyFileRange 循环调用 copy_file_range 直到复制 n 字节或 src 结束
+func copyFileRange(dst, src *os.File, off, n int64) (int64, error) {
+	var copied int64
+	for copied < n {
+		chunk := n - copied
+		if chunk > maxCopyRangeChunk {
+			chunk = maxCopyRangeChunk
+		}
+		k, err := unix.CopyFileRange(int(src.Fd()), &off, int(dst.Fd()), nil, int(chunk), 0)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return copied, err
+		}
+		if k == 0 {
+			break
+		}
+		copied += int64(k)
+	}
+	return copied, nil
+}
+
+// isCopyRangeUnsupported 判断 copy_file_range 的错误是否表示内核或文件系统不支持
+// （如跨文件系统复制），而不是 IO 错误
+func isCopyRangeUnsupported(err error) bool {
+	return errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EXDEV) || errors.Is(err, unix.EINVAL) ||
+		errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.EPERM) || errors.Is(err, unix.EBADF)
+}
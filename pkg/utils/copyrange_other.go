@@ -0,0 +1,18 @@
+//go:build !linux
+
+package utils
+
+import (
+	"errors"
+	"os"
+)
+
+// copyFileRange 平台没有区间复制的系统调用（macOS 的 APFS 只能克隆整个文件）
+func copyFileRange(dst, src *os.File, off, n int64) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
+
+// isCopyRangeUnsupported 平台不支持区间复制
+func isCopyRangeUnsupported(err error) bool {
+	return true
+}
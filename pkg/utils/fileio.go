@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"unsafe"
+)
+
+const (
+	// DefaultReadBuffer 流式读取的默认缓冲区大小
+	DefaultReadBuffer = 64 * 1024
+	// directAlign O_DIRECT 要求的偏移量、长度与内存对齐
+	directAlign = 4096
+	// dropCacheStep 顺序读取时每前进该距离释放一次已读部分的页缓存
+	dropCacheStep = 8 * 1024 * 1024
+)
+
+// IOHints 流式读取输入文件时的 IO 提示，零值为不加提示
+type IOHints struct {
+	// BufferSize 读取缓冲区大小，0 使用 DefaultReadBuffer
+	BufferSize int
+	// Sequential 以 POSIX_FADV_SEQUENTIAL 提示内核加大预读
+	Sequential bool
+	// DropCache 以 POSIX_FADV_DONTNEED 释放已读部分的页缓存，批量处理时不挤占其他数据的缓存
+	DropCache bool
+	// Direct 以 O_DIRECT 打开文件绕过页缓存，文件系统不支持时回退为普通读取
+	Direct bool
+}
+
+// ReadBufferSize 返回读取缓冲区大小，O_DIRECT 时向上对齐
+func (h IOHints) ReadBufferSize() int {
+	size := h.BufferSize
+	if size <= 0 {
+		size = DefaultReadBuffer
+	}
+	if h.Direct {
+		size = (size + directAlign - 1) &^ (directAlign - 1)
+	}
+	return size
+}
+
+// InputFile 按 IO 提示打开的输入文件，实现 io.Reader 与 io.ReaderAt。
+// 提示只影响性能，读出的内容与 os.File 相同；fadvise 与 O_DIRECT 只在 Linux 上生效
+type InputFile struct {
+	f      *os.File
+	hints  IOHints
+	direct bool
+	// bufs O_DIRECT 的对齐缓冲区，ReadAt 可能被并发调用，每次调用各取一个
+	bufs sync.Pool
+	pos  int64 // Read 的位置
+	// dropped 已释放页缓存的位置
+	dropped int64
+}
+
+// OpenInput 按 IO 提示打开输入文件
+func OpenInput(path string, hints IOHints) (*InputFile, error) {
+	in := &InputFile{hints: hints}
+	if hints.Direct {
+		if f, err := openDirect(path); err == nil {
+			in.f, in.direct = f, true
+			size := hints.ReadBufferSize()
+			in.bufs.New = func() interface{} {
+				buf := alignedBuffer(size)
+				return &buf
+			}
+		}
+	}
+	if in.f == nil {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		in.f = f
+	}
+	if hints.Sequential {
+		fadvise(in.f, 0, 0, adviseSequential)
+	}
+	return in, nil
+}
+
+// File 返回底层文件，供 copy_file_range 等按文件描述符的操作使用
+func (in *InputFile) File() *os.File {
+	return in.f
+}
+
+// Direct 报告是否实际以 O_DIRECT 打开
+func (in *InputFile) Direct() bool {
+	return in.direct
+}
+
+// Stat 返回文件信息
+func (in *InputFile) Stat() (os.FileInfo, error) {
+	return in.f.Stat()
+}
+
+// Read 实现 io.Reader，顺序读取时按 DropCache 释放已读部分的页缓存
+func (in *InputFile) Read(p []byte) (int, error) {
+	n, err := in.ReadAt(p, in.pos)
+	in.pos += int64(n)
+	if in.hints.DropCache && in.pos-in.dropped >= dropCacheStep {
+		fadvise(in.f, in.dropped, in.pos-in.dropped, adviseDontNeed)
+		in.dropped = in.pos
+	}
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// ReadAt 实现 io.ReaderAt，可并发调用。O_DIRECT 时按对齐的块读入缓冲区再复制
+func (in *InputFile) ReadAt(p []byte, off int64) (int, error) {
+	if !in.direct {
+		return in.f.ReadAt(p, off)
+	}
+	bufp := in.bufs.Get().(*[]byte)
+	defer in.bufs.Put(bufp)
+	buf := *bufp
+	total := 0
+	for total < len(p) {
+		start := (off + int64(total)) &^ (directAlign - 1)
+		skip := int(off + int64(total) - start)
+		m, err := in.f.ReadAt(buf, start)
+		if m > skip {
+			total += copy(p[total:], buf[skip:m])
+		}
+		if err != nil || m < len(buf) {
+			if total < len(p) {
+				if err == nil || errors.Is(err, io.EOF) {
+					err = io.EOF
+				}
+				return total, err
+			}
+			break
+		}
+	}
+	return total, nil
+}
+
+// Close 关闭文件，按 DropCache 释放整个文件的页缓存
+func (in *InputFile) Close() error {
+	if in.hints.DropCache {
+		fadvise(in.f, 0, 0, adviseDontNeed)
+	}
+	return in.f.Close()
+}
+
+// ReadFileHinted 与 os.ReadFile 相同，但按 IO 提示读取，读完后按 DropCache 释放页缓存
+func ReadFileHinted(path string, hints IOHints) ([]byte, error) {
+	in, err := OpenInput(path, hints)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	var size int
+	if info, err := in.Stat(); err == nil {
+		size = int(info.Size())
+	}
+	data := make([]byte, 0, size)
+	buf := make([]byte, hints.ReadBufferSize())
+	for {
+		n, err := in.Read(buf)
+		data = append(data, buf[:n]...)
+		if err == io.EOF {
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// alignedBuffer 分配起始地址按 directAlign 对齐的缓冲区
+func alignedBuffer(size int) []byte {
+	buf := make([]byte, size+directAlign)
+	shift := int(uintptr(unsafe.Pointer(unsafe.SliceData(buf))) & (directAlign - 1))
+	if shift != 0 {
+		shift = directAlign - shift
+	}
+	return buf[shift : shift+size : shift+size]
+}
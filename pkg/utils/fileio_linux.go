@@ -0,0 +1,24 @@
+//go:build linux
+
+package utils
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	adviseSequential = unix.FADV_SEQUENTIAL
+	adviseDontNeed   = unix.FADV_DONTNEED
+)
+
+// openDirect 以 O_DIRECT 只读打开文件，文件系统不支持时返回错误
+func openDirect(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDONLY|unix.O_DIRECT, 0)
+}
+
+// fadvise 向内核提示文件 [off, off+n) 的访问方式，n 为 0 表示到文件末尾；提示失败不影响读取
+func fadvise(f *os.File, off, n int64, advice int) {
+	unix.Fadvise(int(f.Fd()), off, n, advice)
+}
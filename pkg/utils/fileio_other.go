@@ -0,0 +1,21 @@
+//go:build !linux
+
+package utils
+
+import (
+	"errors"
+	"os"
+)
+
+const (
+	adviseSequential = iota
+	adviseDontNeed
+)
+
+// openDirect 平台不支持 O_DIRECT，使用普通读取
+func openDirect(path string) (*os.File, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// fadvise 平台没有 posix_fadvise，忽略提示
+func fadvise(f *os.File, off, n int64, advice int) {}
@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"bindiff/types"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"lukechampine.com/blake3"
+)
+
+// hashAlgorithmNames 哈希算法名称
+var hashAlgorithmNames = map[types.HashAlgorithm]string{
+	types.HASH_SHA256:   "sha256",
+	types.HASH_BLAKE3:   "blake3",
+	types.HASH_XXHASH64: "xxhash",
+}
+
+// ParseHashAlgorithm 解析哈希算法名称（sha256、blake3、xxhash）
+func ParseHashAlgorithm(name string) (types.HashAlgorithm, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return types.HASH_SHA256, nil
+	}
+	for algo, algoName := range hashAlgorithmNames {
+		if algoName == name {
+			return algo, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported hash algorithm: %s", name)
+}
+
+// HashAlgorithmName 返回哈希算法名称
+func HashAlgorithmName(algo types.HashAlgorithm) string {
+	if name, ok := hashAlgorithmNames[algo]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", algo)
+}
+
+// HashSize 返回哈希算法的摘要长度，未知算法返回 0
+func HashSize(algo types.HashAlgorithm) int {
+	switch algo {
+	case types.HASH_SHA256, types.HASH_BLAKE3:
+		return 32
+	case types.HASH_XXHASH64:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// NewHasher 创建指定算法的哈希器
+func NewHasher(algo types.HashAlgorithm) (hash.Hash, error) {
+	switch algo {
+	case types.HASH_SHA256:
+		return sha256.New(), nil
+	case types.HASH_BLAKE3:
+		return blake3.New(32, nil), nil
+	case types.HASH_XXHASH64:
+		return xxhash.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm: %d", algo)
+	}
+}
+
+// ComputeHashWith 使用指定算法计算数据哈希
+func ComputeHashWith(algo types.HashAlgorithm, data []byte) ([]byte, error) {
+	hasher, err := NewHasher(algo)
+	if err != nil {
+		return nil, err
+	}
+	hasher.Write(data)
+	return hasher.Sum(nil), nil
+}
+
+// HashFile 使用指定算法计算文件哈希
+func HashFile(path string, algo types.HashAlgorithm) ([]byte, error) {
+	hasher, err := NewHasher(algo)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(hasher, file); err != nil {
+		return nil, fmt.Errorf("failed to compute hash for %s: %w", path, err)
+	}
+	return hasher.Sum(nil), nil
+}
+
+// PendingHash 在后台协程中计算的哈希
+type PendingHash struct {
+	done chan struct{}
+	sum  []byte
+	err  error
+}
+
+// HashAsync 在后台协程中计算 data 的哈希，调用方可同时进行差分或应用等工作，随后以 Wait 取得结果。
+// 计算完成前 data 不能被修改
+func HashAsync(algo types.HashAlgorithm, data []byte) *PendingHash {
+	p := &PendingHash{done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		p.sum, p.err = ComputeHashWith(algo, data)
+	}()
+	return p
+}
+
+// Wait 等待计算完成并返回哈希
+func (p *PendingHash) Wait() ([]byte, error) {
+	<-p.done
+	return p.sum, p.err
+}
+
+const (
+	// hashBufferSize HashWriter 每次交给后台协程的数据量
+	hashBufferSize = 256 * 1024
+	// hashBuffers HashWriter 轮转使用的缓冲区个数
+	hashBuffers = 4
+)
+
+// HashWriter 在后台协程中计算写入数据的哈希：Write 只把数据复制到缓冲区，
+// 哈希计算与写入方的 IO 重叠。使用完毕后调用 Sum 或 Close
+type HashWriter struct {
+	hasher hash.Hash
+	buf    []byte
+	queue  chan []byte
+	free   chan []byte
+	done   chan struct{}
+	closed bool
+}
+
+// NewHashWriter 创建指定算法的后台哈希写入器
+func NewHashWriter(algo types.HashAlgorithm) (*HashWriter, error) {
+	hasher, err := NewHasher(algo)
+	if err != nil {
+		return nil, err
+	}
+	w := &HashWriter{
+		hasher: hasher,
+		queue:  make(chan []byte, hashBuffers),
+		free:   make(chan []byte, hashBuffers),
+		done:   make(chan struct{}),
+	}
+	for i := 0; i < hashBuffers; i++ {
+		w.free <- make([]byte, 0, hashBufferSize)
+	}
+	go func() {
+		defer close(w.done)
+		for b := range w.queue {
+			w.hasher.Write(b)
+			w.free <- b[:0]
+		}
+	}()
+	return w, nil
+}
+
+// Write 实现 io.Writer，缓冲区都在等待计算时阻塞
+func (w *HashWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if w.buf == nil {
+			w.buf = <-w.free
+		}
+		k := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf, p = w.buf[:len(w.buf)+k], p[k:]
+		if len(w.buf) == cap(w.buf) {
+			w.queue <- w.buf
+			w.buf = nil
+		}
+	}
+	return n, nil
+}
+
+// Sum 等待已写入的数据计算完成并返回哈希，之后不能再写入
+func (w *HashWriter) Sum() []byte {
+	w.Close()
+	return w.hasher.Sum(nil)
+}
+
+// Close 提交剩余数据并等待后台协程结束，可重复调用
+func (w *HashWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if len(w.buf) > 0 {
+		w.queue <- w.buf
+		w.buf = nil
+	}
+	close(w.queue)
+	<-w.done
+	return nil
+}
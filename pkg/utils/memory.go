@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// DefaultMemorySampleInterval TrackMemory 默认的采样间隔
+const DefaultMemorySampleInterval = 50 * time.Millisecond
+
+// MemoryPeak 一段时间内观察到的内存峰值（字节）
+type MemoryPeak struct {
+	// HeapBytes Go 堆上正在使用的内存（runtime.MemStats.HeapAlloc），含输入数据
+	HeapBytes uint64 `json:"heap_bytes"`
+	// RSSBytes 进程的常驻内存；平台不支持时为 Go 运行时从系统获得的内存（MemStats.Sys）
+	RSSBytes uint64 `json:"rss_bytes"`
+}
+
+// MemoryTracker 在后台定期采样内存，记录峰值
+type MemoryTracker struct {
+	mu   sync.Mutex
+	peak MemoryPeak
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// TrackMemory 立即采样一次并开始按 interval（不大于 0 时为 DefaultMemorySampleInterval）采样，
+// 用完后调用 Stop。采样间隔内的短暂峰值可能被漏掉，结果是下限
+func TrackMemory(interval time.Duration) *MemoryTracker {
+	if interval <= 0 {
+		interval = DefaultMemorySampleInterval
+	}
+	t := &MemoryTracker{stop: make(chan struct{}), done: make(chan struct{})}
+	t.sample()
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.sample()
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// sample 读取当前内存并更新峰值
+func (t *MemoryTracker) sample() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	rss, ok := processRSS()
+	if !ok {
+		rss = stats.Sys
+	}
+	t.mu.Lock()
+	t.peak.HeapBytes = max(t.peak.HeapBytes, stats.HeapAlloc)
+	t.peak.RSSBytes = max(t.peak.RSSBytes, rss)
+	t.mu.Unlock()
+}
+
+// Peak 返回到目前为止的峰值
+func (t *MemoryTracker) Peak() MemoryPeak {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.peak
+}
+
+// Stop 最后采样一次后停止采样并返回峰值，可重复调用
+func (t *MemoryTracker) Stop() MemoryPeak {
+	t.once.Do(func() {
+		close(t.stop)
+		<-t.done
+		t.sample()
+	})
+	return t.Peak()
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+)
+
+// processRSS 从 /proc/self/statm 读取进程的常驻内存
+func processRSS() (uint64, bool) {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, false
+	}
+	fields := bytes.Fields(data)
+	if len(fields) < 2 {
+		return 0, false
+	}
+	pages, err := strconv.ParseUint(string(fields[1]), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return pages * uint64(os.Getpagesize()), true
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package utils
+
+// processRSS 当前平台不读取常驻内存，由调用方回退到 Go 运行时的统计
+func processRSS() (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"unsafe"
+)
+
+// mmapThreshold 小于该大小的文件直接读入内存，映射的开销不值得
+const mmapThreshold = 64 << 10
+
+// MappedFile 只读打开的输入文件：较大的文件以私有写时复制方式映射到内存，
+// 由操作系统按需调页，不占用进程堆内存；映射失败或平台不支持时退回读入内存
+type MappedFile struct {
+	data   []byte
+	mapped bool
+}
+
+// MapFile 打开并映射文件，使用完毕后调用 Close。映射是私有的，
+// 对 Bytes 的修改不会写回文件；映射期间文件被截断时访问会触发 SIGBUS
+func MapFile(path string) (*MappedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if info.Mode().IsRegular() && size >= mmapThreshold && size <= math.MaxInt {
+		if data, err := mmapFile(f, int(size)); err == nil {
+			return &MappedFile{data: data, mapped: true}, nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MappedFile{data: data}, nil
+}
+
+// Bytes 返回文件内容，Close 之后不能再访问
+func (m *MappedFile) Bytes() []byte {
+	return m.data
+}
+
+// Mapped 报告文件是否以内存映射方式打开
+func (m *MappedFile) Mapped() bool {
+	return m.mapped
+}
+
+// Detach 返回在 Close 之后仍可使用的 b：b 指向映射区域时复制一份
+func (m *MappedFile) Detach(b []byte) []byte {
+	if !m.mapped || len(b) == 0 || len(m.data) == 0 {
+		return b
+	}
+	start := uintptr(unsafe.Pointer(unsafe.SliceData(m.data)))
+	p := uintptr(unsafe.Pointer(unsafe.SliceData(b)))
+	if p >= start && p < start+uintptr(len(m.data)) {
+		return bytes.Clone(b)
+	}
+	return b
+}
+
+// Close 解除映射，可重复调用
+func (m *MappedFile) Close() error {
+	data, mapped := m.data, m.mapped
+	m.data, m.mapped = nil, false
+	if !mapped {
+		return nil
+	}
+	return munmapFile(data)
+}
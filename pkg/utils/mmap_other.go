@@ -0,0 +1,18 @@
+//go:build !unix && !windows
+
+package utils
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile 平台不支持内存映射，由调用方读入内存
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// munmapFile 平台不支持内存映射
+func munmapFile(data []byte) error {
+	return nil
+}
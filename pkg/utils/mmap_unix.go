@@ -0,0 +1,18 @@
+//go:build unix
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile 以 MAP_PRIVATE 映射整个文件，可写的页在写入时复制
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE)
+}
+
+// munmapFile 解除映射
+func munmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,32 @@
+//go:build windows
+
+package utils
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// mmapFile 以写时复制（FILE_MAP_COPY）视图映射整个文件
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	h, err := windows.CreateFileMapping(windows.Handle(f.Fd()), nil, windows.PAGE_WRITECOPY, 0, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	// 视图保持映射对象有效，句柄可以立即关闭
+	defer windows.CloseHandle(h)
+	addr, err := windows.MapViewOfFile(h, windows.FILE_MAP_COPY, 0, 0, uintptr(size))
+	if err != nil {
+		return nil, err
+	}
+	// 经指针转换取得地址，避免 uintptr 直接转 unsafe.Pointer
+	ptr := *(*unsafe.Pointer)(unsafe.Pointer(&addr))
+	return unsafe.Slice((*byte)(ptr), size), nil
+}
+
+// munmapFile 解除映射
+func munmapFile(data []byte) error {
+	return windows.UnmapViewOfFile(uintptr(unsafe.Pointer(&data[0])))
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"os"
+	"sort"
+	"sync"
+)
+
+// partialFiles 正在写入、尚未完成的文件（SafeWrite 的临时文件与直接写入的输出），值为登记次数
+var partialFiles = struct {
+	sync.Mutex
+	paths map[string]int
+}{paths: make(map[string]int)}
+
+// TrackPartial 登记一个正在写入的文件，进程被中断时由 RemovePartialFiles 删除。
+// 写入完成（或已自行清理）后调用返回的函数取消登记
+func TrackPartial(path string) (done func()) {
+	partialFiles.Lock()
+	partialFiles.paths[path]++
+	partialFiles.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			partialFiles.Lock()
+			defer partialFiles.Unlock()
+			if partialFiles.paths[path]--; partialFiles.paths[path] <= 0 {
+				delete(partialFiles.paths, path)
+			}
+		})
+	}
+}
+
+// RemovePartialFiles 删除所有登记中的文件并清空登记，返回实际删除的路径。
+// 供收到中断信号、进程退出前调用，不应与仍在进行的写入同时使用
+func RemovePartialFiles() []string {
+	partialFiles.Lock()
+	defer partialFiles.Unlock()
+
+	var removed []string
+	for path := range partialFiles.paths {
+		if err := os.Remove(path); err == nil {
+			removed = append(removed, path)
+		}
+	}
+	partialFiles.paths = make(map[string]int)
+	sort.Strings(removed)
+	return removed
+}
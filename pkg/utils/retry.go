@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// RetryOptions RetryWithContext 的参数，零值使用默认值
+type RetryOptions struct {
+	// Attempts 最多尝试的次数（含第一次），0 使用 4
+	Attempts int
+	// Delay 第一次重试前的基础等待，之后每次加倍；0 使用 200ms
+	Delay time.Duration
+	// MaxDelay 单次等待的上限，0 使用 10s
+	MaxDelay time.Duration
+	// IsRetryable 判断错误是否值得重试，nil 时使用 IsTransient
+	IsRetryable func(error) bool
+	// OnRetry 每次等待前调用，attempt 为刚失败的尝试序号（从 1 开始）
+	OnRetry func(attempt int, err error, wait time.Duration)
+}
+
+// 默认的重试参数
+const (
+	defaultRetryAttempts = 4
+	defaultRetryDelay    = 200 * time.Millisecond
+	defaultRetryMaxDelay = 10 * time.Second
+)
+
+// Retry 重试 fn，每个错误都重试，两次尝试之间等待 delay 并指数退避。
+// 需要取消或只重试暂时性错误时使用 RetryWithContext
+func Retry(attempts int, delay time.Duration, fn func() error) error {
+	return RetryWithContext(context.Background(), RetryOptions{
+		Attempts:    max(attempts, 1),
+		Delay:       delay,
+		IsRetryable: func(error) bool { return true },
+	}, func(context.Context) error { return fn() })
+}
+
+// RetryWithContext 调用 fn 直到成功、错误不可重试、次数用尽或 ctx 取消。
+// 两次尝试之间按指数退避等待，实际等待时间在退避值的一半到全部之间随机（抖动），避免多个客户端同时重试。
+// 不可重试的错误原样返回；次数用尽时返回包装最后一个错误的错误；等待中 ctx 取消时返回包装 ctx.Err() 的错误
+func RetryWithContext(ctx context.Context, opts RetryOptions, fn func(ctx context.Context) error) error {
+	attempts := opts.Attempts
+	if attempts <= 0 {
+		attempts = defaultRetryAttempts
+	}
+	delay := opts.Delay
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+	maxDelay := opts.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+	retryable := opts.IsRetryable
+	if retryable == nil {
+		retryable = IsTransient
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+		if attempt >= attempts {
+			return fmt.Errorf("failed after %d attempts, last error: %w", attempts, err)
+		}
+
+		wait := min(delay, maxDelay)
+		wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+		if opts.OnRetry != nil {
+			opts.OnRetry(attempt, err, wait)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// transientErrnos 可能在稍后成功的系统调用错误
+var transientErrnos = []syscall.Errno{
+	syscall.ECONNREFUSED, syscall.ECONNRESET, syscall.ECONNABORTED, syscall.EPIPE,
+	syscall.ETIMEDOUT, syscall.EINTR, syscall.EAGAIN, syscall.EBUSY,
+}
+
+// StatusError HTTP 请求返回了非预期的状态码
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	// Status 如 "503 Service Unavailable"
+	Status string
+}
+
+// NewStatusError 由响应创建 StatusError
+func NewStatusError(resp *http.Response) *StatusError {
+	e := &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	if resp.Request != nil {
+		e.Method, e.URL = resp.Request.Method, resp.Request.URL.String()
+	}
+	return e
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Method, e.URL, e.Status)
+}
+
+// Temporary 报告状态码是否表示可以稍后重试：408、425、429 与 5xx（501 除外）
+func (e *StatusError) Temporary() bool {
+	return RetryableStatus(e.StatusCode)
+}
+
+// RetryableStatus 报告 HTTP 状态码是否表示可以稍后重试
+func RetryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+		return true
+	case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+		return false
+	}
+	return code >= 500 && code <= 599
+}
+
+// permanentError 标记为不可重试的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 把 err 标记为不可重试，IsTransient 对其返回 false
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsTransient 报告 err 是否可能是暂时性的网络或 IO 故障：超时、连接被拒绝或重置、
+// 响应中途断开、EINTR/EAGAIN/EBUSY，以及可重试的 HTTP 状态码。取消、校验失败等其他错误不重试
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var perm *permanentError
+	if errors.As(err, &perm) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Temporary()
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	for _, errno := range append(transientErrnos, platformTransientErrnos...) {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	// 连接在收到响应前被关闭
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && errors.Is(urlErr.Err, io.EOF)
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package utils
+
+import "syscall"
+
+// platformTransientErrnos 平台特有的暂时性错误
+var platformTransientErrnos []syscall.Errno
@@ -0,0 +1,11 @@
+//go:build windows
+
+package utils
+
+import "syscall"
+
+// platformTransientErrnos 杀毒软件、索引服务等短暂打开文件时 Windows 返回的错误
+var platformTransientErrnos = []syscall.Errno{
+	32, // ERROR_SHARING_VIOLATION
+	33, // ERROR_LOCK_VIOLATION
+}
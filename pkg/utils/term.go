@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
+// IsTerminal 报告 f 是否连接到终端。重定向到文件、管道或 CI 日志时为 false
+func IsTerminal(f *os.File) bool {
+	return f != nil && term.IsTerminal(int(f.Fd()))
+}
+
+// ColorEnabled 报告是否可以向 f 输出颜色：f 是终端且没有设置 NO_COLOR 环境变量（https://no-color.org）
+func ColorEnabled(f *os.File) bool {
+	return os.Getenv("NO_COLOR") == "" && IsTerminal(f)
+}
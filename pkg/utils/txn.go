@@ -0,0 +1,333 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// txnJournalPrefix 事务日志文件名前缀
+	txnJournalPrefix = ".txn-"
+	// txnJournalSuffix 事务日志文件名后缀
+	txnJournalSuffix = ".journal"
+)
+
+// ErrTransactionDone 事务已提交或已回滚
+var ErrTransactionDone = errors.New("transaction already finished")
+
+// txnEntry 事务中的一个文件
+type txnEntry struct {
+	Target string `json:"target"`
+	Temp   string `json:"temp"`
+	Backup string `json:"backup"`
+	// Existed 提交前目标文件已存在，提交时先移到 Backup
+	Existed bool `json:"existed"`
+}
+
+// txnJournal 事务日志：提交开始前写入，Committed 为 true 后重命名全部完成
+type txnJournal struct {
+	ID        string     `json:"id"`
+	Committed bool       `json:"committed"`
+	Entries   []txnEntry `json:"entries"`
+}
+
+// Transaction 暂存多个文件的写入，Commit 时一起替换目标文件：要么全部生效，要么全部回滚。
+// 写入先落到目标旁的临时文件，提交前把文件清单写入 dir 下的事务日志，
+// 进程在提交中途退出时由 RecoverTransactions 根据日志回滚或完成。不可并发使用
+type Transaction struct {
+	id      string
+	journal string
+	entries []txnEntry
+	index   map[string]int
+	untrack []func()
+	done    bool
+}
+
+// NewTransaction 创建事务，事务日志写在 dir 下（不存在时在提交时创建）
+func NewTransaction(dir string) *Transaction {
+	var id [6]byte
+	rand.Read(id[:])
+	t := &Transaction{id: hex.EncodeToString(id[:]), index: make(map[string]int)}
+	t.journal = filepath.Join(dir, txnJournalPrefix+t.id+txnJournalSuffix)
+	return t
+}
+
+// Len 返回已暂存的文件数
+func (t *Transaction) Len() int {
+	return len(t.entries)
+}
+
+// Write 暂存 filename 的新内容
+func (t *Transaction) Write(filename string, data []byte) error {
+	return t.WriteFunc(filename, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// WriteFunc 暂存 filename 的新内容，由 write 写入临时文件。同一文件多次暂存时以最后一次为准
+func (t *Transaction) WriteFunc(filename string, write func(w io.Writer) error) (err error) {
+	if t.done {
+		return ErrTransactionDone
+	}
+	if err := EnsureDir(filepath.Dir(filename)); err != nil {
+		return err
+	}
+
+	base := filename + ".txn-" + t.id
+	entry := txnEntry{Target: filename, Temp: base + ".tmp", Backup: base + ".old"}
+	t.untrack = append(t.untrack, TrackPartial(entry.Temp))
+	f, err := os.OpenFile(entry.Temp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("failed to write temp file: %w", cerr)
+		}
+		if err != nil {
+			os.Remove(entry.Temp)
+			if i, ok := t.index[filename]; ok {
+				t.entries = append(t.entries[:i], t.entries[i+1:]...)
+				t.reindex()
+			}
+		}
+	}()
+
+	if err := write(f); err != nil {
+		return err
+	}
+	if !skipSync.Load() {
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("failed to sync temp file: %w", err)
+		}
+	}
+	if _, ok := t.index[filename]; !ok {
+		t.index[filename] = len(t.entries)
+		t.entries = append(t.entries, entry)
+	}
+	return nil
+}
+
+// ReadFile 读取 filename 暂存的内容，未暂存或事务已结束时读取目标文件
+func (t *Transaction) ReadFile(filename string) ([]byte, error) {
+	if i, ok := t.index[filename]; ok && !t.done {
+		return os.ReadFile(t.entries[i].Temp)
+	}
+	return os.ReadFile(filename)
+}
+
+// reindex 重建目标路径到清单位置的索引
+func (t *Transaction) reindex() {
+	t.index = make(map[string]int, len(t.entries))
+	for i, e := range t.entries {
+		t.index[e.Target] = i
+	}
+}
+
+// Commit 用暂存的内容替换全部目标文件。任一步失败时撤销已完成的替换、删除临时文件并返回错误
+func (t *Transaction) Commit() (err error) {
+	if t.done {
+		return ErrTransactionDone
+	}
+	t.done = true
+	defer t.finish()
+	if len(t.entries) == 0 {
+		return nil
+	}
+
+	for i := range t.entries {
+		e := &t.entries[i]
+		if _, err := os.Lstat(e.Target); err == nil {
+			e.Existed = true
+		} else if !errors.Is(err, os.ErrNotExist) {
+			t.discard()
+			return fmt.Errorf("failed to stat %s: %w", e.Target, err)
+		}
+	}
+	j := txnJournal{ID: t.id, Entries: t.entries}
+	if err := writeJournal(t.journal, j); err != nil {
+		t.discard()
+		return err
+	}
+
+	for i, e := range t.entries {
+		if err := commitEntry(e); err != nil {
+			if rerr := rollbackEntries(t.entries[:i+1]); rerr != nil {
+				return fmt.Errorf("failed to commit %s: %w (rollback failed, journal kept at %s: %v)", e.Target, err, t.journal, rerr)
+			}
+			os.Remove(t.journal)
+			return fmt.Errorf("failed to commit %s: %w", e.Target, err)
+		}
+	}
+	if !skipSync.Load() {
+		for _, dir := range entryDirs(t.entries) {
+			if err := SyncDir(dir); err != nil {
+				rollbackEntries(t.entries)
+				os.Remove(t.journal)
+				return err
+			}
+		}
+	}
+
+	// 日志标记为已提交之后，中断的进程在恢复时完成提交而不是回滚
+	j.Committed = true
+	if err := writeJournal(t.journal, j); err != nil {
+		rollbackEntries(t.entries)
+		os.Remove(t.journal)
+		return err
+	}
+	finishEntries(t.entries)
+	return removeJournal(t.journal)
+}
+
+// Rollback 放弃暂存的写入，目标文件保持不变。已结束的事务上调用时什么也不做
+func (t *Transaction) Rollback() error {
+	if t.done {
+		return nil
+	}
+	t.done = true
+	defer t.finish()
+	t.discard()
+	return nil
+}
+
+// discard 删除全部临时文件
+func (t *Transaction) discard() {
+	for _, e := range t.entries {
+		os.Remove(e.Temp)
+	}
+}
+
+// finish 取消临时文件的中断登记
+func (t *Transaction) finish() {
+	for _, done := range t.untrack {
+		done()
+	}
+	t.untrack = nil
+}
+
+// commitEntry 把原文件移到备份位置，再把临时文件重命名为目标文件
+func commitEntry(e txnEntry) error {
+	if e.Existed {
+		if err := os.Rename(e.Target, e.Backup); err != nil {
+			return err
+		}
+	}
+	return os.Rename(e.Temp, e.Target)
+}
+
+// rollbackEntries 逆序撤销 entries 的替换：恢复备份，删除新建的目标文件与临时文件。
+// 只依据磁盘上的文件判断每一步是否已完成，因此也可用于恢复中断的提交
+func rollbackEntries(entries []txnEntry) error {
+	var errs []error
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		_, tempErr := os.Lstat(e.Temp)
+		switch _, err := os.Lstat(e.Backup); {
+		case err == nil:
+			if err := os.Rename(e.Backup, e.Target); err != nil {
+				errs = append(errs, fmt.Errorf("failed to restore %s: %w", e.Target, err))
+			}
+		case !e.Existed && errors.Is(tempErr, os.ErrNotExist):
+			// 临时文件已被重命名为目标文件
+			if err := os.Remove(e.Target); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("failed to remove %s: %w", e.Target, err))
+			}
+		}
+		os.Remove(e.Temp)
+	}
+	return errors.Join(errs...)
+}
+
+// finishEntries 删除已提交事务的备份与残留的临时文件
+func finishEntries(entries []txnEntry) {
+	for _, e := range entries {
+		os.Remove(e.Backup)
+		os.Remove(e.Temp)
+	}
+}
+
+// entryDirs 返回目标文件所在的目录（去重、已排序）
+func entryDirs(entries []txnEntry) []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, e := range entries {
+		if dir := filepath.Dir(e.Target); !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// writeJournal 原子写入事务日志
+func writeJournal(path string, j txnJournal) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("failed to encode transaction journal: %w", err)
+	}
+	if err := SafeWrite(path, data); err != nil {
+		return fmt.Errorf("failed to write transaction journal: %w", err)
+	}
+	return nil
+}
+
+// removeJournal 删除事务日志
+func removeJournal(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove transaction journal: %w", err)
+	}
+	if !skipSync.Load() {
+		return SyncDir(filepath.Dir(path))
+	}
+	return nil
+}
+
+// RecoverTransactions 处理 dir 下中断的事务：已标记提交的完成提交，其余回滚。
+// 返回处理的事务数；dir 不存在时返回 0
+func RecoverTransactions(dir string) (int, error) {
+	names, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	recovered := 0
+	for _, de := range names {
+		name := de.Name()
+		if de.IsDir() || !strings.HasPrefix(name, txnJournalPrefix) || !strings.HasSuffix(name, txnJournalSuffix) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return recovered, fmt.Errorf("failed to read transaction journal: %w", err)
+		}
+		var j txnJournal
+		if err := json.Unmarshal(data, &j); err != nil {
+			return recovered, fmt.Errorf("invalid transaction journal %s: %w", path, err)
+		}
+		if j.Committed {
+			finishEntries(j.Entries)
+		} else if err := rollbackEntries(j.Entries); err != nil {
+			return recovered, fmt.Errorf("failed to roll back transaction %s: %w", j.ID, err)
+		}
+		if err := removeJournal(path); err != nil {
+			return recovered, err
+		}
+		recovered++
+	}
+	return recovered, nil
+}
@@ -1,70 +1,31 @@
 package utils
 
 import (
+	"bindiff/pkg/progress"
+	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
-
-	"github.com/schollz/progressbar/v3"
 )
 
 // ProgressBar 进度条管理器
-type ProgressBar struct {
-	bar     *progressbar.ProgressBar
-	enabled bool
-}
+//
+// Deprecated: 使用 progress.ProgressBar，或向 core 的选项传入 core.ProgressReporter。
+type ProgressBar = progress.ProgressBar
 
 // NewProgressBar 创建进度条
+//
+// Deprecated: 使用 progress.NewProgressBar，或向 core 的选项传入 core.ProgressReporter。
 func NewProgressBar(max int64, description string, enabled bool) *ProgressBar {
-	if !enabled {
-		return &ProgressBar{enabled: false}
-	}
-
-	bar := progressbar.NewOptions64(max,
-		progressbar.OptionSetDescription(description),
-		progressbar.OptionSetWriter(os.Stderr),
-		progressbar.OptionShowBytes(true),
-		progressbar.OptionSetWidth(10),
-		progressbar.OptionThrottle(65*time.Millisecond),
-		progressbar.OptionShowCount(),
-		progressbar.OptionOnCompletion(func() {
-			fmt.Fprint(os.Stderr, "\n")
-		}),
-		progressbar.OptionSpinnerType(14),
-		progressbar.OptionFullWidth(),
-		progressbar.OptionSetRenderBlankState(true),
-	)
-
-	return &ProgressBar{
-		bar:     bar,
-		enabled: true,
-	}
-}
-
-// Add 更新进度
-func (p *ProgressBar) Add(num int) {
-	if p.enabled && p.bar != nil {
-		p.bar.Add(num)
-	}
-}
-
-// Set 设置进度
-func (p *ProgressBar) Set(num int) {
-	if p.enabled && p.bar != nil {
-		p.bar.Set(num)
-	}
-}
-
-// Finish 完成进度条
-func (p *ProgressBar) Finish() {
-	if p.enabled && p.bar != nil {
-		p.bar.Finish()
-	}
+	return progress.NewProgressBar(max, description, enabled)
 }
 
 // FileInfo 文件信息结构
@@ -109,51 +70,145 @@ func EnsureDir(dir string) error {
 	return nil
 }
 
+// skipSync 为 true 时 SafeWrite 系列函数不刷盘，见 SetDurableWrites
+var skipSync atomic.Bool
+
+// SetDurableWrites 设置 SafeWrite 系列函数是否在报告成功前刷盘（默认开启）：
+// 重命名前 fsync 临时文件，重命名后 fsync 所在目录，崩溃或断电后不会留下空文件或丢失重命名。
+// 关闭后写入更快，但刚写入的文件在系统崩溃时可能丢失
+func SetDurableWrites(on bool) {
+	skipSync.Store(!on)
+}
+
 // SafeWrite 安全写入文件（原子操作）
 func SafeWrite(filename string, data []byte) error {
-	dir := filepath.Dir(filename)
-	if err := EnsureDir(dir); err != nil {
+	return SafeWriteFunc(filename, func(w io.Writer) error {
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("failed to write temp file: %w", err)
+		}
+		return nil
+	})
+}
+
+// SafeWriteFunc 与 SafeWrite 相同，但由 write 把内容流式写入临时文件，
+// write 返回错误时删除临时文件并原样返回该错误
+func SafeWriteFunc(filename string, write func(w io.Writer) error) (err error) {
+	if err := EnsureDir(filepath.Dir(filename)); err != nil {
 		return err
 	}
 
-	// 写入临时文件
 	tmpFile := filename + ".tmp"
-	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+	defer TrackPartial(tmpFile)()
+	f, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
 		return fmt.Errorf("failed to write temp file: %w", err)
 	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmpFile)
+		}
+	}()
 
-	// 原子性重命名
-	if err := os.Rename(tmpFile, filename); err != nil {
-		os.Remove(tmpFile) // 清理临时文件
-		return fmt.Errorf("failed to rename temp file: %w", err)
+	if err := write(f); err != nil {
+		return err
 	}
-
-	return nil
+	return commitTemp(f, filename)
 }
 
-// BackupFile 备份文件
-func BackupFile(filename string) error {
-	backupName := filename + ".backup." + time.Now().Format("20060102-150405")
+// SafeWriteSparse 与 SafeWrite 相同，但跳过全零的 blockSize 字节块，
+// 在支持的文件系统上生成稀疏文件（如磁盘镜像）
+func SafeWriteSparse(filename string, data []byte, blockSize int) (err error) {
+	if blockSize <= 0 {
+		return SafeWrite(filename, data)
+	}
+	if err := EnsureDir(filepath.Dir(filename)); err != nil {
+		return err
+	}
 
-	src, err := os.Open(filename)
+	tmpFile := filename + ".tmp"
+	defer TrackPartial(tmpFile)()
+	f, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to open source file: %w", err)
+		return fmt.Errorf("failed to write temp file: %w", err)
 	}
-	defer src.Close()
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmpFile)
+		}
+	}()
 
-	dst, err := os.Create(backupName)
-	if err != nil {
-		return fmt.Errorf("failed to create backup file: %w", err)
+	for off := 0; off < len(data); off += blockSize {
+		end := off + blockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		if isZeroBlock(data[off:end]) {
+			continue
+		}
+		if _, err := f.WriteAt(data[off:end], int64(off)); err != nil {
+			return fmt.Errorf("failed to write temp file: %w", err)
+		}
+	}
+	// 末尾的空洞由 Truncate 补齐长度
+	if err := f.Truncate(int64(len(data))); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
 	}
-	defer dst.Close()
+	return commitTemp(f, filename)
+}
 
-	if _, err := io.Copy(dst, src); err != nil {
-		return fmt.Errorf("failed to copy file data: %w", err)
+// commitTemp 刷盘并关闭临时文件 f，重命名为 filename 后刷新所在目录使重命名持久化
+func commitTemp(f *os.File, filename string) error {
+	durable := !skipSync.Load()
+	if durable {
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("failed to sync temp file: %w", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
 	}
+	// 目标文件被其他进程（杀毒软件、索引服务）短暂占用时重命名会暂时失败
+	err := RetryWithContext(context.Background(), RetryOptions{Attempts: 3, Delay: 50 * time.Millisecond}, func(context.Context) error {
+		return os.Rename(f.Name(), filename)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	if durable {
+		return SyncDir(filepath.Dir(filename))
+	}
+	return nil
+}
 
+// SyncDir 刷新目录项，使其中新建、重命名或删除的文件在崩溃后仍然可见。
+// Windows 不支持对目录 fsync，此时直接返回；文件系统不支持时（EINVAL）忽略
+func SyncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to sync directory %s: %w", dir, err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) {
+		return fmt.Errorf("failed to sync directory %s: %w", dir, err)
+	}
 	return nil
 }
 
+// isZeroBlock 判断数据块是否全为零
+func isZeroBlock(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // ComputeHash 计算数据的 SHA256 哈希
 func ComputeHash(data []byte) []byte {
 	hash := sha256.Sum256(data)
@@ -254,26 +309,6 @@ func getStackTrace() []string {
 	return stack
 }
 
-// Retry 重试机制
-func Retry(attempts int, delay time.Duration, fn func() error) error {
-	var lastErr error
-
-	for i := 0; i < attempts; i++ {
-		if err := fn(); err == nil {
-			return nil
-		} else {
-			lastErr = err
-		}
-
-		if i < attempts-1 {
-			time.Sleep(delay)
-			delay *= 2 // 指数退避
-		}
-	}
-
-	return fmt.Errorf("failed after %d attempts, last error: %w", attempts, lastErr)
-}
-
 // TempFile 创建临时文件
 func TempFile(prefix string) (*os.File, error) {
 	return os.CreateTemp("", prefix+"_*.tmp")
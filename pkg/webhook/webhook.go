@@ -0,0 +1,272 @@
+// Package webhook 把服务端任务的生命周期事件以 JSON POST 到配置的地址，请求体以 HMAC-SHA256 签名，
+// 发布流水线无需轮询即可对任务完成或失败作出反应
+package webhook
+
+import (
+	"bindiff/pkg/logger"
+	"bindiff/pkg/utils"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 事件类型
+const (
+	EventQueued    = "job.queued"
+	EventStarted   = "job.started"
+	EventCompleted = "job.completed"
+	EventFailed    = "job.failed"
+)
+
+// 请求头
+const (
+	HeaderEvent     = "X-Bindiff-Event"
+	HeaderDelivery  = "X-Bindiff-Delivery"
+	HeaderTimestamp = "X-Bindiff-Timestamp"
+	// HeaderSignature "sha256=" 后接 HMAC-SHA256(secret, timestamp + "." + body) 的十六进制
+	HeaderSignature = "X-Bindiff-Signature"
+)
+
+const (
+	// DefaultRetries 投递失败时默认的重试次数
+	DefaultRetries = 3
+	// DefaultRetryDelay 第一次重试前的等待时间，之后每次加倍
+	DefaultRetryDelay = time.Second
+	// maxPending 等待投递的事件上限，超出的事件被丢弃
+	maxPending = 1024
+)
+
+var (
+	// ErrSignature 签名缺失或不一致
+	ErrSignature = errors.New("invalid webhook signature")
+	// ErrExpired 时间戳超出允许的范围
+	ErrExpired = errors.New("webhook timestamp out of range")
+)
+
+// Event 任务生命周期事件
+type Event struct {
+	// ID 事件的唯一标识，重试时不变，接收方可据此去重
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// Source 事件来源：rest（serve 的任务队列）或 grpc（同步调用）
+	Source string `json:"source"`
+	JobID  string `json:"job_id"`
+	// OperationID 操作 ID，与服务端日志中的 op_id 及响应的 X-Operation-ID 相同
+	OperationID string `json:"operation_id,omitempty"`
+	// Kind 任务类型：diff 或 apply
+	Kind  string `json:"kind"`
+	Error string `json:"error,omitempty"`
+	// PatchSize diff 任务生成的补丁大小
+	PatchSize int64 `json:"patch_size,omitempty"`
+	// ResultSize 结果（补丁或新文件）的大小
+	ResultSize int64 `json:"result_size,omitempty"`
+	// DurationSeconds 任务的运行时间
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+}
+
+// Options 通知器选项
+type Options struct {
+	// URLs 接收事件的地址，每个事件发送到所有地址
+	URLs []string
+	// Secret 签名密钥，为空时不签名
+	Secret string
+	// Events 只发送这些类型的事件，为空时发送全部
+	Events []string
+	// Retries 投递暂时失败（网络错误、408、429 或 5xx 响应）时的重试次数，0 使用 DefaultRetries，负数不重试；
+	// 其他非 2xx 响应不重试
+	Retries int
+	// RetryDelay 第一次重试前的等待时间，0 使用 DefaultRetryDelay
+	RetryDelay time.Duration
+	// Client 为空时使用超时 10 秒的客户端
+	Client *http.Client
+	// Logger 记录投递失败，nil 时不输出
+	Logger logger.Logger
+}
+
+// Notifier 在后台按顺序投递事件，nil 的 Notifier 忽略所有事件
+type Notifier struct {
+	opts   Options
+	events map[string]bool
+	queue  chan Event
+	done   chan struct{}
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// New 创建通知器并启动投递协程，使用完毕后调用 Close。没有地址时返回 nil
+func New(opts Options) *Notifier {
+	if len(opts.URLs) == 0 {
+		return nil
+	}
+	if opts.Retries == 0 {
+		opts.Retries = DefaultRetries
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = DefaultRetryDelay
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.Logger == nil {
+		opts.Logger = logger.Nop()
+	}
+	n := &Notifier{
+		opts:  opts,
+		queue: make(chan Event, maxPending),
+		done:  make(chan struct{}),
+		stop:  make(chan struct{}),
+	}
+	if len(opts.Events) > 0 {
+		n.events = map[string]bool{}
+		for _, e := range opts.Events {
+			n.events[e] = true
+		}
+	}
+	go n.loop()
+	return n
+}
+
+// Send 排队一个事件，补全 ID 与时间；不阻塞，队列已满时丢弃事件
+func (n *Notifier) Send(e Event) {
+	if n == nil || (n.events != nil && !n.events[e.Type]) {
+		return
+	}
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	select {
+	case <-n.stop:
+	case n.queue <- e:
+	default:
+		n.opts.Logger.Warnf("Webhook queue full, dropping %s event for job %s", e.Type, e.JobID)
+	}
+}
+
+// Close 停止接收事件并等待已排队的事件投递完成，ctx 结束时放弃剩余的事件
+func (n *Notifier) Close(ctx context.Context) error {
+	if n == nil {
+		return nil
+	}
+	n.once.Do(func() { close(n.stop) })
+	select {
+	case <-n.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (n *Notifier) loop() {
+	defer close(n.done)
+	for {
+		select {
+		case e := <-n.queue:
+			n.deliver(e)
+		case <-n.stop:
+			for {
+				select {
+				case e := <-n.queue:
+					n.deliver(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver 把事件发送到所有地址，暂时失败时按指数退避（带抖动）重试
+func (n *Notifier) deliver(e Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		n.opts.Logger.Errorf("Failed to encode webhook event: %v", err)
+		return
+	}
+	for _, url := range n.opts.URLs {
+		err = utils.RetryWithContext(context.Background(), utils.RetryOptions{
+			Attempts: max(n.opts.Retries, 0) + 1,
+			Delay:    n.opts.RetryDelay,
+		}, func(context.Context) error {
+			return n.post(url, e, body)
+		})
+		if err != nil {
+			n.opts.Logger.Warnf("Webhook %s for job %s not delivered to %s: %v", e.Type, e.JobID, url, err)
+		}
+	}
+}
+
+// post 发送一次请求
+func (n *Notifier) post(url string, e Event, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "bindiff-webhook")
+	req.Header.Set(HeaderEvent, e.Type)
+	req.Header.Set(HeaderDelivery, e.ID)
+	req.Header.Set(HeaderTimestamp, ts)
+	if n.opts.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign([]byte(n.opts.Secret), ts, body))
+	}
+	resp, err := n.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return utils.NewStatusError(resp)
+	}
+	return nil
+}
+
+// Sign 返回请求体的签名：sha256=HMAC-SHA256(secret, timestamp + "." + body)
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 供接收方校验请求的签名与时间戳，maxAge 大于 0 时拒绝与当前时间相差更久的请求（防止重放）
+func Verify(secret []byte, timestamp, signature string, body []byte, maxAge time.Duration) error {
+	if maxAge > 0 {
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return ErrExpired
+		}
+		if age := time.Since(time.Unix(ts, 0)); math.Abs(float64(age)) > float64(maxAge) {
+			return ErrExpired
+		}
+	}
+	if !strings.HasPrefix(signature, "sha256=") || !hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body))) {
+		return ErrSignature
+	}
+	return nil
+}
+
+// newID 生成事件 ID
+func newID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
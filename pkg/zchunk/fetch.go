@@ -0,0 +1,230 @@
+package zchunk
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/storage"
+	"bindiff/pkg/utils"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ErrChecksum 块或重建的文件与清单中的 SHA-256 不一致
+var ErrChecksum = errors.New("zchunk checksum mismatch")
+
+// DefaultConcurrency 默认同时下载的块数
+const DefaultConcurrency = 4
+
+// ChunkSource 优先于块目录的块来源（如局域网内的对等节点），返回未压缩的块内容。
+// 返回的内容仍按清单校验，出错或校验失败时回退到块目录
+type ChunkSource interface {
+	GetChunk(ctx context.Context, hash string, size int64) ([]byte, error)
+}
+
+// FetchOptions 重建选项
+type FetchOptions struct {
+	// Client 为空时使用 http.DefaultClient
+	Client *http.Client
+	// Storage 设置后从该后端读取块（键为 ChunkKey），忽略 baseURL
+	Storage storage.Backend
+	// Concurrency 同时下载的块数，不大于 0 时为 DefaultConcurrency
+	Concurrency int
+	// Source 设置后先从该来源获取块
+	Source ChunkSource
+	// Retry 下载一个块失败时的重试参数，零值使用 utils.RetryWithContext 的默认值
+	Retry utils.RetryOptions
+}
+
+// Stats 重建统计
+type Stats struct {
+	Reused     int64 // 从本地文件复用的字节数
+	Downloaded int64 // 从块目录下载的压缩数据字节数
+	Chunks     int   // 下载的块数（含来自 Source 的块）
+	FromSource int64 // 从 Source 获取的字节数
+}
+
+// Fetch 根据清单重建文件：按清单的分块参数切分本地文件 seed，复用哈希相同的块，
+// 其余的块从 baseURL/ChunkKey(hash)（或 opts.Storage）下载并解压。每块与整个文件都以 SHA-256 校验
+func Fetch(ctx context.Context, m *Manifest, baseURL string, seed []byte, opts *FetchOptions) ([]byte, *Stats, error) {
+	if opts == nil {
+		opts = &FetchOptions{}
+	}
+	local := map[string][]byte{}
+	for _, c := range core.Chunk(seed, &core.ChunkOptions{MinSize: m.ChunkMin, AvgSize: m.ChunkAvg, MaxSize: m.ChunkMax}) {
+		sum := sha256.Sum256(c)
+		local[hex.EncodeToString(sum[:])] = c
+	}
+
+	// 清单中重复的块只下载一次
+	stats := &Stats{}
+	var missing []Chunk
+	queued := map[string]bool{}
+	for _, c := range m.Chunks {
+		if data, ok := local[c.Hash]; ok && int64(len(data)) == c.Size {
+			stats.Reused += c.Size
+			continue
+		}
+		if !queued[c.Hash] {
+			queued[c.Hash] = true
+			missing = append(missing, c)
+		}
+	}
+
+	downloaded, fromSource, err := download(ctx, missing, baseURL, opts)
+	if err != nil {
+		return nil, stats, err
+	}
+	for _, c := range missing {
+		if fromSource[c.Hash] {
+			stats.FromSource += c.Size
+		} else {
+			stats.Downloaded += c.CompressedSize
+		}
+		stats.Chunks++
+		local[c.Hash] = downloaded[c.Hash]
+	}
+
+	out := make([]byte, 0, m.Size)
+	for _, c := range m.Chunks {
+		out = append(out, local[c.Hash]...)
+	}
+	sum := sha256.Sum256(out)
+	if int64(len(out)) != m.Size || hex.EncodeToString(sum[:]) != m.SHA256 {
+		return nil, stats, ErrChecksum
+	}
+	return out, stats, nil
+}
+
+// download 并发下载并校验 chunks，返回哈希到解压后内容的映射，以及哪些块来自 opts.Source
+func download(ctx context.Context, chunks []Chunk, baseURL string, opts *FetchOptions) (map[string][]byte, map[string]bool, error) {
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = DefaultConcurrency
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		result   = make(map[string][]byte, len(chunks))
+		sourced  = map[string]bool{}
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	next := make(chan Chunk)
+	for i := 0; i < min(workers, len(chunks)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range next {
+				data, fromSource, err := fetchChunk(ctx, c, baseURL, opts)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				result[c.Hash] = data
+				sourced[c.Hash] = fromSource
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, c := range chunks {
+		if ctx.Err() != nil {
+			break
+		}
+		next <- c
+	}
+	close(next)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	return result, sourced, nil
+}
+
+// fetchChunk 获取并校验一个块：先尝试 opts.Source，再从块目录下载并解压
+func fetchChunk(ctx context.Context, c Chunk, baseURL string, opts *FetchOptions) ([]byte, bool, error) {
+	if opts.Source != nil {
+		if data, err := opts.Source.GetChunk(ctx, c.Hash, c.Size); err == nil && verifyChunk(c, data) {
+			return data, true, nil
+		}
+	}
+	data, err := fetchCompressed(ctx, c, baseURL, opts)
+	return data, false, err
+}
+
+// fetchCompressed 从块目录下载、解压并校验一个块
+func fetchCompressed(ctx context.Context, c Chunk, baseURL string, opts *FetchOptions) ([]byte, error) {
+	var compressed []byte
+	var err error
+	if opts.Storage != nil {
+		compressed, err = opts.Storage.Get(ctx, ChunkKey(c.Hash))
+	} else {
+		err = utils.RetryWithContext(ctx, opts.Retry, func(ctx context.Context) error {
+			compressed, err = httpGet(ctx, opts.Client, strings.TrimSuffix(baseURL, "/")+"/"+ChunkKey(c.Hash), c.CompressedSize)
+			return err
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download chunk %s: %w", c.Hash, err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("chunk %s: %w", c.Hash, err)
+	}
+	// 最多读取 Size+1 字节，防止伪造的块解压出过多数据
+	data, err := io.ReadAll(io.LimitReader(zr, c.Size+1))
+	if err != nil {
+		return nil, fmt.Errorf("chunk %s: %w", c.Hash, err)
+	}
+	if !verifyChunk(c, data) {
+		return nil, fmt.Errorf("%w: chunk %s", ErrChecksum, c.Hash)
+	}
+	return data, nil
+}
+
+// verifyChunk 检查 data 的大小与 SHA-256 是否与清单一致
+func verifyChunk(c Chunk, data []byte) bool {
+	sum := sha256.Sum256(data)
+	return int64(len(data)) == c.Size && hex.EncodeToString(sum[:]) == c.Hash
+}
+
+// httpGet 以 GET 下载整个对象，最多读取 limit 字节
+func httpGet(ctx context.Context, client *http.Client, url string, limit int64) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, utils.NewStatusError(resp)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("GET %s: larger than the %d bytes listed in the manifest", url, limit)
+	}
+	return data, nil
+}
@@ -0,0 +1,234 @@
+// Package zchunk 以 zchunk 的方式通过 CDN 分发文件：文件按内容定义分块，每块单独压缩并以内容哈希命名，
+// 清单列出组成文件的块。客户端用本地旧文件按相同参数分块，只下载缺少的块；块是普通的静态文件，
+// 不需要 Range 请求，相同内容的块在各版本间共享，CDN 可以长期缓存
+package zchunk
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/storage"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// ManifestVersion 清单格式版本
+const ManifestVersion = 1
+
+// DefaultChunksURL 块目录相对清单的默认地址
+const DefaultChunksURL = "chunks/"
+
+// ErrInvalidManifest 清单格式错误
+var ErrInvalidManifest = errors.New("invalid zchunk manifest")
+
+// Manifest 发布在文件旁的清单（JSON），按顺序列出组成文件的块
+type Manifest struct {
+	Version  int    `json:"version"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+	// ChunksURL 块目录的地址，相对地址以清单的地址为基准
+	ChunksURL string `json:"chunks_url"`
+	// Compression 块的压缩方式，目前只有 gzip
+	Compression string `json:"compression"`
+	// 分块参数，客户端以相同参数切分本地文件
+	ChunkMin int     `json:"chunk_min"`
+	ChunkAvg int     `json:"chunk_avg"`
+	ChunkMax int     `json:"chunk_max"`
+	Chunks   []Chunk `json:"chunks"`
+}
+
+// Chunk 清单中的一个块
+type Chunk struct {
+	// Hash 未压缩内容的 SHA-256（十六进制），也是块文件的名称
+	Hash           string `json:"hash"`
+	Size           int64  `json:"size"`
+	CompressedSize int64  `json:"compressed_size"`
+}
+
+// BuildOptions 生成清单的选项
+type BuildOptions struct {
+	// Chunk 分块参数，为 nil 时使用 core 的默认值（平均 8 KB）
+	Chunk *core.ChunkOptions
+	// ChunksURL 写入清单的块目录地址，为空时为 DefaultChunksURL
+	ChunksURL string
+	// Level gzip 压缩级别，0 使用 gzip.BestCompression
+	Level int
+}
+
+// BuildStats 发布统计
+type BuildStats struct {
+	Uploaded   int   // 新写入的块数
+	Existing   int   // 后端中已有、跳过的块数
+	Compressed int64 // 新写入块的压缩后总大小
+}
+
+// ChunkKey 返回块在块目录中的路径：<前两位>/<哈希>
+func ChunkKey(hash string) string {
+	return hash[:2] + "/" + hash
+}
+
+// Build 切分 data 生成清单，并把后端中还没有的块压缩后写入 chunks（以 ChunkKey 为键）
+func Build(ctx context.Context, data []byte, filename string, chunks storage.Backend, opts *BuildOptions) (*Manifest, *BuildStats, error) {
+	if opts == nil {
+		opts = &BuildOptions{}
+	}
+	chunkOpts := core.ChunkOptions{}
+	if opts.Chunk != nil {
+		chunkOpts = *opts.Chunk
+	}
+	chunkOpts.MinSize, chunkOpts.AvgSize, chunkOpts.MaxSize = chunkParams(chunkOpts)
+	level := opts.Level
+	if level == 0 {
+		level = gzip.BestCompression
+	}
+	sum := sha256.Sum256(data)
+	m := &Manifest{
+		Version:     ManifestVersion,
+		Filename:    filename,
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		ChunksURL:   opts.ChunksURL,
+		Compression: "gzip",
+		ChunkMin:    chunkOpts.MinSize,
+		ChunkAvg:    chunkOpts.AvgSize,
+		ChunkMax:    chunkOpts.MaxSize,
+	}
+	if m.ChunksURL == "" {
+		m.ChunksURL = DefaultChunksURL
+	}
+
+	stats := &BuildStats{}
+	written := map[string]int64{}
+	for _, c := range core.Chunk(data, &chunkOpts) {
+		sum := sha256.Sum256(c)
+		hash := hex.EncodeToString(sum[:])
+		size, ok := written[hash]
+		if !ok {
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+			var err error
+			size, err = chunks.Stat(ctx, ChunkKey(hash))
+			switch {
+			case err == nil:
+				stats.Existing++
+			case errors.Is(err, storage.ErrNotFound):
+				compressed, err := compress(c, level)
+				if err != nil {
+					return nil, nil, err
+				}
+				if err := chunks.Put(ctx, ChunkKey(hash), compressed); err != nil {
+					return nil, nil, fmt.Errorf("failed to upload chunk %s: %w", hash, err)
+				}
+				size = int64(len(compressed))
+				stats.Uploaded++
+				stats.Compressed += size
+			default:
+				return nil, nil, err
+			}
+			written[hash] = size
+		}
+		m.Chunks = append(m.Chunks, Chunk{Hash: hash, Size: int64(len(c)), CompressedSize: size})
+	}
+	return m, stats, nil
+}
+
+// chunkParams 补全分块参数的默认值，使清单记录实际使用的参数
+func chunkParams(o core.ChunkOptions) (int, int, int) {
+	if o.MinSize <= 0 {
+		o.MinSize = core.DefaultChunkMin
+	}
+	if o.AvgSize <= 0 {
+		o.AvgSize = core.DefaultChunkAvg
+	}
+	if o.MaxSize <= 0 {
+		o.MaxSize = core.DefaultChunkMax
+	}
+	return o.MinSize, o.AvgSize, o.MaxSize
+}
+
+// compress 以 gzip 压缩块
+func compress(data []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteTo 以缩进的 JSON 写出清单
+func (m *Manifest) WriteTo(w io.Writer) (int64, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(data, '\n'))
+	return int64(n), err
+}
+
+// ReadManifest 读取并校验清单
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+	if m.Version != ManifestVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidManifest, m.Version)
+	}
+	if m.Compression != "gzip" {
+		return nil, fmt.Errorf("%w: unsupported compression %q", ErrInvalidManifest, m.Compression)
+	}
+	if len(m.SHA256) != 64 {
+		return nil, fmt.Errorf("%w: bad sha256", ErrInvalidManifest)
+	}
+	if m.ChunkMin <= 0 || m.ChunkAvg < m.ChunkMin || m.ChunkMax < m.ChunkAvg {
+		return nil, fmt.Errorf("%w: bad chunk parameters %d/%d/%d", ErrInvalidManifest, m.ChunkMin, m.ChunkAvg, m.ChunkMax)
+	}
+	var total int64
+	for _, c := range m.Chunks {
+		if len(c.Hash) != 64 || c.Size <= 0 || c.CompressedSize <= 0 {
+			return nil, fmt.Errorf("%w: bad chunk entry %q", ErrInvalidManifest, c.Hash)
+		}
+		if _, err := hex.DecodeString(c.Hash); err != nil {
+			return nil, fmt.Errorf("%w: bad chunk hash %q", ErrInvalidManifest, c.Hash)
+		}
+		total += c.Size
+	}
+	if total != m.Size {
+		return nil, fmt.Errorf("%w: chunks add up to %d bytes, expected %d", ErrInvalidManifest, total, m.Size)
+	}
+	return &m, nil
+}
+
+// BaseURL 返回块目录的地址，相对地址以清单的地址 manifestURL 为基准
+func (m *Manifest) BaseURL(manifestURL string) (string, error) {
+	ref, err := url.Parse(m.ChunksURL)
+	if err != nil {
+		return "", fmt.Errorf("%w: bad chunks_url: %v", ErrInvalidManifest, err)
+	}
+	if ref.IsAbs() || manifestURL == "" {
+		return m.ChunksURL, nil
+	}
+	if storage.IsURL(manifestURL) || !strings.Contains(manifestURL, "://") {
+		// 对象存储地址与本地路径按目录拼接
+		return manifestURL[:strings.LastIndex(manifestURL, "/")+1] + m.ChunksURL, nil
+	}
+	base, err := url.Parse(manifestURL)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
@@ -0,0 +1,191 @@
+package zsync
+
+import (
+	"bindiff/pkg/storage"
+	"bindiff/pkg/utils"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrChecksum 重建的文件与索引中的 SHA-256 不一致
+var ErrChecksum = errors.New("reconstructed file checksum mismatch")
+
+// FetchOptions 远程重建选项
+type FetchOptions struct {
+	// Client 为空时使用 http.DefaultClient
+	Client *http.Client
+	// MaxGap 两段缺失数据之间已有的数据不超过 MaxGap 字节时合并为一个请求，减少请求次数
+	MaxGap int64
+	// Storage 设置后从该后端的 Key 对象读取缺失的块（如 S3 上的文件），忽略 fileURL
+	Storage storage.Backend
+	Key     string
+	// Retry 下载一段数据失败时的重试参数，零值使用 utils.RetryWithContext 的默认值
+	Retry utils.RetryOptions
+}
+
+// Stats 重建统计
+type Stats struct {
+	Reused     int64 // 从本地文件复用的字节数
+	Downloaded int64 // 通过网络下载的字节数
+	Requests   int
+}
+
+// byteRange 半开区间 [start, end)
+type byteRange struct {
+	start, end int64
+}
+
+// Fetch 根据索引重建远程文件：在本地文件 seed 中查找索引中的块，只通过 HTTP Range 请求
+// （或 opts.Storage 的范围读取）下载缺失的块，最后以 SHA-256 校验结果。服务器不支持 Range 时退化为下载整个文件
+func Fetch(ctx context.Context, idx *Index, fileURL string, seed []byte, opts *FetchOptions) ([]byte, *Stats, error) {
+	if opts == nil {
+		opts = &FetchOptions{}
+	}
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	// 内容相同的块（如全零块）共用本地数据
+	same := make(map[string][]int)
+	for i, b := range idx.Sig.Blocks {
+		key := blockKey(b.Weak, b.Strong, idx.blockSize(i))
+		same[key] = append(same[key], i)
+	}
+	have := make([]int64, len(idx.Sig.Blocks))
+	for i := range have {
+		have[i] = -1
+	}
+	idx.Sig.Search(seed, func(block, offset, length int) {
+		b := idx.Sig.Blocks[block]
+		for _, i := range same[blockKey(b.Weak, b.Strong, int64(length))] {
+			if have[i] < 0 {
+				have[i] = int64(offset)
+			}
+		}
+	})
+
+	out := make([]byte, idx.Length)
+	stats := &Stats{}
+	var missing []byteRange
+	bl := int64(idx.Sig.BlockLen)
+	for i, off := range have {
+		start, size := int64(i)*bl, idx.blockSize(i)
+		if off >= 0 {
+			copy(out[start:start+size], seed[off:off+size])
+			continue
+		}
+		if n := len(missing); n > 0 && start-missing[n-1].end <= opts.MaxGap {
+			missing[n-1].end = start + size
+		} else {
+			missing = append(missing, byteRange{start, start + size})
+		}
+	}
+
+	for _, r := range missing {
+		var full bool
+		var err error
+		if opts.Storage != nil {
+			err = storageRange(ctx, opts.Storage, opts.Key, r, out)
+		} else {
+			err = utils.RetryWithContext(ctx, opts.Retry, func(ctx context.Context) error {
+				full, err = fetchRange(ctx, client, fileURL, r, out)
+				return err
+			})
+		}
+		stats.Requests++
+		if err != nil {
+			return nil, stats, err
+		}
+		if full {
+			stats.Downloaded = idx.Length
+			break
+		}
+		stats.Downloaded += r.end - r.start
+	}
+	// 合并请求时重新下载的数据不计入复用
+	stats.Reused = idx.Length - stats.Downloaded
+
+	sum := sha256.Sum256(out)
+	if hex.EncodeToString(sum[:]) != idx.SHA256 {
+		return nil, stats, ErrChecksum
+	}
+	return out, stats, nil
+}
+
+// blockKey 块内容的标识
+func blockKey(weak uint32, strong []byte, size int64) string {
+	return fmt.Sprintf("%08x:%x:%d", weak, strong, size)
+}
+
+// fetchRange 下载 r 写入 out 的对应位置。服务器忽略 Range 返回整个文件时写入整个 out 并返回 true
+func fetchRange(ctx context.Context, client *http.Client, fileURL string, r byteRange, out []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", r.start, r.end-1))
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, end, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || start != r.start || end != r.end {
+			return false, fmt.Errorf("server returned range %q for bytes %d-%d", resp.Header.Get("Content-Range"), r.start, r.end-1)
+		}
+		if _, err := io.ReadFull(resp.Body, out[r.start:r.end]); err != nil {
+			return false, fmt.Errorf("failed to read range %d-%d: %w", r.start, r.end-1, err)
+		}
+		return false, nil
+	case http.StatusOK:
+		if _, err := io.ReadFull(resp.Body, out); err != nil {
+			return false, fmt.Errorf("failed to read file: %w", err)
+		}
+		return true, nil
+	default:
+		return false, utils.NewStatusError(resp)
+	}
+}
+
+// storageRange 从存储后端读取 r 写入 out 的对应位置
+func storageRange(ctx context.Context, b storage.Backend, key string, r byteRange, out []byte) error {
+	data, err := b.GetRange(ctx, key, r.start, r.end-r.start)
+	if err != nil {
+		return fmt.Errorf("failed to read range %d-%d: %w", r.start, r.end-1, err)
+	}
+	if int64(len(data)) != r.end-r.start {
+		return fmt.Errorf("failed to read range %d-%d: %w", r.start, r.end-1, io.ErrUnexpectedEOF)
+	}
+	copy(out[r.start:r.end], data)
+	return nil
+}
+
+// parseContentRange 解析 "bytes start-end/size"，返回半开区间
+func parseContentRange(v string) (int64, int64, error) {
+	spec, ok := strings.CutPrefix(v, "bytes ")
+	if !ok {
+		return 0, 0, fmt.Errorf("bad Content-Range %q", v)
+	}
+	spec, _, _ = strings.Cut(spec, "/")
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("bad Content-Range %q", v)
+	}
+	start, err1 := strconv.ParseInt(first, 10, 64)
+	end, err2 := strconv.ParseInt(last, 10, 64)
+	if err1 != nil || err2 != nil || end < start {
+		return 0, 0, fmt.Errorf("bad Content-Range %q", v)
+	}
+	return start, end + 1, nil
+}
@@ -0,0 +1,166 @@
+package zsync
+
+import (
+	"bindiff/pkg/rdiff"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// 索引文件头的版本标识
+const indexVersion = "bindiff-1"
+
+// DefaultBlockLen 默认块长度
+const DefaultBlockLen = 2048
+
+// DefaultStrongLen 默认强校验长度：整个文件另有 SHA-256 校验，块校验只需避免误匹配
+const DefaultStrongLen = 8
+
+// ErrInvalidIndex 索引文件格式错误
+var ErrInvalidIndex = errors.New("invalid zsync index")
+
+// Index 发布在文件旁的块校验索引：文本头（文件名、长度、块长度、SHA-256、下载地址），
+// 空行之后是 librsync 格式的块签名
+type Index struct {
+	Filename string
+	// URL 文件的下载地址，相对地址以索引文件的地址为基准
+	URL    string
+	Length int64
+	// SHA256 整个文件的十六进制 SHA-256，用于校验重建结果
+	SHA256 string
+	Sig    *rdiff.Signature
+}
+
+// BuildIndex 为 data 生成索引，blockLen 不大于 0 时使用 DefaultBlockLen
+func BuildIndex(data []byte, filename, fileURL string, blockLen int) (*Index, error) {
+	if blockLen <= 0 {
+		blockLen = DefaultBlockLen
+	}
+	var buf bytes.Buffer
+	if err := rdiff.WriteSignature(bytes.NewReader(data), &buf, rdiff.RKBlake2SigMagic, blockLen, DefaultStrongLen); err != nil {
+		return nil, err
+	}
+	sig, err := rdiff.ReadSignature(&buf)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return &Index{
+		Filename: filename,
+		URL:      fileURL,
+		Length:   int64(len(data)),
+		SHA256:   hex.EncodeToString(sum[:]),
+		Sig:      sig,
+	}, nil
+}
+
+// WriteTo 写出索引文件
+func (idx *Index) WriteTo(w io.Writer) (int64, error) {
+	var hdr strings.Builder
+	fmt.Fprintf(&hdr, "zsync: %s\n", indexVersion)
+	fmt.Fprintf(&hdr, "Filename: %s\n", idx.Filename)
+	fmt.Fprintf(&hdr, "Length: %d\n", idx.Length)
+	fmt.Fprintf(&hdr, "Blocksize: %d\n", idx.Sig.BlockLen)
+	fmt.Fprintf(&hdr, "SHA-256: %s\n", idx.SHA256)
+	if idx.URL != "" {
+		fmt.Fprintf(&hdr, "URL: %s\n", idx.URL)
+	}
+	hdr.WriteString("\n")
+
+	n, err := io.WriteString(w, hdr.String())
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := idx.Sig.WriteTo(w)
+	return int64(n) + m, err
+}
+
+// ReadIndex 读取并校验索引文件
+func ReadIndex(r io.Reader) (*Index, error) {
+	br := bufio.NewReader(r)
+	idx := &Index{Length: -1}
+	blockLen := 0
+	for first := true; ; first = false {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("%w: truncated header", ErrInvalidIndex)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return nil, fmt.Errorf("%w: bad header line %q", ErrInvalidIndex, line)
+		}
+		if first != (key == "zsync") {
+			return nil, fmt.Errorf("%w: missing zsync header", ErrInvalidIndex)
+		}
+		switch key {
+		case "zsync":
+			if value != indexVersion {
+				return nil, fmt.Errorf("%w: unsupported version %q", ErrInvalidIndex, value)
+			}
+		case "Filename":
+			idx.Filename = value
+		case "URL":
+			idx.URL = value
+		case "SHA-256":
+			idx.SHA256 = value
+		case "Length":
+			idx.Length, err = strconv.ParseInt(value, 10, 64)
+		case "Blocksize":
+			blockLen, err = strconv.Atoi(value)
+		}
+		// 未知的头字段忽略，便于以后扩展
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad %s header %q", ErrInvalidIndex, key, value)
+		}
+	}
+
+	sig, err := rdiff.ReadSignature(br)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIndex, err)
+	}
+	idx.Sig = sig
+	if sum, err := hex.DecodeString(idx.SHA256); err != nil || len(sum) != sha256.Size {
+		return nil, fmt.Errorf("%w: bad SHA-256 header", ErrInvalidIndex)
+	}
+	if idx.Length < 0 || sig.BlockLen != blockLen ||
+		int64(len(sig.Blocks)) != (idx.Length+int64(blockLen)-1)/int64(blockLen) {
+		return nil, fmt.Errorf("%w: block table does not match length %d and block size %d", ErrInvalidIndex, idx.Length, blockLen)
+	}
+	return idx, nil
+}
+
+// FileURL 返回文件的下载地址，相对地址以索引文件的地址 indexURL 为基准
+func (idx *Index) FileURL(indexURL string) (string, error) {
+	if idx.URL == "" {
+		return "", fmt.Errorf("index for %s has no URL", idx.Filename)
+	}
+	ref, err := url.Parse(idx.URL)
+	if err != nil {
+		return "", fmt.Errorf("bad URL in index: %w", err)
+	}
+	if ref.IsAbs() || indexURL == "" {
+		return ref.String(), nil
+	}
+	base, err := url.Parse(indexURL)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// blockSize 返回第 i 块的长度，最后一块可能不足块长度
+func (idx *Index) blockSize(i int) int64 {
+	bl := int64(idx.Sig.BlockLen)
+	return min(bl, idx.Length-int64(i)*bl)
+}
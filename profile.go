@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bindiff/pkg/logger"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sync"
+	"time"
+)
+
+// profiling 当前命令的性能分析，未启用时为 nil
+var profiling struct {
+	sync.Mutex
+	stop func() error
+}
+
+// startProfiling 开始把 CPU 分析（与 withTrace 时的执行跟踪）写到 dir 下，文件名以命令名与时间开头，
+// 停止时再写入堆分析。重复调用时先停止上一次的分析
+func startProfiling(dir, command string, withTrace bool) error {
+	if err := stopProfiling(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create profile directory: %w", err)
+	}
+	prefix := filepath.Join(dir, command+"-"+time.Now().Format("20060102-150405"))
+
+	cpuFile, err := os.Create(prefix + "-cpu.pprof")
+	if err != nil {
+		return fmt.Errorf("failed to create CPU profile: %w", err)
+	}
+	if err := pprof.StartCPUProfile(cpuFile); err != nil {
+		cpuFile.Close()
+		return fmt.Errorf("failed to start CPU profile: %w", err)
+	}
+
+	var traceFile *os.File
+	if withTrace {
+		if traceFile, err = os.Create(prefix + "-trace.out"); err == nil {
+			err = trace.Start(traceFile)
+		}
+		if err != nil {
+			pprof.StopCPUProfile()
+			cpuFile.Close()
+			if traceFile != nil {
+				traceFile.Close()
+			}
+			return fmt.Errorf("failed to start execution trace: %w", err)
+		}
+	}
+
+	profiling.Lock()
+	profiling.stop = func() error {
+		pprof.StopCPUProfile()
+		errs := []error{cpuFile.Close()}
+		if traceFile != nil {
+			trace.Stop()
+			errs = append(errs, traceFile.Close())
+		}
+		errs = append(errs, writeHeapProfile(prefix+"-heap.pprof"))
+		if err := errors.Join(errs...); err != nil {
+			return fmt.Errorf("failed to write profiles: %w", err)
+		}
+		logger.Infof("Profiles written to %s-*", prefix)
+		return nil
+	}
+	profiling.Unlock()
+	return nil
+}
+
+// writeHeapProfile 在一次 GC 之后写入堆分析，使其反映仍在使用的内存
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// stopProfiling 停止分析并写入剩余的文件，未启用或已停止时什么也不做
+func stopProfiling() error {
+	profiling.Lock()
+	stop := profiling.stop
+	profiling.stop = nil
+	profiling.Unlock()
+	if stop == nil {
+		return nil
+	}
+	return stop()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bindiff/pkg/logger"
+	"bindiff/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// interruptGrace 收到信号后等待命令自行停止的时间，超时或再次收到信号时强制清理退出
+const interruptGrace = 30 * time.Second
+
+// interruptedError 命令因信号被取消
+type interruptedError struct {
+	sig os.Signal
+}
+
+func (e *interruptedError) Error() string {
+	return fmt.Sprintf("interrupted by %v", e.sig)
+}
+
+// handleSignals 返回收到 SIGINT/SIGTERM 时取消的上下文，取消原因为 *interruptedError。
+// 命令应在上下文取消后尽快返回，由 main 调用 exitInterrupted；宽限期内未返回时在此直接退出
+func handleSignals() context.Context {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-ch
+		logger.Warnf("Received %v, stopping (press Ctrl+C again to exit immediately)", sig)
+		cancel(&interruptedError{sig: sig})
+		select {
+		case <-ch:
+		case <-time.After(interruptGrace):
+			logger.Warnf("Operation did not stop within %s", interruptGrace)
+		}
+		exitInterrupted(sig)
+	}()
+	return ctx
+}
+
+// interruptSignal 返回取消 ctx 的信号，未被信号取消时返回 nil
+func interruptSignal(ctx context.Context) os.Signal {
+	var ie *interruptedError
+	if errors.As(context.Cause(ctx), &ie) {
+		return ie.sig
+	}
+	return nil
+}
+
+// exitInterrupted 删除未写完的临时文件与输出、写完性能分析、刷新日志，以 128+信号值（SIGINT 为 130，SIGTERM 为 143）退出
+func exitInterrupted(sig os.Signal) {
+	for _, path := range utils.RemovePartialFiles() {
+		logger.Infof("Removed partial output %s", path)
+	}
+	logger.Warnf("Interrupted by %v", sig)
+	if err := stopProfiling(); err != nil {
+		logger.Warnf("%v", err)
+	}
+	logger.Close()
+
+	code := 1
+	if s, ok := sig.(syscall.Signal); ok {
+		code = 128 + int(s)
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,120 @@
+package audit_test
+
+import (
+	"bindiff/pkg/audit"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAppendChainsEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.log")
+	log := audit.New(path)
+
+	for _, outcome := range []string{audit.OutcomeSuccess, audit.OutcomeFailure, audit.OutcomeSuccess} {
+		e := &audit.Entry{Operation: audit.OperationApply, Source: "/a", Patch: "/p", Outcome: outcome}
+		if err := log.Append(e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Hash == "" || e.User == "" {
+			t.Errorf("Append did not fill in the entry: %+v", e)
+		}
+	}
+
+	entries, err := audit.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	for i, e := range entries {
+		if e.Seq != uint64(i+1) {
+			t.Errorf("entry %d has seq %d", i, e.Seq)
+		}
+		if i > 0 && e.Prev != entries[i-1].Hash {
+			t.Errorf("entry %d does not link to its predecessor", e.Seq)
+		}
+	}
+	if err := audit.Verify(entries); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log := audit.New(path)
+	for i := 0; i < 3; i++ {
+		if err := log.Append(&audit.Entry{Operation: audit.OperationApply, Outcome: audit.OutcomeFailure, Error: "boom"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := audit.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]func([]audit.Entry) []audit.Entry{
+		"modified": func(es []audit.Entry) []audit.Entry {
+			es[1].Outcome = audit.OutcomeSuccess
+			return es
+		},
+		"removed": func(es []audit.Entry) []audit.Entry {
+			return append(es[:1], es[2:]...)
+		},
+		"reordered": func(es []audit.Entry) []audit.Entry {
+			es[1], es[2] = es[2], es[1]
+			return es
+		},
+	}
+	for name, tamper := range cases {
+		t.Run(name, func(t *testing.T) {
+			es := tamper(append([]audit.Entry(nil), entries...))
+			if err := audit.Verify(es); !errors.Is(err, audit.ErrTampered) {
+				t.Errorf("Verify = %v, want ErrTampered", err)
+			}
+		})
+	}
+}
+
+func TestAppendConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := audit.New(path).Append(&audit.Entry{Operation: audit.OperationApply, Outcome: audit.OutcomeSuccess}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	entries, err := audit.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 8 {
+		t.Fatalf("expected 8 entries, got %d", len(entries))
+	}
+	if err := audit.Verify(entries); err != nil {
+		t.Errorf("concurrent appends broke the chain: %v", err)
+	}
+}
+
+func TestReadRejectsCorruptLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := os.WriteFile(path, []byte("{not json\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := audit.Read(path); !errors.Is(err, audit.ErrTampered) {
+		t.Errorf("Read = %v, want ErrTampered", err)
+	}
+	if err := audit.New(path).Append(&audit.Entry{}); err == nil || !strings.Contains(err.Error(), "last entry") {
+		t.Errorf("Append after a corrupt entry = %v", err)
+	}
+}
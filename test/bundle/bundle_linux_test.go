@@ -0,0 +1,187 @@
+package bundle_test
+
+import (
+	"archive/tar"
+	"bindiff/pkg/bundle"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"testing/fstest"
+)
+
+// TestApplyBundleFidelity 测试符号链接、硬链接、稀疏文件与特殊权限位的还原
+func TestApplyBundleFidelity(t *testing.T) {
+	oldDir, newDir := t.TempDir(), t.TempDir()
+	write := func(dir, name, data string, mode os.FileMode) {
+		p := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chmod(p, mode)
+	}
+	for _, dir := range []string{oldDir, newDir} {
+		write(dir, "bin/tool", "tool v1", 0755)
+		os.Symlink("tool", filepath.Join(dir, "bin/current"))
+	}
+	write(oldDir, "etc/app.conf", "old config", 0644)
+	write(oldDir, "lib/libold.so", "old library", 0644)
+	os.Symlink("libold.so", filepath.Join(oldDir, "lib/libfoo.so"))
+
+	// 新目录：链接改指向、悬空链接、硬链接组、稀疏文件、setgid 与 sticky
+	write(newDir, "lib/libnew.so", "new library", 0644)
+	os.Symlink("libnew.so", filepath.Join(newDir, "lib/libfoo.so"))
+	os.Symlink("/nonexistent/target", filepath.Join(newDir, "dangling"))
+	write(newDir, "etc/app.conf", "new config", os.ModeSetgid|0755)
+	os.Link(filepath.Join(newDir, "etc/app.conf"), filepath.Join(newDir, "etc/app.conf.hardlink"))
+	os.Mkdir(filepath.Join(newDir, "tmp"), 0755)
+	os.Chmod(filepath.Join(newDir, "tmp"), os.ModeSticky|0777)
+
+	const sparseSize = 4 << 20
+	f, err := os.Create(filepath.Join(newDir, "disk.img"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte("boot sector"), 0)
+	f.WriteAt([]byte("tail data"), sparseSize-4096)
+	f.Truncate(sparseSize)
+	f.Close()
+
+	var buf bytes.Buffer
+	manifest, err := bundle.Diff(os.DirFS(oldDir), os.DirFS(newDir), &buf, nil)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	entries := make(map[string]bundle.FileEntry)
+	for _, e := range manifest.Files {
+		entries[e.Path] = e
+	}
+	if e := entries["lib/libfoo.so"]; e.Type != bundle.TypeSymlink || e.Target != "libnew.so" || e.Kind != bundle.KindModified {
+		t.Errorf("Unexpected symlink entry: %+v", e)
+	}
+	if e := entries["etc/app.conf.hardlink"]; e.Link != "etc/app.conf" || e.Patch != "" {
+		t.Errorf("Hard link not recorded: %+v", e)
+	}
+
+	if _, err := bundle.Apply(oldDir, bytes.NewReader(buf.Bytes()), nil); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	for name, want := range map[string]string{
+		"bin/current":   "tool",
+		"lib/libfoo.so": "libnew.so",
+		"dangling":      "/nonexistent/target",
+	} {
+		if got, err := os.Readlink(filepath.Join(oldDir, name)); err != nil || got != want {
+			t.Errorf("%s: expected link to %q, got %q (%v)", name, want, got, err)
+		}
+	}
+	conf, _ := os.Stat(filepath.Join(oldDir, "etc/app.conf"))
+	link, _ := os.Stat(filepath.Join(oldDir, "etc/app.conf.hardlink"))
+	if conf == nil || link == nil || !os.SameFile(conf, link) {
+		t.Error("Hard link group not reproduced")
+	}
+	if conf != nil && conf.Mode() != os.ModeSetgid|0755 {
+		t.Errorf("Expected setgid 0755, got %v", conf.Mode())
+	}
+	if info, err := os.Stat(filepath.Join(oldDir, "tmp")); err != nil || info.Mode() != os.ModeDir|os.ModeSticky|0777 {
+		t.Errorf("Sticky directory not reproduced: %v", info)
+	}
+	if _, err := os.Lstat(filepath.Join(oldDir, "lib/libold.so")); !os.IsNotExist(err) {
+		t.Error("Removed file still present")
+	}
+
+	img, err := os.Stat(filepath.Join(oldDir, "disk.img"))
+	if err != nil || img.Size() != sparseSize {
+		t.Fatalf("Sparse file not reproduced: %v", err)
+	}
+	// 文件系统支持空洞时，还原后的文件同样是稀疏的
+	if len(entries["disk.img"].Holes) > 0 {
+		if blocks := img.Sys().(*syscall.Stat_t).Blocks * 512; blocks >= sparseSize {
+			t.Errorf("Sparse file densified: %d bytes allocated", blocks)
+		}
+	}
+}
+
+// rewriteBundle 读取增量包，修改清单后重新写出，模拟构造的恶意增量包
+func rewriteBundle(t *testing.T, data []byte, edit func(*bundle.Manifest)) []byte {
+	t.Helper()
+	manifest, files, err := bundle.Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	edit(manifest)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		tw.Write(content)
+	}
+	encoded, _ := json.Marshal(manifest)
+	tw.WriteHeader(&tar.Header{Name: bundle.ManifestName, Mode: 0644, Size: int64(len(encoded))})
+	tw.Write(encoded)
+	tw.Close()
+	return buf.Bytes()
+}
+
+// TestApplyBundleSymlinkEscape 测试经过符号链接的路径被拒绝，不会写到目标目录之外
+func TestApplyBundleSymlinkEscape(t *testing.T) {
+	outside := t.TempDir()
+	oldFS, newFS := fstest.MapFS{}, fstest.MapFS{"l/pwned": {Data: []byte("escaped"), Mode: 0644}}
+	var buf bytes.Buffer
+	if _, err := bundle.Diff(oldFS, newFS, &buf, nil); err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	escaped := func() bool {
+		_, err := os.Lstat(filepath.Join(outside, "pwned"))
+		return err == nil
+	}
+
+	// 清单中的目录 l 换成符号链接 l -> outside，其后是文件 l/pwned
+	crafted := rewriteBundle(t, buf.Bytes(), func(m *bundle.Manifest) {
+		for i, e := range m.Files {
+			if e.Path == "l" {
+				m.Files[i] = bundle.FileEntry{Path: "l", Kind: bundle.KindAdded, Type: bundle.TypeSymlink,
+					Target: outside, Hash: bundle.Digest([]byte(outside))}
+			}
+		}
+	})
+	dir := t.TempDir()
+	if _, err := bundle.Apply(dir, bytes.NewReader(crafted), nil); !errors.Is(err, bundle.ErrInvalidBundle) {
+		t.Errorf("Expected ErrInvalidBundle for a path under a symlink entry, got %v", err)
+	}
+	if escaped() {
+		t.Fatal("Apply wrote through the symlink entry")
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "l")); !os.IsNotExist(err) {
+		t.Error("Rejected bundle left the symlink behind")
+	}
+
+	// 目标目录中原有的符号链接同样不能被跟随（清单中不含目录 l）
+	crafted = rewriteBundle(t, buf.Bytes(), func(m *bundle.Manifest) {
+		files := m.Files[:0]
+		for _, e := range m.Files {
+			if e.Path != "l" {
+				files = append(files, e)
+			}
+		}
+		m.Files = files
+	})
+	dir = t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dir, "l")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bundle.Apply(dir, bytes.NewReader(crafted), nil); !errors.Is(err, bundle.ErrUnsafePath) {
+		t.Errorf("Expected ErrUnsafePath for an existing symlinked directory, got %v", err)
+	}
+	if escaped() {
+		t.Fatal("Apply wrote through the existing symlink")
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "l")); err != nil || target != outside {
+		t.Errorf("Existing symlink changed: %q (%v)", target, err)
+	}
+}
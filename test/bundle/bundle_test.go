@@ -0,0 +1,165 @@
+package bundle_test
+
+import (
+	"bindiff/pkg/bundle"
+	"bytes"
+	"errors"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// writeTree 将 MapFS 写到磁盘目录
+func writeTree(t *testing.T, dir string, files fstest.MapFS) {
+	t.Helper()
+	for name, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if f.Mode.IsDir() {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		mode := f.Mode.Perm()
+		if mode == 0 {
+			mode = 0644
+		}
+		if err := os.WriteFile(p, f.Data, mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(p, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// trees 返回测试用的新旧目录
+func trees() (fstest.MapFS, fstest.MapFS) {
+	rng := rand.New(rand.NewSource(11))
+	model := make([]byte, 32*1024)
+	rng.Read(model)
+	edited := append([]byte(nil), model...)
+	copy(edited[1000:], "retrained weights")
+
+	oldFS := fstest.MapFS{
+		"bin":           {Mode: fs.ModeDir | 0755},
+		"lib":           {Mode: fs.ModeDir | 0755},
+		"etc":           {Mode: fs.ModeDir | 0755},
+		"bin/app":       {Data: []byte("#!/bin/sh\necho v1\n"), Mode: 0755},
+		"lib/model.bin": {Data: model, Mode: 0644},
+		"etc/conf":      {Data: []byte("level=1"), Mode: 0644},
+		"obsolete.txt":  {Data: []byte("remove me"), Mode: 0644},
+	}
+	newFS := fstest.MapFS{
+		"bin":           {Mode: fs.ModeDir | 0755},
+		"lib":           {Mode: fs.ModeDir | 0755},
+		"etc":           {Mode: fs.ModeDir | 0750},
+		"share":         {Mode: fs.ModeDir | 0755},
+		"bin/app":       {Data: []byte("#!/bin/sh\necho v1\n"), Mode: 0700},
+		"lib/model.bin": {Data: edited, Mode: 0644},
+		"etc/conf":      {Data: []byte("level=1"), Mode: 0644},
+		"share/new.txt": {Data: []byte("added file"), Mode: 0600},
+	}
+	return oldFS, newFS
+}
+
+// checkTree 检查磁盘目录的内容与权限
+func checkTree(t *testing.T, dir string, want fstest.MapFS) {
+	t.Helper()
+	for name, f := range want {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if f.Mode.IsDir() {
+			if info, err := os.Stat(p); err != nil || info.Mode() != f.Mode {
+				t.Errorf("%s: expected directory mode %v, got %v", name, f.Mode, info)
+			}
+			continue
+		}
+		got, err := os.ReadFile(p)
+		if err != nil {
+			t.Errorf("Missing %s: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, f.Data) {
+			t.Errorf("%s: content mismatch", name)
+		}
+		if info, err := os.Stat(p); err == nil && f.Mode != 0 && info.Mode().Perm() != f.Mode.Perm() {
+			t.Errorf("%s: expected mode %v, got %v", name, f.Mode.Perm(), info.Mode().Perm())
+		}
+	}
+}
+
+// TestApplyBundle 测试目录增量包的生成与原地应用
+func TestApplyBundle(t *testing.T) {
+	oldFS, newFS := trees()
+	var buf bytes.Buffer
+	manifest, err := bundle.Diff(oldFS, newFS, &buf, nil)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	kinds := make(map[string]string)
+	for _, e := range manifest.Files {
+		kinds[e.Path] = e.Kind
+	}
+	if kinds["lib/model.bin"] != bundle.KindModified || kinds["share/new.txt"] != bundle.KindAdded ||
+		kinds["obsolete.txt"] != bundle.KindRemoved || kinds["bin/app"] != bundle.KindUnchanged {
+		t.Errorf("Unexpected manifest kinds: %v", kinds)
+	}
+	if buf.Len() > 8*1024 {
+		t.Errorf("Bundle is %d bytes, expected only the changes", buf.Len())
+	}
+
+	dir := t.TempDir()
+	writeTree(t, dir, oldFS)
+	if _, err := bundle.Apply(dir, bytes.NewReader(buf.Bytes()), nil); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	checkTree(t, dir, newFS)
+	if _, err := os.Stat(filepath.Join(dir, "obsolete.txt")); !os.IsNotExist(err) {
+		t.Error("Removed file still present")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, ".bindiff-staging-*")); len(matches) != 0 {
+		t.Errorf("Staging area left behind: %v", matches)
+	}
+
+	// 截断的增量包缺少清单
+	if _, err := bundle.Apply(dir, bytes.NewReader(buf.Bytes()[:buf.Len()/2]), nil); !errors.Is(err, bundle.ErrInvalidBundle) {
+		t.Errorf("Expected ErrInvalidBundle for truncated bundle, got %v", err)
+	}
+}
+
+// TestApplyBundleAtomic 测试校验失败与提交失败时目录保持原样
+func TestApplyBundleAtomic(t *testing.T) {
+	oldFS, newFS := trees()
+	var buf bytes.Buffer
+	if _, err := bundle.Diff(oldFS, newFS, &buf, nil); err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+
+	// 旧文件被本地修改：在替换任何文件之前失败
+	dir := t.TempDir()
+	writeTree(t, dir, oldFS)
+	os.WriteFile(filepath.Join(dir, "etc/conf"), []byte("level=2"), 0644)
+	if _, err := bundle.Apply(dir, bytes.NewReader(buf.Bytes()), nil); !errors.Is(err, bundle.ErrBaseMismatch) {
+		t.Fatalf("Expected ErrBaseMismatch, got %v", err)
+	}
+	checkTree(t, dir, fstest.MapFS{"lib/model.bin": oldFS["lib/model.bin"], "obsolete.txt": oldFS["obsolete.txt"]})
+
+	// share 是一个不在清单中的普通文件，写入 share/new.txt 时提交失败，
+	// 此前已替换的 lib/model.bin 与已删除的 obsolete.txt 必须恢复
+	dir = t.TempDir()
+	writeTree(t, dir, oldFS)
+	os.WriteFile(filepath.Join(dir, "share"), []byte("blocker"), 0644)
+	if _, err := bundle.Apply(dir, bytes.NewReader(buf.Bytes()), nil); err == nil {
+		t.Fatal("Expected commit to fail")
+	}
+	checkTree(t, dir, oldFS)
+	if matches, _ := filepath.Glob(filepath.Join(dir, ".bindiff-staging-*")); len(matches) != 0 {
+		t.Errorf("Staging area left behind: %v", matches)
+	}
+}
@@ -0,0 +1,107 @@
+package cmd_test
+
+import (
+	"bindiff/cmd"
+	"bindiff/pkg/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// diffOptions 加载内容为 yaml 的配置文件，以 args 解析 diff 命令的选项，
+// 返回 flags（命令行解析出的选项值）合并配置后的结果
+func diffOptions(t *testing.T, yaml string, flags cmd.DiffOptions, args ...string) cmd.DiffOptions {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bindiff.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	c := cmd.DiffCommand(func() *config.Config { return cfg })
+	if err := c.ParseFlags(args); err != nil {
+		t.Fatalf("ParseFlags failed: %v", err)
+	}
+	return flags.WithConfig(c, cfg)
+}
+
+// TestDiffConfigFFTPrecision 测试配置项 fft_precision 传到差分引擎，命令行选项优先
+func TestDiffConfigFFTPrecision(t *testing.T) {
+	const yaml = "fft_precision: float32\n"
+	if got := diffOptions(t, yaml, cmd.DiffOptions{}).EngineConfig().FFTPrecision; got != config.FFTPrecisionFloat32 {
+		t.Errorf("FFTPrecision = %q, want %q from the config file", got, config.FFTPrecisionFloat32)
+	}
+	flags := cmd.DiffOptions{FFTPrecision: config.FFTPrecisionFloat64}
+	if got := diffOptions(t, yaml, flags, "--fft-precision", "float64").EngineConfig().FFTPrecision; got != config.FFTPrecisionFloat64 {
+		t.Errorf("FFTPrecision = %q, want %q from --fft-precision", got, config.FFTPrecisionFloat64)
+	}
+}
+
+// TestDiffConfigAlignStrategy 测试配置项 align_strategy 传到差分引擎，命令行选项优先
+func TestDiffConfigAlignStrategy(t *testing.T) {
+	const yaml = "align_strategy: winnow\n"
+	if got := diffOptions(t, yaml, cmd.DiffOptions{}).EngineConfig().AlignStrategy; got != config.AlignStrategyWinnow {
+		t.Errorf("AlignStrategy = %q, want %q from the config file", got, config.AlignStrategyWinnow)
+	}
+	flags := cmd.DiffOptions{AlignStrategy: config.AlignStrategyFFT}
+	if got := diffOptions(t, yaml, flags, "--align", "fft").EngineConfig().AlignStrategy; got != config.AlignStrategyFFT {
+		t.Errorf("AlignStrategy = %q, want %q from --align", got, config.AlignStrategyFFT)
+	}
+}
+
+// TestDiffConfigCorrelationBackend 测试配置项 correlation_backend 传到差分引擎，命令行选项优先
+func TestDiffConfigCorrelationBackend(t *testing.T) {
+	const yaml = "correlation_backend: cuda\n"
+	if got := diffOptions(t, yaml, cmd.DiffOptions{}).EngineConfig().CorrelationBackend; got != config.CorrelationBackendCUDA {
+		t.Errorf("CorrelationBackend = %q, want %q from the config file", got, config.CorrelationBackendCUDA)
+	}
+	flags := cmd.DiffOptions{Backend: config.CorrelationBackendCPU}
+	if got := diffOptions(t, yaml, flags, "--correlation-backend", "cpu").EngineConfig().CorrelationBackend; got != config.CorrelationBackendCPU {
+		t.Errorf("CorrelationBackend = %q, want %q from --correlation-backend", got, config.CorrelationBackendCPU)
+	}
+}
+
+// TestDiffConfigAlignSamples 测试没有命令行选项的配置项 align_samples、align_sample_size
+// 以及 block_size 等未指定的选项传到差分引擎
+func TestDiffConfigAlignSamples(t *testing.T) {
+	const yaml = "align_strategy: sampled\nalign_samples: 8\nalign_sample_size: 4096\nblock_size: 2048\n"
+	cfg := diffOptions(t, yaml, cmd.DiffOptions{}).EngineConfig()
+	if cfg.AlignStrategy != config.AlignStrategySampled {
+		t.Errorf("AlignStrategy = %q, want %q", cfg.AlignStrategy, config.AlignStrategySampled)
+	}
+	if cfg.AlignSamples != 8 || cfg.AlignSampleSize != 4096 {
+		t.Errorf("AlignSamples, AlignSampleSize = %d, %d, want 8, 4096", cfg.AlignSamples, cfg.AlignSampleSize)
+	}
+	if cfg.BlockSize != 2048 {
+		t.Errorf("BlockSize = %d, want 2048 from the config file", cfg.BlockSize)
+	}
+	flags := cmd.DiffOptions{BlockSize: 512}
+	if got := diffOptions(t, yaml, flags, "--block-size", "512").EngineConfig().BlockSize; got != 512 {
+		t.Errorf("BlockSize = %d, want 512 from --block-size", got)
+	}
+}
+
+// TestDiffConfigAutoTune 测试配置项 auto_tune 传到差分引擎，命令行选项优先
+func TestDiffConfigAutoTune(t *testing.T) {
+	const yaml = "auto_tune: true\n"
+	if !diffOptions(t, yaml, cmd.DiffOptions{}).EngineConfig().AutoTune {
+		t.Error("AutoTune = false, want true from the config file")
+	}
+	if diffOptions(t, yaml, cmd.DiffOptions{}, "--auto-tune=false").EngineConfig().AutoTune {
+		t.Error("AutoTune = true, want false from --auto-tune=false")
+	}
+}
+
+// TestDiffConfigHashAlgorithm 测试配置项 hash_algorithm 传到差分引擎（用于计算补丁的校验哈希），命令行选项优先
+func TestDiffConfigHashAlgorithm(t *testing.T) {
+	const yaml = "hash_algorithm: blake3\n"
+	if got := diffOptions(t, yaml, cmd.DiffOptions{}).EngineConfig().HashAlgorithm; got != "blake3" {
+		t.Errorf("HashAlgorithm = %q, want %q from the config file", got, "blake3")
+	}
+	flags := cmd.DiffOptions{HashAlgorithm: "xxhash"}
+	if got := diffOptions(t, yaml, flags, "--hash", "xxhash").EngineConfig().HashAlgorithm; got != "xxhash" {
+		t.Errorf("HashAlgorithm = %q, want %q from --hash", got, "xxhash")
+	}
+}
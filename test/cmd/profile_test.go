@@ -0,0 +1,61 @@
+package cmd_test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestProfileDir 测试 --profile-dir 把命令的 CPU 与堆分析（以及 --profile-trace 的执行跟踪）
+// 写到指定目录，且分析文件可由 go tool pprof 读取
+func TestProfileDir(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping bdiff build in short mode")
+	}
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bdiff")
+	if runtime.GOOS == "windows" {
+		bin += ".exe"
+	}
+	// run 运行命令：bdiff 在 dir 中运行，go 命令在模块目录中运行
+	run := func(name string, args ...string) {
+		t.Helper()
+		cmd := exec.Command(name, args...)
+		if name != "go" {
+			cmd.Dir = dir
+		}
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s %v failed: %v\n%s", filepath.Base(name), args, err, out)
+		}
+	}
+	run("go", "build", "-o", bin, "bindiff")
+
+	oldData := bytes.Repeat([]byte("profiled content "), 4096)
+	newData := append([]byte("prefix "), oldData...)
+	for name, data := range map[string][]byte{"old.bin": oldData, "new.bin": newData} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	profiles := filepath.Join(dir, "profiles")
+	run(bin, "--profile-dir", profiles, "--profile-trace", "--progress=false",
+		"diff", "old.bin", "new.bin", "-o", "patch.bdf")
+
+	for _, suffix := range []string{"-cpu.pprof", "-heap.pprof", "-trace.out"} {
+		matches, _ := filepath.Glob(filepath.Join(profiles, "diff-*"+suffix))
+		if len(matches) != 1 {
+			t.Fatalf("Expected one diff-*%s in %s, got %v", suffix, profiles, matches)
+		}
+		if suffix == "-trace.out" {
+			data, _ := os.ReadFile(matches[0])
+			if !bytes.HasPrefix(data, []byte("go 1.")) {
+				t.Errorf("%s is not an execution trace", matches[0])
+			}
+			continue
+		}
+		run("go", "tool", "pprof", "-raw", matches[0])
+	}
+}
@@ -0,0 +1,82 @@
+package config_test
+
+import (
+	"bindiff/pkg/config"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestJSONSchemaCoversConfig(t *testing.T) {
+	schema := config.JSONSchema()
+	if _, err := json.Marshal(schema); err != nil {
+		t.Fatalf("schema does not marshal: %v", err)
+	}
+	if schema.AdditionalProperties == nil || *schema.AdditionalProperties {
+		t.Error("schema should reject unknown top-level keys")
+	}
+
+	// 每个配置项都出现在 Schema 中
+	for key := range config.DefaultConfig().Settings() {
+		s := schema
+		for _, part := range strings.Split(key, ".") {
+			s = s.Properties[part]
+			if s == nil {
+				t.Errorf("schema misses %s", key)
+				break
+			}
+		}
+	}
+
+	if got := schema.Properties["block_size"]; got.Type != "integer" || *got.Minimum != 1 || got.Default != 1024 {
+		t.Errorf("unexpected block_size schema: %+v", got)
+	}
+	if got := schema.Properties["log_level"].Enum; !slices.Contains(got, "debug") {
+		t.Errorf("log_level enum = %v", got)
+	}
+	if got := schema.Properties["profiles"].Items.Required; !slices.Equal(got, []string{"match"}) {
+		t.Errorf("profiles items required = %v", got)
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	tempDir := t.TempDir()
+	bad := filepath.Join(tempDir, "bad.yaml")
+	content := `
+blok_size: 3
+log_level: loud
+io:
+  sequental: true
+profiles:
+  - match: "*.gz"
+    stratgy: raw
+`
+	if err := os.WriteFile(bad, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := config.ValidateFile(bad)
+	var fields []string
+	for _, fe := range config.FieldErrors(err) {
+		fields = append(fields, fe.Field)
+	}
+	want := []string{"blok_size", "io.sequental", "profiles[0].stratgy", "log_level"}
+	if !slices.Equal(fields, want) {
+		t.Errorf("ValidateFile reported %v, want %v (err: %v)", fields, want, err)
+	}
+
+	good := filepath.Join(tempDir, "good.yaml")
+	if err := os.WriteFile(good, []byte("block_size: 2048\nio:\n  direct_io: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.ValidateFile(good); err != nil {
+		t.Errorf("ValidateFile(good) = %v", err)
+	}
+
+	if err := config.ValidateFile(filepath.Join(tempDir, "missing.yaml")); err == nil {
+		t.Error("ValidateFile should fail for a missing file")
+	}
+}
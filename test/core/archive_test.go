@@ -0,0 +1,266 @@
+package core_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bindiff/core"
+	"bindiff/types"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// archiveFile 测试归档中的一个条目
+type archiveFile struct {
+	name string
+	data []byte
+}
+
+// buildTar 按顺序构造 tar 归档
+func buildTar(t *testing.T, files []archiveFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(f.data)
+	}
+	tw.Close()
+	return buf.Bytes()
+}
+
+// buildZip 按顺序构造不压缩的 zip 归档
+func buildZip(t *testing.T, files []archiveFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(f.data)
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+// buildAr 按顺序构造 ar 归档（.deb 的外层格式），成员数据按 2 字节对齐
+func buildAr(t *testing.T, files []archiveFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.WriteString("!<arch>\n")
+	for _, f := range files {
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", f.name+"/", 0, 0, 0, "100644", len(f.data))
+		buf.Write(f.data)
+		if len(f.data)%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+// TestDiffArchive 测试条目重排、修改和重命名后的归档差分
+func TestDiffArchive(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	blob := func(n int) []byte {
+		b := make([]byte, n)
+		rng.Read(b)
+		return b
+	}
+	a, b, c := blob(40*1024), blob(30*1024), blob(20*1024)
+	modified := append([]byte(nil), b...)
+	copy(modified[1000:], "modified region")
+
+	oldFiles := []archiveFile{{"a.bin", a}, {"b.bin", b}, {"c.bin", c}}
+	// 重排、修改 b、将 c 移动到新目录并新增一个条目
+	newFiles := []archiveFile{{"moved/c.bin", c}, {"b.bin", modified}, {"new.txt", []byte("new entry")}, {"a.bin", a}}
+
+	for _, tc := range []struct {
+		name  string
+		build func(*testing.T, []archiveFile) []byte
+	}{
+		{"tar", buildTar},
+		{"zip", buildZip},
+		{"ar", buildAr},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			oldData, newData := tc.build(t, oldFiles), tc.build(t, newFiles)
+
+			patch, err := core.DiffArchive(oldData, newData, nil)
+			if err != nil {
+				t.Fatalf("DiffArchive failed: %v", err)
+			}
+			payload := core.EncodeArchivePatch(patch)
+			if len(payload) > len(newData)/10 {
+				t.Errorf("Archive patch is %d bytes for a %d byte archive", len(payload), len(newData))
+			}
+
+			decoded, err := core.DecodeArchivePatch(payload)
+			if err != nil {
+				t.Fatalf("DecodeArchivePatch failed: %v", err)
+			}
+			if err := core.ValidateArchivePatch(decoded, int64(len(oldData)), int64(len(newData))); err != nil {
+				t.Errorf("ValidateArchivePatch failed: %v", err)
+			}
+			got, err := core.ApplyArchive(oldData, decoded, nil)
+			if err != nil {
+				t.Fatalf("ApplyArchive failed: %v", err)
+			}
+			if !bytes.Equal(got, newData) {
+				t.Error("Archive not reconstructed bit-exactly")
+			}
+		})
+	}
+
+	if _, err := core.DiffArchive(buildTar(t, oldFiles), buildZip(t, newFiles), nil); !errors.Is(err, core.ErrNotArchive) {
+		t.Errorf("Expected ErrNotArchive for mixed formats, got %v", err)
+	}
+}
+
+// TestArchiveDiffFile 测试归档负载格式的补丁文件编解码与应用
+func TestArchiveDiffFile(t *testing.T) {
+	oldData := buildTar(t, []archiveFile{{"x", bytes.Repeat([]byte("x"), 5000)}, {"y", []byte("yyyy")}})
+	newData := buildTar(t, []archiveFile{{"y", []byte("yyyy!")}, {"x", bytes.Repeat([]byte("x"), 5000)}})
+
+	patch, err := core.DiffArchive(oldData, newData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	df := types.DiffFile{
+		MagicNumber: types.PATCH_MAGIC,
+		Version:     types.PATCH_VERSION,
+		Format:      types.FORMAT_ARCHIVE,
+		OldSize:     uint32(len(oldData)),
+		NewSize:     uint32(len(newData)),
+		OldHash:     core.ComputeHash(oldData),
+		NewHash:     core.ComputeHash(newData),
+		Payload:     core.EncodeArchivePatch(patch),
+	}
+	decoded, err := core.DecodeDiffFile(core.EncodeDiffFile(df))
+	if err != nil {
+		t.Fatalf("DecodeDiffFile failed: %v", err)
+	}
+	if decoded.Format != types.FORMAT_ARCHIVE {
+		t.Fatalf("Format not preserved: %d", decoded.Format)
+	}
+	if err := core.ValidateDiffFile(decoded); err != nil {
+		t.Errorf("ValidateDiffFile failed: %v", err)
+	}
+	got, err := core.ApplyDiffFile(oldData, decoded, nil)
+	if err != nil || !bytes.Equal(got, newData) {
+		t.Errorf("ApplyDiffFile failed: %v", err)
+	}
+
+	corrupt := append([]byte(nil), df.Payload...)
+	corrupt = corrupt[:len(corrupt)-3]
+	if _, err := core.DecodeArchivePatch(corrupt); !errors.Is(err, core.ErrCorruptPatch) {
+		t.Errorf("Expected ErrCorruptPatch for truncated payload, got %v", err)
+	}
+}
+
+// zipEntry 测试 zip 中的一个条目及其压缩方式
+type zipEntry struct {
+	name   string
+	method uint16
+	data   []byte
+}
+
+// buildAPK 构造类似 APK 的 zip：条目按 4 字节对齐（zipalign），中央目录前插入签名块
+func buildAPK(t *testing.T, entries []zipEntry, sigBlock []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: e.method}
+		// 对齐存储条目的数据：本地头 30 字节 + 文件名 + 4 字节额外字段头 + 填充
+		if e.method == zip.Store {
+			pad := (4 - (buf.Len()+30+len(e.name)+4)%4) % 4
+			hdr.Extra = append([]byte{0xd9, 0x35, byte(pad), 0}, make([]byte, pad)...)
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(e.data)
+		zw.Flush()
+	}
+	zw.Close()
+
+	data := buf.Bytes()
+	eocd := len(data) - 22
+	cdOffset := binary.LittleEndian.Uint32(data[eocd+16:])
+	out := append([]byte(nil), data[:cdOffset]...)
+	out = append(out, sigBlock...)
+	out = append(out, data[cdOffset:]...)
+	binary.LittleEndian.PutUint32(out[len(out)-22+16:], cdOffset+uint32(len(sigBlock)))
+	return out
+}
+
+// TestDiffAPK 测试 deflate 条目按解压内容差分、嵌套 jar 递归差分，且对齐与签名块逐字节保留
+func TestDiffAPK(t *testing.T) {
+	rng := rand.New(rand.NewSource(9))
+	text := func(n int) []byte {
+		words := []string{"invoke-virtual ", "const-string ", "return-void ", "move-result ", "\n"}
+		var b bytes.Buffer
+		for b.Len() < n {
+			b.WriteString(words[rng.Intn(len(words))])
+		}
+		return b.Bytes()[:n]
+	}
+	dex := text(300 * 1024)
+	arsc := text(40 * 1024)
+	innerClass := text(60 * 1024)
+
+	jar := func(class []byte) []byte {
+		return buildAPK(t, []zipEntry{{"META-INF/MANIFEST.MF", zip.Deflate, []byte("Manifest-Version: 1.0\n")}, {"a/B.class", zip.Deflate, class}}, nil)
+	}
+	oldAPK := buildAPK(t, []zipEntry{
+		{"AndroidManifest.xml", zip.Deflate, []byte("<manifest/>")},
+		{"classes.dex", zip.Deflate, dex},
+		{"resources.arsc", zip.Store, arsc},
+		{"lib/inner.jar", zip.Store, jar(innerClass)},
+		{"assets/plugin.jar", zip.Deflate, jar(innerClass)},
+	}, append([]byte("APK Sig Block 42"), bytes.Repeat([]byte{1}, 4096)...))
+
+	newDex := append([]byte(nil), dex...)
+	copy(newDex[150000:], "invoke-static ")
+	newClass := append([]byte(nil), innerClass...)
+	copy(newClass[30000:], "return-object ")
+	newAPK := buildAPK(t, []zipEntry{
+		{"AndroidManifest.xml", zip.Deflate, []byte("<manifest/>")},
+		{"classes.dex", zip.Deflate, newDex},
+		{"resources.arsc", zip.Store, arsc},
+		{"lib/inner.jar", zip.Store, jar(newClass)},
+		{"assets/plugin.jar", zip.Deflate, jar(newClass)},
+	}, append([]byte("APK Sig Block 42"), bytes.Repeat([]byte{2}, 4096)...))
+
+	patch, err := core.DiffArchive(oldAPK, newAPK, nil)
+	if err != nil {
+		t.Fatalf("DiffArchive failed: %v", err)
+	}
+	payload := core.EncodeArchivePatch(patch)
+	if len(payload) > 8*1024 {
+		t.Errorf("APK patch is %d bytes, expected only the changed regions and signature block", len(payload))
+	}
+
+	decoded, err := core.DecodeArchivePatch(payload)
+	if err != nil {
+		t.Fatalf("DecodeArchivePatch failed: %v", err)
+	}
+	if err := core.ValidateArchivePatch(decoded, int64(len(oldAPK)), int64(len(newAPK))); err != nil {
+		t.Errorf("ValidateArchivePatch failed: %v", err)
+	}
+	got, err := core.ApplyArchive(oldAPK, decoded, nil)
+	if err != nil {
+		t.Fatalf("ApplyArchive failed: %v", err)
+	}
+	if !bytes.Equal(got, newAPK) {
+		t.Error("APK not reconstructed bit-exactly")
+	}
+}
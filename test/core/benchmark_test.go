@@ -244,3 +244,19 @@ func BenchmarkMultipleFiles(b *testing.B) {
 		}
 	})
 }
+
+// BenchmarkShiftedData 测试插入后数据整体平移时的块匹配性能（滚动校验逐字节扫描）
+func BenchmarkShiftedData(b *testing.B) {
+	suite := NewBenchmarkSuite(8*1024*1024, 0)
+	newData := append([]byte("shifted by a short header"), suite.oldData...)
+	cfg := config.DefaultConfig()
+	cfg.MaxMemoryMB = 1024
+
+	b.SetBytes(int64(len(newData)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := core.DiffBytes(suite.oldData, newData, &core.DiffOptions{Config: cfg}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
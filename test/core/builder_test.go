@@ -0,0 +1,72 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// TestPatchBuilder 测试以编程方式构造补丁
+func TestPatchBuilder(t *testing.T) {
+	oldData := []byte("HDR1 payload that stays the same, trailing bytes")
+	expected := []byte("HDR2 payload that stays the same! trailing")
+
+	b := core.NewPatchBuilder(oldData).SetNames("app-v1.bin", "app-v2.bin")
+	steps := []error{
+		b.AppendReplace(3, []byte("2")),
+		b.AppendCopy(4, 28),
+		b.AppendDelete(32, 1),
+		b.AppendInsert(33, []byte("!")),
+		b.AppendCopy(33, 9),
+		b.AppendDelete(42, int64(len(oldData))-42),
+	}
+	for i, err := range steps {
+		if err != nil {
+			t.Fatalf("Step %d failed: %v", i, err)
+		}
+	}
+
+	df, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if string(df.NewFileName) != "app-v2.bin" || df.NewSize != uint32(len(expected)) {
+		t.Errorf("Unexpected header: name=%s size=%d", df.NewFileName, df.NewSize)
+	}
+
+	decoded, err := core.DecodeDiffFile(core.EncodeDiffFile(df))
+	if err != nil {
+		t.Fatalf("DecodeDiffFile failed: %v", err)
+	}
+	if err := core.ValidatePatch(decoded.Diff, int64(decoded.OldSize), int64(decoded.NewSize)); err != nil {
+		t.Errorf("Built patch fails validation: %v", err)
+	}
+	result, err := core.Apply(oldData, decoded.Diff, nil)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !bytes.Equal(result, expected) {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+	if err := core.VerifyHash(decoded.HashAlgorithm, result, decoded.NewHash, nil); err != nil {
+		t.Errorf("Result hash does not verify: %v", err)
+	}
+
+	t.Run("invariants", func(t *testing.T) {
+		b := core.NewPatchBuilder(oldData)
+		if err := b.AppendCopy(10, 5); err != nil {
+			t.Fatalf("AppendCopy failed: %v", err)
+		}
+		var patchErr *core.PatchError
+		if err := b.AppendInsert(12, []byte("x")); !errors.As(err, &patchErr) {
+			t.Errorf("Expected *core.PatchError for unordered offset, got %v", err)
+		}
+		if err := b.AppendCopy(20, 1000); !errors.As(err, &patchErr) {
+			t.Errorf("Expected *core.PatchError for overrun, got %v", err)
+		}
+		if len(b.Patches()) != 1 {
+			t.Errorf("Rejected operations must not be recorded, got %d", len(b.Patches()))
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// TestChunkBoundaries 测试内容定义分块的大小约束与插入后的稳定性
+func TestChunkBoundaries(t *testing.T) {
+	data := make([]byte, 512*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	chunks := core.Chunk(data, nil)
+	if !bytes.Equal(bytes.Join(chunks, nil), data) {
+		t.Fatal("Chunks do not reassemble to the input")
+	}
+	for i, c := range chunks {
+		if len(c) > core.DefaultChunkMax {
+			t.Errorf("Chunk %d exceeds max size: %d", i, len(c))
+		}
+		if len(c) < core.DefaultChunkMin && i != len(chunks)-1 {
+			t.Errorf("Chunk %d below min size: %d", i, len(c))
+		}
+	}
+
+	// 在开头插入数据后，绝大多数块应保持不变
+	shifted := append([]byte("inserted prefix"), data...)
+	before := make(map[string]bool)
+	for _, c := range chunks {
+		before[string(c)] = true
+	}
+	shared := 0
+	after := core.Chunk(shifted, nil)
+	for _, c := range after {
+		if before[string(c)] {
+			shared++
+		}
+	}
+	if shared < len(chunks)-2 {
+		t.Errorf("Only %d of %d chunks survived a prefix insertion", shared, len(chunks))
+	}
+}
@@ -0,0 +1,122 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/types"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+)
+
+// TestDiffFileChecksum 测试补丁文件尾部的整体校验和：编码时写出，解码时在解析之前检查
+func TestDiffFileChecksum(t *testing.T) {
+	oldData := bytes.Repeat([]byte("checksum footer "), 200)
+	newData := append([]byte("prefix "), oldData...)
+	df := newTestDiffFile(t, types.HASH_SHA256, oldData, newData)
+	encoded := core.EncodeDiffFile(df)
+
+	n := len(encoded) - 4
+	want := crc32.Checksum(encoded[:n], crc32.MakeTable(crc32.Castagnoli))
+	if got := binary.LittleEndian.Uint32(encoded[n:]); got != want {
+		t.Fatalf("footer = %08x, want crc32c %08x", got, want)
+	}
+	if _, err := core.DecodeDiffFile(encoded); err != nil {
+		t.Fatalf("DecodeDiffFile failed: %v", err)
+	}
+
+	// 头、差分数据与尾部任一处损坏都报告为校验和错误，而不是头错误或哈希不一致
+	for name, pos := range map[string]int{"header": 20, "data": n - 10, "footer": n + 1} {
+		t.Run(name, func(t *testing.T) {
+			bad := bytes.Clone(encoded)
+			bad[pos] ^= 0x40
+			var sumErr *core.ChecksumError
+			_, err := core.DecodeDiffFile(bad)
+			if !errors.As(err, &sumErr) || !errors.Is(err, core.ErrPatchChecksum) || !errors.Is(err, core.ErrCorruptPatch) {
+				t.Fatalf("DecodeDiffFile = %v, want *ChecksumError", err)
+			}
+			if _, err := core.VerifyDiffFileChecksum(bytes.NewReader(bad)); !errors.Is(err, core.ErrCorruptPatch) {
+				t.Errorf("VerifyDiffFileChecksum = %v, want ErrCorruptPatch", err)
+			}
+		})
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		if _, err := core.DecodeDiffFile(encoded[:n-100]); !errors.Is(err, core.ErrPatchChecksum) {
+			t.Errorf("DecodeDiffFile = %v, want ErrPatchChecksum", err)
+		}
+		if _, err := core.VerifyDiffFileChecksum(bytes.NewReader(encoded[:n-100])); !errors.Is(err, core.ErrCorruptPatch) {
+			t.Errorf("VerifyDiffFileChecksum = %v, want ErrCorruptPatch", err)
+		}
+	})
+
+	t.Run("trailing_bytes", func(t *testing.T) {
+		trailing := append(bytes.Clone(encoded), 0, 0, 0, 0)
+		if _, err := core.DecodeDiffFile(trailing); !errors.Is(err, core.ErrCorruptPatch) {
+			t.Errorf("DecodeDiffFile = %v, want ErrCorruptPatch", err)
+		}
+	})
+
+	t.Run("version_3_compat", func(t *testing.T) {
+		v3, v4 := df, df
+		v3.Version = types.PATCH_VERSION_V3
+		v4.Version = types.PATCH_VERSION_V4
+		old := core.EncodeDiffFile(v3)
+		if want := len(core.EncodeDiffFile(v4)) - 4; len(old) != want {
+			t.Errorf("version 3 patch is %d bytes, want %d without footer", len(old), want)
+		}
+		decoded, err := core.DecodeDiffFile(old)
+		if err != nil || decoded.Version != types.PATCH_VERSION_V3 {
+			t.Fatalf("DecodeDiffFile = %v (version %d)", err, decoded.Version)
+		}
+		if !bytes.Equal(core.EncodeDiffFile(decoded), old) {
+			t.Error("version 3 patch is not stable across decode/encode")
+		}
+		if _, err := core.VerifyDiffFileChecksum(bytes.NewReader(old)); err != nil {
+			t.Errorf("VerifyDiffFileChecksum on version 3 = %v", err)
+		}
+	})
+}
+
+// TestApplyStreamChecksum 测试流式应用检查校验和：可定位的补丁在写出之前拒绝，
+// 不能定位的补丁在结束时报告校验和错误而不是哈希不一致
+func TestApplyStreamChecksum(t *testing.T) {
+	oldData := bytes.Repeat([]byte("stream checksum "), 500)
+	newData := append(bytes.Clone(oldData[:4000]), "changed"...)
+	newData = append(newData, oldData[4000:]...)
+	encoded := core.EncodeDiffFile(newTestDiffFile(t, types.HASH_SHA256, oldData, newData))
+	// 损坏差分数据末尾附近的一个字节，没有校验和时只能在应用中途或结果校验时发现
+	bad := bytes.Clone(encoded)
+	bad[len(bad)-30] ^= 0x01
+
+	var out bytes.Buffer
+	if _, err := core.ApplyDiffFileStream(bytes.NewReader(oldData), bytes.NewReader(encoded), &out, nil); err != nil {
+		t.Fatalf("ApplyDiffFileStream failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), newData) {
+		t.Fatal("streamed result differs")
+	}
+
+	out.Reset()
+	_, err := core.ApplyDiffFileStream(bytes.NewReader(oldData), bytes.NewReader(bad), &out,
+		&core.ApplyOptions{VerifyResult: true})
+	if !errors.Is(err, core.ErrPatchChecksum) {
+		t.Errorf("seekable: ApplyDiffFileStream = %v, want ErrPatchChecksum", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("seekable: wrote %d bytes before rejecting the patch", out.Len())
+	}
+
+	// io.MultiReader 隐藏 Seek，校验和边读边计算
+	_, err = core.ApplyDiffFileStream(bytes.NewReader(oldData), io.MultiReader(bytes.NewReader(bad)), io.Discard,
+		&core.ApplyOptions{VerifyResult: true})
+	if !errors.Is(err, core.ErrPatchChecksum) {
+		t.Errorf("non-seekable: ApplyDiffFileStream = %v, want ErrPatchChecksum", err)
+	}
+	if _, err := core.ApplyDiffFileStream(bytes.NewReader(oldData), io.MultiReader(bytes.NewReader(encoded)), io.Discard,
+		&core.ApplyOptions{VerifyResult: true}); err != nil {
+		t.Errorf("non-seekable: ApplyDiffFileStream failed: %v", err)
+	}
+}
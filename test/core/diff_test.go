@@ -4,8 +4,12 @@ import (
 	"bindiff/core"
 	"bindiff/pkg/config"
 	"bindiff/types"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
 	"time"
 )
@@ -257,6 +261,156 @@ func TestParallelDiff(t *testing.T) {
 	}
 }
 
+// TestBlockMatching 测试块匹配找回插入与删除后平移的数据，且输出与工作线程数无关
+func TestBlockMatching(t *testing.T) {
+	// 跨越多个扫描区间
+	oldData := make([]byte, 3<<20)
+	x := uint32(7)
+	for i := range oldData {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		oldData[i] = byte(x)
+	}
+	newData := append([]byte(nil), oldData[:100000]...)
+	newData = append(newData, "inserted bytes"...)
+	newData = append(newData, oldData[100000:1500000]...)
+	newData = append(newData, oldData[1600000:]...) // 删除 100000 字节
+
+	var reference []byte
+	for _, workers := range []int{1, 4} {
+		options := &core.DiffOptions{
+			Config: &config.Config{
+				MaxWorkers:     workers,
+				UseParallel:    true,
+				BlockSize:      1024,
+				MinMatchLength: 64,
+				MaxMemoryMB:    512,
+			},
+		}
+		patches, err := core.DiffBytes(oldData, newData, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := core.ValidatePatch(patches, int64(len(oldData)), int64(len(newData))); err != nil {
+			t.Fatalf("Invalid patch with %d workers: %v", workers, err)
+		}
+		result, err := core.Apply(oldData, patches, nil)
+		if err != nil || !bytes.Equal(result, newData) {
+			t.Fatalf("Patch with %d workers does not reproduce new data: %v", workers, err)
+		}
+		encoded := core.EncodePatch(patches)
+		if len(encoded) > 1024 {
+			t.Errorf("Expected shifted data to be copied, patch is %d bytes", len(encoded))
+		}
+		if reference == nil {
+			reference = encoded
+		} else if !bytes.Equal(encoded, reference) {
+			t.Errorf("Output with %d workers differs from single worker", workers)
+		}
+	}
+}
+
+// TestMemoryBudget 测试内存预算不足时放大块大小、减少并发，仍然生成有效且紧凑的补丁
+func TestMemoryBudget(t *testing.T) {
+	oldData := make([]byte, 8<<20)
+	x := uint32(11)
+	for i := range oldData {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		oldData[i] = byte(x)
+	}
+	newData := append([]byte("prefix"), oldData[:5<<20]...)
+	newData = append(newData, oldData[5<<20+3000:]...)
+
+	for _, budget := range []int{0, 1, 512} {
+		cfg := &config.Config{
+			MaxWorkers:     4,
+			UseParallel:    true,
+			BlockSize:      1024,
+			MinMatchLength: 64,
+			MaxMemoryMB:    budget,
+		}
+		options := &core.DiffOptions{Config: cfg}
+		patches, err := core.DiffBytes(oldData, newData, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := core.ValidatePatch(patches, int64(len(oldData)), int64(len(newData))); err != nil {
+			t.Fatalf("Invalid patch with a %d MB budget: %v", budget, err)
+		}
+		result, err := core.Apply(oldData, patches, nil)
+		if err != nil || !bytes.Equal(result, newData) {
+			t.Fatalf("Patch with a %d MB budget does not reproduce new data: %v", budget, err)
+		}
+		if size := len(core.EncodePatch(patches)); size > 1024 {
+			t.Errorf("Expected shifted data to be copied with a %d MB budget, patch is %d bytes", budget, size)
+		}
+	}
+
+	small := &core.DiffOptions{Config: &config.Config{BlockSize: 1024, MaxMemoryMB: 1}}
+	large := &core.DiffOptions{Config: &config.Config{BlockSize: 1024, MaxMemoryMB: 512}}
+	n := int64(len(oldData))
+	if core.EstimateMemory(n, n, small) >= core.EstimateMemory(n, n, large) {
+		t.Error("Expected a smaller budget to shrink the estimated index memory")
+	}
+}
+
+// TestDiffReportsPeakMemory 测试差分结果带有内存峰值，且至少包含输入数据
+func TestDiffReportsPeakMemory(t *testing.T) {
+	oldData := bytes.Repeat([]byte("bindiff peak memory "), 1<<16)
+	newData := append([]byte("header"), oldData...)
+
+	result, err := core.DiffFull(oldData, newData, &core.DiffOptions{Config: config.DefaultConfig()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Memory.HeapBytes < uint64(len(oldData)+len(newData)) {
+		t.Errorf("DiffFull peak heap %d is below the %d input bytes", result.Memory.HeapBytes, len(oldData)+len(newData))
+	}
+	if result.Memory.RSSBytes == 0 {
+		t.Error("DiffFull reported no RSS")
+	}
+
+	_, payloadResult, _, err := core.DiffPayload(oldData, newData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payloadResult.Memory.HeapBytes == 0 {
+		t.Error("DiffPayload reported no peak heap")
+	}
+}
+
+// TestRunBoundaries 测试按字比较时各种对齐位置上的操作边界都精确到字节
+func TestRunBoundaries(t *testing.T) {
+	oldData := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	for pos := 0; pos < len(oldData); pos++ {
+		for _, width := range []int{1, 3, 9} {
+			if pos+width > len(oldData) {
+				continue
+			}
+			newData := append([]byte(nil), oldData...)
+			for i := pos; i < pos+width; i++ {
+				newData[i] = '#'
+			}
+			patches, err := core.DiffBytes(oldData, newData, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var replaced []types.Patch
+			for _, p := range patches {
+				if p.Op == types.OP_REPLACE {
+					replaced = append(replaced, p)
+				}
+			}
+			if len(replaced) != 1 || replaced[0].Offset != int64(pos) || replaced[0].Length != int64(width) {
+				t.Errorf("Edit at %d width %d: got %+v", pos, width, patches)
+			}
+		}
+	}
+}
+
 // TestOptimizePatches 测试补丁优化
 func TestOptimizePatches(t *testing.T) {
 	patches := []types.Patch{
@@ -313,6 +467,17 @@ func TestContextCancellation(t *testing.T) {
 	// 这个测试可能会或不会被取消，取决于执行速度
 	patches := core.DiffWithOptions(oldData, newData, options)
 	t.Logf("Generated %d patches before cancellation (if any)", len(patches))
+
+	// 超时后新接口必须返回 DeadlineExceeded，而不是部分结果
+	<-ctx.Done()
+	patches, err := core.DiffBytes(oldData, newData, options)
+	if !errors.Is(err, context.DeadlineExceeded) || patches != nil {
+		t.Errorf("Expected DeadlineExceeded and no patches, got %d patches, err=%v", len(patches), err)
+	}
+
+	if _, err := core.ComputeOffsetWithContext(ctx, oldData[:1024], newData[:1024]); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded from ComputeOffsetWithContext, got %v", err)
+	}
 }
 
 // BenchmarkDiff 基准测试差分性能
@@ -377,3 +542,406 @@ func TestErrorHandling(t *testing.T) {
 		}
 	})
 }
+
+// TestDiffBytesAndApply 测试返回错误的差分与应用接口
+func TestDiffBytesAndApply(t *testing.T) {
+	oldData := []byte("The quick brown fox jumps over the lazy dog")
+	newData := []byte("The quick red fox jumps over the sleepy cat!")
+
+	patches, err := core.DiffBytes(oldData, newData, nil)
+	if err != nil {
+		t.Fatalf("DiffBytes failed: %v", err)
+	}
+
+	result, err := core.Apply(oldData, patches, nil)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if string(result) != string(newData) {
+		t.Errorf("Apply result mismatch.\nExpected: %q\nGot: %q", string(newData), string(result))
+	}
+
+	t.Run("cancelled_context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := core.DiffBytes(oldData, newData, &core.DiffOptions{
+			Config:  config.DefaultConfig(),
+			Context: ctx,
+		})
+		if !errors.Is(err, context.Canceled) || !errors.Is(err, core.ErrCancelled) {
+			t.Errorf("Expected context.Canceled from DiffBytes, got %v", err)
+		}
+
+		_, err = core.Apply(oldData, patches, &core.ApplyOptions{Context: ctx})
+		if !errors.Is(err, context.Canceled) || !errors.Is(err, core.ErrCancelled) {
+			t.Errorf("Expected context.Canceled from Apply, got %v", err)
+		}
+	})
+
+	t.Run("invalid_offset", func(t *testing.T) {
+		invalid := []types.Patch{
+			{Op: types.OP_COPY, Offset: 1000, Length: 5},
+		}
+		if _, err := core.Apply([]byte("hello"), invalid, nil); err == nil {
+			t.Error("Expected error for offset beyond old data")
+		}
+	})
+}
+
+// TestApplyStrictMode 测试严格模式下的补丁条目校验
+func TestApplyStrictMode(t *testing.T) {
+	oldData := []byte("hello")
+
+	tests := []struct {
+		name    string
+		patches []types.Patch
+		index   int
+	}{
+		{
+			name:    "offset_overflow",
+			patches: []types.Patch{{Op: types.OP_COPY, Offset: 1000, Length: 5}},
+			index:   0,
+		},
+		{
+			name: "copy_overrun",
+			patches: []types.Patch{
+				{Op: types.OP_COPY, Offset: 0, Length: 2},
+				{Op: types.OP_COPY, Offset: 2, Length: 10},
+			},
+			index: 1,
+		},
+		{
+			name:    "replace_overrun",
+			patches: []types.Patch{{Op: types.OP_REPLACE, Offset: 3, Length: 4, Data: []byte("abcd")}},
+			index:   0,
+		},
+		{
+			name:    "unknown_op",
+			patches: []types.Patch{{Op: types.Operator(0x7f), Offset: 0, Length: 1}},
+			index:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := core.Apply(oldData, tt.patches, nil)
+			var patchErr *core.PatchError
+			if !errors.As(err, &patchErr) {
+				t.Fatalf("Expected *core.PatchError, got %v", err)
+			}
+			if patchErr.Index != tt.index {
+				t.Errorf("Expected error at entry %d, got %d", tt.index, patchErr.Index)
+			}
+
+			// 宽松模式保持旧行为
+			if _, err := core.Apply(oldData, tt.patches, &core.ApplyOptions{Lenient: true}); err != nil {
+				t.Errorf("Lenient apply should not fail: %v", err)
+			}
+		})
+	}
+}
+
+// TestProgressReporter 测试进度回调
+func TestProgressReporter(t *testing.T) {
+	oldData := make([]byte, 64*1024)
+	newData := make([]byte, 64*1024)
+	for i := range newData {
+		newData[i] = byte(i % 7)
+	}
+
+	var calls int
+	var last, lastTotal int64
+	reporter := core.ProgressFunc(func(stage string, current, total int64) {
+		if stage != core.ProgressStageDiff {
+			t.Errorf("Unexpected stage %q", stage)
+		}
+		if current < last {
+			t.Errorf("Progress went backwards: %d -> %d", last, current)
+		}
+		calls++
+		last, lastTotal = current, total
+	})
+
+	_, err := core.DiffBytes(oldData, newData, &core.DiffOptions{
+		Config:   config.DefaultConfig(),
+		Context:  context.Background(),
+		Progress: reporter,
+	})
+	if err != nil {
+		t.Fatalf("DiffBytes failed: %v", err)
+	}
+	if calls < 2 || calls > 102 {
+		t.Errorf("Expected throttled progress callbacks, got %d", calls)
+	}
+	if last != lastTotal || lastTotal != int64(len(newData)) {
+		t.Errorf("Expected final progress %d/%d, got %d/%d", len(newData), len(newData), last, lastTotal)
+	}
+}
+
+// TestComputeHashWithReporter 测试带进度的哈希计算与保留的布尔参数形式结果一致
+func TestComputeHashWithReporter(t *testing.T) {
+	data := bytes.Repeat([]byte("hash progress "), 200*1024)
+	want := core.ComputeHash(data)
+
+	var last, lastTotal int64
+	got := core.ComputeHashWithReporter(data, core.ProgressFunc(func(stage string, current, total int64) {
+		if stage != core.ProgressStageHash {
+			t.Errorf("Unexpected stage %q", stage)
+		}
+		last, lastTotal = current, total
+	}))
+	if !bytes.Equal(got, want) {
+		t.Error("ComputeHashWithReporter differs from ComputeHash")
+	}
+	if last != lastTotal || lastTotal != int64(len(data)) {
+		t.Errorf("Expected final progress %d/%d, got %d/%d", len(data), len(data), last, lastTotal)
+	}
+	if !bytes.Equal(core.ComputeHashWithReporter(data, nil), want) {
+		t.Error("ComputeHashWithReporter without a reporter differs from ComputeHash")
+	}
+	if !bytes.Equal(core.ComputeHashWithProgress(data, false), want) {
+		t.Error("ComputeHashWithProgress differs from ComputeHash")
+	}
+}
+
+// TestFunctionalOptions 测试函数式选项
+func TestFunctionalOptions(t *testing.T) {
+	options := core.NewDiffOptions(
+		core.WithBlockSize(256),
+		core.WithMinMatchLength(16),
+		core.WithWorkers(8),
+		core.WithFFT(false),
+	)
+	if options.Config.BlockSize != 256 || options.Config.MinMatchLength != 16 {
+		t.Errorf("Block options not applied: %+v", options.Config)
+	}
+	if options.Config.MaxWorkers != 8 || !options.Config.UseParallel {
+		t.Errorf("Worker options not applied: %+v", options.Config)
+	}
+	if options.Config.EnableFFT {
+		t.Error("WithFFT(false) not applied")
+	}
+
+	// WithConfig 使用副本，不修改调用方的配置
+	base := config.DefaultConfig()
+	options = core.NewDiffOptions(core.WithConfig(base), core.WithBlockSize(64))
+	if base.BlockSize != 1024 || options.Config.BlockSize != 64 {
+		t.Errorf("WithConfig should copy the config: base=%d, options=%d",
+			base.BlockSize, options.Config.BlockSize)
+	}
+
+	oldData := []byte("hello world")
+	newData := []byte("hello brave new world")
+	patches, err := core.DiffWith(oldData, newData, core.WithWorkers(2))
+	if err != nil {
+		t.Fatalf("DiffWith failed: %v", err)
+	}
+	result, err := core.ApplyWith(oldData, patches)
+	if err != nil {
+		t.Fatalf("ApplyWith failed: %v", err)
+	}
+	if string(result) != string(newData) {
+		t.Errorf("Round trip mismatch: %q", result)
+	}
+
+	if len(core.Diff(oldData, newData, core.WithWorkers(8))) == 0 {
+		t.Error("Diff with options should produce patches")
+	}
+}
+
+// TestLifecycleHooks 测试生命周期钩子
+func TestLifecycleHooks(t *testing.T) {
+	oldData := []byte("Hello, World! This is a test.")
+	newData := []byte("Hello, Go! This is a longer test with more data.")
+
+	var events []string
+	var matched, applied int
+	hooks := &core.Hooks{
+		OnStart: func(op string, oldSize, newSize int64) {
+			events = append(events, "start:"+op)
+		},
+		OnBlockMatched: func(patch types.Patch) { matched++ },
+		OnOpApplied:    func(index int, patch types.Patch) { applied++ },
+		OnVerify: func(algo types.HashAlgorithm, expected, actual []byte, ok bool) {
+			events = append(events, fmt.Sprintf("verify:%v", ok))
+		},
+		OnComplete: func(op string, elapsed time.Duration, err error) {
+			events = append(events, fmt.Sprintf("complete:%s:%v", op, err))
+		},
+	}
+
+	patches, err := core.DiffWith(oldData, newData, core.WithHooks(hooks))
+	if err != nil {
+		t.Fatalf("DiffWith failed: %v", err)
+	}
+	result, err := core.ApplyWith(oldData, patches, core.WithHooks(hooks))
+	if err != nil {
+		t.Fatalf("ApplyWith failed: %v", err)
+	}
+	if err := core.VerifyHash(types.HASH_SHA256, result, core.ComputeHash(newData), hooks); err != nil {
+		t.Errorf("VerifyHash failed: %v", err)
+	}
+	if err := core.VerifyHash(types.HASH_SHA256, oldData, core.ComputeHash(newData), hooks); err == nil {
+		t.Error("Expected hash mismatch")
+	}
+
+	expected := []string{"start:diff", "complete:diff:<nil>", "start:apply", "complete:apply:<nil>", "verify:true", "verify:false"}
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Errorf("Unexpected events: %v", events)
+	}
+	if matched == 0 {
+		t.Error("OnBlockMatched was not called")
+	}
+	if applied != len(patches) {
+		t.Errorf("Expected %d OnOpApplied calls, got %d", len(patches), applied)
+	}
+}
+
+// TestDiffFull 测试返回统计信息的差分接口
+func TestDiffFull(t *testing.T) {
+	oldData := []byte("Hello, World! This is a test.")
+	newData := []byte("Hello, Go! This is a longer test with more data.")
+
+	result, err := core.DiffFull(oldData, newData, nil)
+	if err != nil {
+		t.Fatalf("DiffFull failed: %v", err)
+	}
+	if result.OldSize != int64(len(oldData)) || result.NewSize != int64(len(newData)) {
+		t.Errorf("Unexpected sizes: old=%d new=%d", result.OldSize, result.NewSize)
+	}
+	if len(result.Patches) == 0 {
+		t.Fatal("Expected patches")
+	}
+	encoded := float64(len(core.EncodePatch(result.Patches))) / float64(len(newData))
+	if result.CompressionRatio != encoded {
+		t.Errorf("Compression ratio %f does not match encoded size ratio %f", result.CompressionRatio, encoded)
+	}
+	if result.ProcessTime <= 0 {
+		t.Error("Expected positive process time")
+	}
+	expected := int32(core.ComputeOffset(oldData, newData))
+	if result.AlignConfidence < core.MinAlignConfidence {
+		expected = 0
+	}
+	if result.Offset != expected {
+		t.Errorf("Expected offset %d, got %d", expected, result.Offset)
+	}
+}
+
+// TestAlignmentConfidence 测试对齐置信度：确实平移的数据置信度高，无关的数据回退为偏移量 0
+func TestAlignmentConfidence(t *testing.T) {
+	random := func(n int, seed uint32) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			seed = seed*1664525 + 1013904223
+			b[i] = byte(seed >> 24)
+		}
+		return b
+	}
+	oldData := random(100000, 1)
+	shifted := append(random(500, 2), oldData...)
+
+	align, err := core.ComputeAlignment(context.Background(), oldData, shifted, nil)
+	if err != nil {
+		t.Fatalf("ComputeAlignment failed: %v", err)
+	}
+	if align.Offset != -500 || align.Confidence < core.MinAlignConfidence {
+		t.Errorf("Shifted data: got %+v, expected offset -500 with high confidence", align)
+	}
+
+	unrelated := random(100000, 3)
+	align, err = core.ComputeAlignment(context.Background(), oldData, unrelated, nil)
+	if err != nil {
+		t.Fatalf("ComputeAlignment failed: %v", err)
+	}
+	if align.Confidence >= core.MinAlignConfidence {
+		t.Errorf("Unrelated data: confidence %f should be below %f", align.Confidence, core.MinAlignConfidence)
+	}
+
+	log := &recordingLogger{}
+	result, err := core.DiffFull(oldData, unrelated, &core.DiffOptions{Logger: log})
+	if err != nil {
+		t.Fatalf("DiffFull failed: %v", err)
+	}
+	if result.Offset != 0 || result.AlignConfidence != align.Confidence {
+		t.Errorf("Expected fallback to offset 0 with confidence %f, got %d (%f)",
+			align.Confidence, result.Offset, result.AlignConfidence)
+	}
+	fellBack := false
+	for _, m := range log.messages {
+		fellBack = fellBack || strings.Contains(m, "using offset 0")
+	}
+	if !fellBack && align.Offset != 0 {
+		t.Errorf("Expected a log entry for the fallback, got %v", log.messages)
+	}
+}
+
+// recordingLogger 记录日志消息的测试日志器
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Debugf(template string, args ...interface{}) { l.record(template, args) }
+func (l *recordingLogger) Infof(template string, args ...interface{})  { l.record(template, args) }
+func (l *recordingLogger) Warnf(template string, args ...interface{})  { l.record(template, args) }
+func (l *recordingLogger) Errorf(template string, args ...interface{}) { l.record(template, args) }
+
+func (l *recordingLogger) record(template string, args []interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(template, args...))
+}
+
+// TestInjectedLogger 测试通过选项注入日志器
+func TestInjectedLogger(t *testing.T) {
+	log := &recordingLogger{}
+	oldData := []byte("Hello, World!")
+	newData := []byte("Hello, Go!")
+
+	patches, err := core.DiffWith(oldData, newData, core.WithLogger(log))
+	if err != nil {
+		t.Fatalf("DiffWith failed: %v", err)
+	}
+	if _, err := core.ApplyWith(oldData, patches, core.WithLogger(log)); err != nil {
+		t.Fatalf("ApplyWith failed: %v", err)
+	}
+	if len(log.messages) < 2 {
+		t.Errorf("Expected injected logger to receive messages, got %v", log.messages)
+	}
+}
+
+// TestApplyInto 测试写入调用方缓冲区的应用接口
+func TestApplyInto(t *testing.T) {
+	oldData := make([]byte, 256*1024)
+	for i := range oldData {
+		oldData[i] = byte(i % 251)
+	}
+	newData := append([]byte("header"), oldData...)
+	copy(newData[100000:], "modified region")
+
+	patches, err := core.DiffBytes(oldData, newData, nil)
+	if err != nil {
+		t.Fatalf("DiffBytes failed: %v", err)
+	}
+
+	dst := make([]byte, len(newData)+100)
+	n, err := core.ApplyInto(dst, oldData, patches, nil)
+	if err != nil {
+		t.Fatalf("ApplyInto failed: %v", err)
+	}
+	if n != len(newData) || !bytes.Equal(dst[:n], newData) {
+		t.Error("ApplyInto result mismatch")
+	}
+
+	// 结果缓冲区由调用方提供，每次调用的分配与数据大小无关
+	options := &core.ApplyOptions{}
+	allocs := testing.AllocsPerRun(10, func() {
+		core.ApplyInto(dst, oldData, patches, options)
+	})
+	if allocs > 8 {
+		t.Errorf("Expected only constant allocations, got %.0f per call", allocs)
+	}
+
+	if _, err := core.ApplyInto(dst[:len(newData)-1], oldData, patches, nil); !errors.Is(err, io.ErrShortBuffer) {
+		t.Errorf("Expected io.ErrShortBuffer for small buffer, got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/types"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// TestDiffFS 测试基于 fs.FS 的目录差分
+func TestDiffFS(t *testing.T) {
+	oldFS := fstest.MapFS{
+		"same.bin":         {Data: []byte("unchanged content")},
+		"assets/model.bin": {Data: []byte("model version one")},
+		"removed.txt":      {Data: []byte("gone")},
+	}
+	newFS := fstest.MapFS{
+		"same.bin":         {Data: []byte("unchanged content")},
+		"assets/model.bin": {Data: []byte("model version two!")},
+		"assets/new.bin":   {Data: []byte("brand new")},
+	}
+
+	diffs, err := core.DiffFS(oldFS, newFS, nil)
+	if err != nil {
+		t.Fatalf("DiffFS failed: %v", err)
+	}
+
+	expected := map[string]types.FileChangeKind{
+		"assets/model.bin": types.FILE_MODIFIED,
+		"assets/new.bin":   types.FILE_ADDED,
+		"removed.txt":      types.FILE_REMOVED,
+		"same.bin":         types.FILE_UNCHANGED,
+	}
+	if len(diffs) != len(expected) {
+		t.Fatalf("Expected %d entries, got %d", len(expected), len(diffs))
+	}
+	for i, fd := range diffs {
+		if i > 0 && diffs[i-1].Path >= fd.Path {
+			t.Errorf("Entries not sorted: %s before %s", diffs[i-1].Path, fd.Path)
+		}
+		if expected[fd.Path] != fd.Kind {
+			t.Errorf("%s: expected kind %d, got %d", fd.Path, expected[fd.Path], fd.Kind)
+		}
+	}
+
+	outDir := t.TempDir()
+	if err := core.ApplyFS(oldFS, diffs, outDir, nil); err != nil {
+		t.Fatalf("ApplyFS failed: %v", err)
+	}
+	for path, file := range newFS {
+		got, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(path)))
+		if err != nil {
+			t.Errorf("Missing output %s: %v", path, err)
+			continue
+		}
+		if string(got) != string(file.Data) {
+			t.Errorf("%s: expected %q, got %q", path, file.Data, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "removed.txt")); !os.IsNotExist(err) {
+		t.Error("Removed file should not be written")
+	}
+}
+
+// TestDiffFSRenames 测试目录差分中的重命名检测
+func TestDiffFSRenames(t *testing.T) {
+	content := make([]byte, 16*1024)
+	for i := range content {
+		content[i] = byte(i * 7 % 251)
+	}
+	edited := append([]byte(nil), content...)
+	copy(edited[5000:], "edited")
+
+	oldFS := fstest.MapFS{
+		"assets/texture.bin": {Data: content},
+		"obsolete.bin":       {Data: []byte("unrelated")},
+	}
+	newFS := fstest.MapFS{
+		"packs/texture.bin": {Data: edited},
+		"fresh.bin":         {Data: []byte("also unrelated")},
+	}
+
+	diffs, err := core.DiffFS(oldFS, newFS, nil)
+	if err != nil {
+		t.Fatalf("DiffFS failed: %v", err)
+	}
+	kinds := make(map[string]types.FileChangeKind)
+	for _, fd := range diffs {
+		kinds[fd.Path] = fd.Kind
+		if fd.Kind == types.FILE_RENAMED {
+			if fd.OldPath != "assets/texture.bin" {
+				t.Errorf("Unexpected rename source %q", fd.OldPath)
+			}
+			var inserted int
+			for _, p := range fd.Patches {
+				inserted += len(p.Data)
+			}
+			if inserted >= len(edited)/2 {
+				t.Errorf("Rename patch carries %d bytes, expected a small delta", inserted)
+			}
+		}
+	}
+	expected := map[string]types.FileChangeKind{
+		"packs/texture.bin": types.FILE_RENAMED,
+		"obsolete.bin":      types.FILE_REMOVED,
+		"fresh.bin":         types.FILE_ADDED,
+	}
+	if len(kinds) != len(expected) {
+		t.Fatalf("Expected %d entries, got %+v", len(expected), kinds)
+	}
+	for path, kind := range expected {
+		if kinds[path] != kind {
+			t.Errorf("%s: expected kind %d, got %d", path, kind, kinds[path])
+		}
+	}
+
+	outDir := t.TempDir()
+	if err := core.ApplyFS(oldFS, diffs, outDir, nil); err != nil {
+		t.Fatalf("ApplyFS failed: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(outDir, "packs", "texture.bin"))
+	if err != nil || string(got) != string(edited) {
+		t.Errorf("Renamed file not reconstructed: %v", err)
+	}
+
+	// 负阈值禁用重命名检测
+	diffs, err = core.DiffFS(oldFS, newFS, &core.DiffOptions{RenameThreshold: -1})
+	if err != nil {
+		t.Fatalf("DiffFS failed: %v", err)
+	}
+	for _, fd := range diffs {
+		if fd.Kind == types.FILE_RENAMED {
+			t.Errorf("Rename detected with detection disabled: %s", fd.Path)
+		}
+	}
+}
+
+// TestApplyFSRejectsUnsafePaths 测试含 .. 或绝对路径的差分被拒绝，且不写入任何文件
+func TestApplyFSRejectsUnsafePaths(t *testing.T) {
+	oldFS := fstest.MapFS{"a.bin": {Data: []byte("content")}}
+	tests := []struct {
+		name string
+		diff types.FileDiff
+	}{
+		{"parent", types.FileDiff{Path: "../x", Kind: types.FILE_ADDED}},
+		{"nested_parent", types.FileDiff{Path: "dir/../../x", Kind: types.FILE_ADDED}},
+		{"absolute", types.FileDiff{Path: "/etc/x", Kind: types.FILE_ADDED}},
+		{"dot", types.FileDiff{Path: ".", Kind: types.FILE_ADDED}},
+		{"rename_from_parent", types.FileDiff{Path: "b.bin", OldPath: "../a.bin", Kind: types.FILE_RENAMED}},
+		{"rename_from_absolute", types.FileDiff{Path: "b.bin", OldPath: "/a.bin", Kind: types.FILE_RENAMED}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outDir := filepath.Join(t.TempDir(), "out")
+			diffs := []types.FileDiff{{Path: "a.bin", Kind: types.FILE_UNCHANGED}, tt.diff}
+			err := core.ApplyFS(oldFS, diffs, outDir, nil)
+			if !errors.Is(err, core.ErrCorruptPatch) {
+				t.Fatalf("Expected ErrCorruptPatch, got %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(outDir, "a.bin")); !os.IsNotExist(err) {
+				t.Errorf("Output written despite rejected path: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/types"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"testing"
+	"unicode/utf16"
+)
+
+// gptImage 构造 512 字节扇区的 GPT 镜像，parts 为各分区的名称与内容（按顺序排列，4 KiB 对齐）
+func gptImage(names []string, parts [][]byte) []byte {
+	const sector = 512
+	offset := int64(1 << 20)
+	size := offset
+	for _, p := range parts {
+		size += int64(len(p))
+	}
+	data := make([]byte, size)
+	// 保护性 MBR
+	data[446+4] = 0xEE
+	data[510], data[511] = 0x55, 0xAA
+
+	hdr := data[sector:]
+	copy(hdr, "EFI PART")
+	binary.LittleEndian.PutUint64(hdr[72:], 2)
+	binary.LittleEndian.PutUint32(hdr[80:], 128)
+	binary.LittleEndian.PutUint32(hdr[84:], 128)
+	for i, p := range parts {
+		entry := data[2*sector+128*i:]
+		entry[0] = byte(i + 1) // 分区类型 GUID 非零
+		binary.LittleEndian.PutUint64(entry[32:], uint64(offset/sector))
+		binary.LittleEndian.PutUint64(entry[40:], uint64((offset+int64(len(p)))/sector-1))
+		for k, u := range utf16.Encode([]rune(names[i])) {
+			binary.LittleEndian.PutUint16(entry[56+2*k:], u)
+		}
+		copy(data[offset:], p)
+		offset += int64(len(p))
+	}
+	return data
+}
+
+// TestDiffDiskImage 测试分区扩容导致后续分区移动时的逐分区差分
+func TestDiffDiskImage(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		rng.Read(b)
+		return b
+	}
+	boot := random(256 << 10)
+	rootfs := append(random(512<<10), make([]byte, 512<<10)...)
+	data := random(256 << 10)
+	oldData := gptImage([]string{"boot", "rootfs", "data"}, [][]byte{boot, rootfs, data})
+
+	layout, err := core.ParseDiskImage(oldData)
+	if err != nil {
+		t.Fatalf("ParseDiskImage failed: %v", err)
+	}
+	if layout.Scheme != "gpt" || len(layout.Partitions) != 3 || layout.Partitions[1].Name != "rootfs" {
+		t.Fatalf("Unexpected layout: %+v", layout)
+	}
+
+	// rootfs 扩容 1 MiB（新空间全零），修改其中一个块，data 分区随之后移
+	newRootfs := append(append([]byte(nil), rootfs...), make([]byte, 1<<20)...)
+	copy(newRootfs[8192+100:], "updated block")
+	newData := gptImage([]string{"boot", "rootfs", "data"}, [][]byte{boot, newRootfs, data})
+
+	patch, err := core.DiffDiskImage(oldData, newData, 0, nil)
+	if err != nil {
+		t.Fatalf("DiffDiskImage failed: %v", err)
+	}
+	payload := core.EncodeArchivePatch(patch)
+	if len(payload) > 16<<10 {
+		t.Errorf("Disk image patch is %d bytes, expected only the changed blocks", len(payload))
+	}
+
+	df := types.DiffFile{
+		MagicNumber: types.PATCH_MAGIC,
+		Version:     types.PATCH_VERSION,
+		Format:      types.FORMAT_DISK,
+		OldSize:     uint32(len(oldData)),
+		NewSize:     uint32(len(newData)),
+		OldHash:     core.ComputeHash(oldData),
+		NewHash:     core.ComputeHash(newData),
+		Payload:     payload,
+	}
+	decoded, err := core.DecodeDiffFile(core.EncodeDiffFile(df))
+	if err != nil {
+		t.Fatalf("DecodeDiffFile failed: %v", err)
+	}
+	if err := core.ValidateDiffFile(decoded); err != nil {
+		t.Errorf("ValidateDiffFile failed: %v", err)
+	}
+	got, err := core.ApplyDiffFile(oldData, decoded, nil)
+	if err != nil {
+		t.Fatalf("ApplyDiffFile failed: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Error("Disk image not reconstructed bit-exactly")
+	}
+
+	format, _, _, err := core.DiffPayload(oldData, newData, nil)
+	if err != nil || format != types.FORMAT_DISK {
+		t.Errorf("DiffPayload chose format %d, %v", format, err)
+	}
+	if _, err := core.DiffDiskImage(random(4096), newData, 0, nil); !errors.Is(err, core.ErrNotDiskImage) {
+		t.Errorf("Expected ErrNotDiskImage, got %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"testing"
+)
+
+// TestEstimatePatchSize 测试补丁大小估算
+func TestEstimatePatchSize(t *testing.T) {
+	t.Run("small_exact", func(t *testing.T) {
+		oldData := []byte("Hello, World! This is a test.")
+		newData := []byte("Hello, Go! This is a longer test with more data.")
+		patches, _ := core.DiffBytes(oldData, newData, nil)
+
+		estimate, err := core.EstimatePatchSize(oldData, newData, nil)
+		if err != nil {
+			t.Fatalf("EstimatePatchSize failed: %v", err)
+		}
+		if actual := int64(len(core.EncodePatch(patches))); estimate != actual {
+			t.Errorf("Expected exact size %d for small input, got %d", actual, estimate)
+		}
+	})
+
+	t.Run("sampled", func(t *testing.T) {
+		oldData := pseudoRandom(7, 4*1024*1024)
+		newData := append([]byte(nil), oldData...)
+		// 均匀分布的小改动
+		for pos := 1000; pos < len(newData); pos += 50000 {
+			copy(newData[pos:], "changed!")
+		}
+		newData = append(newData, make([]byte, 1000)...)
+
+		patches, _ := core.DiffBytes(oldData, newData, nil)
+		actual := int64(len(core.EncodePatch(patches)))
+		estimate, err := core.EstimatePatchSize(oldData, newData, nil)
+		if err != nil {
+			t.Fatalf("EstimatePatchSize failed: %v", err)
+		}
+		if estimate < actual/3 || estimate > actual*3 {
+			t.Errorf("Estimate %d too far from actual %d", estimate, actual)
+		}
+	})
+}
+
+// TestEstimateMemory 测试峰值内存估算
+func TestEstimateMemory(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.EnableFFT = false
+	withoutFFT := core.EstimateMemory(1<<20, 1<<20, &core.DiffOptions{Config: cfg})
+	if withoutFFT < 2<<20 {
+		t.Errorf("Estimate %d smaller than inputs", withoutFFT)
+	}
+
+	cfg.EnableFFT = true
+	withFFT := core.EstimateMemory(1<<20, 1<<20, &core.DiffOptions{Config: cfg})
+	if withFFT <= withoutFFT {
+		t.Errorf("FFT alignment should increase the estimate: %d <= %d", withFFT, withoutFFT)
+	}
+}
@@ -0,0 +1,268 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/types"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// TestDiffExecutable 以测试程序自身为旧文件，修改两处后按节差分
+func TestDiffExecutable(t *testing.T) {
+	path, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	oldData, err := os.ReadFile(path)
+	if err != nil {
+		t.Skip(err)
+	}
+	if core.DetectExecutable(oldData) == core.ExecNone {
+		t.Skip("test binary format not supported")
+	}
+
+	newData := append([]byte(nil), oldData...)
+	copy(newData[len(newData)/3:], "patched code")
+	copy(newData[2*len(newData)/3:], "patched data")
+
+	patch, err := core.DiffExecutable(oldData, newData, nil)
+	if err != nil {
+		t.Fatalf("DiffExecutable failed: %v", err)
+	}
+	if len(patch.Sections) < 2 {
+		t.Errorf("Expected a section map, got %d regions", len(patch.Sections))
+	}
+	payload := core.EncodeExecPatch(patch)
+	if len(payload) > len(newData)/20 {
+		t.Errorf("Executable patch is %d bytes for a %d byte file", len(payload), len(newData))
+	}
+
+	df := types.DiffFile{
+		MagicNumber: types.PATCH_MAGIC,
+		Version:     types.PATCH_VERSION,
+		Format:      types.FORMAT_EXEC,
+		OldSize:     uint32(len(oldData)),
+		NewSize:     uint32(len(newData)),
+		OldHash:     core.ComputeHash(oldData),
+		NewHash:     core.ComputeHash(newData),
+		Payload:     payload,
+	}
+	decoded, err := core.DecodeDiffFile(core.EncodeDiffFile(df))
+	if err != nil {
+		t.Fatalf("DecodeDiffFile failed: %v", err)
+	}
+	if err := core.ValidateDiffFile(decoded); err != nil {
+		t.Errorf("ValidateDiffFile failed: %v", err)
+	}
+	got, err := core.ApplyDiffFile(oldData, decoded, nil)
+	if err != nil {
+		t.Fatalf("ApplyDiffFile failed: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Error("Executable not reconstructed bit-exactly")
+	}
+
+	if _, err := core.DiffExecutable(oldData, []byte("plain text"), nil); !errors.Is(err, core.ErrNotExecutable) {
+		t.Errorf("Expected ErrNotExecutable, got %v", err)
+	}
+}
+
+// synthProgram 生成由若干函数组成的代码：每个函数是随机指令与指向其他函数的调用，
+// 插入函数后其余函数整体移动，所有跨越插入点的调用目标随之改变
+type synthProgram struct {
+	arm64 bool
+	funcs [][]synthOp
+}
+
+// synthOp 一段非分支指令或对函数 call 的调用
+type synthOp struct {
+	filler []byte
+	call   int
+}
+
+// newSynthProgram 随机生成 n 个函数
+func newSynthProgram(rng *rand.Rand, arm64 bool, n int) *synthProgram {
+	p := &synthProgram{arm64: arm64}
+	for i := 0; i < n; i++ {
+		p.funcs = append(p.funcs, p.randomFunc(rng, n))
+	}
+	return p
+}
+
+func (p *synthProgram) randomFunc(rng *rand.Rand, n int) []synthOp {
+	var ops []synthOp
+	for j := 0; j < 8; j++ {
+		ops = append(ops, synthOp{filler: p.randomFiller(rng, 4+rng.Intn(12))})
+		ops = append(ops, synthOp{filler: nil, call: rng.Intn(n)})
+	}
+	return ops
+}
+
+// randomFiller 生成 words 条不含分支操作码的指令
+func (p *synthProgram) randomFiller(rng *rand.Rand, words int) []byte {
+	b := make([]byte, words*4)
+	for i := 0; i < len(b); i += 4 {
+		for {
+			w := rng.Uint32()
+			if p.arm64 && w&0x7c000000 == 0x14000000 {
+				continue
+			}
+			binary.LittleEndian.PutUint32(b[i:], w)
+			if !p.arm64 && (bytes.IndexByte(b[i:i+4], 0xe8) >= 0 || bytes.IndexByte(b[i:i+4], 0xe9) >= 0) {
+				continue
+			}
+			break
+		}
+	}
+	return b
+}
+
+// layout 返回代码节内容，代码节从 addr 开始
+func (p *synthProgram) layout(addr uint64) []byte {
+	callSize := 5
+	if p.arm64 {
+		callSize = 4
+	}
+	starts := make([]uint64, len(p.funcs))
+	pos := addr
+	for i, f := range p.funcs {
+		starts[i] = pos
+		for _, op := range f {
+			if op.filler != nil {
+				pos += uint64(len(op.filler))
+			} else {
+				pos += uint64(callSize)
+			}
+		}
+	}
+
+	var code []byte
+	for _, f := range p.funcs {
+		for _, op := range f {
+			if op.filler != nil {
+				code = append(code, op.filler...)
+				continue
+			}
+			pc := addr + uint64(len(code))
+			if p.arm64 {
+				code = binary.LittleEndian.AppendUint32(code, 0x94000000|uint32((starts[op.call]-pc)/4)&0x03ffffff)
+			} else {
+				code = append(code, 0xe8)
+				code = binary.LittleEndian.AppendUint32(code, uint32(starts[op.call]-pc-5))
+			}
+		}
+	}
+	return code
+}
+
+// buildELF 构造只有 .text 与 .shstrtab 两个节的 ELF64 文件
+func buildELF(machine elf.Machine, text []byte, addr uint64) []byte {
+	const textOffset = 64
+	shstrtab := []byte("\x00.text\x00.shstrtab\x00")
+	shoff := uint64(textOffset + len(text) + len(shstrtab))
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Entry:     addr,
+		Shoff:     shoff,
+		Ehsize:    64,
+		Shentsize: 64,
+		Shnum:     3,
+		Shstrndx:  2,
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, hdr)
+	buf.Write(text)
+	buf.Write(shstrtab)
+	binary.Write(buf, binary.LittleEndian, []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_PROGBITS), Flags: uint64(elf.SHF_ALLOC | elf.SHF_EXECINSTR),
+			Addr: addr, Off: textOffset, Size: uint64(len(text)), Addralign: 16},
+		{Name: 7, Type: uint32(elf.SHT_STRTAB), Off: uint64(textOffset + len(text)), Size: uint64(len(shstrtab)), Addralign: 1},
+	})
+	return buf.Bytes()
+}
+
+// TestExecutablePointerNormalization 在代码中间插入函数后，分支目标归一化使补丁只包含新函数
+func TestExecutablePointerNormalization(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		machine elf.Machine
+		arm64   bool
+	}{
+		{"x86-64", elf.EM_X86_64, false},
+		{"arm64", elf.EM_AARCH64, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(7))
+			const addr = 0x401000
+			prog := newSynthProgram(rng, tt.arm64, 400)
+			oldData := buildELF(tt.machine, prog.layout(addr), addr)
+
+			// 在中间插入一个函数，其余函数的调用索引随之后移
+			inserted := prog.randomFunc(rng, len(prog.funcs))
+			for _, f := range prog.funcs {
+				for i := range f {
+					if f[i].filler == nil && f[i].call >= 200 {
+						f[i].call++
+					}
+				}
+			}
+			prog.funcs = append(prog.funcs[:200], append([][]synthOp{inserted}, prog.funcs[200:]...)...)
+			newData := buildELF(tt.machine, prog.layout(addr), addr)
+
+			patch, err := core.DiffExecutable(oldData, newData, nil)
+			if err != nil {
+				t.Fatalf("DiffExecutable failed: %v", err)
+			}
+			if patch.Pointers == nil {
+				t.Fatal("Expected branch targets to be normalized")
+			}
+			payload := core.EncodeExecPatch(patch)
+
+			raw, err := core.DiffBytes(oldData, newData, nil)
+			if err != nil {
+				t.Fatalf("DiffBytes failed: %v", err)
+			}
+			var rawSize int
+			for _, p := range raw {
+				rawSize += len(p.Data)
+			}
+			if len(payload)*10 > rawSize {
+				t.Errorf("Normalized patch is %d bytes, raw diff carries %d bytes of data", len(payload), rawSize)
+			}
+
+			decoded, err := core.DecodeExecPatch(payload)
+			if err != nil {
+				t.Fatalf("DecodeExecPatch failed: %v", err)
+			}
+			if err := core.ValidateExecPatch(decoded, int64(len(oldData)), int64(len(newData))); err != nil {
+				t.Fatalf("ValidateExecPatch failed: %v", err)
+			}
+			got, err := core.ApplyExecutable(oldData, decoded, nil)
+			if err != nil {
+				t.Fatalf("ApplyExecutable failed: %v", err)
+			}
+			if !bytes.Equal(got, newData) {
+				t.Error("Executable not reconstructed bit-exactly")
+			}
+
+			// 重叠的等价区间视为损坏的补丁
+			decoded.Pointers.Equivalences = append(decoded.Pointers.Equivalences, decoded.Pointers.Equivalences[0])
+			if err := core.ValidateExecPatch(decoded, int64(len(oldData)), int64(len(newData))); !errors.Is(err, core.ErrCorruptPatch) {
+				t.Errorf("Expected ErrCorruptPatch for overlapping equivalences, got %v", err)
+			}
+		})
+	}
+}
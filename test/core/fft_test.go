@@ -2,9 +2,14 @@ package core_test
 
 import (
 	"bindiff/core"
+	"bindiff/pkg/config"
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"math/cmplx"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -305,3 +310,205 @@ func BenchmarkConvolutionFFT(b *testing.B) {
 		})
 	}
 }
+
+// TestRealFFTMatchesComplex 测试实数 FFT 的半频谱与复数 FFT 一致，逆变换还原输入
+func TestRealFFTMatchesComplex(t *testing.T) {
+	for _, n := range []int{1, 2, 4, 8, 64, 1024} {
+		t.Run(fmt.Sprintf("size_%d", n), func(t *testing.T) {
+			input := make([]float64, n)
+			complexInput := make([]complex128, n)
+			for i := range input {
+				input[i] = float64((i*37 + i*i) % 251)
+				complexInput[i] = complex(input[i], 0)
+			}
+
+			expected := make([]complex128, n)
+			core.NewFFT(n).Transform(complexInput, expected, false)
+
+			rfft := core.NewRealFFT(n)
+			spectrum := make([]complex128, rfft.SpectrumLen())
+			rfft.Forward(input, spectrum)
+			for k := range spectrum {
+				if diff := cmplx.Abs(spectrum[k] - expected[k%n]); diff > 1e-6 {
+					t.Fatalf("Spectrum mismatch at %d: %v vs %v", k, spectrum[k], expected[k%n])
+				}
+			}
+
+			full := make([]complex128, n)
+			rfft.Transform(input, full, false)
+			for k := range full {
+				if diff := cmplx.Abs(full[k] - expected[k]); diff > 1e-6 {
+					t.Fatalf("Full spectrum mismatch at %d: %v vs %v", k, full[k], expected[k])
+				}
+			}
+
+			recovered := make([]float64, n)
+			rfft.Inverse(spectrum, recovered)
+			for i := range recovered {
+				if math.Abs(recovered[i]-input[i]) > 1e-6 {
+					t.Fatalf("Round-trip error at %d: %v vs %v", i, recovered[i], input[i])
+				}
+			}
+		})
+	}
+}
+
+// TestComputeOffsetConcurrent 测试并发对齐共享缓存的 FFT 计划时结果一致
+func TestComputeOffsetConcurrent(t *testing.T) {
+	oldData := make([]byte, 3000)
+	for i := range oldData {
+		oldData[i] = byte(i*i + i/7)
+	}
+	newData := append(make([]byte, 100), oldData...)
+	expected := core.ComputeOffset(oldData, newData)
+
+	var wg sync.WaitGroup
+	results := make([]int, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = core.ComputeOffset(oldData, newData)
+		}(i)
+	}
+	wg.Wait()
+	for i, offset := range results {
+		if offset != expected {
+			t.Errorf("Goroutine %d: offset %d, expected %d", i, offset, expected)
+		}
+	}
+
+	conv := core.ConvolutionFFT([]complex128{1, 2}, []complex128{3, 4})
+	if again := core.ConvolutionFFT([]complex128{1, 2}, []complex128{3, 4}); cmplx.Abs(conv[1]-again[1]) > 1e-10 {
+		t.Errorf("Convolution with cached plan differs: %v vs %v", conv, again)
+	}
+}
+
+// TestComputeOffsetFloat32 测试单精度对齐与双精度得到相同的偏移量
+func TestComputeOffsetFloat32(t *testing.T) {
+	for _, size := range []int{1, 100, 4096, 1 << 20} {
+		t.Run(fmt.Sprintf("size_%d", size), func(t *testing.T) {
+			oldData := make([]byte, size)
+			state := uint32(size)
+			for i := range oldData {
+				state = state*1664525 + 1013904223
+				oldData[i] = byte(state >> 24)
+			}
+			shift := size / 10
+			newData := append(make([]byte, shift), oldData...)
+
+			expected := core.ComputeOffset(oldData, newData)
+			offset, err := core.ComputeOffsetFloat32(context.Background(), oldData, newData)
+			if err != nil {
+				t.Fatalf("ComputeOffsetFloat32 failed: %v", err)
+			}
+			if offset != expected {
+				t.Errorf("Float32 offset %d, float64 offset %d", offset, expected)
+			}
+
+			cfg := config.DefaultConfig()
+			cfg.FFTPrecision = config.FFTPrecisionFloat32
+			d := core.NewSharedDiffer(&core.DiffOptions{Config: cfg})
+			if offset, err := d.ComputeOffset(oldData, newData); err != nil || offset != expected {
+				t.Errorf("Differ float32 offset %d (%v), expected %d", offset, err, expected)
+			}
+		})
+	}
+}
+
+// TestComputeOffsetHierarchical 测试大数据的分层对齐找到逐字节准确的偏移量
+func TestComputeOffsetHierarchical(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping large alignment in short mode")
+	}
+	data := make([]byte, 6<<20)
+	state := uint32(1)
+	for i := range data {
+		state = state*1664525 + 1013904223
+		data[i] = byte(state >> 24)
+	}
+
+	for _, shift := range []int{12345, -777} {
+		t.Run(fmt.Sprintf("shift_%d", shift), func(t *testing.T) {
+			oldData, newData := data, data
+			if shift > 0 {
+				newData = append(make([]byte, shift), data...)
+			} else {
+				oldData = append(make([]byte, -shift), data...)
+			}
+			offset, err := core.ComputeOffsetHierarchical(context.Background(), oldData, newData)
+			if err != nil {
+				t.Fatalf("ComputeOffsetHierarchical failed: %v", err)
+			}
+			if offset != -shift {
+				t.Errorf("Offset %d, expected %d", offset, -shift)
+			}
+		})
+	}
+
+	// 数据较小时与完整相关的结果相同
+	small := data[:4096]
+	offset, err := core.ComputeOffsetHierarchical(context.Background(), small, small[100:])
+	if err != nil || offset != core.ComputeOffset(small, small[100:]) {
+		t.Errorf("Small input offset %d (%v), expected %d", offset, err, core.ComputeOffset(small, small[100:]))
+	}
+}
+
+// naiveBackend 直接按定义计算循环卷积的测试后端
+type naiveBackend struct {
+	calls atomic.Int32
+}
+
+func (b *naiveBackend) Name() string { return "naive-test" }
+
+func (b *naiveBackend) Convolve(ctx context.Context, a, bIn, out []float64) error {
+	b.calls.Add(1)
+	n := len(a)
+	result := make([]float64, n)
+	for i := range result {
+		for j := 0; j < n; j++ {
+			result[i] += a[j] * bIn[(i-j+n)%n]
+		}
+	}
+	copy(out, result)
+	return nil
+}
+
+func TestCorrelationBackend(t *testing.T) {
+	backend := &naiveBackend{}
+	core.RegisterCorrelationBackend(backend)
+
+	oldData := make([]byte, 600)
+	state := uint32(7)
+	for i := range oldData {
+		state = state*1664525 + 1013904223
+		oldData[i] = byte(state >> 24)
+	}
+	newData := append(make([]byte, 37), oldData[:500]...)
+	expected, err := core.ComputeAlignment(context.Background(), oldData, newData, config.DefaultConfig())
+	if err != nil {
+		t.Fatalf("ComputeAlignment failed: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.CorrelationBackend = backend.Name()
+	align, err := core.ComputeAlignment(context.Background(), oldData, newData, cfg)
+	if err != nil {
+		t.Fatalf("ComputeAlignment with backend failed: %v", err)
+	}
+	if align.Offset != expected.Offset || math.Abs(align.Confidence-expected.Confidence) > 1e-6 {
+		t.Errorf("Backend alignment %+v, CPU alignment %+v", align, expected)
+	}
+	d := core.NewSharedDiffer(&core.DiffOptions{Config: cfg})
+	if offset, err := d.ComputeOffset(oldData, newData); err != nil || offset != expected.Offset {
+		t.Errorf("Differ backend offset %d (%v), expected %d", offset, err, expected.Offset)
+	}
+	if backend.calls.Load() != 2 {
+		t.Errorf("Backend called %d times, expected 2", backend.calls.Load())
+	}
+
+	cfg.CorrelationBackend = "missing"
+	if _, err := core.ComputeAlignment(context.Background(), oldData, newData, cfg); !errors.Is(err, core.ErrBackendUnavailable) {
+		t.Errorf("Expected ErrBackendUnavailable, got %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/utils"
+	"bindiff/types"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// newTestDiffFile 构造测试用补丁文件
+func newTestDiffFile(t *testing.T, algo types.HashAlgorithm, oldData, newData []byte) types.DiffFile {
+	t.Helper()
+
+	patches, err := core.DiffBytes(oldData, newData, nil)
+	if err != nil {
+		t.Fatalf("DiffBytes failed: %v", err)
+	}
+	oldHash, err := core.ComputeHashWith(algo, oldData)
+	if err != nil {
+		t.Fatalf("ComputeHashWith failed: %v", err)
+	}
+	newHash, err := core.ComputeHashWith(algo, newData)
+	if err != nil {
+		t.Fatalf("ComputeHashWith failed: %v", err)
+	}
+
+	return types.DiffFile{
+		MagicNumber:       types.PATCH_MAGIC,
+		Version:           types.PATCH_VERSION,
+		HashAlgorithm:     algo,
+		OldFileNameLength: 3,
+		FileName:          []byte("old"),
+		NewFileNameLength: 3,
+		NewFileName:       []byte("new"),
+		OldSize:           uint32(len(oldData)),
+		NewSize:           uint32(len(newData)),
+		OldHash:           oldHash,
+		NewHash:           newHash,
+		Diff:              patches,
+	}
+}
+
+// TestDiffFileHashAlgorithms 测试补丁头中的哈希算法字段
+func TestDiffFileHashAlgorithms(t *testing.T) {
+	oldData := []byte("The quick brown fox jumps over the lazy dog")
+	newData := []byte("The quick red fox jumps over the sleepy cat")
+
+	for _, algo := range []types.HashAlgorithm{types.HASH_SHA256, types.HASH_BLAKE3, types.HASH_XXHASH64} {
+		t.Run(utils.HashAlgorithmName(algo), func(t *testing.T) {
+			df := newTestDiffFile(t, algo, oldData, newData)
+
+			decoded, err := core.DecodeDiffFile(core.EncodeDiffFile(df))
+			if err != nil {
+				t.Fatalf("DecodeDiffFile failed: %v", err)
+			}
+			if decoded.HashAlgorithm != algo {
+				t.Errorf("Hash algorithm mismatch: expected %d, got %d", algo, decoded.HashAlgorithm)
+			}
+			if !bytes.Equal(decoded.NewHash, df.NewHash) || len(decoded.NewHash) != utils.HashSize(algo) {
+				t.Errorf("New hash mismatch: %x vs %x", decoded.NewHash, df.NewHash)
+			}
+
+			result, err := core.Apply(oldData, decoded.Diff, nil)
+			if err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			resultHash, _ := core.ComputeHashWith(decoded.HashAlgorithm, result)
+			if !utils.CompareHashes(resultHash, decoded.NewHash) {
+				t.Error("Result hash does not verify with header algorithm")
+			}
+		})
+	}
+
+	t.Run("version_1_compat", func(t *testing.T) {
+		df := newTestDiffFile(t, types.HASH_SHA256, oldData, newData)
+		df.Version = types.PATCH_VERSION_V1
+
+		decoded, err := core.DecodeDiffFile(core.EncodeDiffFile(df))
+		if err != nil {
+			t.Fatalf("DecodeDiffFile failed for v1 patch: %v", err)
+		}
+		if decoded.HashAlgorithm != types.HASH_SHA256 || !bytes.Equal(decoded.OldHash, df.OldHash) {
+			t.Error("v1 patch should decode with SHA256 hashes")
+		}
+	})
+
+	t.Run("unsupported_algorithm", func(t *testing.T) {
+		df := newTestDiffFile(t, types.HASH_SHA256, oldData, newData)
+		df.HashAlgorithm = 0x7f
+		if _, err := core.DecodeDiffFile(core.EncodeDiffFile(df)); err == nil {
+			t.Error("Expected error for unknown hash algorithm")
+		}
+	})
+}
+
+// TestTypedErrors 测试可通过 errors.Is 判断的错误类别
+func TestTypedErrors(t *testing.T) {
+	oldData := []byte("The quick brown fox jumps over the lazy dog")
+	newData := []byte("The quick red fox jumps over the sleepy cat")
+	encoded := core.EncodeDiffFile(newTestDiffFile(t, types.HASH_SHA256, oldData, newData))
+
+	t.Run("corrupt_truncated", func(t *testing.T) {
+		if _, err := core.DecodeDiffFile(encoded[:len(encoded)-3]); !errors.Is(err, core.ErrCorruptPatch) {
+			t.Errorf("Expected ErrCorruptPatch, got %v", err)
+		}
+		if _, err := core.DecodePatch([]byte{byte(types.OP_INSERT), 1, 2}); !errors.Is(err, core.ErrCorruptPatch) {
+			t.Errorf("Expected ErrCorruptPatch from DecodePatch, got %v", err)
+		}
+	})
+
+	t.Run("corrupt_magic", func(t *testing.T) {
+		bad := append([]byte(nil), encoded...)
+		bad[0] ^= 0xFF
+		if _, err := core.DecodeDiffFile(bad); !errors.Is(err, core.ErrCorruptPatch) {
+			t.Errorf("Expected ErrCorruptPatch, got %v", err)
+		}
+	})
+
+	t.Run("unsupported_version", func(t *testing.T) {
+		df := newTestDiffFile(t, types.HASH_SHA256, oldData, newData)
+		df.Version = types.PATCH_VERSION + 1
+		if _, err := core.DecodeDiffFile(core.EncodeDiffFile(df)); !errors.Is(err, core.ErrUnsupportedVersion) {
+			t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+		}
+	})
+
+	t.Run("hash_mismatch", func(t *testing.T) {
+		if err := core.VerifyHash(types.HASH_SHA256, oldData, core.ComputeHash(newData), nil); !errors.Is(err, core.ErrHashMismatch) {
+			t.Errorf("Expected ErrHashMismatch, got %v", err)
+		}
+	})
+
+	t.Run("invalid_entry", func(t *testing.T) {
+		invalid := []types.Patch{{Op: types.OP_COPY, Offset: 0, Length: 1000}}
+		if _, err := core.Apply(oldData, invalid, nil); !errors.Is(err, core.ErrCorruptPatch) {
+			t.Errorf("Expected ErrCorruptPatch for invalid entry, got %v", err)
+		}
+	})
+}
+
+// TestEncodeHelpers 测试追加、写出与一次分配的编码结果一致
+func TestEncodeHelpers(t *testing.T) {
+	oldData := bytes.Repeat([]byte("base data "), 20000)
+	newData := append([]byte(nil), oldData...)
+	copy(newData[5000:], bytes.Repeat([]byte{'x'}, 100000)) // 超过写缓冲区的条目
+	newData = append(newData, "tail"...)
+	df := newTestDiffFile(t, types.HASH_SHA256, oldData, newData)
+	encoded := core.EncodeDiffFile(df)
+
+	if got := core.AppendDiffFile([]byte("prefix"), df); !bytes.Equal(got[6:], encoded) {
+		t.Error("AppendDiffFile differs from EncodeDiffFile")
+	}
+	var buf bytes.Buffer
+	if err := core.WriteDiffFile(&buf, df); err != nil || !bytes.Equal(buf.Bytes(), encoded) {
+		t.Errorf("WriteDiffFile differs from EncodeDiffFile: %v", err)
+	}
+	buf.Reset()
+	patch := core.EncodePatch(df.Diff)
+	if err := core.WritePatch(&buf, df.Diff); err != nil || !bytes.Equal(buf.Bytes(), patch) {
+		t.Errorf("WritePatch differs from EncodePatch: %v", err)
+	}
+	if core.EncodedPatchSize(df.Diff) != int64(len(patch)) {
+		t.Errorf("EncodedPatchSize = %d, want %d", core.EncodedPatchSize(df.Diff), len(patch))
+	}
+
+	payload := df
+	payload.Format, payload.Diff, payload.Payload = types.FORMAT_GZIP, nil, []byte("payload")
+	buf.Reset()
+	if err := core.WriteDiffFile(&buf, payload); err != nil || !bytes.Equal(buf.Bytes(), core.EncodeDiffFile(payload)) {
+		t.Errorf("WriteDiffFile differs for payload formats: %v", err)
+	}
+}
+
+// TestPatchArena 测试 arena 解码与复用
+func TestPatchArena(t *testing.T) {
+	patches := []types.Patch{
+		{Op: types.OP_REPLACE, Offset: 0, Length: 3, Data: []byte("abc")},
+		{Op: types.OP_COPY, Offset: 3, Length: 10},
+		{Op: types.OP_INSERT, Offset: 13, Length: 2, Data: []byte("de")},
+	}
+	encoded := core.EncodePatch(patches)
+
+	decoded, err := core.DecodePatch(encoded)
+	if err != nil || len(decoded) != 3 || !bytes.Equal(core.EncodePatch(decoded), encoded) {
+		t.Fatalf("DecodePatch round trip failed: %v", err)
+	}
+	// 条目数据共用一块内存，追加时不能覆盖后面的条目
+	_ = append(decoded[0].Data, "zz"...)
+	if string(decoded[2].Data) != "de" {
+		t.Error("Appending to entry data overwrote the next entry")
+	}
+	if allocs := testing.AllocsPerRun(10, func() { core.DecodePatch(encoded) }); allocs > 2 {
+		t.Errorf("DecodePatch made %.0f allocations, want at most 2", allocs)
+	}
+
+	var arena core.PatchArena
+	if got, err := arena.DecodePatch(encoded); err != nil || !bytes.Equal(core.EncodePatch(got), encoded) {
+		t.Fatalf("Arena round trip failed: %v", err)
+	}
+	if allocs := testing.AllocsPerRun(10, func() {
+		arena.Reset()
+		arena.DecodePatch(encoded)
+	}); allocs != 0 {
+		t.Errorf("Reused arena made %.0f allocations", allocs)
+	}
+
+	// 损坏的输入返回之前的条目
+	got, err := arena.DecodePatch(encoded[:len(encoded)-1])
+	if !errors.Is(err, core.ErrCorruptPatch) || len(got) != 2 {
+		t.Errorf("Expected 2 entries and ErrCorruptPatch, got %d, %v", len(got), err)
+	}
+}
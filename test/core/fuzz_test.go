@@ -0,0 +1,237 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/types"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+)
+
+// 运行模糊测试：go test ./test/core -run '^$' -fuzz FuzzDecodeDiffFile -fuzztime 1m
+
+// fuzzMaxOld 模糊测试中旧数据的最大长度，避免单个输入耗时过长
+const fuzzMaxOld = 64 * 1024
+
+// fuzzSeeds 返回模糊测试的种子：旧数据、新数据与两者的补丁
+func fuzzSeeds() [][3][]byte {
+	pairs := [][2][]byte{
+		{[]byte("The quick brown fox jumps over the lazy dog"), []byte("The quick red fox jumps over the sleepy cat!")},
+		{[]byte("abcdefghijklmnopqrstuvwxyz"), []byte("abcXYZdefghijklmnopqrstu")},
+		{nil, []byte("new")},
+		{[]byte("old"), nil},
+	}
+	seeds := make([][3][]byte, 0, len(pairs))
+	for _, p := range pairs {
+		patches, err := core.DiffBytes(p[0], p[1], nil)
+		if err != nil {
+			panic(err)
+		}
+		seeds = append(seeds, [3][]byte{p[0], p[1], core.EncodePatch(patches)})
+	}
+	return seeds
+}
+
+// fuzzDiffFile 把种子编码为完整的补丁文件
+func fuzzDiffFile(oldData, newData, encoded []byte) []byte {
+	patches, _ := core.DecodePatch(encoded)
+	return core.EncodeDiffFile(types.DiffFile{
+		MagicNumber:       types.PATCH_MAGIC,
+		Version:           types.PATCH_VERSION,
+		HashAlgorithm:     types.HASH_SHA256,
+		OldFileNameLength: 3,
+		FileName:          []byte("old"),
+		NewFileNameLength: 3,
+		NewFileName:       []byte("new"),
+		OldSize:           uint32(len(oldData)),
+		NewSize:           uint32(len(newData)),
+		OldHash:           core.ComputeHash(oldData),
+		NewHash:           core.ComputeHash(newData),
+		DataLength:        uint32(len(encoded)),
+		Diff:              patches,
+	})
+}
+
+func FuzzDecodePatch(f *testing.F) {
+	for _, s := range fuzzSeeds() {
+		f.Add(s[2])
+	}
+	f.Add([]byte{byte(types.OP_INSERT), 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		patches, err := core.DecodePatch(data)
+
+		// 迭代器读取同一输入，结果须与一次解码一致
+		it := core.NewPatchIterator(bytes.NewReader(data))
+		n := 0
+		for it.Next() {
+			if n >= len(patches) {
+				t.Fatalf("iterator returned more entries than DecodePatch (%d)", len(patches))
+			}
+			if got := it.Patch(); got.Op != patches[n].Op || got.Offset != patches[n].Offset ||
+				got.Length != patches[n].Length || !bytes.Equal(got.Data, patches[n].Data) {
+				t.Fatalf("entry %d: iterator %+v, DecodePatch %+v", n, got, patches[n])
+			}
+			n++
+		}
+		if (err == nil) != (it.Err() == nil) {
+			t.Fatalf("DecodePatch error %v, iterator error %v", err, it.Err())
+		}
+		if err != nil {
+			if !errors.Is(err, core.ErrCorruptPatch) {
+				t.Fatalf("error %v is not ErrCorruptPatch", err)
+			}
+			return
+		}
+		if !bytes.Equal(core.EncodePatch(patches), data) {
+			t.Fatal("re-encoding a decoded patch changed it")
+		}
+	})
+}
+
+func FuzzDecodeDiffFile(f *testing.F) {
+	for _, s := range fuzzSeeds() {
+		f.Add(fuzzDiffFile(s[0], s[1], s[2]))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		df, err := core.DecodeDiffFile(data)
+		if err != nil {
+			return
+		}
+		// 校验只能返回错误，不能 panic
+		_ = core.ValidateDiffFile(df)
+
+		encoded := core.EncodeDiffFile(df)
+		again, err := core.DecodeDiffFile(encoded)
+		if err != nil {
+			t.Fatalf("decoding a re-encoded patch failed: %v", err)
+		}
+		if !bytes.Equal(core.EncodeDiffFile(again), encoded) {
+			t.Fatal("patch file is not stable across decode/encode")
+		}
+	})
+}
+
+func FuzzApplyPatch(f *testing.F) {
+	for _, s := range fuzzSeeds() {
+		f.Add(s[0], s[2])
+	}
+
+	f.Fuzz(func(t *testing.T, oldData, encoded []byte) {
+		if len(oldData) > fuzzMaxOld {
+			return
+		}
+		patches, err := core.DecodePatch(encoded)
+		if err != nil {
+			return
+		}
+
+		// 宽松模式跳过无效条目，不能 panic
+		lenient := core.ApplyPatch(oldData, patches)
+
+		strict, err := core.Apply(oldData, patches, nil)
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(strict, lenient) {
+			t.Fatalf("strict apply produced %d bytes, lenient %d", len(strict), len(lenient))
+		}
+		if err := core.ValidatePatch(patches, int64(len(oldData)), int64(len(strict))); err != nil {
+			t.Fatalf("patch applied in strict mode but fails validation: %v", err)
+		}
+	})
+}
+
+// allocatedDuring 返回 fn 运行期间分配的字节数
+func allocatedDuring(fn func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+// TestHostileLengthsDoNotAllocate 测试伪造的长度字段只得到损坏错误，不会按长度分配内存
+func TestHostileLengthsDoNotAllocate(t *testing.T) {
+	const limit = 16 << 20
+
+	// 文件名长度 4 GB，文件本身只有几十字节；分别以内存与流的方式读取
+	header := binary.LittleEndian.AppendUint32(nil, types.PATCH_MAGIC)
+	header = binary.LittleEndian.AppendUint32(header, types.PATCH_VERSION)
+	header = binary.LittleEndian.AppendUint32(header, uint32(types.HASH_SHA256))
+	header = binary.LittleEndian.AppendUint32(header, uint32(types.FORMAT_RAW))
+	header = binary.LittleEndian.AppendUint32(header, 0xffffffff)
+	header = append(header, "old"...)
+	readers := map[string]func() error{
+		"DecodeDiffFile": func() error {
+			_, err := core.DecodeDiffFile(header)
+			return err
+		},
+		"ReadDiffHeader": func() error {
+			_, err := core.ReadDiffHeader(io.MultiReader(bytes.NewReader(header)))
+			return err
+		},
+	}
+
+	// 插入长度接近 2^63，数据只有几个字节
+	entry := []byte{byte(types.OP_INSERT)}
+	entry = binary.LittleEndian.AppendUint64(entry, 0)
+	entry = binary.LittleEndian.AppendUint64(entry, 1<<62)
+	entry = append(entry, "data"...)
+	readers["DecodePatch"] = func() error {
+		_, err := core.DecodePatch(entry)
+		return err
+	}
+	readers["PatchIterator"] = func() error {
+		it := core.NewPatchIterator(io.MultiReader(bytes.NewReader(entry)))
+		for it.Next() {
+		}
+		return it.Err()
+	}
+
+	// 负长度
+	negative := []byte{byte(types.OP_INSERT)}
+	negative = binary.LittleEndian.AppendUint64(negative, 0)
+	negative = binary.LittleEndian.AppendUint64(negative, 1<<63)
+	readers["PatchIterator negative"] = func() error {
+		it := core.NewPatchIterator(bytes.NewReader(negative))
+		for it.Next() {
+		}
+		return it.Err()
+	}
+
+	for name, read := range readers {
+		var err error
+		if n := allocatedDuring(func() { err = read() }); n > limit {
+			t.Errorf("%s allocated %d bytes", name, n)
+		}
+		if !errors.Is(err, core.ErrCorruptPatch) {
+			t.Errorf("%s: error %v, want ErrCorruptPatch", name, err)
+		}
+	}
+}
+
+// TestApplyRejectsHostileEntries 测试负数与溢出的偏移量、长度在严格模式下返回错误，宽松模式下不会 panic
+func TestApplyRejectsHostileEntries(t *testing.T) {
+	oldData := []byte("0123456789")
+	cases := map[string][]types.Patch{
+		"negative offset":      {{Op: types.OP_COPY, Offset: -5, Length: 3}},
+		"negative length":      {{Op: types.OP_DELETE, Offset: 2, Length: -4}},
+		"overflowing replace":  {{Op: types.OP_REPLACE, Offset: 2, Length: 1<<63 - 1, Data: []byte("x")}},
+		"overflowing copy":     {{Op: types.OP_COPY, Offset: 0, Length: 1<<63 - 1}},
+		"huge insert estimate": {{Op: types.OP_INSERT, Offset: 0, Length: 1 << 60, Data: []byte("x")}},
+	}
+	for name, patches := range cases {
+		t.Run(name, func(t *testing.T) {
+			core.ApplyPatch(oldData, patches)
+			var perr *core.PatchError
+			if _, err := core.Apply(oldData, patches, nil); name != "huge insert estimate" && !errors.As(err, &perr) {
+				t.Errorf("Apply error %v, want *PatchError", err)
+			}
+		})
+	}
+}
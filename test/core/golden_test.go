@@ -0,0 +1,130 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"bindiff/types"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+// goldenCase 黄金测试用例
+type goldenCase struct {
+	name     string
+	old, new []byte
+}
+
+// pseudoRandom 与平台和 Go 版本无关的确定性伪随机数据（xorshift）
+func pseudoRandom(seed uint32, n int) []byte {
+	data := make([]byte, n)
+	x := seed
+	for i := range data {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		data[i] = byte(x)
+	}
+	return data
+}
+
+// goldenCases 构造黄金测试输入
+func goldenCases() []goldenCase {
+	base := pseudoRandom(1, 256*1024)
+
+	edited := append([]byte(nil), base...)
+	for _, pos := range []int{100, 40000, 65535, 65536, 130000, 200000} {
+		copy(edited[pos:], "edited")
+	}
+
+	grown := append(append([]byte(nil), edited...), pseudoRandom(2, 10000)...)
+	shrunk := edited[:180000]
+
+	return []goldenCase{
+		{"text", []byte("The quick brown fox jumps over the lazy dog"), []byte("The quick red fox jumps over the sleepy cat!")},
+		{"edited", base, edited},
+		{"grown", base, grown},
+		{"shrunk", base, shrunk},
+		{"replaced", base, pseudoRandom(3, len(base))},
+	}
+}
+
+// TestGoldenDeterministic 测试相同输入与选项产生逐字节一致的补丁，且与工作线程数无关
+func TestGoldenDeterministic(t *testing.T) {
+	var lines []string
+
+	for _, tc := range goldenCases() {
+		var reference []byte
+		for _, workers := range []int{1, 2, 3, 4, 8} {
+			cfg := config.DefaultConfig()
+			cfg.BlockSize = 1024
+			patches, err := core.DiffWith(tc.old, tc.new, core.WithConfig(cfg), core.WithWorkers(workers))
+			if err != nil {
+				t.Fatalf("%s: diff with %d workers failed: %v", tc.name, workers, err)
+			}
+			encoded := core.EncodePatch(patches)
+
+			if reference == nil {
+				reference = encoded
+			} else if !bytes.Equal(encoded, reference) {
+				t.Errorf("%s: output with %d workers differs from single worker", tc.name, workers)
+			}
+		}
+
+		result, err := core.Apply(tc.old, decodeForTest(t, reference), nil)
+		if err != nil || !bytes.Equal(result, tc.new) {
+			t.Errorf("%s: golden patch does not reproduce new data: %v", tc.name, err)
+		}
+
+		sum := sha256.Sum256(reference)
+		lines = append(lines, fmt.Sprintf("%s %s", tc.name, hex.EncodeToString(sum[:])))
+	}
+
+	sort.Strings(lines)
+	got := strings.Join(lines, "\n") + "\n"
+	path := filepath.Join("testdata", "patches.golden")
+
+	if *updateGolden {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file (run with -update to create): %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("Patch output differs from golden file:\ngot:\n%swant:\n%s", got, want)
+	}
+}
+
+// TestGoldenDiffFile 测试补丁文件编码的确定性
+func TestGoldenDiffFile(t *testing.T) {
+	tc := goldenCases()[0]
+	for _, algo := range []types.HashAlgorithm{types.HASH_SHA256, types.HASH_BLAKE3, types.HASH_XXHASH64} {
+		first := core.EncodeDiffFile(newTestDiffFile(t, algo, tc.old, tc.new))
+		second := core.EncodeDiffFile(newTestDiffFile(t, algo, tc.old, tc.new))
+		if !bytes.Equal(first, second) {
+			t.Errorf("Diff file encoding not deterministic for algorithm %d", algo)
+		}
+	}
+}
+
+// decodeForTest 解码补丁，失败时终止测试
+func decodeForTest(t *testing.T, data []byte) []types.Patch {
+	t.Helper()
+	patches, err := core.DecodePatch(data)
+	if err != nil {
+		t.Fatalf("DecodePatch failed: %v", err)
+	}
+	return patches
+}
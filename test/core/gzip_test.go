@@ -0,0 +1,93 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// gzipData 使用指定级别与头信息压缩数据
+func gzipData(t *testing.T, data []byte, level int, name string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Name = name
+	w.ModTime = time.Unix(1700000000, 0)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// TestDiffGzip 测试解压差分与逐字节重新压缩
+func TestDiffGzip(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	words := []string{"alpha ", "beta ", "gamma ", "delta ", "\n"}
+	var raw bytes.Buffer
+	for raw.Len() < 200*1024 {
+		raw.WriteString(words[rng.Intn(len(words))])
+	}
+	oldRaw := raw.Bytes()
+	newRaw := append([]byte(nil), oldRaw...)
+	copy(newRaw[5000:], "first change")
+	copy(newRaw[100000:], "changed")
+
+	for _, level := range []int{gzip.DefaultCompression, gzip.BestSpeed, gzip.BestCompression, gzip.HuffmanOnly} {
+		oldData := gzipData(t, oldRaw, gzip.DefaultCompression, "old.txt")
+		newData := gzipData(t, newRaw, level, "new.txt")
+
+		patch, err := core.DiffGzip(oldData, newData, nil)
+		if err != nil {
+			t.Fatalf("level %d: DiffGzip failed: %v", level, err)
+		}
+		payload := core.EncodeGzipPatch(patch)
+		if len(payload) > len(newData)/10 {
+			t.Errorf("level %d: gzip patch is %d bytes for a %d byte file", level, len(payload), len(newData))
+		}
+
+		decoded, err := core.DecodeGzipPatch(payload)
+		if err != nil {
+			t.Fatalf("level %d: DecodeGzipPatch failed: %v", level, err)
+		}
+		if err := core.ValidateGzipPatch(decoded); err != nil {
+			t.Errorf("level %d: ValidateGzipPatch failed: %v", level, err)
+		}
+		got, err := core.ApplyGzip(oldData, decoded, nil)
+		if err != nil {
+			t.Fatalf("level %d: ApplyGzip failed: %v", level, err)
+		}
+		if !bytes.Equal(got, newData) {
+			t.Errorf("level %d: gzip file not reproduced bit-exactly", level)
+		}
+	}
+}
+
+// TestDiffGzipFallback 测试无法重现时返回 ErrNotRecompressible
+func TestDiffGzipFallback(t *testing.T) {
+	oldData := gzipData(t, []byte("hello world"), gzip.DefaultCompression, "")
+
+	// 多成员 gzip 不支持
+	multi := append(append([]byte(nil), oldData...), oldData...)
+	if _, err := core.DiffGzip(oldData, multi, nil); !errors.Is(err, core.ErrNotRecompressible) {
+		t.Errorf("Expected ErrNotRecompressible for multi-member gzip, got %v", err)
+	}
+
+	// 篡改 deflate 流中的块类型，使其成为合法但无法由已知参数产生的存储块
+	stored := []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 0xff,
+		0x00, 0x05, 0x00, 0xfa, 0xff, 'h', 'e', 'l', 'l', 'o',
+		0x01, 0x00, 0x00, 0xff, 0xff,
+		0x86, 0xa6, 0x10, 0x36, 0x05, 0x00, 0x00, 0x00}
+	if _, err := core.DiffGzip(oldData, stored, nil); !errors.Is(err, core.ErrNotRecompressible) {
+		t.Errorf("Expected ErrNotRecompressible for foreign deflate stream, got %v", err)
+	}
+
+	if _, err := core.DiffGzip(oldData, []byte("not gzip at all"), nil); !errors.Is(err, core.ErrNotRecompressible) {
+		t.Errorf("Expected ErrNotRecompressible for non-gzip input, got %v", err)
+	}
+}
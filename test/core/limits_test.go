@@ -0,0 +1,133 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"bindiff/types"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"testing"
+)
+
+// limitedConfig 返回设置了资源上限的默认配置
+func limitedConfig(outputMB, opMB, ops int) *config.Config {
+	cfg := config.DefaultConfig()
+	cfg.Limits = config.LimitsConfig{MaxOutputMB: outputMB, MaxOpMB: opMB, MaxOps: ops}
+	return cfg
+}
+
+// wantLimit 检查 err 是指定配置项的 *LimitError
+func wantLimit(t *testing.T, err error, limit string) {
+	t.Helper()
+	var limitErr *core.LimitError
+	if !errors.As(err, &limitErr) || !errors.Is(err, core.ErrLimitExceeded) {
+		t.Fatalf("error %v, want *LimitError", err)
+	}
+	if limitErr.Limit != limit {
+		t.Errorf("limit %s exceeded, want %s", limitErr.Limit, limit)
+	}
+}
+
+// TestApplyLimits 测试操作数、单个操作长度与输出大小的上限在严格与宽松模式下都中止应用
+func TestApplyLimits(t *testing.T) {
+	oldData := bytes.Repeat([]byte("limits "), 1000)
+	many := make([]types.Patch, 10)
+	for i := range many {
+		many[i] = types.Patch{Op: types.OP_INSERT, Offset: int64(i), Length: 1, Data: []byte("x")}
+	}
+	big := []types.Patch{{Op: types.OP_INSERT, Offset: 0, Length: 2 << 20, Data: make([]byte, 2<<20)}}
+
+	tests := []struct {
+		name    string
+		cfg     *config.Config
+		patches []types.Patch
+		limit   string
+	}{
+		{"max_ops", limitedConfig(0, 0, 5), many, "limits.max_ops"},
+		{"max_op_mb", limitedConfig(0, 1, 0), big, "limits.max_op_mb"},
+		{"max_output_mb", limitedConfig(1, 0, 0), big, "limits.max_output_mb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, lenient := range []bool{false, true} {
+				_, err := core.Apply(oldData, tt.patches, &core.ApplyOptions{Config: tt.cfg, Lenient: lenient})
+				wantLimit(t, err, tt.limit)
+			}
+			// 不设置上限时正常应用
+			if _, err := core.Apply(oldData, tt.patches, &core.ApplyOptions{Config: config.DefaultConfig()}); err != nil {
+				t.Errorf("unlimited apply failed: %v", err)
+			}
+		})
+	}
+}
+
+// TestApplyDiffFileLimits 测试记录的新文件大小超出上限时在应用之前返回错误，流式应用不写出任何数据
+func TestApplyDiffFileLimits(t *testing.T) {
+	oldData := bytes.Repeat([]byte("output limit "), 100)
+	newData := append(bytes.Repeat([]byte{0x5a}, 2<<20), oldData...)
+	df := newTestDiffFile(t, types.HASH_SHA256, oldData, newData)
+	cfg := limitedConfig(1, 0, 0)
+
+	_, err := core.ApplyDiffFile(oldData, df, &core.ApplyOptions{Config: cfg})
+	wantLimit(t, err, "limits.max_output_mb")
+
+	var out bytes.Buffer
+	_, err = core.ApplyDiffFileStream(bytes.NewReader(oldData), bytes.NewReader(core.EncodeDiffFile(df)), &out,
+		&core.ApplyOptions{Config: cfg})
+	wantLimit(t, err, "limits.max_output_mb")
+	if out.Len() != 0 {
+		t.Errorf("ApplyDiffFileStream wrote %d bytes before rejecting the patch", out.Len())
+	}
+
+	// 操作数超限的补丁在可定位的输入上预先检查，不写出任何数据
+	df = newTestDiffFile(t, types.HASH_SHA256, oldData, append(append([]byte("head "), oldData...), " tail"...))
+	if len(df.Diff) < 2 {
+		t.Fatalf("test patch has %d entries, want at least 2", len(df.Diff))
+	}
+	_, err = core.ApplyDiffFileStream(bytes.NewReader(oldData), bytes.NewReader(core.EncodeDiffFile(df)), &out,
+		&core.ApplyOptions{Config: limitedConfig(0, 0, 1)})
+	wantLimit(t, err, "limits.max_ops")
+	if out.Len() != 0 {
+		t.Errorf("ApplyDiffFileStream wrote %d bytes before rejecting the patch", out.Len())
+	}
+}
+
+// TestApplyIteratorOutputLimit 测试流式应用中隐式复制的剩余数据也计入输出上限
+func TestApplyIteratorOutputLimit(t *testing.T) {
+	oldData := make([]byte, 3<<20)
+	patch := core.EncodePatch([]types.Patch{{Op: types.OP_INSERT, Offset: 0, Length: 1, Data: []byte("x")}})
+
+	err := core.ApplyIterator(bytes.NewReader(oldData), core.NewPatchIterator(bytes.NewReader(patch)), io.Discard,
+		&core.ApplyOptions{Config: limitedConfig(2, 0, 0)})
+	wantLimit(t, err, "limits.max_output_mb")
+
+	err = core.ApplyIterator(bytes.NewReader(oldData), core.NewPatchIterator(bytes.NewReader(patch)), io.Discard,
+		&core.ApplyOptions{Config: limitedConfig(4, 0, 0)})
+	if err != nil {
+		t.Errorf("ApplyIterator within the limit failed: %v", err)
+	}
+}
+
+// TestArchiveInflateLimit 测试压缩片段解压到输出上限即中止，压缩炸弹不会被完整解压
+func TestArchiveInflateLimit(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	w.Write(make([]byte, 64<<20))
+	w.Close()
+	oldData := buf.Bytes()
+
+	patch := &core.ArchivePatch{Segments: []core.ArchiveSegment{{
+		BaseLength: int64(len(oldData)),
+		Deflate:    true,
+		Level:      flate.BestCompression,
+		Size:       int64(len(oldData)),
+	}}}
+	_, err := core.ApplyArchive(oldData, patch, &core.ApplyOptions{Config: limitedConfig(1, 0, 0)})
+	wantLimit(t, err, "limits.max_output_mb")
+
+	zero := &core.ArchivePatch{Segments: []core.ArchiveSegment{{Zero: true, Size: 1 << 40}}}
+	_, err = core.ApplyArchive(nil, zero, &core.ApplyOptions{Config: limitedConfig(1, 0, 0)})
+	wantLimit(t, err, "limits.max_output_mb")
+}
@@ -0,0 +1,212 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/types"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// merkleTestData 返回 n 字节的确定性测试数据
+func merkleTestData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i/251)
+	}
+	return data
+}
+
+// wantMerkleBlocks 检查 err 是指明 blocks 出错的 *MerkleError
+func wantMerkleBlocks(t *testing.T, err error, blocks ...int) *core.MerkleError {
+	t.Helper()
+	var merkleErr *core.MerkleError
+	if !errors.As(err, &merkleErr) || !errors.Is(err, core.ErrHashMismatch) {
+		t.Fatalf("error %v, want *MerkleError", err)
+	}
+	if len(merkleErr.Blocks) != len(blocks) {
+		t.Fatalf("wrong blocks %v, want %v", merkleErr.Blocks, blocks)
+	}
+	for i, b := range blocks {
+		if merkleErr.Blocks[i] != b {
+			t.Fatalf("wrong blocks %v, want %v", merkleErr.Blocks, blocks)
+		}
+	}
+	return merkleErr
+}
+
+// TestMerkleTree 测试由叶子重建的树与直接构造的树一致，逐块校验指出出错的区间
+func TestMerkleTree(t *testing.T) {
+	data := merkleTestData(10*1024 + 100)
+	tree, err := core.BuildMerkleTree(types.HASH_SHA256, data, 1024)
+	if err != nil {
+		t.Fatalf("BuildMerkleTree failed: %v", err)
+	}
+	if tree.Blocks() != 11 {
+		t.Fatalf("Blocks = %d, want 11", tree.Blocks())
+	}
+	rebuilt, err := core.NewMerkleTree(types.HASH_SHA256, 1024, int64(len(data)), tree.Leaves(), tree.Root())
+	if err != nil {
+		t.Fatalf("NewMerkleTree failed: %v", err)
+	}
+	if !bytes.Equal(rebuilt.Leaves(), tree.Leaves()) {
+		t.Error("rebuilt tree has different leaves")
+	}
+	if _, err := core.NewMerkleTree(types.HASH_SHA256, 1024, int64(len(data))+1024, tree.Leaves(), tree.Root()); !errors.Is(err, core.ErrCorruptPatch) {
+		t.Errorf("NewMerkleTree with too few leaves = %v, want ErrCorruptPatch", err)
+	}
+	// 叶子被替换（如与另一份数据的叶子对调）时与根不符
+	leaves := tree.Leaves()
+	leaves[5] ^= 1
+	if _, err := core.NewMerkleTree(types.HASH_SHA256, 1024, int64(len(data)), leaves, tree.Root()); !errors.Is(err, core.ErrCorruptPatch) {
+		t.Errorf("NewMerkleTree with a changed leaf = %v, want ErrCorruptPatch", err)
+	}
+	empty, err := core.BuildMerkleTree(types.HASH_SHA256, nil, 1024)
+	if err != nil || empty.Blocks() != 0 || len(empty.Root()) != 32 {
+		t.Errorf("BuildMerkleTree on empty data = %v, want 0 blocks and a root", err)
+	}
+	if err := tree.Verify(data); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	// 损坏第 2、3 块与最后一块，相邻的块合并为一个区间
+	bad := bytes.Clone(data)
+	bad[2*1024+5] ^= 1
+	bad[3*1024] ^= 1
+	bad[len(bad)-1] ^= 1
+	merkleErr := wantMerkleBlocks(t, tree.Verify(bad), 2, 3, 10)
+	want := [][2]int64{{2 * 1024, 4 * 1024}, {10 * 1024, int64(len(data))}}
+	if ranges := merkleErr.Ranges(); len(ranges) != 2 || ranges[0] != want[0] || ranges[1] != want[1] {
+		t.Errorf("Ranges = %v, want %v", ranges, want)
+	}
+
+	// 截断的数据缺少的块记为出错，多出的数据报告为哈希不一致
+	wantMerkleBlocks(t, tree.Verify(data[:9*1024]), 9, 10)
+	if err := tree.Verify(append(bytes.Clone(data), 'x')); !errors.Is(err, core.ErrHashMismatch) {
+		t.Errorf("Verify with extra data = %v, want ErrHashMismatch", err)
+	}
+}
+
+// TestMerkleVerifyRange 测试只校验与块对齐的一段数据
+func TestMerkleVerifyRange(t *testing.T) {
+	data := merkleTestData(5*512 + 10)
+	tree, err := core.BuildMerkleTree(types.HASH_BLAKE3, data, 512)
+	if err != nil {
+		t.Fatalf("BuildMerkleTree failed: %v", err)
+	}
+	if err := tree.VerifyRange(512, data[512:3*512]); err != nil {
+		t.Errorf("VerifyRange of whole blocks failed: %v", err)
+	}
+	if err := tree.VerifyRange(4*512, data[4*512:]); err != nil {
+		t.Errorf("VerifyRange up to the end failed: %v", err)
+	}
+
+	part := bytes.Clone(data[2*512 : 4*512])
+	part[600] ^= 1
+	merkleErr := wantMerkleBlocks(t, tree.VerifyRange(2*512, part), 3)
+	if start, end := tree.BlockRange(3); merkleErr.Ranges()[0] != [2]int64{start, end} {
+		t.Errorf("Ranges = %v, want [%d, %d)", merkleErr.Ranges(), start, end)
+	}
+
+	for _, r := range [][2]int{{100, 512}, {0, 700}, {4 * 512, 5*512 + 5}} {
+		if err := tree.VerifyRange(int64(r[0]), data[r[0]:r[1]]); err == nil || errors.Is(err, core.ErrHashMismatch) {
+			t.Errorf("VerifyRange(%d, %d bytes) = %v, want an alignment error", r[0], r[1]-r[0], err)
+		}
+	}
+}
+
+// TestMerklePatchRoundTrip 测试 Merkle 树随补丁编码与解码，版本 4 的补丁不带树仍然可读
+func TestMerklePatchRoundTrip(t *testing.T) {
+	oldData := merkleTestData(40 << 10)
+	newData := append(bytes.Clone(oldData[:10000]), "merkle"...)
+	newData = append(newData, oldData[10000:]...)
+	df := newTestDiffFile(t, types.HASH_SHA256, oldData, newData)
+	df.Version = types.PATCH_VERSION_V4
+	if err := core.AddMerkleTree(&df, newData, 4<<10); err != nil {
+		t.Fatalf("AddMerkleTree failed: %v", err)
+	}
+	if df.Version != types.PATCH_VERSION {
+		t.Errorf("AddMerkleTree left version %d, want %d", df.Version, types.PATCH_VERSION)
+	}
+
+	decoded, err := core.DecodeDiffFile(core.EncodeDiffFile(df))
+	if err != nil {
+		t.Fatalf("DecodeDiffFile failed: %v", err)
+	}
+	if decoded.MerkleBlockSize != 4<<10 || !bytes.Equal(decoded.MerkleLeaves, df.MerkleLeaves) ||
+		!bytes.Equal(decoded.MerkleRoot, df.MerkleRoot) {
+		t.Fatalf("decoded merkle tree: block size %d, %d bytes of leaves, root %x",
+			decoded.MerkleBlockSize, len(decoded.MerkleLeaves), decoded.MerkleRoot)
+	}
+	tree, err := core.DiffFileMerkleTree(decoded)
+	if err != nil || tree == nil {
+		t.Fatalf("DiffFileMerkleTree = %v, %v", tree, err)
+	}
+	if err := tree.Verify(newData); err != nil {
+		t.Errorf("decoded tree rejects the new data: %v", err)
+	}
+	forged := decoded
+	forged.MerkleLeaves = bytes.Clone(decoded.MerkleLeaves)
+	forged.MerkleLeaves[0] ^= 1
+	if _, err := core.DiffFileMerkleTree(forged); !errors.Is(err, core.ErrCorruptPatch) {
+		t.Errorf("DiffFileMerkleTree with a changed leaf = %v, want ErrCorruptPatch", err)
+	}
+
+	v4 := newTestDiffFile(t, types.HASH_SHA256, oldData, newData)
+	v4.Version = types.PATCH_VERSION_V4
+	decoded, err = core.DecodeDiffFile(core.EncodeDiffFile(v4))
+	if err != nil || decoded.Version != types.PATCH_VERSION_V4 || decoded.MerkleBlockSize != 0 {
+		t.Fatalf("DecodeDiffFile on version 4 = %v (version %d, merkle block %d)", err, decoded.Version, decoded.MerkleBlockSize)
+	}
+	if tree, err := core.DiffFileMerkleTree(decoded); tree != nil || err != nil {
+		t.Errorf("DiffFileMerkleTree on version 4 = %v, %v", tree, err)
+	}
+
+	if err := core.AddMerkleTree(&df, newData, 0); err == nil {
+		t.Error("AddMerkleTree accepted a zero block size")
+	}
+}
+
+// TestMerkleResult 测试结果不一致时内存与流式应用都指出出错的输出块
+func TestMerkleResult(t *testing.T) {
+	oldData := merkleTestData(64 << 10)
+	newData := append(bytes.Clone(oldData[:20000]), "inserted"...)
+	newData = append(newData, oldData[20000:]...)
+	df := newTestDiffFile(t, types.HASH_SHA256, oldData, newData)
+	if err := core.AddMerkleTree(&df, newData, 8<<10); err != nil {
+		t.Fatalf("AddMerkleTree failed: %v", err)
+	}
+	if err := core.VerifyDiffFileResult(df, newData, nil); err != nil {
+		t.Fatalf("VerifyDiffFileResult failed: %v", err)
+	}
+
+	bad := bytes.Clone(newData)
+	bad[5*(8<<10)+3] ^= 0x80
+	wantMerkleBlocks(t, core.VerifyDiffFileResult(df, bad, nil), 5)
+
+	// 补丁记录的结果与差分数据产生的结果在第 2 块不同，流式应用在结束时指出该块
+	expected := bytes.Clone(newData)
+	expected[2*(8<<10)+100] ^= 0x01
+	wrong := df
+	if err := core.AddMerkleTree(&wrong, expected, 8<<10); err != nil {
+		t.Fatalf("AddMerkleTree failed: %v", err)
+	}
+	var err error
+	if wrong.NewHash, err = core.ComputeHashWith(types.HASH_SHA256, expected); err != nil {
+		t.Fatalf("ComputeHashWith failed: %v", err)
+	}
+	_, err = core.ApplyDiffFileStream(bytes.NewReader(oldData), bytes.NewReader(core.EncodeDiffFile(wrong)), io.Discard,
+		&core.ApplyOptions{VerifyResult: true})
+	merkleErr := wantMerkleBlocks(t, err, 2)
+	if merkleErr.Err == nil {
+		t.Error("MerkleError does not wrap the result hash error")
+	}
+
+	// 没有 Merkle 树时只报告哈希不一致
+	plain := newTestDiffFile(t, types.HASH_SHA256, oldData, newData)
+	var target *core.MerkleError
+	if err := core.VerifyDiffFileResult(plain, bad, nil); !errors.Is(err, core.ErrHashMismatch) || errors.As(err, &target) {
+		t.Errorf("VerifyDiffFileResult without a tree = %v, want a plain hash mismatch", err)
+	}
+}
@@ -0,0 +1,67 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"bindiff/types"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// TestCreateAndApplyPatchFile 测试生成补丁文件使用配置的哈希算法，应用时校验两端哈希
+func TestCreateAndApplyPatchFile(t *testing.T) {
+	oldData := bytes.Repeat([]byte("patch file helper round trip. "), 200)
+	newData := append(append([]byte{}, oldData[:3000]...), []byte("inserted")...)
+	newData = append(newData, oldData[3000:]...)
+
+	for _, tt := range []struct {
+		name string
+		algo types.HashAlgorithm
+	}{
+		{"sha256", types.HASH_SHA256},
+		{"blake3", types.HASH_BLAKE3},
+		{"xxhash", types.HASH_XXHASH64},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.HashAlgorithm = tt.name
+			patch, err := core.CreatePatchFile(oldData, newData, &core.DiffOptions{Config: cfg})
+			if err != nil {
+				t.Fatalf("CreatePatchFile failed: %v", err)
+			}
+			df, err := core.DecodeDiffFile(patch)
+			if err != nil {
+				t.Fatalf("DecodeDiffFile failed: %v", err)
+			}
+			if df.HashAlgorithm != tt.algo {
+				t.Errorf("HashAlgorithm = %d, want %d", df.HashAlgorithm, tt.algo)
+			}
+
+			got, err := core.ApplyPatchFile(oldData, patch, nil)
+			if err != nil {
+				t.Fatalf("ApplyPatchFile failed: %v", err)
+			}
+			if !bytes.Equal(got, newData) {
+				t.Fatal("Applied result mismatch")
+			}
+		})
+	}
+}
+
+// TestApplyPatchFileRejects 测试旧数据不匹配与损坏的补丁被拒绝
+func TestApplyPatchFileRejects(t *testing.T) {
+	oldData := []byte("the original content of the old file")
+	newData := []byte("the updated content of the new file")
+	patch, err := core.CreatePatchFile(oldData, newData, nil)
+	if err != nil {
+		t.Fatalf("CreatePatchFile failed: %v", err)
+	}
+
+	if _, err := core.ApplyPatchFile([]byte("some other file"), patch, nil); !errors.Is(err, core.ErrHashMismatch) {
+		t.Errorf("Expected ErrHashMismatch for wrong old data, got %v", err)
+	}
+	if _, err := core.ApplyPatchFile(oldData, []byte("not a patch"), nil); !errors.Is(err, core.ErrCorruptPatch) {
+		t.Errorf("Expected ErrCorruptPatch for garbage, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"bindiff/types"
+	"compress/gzip"
+	"testing"
+)
+
+// TestProfileFor 测试配置档按文件名与检测到的类型匹配，用户配置档优先于内置配置档
+func TestProfileFor(t *testing.T) {
+	gz := gzipData(t, []byte("profile test data"), gzip.BestCompression, "a.txt")
+	cfg := config.DefaultConfig()
+	cfg.Profiles = []config.Profile{
+		{Match: "*.log.gz", Strategy: config.StrategyRaw},
+		{Match: "type:gzip", BlockSize: 256},
+	}
+
+	tests := []struct {
+		name, path string
+		data       []byte
+		match      string
+	}{
+		{"user_pattern", "logs/app.log.gz", gz, "*.log.gz"},
+		{"detected_type", "data/blob", gz, "type:gzip"},
+		{"default_pattern", "lib/libz.so.1", []byte("not an elf"), "*.so.*"},
+		{"no_match", "readme.txt", []byte("text"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := core.ProfileFor(cfg, tt.path, tt.data)
+			if ok != (tt.match != "") || p.Match != tt.match {
+				t.Errorf("ProfileFor(%s) = %+v, %v; expected %q", tt.path, p, ok, tt.match)
+			}
+		})
+	}
+
+	options := core.WithProfile(&core.DiffOptions{Config: cfg}, "data/blob", gz)
+	if options.Config.BlockSize != 256 || options.Config.MinMatchLength != 64 || options.Strategy != "" {
+		t.Errorf("Unexpected profile options: block size %d, min match %d, strategy %q",
+			options.Config.BlockSize, options.Config.MinMatchLength, options.Strategy)
+	}
+	if cfg.BlockSize != config.DefaultConfig().BlockSize {
+		t.Errorf("WithProfile modified the caller's config")
+	}
+}
+
+// TestDiffPayloadStrategy 测试 Strategy 限定 DiffPayload 尝试的差分方式
+func TestDiffPayloadStrategy(t *testing.T) {
+	oldGz := gzipData(t, []byte("the quick brown fox jumps over the lazy dog"), gzip.DefaultCompression, "a.txt")
+	newGz := gzipData(t, []byte("the quick brown fox jumps over the lazy cat"), gzip.DefaultCompression, "a.txt")
+
+	for strategy, expected := range map[string]types.PatchFormat{
+		"":                     types.FORMAT_GZIP,
+		config.StrategyGzip:    types.FORMAT_GZIP,
+		config.StrategyRaw:     types.FORMAT_RAW,
+		config.StrategyArchive: types.FORMAT_RAW,
+	} {
+		format, _, _, err := core.DiffPayload(oldGz, newGz, &core.DiffOptions{Strategy: strategy})
+		if err != nil {
+			t.Fatalf("DiffPayload (strategy %q) failed: %v", strategy, err)
+		}
+		if format != expected {
+			t.Errorf("Strategy %q produced format %d, expected %d", strategy, format, expected)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"context"
+	"testing"
+)
+
+// TestComputeOffsetSampled 测试抽样对齐找到插入前缀后的偏移量
+func TestComputeOffsetSampled(t *testing.T) {
+	oldData := randomBytes(4<<20, 3)
+	newData := append(randomBytes(3000, 4), oldData...)
+
+	offset, err := core.ComputeOffsetSampled(context.Background(), oldData, newData, 0, 0)
+	if err != nil {
+		t.Fatalf("ComputeOffsetSampled failed: %v", err)
+	}
+	if offset != -3000 {
+		t.Errorf("Expected offset -3000, got %d", offset)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.AlignStrategy = config.AlignStrategySampled
+	cfg.AlignSamples = 8
+	cfg.AlignSampleSize = 16 << 10
+	align, err := core.ComputeAlignment(context.Background(), oldData, newData, cfg)
+	if err != nil {
+		t.Fatalf("ComputeAlignment failed: %v", err)
+	}
+	if align.Offset != -3000 || align.Confidence < core.MinAlignConfidence {
+		t.Errorf("Unexpected sampled alignment: %+v", align)
+	}
+
+	// 数据不超过所有窗口的总大小时对整个数据做相关
+	small := randomBytes(10000, 5)
+	smallNew := append(randomBytes(100, 6), small...)
+	if offset, err := core.ComputeOffsetSampled(context.Background(), small, smallNew, 0, 0); err != nil || offset != core.ComputeOffset(small, smallNew) {
+		t.Errorf("Small sampled offset %d (%v), expected %d", offset, err, core.ComputeOffset(small, smallNew))
+	}
+}
+
+// TestComputeOffsetSampledUnrelated 测试无关数据上各窗口都不可信时置信度低于阈值
+func TestComputeOffsetSampledUnrelated(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.AlignStrategy = config.AlignStrategySampled
+	cfg.AlignSamples = 4
+	cfg.AlignSampleSize = 16 << 10
+	align, err := core.ComputeAlignment(context.Background(), randomBytes(1<<20, 7), randomBytes(1<<20, 8), cfg)
+	if err != nil {
+		t.Fatalf("ComputeAlignment failed: %v", err)
+	}
+	if align.Confidence >= core.MinAlignConfidence {
+		t.Errorf("Expected low confidence on unrelated data, got %+v", align)
+	}
+}
@@ -0,0 +1,94 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/types"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// sqliteImage 构造由给定页组成的 SQLite 文件，第一页写入文件头
+func sqliteImage(pageSize int, pages [][]byte, freeTrunk uint32) []byte {
+	data := bytes.Join(pages, nil)
+	copy(data, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(data[16:], uint16(pageSize))
+	binary.BigEndian.PutUint32(data[32:], freeTrunk)
+	return data
+}
+
+// TestDiffSQLite 测试页移动与页内修改的逐页差分
+func TestDiffSQLite(t *testing.T) {
+	const pageSize = 4096
+	rng := rand.New(rand.NewSource(5))
+	oldPages := make([][]byte, 64)
+	for i := range oldPages {
+		oldPages[i] = make([]byte, pageSize)
+		rng.Read(oldPages[i])
+	}
+	// 第 10 页为空闲链表主干页，第 11 页为叶子页
+	binary.BigEndian.PutUint32(oldPages[9][0:], 0)
+	binary.BigEndian.PutUint32(oldPages[9][4:], 1)
+	binary.BigEndian.PutUint32(oldPages[9][8:], 11)
+	oldData := sqliteImage(pageSize, oldPages, 10)
+
+	// 打乱页顺序、修改一页并追加新页
+	newPages := make([][]byte, 0, 66)
+	newPages = append(newPages, oldPages[0])
+	for i := 63; i >= 1; i-- {
+		newPages = append(newPages, append([]byte(nil), oldPages[i]...))
+	}
+	copy(newPages[5][100:], "updated row")
+	extra := make([]byte, pageSize)
+	rng.Read(extra)
+	newPages = append(newPages, extra)
+	newData := sqliteImage(pageSize, newPages, 0)
+
+	if core.SQLitePageSize(oldData) != pageSize {
+		t.Fatalf("Page size not detected")
+	}
+	patch, err := core.DiffSQLite(oldData, newData, nil)
+	if err != nil {
+		t.Fatalf("DiffSQLite failed: %v", err)
+	}
+	payload := core.EncodeArchivePatch(patch)
+	if len(payload) > 4*pageSize {
+		t.Errorf("SQLite patch is %d bytes, expected about two pages", len(payload))
+	}
+
+	df := types.DiffFile{
+		MagicNumber: types.PATCH_MAGIC,
+		Version:     types.PATCH_VERSION,
+		Format:      types.FORMAT_SQLITE,
+		OldSize:     uint32(len(oldData)),
+		NewSize:     uint32(len(newData)),
+		OldHash:     core.ComputeHash(oldData),
+		NewHash:     core.ComputeHash(newData),
+		Payload:     payload,
+	}
+	decoded, err := core.DecodeDiffFile(core.EncodeDiffFile(df))
+	if err != nil {
+		t.Fatalf("DecodeDiffFile failed: %v", err)
+	}
+	if err := core.ValidateDiffFile(decoded); err != nil {
+		t.Errorf("ValidateDiffFile failed: %v", err)
+	}
+	got, err := core.ApplyDiffFile(oldData, decoded, nil)
+	if err != nil {
+		t.Fatalf("ApplyDiffFile failed: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Error("Database not reconstructed bit-exactly")
+	}
+
+	format, _, _, err := core.DiffPayload(oldData, newData, nil)
+	if err != nil || format != types.FORMAT_SQLITE {
+		t.Errorf("DiffPayload chose format %d, %v", format, err)
+	}
+	other := sqliteImage(1024, [][]byte{make([]byte, 1024)}, 0)
+	if _, err := core.DiffSQLite(oldData, other, nil); !errors.Is(err, core.ErrNotSQLite) {
+		t.Errorf("Expected ErrNotSQLite for different page sizes, got %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/utils"
+	"bindiff/types"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestStreamingRoundTrip 测试流式差分与流式应用
+func TestStreamingRoundTrip(t *testing.T) {
+	large := make([]byte, 300*1024)
+	for i := range large {
+		large[i] = byte(i % 251)
+	}
+	changed := append([]byte(nil), large...)
+	copy(changed[70*1024:], bytes.Repeat([]byte{0xFF}, 200*1024))
+
+	tests := []struct {
+		name    string
+		oldData []byte
+		newData []byte
+	}{
+		{"identical", []byte("hello world"), []byte("hello world")},
+		{"append", []byte("hello"), []byte("hello world")},
+		{"truncate", []byte("hello world"), []byte("hello")},
+		{"replace", []byte("hello world"), []byte("hello earth")},
+		{"empty_old", []byte{}, []byte("content")},
+		{"empty_new", []byte("content"), []byte{}},
+		{"multi_chunk", large, changed},
+		{"multi_chunk_grow", large[:100*1024], changed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch bytes.Buffer
+			differ := core.NewDiffer(bytes.NewReader(tt.oldData), nil)
+			if err := differ.WriteDiff(bytes.NewReader(tt.newData), &patch); err != nil {
+				t.Fatalf("WriteDiff failed: %v", err)
+			}
+
+			// 流式输出应与内存差分的编码结果一致
+			patches, err := core.DiffBytes(tt.oldData, tt.newData, nil)
+			if err != nil {
+				t.Fatalf("DiffBytes failed: %v", err)
+			}
+			if len(tt.newData) < 1024*1024 && !bytes.Equal(patch.Bytes(), core.EncodePatch(patches)) {
+				t.Error("Streaming patch differs from in-memory patch")
+			}
+
+			var out bytes.Buffer
+			if err := core.ApplyStream(bytes.NewReader(tt.oldData), bytes.NewReader(patch.Bytes()), &out); err != nil {
+				t.Fatalf("ApplyStream failed: %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), tt.newData) {
+				t.Errorf("ApplyStream result mismatch: got %d bytes, expected %d", out.Len(), len(tt.newData))
+			}
+		})
+	}
+}
+
+// TestApplyStreamInvalidPatch 测试流式应用对无效补丁的处理
+func TestApplyStreamInvalidPatch(t *testing.T) {
+	patches, err := core.DiffBytes([]byte("hello world"), []byte("hello"), nil)
+	if err != nil {
+		t.Fatalf("DiffBytes failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	err = core.ApplyStream(bytes.NewReader([]byte("hi")), bytes.NewReader(core.EncodePatch(patches)), &out)
+	var patchErr *core.PatchError
+	if !errors.As(err, &patchErr) {
+		t.Errorf("Expected *core.PatchError for short old data, got %v", err)
+	}
+}
+
+// TestStreamingCancellation 测试流式接口的上下文取消
+func TestStreamingCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	data := bytes.Repeat([]byte("abc"), 1024)
+	var out bytes.Buffer
+	differ := core.NewDiffer(bytes.NewReader(data), &core.DiffOptions{Context: ctx})
+	if err := differ.WriteDiff(bytes.NewReader(data), &out); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from WriteDiff, got %v", err)
+	}
+
+	patch := core.EncodePatch([]types.Patch{{Op: types.OP_COPY, Offset: 0, Length: int64(len(data))}})
+	err := core.ApplyStreamWithOptions(bytes.NewReader(data), bytes.NewReader(patch), &out,
+		&core.ApplyOptions{Context: ctx})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from ApplyStream, got %v", err)
+	}
+}
+
+// TestPatchIterator 测试补丁迭代器与基于迭代器的应用
+func TestPatchIterator(t *testing.T) {
+	oldData := bytes.Repeat([]byte("0123456789"), 1000)
+	newData := append([]byte(nil), oldData...)
+	for i := 100; i < len(newData); i += 997 {
+		newData[i] = 'x'
+	}
+	newData = append(newData, "tail"...)
+
+	df := newTestDiffFile(t, types.HASH_SHA256, oldData, newData)
+	encoded := core.EncodeDiffFile(df)
+
+	r := bytes.NewReader(encoded)
+	header, err := core.ReadDiffHeader(r)
+	if err != nil {
+		t.Fatalf("ReadDiffHeader failed: %v", err)
+	}
+
+	it := core.NewPatchIterator(io.LimitReader(r, int64(header.DataLength)))
+	count := 0
+	for it.Next() {
+		p := it.Patch()
+		if it.Index() != count || p.Op != df.Diff[count].Op || p.Offset != df.Diff[count].Offset ||
+			!bytes.Equal(p.Data, df.Diff[count].Data) {
+			t.Fatalf("Entry %d mismatch: %+v vs %+v", count, p, df.Diff[count])
+		}
+		count++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Iterator error: %v", err)
+	}
+	if count != len(df.Diff) {
+		t.Errorf("Expected %d entries, got %d", len(df.Diff), count)
+	}
+
+	var out bytes.Buffer
+	it = core.NewPatchIterator(bytes.NewReader(core.EncodePatch(df.Diff)))
+	if err := core.ApplyIterator(bytes.NewReader(oldData), it, &out, nil); err != nil {
+		t.Fatalf("ApplyIterator failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), newData) {
+		t.Error("ApplyIterator result mismatch")
+	}
+
+	// 截断的补丁应报告错误
+	truncated := core.EncodePatch(df.Diff)
+	it = core.NewPatchIterator(bytes.NewReader(truncated[:len(truncated)-2]))
+	for it.Next() {
+	}
+	if it.Err() == nil {
+		t.Error("Expected error for truncated patch")
+	}
+}
+
+// TestDifferConcurrent 测试共享差分器的并发使用
+func TestDifferConcurrent(t *testing.T) {
+	d := core.NewSharedDiffer(nil)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			oldData := bytes.Repeat([]byte{byte(g), 1, 2, 3}, 4096+g*100)
+			newData := append([]byte("prefix"), oldData...)
+			newData[len(newData)/2] ^= 0xFF
+
+			for i := 0; i < 4; i++ {
+				patches, err := d.Diff(oldData, newData)
+				if err != nil {
+					t.Errorf("Diff failed: %v", err)
+					return
+				}
+				result, err := core.Apply(oldData, patches, nil)
+				if err != nil || !bytes.Equal(result, newData) {
+					t.Errorf("Round trip failed in goroutine %d: %v", g, err)
+					return
+				}
+
+				offset, err := d.ComputeOffset(oldData[:1024], newData[:1024])
+				if err != nil {
+					t.Errorf("ComputeOffset failed: %v", err)
+					return
+				}
+				if expected := core.ComputeOffset(oldData[:1024], newData[:1024]); offset != expected {
+					t.Errorf("Offset mismatch: expected %d, got %d", expected, offset)
+				}
+
+				var out bytes.Buffer
+				if err := d.WriteDiffFrom(bytes.NewReader(oldData), bytes.NewReader(newData), &out); err != nil {
+					t.Errorf("WriteDiffFrom failed: %v", err)
+					return
+				}
+				var applied bytes.Buffer
+				if err := core.ApplyStream(bytes.NewReader(oldData), &out, &applied); err != nil || !bytes.Equal(applied.Bytes(), newData) {
+					t.Errorf("Streaming round trip failed in goroutine %d: %v", g, err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if err := d.WriteDiff(bytes.NewReader(nil), io.Discard); err == nil {
+		t.Error("Expected error from WriteDiff without old data")
+	}
+}
+
+// TestApplyDiffFileStream 测试补丁文件的流式应用与两端哈希校验
+func TestApplyDiffFileStream(t *testing.T) {
+	oldData := bytes.Repeat([]byte("streaming apply "), 20*1024)
+	newData := append([]byte("header "), oldData[1000:]...)
+	copy(newData[100*1024:], "changed in the middle")
+	df := newTestDiffFile(t, types.HASH_SHA256, oldData, newData)
+	encoded := core.EncodeDiffFile(df)
+
+	var out bytes.Buffer
+	got, err := core.ApplyDiffFileStream(bytes.NewReader(oldData), bytes.NewReader(encoded), &out,
+		&core.ApplyOptions{VerifyResult: true})
+	if err != nil {
+		t.Fatalf("ApplyDiffFileStream failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), newData) || string(got.NewFileName) != "new" {
+		t.Errorf("Streamed result mismatch: got %d bytes, expected %d", out.Len(), len(newData))
+	}
+
+	apply := func(old, patch []byte) error {
+		_, err := core.ApplyDiffFileStream(bytes.NewReader(old), bytes.NewReader(patch), io.Discard,
+			&core.ApplyOptions{VerifyResult: true})
+		return err
+	}
+	wrongOld := append([]byte(nil), oldData...)
+	wrongOld[5] ^= 0xFF
+	if err := apply(wrongOld, encoded); !errors.Is(err, core.ErrHashMismatch) {
+		t.Errorf("Expected ErrHashMismatch for modified old data, got %v", err)
+	}
+	if err := apply(append(oldData, 'x'), encoded); !errors.Is(err, core.ErrHashMismatch) {
+		t.Errorf("Expected ErrHashMismatch for longer old data, got %v", err)
+	}
+
+	badNew := df
+	badNew.NewHash = append([]byte(nil), df.NewHash...)
+	badNew.NewHash[0] ^= 0xFF
+	if err := apply(oldData, core.EncodeDiffFile(badNew)); !errors.Is(err, core.ErrHashMismatch) {
+		t.Errorf("Expected ErrHashMismatch for a wrong new hash, got %v", err)
+	}
+
+	payload := df
+	payload.Format, payload.Diff, payload.Payload = types.FORMAT_GZIP, nil, []byte("payload")
+	if err := apply(oldData, core.EncodeDiffFile(payload)); !errors.Is(err, core.ErrNotStreamable) {
+		t.Errorf("Expected ErrNotStreamable, got %v", err)
+	}
+}
+
+// TestApplyDiffFileStreamFiles 测试旧数据与输出都是文件时按区间直接复制的结果
+func TestApplyDiffFileStreamFiles(t *testing.T) {
+	// 长度不按页对齐，O_DIRECT 打开时 copy_file_range 复制尾部会失败
+	oldData := make([]byte, 2<<20+1234)
+	for i := range oldData {
+		oldData[i] = byte(i*13 + i>>9)
+	}
+	newData := append([]byte(nil), oldData[:700000]...)
+	newData = append(newData, "a small change"...)
+	newData = append(newData, oldData[700100:]...)
+	df := newTestDiffFile(t, types.HASH_BLAKE3, oldData, newData)
+	encoded := core.EncodeDiffFile(df)
+
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.bin")
+	if err := os.WriteFile(oldPath, oldData, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, direct := range []bool{false, true} {
+		old, err := utils.OpenInput(oldPath, utils.IOHints{Direct: direct})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, verify := range []bool{true, false} {
+			out, err := os.Create(filepath.Join(dir, "new.bin"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = core.ApplyDiffFileStream(old, bytes.NewReader(encoded), out, &core.ApplyOptions{VerifyResult: verify})
+			out.Close()
+			if err != nil {
+				t.Fatalf("ApplyDiffFileStream (direct=%v, verify=%v) failed: %v", direct, verify, err)
+			}
+			got, err := os.ReadFile(out.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, newData) {
+				t.Errorf("File result (direct=%v, verify=%v) mismatch: got %d bytes, expected %d",
+					direct, verify, len(got), len(newData))
+			}
+		}
+		old.Close()
+	}
+}
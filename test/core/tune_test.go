@@ -0,0 +1,52 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"bytes"
+	"testing"
+)
+
+// TestTuneParameters 测试密集的小修改上自动调参选择较小的块，且估算的补丁不大于默认参数
+func TestTuneParameters(t *testing.T) {
+	oldData := randomBytes(2<<20, 9)
+	newData := append([]byte{}, oldData...)
+	for i := 100; i < len(newData); i += 400 {
+		newData[i] ^= 0xff
+	}
+
+	cfg := config.DefaultConfig()
+	tuned, err := core.TuneParameters(oldData, newData, &core.DiffOptions{Config: cfg})
+	if err != nil {
+		t.Fatalf("TuneParameters failed: %v", err)
+	}
+	if tuned.BlockSize >= cfg.BlockSize || tuned.MinMatchLength > tuned.BlockSize {
+		t.Errorf("Expected a block size below %d, got %+v", cfg.BlockSize, tuned)
+	}
+	if tuned.MatchedRatio < 0.5 {
+		t.Errorf("Expected most sampled bytes to be matched, got %+v", tuned)
+	}
+
+	cfg.AutoTune = true
+	result, err := core.DiffFull(oldData, newData, &core.DiffOptions{Config: cfg})
+	if err != nil {
+		t.Fatalf("DiffFull failed: %v", err)
+	}
+	if cfg.BlockSize != config.DefaultConfig().BlockSize {
+		t.Errorf("DiffFull modified the caller's config: block size %d", cfg.BlockSize)
+	}
+	got, err := core.Apply(oldData, result.Patches, nil)
+	if err != nil || !bytes.Equal(got, newData) {
+		t.Fatalf("Auto-tuned patch does not reproduce new data: %v", err)
+	}
+
+	cfg.AutoTune = false
+	untuned, err := core.DiffFull(oldData, newData, &core.DiffOptions{Config: cfg})
+	if err != nil {
+		t.Fatalf("DiffFull failed: %v", err)
+	}
+	if len(core.EncodePatch(result.Patches)) > len(core.EncodePatch(untuned.Patches)) {
+		t.Errorf("Auto-tuned patch %d bytes, larger than default %d bytes",
+			len(core.EncodePatch(result.Patches)), len(core.EncodePatch(untuned.Patches)))
+	}
+}
@@ -0,0 +1,94 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/types"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// TestValidatePatch 测试补丁结构校验
+func TestValidatePatch(t *testing.T) {
+	oldData := []byte("Hello, World! This is a test.")
+	newData := []byte("Hello, Go! This is a longer test with more data.")
+
+	patches, err := core.DiffBytes(oldData, newData, nil)
+	if err != nil {
+		t.Fatalf("DiffBytes failed: %v", err)
+	}
+	if err := core.ValidatePatch(patches, int64(len(oldData)), int64(len(newData))); err != nil {
+		t.Fatalf("Valid patch rejected: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		patches []types.Patch
+		entry   bool
+	}{
+		{"wrong_new_size", []types.Patch{{Op: types.OP_INSERT, Offset: 0, Length: 1, Data: []byte("x")}}, false},
+		{"unordered", []types.Patch{
+			{Op: types.OP_COPY, Offset: 0, Length: 10},
+			{Op: types.OP_COPY, Offset: 5, Length: 1},
+		}, true},
+		{"copy_overrun", []types.Patch{{Op: types.OP_COPY, Offset: 20, Length: 100}}, true},
+		{"offset_overrun", []types.Patch{{Op: types.OP_INSERT, Offset: 1000, Length: 0}}, true},
+		{"data_length", []types.Patch{{Op: types.OP_REPLACE, Offset: 0, Length: 4, Data: []byte("ab")}}, true},
+		{"unknown_op", []types.Patch{{Op: types.Operator(99), Offset: 0, Length: 1}}, true},
+		{"output_overrun", []types.Patch{{Op: types.OP_INSERT, Offset: 0, Length: 60, Data: make([]byte, 60)}}, true},
+		{"negative_length", []types.Patch{{Op: types.OP_DELETE, Offset: 3, Length: -2}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := core.ValidatePatch(tt.patches, int64(len(oldData)), int64(len(newData)))
+			if err == nil {
+				t.Fatal("Expected validation error")
+			}
+			var patchErr *core.PatchError
+			var sizeErr *core.SizeError
+			if errors.As(err, &patchErr) != tt.entry || errors.As(err, &sizeErr) == tt.entry {
+				t.Errorf("Unexpected error type: %v", err)
+			}
+			if !errors.Is(err, core.ErrCorruptPatch) {
+				t.Errorf("Expected ErrCorruptPatch, got %v", err)
+			}
+
+			// 流式校验与一次校验的结果一致
+			streamErr := core.ValidatePatchStream(bytes.NewReader(core.EncodePatch(tt.patches)),
+				int64(len(oldData)), int64(len(newData)))
+			if tt.name == "data_length" {
+				// 编码后的数据长度总与 Length 一致，截断的条目为损坏错误
+				if !errors.Is(streamErr, core.ErrCorruptPatch) {
+					t.Errorf("ValidatePatchStream = %v, want ErrCorruptPatch", streamErr)
+				}
+			} else if streamErr == nil || streamErr.Error() != err.Error() {
+				t.Errorf("ValidatePatchStream = %v, ValidatePatch = %v", streamErr, err)
+			}
+		})
+	}
+}
+
+// TestApplyValidatesBeforeOutput 测试结构错误的补丁在产生任何输出之前被拒绝
+func TestApplyValidatesBeforeOutput(t *testing.T) {
+	oldData := bytes.Repeat([]byte("validate before apply "), 100)
+	newData := append([]byte("prefix "), oldData...)
+	df := newTestDiffFile(t, types.HASH_SHA256, oldData, newData)
+	// 记录的新文件大小与操作产生的长度不一致，应用后只能由结果哈希发现
+	df.NewSize++
+
+	var sizeErr *core.SizeError
+	if _, err := core.ApplyDiffFile(oldData, df, nil); !errors.As(err, &sizeErr) || sizeErr.Expected != int64(df.NewSize) {
+		t.Errorf("ApplyDiffFile = %v, want *SizeError", err)
+	}
+
+	var out bytes.Buffer
+	_, err := core.ApplyDiffFileStream(bytes.NewReader(oldData), bytes.NewReader(core.EncodeDiffFile(df)), &out,
+		&core.ApplyOptions{VerifyResult: true})
+	if !errors.As(err, &sizeErr) {
+		t.Errorf("ApplyDiffFileStream = %v, want *SizeError", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("ApplyDiffFileStream wrote %d bytes before rejecting the patch", out.Len())
+	}
+}
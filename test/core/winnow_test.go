@@ -0,0 +1,79 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"bytes"
+	"context"
+	"testing"
+)
+
+// randomBytes 生成确定的伪随机数据，模拟压缩等高熵内容
+func randomBytes(n int, seed uint32) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		seed = seed*1664525 + 1013904223
+		b[i] = byte(seed >> 24)
+	}
+	return b
+}
+
+// TestLocalAlignments 测试指纹对齐找出插入前后的两段局部对齐
+func TestLocalAlignments(t *testing.T) {
+	oldData := randomBytes(200000, 1)
+	newData := append(append(append([]byte{}, oldData[:80000]...), randomBytes(3000, 2)...), oldData[80000:]...)
+
+	aligns, err := core.LocalAlignments(context.Background(), oldData, newData)
+	if err != nil {
+		t.Fatalf("LocalAlignments failed: %v", err)
+	}
+	if len(aligns) != 2 {
+		t.Fatalf("Expected 2 local alignments, got %+v", aligns)
+	}
+	before, after := aligns[0], aligns[1]
+	if before.OldPos != before.NewPos || before.NewPos+before.Length > 80000 {
+		t.Errorf("Unexpected alignment before the insertion: %+v", before)
+	}
+	if after.OldPos-after.NewPos != -3000 || after.NewPos < 83000 {
+		t.Errorf("Unexpected alignment after the insertion: %+v", after)
+	}
+	for _, a := range aligns {
+		if !bytes.Equal(oldData[a.OldPos:a.OldPos+a.Length], newData[a.NewPos:a.NewPos+a.Length]) {
+			t.Errorf("Alignment %+v does not cover identical content", a)
+		}
+	}
+}
+
+// TestWinnowAlignment 测试通过配置选择指纹对齐
+func TestWinnowAlignment(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.AlignStrategy = config.AlignStrategyWinnow
+
+	oldData := randomBytes(100000, 3)
+	newData := append(randomBytes(700, 4), oldData...)
+	align, err := core.ComputeAlignment(context.Background(), oldData, newData, cfg)
+	if err != nil {
+		t.Fatalf("ComputeAlignment failed: %v", err)
+	}
+	if align.Offset != -700 || align.Confidence < core.MinAlignConfidence {
+		t.Errorf("Got %+v, expected offset -700 with high confidence", align)
+	}
+
+	result, err := core.DiffFull(oldData, newData, &core.DiffOptions{Config: cfg})
+	if err != nil {
+		t.Fatalf("DiffFull failed: %v", err)
+	}
+	if result.Offset != -700 {
+		t.Errorf("DiffFull offset %d, expected -700", result.Offset)
+	}
+
+	// 重复内容没有唯一的锚点，置信度为 0
+	periodic := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	align, err = core.ComputeAlignment(context.Background(), periodic, append([]byte("xyz"), periodic...), cfg)
+	if err != nil {
+		t.Fatalf("ComputeAlignment failed: %v", err)
+	}
+	if align.Confidence >= core.MinAlignConfidence {
+		t.Errorf("Periodic data: confidence %f should be below %f", align.Confidence, core.MinAlignConfidence)
+	}
+}
@@ -0,0 +1,98 @@
+package core_test
+
+import (
+	"bindiff/core"
+	"bindiff/types"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newImagePair 构造带大段零区的镜像数据
+func newImagePair() ([]byte, []byte) {
+	oldData := make([]byte, 256*1024)
+	for i := 0; i < 32*1024; i++ {
+		oldData[i] = byte(i % 253)
+	}
+	newData := append([]byte(nil), oldData...)
+	copy(newData[8*1024:], bytes.Repeat([]byte{0xAB}, 4096))
+	copy(newData[200*1024:], "changed block")
+	return oldData, newData
+}
+
+// TestApplyToWriterAtSparse 测试稀疏输出
+func TestApplyToWriterAtSparse(t *testing.T) {
+	oldData, newData := newImagePair()
+	patches, err := core.DiffBytes(oldData, newData, nil)
+	if err != nil {
+		t.Fatalf("DiffBytes failed: %v", err)
+	}
+
+	out, err := os.Create(filepath.Join(t.TempDir(), "out.img"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	it := core.NewPatchIterator(bytes.NewReader(core.EncodePatch(patches)))
+	size, err := core.ApplyToWriterAt(bytes.NewReader(oldData), it, out, &core.WriterAtOptions{Sparse: true})
+	if err != nil {
+		t.Fatalf("ApplyToWriterAt failed: %v", err)
+	}
+	if size != int64(len(newData)) {
+		t.Errorf("Expected output size %d, got %d", len(newData), size)
+	}
+
+	result, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result, newData) {
+		t.Error("Sparse output content mismatch")
+	}
+}
+
+// TestApplyToWriterAtInPlace 测试原地修补
+func TestApplyToWriterAtInPlace(t *testing.T) {
+	oldData, newData := newImagePair()
+	newData = newData[:240*1024] // 同时验证截断
+	patches, err := core.DiffBytes(oldData, newData, nil)
+	if err != nil {
+		t.Fatalf("DiffBytes failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "disk.img")
+	if err := os.WriteFile(path, oldData, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	it := core.NewPatchIterator(bytes.NewReader(core.EncodePatch(patches)))
+	if _, err := core.ApplyToWriterAt(f, it, f, &core.WriterAtOptions{InPlace: true, Sparse: true}); err != nil {
+		t.Fatalf("In-place apply failed: %v", err)
+	}
+
+	result, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result, newData) {
+		t.Error("In-place output content mismatch")
+	}
+
+	t.Run("insert_rejected", func(t *testing.T) {
+		insert := []types.Patch{{Op: types.OP_INSERT, Offset: 0, Length: 3, Data: []byte("abc")}}
+		it := core.NewPatchIterator(bytes.NewReader(core.EncodePatch(insert)))
+		_, err := core.ApplyToWriterAt(f, it, f, &core.WriterAtOptions{InPlace: true})
+		var patchErr *core.PatchError
+		if !errors.As(err, &patchErr) {
+			t.Errorf("Expected *core.PatchError for in-place insert, got %v", err)
+		}
+	})
+}
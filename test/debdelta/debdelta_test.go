@@ -0,0 +1,148 @@
+package debdelta_test
+
+import (
+	"archive/tar"
+	"bindiff/pkg/debdelta"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// buildDeb 按 dpkg-deb 的成员顺序构造 .deb，control 为 nil 时 control 成员使用不支持的压缩格式
+func buildDeb(t *testing.T, control map[string]string, files map[string][]byte) []byte {
+	t.Helper()
+	var ctrl bytes.Buffer
+	for _, k := range []string{"Package", "Version", "Architecture"} {
+		fmt.Fprintf(&ctrl, "%s: %s\n", k, control[k])
+	}
+	ctrl.WriteString("Description: test package\n multi-line description\n")
+
+	controlName, controlData := "control.tar.gz", tarGz(t, map[string][]byte{"./control": ctrl.Bytes()})
+	if control == nil {
+		controlName, controlData = "control.tar.xz", []byte("\xfd7zXZ\x00not really xz")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("!<arch>\n")
+	for _, m := range []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{controlName, controlData},
+		{"data.tar", tarOnly(t, files)},
+	} {
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", m.name, 1700000000, 0, 0, "100644", len(m.data))
+		buf.Write(m.data)
+		if len(m.data)%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+// tarOnly 按固定顺序写入 tar
+func tarOnly(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"./usr/bin/tool", "./usr/share/doc/tool/README", "./control"} {
+		data, ok := files[name]
+		if !ok {
+			continue
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(data)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// tarGz 写入 gzip 压缩的 tar
+func tarGz(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(tarOnly(t, files))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestCreateApply 生成增量包并应用到旧软件包
+func TestCreateApply(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	binary := make([]byte, 128*1024)
+	rng.Read(binary)
+	updated := append([]byte(nil), binary...)
+	copy(updated[70000:], "security fix")
+
+	oldDeb := buildDeb(t, map[string]string{"Package": "tool", "Version": "1:1.0-1", "Architecture": "amd64"},
+		map[string][]byte{"./usr/bin/tool": binary, "./usr/share/doc/tool/README": []byte("v1\n")})
+	newDeb := buildDeb(t, map[string]string{"Package": "tool", "Version": "1:1.0-2", "Architecture": "amd64"},
+		map[string][]byte{"./usr/bin/tool": updated, "./usr/share/doc/tool/README": []byte("v2\n")})
+
+	delta, info, err := debdelta.Create(oldDeb, newDeb, "old.deb", "new.deb", nil)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if info.Old.Version != "1:1.0-1" || info.New.Version != "1:1.0-2" || info.New.Size != int64(len(newDeb)) {
+		t.Errorf("Unexpected info %+v", info)
+	}
+	if want := "tool_1%3a1.0-1_1%3a1.0-2_amd64.debdelta"; info.Name() != want {
+		t.Errorf("Name = %s, want %s", info.Name(), want)
+	}
+	if len(delta) > len(newDeb)/10 {
+		t.Errorf("Delta is %d bytes for a %d byte package", len(delta), len(newDeb))
+	}
+	for _, member := range []string{"info/", "patch.sh/", "patch.bdf/", "NEW/MD5sum: ", "needs-old", "bdiff apply OLD.file PATCH/patch.bdf -o NEW.file"} {
+		if !bytes.Contains(delta, []byte(member)) {
+			t.Errorf("Delta lacks %q", member)
+		}
+	}
+
+	got, applied, err := debdelta.Apply(oldDeb, delta, nil)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !bytes.Equal(got, newDeb) {
+		t.Error("Reconstructed package differs")
+	}
+	if *applied != *info {
+		t.Errorf("Applied info %+v, created %+v", applied, info)
+	}
+
+	// 与 info 不符的旧软件包被拒绝
+	if _, _, err := debdelta.Apply(newDeb, delta, nil); !errors.Is(err, debdelta.ErrInvalidDelta) {
+		t.Errorf("Expected ErrInvalidDelta for the wrong old package, got %v", err)
+	}
+	if _, err := debdelta.Inspect(delta[:len(delta)/2]); !errors.Is(err, debdelta.ErrInvalidDelta) {
+		t.Errorf("Expected ErrInvalidDelta for a truncated delta, got %v", err)
+	}
+}
+
+// TestParsePackage 测试 control 不可读时从文件名推断软件包字段
+func TestParsePackage(t *testing.T) {
+	deb := buildDeb(t, nil, map[string][]byte{"./usr/bin/tool": []byte("x")})
+	p, err := debdelta.ParsePackage(deb, "/mirror/pool/t/tool_2%3a3.1-4_arm64.deb")
+	if err != nil {
+		t.Fatalf("ParsePackage failed: %v", err)
+	}
+	if p.Name != "tool" || p.Version != "2:3.1-4" || p.Architecture != "arm64" || p.Size != int64(len(deb)) {
+		t.Errorf("Unexpected package %+v", p)
+	}
+	if _, err := debdelta.ParsePackage(deb, "tool.deb"); !errors.Is(err, debdelta.ErrInvalidPackage) {
+		t.Errorf("Expected ErrInvalidPackage without usable fields, got %v", err)
+	}
+	if _, err := debdelta.ParsePackage([]byte("not a deb"), "x_1_all.deb"); !errors.Is(err, debdelta.ErrInvalidPackage) {
+		t.Errorf("Expected ErrInvalidPackage for non-ar input, got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package doctor_test
+
+import (
+	"bindiff/pkg/config"
+	"bindiff/pkg/doctor"
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestBuiltinChecksPass(t *testing.T) {
+	dir := t.TempDir()
+	report := doctor.Run(context.Background(), doctor.Checks(config.DefaultConfig(), dir))
+
+	want := []string{"patch-format", "apply", "fft", "config", "filesystem"}
+	if len(report.Results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(report.Results), len(want))
+	}
+	for i, res := range report.Results {
+		if res.Name != want[i] {
+			t.Errorf("result %d is %q, want %q", i, res.Name, want[i])
+		}
+		if res.Status == doctor.StatusFail {
+			t.Errorf("%s failed: %s", res.Name, res.Error)
+		}
+	}
+	if report.Failed() != 0 {
+		t.Errorf("Failed = %d", report.Failed())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("filesystem check left %d files behind", len(entries))
+	}
+	if report.Environment.GoVersion == "" || report.Environment.CPUs == 0 {
+		t.Errorf("environment not detected: %+v", report.Environment)
+	}
+}
+
+func TestInvalidConfigFails(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.BlockSize = -1
+	report := doctor.Run(context.Background(), doctor.Checks(cfg, t.TempDir()))
+	for _, res := range report.Results {
+		if res.Name == "config" && res.Status != doctor.StatusFail {
+			t.Errorf("config check = %s, want fail", res.Status)
+		}
+	}
+}
+
+func TestRunStatuses(t *testing.T) {
+	checks := []doctor.Check{
+		{Name: "ok", Run: func(ctx context.Context) (string, error) { return "fine", nil }},
+		{Name: "warn", Run: func(ctx context.Context) (string, error) {
+			return "mostly fine", &doctor.Warning{Msg: "careful"}
+		}},
+		{Name: "fail", Run: func(ctx context.Context) (string, error) { return "", errors.New("broken") }},
+		{Name: "panic", Run: func(ctx context.Context) (string, error) { panic("boom") }},
+	}
+	report := doctor.Run(context.Background(), checks)
+
+	want := []doctor.Status{doctor.StatusPass, doctor.StatusWarn, doctor.StatusFail, doctor.StatusFail}
+	for i, res := range report.Results {
+		if res.Status != want[i] {
+			t.Errorf("%s: status %s, want %s", res.Name, res.Status, want[i])
+		}
+	}
+	if report.Results[1].Detail != "mostly fine" || report.Results[1].Error != "careful" {
+		t.Errorf("warning result = %+v", report.Results[1])
+	}
+	if report.Failed() != 2 {
+		t.Errorf("Failed = %d, want 2", report.Failed())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if report := doctor.Run(ctx, checks[:1]); report.Results[0].Status != doctor.StatusFail {
+		t.Errorf("check ran after cancellation: %+v", report.Results[0])
+	}
+}
@@ -0,0 +1,137 @@
+package gitdelta_test
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/gitdelta"
+	"bindiff/types"
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildPatch 用 PatchBuilder 构造覆盖所有操作的 RAW 补丁
+func buildPatch(t *testing.T, oldData []byte) (types.DiffFile, []byte) {
+	t.Helper()
+	b := core.NewPatchBuilder(oldData)
+	steps := []error{
+		b.AppendCopy(0, 1000),
+		b.AppendInsert(1000, bytes.Repeat([]byte("I"), 300)), // 超过单条插入指令的 127 字节
+		b.AppendReplace(1000, []byte("REPLACED")),
+		b.AppendDelete(2000, 500), // 1008-2000 隐式复制
+		b.AppendCopy(2500, 70000), // 超过 0x10000
+	}
+	for _, err := range steps {
+		if err != nil {
+			t.Fatalf("PatchBuilder failed: %v", err)
+		}
+	}
+	df, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	newData, err := core.ApplyDiffFile(oldData, df, nil)
+	if err != nil {
+		t.Fatalf("ApplyDiffFile failed: %v", err)
+	}
+	return df, newData
+}
+
+func oldData() []byte {
+	data := make([]byte, 100_000)
+	for i := range data {
+		data[i] = byte(i * 7 / 3)
+	}
+	return data
+}
+
+// TestFromDiffFile 测试 RAW 补丁转换为 git 增量后结果一致
+func TestFromDiffFile(t *testing.T) {
+	old := oldData()
+	df, newData := buildPatch(t, old)
+
+	delta, err := gitdelta.FromDiffFile(old, df, nil)
+	if err != nil {
+		t.Fatalf("FromDiffFile failed: %v", err)
+	}
+	got, err := gitdelta.Apply(old, delta)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatal("Git delta result mismatch")
+	}
+	if len(delta) > 1000 {
+		t.Errorf("Delta should consist of a few copies and inserts, got %d bytes", len(delta))
+	}
+
+	// 旧文件与补丁不匹配
+	if _, err := gitdelta.FromDiffFile(old[1:], df, nil); !errors.Is(err, core.ErrHashMismatch) {
+		t.Errorf("Expected ErrHashMismatch, got %v", err)
+	}
+}
+
+// TestApplyRejectsMalformed 测试损坏的增量被拒绝
+func TestApplyRejectsMalformed(t *testing.T) {
+	base := []byte("0123456789")
+	cases := map[string][]byte{
+		"wrong base size": {5, 3, 0x03, 'a', 'b', 'c'},
+		"reserved opcode": {10, 3, 0x00},
+		"copy past base":  {10, 4, 0x91, 8, 4},
+		"short insert":    {10, 3, 0x05, 'a'},
+		"size mismatch":   {10, 9, 0x03, 'a', 'b', 'c'},
+		"truncated copy":  {10, 4, 0x91},
+	}
+	for name, delta := range cases {
+		if _, err := gitdelta.Apply(base, delta); !errors.Is(err, gitdelta.ErrInvalidDelta) {
+			t.Errorf("%s: expected ErrInvalidDelta, got %v", name, err)
+		}
+	}
+	got, err := gitdelta.Apply(base, []byte{10, 7, 0x91, 2, 4, 0x03, 'a', 'b', 'c'})
+	if err != nil || string(got) != "2345abc" {
+		t.Errorf("Expected 2345abc, got %q (%v)", got, err)
+	}
+}
+
+// TestPackWithGit 测试生成的打包文件可被 git 读取
+func TestPackWithGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	old := oldData()
+	df, newData := buildPatch(t, old)
+	delta, err := gitdelta.FromDiffFile(old, df, nil)
+	if err != nil {
+		t.Fatalf("FromDiffFile failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	run := func(stdin []byte, args ...string) []byte {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Stdin = bytes.NewReader(stdin)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git %s failed: %v", strings.Join(args, " "), err)
+		}
+		return out
+	}
+	run(nil, "init", "-q")
+	var pack bytes.Buffer
+	if err := gitdelta.WritePack(&pack, old, delta); err != nil {
+		t.Fatalf("WritePack failed: %v", err)
+	}
+	packPath := filepath.Join(dir, ".git", "objects", "pack", "pack-test.pack")
+	if err := os.WriteFile(packPath, pack.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run(nil, "index-pack", packPath)
+
+	id := strings.TrimSpace(string(run(newData, "hash-object", "--stdin")))
+	if got := run(nil, "cat-file", "blob", id); !bytes.Equal(got, newData) {
+		t.Fatal("git returned different content for the delta object")
+	}
+}
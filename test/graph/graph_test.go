@@ -0,0 +1,175 @@
+package graph_test
+
+import (
+	"bindiff/pkg/graph"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hash 返回以 c 填充的测试哈希
+func hash(c string) string {
+	return strings.Repeat(c, 64)
+}
+
+// sample 版本 1.0 -> 1.1 -> 1.2 -> 2.0，另有 1.0 -> 2.0 的大补丁
+func sample(t *testing.T) *graph.Graph {
+	t.Helper()
+	g := &graph.Graph{}
+	for i, name := range []string{"1.0", "1.1", "1.2", "2.0"} {
+		if err := g.AddVersion(graph.Version{Name: name, SHA256: hash(string(rune('a' + i))), Size: 1000, URL: "full/" + name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []graph.Patch{
+		{From: "1.0", To: "1.1", Size: 100},
+		{From: "1.1", To: "1.2", Size: 100},
+		{From: "1.2", To: "2.0", Size: 150},
+		{From: "1.0", To: "2.0", Size: 400},
+		{From: "1.1", To: "2.0", Size: 900},
+	} {
+		if err := g.AddPatch(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return g
+}
+
+// TestPlan 测试最短补丁链与整包下载的选择
+func TestPlan(t *testing.T) {
+	g := sample(t)
+
+	plan, err := g.Plan(hash("a"), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Full || plan.From != "1.0" || plan.Target.Name != "2.0" || plan.Size != 350 || len(plan.Steps) != 3 {
+		t.Errorf("Expected the 3-step chain of 350 bytes: %+v", plan)
+	}
+
+	// 每步额外代价使直接补丁更便宜
+	plan, _ = g.Plan(hash("a"), "2.0", &graph.PlanOptions{StepCost: 100})
+	if len(plan.Steps) != 1 || plan.Size != 400 {
+		t.Errorf("Expected the direct patch with a step cost: %+v", plan)
+	}
+
+	plan, _ = g.Plan(hash("b"), "1.2", nil)
+	if len(plan.Steps) != 1 || plan.Steps[0].From != "1.1" {
+		t.Errorf("Expected 1.1 -> 1.2: %+v", plan)
+	}
+
+	// 未知的当前版本与没有补丁的方向只能整包下载
+	for _, from := range []string{hash("f"), hash("d")} {
+		plan, err = g.Plan(from, "1.0", nil)
+		if err != nil || !plan.Full || plan.Size != 1000 {
+			t.Errorf("Expected a full download from %s: %+v %v", from[:1], plan, err)
+		}
+	}
+
+	plan, _ = g.Plan(strings.ToUpper(hash("d")), "latest", nil)
+	if plan.Full || len(plan.Steps) != 0 || plan.Size != 0 {
+		t.Errorf("Expected an empty plan at the target: %+v", plan)
+	}
+
+	if _, err := g.Plan(hash("a"), "9.9", nil); !errors.Is(err, graph.ErrUnknownVersion) {
+		t.Errorf("Expected ErrUnknownVersion, got %v", err)
+	}
+}
+
+// TestPlanFullCheaper 测试补丁链比整包更大时选择整包下载
+func TestPlanFullCheaper(t *testing.T) {
+	g := sample(t)
+	g.Versions[3].Size = 300
+	plan, err := g.Plan(hash("a"), "2.0", nil)
+	if err != nil || !plan.Full || plan.Size != 300 {
+		t.Errorf("Expected a full download: %+v %v", plan, err)
+	}
+
+	g.Versions[3].URL = ""
+	plan, err = g.Plan(hash("a"), "2.0", nil)
+	if err != nil || plan.Full {
+		t.Errorf("Expected the patch chain without a full download URL: %+v %v", plan, err)
+	}
+	if _, err := g.Plan(hash("f"), "2.0", nil); err == nil {
+		t.Error("Expected an error without any way to reach the target")
+	}
+}
+
+// TestValidate 测试版本图的校验
+func TestValidate(t *testing.T) {
+	g := sample(t)
+	if err := g.AddVersion(graph.Version{Name: "3.0", SHA256: hash("a")}); err == nil {
+		t.Error("Expected duplicate hash to be rejected")
+	}
+	if err := sample(t).AddPatch(graph.Patch{From: "1.0", To: "9.9"}); err == nil {
+		t.Error("Expected patch to an unknown version to be rejected")
+	}
+
+	var buf bytes.Buffer
+	if err := sample(t).Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := graph.Read(&buf)
+	if err != nil || len(loaded.Versions) != 4 || len(loaded.Patches) != 5 {
+		t.Fatalf("Round trip failed: %v", err)
+	}
+	if _, err := graph.Read(strings.NewReader(`{"versions":[{"name":"x","sha256":"00"}]}`)); err == nil {
+		t.Error("Expected bad hash to be rejected")
+	}
+}
+
+// TestHandler 测试 REST 查询与文件修改后的重新加载
+func TestHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "versions.json")
+	var buf bytes.Buffer
+	sample(t).Save(&buf)
+	os.WriteFile(path, buf.Bytes(), 0644)
+
+	srv := httptest.NewServer(&graph.Handler{Path: path})
+	defer srv.Close()
+
+	get := func(query string, want int) *graph.Plan {
+		t.Helper()
+		resp, err := http.Get(srv.URL + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("GET %s = %d, want %d", query, resp.StatusCode, want)
+		}
+		var plan graph.Plan
+		json.NewDecoder(resp.Body).Decode(&plan)
+		return &plan
+	}
+
+	if plan := get("/v1/plan?from="+hash("a"), http.StatusOK); plan.Size != 350 {
+		t.Errorf("Plan = %+v", plan)
+	}
+	if plan := get("/v1/plan?from="+hash("a")+"&step_cost=100", http.StatusOK); len(plan.Steps) != 1 {
+		t.Errorf("Plan with step cost = %+v", plan)
+	}
+	get("/v1/plan?to=9.9", http.StatusNotFound)
+	get("/v1/plan?step_cost=x", http.StatusBadRequest)
+	get("/v1/versions", http.StatusOK)
+	get("/v1/other", http.StatusNotFound)
+
+	// 发布新版本后无需重启
+	g := sample(t)
+	g.AddVersion(graph.Version{Name: "2.1", SHA256: hash("e"), Size: 10, URL: "full/2.1"})
+	buf.Reset()
+	g.Save(&buf)
+	os.WriteFile(path, buf.Bytes(), 0644)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+	if plan := get("/v1/plan?from="+hash("a"), http.StatusOK); plan.Target.Name != "2.1" {
+		t.Errorf("Expected the reloaded graph, got %+v", plan)
+	}
+}
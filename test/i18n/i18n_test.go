@@ -0,0 +1,99 @@
+package i18n_test
+
+import (
+	"bindiff/pkg/i18n"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// verbPattern 匹配格式动词，第 1 组为动词字母
+var verbPattern = regexp.MustCompile(`%(?:\[\d+\])?[-+# 0]*\d*(?:\.\d+)?([a-zA-Z%])`)
+
+// verbs 返回格式串中的动词字母（已排序）
+func verbs(format string) string {
+	var letters []string
+	for _, m := range verbPattern.FindAllStringSubmatch(format, -1) {
+		if m[1] != "%" {
+			letters = append(letters, m[1])
+		}
+	}
+	sort.Strings(letters)
+	return strings.Join(letters, "")
+}
+
+func TestSetLanguage(t *testing.T) {
+	defer i18n.SetLanguage(i18n.English)
+
+	cases := map[string]string{
+		"zh":          i18n.Chinese,
+		"zh_CN.UTF-8": i18n.Chinese,
+		"zh-Hans":     i18n.Chinese,
+		"EN":          i18n.English,
+		"en_US.UTF-8": i18n.English,
+		"C":           i18n.English,
+	}
+	for in, want := range cases {
+		if err := i18n.SetLanguage(in); err != nil {
+			t.Errorf("SetLanguage(%q): %v", in, err)
+			continue
+		}
+		if got := i18n.Language(); got != want {
+			t.Errorf("SetLanguage(%q) selected %q, want %q", in, got, want)
+		}
+	}
+	if err := i18n.SetLanguage("fr"); err == nil {
+		t.Error("SetLanguage(fr) succeeded")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "")
+	t.Setenv("LANG", "zh_CN.UTF-8")
+	if got := i18n.Detect(); got != i18n.Chinese {
+		t.Errorf("LANG=zh_CN.UTF-8: Detect = %q", got)
+	}
+
+	// LC_ALL 优先于 LANG
+	t.Setenv("LC_ALL", "en_US.UTF-8")
+	if got := i18n.Detect(); got != i18n.English {
+		t.Errorf("LC_ALL=en_US.UTF-8: Detect = %q", got)
+	}
+
+	// 不支持的语言回退到英文，而不是继续查找 LANG
+	t.Setenv("LC_ALL", "fr_FR.UTF-8")
+	if got := i18n.Detect(); got != i18n.English {
+		t.Errorf("LC_ALL=fr_FR.UTF-8: Detect = %q", got)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	defer i18n.SetLanguage(i18n.English)
+
+	msg := "✓ Restored %s from %s\n"
+	if got := i18n.T(msg); got != msg {
+		t.Errorf("English T = %q", got)
+	}
+	i18n.SetLanguage(i18n.Chinese)
+	if got := i18n.Sprintf(msg, "a.bin", "a.bin.backup"); got != "✓ 已从 a.bin.backup 恢复 a.bin\n" {
+		t.Errorf("Chinese Sprintf = %q", got)
+	}
+	if got := i18n.T("a message without a translation"); got != "a message without a translation" {
+		t.Errorf("missing translation = %q", got)
+	}
+}
+
+func TestCatalogKeepsVerbs(t *testing.T) {
+	for _, lang := range i18n.Languages {
+		for msg, translated := range i18n.Catalog(lang) {
+			if verbs(msg) != verbs(translated) {
+				t.Errorf("%s: %q translates to %q with different format verbs", lang, msg, translated)
+			}
+			if strings.HasSuffix(msg, "\n") != strings.HasSuffix(translated, "\n") {
+				t.Errorf("%s: %q and its translation end differently", lang, msg)
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package ignore_test
+
+import (
+	"bindiff/pkg/ignore"
+	"io/fs"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+// TestMatcher 测试 gitignore 语法的匹配规则
+func TestMatcher(t *testing.T) {
+	m, err := ignore.New(
+		"# 注释",
+		"",
+		"*.log",
+		"build/",
+		"/cache",
+		"docs/**/*.tmp",
+		"node_modules/**",
+		"!important.log",
+		`\#literal`,
+	)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"app.log", false, true},
+		{"logs/deep/app.log", false, true},
+		{"important.log", false, false},
+		{"sub/important.log", false, false},
+		{"build", true, true},
+		{"build", false, false}, // 只匹配目录
+		{"src/build/out.o", false, true},
+		{"cache", true, true},
+		{"src/cache", true, false}, // 以 / 开头的模式相对根目录
+		{"docs/a/b/x.tmp", false, true},
+		{"docs/x.tmp", false, true},
+		{"other/x.tmp", false, false},
+		{"node_modules/pkg/index.js", false, true},
+		{"#literal", false, true},
+		{"main.go", false, false},
+	}
+	for _, tt := range tests {
+		if got := m.Ignored(tt.path, tt.isDir); got != tt.ignored {
+			t.Errorf("Ignored(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.ignored)
+		}
+	}
+
+	// 被忽略目录中的文件不能被 ! 规则重新包含
+	m.Add("!build/keep.txt")
+	if !m.Ignored("build/keep.txt", false) {
+		t.Error("Files inside an ignored directory should stay ignored")
+	}
+
+	if _, err := ignore.New("[z-a"); err == nil {
+		t.Error("Expected error for malformed pattern")
+	}
+}
+
+// TestFilter 测试从 .bindiffignore 加载规则并过滤文件系统
+func TestFilter(t *testing.T) {
+	fsys := fstest.MapFS{
+		".bindiffignore":     {Data: []byte("*.log\ntmp/\n")},
+		"main.go":            {Data: []byte("package main")},
+		"server.log":         {Data: []byte("log")},
+		"tmp/cache.bin":      {Data: []byte("cache")},
+		"assets/logo.png":    {Data: []byte("png")},
+		"assets/tmp/old.png": {Data: []byte("png")},
+		"vendor/lib.go":      {Data: []byte("package lib")},
+	}
+	m, err := ignore.Load(fsys, "vendor/")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	view := ignore.Filter(fsys, m)
+
+	var files []string
+	err = fs.WalkDir(view, ".", func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, p)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WalkDir failed: %v", err)
+	}
+	sort.Strings(files)
+	want := []string{".bindiffignore", "assets/logo.png", "main.go"}
+	if len(files) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, files)
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want, files)
+			break
+		}
+	}
+
+	if _, err := fs.ReadFile(view, "tmp/cache.bin"); err == nil {
+		t.Error("Ignored file should not be readable through the filter")
+	}
+	if _, err := fs.Stat(view, "server.log"); err == nil {
+		t.Error("Ignored file should not be visible through the filter")
+	}
+}
@@ -0,0 +1,404 @@
+package jobs_test
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"bindiff/pkg/jobs"
+	"bindiff/pkg/logger"
+	"bindiff/pkg/metrics"
+	"bindiff/pkg/storage"
+	"bindiff/types"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// submit 以 multipart 表单提交任务
+func submit(t *testing.T, url, token string, files map[string][]byte) (*http.Response, jobs.Job) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, data := range files {
+		w, _ := mw.CreateFormFile(name, name)
+		w.Write(data)
+	}
+	mw.Close()
+	req, _ := http.NewRequest(http.MethodPost, url, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var job jobs.Job
+	json.NewDecoder(resp.Body).Decode(&job)
+	return resp, job
+}
+
+// get 发送带令牌的 GET 请求
+func get(t *testing.T, url string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	return resp
+}
+
+// wait 轮询直到任务结束
+func wait(t *testing.T, q *jobs.Queue, id string) jobs.Job {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := q.Get(id)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if job.Status == jobs.StatusSucceeded || job.Status == jobs.StatusFailed {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not finish", id)
+	return jobs.Job{}
+}
+
+// TestRESTWorkflow 测试提交、轮询、下载与删除任务
+func TestRESTWorkflow(t *testing.T) {
+	m := metrics.New(nil)
+	q, err := jobs.Open(t.TempDir(), jobs.Options{Workers: 2, Metrics: m})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer q.Close()
+	srv := httptest.NewServer(&jobs.Handler{Queue: q, Token: "secret", MaxInputSize: 1 << 20})
+	defer srv.Close()
+
+	oldData := bytes.Repeat([]byte("the quick brown fox "), 500)
+	newData := append(append([]byte{}, oldData[:4000]...), []byte("jumps over the lazy dog")...)
+	newData = append(newData, oldData[4000:]...)
+
+	if resp, _ := submit(t, srv.URL+"/v1/jobs/diff", "wrong", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", resp.StatusCode)
+	}
+	if resp, _ := submit(t, srv.URL+"/v1/jobs/diff", "secret", map[string][]byte{"old": oldData}); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for missing input, got %d", resp.StatusCode)
+	}
+
+	resp, job := submit(t, srv.URL+"/v1/jobs/diff", "secret", map[string][]byte{"old": oldData, "new": newData})
+	if resp.StatusCode != http.StatusAccepted || job.ID == "" {
+		t.Fatalf("Expected 202 with job, got %d", resp.StatusCode)
+	}
+	if done := wait(t, q, job.ID); done.Status != jobs.StatusSucceeded {
+		t.Fatalf("Diff job failed: %s", done.Error)
+	}
+
+	resp = get(t, srv.URL+"/v1/jobs/"+job.ID+"/result")
+	patch, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for result, got %d", resp.StatusCode)
+	}
+
+	// 用生成的补丁提交应用任务
+	_, job2 := submit(t, srv.URL+"/v1/jobs/apply", "secret", map[string][]byte{"old": oldData, "patch": patch})
+	if done := wait(t, q, job2.ID); done.Status != jobs.StatusSucceeded {
+		t.Fatalf("Apply job failed: %s", done.Error)
+	}
+	resp = get(t, srv.URL+"/v1/jobs/"+job2.ID+"/result")
+	got, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(got, newData) {
+		t.Fatal("Apply result mismatch")
+	}
+
+	// 补丁与旧文件不匹配时任务失败
+	_, job3 := submit(t, srv.URL+"/v1/jobs/apply", "secret", map[string][]byte{"old": []byte("other"), "patch": patch})
+	if done := wait(t, q, job3.ID); done.Status != jobs.StatusFailed || done.Error == "" {
+		t.Errorf("Expected failed job, got %+v", done)
+	}
+	if resp := get(t, srv.URL+"/v1/jobs/"+job3.ID+"/result"); resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected 409 for failed job result, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/v1/jobs/"+job.ID, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204 for delete, got %v %v", resp, err)
+	}
+	if resp := get(t, srv.URL+"/v1/jobs/"+job.ID); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 after delete, got %d", resp.StatusCode)
+	}
+	if n := len(q.List()); n != 2 {
+		t.Errorf("Expected 2 jobs, got %d", n)
+	}
+
+	var out bytes.Buffer
+	m.Registry.WriteTo(&out)
+	for _, want := range []string{
+		`bindiff_operations_total{op="diff",result="success"} 1`,
+		`bindiff_operations_total{op="apply",result="success"} 1`,
+		`bindiff_operations_total{op="apply",result="error"} 1`,
+		`bindiff_apply_failures_total 1`,
+		`bindiff_patch_size_bytes_count 1`,
+	} {
+		if !bytes.Contains(out.Bytes(), []byte(want)) {
+			t.Errorf("Metrics missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+// TestResume 测试重启后继续执行未完成的任务并保留已完成的任务
+func TestResume(t *testing.T) {
+	dir := t.TempDir()
+	q, err := jobs.Open(dir, jobs.Options{})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	upload, err := q.NewUpload(jobs.KindDiff)
+	if err != nil {
+		t.Fatalf("NewUpload failed: %v", err)
+	}
+	upload.Add("old", bytes.NewReader([]byte("hello world")), 0)
+	upload.Add("new", bytes.NewReader([]byte("hello there world")), 0)
+	done, err := upload.Submit()
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	wait(t, q, done.ID)
+	q.Close()
+
+	// 模拟上次退出时正在运行的任务与未完成的上传
+	interrupted := "0123456789abcdef0123456789abcdef"
+	os.Mkdir(filepath.Join(dir, interrupted), 0755)
+	os.WriteFile(filepath.Join(dir, interrupted, "old"), []byte("aaaa"), 0644)
+	os.WriteFile(filepath.Join(dir, interrupted, "new"), []byte("aaab"), 0644)
+	os.WriteFile(filepath.Join(dir, interrupted, "job.json"),
+		[]byte(`{"id":"`+interrupted+`","kind":"diff","status":"running","created":"2026-01-01T00:00:00Z"}`), 0644)
+	os.Mkdir(filepath.Join(dir, "stale-upload"), 0755)
+
+	q, err = jobs.Open(dir, jobs.Options{})
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer q.Close()
+	if job := wait(t, q, interrupted); job.Status != jobs.StatusSucceeded {
+		t.Fatalf("Resumed job failed: %s", job.Error)
+	}
+	path, err := q.ResultPath(done.ID)
+	if err != nil {
+		t.Fatalf("Finished job lost after restart: %v", err)
+	}
+	patch, _ := os.ReadFile(path)
+	df, err := core.DecodeDiffFile(patch)
+	if err != nil || df.NewSize != uint32(len("hello there world")) {
+		t.Errorf("Unexpected result after restart: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "stale-upload")); !os.IsNotExist(err) {
+		t.Error("Stale upload directory should be removed")
+	}
+}
+
+// TestOperationID 测试调用方提供的操作 ID 出现在响应、任务与日志中，没有提供时生成
+func TestOperationID(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	q, err := jobs.Open(t.TempDir(), jobs.Options{Logger: logger.FromZap(zap.New(core))})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer q.Close()
+	srv := httptest.NewServer(&jobs.Handler{Queue: q})
+	defer srv.Close()
+
+	post := func(opID string) (*http.Response, jobs.Job) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for _, name := range []string{"old", "new"} {
+			w, _ := mw.CreateFormFile(name, name)
+			w.Write(bytes.Repeat([]byte(name), 100))
+		}
+		mw.Close()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/v1/jobs/diff", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		if opID != "" {
+			req.Header.Set(logger.OperationIDHeader, opID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var job jobs.Job
+		json.NewDecoder(resp.Body).Decode(&job)
+		return resp, job
+	}
+
+	resp, job := post("release-42.step-3")
+	if job.OperationID != "release-42.step-3" || resp.Header.Get(logger.OperationIDHeader) != job.OperationID {
+		t.Errorf("operation ID not echoed: header %q, job %q", resp.Header.Get(logger.OperationIDHeader), job.OperationID)
+	}
+	wait(t, q, job.ID)
+	if resp := get(t, srv.URL+"/v1/jobs/"+job.ID); resp.Header.Get(logger.OperationIDHeader) != job.OperationID {
+		t.Errorf("GET did not return the operation ID")
+	}
+	found := false
+	for _, e := range logs.All() {
+		found = found || e.ContextMap()[logger.OperationIDField] == job.OperationID
+	}
+	if !found {
+		t.Errorf("no log line carries op_id %s", job.OperationID)
+	}
+
+	// 无效的 ID 被替换为生成的 ID
+	resp, job = post("not valid!")
+	if job.OperationID == "" || job.OperationID == "not valid!" || resp.Header.Get(logger.OperationIDHeader) != job.OperationID {
+		t.Errorf("expected a generated operation ID, got %q", job.OperationID)
+	}
+	wait(t, q, job.ID)
+}
+
+// TestDiffHashAlgorithm 测试差分任务按配置项 hash_algorithm 计算补丁的校验哈希
+func TestDiffHashAlgorithm(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.HashAlgorithm = "xxhash"
+	q, err := jobs.Open(t.TempDir(), jobs.Options{Config: cfg})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer q.Close()
+
+	oldData := bytes.Repeat([]byte("configured hash "), 100)
+	newData := append([]byte("prefix "), oldData...)
+	upload, err := q.NewUpload(jobs.KindDiff)
+	if err != nil {
+		t.Fatalf("NewUpload failed: %v", err)
+	}
+	upload.Add("old", bytes.NewReader(oldData), 0)
+	upload.Add("new", bytes.NewReader(newData), 0)
+	job, err := upload.Submit()
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if done := wait(t, q, job.ID); done.Status != jobs.StatusSucceeded {
+		t.Fatalf("Diff job failed: %s", done.Error)
+	}
+	result, err := q.Result(context.Background(), job.ID)
+	if err != nil {
+		t.Fatalf("Result failed: %v", err)
+	}
+	defer result.Close()
+	patch, _ := io.ReadAll(result)
+	df, err := core.DecodeDiffFile(patch)
+	if err != nil {
+		t.Fatalf("DecodeDiffFile failed: %v", err)
+	}
+	if df.HashAlgorithm != types.HASH_XXHASH64 {
+		t.Errorf("HashAlgorithm = %d, want XXHASH64", df.HashAlgorithm)
+	}
+}
+
+// TestResultCommittedWithState 测试结果文件与任务状态在同一事务中提交，完成后不留下事务文件
+func TestResultCommittedWithState(t *testing.T) {
+	dir := t.TempDir()
+	q, err := jobs.Open(dir, jobs.Options{})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer q.Close()
+
+	upload, err := q.NewUpload(jobs.KindDiff)
+	if err != nil {
+		t.Fatalf("NewUpload failed: %v", err)
+	}
+	upload.Add("old", strings.NewReader("old content"), 0)
+	upload.Add("new", strings.NewReader("new content"), 0)
+	job, err := upload.Submit()
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	done := wait(t, q, job.ID)
+	if done.Status != jobs.StatusSucceeded {
+		t.Fatalf("Diff job failed: %s", done.Error)
+	}
+	path, err := q.ResultPath(job.ID)
+	if err != nil {
+		t.Fatalf("ResultPath failed: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != done.ResultSize {
+		t.Errorf("Result file missing or size differs: %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, job.ID))
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".txn-") {
+			t.Errorf("Transaction file left behind: %s", e.Name())
+		}
+	}
+}
+
+// TestSaveFailure 测试任务状态无法写入磁盘时记录错误并把任务标记为失败，而不是静默丢失状态
+func TestSaveFailure(t *testing.T) {
+	dir := t.TempDir()
+	core, logs := observer.New(zap.InfoLevel)
+	// 结果写入存储后端，只有任务状态写不进任务目录
+	q, err := jobs.Open(dir, jobs.Options{Logger: logger.FromZap(zap.New(core)), Storage: storage.NewFS(t.TempDir())})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer q.Close()
+
+	oldData := make([]byte, 16<<20)
+	rand.New(rand.NewSource(1)).Read(oldData)
+	newData := append([]byte("prefix"), oldData...)
+	upload, err := q.NewUpload(jobs.KindDiff)
+	if err != nil {
+		t.Fatalf("NewUpload failed: %v", err)
+	}
+	upload.Add("old", bytes.NewReader(oldData), 0)
+	upload.Add("new", bytes.NewReader(newData), 0)
+	job, err := upload.Submit()
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	// 等到输入读取完毕、差分开始报告进度
+	for {
+		current, _ := q.Get(job.ID)
+		if current.Status != jobs.StatusQueued && (current.Status != jobs.StatusRunning || current.Progress != nil) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// 把任务目录换成同名文件，任务结束时无法写入 job.json
+	jobDir := filepath.Join(dir, job.ID)
+	if err := os.RemoveAll(jobDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(jobDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if current, _ := q.Get(job.ID); current.Status != jobs.StatusRunning {
+		t.Skip("job finished before its state file could be blocked")
+	}
+	finished := wait(t, q, job.ID)
+	if logs.FilterMessageSnippet("Failed to save job").Len() == 0 {
+		t.Error("save failure was not logged")
+	}
+	if finished.Status != jobs.StatusFailed || !strings.Contains(finished.Error, "failed to save job state") {
+		t.Errorf("Expected the job to fail on save, got %s (%s)", finished.Status, finished.Error)
+	}
+}
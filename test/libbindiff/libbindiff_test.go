@@ -0,0 +1,50 @@
+package libbindiff_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestCABI 以 c-shared 模式构建 libbindiff，编译 testdata/abi.c 并运行，
+// 经由 C ABI 检查差分、应用、校验与错误码
+func TestCABI(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping c-shared build in short mode")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("c-shared test is not supported on Windows")
+	}
+	if out, err := exec.Command("go", "env", "CGO_ENABLED").Output(); err != nil || strings.TrimSpace(string(out)) != "1" {
+		t.Skip("cgo is disabled")
+	}
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("C compiler not installed")
+	}
+
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "libbindiff.so")
+	if runtime.GOOS == "darwin" {
+		lib = filepath.Join(dir, "libbindiff.dylib")
+	}
+	run := func(name string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command(name, args...)
+		cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir, "DYLD_LIBRARY_PATH="+dir)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s failed: %v\n%s", filepath.Base(name), err, out)
+		}
+		return string(out)
+	}
+	run("go", "build", "-buildmode=c-shared", "-o", lib, "bindiff/cmd/libbindiff")
+	prog := filepath.Join(dir, "abi")
+	run(cc, "-o", prog, filepath.Join("testdata", "abi.c"), "-I"+dir, "-L"+dir, "-lbindiff")
+	if out := run(prog); strings.TrimSpace(out) != "ok" {
+		t.Errorf("Unexpected output: %s", out)
+	}
+}
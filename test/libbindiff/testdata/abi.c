@@ -0,0 +1,83 @@
+/*
+ * 通过 C ABI 调用 libbindiff 导出函数的测试程序，由 libbindiff_test.go 编译运行。
+ * 全部检查通过时输出 ok 并返回 0，否则输出失败的检查并返回 1
+ */
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#include "libbindiff.h"
+
+static int failures = 0;
+
+#define CHECK(cond, ...)                     \
+	do {                                     \
+		if (!(cond)) {                       \
+			fprintf(stderr, __VA_ARGS__);    \
+			fputc('\n', stderr);             \
+			failures++;                      \
+		}                                    \
+	} while (0)
+
+int main(void) {
+	size_t old_len = 64 * 1024, new_len = old_len + 16;
+	unsigned char *old_data = malloc(old_len), *new_data = malloc(new_len);
+	for (size_t i = 0; i < old_len; i++) {
+		old_data[i] = (unsigned char)(i * 31 / 7);
+	}
+	memcpy(new_data, old_data, 1000);
+	memcpy(new_data + 1000, "sixteen bytes!!!", 16);
+	memcpy(new_data + 1016, old_data + 1000, old_len - 1000);
+
+	char *version = bindiff_version();
+	CHECK(version != NULL && version[0] != '\0', "bindiff_version returned an empty string");
+
+	void *patch = NULL;
+	size_t patch_len = 0;
+	char *err = NULL;
+	int rc = bindiff_diff(old_data, old_len, new_data, new_len, &patch, &patch_len, &err);
+	if (rc != BINDIFF_OK) {
+		fprintf(stderr, "bindiff_diff failed (%d): %s\n", rc, err);
+		return 1;
+	}
+	CHECK(patch_len > 0 && patch_len < new_len, "unexpected patch size %zu", patch_len);
+
+	rc = bindiff_verify(patch, patch_len, old_data, old_len, NULL);
+	CHECK(rc == BINDIFF_OK, "bindiff_verify returned %d", rc);
+
+	void *out = NULL;
+	size_t out_len = 0;
+	rc = bindiff_apply(old_data, old_len, patch, patch_len, &out, &out_len, NULL);
+	CHECK(rc == BINDIFF_OK, "bindiff_apply returned %d", rc);
+	if (rc == BINDIFF_OK) {
+		CHECK(out_len == new_len && memcmp(out, new_data, new_len) == 0, "bindiff_apply result mismatch");
+		bindiff_free(out);
+	}
+
+	/* 旧数据与补丁不匹配 */
+	old_data[0] ^= 0xff;
+	rc = bindiff_apply(old_data, old_len, patch, patch_len, &out, &out_len, &err);
+	CHECK(rc == BINDIFF_EHASH, "expected BINDIFF_EHASH for mismatched old data, got %d", rc);
+	CHECK(err != NULL && err[0] != '\0', "expected an error message");
+	bindiff_free(err);
+	rc = bindiff_verify(patch, patch_len, old_data, old_len, NULL);
+	CHECK(rc == BINDIFF_EHASH, "expected BINDIFF_EHASH from bindiff_verify, got %d", rc);
+	old_data[0] ^= 0xff;
+
+	/* 损坏的补丁与无效参数 */
+	rc = bindiff_verify(patch, patch_len / 2, NULL, 0, NULL);
+	CHECK(rc == BINDIFF_ECORRUPT, "expected BINDIFF_ECORRUPT for a truncated patch, got %d", rc);
+	rc = bindiff_apply(old_data, old_len, NULL, 0, &out, &out_len, NULL);
+	CHECK(rc == BINDIFF_EINVAL, "expected BINDIFF_EINVAL for a NULL patch, got %d", rc);
+	rc = bindiff_diff(old_data, old_len, new_data, new_len, NULL, &patch_len, NULL);
+	CHECK(rc == BINDIFF_EINVAL, "expected BINDIFF_EINVAL for a NULL output, got %d", rc);
+
+	bindiff_free(patch);
+	free(old_data);
+	free(new_data);
+	if (failures > 0) {
+		return 1;
+	}
+	printf("ok\n");
+	return 0;
+}
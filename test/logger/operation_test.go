@@ -0,0 +1,57 @@
+package logger_test
+
+import (
+	"bindiff/pkg/logger"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidOperationID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"release-42.step_3:a":    true,
+		"":                       false,
+		"has space":              false,
+		"semi;colon":             false,
+		strings.Repeat("a", 128): true,
+		strings.Repeat("a", 129): false,
+		logger.NewOperationID():  true,
+	} {
+		if got := logger.ValidOperationID(id); got != want {
+			t.Errorf("ValidOperationID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestNewOperationIDUnique(t *testing.T) {
+	a, b := logger.NewOperationID(), logger.NewOperationID()
+	if len(a) != 16 || a == b {
+		t.Errorf("NewOperationID returned %q and %q", a, b)
+	}
+}
+
+func TestStartOperationRejectsInvalidID(t *testing.T) {
+	if _, err := logger.StartOperation("bad id"); err == nil {
+		t.Error("expected an error for an invalid operation ID")
+	}
+}
+
+// recordLogger 记录格式化后的消息
+type recordLogger struct{ lines *[]string }
+
+func (r recordLogger) Debugf(f string, a ...interface{}) { r.add(f, a...) }
+func (r recordLogger) Infof(f string, a ...interface{})  { r.add(f, a...) }
+func (r recordLogger) Warnf(f string, a ...interface{})  { r.add(f, a...) }
+func (r recordLogger) Errorf(f string, a ...interface{}) { r.add(f, a...) }
+func (r recordLogger) add(f string, a ...interface{}) {
+	*r.lines = append(*r.lines, fmt.Sprintf(f, a...))
+}
+
+func TestWithOperationIDPrefixesCustomLogger(t *testing.T) {
+	var lines []string
+	l := logger.WithOperationID(recordLogger{&lines}, "job-7")
+	l.Infof("done %d%%", 100)
+	if len(lines) != 1 || lines[0] != "[op_id=job-7] done 100%" {
+		t.Errorf("unexpected log lines: %q", lines)
+	}
+}
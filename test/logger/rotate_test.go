@@ -0,0 +1,104 @@
+package logger_test
+
+import (
+	"bindiff/pkg/logger"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFileRotatesAndPrunes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bindiff.log")
+	f, err := logger.OpenRotatingFile(logger.LoggerConfig{
+		OutputPath: path,
+		MaxSize:    1,
+		MaxBackups: 2,
+		Compress:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := append(bytes.Repeat([]byte("x"), 100<<10-1), '\n')
+	for i := 0; i < 40; i++ {
+		if _, err := f.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 1<<20 {
+		t.Errorf("current log is %d bytes, over the 1 MB limit", info.Size())
+	}
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "bindiff-*"))
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups, got %v", backups)
+	}
+	for _, b := range backups {
+		if !strings.HasSuffix(b, ".log.gz") {
+			t.Errorf("backup %s is not compressed", b)
+			continue
+		}
+		data := gunzip(t, b)
+		if len(data) == 0 || len(data) > 1<<20 || len(data)%len(line) != 0 {
+			t.Errorf("backup %s holds %d bytes, want whole lines up to 1 MB", b, len(data))
+		}
+	}
+}
+
+func TestRotatingFileExpiresOldBackups(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "bindiff-2000-01-01T00-00-00.000.log")
+	other := filepath.Join(dir, "bindiff-notes.log")
+	for _, p := range []string{old, other} {
+		if err := os.WriteFile(p, []byte("old\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := logger.OpenRotatingFile(logger.LoggerConfig{
+		OutputPath: filepath.Join(dir, "bindiff.log"),
+		MaxAge:     1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("expired backup was not removed: %v", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("unrelated file was removed: %v", err)
+	}
+}
+
+func gunzip(t *testing.T, path string) []byte {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
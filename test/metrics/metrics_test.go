@@ -0,0 +1,156 @@
+package metrics_test
+
+import (
+	"bindiff/pkg/metrics"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExposition 测试 Prometheus 文本格式的输出
+func TestExposition(t *testing.T) {
+	reg := metrics.NewRegistry()
+	c := reg.NewCounter("test_requests_total", "Requests.\nSecond line.", "path")
+	c.Inc("/a")
+	c.Add(2, "/a")
+	c.Inc(`quote"back\slash`)
+	g := reg.NewGauge("test_in_flight", "In flight.")
+	g.Add(3)
+	g.Add(-1)
+	reg.NewGaugeFunc("test_depth", "Depth.", func() float64 { return 7 })
+	h := reg.NewHistogram("test_latency_seconds", "Latency.", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.1)
+	h.Observe(5)
+
+	var out bytes.Buffer
+	if _, err := reg.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_depth Depth.
+# TYPE test_depth gauge
+test_depth 7
+# HELP test_in_flight In flight.
+# TYPE test_in_flight gauge
+test_in_flight 2
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.1"} 2
+test_latency_seconds_bucket{le="1"} 2
+test_latency_seconds_bucket{le="+Inf"} 3
+test_latency_seconds_sum 5.15
+test_latency_seconds_count 3
+# HELP test_requests_total Requests.\nSecond line.
+# TYPE test_requests_total counter
+test_requests_total{path="/a"} 3
+test_requests_total{path="quote\"back\\slash"} 1
+`
+	if out.String() != want {
+		t.Errorf("Exposition mismatch:\n got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+// TestRegistryPanics 测试重复注册、标签数量不符与计数器减少时 panic
+func TestRegistryPanics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	c := reg.NewCounter("dup_total", "Dup.", "a")
+	for name, fn := range map[string]func(){
+		"duplicate":       func() { reg.NewGauge("dup_total", "Dup.") },
+		"label count":     func() { c.Inc() },
+		"negative add":    func() { c.Add(-1, "x") },
+		"unsorted bucket": func() { reg.NewHistogram("h", "H.", []float64{2, 1}) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected panic for %s", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+// TestHandler 测试 HTTP 输出与内容类型
+func TestHandler(t *testing.T) {
+	m := metrics.New(nil)
+	m.QueueDepth(func() int { return 4 })
+	m.Observe(metrics.OpDiff, 100, 10, time.Now(), nil)
+	m.Observe(metrics.OpApply, 50, 0, time.Now(), errors.New("hash mismatch"))
+
+	srv := httptest.NewServer(m.Registry)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected Content-Type %q", ct)
+	}
+	for _, want := range []string{
+		"bindiff_job_queue_depth 4",
+		`bindiff_operations_total{op="diff",result="success"} 1`,
+		`bindiff_operations_total{op="apply",result="error"} 1`,
+		"bindiff_apply_failures_total 1",
+		`bindiff_bytes_processed_total{op="apply"} 50`,
+		`bindiff_bytes_processed_total{op="diff"} 100`,
+		`bindiff_patch_size_bytes_bucket{le="1024"} 1`,
+		`bindiff_operation_duration_seconds_count{op="diff"} 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Output missing %q:\n%s", want, body)
+		}
+	}
+
+	resp, err = http.Post(srv.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", resp.StatusCode)
+	}
+}
+
+// TestStageTimer 测试按阶段开始与结束记录耗时，并转发进度
+func TestStageTimer(t *testing.T) {
+	m := metrics.New(nil)
+	var forwarded int
+	report := m.StageTimer(func(stage string, current, total int64) { forwarded++ })
+	report("Computing diff", 0, 100)
+	report("Computing diff", 50, 100)
+	report("Computing hash", 0, 0)
+	report("Computing hash", 0, 0)
+	report("Computing diff", 100, 100)
+	if forwarded != 5 {
+		t.Errorf("Expected 5 forwarded reports, got %d", forwarded)
+	}
+
+	var out bytes.Buffer
+	m.Registry.WriteTo(&out)
+	for _, want := range []string{
+		`bindiff_stage_duration_seconds_count{stage="Computing diff"} 1`,
+		`bindiff_stage_duration_seconds_count{stage="Computing hash"} 1`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+// TestNilMetrics 测试未启用指标时各方法不做任何事
+func TestNilMetrics(t *testing.T) {
+	var m *metrics.Metrics
+	m.QueueDepth(func() int { return 1 })
+	m.Observe(metrics.OpDiff, 1, 1, time.Now(), nil)
+	if m.StageTimer(nil) != nil {
+		t.Error("Expected nil StageTimer for nil Metrics")
+	}
+}
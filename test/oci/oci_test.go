@@ -0,0 +1,167 @@
+package oci_test
+
+import (
+	"archive/tar"
+	"bindiff/pkg/oci"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// layerTar 构造一个 gzip 压缩的层，内容为给定文件
+func layerTar(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, name := range []string{"bin/app", "etc/config", "usr/lib/libfoo.so"} {
+		data, ok := files[name]
+		if !ok {
+			continue
+		}
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(data)), ModTime: time.Unix(1700000000, 0)})
+		tw.Write(data)
+	}
+	tw.Close()
+	zw.Close()
+	return buf.Bytes()
+}
+
+// writeImage 在 dir 中写出由给定层组成的镜像布局
+func writeImage(t *testing.T, dir string, layers ...[]byte) {
+	t.Helper()
+	blobs := filepath.Join(dir, "blobs", "sha256")
+	if err := os.MkdirAll(blobs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	put := func(mediaType string, data []byte) oci.Descriptor {
+		d := oci.Descriptor{MediaType: mediaType, Digest: oci.Digest(data), Size: int64(len(data))}
+		os.WriteFile(filepath.Join(blobs, strings.TrimPrefix(d.Digest, "sha256:")), data, 0644)
+		return d
+	}
+
+	manifest := oci.Manifest{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeImageManifest,
+		Config:        put("application/vnd.oci.image.config.v1+json", []byte(`{"architecture":"amd64","os":"linux"}`)),
+	}
+	for _, l := range layers {
+		manifest.Layers = append(manifest.Layers, put("application/vnd.oci.image.layer.v1.tar+gzip", l))
+	}
+	data, _ := json.Marshal(manifest)
+	index, _ := json.Marshal(oci.Index{SchemaVersion: 2, Manifests: []oci.Descriptor{put(oci.MediaTypeImageManifest, data)}})
+	os.WriteFile(filepath.Join(dir, "index.json"), index, 0644)
+	os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644)
+}
+
+// TestBundleRoundTrip 测试增量包的生成与应用
+func TestBundleRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	blob := func(n int) []byte {
+		b := make([]byte, n)
+		rng.Read(b)
+		return b
+	}
+	base := layerTar(t, map[string][]byte{"usr/lib/libfoo.so": blob(64 * 1024)})
+	app := blob(48 * 1024)
+	oldApp := layerTar(t, map[string][]byte{"bin/app": app, "etc/config": []byte("debug=false\n")})
+	app[1000] ^= 0xff
+	newApp := layerTar(t, map[string][]byte{"bin/app": app, "etc/config": []byte("debug=true\n")})
+	extra := layerTar(t, map[string][]byte{"etc/config": []byte("new layer\n")})
+
+	oldDir, newDir, outDir := t.TempDir(), t.TempDir(), t.TempDir()
+	writeImage(t, oldDir, base, oldApp)
+	writeImage(t, newDir, base, newApp, extra)
+
+	oldImg, err := oci.Open(oldDir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	newImg, err := oci.Open(newDir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	var bundleData bytes.Buffer
+	bundle, err := oci.Diff(oldImg, newImg, &bundleData, nil)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	kinds := []string{bundle.Layers[0].Kind, bundle.Layers[1].Kind, bundle.Layers[2].Kind}
+	if kinds[0] != oci.LayerUnchanged || kinds[1] != oci.LayerDelta {
+		t.Errorf("Unexpected layer kinds: %v", kinds)
+	}
+	if bundle.Layers[1].Transferred > int64(len(newApp))/4 {
+		t.Errorf("Delta for changed layer is %d bytes, layer is %d", bundle.Layers[1].Transferred, len(newApp))
+	}
+
+	if _, err := oci.Apply(oldImg, bytes.NewReader(bundleData.Bytes()), outDir, nil); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	rebuilt, err := oci.Open(outDir)
+	if err != nil {
+		t.Fatalf("Open rebuilt image failed: %v", err)
+	}
+	if rebuilt.ManifestDescriptor.Digest != newImg.ManifestDescriptor.Digest {
+		t.Error("Rebuilt image manifest differs")
+	}
+	for _, l := range rebuilt.Manifest.Layers {
+		if _, err := rebuilt.Blob(l); err != nil {
+			t.Errorf("Rebuilt layer %s: %v", l.Digest, err)
+		}
+	}
+
+	// 增量包只能应用到生成时的旧镜像
+	if _, err := oci.Apply(newImg, bytes.NewReader(bundleData.Bytes()), t.TempDir(), nil); !errors.Is(err, oci.ErrInvalidBundle) {
+		t.Errorf("Expected ErrInvalidBundle for wrong base image, got %v", err)
+	}
+	truncated := bundleData.Bytes()[:bundleData.Len()/2]
+	if _, err := oci.Apply(oldImg, bytes.NewReader(truncated), t.TempDir(), nil); !errors.Is(err, oci.ErrInvalidBundle) {
+		t.Errorf("Expected ErrInvalidBundle for truncated bundle, got %v", err)
+	}
+}
+
+// TestOpenArchive 测试从 oci-archive tar 打开镜像并校验 blob
+func TestOpenArchive(t *testing.T) {
+	dir := t.TempDir()
+	writeImage(t, dir, layerTar(t, map[string][]byte{"bin/app": []byte("app")}))
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		data, _ := os.ReadFile(p)
+		tw.WriteHeader(&tar.Header{Name: filepath.ToSlash(rel), Mode: 0644, Size: int64(len(data))})
+		tw.Write(data)
+		return nil
+	})
+	tw.Close()
+
+	img, err := oci.OpenArchive(&buf)
+	if err != nil {
+		t.Fatalf("OpenArchive failed: %v", err)
+	}
+	if len(img.Manifest.Layers) != 1 {
+		t.Fatalf("Expected 1 layer, got %d", len(img.Manifest.Layers))
+	}
+
+	layer := img.Manifest.Layers[0]
+	os.WriteFile(filepath.Join(dir, "blobs", "sha256", strings.TrimPrefix(layer.Digest, "sha256:")), []byte("tampered"), 0644)
+	tampered, err := oci.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tampered.Blob(layer); !errors.Is(err, oci.ErrInvalidImage) {
+		t.Errorf("Expected ErrInvalidImage for tampered blob, got %v", err)
+	}
+}
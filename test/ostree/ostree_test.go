@@ -0,0 +1,169 @@
+package ostree_test
+
+import (
+	"bindiff/pkg/ostree"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTree 在 dir 下按 files 创建文件，值以 "->" 开头时创建符号链接
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		if target, ok := strings.CutPrefix(content, "->"); ok {
+			err = os.Symlink(target, p)
+		} else {
+			err = os.WriteFile(p, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestStaticDelta 提交两个版本，生成静态增量并应用到只有旧版本的仓库
+func TestStaticDelta(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	firmware := make([]byte, 256*1024)
+	rng.Read(firmware)
+	updated := append([]byte(nil), firmware...)
+	copy(updated[100000:], "patched firmware block")
+
+	v1, v2 := t.TempDir(), t.TempDir()
+	writeTree(t, v1, map[string]string{
+		"usr/lib/firmware.bin": string(firmware),
+		"etc/os-release":       "VERSION=1\n",
+		"etc/hostname":         "device\n",
+		"usr/bin/sh":           "->busybox",
+	})
+	writeTree(t, v2, map[string]string{
+		"usr/lib/firmware.bin": string(updated),
+		"etc/os-release":       "VERSION=2\n",
+		"etc/hostname":         "device\n",
+		"usr/bin/sh":           "->busybox",
+		"usr/share/new.txt":    "added in v2\n",
+	})
+
+	server, err := ostree.Init(filepath.Join(t.TempDir(), "server"))
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	stamp := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c1, err := server.CommitDir(v1, "os/main", "v1", stamp)
+	if err != nil {
+		t.Fatalf("CommitDir v1 failed: %v", err)
+	}
+	c2, err := server.CommitDir(v2, "os/main", "v2", stamp.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CommitDir v2 failed: %v", err)
+	}
+	if head, err := server.Resolve("os/main"); err != nil || head != c2 {
+		t.Fatalf("Resolve(os/main) = %s, %v; want %s", head, err, c2)
+	}
+	data, err := server.ReadMetadata(c2, ostree.ObjectCommit)
+	if err != nil {
+		t.Fatalf("ReadMetadata failed: %v", err)
+	}
+	commit, err := ostree.ParseCommit(data)
+	if err != nil {
+		t.Fatalf("ParseCommit failed: %v", err)
+	}
+	if commit.Parent != c1 || commit.Subject != "v2" || !commit.Timestamp.Equal(stamp.Add(time.Hour)) {
+		t.Errorf("Unexpected commit %+v", commit)
+	}
+
+	delta, err := ostree.GenerateDelta(server, c1, c2, nil)
+	if err != nil {
+		t.Fatalf("GenerateDelta failed: %v", err)
+	}
+	rel, _ := ostree.DeltaPath(c1, c2)
+	if _, err := os.Stat(filepath.Join(server.Path, rel, "superblock")); err != nil {
+		t.Fatalf("Superblock not written: %v", err)
+	}
+	if delta.Fuzzy != 1 {
+		t.Errorf("Expected firmware.bin to be sent against its old version, got %d fuzzy objects", delta.Fuzzy)
+	}
+	if delta.Size > int64(len(firmware))/10 {
+		t.Errorf("Delta is %d bytes for a one-block firmware change", delta.Size)
+	}
+
+	// 设备端仓库只有 v1，相同内容与时间戳的提交得到相同的校验和
+	device, err := ostree.Init(filepath.Join(t.TempDir(), "device"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := device.CommitDir(v1, "os/main", "v1", stamp); err != nil || got != c1 {
+		t.Fatalf("Device commit = %s, %v; want %s", got, err, c1)
+	}
+	applied, err := ostree.ApplyDelta(device, delta.Dir)
+	if err != nil {
+		t.Fatalf("ApplyDelta failed: %v", err)
+	}
+	if applied.From != c1 || applied.To != c2 || applied.Objects != delta.Objects {
+		t.Errorf("Applied %+v, generated %+v", applied, delta)
+	}
+	if _, err := device.ReadMetadata(c2, ostree.ObjectCommit); err != nil {
+		t.Errorf("Target commit missing after apply: %v", err)
+	}
+	for name, content := range map[string][]byte{"firmware": updated, "os-release": []byte("VERSION=2\n"), "new": []byte("added in v2\n")} {
+		sum := ostree.ContentChecksum(&ostree.Content{Mode: 0100644, Data: content})
+		got, err := device.ReadContent(sum)
+		if err != nil || string(got.Data) != string(content) {
+			t.Errorf("%s not reconstructed: %v", name, err)
+		}
+	}
+
+	// 完整增量可以应用到空仓库
+	full, err := ostree.GenerateDelta(server, "", c2, &ostree.DeltaOptions{MaxPartSize: 64 * 1024})
+	if err != nil {
+		t.Fatalf("GenerateDelta from scratch failed: %v", err)
+	}
+	if full.Parts < 2 {
+		t.Errorf("Expected the scratch delta to be split into parts, got %d", full.Parts)
+	}
+	empty, _ := ostree.Init(filepath.Join(t.TempDir(), "empty"))
+	if _, err := ostree.ApplyDelta(empty, full.Dir); err != nil {
+		t.Fatalf("ApplyDelta from scratch failed: %v", err)
+	}
+
+	// 损坏的部分被拒绝
+	part := filepath.Join(delta.Dir, "0")
+	partData, _ := os.ReadFile(part)
+	partData[len(partData)/2] ^= 0xff
+	os.WriteFile(part, partData, 0644)
+	other, _ := ostree.Init(filepath.Join(t.TempDir(), "other"))
+	other.CommitDir(v1, "os/main", "v1", stamp)
+	if _, err := ostree.ApplyDelta(other, delta.Dir); !errors.Is(err, ostree.ErrInvalidDelta) {
+		t.Errorf("Expected ErrInvalidDelta for a corrupt part, got %v", err)
+	}
+}
+
+// TestDeltaPath 测试增量目录名使用的修改版 base64
+func TestDeltaPath(t *testing.T) {
+	zeros := strings.Repeat("00", 32)
+	ones := strings.Repeat("ff", 32)
+	got, err := ostree.DeltaPath(zeros, ones)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join("deltas", "AA", strings.Repeat("A", 41)+"-"+strings.Repeat("_", 42)+"8")
+	if got != want {
+		t.Errorf("DeltaPath = %s, want %s", got, want)
+	}
+	if got, _ := ostree.DeltaPath("", ones); got != filepath.Join("deltas", "__", strings.Repeat("_", 40)+"8") {
+		t.Errorf("Scratch DeltaPath = %s", got)
+	}
+	if _, err := ostree.DeltaPath("xyz", ones); err == nil {
+		t.Error("Expected error for a malformed checksum")
+	}
+}
@@ -0,0 +1,144 @@
+package p2p_test
+
+import (
+	"bindiff/pkg/p2p"
+	"bindiff/pkg/storage"
+	"bindiff/pkg/zchunk"
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// release 生成测试用的旧版本与新版本
+func release(t *testing.T) (oldData, newData []byte) {
+	t.Helper()
+	r := rand.New(rand.NewSource(1))
+	oldData = make([]byte, 192<<10)
+	r.Read(oldData)
+	extra := make([]byte, 64<<10)
+	r.Read(extra)
+	newData = append(append([]byte{}, oldData...), extra...)
+	return oldData, newData
+}
+
+// TestFetchFromPeers 测试块优先从对等节点获取，只有对等节点没有的块才访问块目录
+func TestFetchFromPeers(t *testing.T) {
+	oldData, newData := release(t)
+	chunks := storage.NewFS(t.TempDir())
+	m, _, err := zchunk.Build(context.Background(), newData, "app.bin", chunks, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var origin int64
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&origin, 1)
+		http.FileServer(http.Dir(chunks.Dir())).ServeHTTP(w, r)
+	}))
+	defer cdn.Close()
+
+	// 已更新的节点提供新版本的前一半
+	seeder := p2p.NewSeeder()
+	half := newData[:len(newData)/2]
+	seeder.Add(half, nil)
+	peer := httptest.NewServer(seeder)
+	defer peer.Close()
+	empty := httptest.NewServer(p2p.NewSeeder())
+	defer empty.Close()
+
+	out, stats, err := zchunk.Fetch(context.Background(), m, cdn.URL, nil, &zchunk.FetchOptions{
+		Source: p2p.NewPeers([]string{empty.URL, peer.Listener.Addr().String(), "127.0.0.1:1"}),
+	})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if !bytes.Equal(out, newData) {
+		t.Fatal("Reconstructed file mismatch")
+	}
+	if stats.FromSource == 0 || stats.FromSource > int64(len(half)) {
+		t.Errorf("Expected part of the file from peers: %+v", stats)
+	}
+	if stats.Downloaded == 0 || int(origin) >= len(m.Chunks) {
+		t.Errorf("Expected the rest from the chunk directory: %+v, %d origin requests", stats, origin)
+	}
+
+	// 复用旧版本后，其余的块全部由对等节点提供
+	full := p2p.NewSeeder()
+	full.Add(newData, nil)
+	fullPeer := httptest.NewServer(full)
+	defer fullPeer.Close()
+	atomic.StoreInt64(&origin, 0)
+	out, stats, err = zchunk.Fetch(context.Background(), m, cdn.URL, oldData, &zchunk.FetchOptions{
+		Source: p2p.NewPeers([]string{fullPeer.URL}),
+	})
+	if err != nil || !bytes.Equal(out, newData) {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if origin != 0 || stats.Downloaded != 0 || stats.Reused == 0 {
+		t.Errorf("Expected no origin requests: %+v, %d origin requests", stats, origin)
+	}
+}
+
+// liar 对所有块返回错误内容的节点
+type liar struct{}
+
+func (liar) GetChunk(ctx context.Context, hash string, size int64) ([]byte, error) {
+	return make([]byte, size), nil
+}
+
+// TestUntrustedPeer 测试对等节点返回的错误内容被丢弃并回退到块目录
+func TestUntrustedPeer(t *testing.T) {
+	_, newData := release(t)
+	chunks := storage.NewFS(t.TempDir())
+	m, _, err := zchunk.Build(context.Background(), newData, "app.bin", chunks, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, stats, err := zchunk.Fetch(context.Background(), m, "", nil, &zchunk.FetchOptions{Storage: chunks, Source: liar{}})
+	if err != nil || !bytes.Equal(out, newData) {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if stats.FromSource != 0 {
+		t.Errorf("Corrupt peer data should not be used: %+v", stats)
+	}
+}
+
+// TestSeeder 测试 Seeder 的请求处理与 Peers 的错误
+func TestSeeder(t *testing.T) {
+	seeder := p2p.NewSeeder()
+	if n := seeder.Add(bytes.Repeat([]byte("seed"), 1000), nil); n != 1 || seeder.Len() != 1 {
+		t.Fatalf("Add = %d, Len = %d", n, seeder.Len())
+	}
+	srv := httptest.NewServer(seeder)
+	defer srv.Close()
+
+	for path, want := range map[string]int{
+		p2p.ChunkPath + "00": http.StatusNotFound,
+		"/other":             http.StatusNotFound,
+	} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET %s = %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+	resp, _ := http.Post(srv.URL+p2p.ChunkPath+"00", "text/plain", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST = %d", resp.StatusCode)
+	}
+
+	if _, err := p2p.NewPeers(nil).GetChunk(context.Background(), "00112233", 1); !errors.Is(err, p2p.ErrNoPeer) {
+		t.Errorf("Expected ErrNoPeer without peers, got %v", err)
+	}
+	if _, err := p2p.NewPeers([]string{srv.URL}).GetChunk(context.Background(), "0011223344", 1); !errors.Is(err, p2p.ErrNoPeer) {
+		t.Errorf("Expected ErrNoPeer for an unknown chunk, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package progress_test
+
+import (
+	"bindiff/pkg/progress"
+	"bindiff/pkg/utils"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestJSONLThrottlesRecords 测试阶段开始与完成总会输出，其间按间隔节流
+func TestJSONLThrottlesRecords(t *testing.T) {
+	var buf bytes.Buffer
+	j := progress.NewJSONL(&buf)
+	j.Interval = time.Hour
+
+	j.Report("Computing diff", 0, 1000)
+	j.Report("Computing diff", 500, 1000)
+	time.Sleep(10 * time.Millisecond)
+	j.Report("Computing diff", 1000, 1000)
+	j.Report("Computing hash", 0, 10)
+
+	var records []progress.Record
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var r progress.Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d: %+v", len(records), records)
+	}
+
+	first, done, next := records[0], records[1], records[2]
+	if first.Percent != 0 || first.Done || first.ETASeconds != nil {
+		t.Errorf("unexpected first record: %+v", first)
+	}
+	if !done.Done || done.Percent != 100 || done.BytesPerSecond <= 0 || done.ETASeconds == nil || *done.ETASeconds != 0 {
+		t.Errorf("unexpected completion record: %+v", done)
+	}
+	if next.Stage != "Computing hash" {
+		t.Errorf("new stage not reported: %+v", next)
+	}
+}
+
+func TestSetFormat(t *testing.T) {
+	defer progress.SetFormat(progress.FormatBar)
+	if err := progress.SetFormat("fancy"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if err := progress.SetFormat(progress.FormatNone); err != nil {
+		t.Fatal(err)
+	}
+	if r := progress.Default(); r != nil {
+		t.Errorf("Default() = %T, want nil for none", r)
+	}
+	if err := progress.SetFormat(progress.FormatJSONL); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := progress.Default().(*progress.JSONL); !ok {
+		t.Error("Default() is not a JSONL reporter")
+	}
+	// 标准错误不是终端时进度条不显示
+	if err := progress.SetFormat(progress.FormatBar); err != nil {
+		t.Fatal(err)
+	}
+	if r := progress.Default(); !utils.IsTerminal(os.Stderr) && r != nil {
+		t.Errorf("Default() = %T, want nil when stderr is not a terminal", r)
+	}
+}
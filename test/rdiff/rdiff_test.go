@@ -0,0 +1,136 @@
+package rdiff_test
+
+import (
+	"bindiff/pkg/rdiff"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// roundTrip 生成签名与增量并应用，返回增量大小
+func roundTrip(t *testing.T, magic rdiff.Magic, blockLen int, base, newData []byte) int {
+	t.Helper()
+	var sigBuf bytes.Buffer
+	if err := rdiff.WriteSignature(bytes.NewReader(base), &sigBuf, magic, blockLen, 0); err != nil {
+		t.Fatalf("WriteSignature failed: %v", err)
+	}
+	sig, err := rdiff.ReadSignature(&sigBuf)
+	if err != nil {
+		t.Fatalf("ReadSignature failed: %v", err)
+	}
+	var delta bytes.Buffer
+	if err := rdiff.WriteDelta(sig, newData, &delta); err != nil {
+		t.Fatalf("WriteDelta failed: %v", err)
+	}
+	size := delta.Len()
+	var out bytes.Buffer
+	if err := rdiff.Patch(bytes.NewReader(base), &delta, &out); err != nil {
+		t.Fatalf("Patch failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), newData) {
+		t.Fatalf("Patched data mismatch for magic %#x", uint32(magic))
+	}
+	return size
+}
+
+// TestRoundTrip 测试四种签名格式下的增量与补丁
+func TestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	base := make([]byte, 100_000+123) // 最后一块不足块长度
+	rng.Read(base)
+	insert := make([]byte, 500)
+	rng.Read(insert)
+
+	// 插入一段数据使后续块错位，只有滚动校验能重新对齐
+	newData := append(append(append([]byte{}, base[:3001]...), insert...), base[3001:]...)
+
+	for _, magic := range []rdiff.Magic{rdiff.MD4SigMagic, rdiff.Blake2SigMagic, rdiff.RKMD4SigMagic, rdiff.RKBlake2SigMagic} {
+		size := roundTrip(t, magic, 1024, base, newData)
+		if size > 3*1024+len(insert)+100 {
+			t.Errorf("Magic %#x: delta too large (%d bytes)", uint32(magic), size)
+		}
+	}
+
+	// 相同文件（包括不足块长度的最后一块）只需要复制命令
+	if size := roundTrip(t, rdiff.RKBlake2SigMagic, 1024, base, base); size > 16 {
+		t.Errorf("Identical files: delta too large (%d bytes)", size)
+	}
+
+	// 空文件与完全不同的文件
+	roundTrip(t, rdiff.RKBlake2SigMagic, 0, nil, base)
+	roundTrip(t, rdiff.RKBlake2SigMagic, 0, base, nil)
+	roundTrip(t, rdiff.MD4SigMagic, 16, []byte("short"), []byte("short"))
+}
+
+// TestSignatureFormat 测试签名文件的字节布局与 librsync 一致
+func TestSignatureFormat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := rdiff.WriteSignature(bytes.NewReader([]byte("abc")), &buf, rdiff.MD4SigMagic, 2048, 0); err != nil {
+		t.Fatalf("WriteSignature failed: %v", err)
+	}
+	// 魔数、块长度、强校验长度，然后是 rollsum("abc") 与 MD4("abc")
+	want := "72730136" + "00000800" + "00000010" + "03040183" + "a448017aaf21d8525fc10ae87aa6729d"
+	if got := hex.EncodeToString(buf.Bytes()); got != want {
+		t.Errorf("Signature mismatch:\n got %s\nwant %s", got, want)
+	}
+
+	buf.Reset()
+	if err := rdiff.WriteSignature(bytes.NewReader([]byte("abc")), &buf, rdiff.RKBlake2SigMagic, 2048, 8); err != nil {
+		t.Fatalf("WriteSignature failed: %v", err)
+	}
+	// 弱校验之后是 BLAKE2b-256("abc") 截断为 8 字节
+	if got := hex.EncodeToString(buf.Bytes()[16:]); got != "bddd813c63423972" {
+		t.Errorf("Strong sum mismatch: %s", got)
+	}
+
+	buf.Reset()
+	if err := rdiff.WriteSignature(bytes.NewReader([]byte("abc")), &buf, rdiff.Blake2SigMagic, 2048, 0); err != nil {
+		t.Fatalf("WriteSignature failed: %v", err)
+	}
+	// 默认的强校验长度为完整的 BLAKE2b-256("abc")
+	want = "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319"
+	if got := hex.EncodeToString(buf.Bytes()[16:]); got != want {
+		t.Errorf("Strong sum mismatch:\n got %s\nwant %s", got, want)
+	}
+}
+
+// TestCorruptInput 测试截断或损坏的输入返回 ErrFormat
+func TestCorruptInput(t *testing.T) {
+	base := bytes.Repeat([]byte("0123456789"), 1000)
+	var sigBuf bytes.Buffer
+	if err := rdiff.WriteSignature(bytes.NewReader(base), &sigBuf, rdiff.RKBlake2SigMagic, 512, 0); err != nil {
+		t.Fatalf("WriteSignature failed: %v", err)
+	}
+	sigData := sigBuf.Bytes()
+	if _, err := rdiff.ReadSignature(bytes.NewReader(sigData[:len(sigData)-1])); !errors.Is(err, rdiff.ErrFormat) {
+		t.Errorf("Expected ErrFormat for truncated signature, got %v", err)
+	}
+	if _, err := rdiff.ReadSignature(bytes.NewReader([]byte("not a signature"))); !errors.Is(err, rdiff.ErrFormat) {
+		t.Errorf("Expected ErrFormat for bad magic, got %v", err)
+	}
+
+	sig, err := rdiff.ReadSignature(bytes.NewReader(sigData))
+	if err != nil {
+		t.Fatalf("ReadSignature failed: %v", err)
+	}
+	var delta bytes.Buffer
+	if err := rdiff.WriteDelta(sig, append([]byte("prefix"), base...), &delta); err != nil {
+		t.Fatalf("WriteDelta failed: %v", err)
+	}
+	d := delta.Bytes()
+
+	cases := map[string][]byte{
+		"truncated":   d[:len(d)-1],
+		"bad magic":   append([]byte{0, 0, 0, 0}, d[4:]...),
+		"reserved op": append(append([]byte{}, d[:4]...), 0x55, 0x00),
+		// 偏移与长度各 2 字节：从 9984 复制 256 字节，超出基准文件末尾
+		"copy too far": append(append([]byte{}, d[:4]...), 0x4a, 0x27, 0x00, 0x01, 0x00, 0x00),
+	}
+	for name, data := range cases {
+		if err := rdiff.Patch(bytes.NewReader(base), bytes.NewReader(data), &bytes.Buffer{}); !errors.Is(err, rdiff.ErrFormat) {
+			t.Errorf("%s: expected ErrFormat, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,577 @@
+package repo_test
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/repo"
+	"bindiff/pkg/storage"
+	"bindiff/types"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// TestBlobStore 测试内容寻址对象存储
+func TestBlobStore(t *testing.T) {
+	store := repo.NewBlobStore(t.TempDir())
+	data := []byte("blob content")
+
+	id, err := store.Put(data)
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if id != repo.ObjectID(data) {
+		t.Errorf("Object ID mismatch: %s", id)
+	}
+	if again, _ := store.Put(data); again != id {
+		t.Error("Identical content must map to the same object")
+	}
+
+	got, err := store.Get(id)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Get returned %q, %v", got, err)
+	}
+	if _, err := store.Get(repo.ObjectID([]byte("missing"))); !errors.Is(err, repo.ErrObjectNotFound) {
+		t.Errorf("Expected ErrObjectNotFound, got %v", err)
+	}
+}
+
+// TestRepositoryHistory 测试版本提交与检出
+func TestRepositoryHistory(t *testing.T) {
+	dir := t.TempDir()
+	r, err := repo.Open(dir, nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	base := bytes.Repeat([]byte("shared content "), 200)
+	versions := [][]byte{
+		base,
+		append(append([]byte(nil), base...), "appended"...),
+		[]byte("completely different"),
+	}
+	for i, data := range versions {
+		if _, changed, err := r.Commit("bin/app.bin", data); err != nil || !changed {
+			t.Fatalf("Commit %d failed: changed=%v err=%v", i, changed, err)
+		}
+	}
+	if _, changed, _ := r.Commit("bin/app.bin", versions[2]); changed {
+		t.Error("Unchanged content must not create a version")
+	}
+	if err := r.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// 重新打开后历史保持不变
+	r, err = repo.Open(dir, nil)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	history, err := r.History("bin/app.bin")
+	if err != nil || len(history) != len(versions) {
+		t.Fatalf("Expected %d versions, got %d (%v)", len(versions), len(history), err)
+	}
+	if history[1].Kind != types.OBJECT_DELTA || history[1].Base != history[0].Hash {
+		t.Errorf("Version 1 should be a delta against version 0, got %+v", history[1])
+	}
+	if history[2].Kind != types.OBJECT_FULL {
+		t.Errorf("Unrelated content should be stored in full, got %s", history[2].Kind)
+	}
+
+	for i, expected := range versions {
+		got, err := r.Checkout("bin/app.bin", i)
+		if err != nil || !bytes.Equal(got, expected) {
+			t.Errorf("Checkout of version %d failed: %v", i, err)
+		}
+	}
+	if _, err := r.History("missing"); !errors.Is(err, repo.ErrFileNotTracked) {
+		t.Errorf("Expected ErrFileNotTracked, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, types.INDEX_FILE)); err != nil {
+		t.Errorf("Index file not written: %v", err)
+	}
+}
+
+// TestRepositoryStorage 对象存放在外部存储后端，仓库目录只保留索引
+func TestRepositoryStorage(t *testing.T) {
+	dir, objects := t.TempDir(), t.TempDir()
+	r, err := repo.Open(dir, &repo.Options{Storage: storage.NewFS(objects)})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	data := bytes.Repeat([]byte("remote object "), 100)
+	if _, _, err := r.Commit("a.bin", data); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	ids, err := r.Store().List()
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("Expected one object in the backend, got %v (%v)", ids, err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "objects")); len(entries) != 0 {
+		t.Errorf("Objects written to the local directory: %d entries", len(entries))
+	}
+	if got, err := r.Checkout("a.bin", 0); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Checkout failed: %v", err)
+	}
+}
+
+// TestCommitFS 测试从 fs.FS 提交
+func TestCommitFS(t *testing.T) {
+	r, err := repo.Open(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	fsys := fstest.MapFS{
+		"a.txt":     {Data: []byte("a")},
+		"dir/b.txt": {Data: []byte("b")},
+	}
+	changed, err := r.CommitFS(fsys)
+	if err != nil || changed != 2 {
+		t.Fatalf("CommitFS: changed=%d err=%v", changed, err)
+	}
+	if files := r.Files(); len(files) != 2 || files[0] != "a.txt" || files[1] != "dir/b.txt" {
+		t.Errorf("Unexpected files: %v", files)
+	}
+}
+
+// TestBoundedDeltaChain 测试增量链长度受快照间隔限制
+func TestBoundedDeltaChain(t *testing.T) {
+	r, err := repo.Open(t.TempDir(), &repo.Options{SnapshotInterval: 2})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	data := bytes.Repeat([]byte("bounded chain content "), 200)
+	var contents [][]byte
+	for i := 0; i < 7; i++ {
+		data = append(append([]byte(nil), data...), byte('a'+i))
+		contents = append(contents, data)
+		if _, _, err := r.Commit("lib.so", data); err != nil {
+			t.Fatalf("Commit %d failed: %v", i, err)
+		}
+	}
+
+	versions, _ := r.History("lib.so")
+	for i := range versions {
+		if depth := repo.ChainDepth(versions, i); depth > 2 {
+			t.Errorf("Version %d has chain depth %d, exceeds interval", i, depth)
+		}
+		got, err := r.Checkout("lib.so", i)
+		if err != nil || !bytes.Equal(got, contents[i]) {
+			t.Errorf("Checkout of version %d failed: %v", i, err)
+		}
+	}
+
+	stats, err := r.Stats("lib.so")
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.Full < 2 || stats.Delta == 0 {
+		t.Errorf("Expected periodic snapshots between deltas, got %+v", stats)
+	}
+	if stats.MaxDepth > 2 || stats.StoredSize >= stats.LogicalSize {
+		t.Errorf("Unexpected chain stats: %+v", stats)
+	}
+}
+
+// TestFsck 测试完整性检查与从冗余数据修复
+func TestFsck(t *testing.T) {
+	dir := t.TempDir()
+	r, err := repo.Open(dir, nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	content := bytes.Repeat([]byte("fsck content "), 300)
+	similar := append(append([]byte(nil), content...), "tail"...)
+	if _, _, err := r.Commit("a.bin", content); err != nil {
+		t.Fatal(err)
+	}
+	// b.bin 的第二个版本以增量形式保存相同内容，作为冗余数据
+	for _, data := range [][]byte{similar, content} {
+		if _, _, err := r.Commit("b.bin", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := r.Fsck(false)
+	if err != nil || len(report.Problems) != 0 {
+		t.Fatalf("Expected clean repository, got %v %v", report.Problems, err)
+	}
+
+	history, _ := r.History("a.bin")
+	object := history[0].Object
+	if err := os.WriteFile(filepath.Join(dir, "objects", object[:2], object[2:]), []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = r.Fsck(false)
+	if err != nil {
+		t.Fatalf("Fsck failed: %v", err)
+	}
+	if len(report.Problems) == 0 || !errors.Is(report.Problems[0].Err, repo.ErrCorruptObject) {
+		t.Fatalf("Expected corrupt object to be reported, got %v", report.Problems)
+	}
+
+	report, err = r.Fsck(true)
+	if err != nil {
+		t.Fatalf("Fsck repair failed: %v", err)
+	}
+	if report.Unrepaired() != 0 {
+		t.Fatalf("Expected all problems repaired, got %v", report.Problems)
+	}
+
+	reopened, err := repo.Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.Checkout("a.bin", 0)
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("Checkout after repair failed: %v", err)
+	}
+	if report, _ := reopened.Fsck(false); len(report.Problems) != 0 {
+		t.Errorf("Repository still inconsistent: %v", report.Problems)
+	}
+}
+
+// TestStatus 测试工作区状态比较
+func TestStatus(t *testing.T) {
+	r, err := repo.Open(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	base := bytes.Repeat([]byte("status content "), 100)
+	tracked := fstest.MapFS{
+		"same.bin":    {Data: []byte("unchanged")},
+		"changed.bin": {Data: base},
+		"gone.bin":    {Data: []byte("will be removed")},
+	}
+	if _, err := r.CommitFS(tracked); err != nil {
+		t.Fatalf("CommitFS failed: %v", err)
+	}
+
+	edited := append(append([]byte(nil), base...), "edit"...)
+	work := fstest.MapFS{
+		"same.bin":        {Data: []byte("unchanged")},
+		"changed.bin":     {Data: edited},
+		"new.bin":         {Data: []byte("brand new")},
+		".bindiff/object": {Data: []byte("repository data")},
+	}
+	statuses, err := r.Status(work, &repo.StatusOptions{
+		Estimate: true,
+		Ignore:   func(p string) bool { return p == ".bindiff" },
+	})
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+
+	want := []struct {
+		path string
+		kind types.FileChangeKind
+	}{
+		{"changed.bin", types.FILE_MODIFIED},
+		{"gone.bin", types.FILE_REMOVED},
+		{"new.bin", types.FILE_ADDED},
+	}
+	if len(statuses) != len(want) {
+		t.Fatalf("Expected %d changes, got %+v", len(want), statuses)
+	}
+	for i, w := range want {
+		if statuses[i].Path != w.path || statuses[i].Kind != w.kind {
+			t.Errorf("Status %d: got %s/%d, want %s/%d", i, statuses[i].Path, statuses[i].Kind, w.path, w.kind)
+		}
+	}
+	if d := statuses[0].EstimatedDelta; d <= 0 || d >= int64(len(edited)) {
+		t.Errorf("Unexpected delta estimate %d for a small edit", d)
+	}
+}
+
+// TestStatusRename 测试工作区中移动的文件被识别为重命名
+func TestStatusRename(t *testing.T) {
+	r, err := repo.Open(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	content := bytes.Repeat([]byte("movable asset "), 1000)
+	if _, err := r.CommitFS(fstest.MapFS{"old/asset.bin": {Data: content}}); err != nil {
+		t.Fatalf("CommitFS failed: %v", err)
+	}
+
+	statuses, err := r.Status(fstest.MapFS{"new/asset.bin": {Data: content}}, nil)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Kind != types.FILE_RENAMED || statuses[0].OldPath != "old/asset.bin" {
+		t.Errorf("Expected a single rename, got %+v", statuses)
+	}
+}
+
+// TestConcurrentCommit 测试多个仓库实例加锁后并发提交不会丢失更新
+func TestConcurrentCommit(t *testing.T) {
+	dir := t.TempDir()
+	const writers = 8
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r, err := repo.Open(dir, nil)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := r.Lock(); err != nil {
+				errs <- err
+				return
+			}
+			defer r.Unlock()
+			name := fmt.Sprintf("file%d.bin", i)
+			if _, _, err := r.Commit(name, []byte(name)); err != nil {
+				errs <- err
+				return
+			}
+			errs <- r.Save()
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Concurrent commit failed: %v", err)
+		}
+	}
+
+	r, err := repo.Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := r.Files(); len(files) != writers {
+		t.Errorf("Expected %d tracked files, got %v", writers, files)
+	}
+	if err := r.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Lock(); !errors.Is(err, repo.ErrAlreadyLocked) {
+		t.Errorf("Expected ErrAlreadyLocked, got %v", err)
+	}
+	r.Unlock()
+}
+
+// TestCommitStagedUntilSave 测试提交的对象暂存到 Save 时才与索引一起写入：
+// 保存前其他进程看不到新对象，保存后对象与索引同时可见
+func TestCommitStagedUntilSave(t *testing.T) {
+	dir := t.TempDir()
+	r, err := repo.Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := bytes.Repeat([]byte("staged content "), 200)
+	next := append(append([]byte(nil), base...), "v2"...)
+	for _, data := range [][]byte{base, next} {
+		if _, _, err := r.Commit("data.bin", data); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+	}
+	// 暂存的对象可以读取，增量以暂存的上一版本为基
+	if got, err := r.Checkout("data.bin", 1); err != nil || !bytes.Equal(got, next) {
+		t.Fatalf("Checkout of a staged version failed: %v", err)
+	}
+
+	other, err := repo.Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := other.Store().List(); err != nil || len(ids) != 0 {
+		t.Errorf("Objects visible before Save: %v (%v)", ids, err)
+	}
+
+	if err := r.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	reopened, err := repo.Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := reopened.Store().List(); len(ids) != 2 {
+		t.Errorf("Expected 2 objects after Save, got %v", ids)
+	}
+	if got, err := reopened.Checkout("data.bin", 1); err != nil || !bytes.Equal(got, next) {
+		t.Errorf("Checkout after Save failed: %v", err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, ".txn-*")); len(matches) != 0 {
+		t.Errorf("Transaction journal left behind: %v", matches)
+	}
+}
+
+// TestExportImport 测试仓库导出为归档并导入到新仓库
+func TestExportImport(t *testing.T) {
+	src, err := repo.Open(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	base := bytes.Repeat([]byte("exported content "), 200)
+	versions := [][]byte{base, append(append([]byte(nil), base...), "v2"...)}
+	for _, data := range versions {
+		if _, _, err := src.Commit("data.bin", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var archive bytes.Buffer
+	if err := src.Export(&archive); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	dst, err := repo.Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Import(bytes.NewReader(archive.Bytes())); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	reopened, err := repo.Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range versions {
+		got, err := reopened.Checkout("data.bin", i)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("Version %d not restored: %v", i, err)
+		}
+	}
+
+	if err := reopened.Import(bytes.NewReader(archive.Bytes())); !errors.Is(err, repo.ErrRepositoryNotEmpty) {
+		t.Errorf("Expected ErrRepositoryNotEmpty, got %v", err)
+	}
+
+	empty, err := repo.Open(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := archive.Bytes()[:archive.Len()/2]
+	if err := empty.Import(bytes.NewReader(truncated)); !errors.Is(err, repo.ErrInvalidArchive) {
+		t.Errorf("Expected ErrInvalidArchive for truncated archive, got %v", err)
+	}
+	if len(empty.Files()) != 0 {
+		t.Error("Failed import must not modify the index")
+	}
+}
+
+// TestTagsAndChannels 测试标签、通道与到通道版本的补丁
+func TestTagsAndChannels(t *testing.T) {
+	r, err := repo.Open(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	v1 := bytes.Repeat([]byte("release one "), 100)
+	v2 := append(append([]byte(nil), v1...), "release two"...)
+	if _, _, err := r.Commit("app.bin", v1); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Tag("v1"); err != nil {
+		t.Fatalf("Tag failed: %v", err)
+	}
+	if _, _, err := r.Commit("app.bin", v2); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Tag("v2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Tag("v2"); !errors.Is(err, repo.ErrRefExists) {
+		t.Errorf("Expected ErrRefExists, got %v", err)
+	}
+
+	if err := r.SetChannel("stable", "v1"); err != nil {
+		t.Fatalf("SetChannel failed: %v", err)
+	}
+	if err := r.SetChannel("beta", "missing"); !errors.Is(err, repo.ErrRefNotFound) {
+		t.Errorf("Expected ErrRefNotFound, got %v", err)
+	}
+	if err := r.DeleteTag("v1"); err == nil {
+		t.Error("Deleting a tag used by a channel must fail")
+	}
+
+	got, err := r.CheckoutRef("app.bin", "stable")
+	if err != nil || !bytes.Equal(got, v1) {
+		t.Errorf("CheckoutRef(stable) failed: %v", err)
+	}
+
+	// 客户端持有 v1，升级到指向 v2 的通道
+	if err := r.SetChannel("stable", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	patches, err := r.DeltaTo("app.bin", repo.ObjectID(v1), "stable")
+	if err != nil {
+		t.Fatalf("DeltaTo failed: %v", err)
+	}
+	updated, err := core.Apply(v1, patches, nil)
+	if err != nil || !bytes.Equal(updated, v2) {
+		t.Errorf("Patch to channel does not reproduce v2: %v", err)
+	}
+	if patches, _ := r.DeltaTo("app.bin", repo.ObjectID(v2), "v2"); len(patches) != 0 {
+		t.Error("Client already at target must receive an empty patch")
+	}
+
+	if report, err := r.Fsck(false); err != nil || len(report.Problems) != 0 {
+		t.Errorf("Fsck reported problems: %v %v", report.Problems, err)
+	}
+}
+
+// TestChunkedDedup 测试分块存储使相似文件共享块
+func TestChunkedDedup(t *testing.T) {
+	dir := t.TempDir()
+	r, err := repo.Open(dir, &repo.Options{Chunking: true})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	asset := make([]byte, 256*1024)
+	for i := range asset {
+		asset[i] = byte((i * 31) ^ (i >> 7))
+	}
+	variant := append([]byte("variant header"), asset...)
+
+	if _, _, err := r.Commit("a/asset.bin", asset); err != nil {
+		t.Fatal(err)
+	}
+	version, _, err := r.Commit("b/asset.bin", variant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.Kind != types.OBJECT_CHUNKED {
+		t.Fatalf("Expected chunked object, got %s", version.Kind)
+	}
+
+	first, _ := r.Stats("a/asset.bin")
+	before := first.StoredSize
+	ids, _ := r.Store().List()
+	var total int64
+	for _, id := range ids {
+		size, _ := r.Store().Size(id)
+		total += size
+	}
+	if extra := total - before; extra >= int64(len(variant))/4 {
+		t.Errorf("Near-duplicate file added %d bytes, expected shared chunks", extra)
+	}
+
+	got, err := r.Checkout("b/asset.bin", -1)
+	if err != nil || !bytes.Equal(got, variant) {
+		t.Errorf("Checkout of chunked file failed: %v", err)
+	}
+	report, err := r.Fsck(false)
+	if err != nil || len(report.Problems) != 0 || len(report.Unreferenced) != 0 {
+		t.Errorf("Fsck: problems=%v unreferenced=%d err=%v", report.Problems, len(report.Unreferenced), err)
+	}
+}
@@ -0,0 +1,136 @@
+package rpc_test
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/config"
+	"bindiff/pkg/rpc"
+	"bindiff/types"
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startServer 以 TLS + HTTP/2 启动差分服务
+func startServer(t *testing.T, s *rpc.Server) *rpc.Client {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(s)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return &rpc.Client{URL: srv.URL, HTTPClient: srv.Client(), Token: s.Token}
+}
+
+// progressLog 记录收到的进度阶段
+type progressLog struct {
+	mu     sync.Mutex
+	stages map[string]bool
+}
+
+func (p *progressLog) Report(stage string, current, total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stages == nil {
+		p.stages = make(map[string]bool)
+	}
+	p.stages[stage] = true
+}
+
+// TestComputeAndApply 测试远程差分与应用的完整流程
+func TestComputeAndApply(t *testing.T) {
+	client := startServer(t, &rpc.Server{Config: config.DefaultConfig(), Token: "secret"})
+
+	rng := rand.New(rand.NewSource(1))
+	oldData := make([]byte, 300_000) // 大于单个消息分块
+	rng.Read(oldData)
+	newData := append(append([]byte{}, oldData[:100_000]...), []byte("inserted bytes")...)
+	newData = append(newData, oldData[100_000:]...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var progress progressLog
+	patch, err := client.ComputeDiff(ctx, oldData, newData, &progress)
+	if err != nil {
+		t.Fatalf("ComputeDiff failed: %v", err)
+	}
+	if len(patch) == 0 || len(patch) > len(newData) {
+		t.Fatalf("Unexpected patch size %d", len(patch))
+	}
+	if !progress.stages[core.ProgressStageDiff] {
+		t.Errorf("Expected %q progress, got %v", core.ProgressStageDiff, progress.stages)
+	}
+
+	got, err := client.ApplyPatch(ctx, oldData, patch, nil)
+	if err != nil {
+		t.Fatalf("ApplyPatch failed: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatal("Applied result mismatch")
+	}
+
+	// 旧文件与补丁不匹配
+	oldData[0] ^= 0xff
+	_, err = client.ApplyPatch(ctx, oldData, patch, nil)
+	var st *rpc.StatusError
+	if !errors.As(err, &st) || st.Code != rpc.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition, got %v", err)
+	}
+	_, err = client.ApplyPatch(ctx, oldData, []byte("not a patch"), nil)
+	if !errors.As(err, &st) || st.Code != rpc.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
+
+// TestComputeDiffHashAlgorithm 测试服务端按配置项 hash_algorithm 计算补丁的校验哈希
+func TestComputeDiffHashAlgorithm(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.HashAlgorithm = "blake3"
+	client := startServer(t, &rpc.Server{Config: cfg})
+
+	ctx := context.Background()
+	oldData := bytes.Repeat([]byte("configured hash "), 100)
+	newData := append([]byte("prefix "), oldData...)
+	patch, err := client.ComputeDiff(ctx, oldData, newData, nil)
+	if err != nil {
+		t.Fatalf("ComputeDiff failed: %v", err)
+	}
+	df, err := core.DecodeDiffFile(patch)
+	if err != nil {
+		t.Fatalf("DecodeDiffFile failed: %v", err)
+	}
+	if df.HashAlgorithm != types.HASH_BLAKE3 {
+		t.Errorf("HashAlgorithm = %d, want BLAKE3", df.HashAlgorithm)
+	}
+	got, err := client.ApplyPatch(ctx, oldData, patch, nil)
+	if err != nil || !bytes.Equal(got, newData) {
+		t.Errorf("ApplyPatch failed: %v", err)
+	}
+}
+
+// TestAuthAndLimits 测试认证、输入上限与截止时间
+func TestAuthAndLimits(t *testing.T) {
+	client := startServer(t, &rpc.Server{Token: "secret", MaxInputSize: 1000})
+	ctx := context.Background()
+	var st *rpc.StatusError
+
+	client.Token = "wrong"
+	if _, err := client.ComputeDiff(ctx, []byte("a"), []byte("b"), nil); !errors.As(err, &st) || st.Code != rpc.Unauthenticated {
+		t.Errorf("Expected Unauthenticated, got %v", err)
+	}
+
+	client.Token = "secret"
+	if _, err := client.ComputeDiff(ctx, make([]byte, 600), make([]byte, 600), nil); !errors.As(err, &st) || st.Code != rpc.ResourceExhausted {
+		t.Errorf("Expected ResourceExhausted, got %v", err)
+	}
+
+	// 服务端的截止时间短于处理时间
+	slow := startServer(t, &rpc.Server{MaxTimeout: time.Nanosecond})
+	if _, err := slow.ComputeDiff(ctx, []byte("old"), []byte("new"), nil); !errors.As(err, &st) ||
+		(st.Code != rpc.DeadlineExceeded && st.Code != rpc.Canceled) {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+package trace_test
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/jobs"
+	"bindiff/pkg/trace"
+	"bindiff/types"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder 在内存中收集跨度的导出器
+type recorder struct {
+	mu    sync.Mutex
+	spans []trace.SpanData
+}
+
+func (r *recorder) ExportSpans(spans []trace.SpanData) {
+	r.mu.Lock()
+	r.spans = append(r.spans, spans...)
+	r.mu.Unlock()
+}
+
+func (r *recorder) Shutdown(ctx context.Context) error { return nil }
+
+// byName 返回名为 name 的跨度
+func (r *recorder) byName(name string) (trace.SpanData, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.spans {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return trace.SpanData{}, false
+}
+
+// TestTraceparent 测试 traceparent 头的解析与编码
+func TestTraceparent(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := trace.ParseTraceparent(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sc.Sampled || sc.Traceparent() != tp {
+		t.Errorf("Round trip mismatch: %+v -> %s", sc, sc.Traceparent())
+	}
+	if _, err := trace.ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); err != nil {
+		t.Errorf("Future version should parse: %v", err)
+	}
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",
+	} {
+		if _, err := trace.ParseTraceparent(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+// TestSpans 测试父子关系、远程父跨度、采样标志与未启用追踪时的 nil 跨度
+func TestSpans(t *testing.T) {
+	if ctx, span := trace.Start(context.Background(), "noop"); span != nil || ctx != context.Background() {
+		t.Error("Expected nil span without a tracer")
+	}
+
+	rec := &recorder{}
+	ctx := trace.ContextWithTracer(context.Background(), trace.NewTracer(rec))
+	parent, _ := trace.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, root := trace.StartKind(trace.ContextWithRemoteParent(ctx, parent), "root", trace.KindServer)
+	_, child := trace.Start(ctx, "child", trace.Int64("n", 1))
+	child.RecordError(errors.New("boom"))
+	child.End()
+	child.End()
+	root.End()
+
+	if len(rec.spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(rec.spans))
+	}
+	r, _ := rec.byName("root")
+	c, _ := rec.byName("child")
+	if r.Context.TraceID != parent.TraceID || r.Parent != parent.SpanID || r.Kind != trace.KindServer {
+		t.Errorf("Root span not parented to the remote span: %+v", r)
+	}
+	if c.Context.TraceID != parent.TraceID || c.Parent != r.Context.SpanID || c.Err != "boom" {
+		t.Errorf("Child span mismatch: %+v", c)
+	}
+
+	h := http.Header{}
+	trace.Inject(ctx, h)
+	if got, _ := trace.ParseTraceparent(h.Get("traceparent")); got != r.Context {
+		t.Errorf("Injected %q, want root span context", h.Get("traceparent"))
+	}
+
+	unsampled := parent
+	unsampled.Sampled = false
+	uctx := trace.ContextWithRemoteParent(trace.ContextWithTracer(context.Background(), trace.NewTracer(rec)), unsampled)
+	if _, span := trace.Start(uctx, "skipped"); span != nil {
+		t.Error("Expected nil span for an unsampled parent")
+	}
+}
+
+// TestPipelineSpans 测试差分与应用流水线记录的阶段跨度
+func TestPipelineSpans(t *testing.T) {
+	rec := &recorder{}
+	ctx := trace.ContextWithTracer(context.Background(), trace.NewTracer(rec))
+	oldData := bytes.Repeat([]byte("0123456789"), 1000)
+	newData := append([]byte("prefix"), oldData...)
+
+	format, result, payload, err := core.DiffPayload(oldData, newData, &core.DiffOptions{Context: ctx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"diff", "align", "match"} {
+		if _, ok := rec.byName(name); !ok {
+			t.Errorf("Missing %q span", name)
+		}
+	}
+	diff, _ := rec.byName("diff")
+	if match, _ := rec.byName("match"); match.Parent != diff.Context.SpanID {
+		t.Error("match span should be a child of the diff span")
+	}
+
+	df := core.EncodeDiffFile(types.DiffFile{
+		MagicNumber:   types.PATCH_MAGIC,
+		Version:       types.PATCH_VERSION,
+		HashAlgorithm: types.HASH_SHA256,
+		Format:        format,
+		OldSize:       uint32(len(oldData)),
+		NewSize:       uint32(len(newData)),
+		OldHash:       core.ComputeHash(oldData),
+		NewHash:       core.ComputeHash(newData),
+		Offset:        result.Offset,
+		Diff:          result.Patches,
+		Payload:       payload,
+	})
+	decoded, _ := core.DecodeDiffFile(df)
+	if _, err := core.ApplyDiffFile(oldData, decoded, &core.ApplyOptions{Context: ctx}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.byName("apply"); !ok {
+		t.Error("Missing apply span")
+	}
+}
+
+// TestJobTrace 测试 REST 提交请求的 traceparent 成为任务跨度的父跨度
+func TestJobTrace(t *testing.T) {
+	rec := &recorder{}
+	q, err := jobs.Open(t.TempDir(), jobs.Options{Tracer: trace.NewTracer(rec)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	srv := httptest.NewServer(&jobs.Handler{Queue: q})
+	defer srv.Close()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, data := range map[string]string{"old": "hello world", "new": "hello there world"} {
+		w, _ := mw.CreateFormFile(name, name)
+		io.WriteString(w, data)
+	}
+	mw.Close()
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/v1/jobs/diff", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("traceparent", tp)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job jobs.Job
+	json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if job.TraceParent != tp {
+		t.Errorf("Job trace_parent = %q", job.TraceParent)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		j, _ := q.Get(job.ID)
+		if j.Status == jobs.StatusSucceeded || j.Status == jobs.StatusFailed || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	root, ok := rec.byName("job diff")
+	if !ok {
+		t.Fatal("Missing job span")
+	}
+	parent, _ := trace.ParseTraceparent(tp)
+	if root.Context.TraceID != parent.TraceID || root.Parent != parent.SpanID {
+		t.Errorf("Job span not parented to the submit request: %+v", root)
+	}
+	for _, name := range []string{"read", "diff", "encode", "write"} {
+		if s, ok := rec.byName(name); !ok || s.Context.TraceID != parent.TraceID {
+			t.Errorf("Missing %q span in the job trace", name)
+		}
+	}
+}
+
+// TestOTLPExporter 测试 OTLP/HTTP JSON 导出
+func TestOTLPExporter(t *testing.T) {
+	var mu sync.Mutex
+	var got map[string]interface{}
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	exp := trace.NewOTLPExporter(trace.OTLPOptions{
+		Endpoint:    srv.URL + "/v1/traces",
+		ServiceName: "bindiff-test",
+		Headers:     map[string]string{"Authorization": "Bearer x"},
+		OnError:     func(err error) { t.Error(err) },
+	})
+	tracer := trace.NewTracer(exp)
+	ctx := trace.ContextWithTracer(context.Background(), tracer)
+	ctx, root := trace.Start(ctx, "root", trace.String("s", "v"), trace.Bool("b", true))
+	_, child := trace.Start(ctx, "child", trace.Int64("n", 42))
+	child.RecordError(errors.New("failed"))
+	child.End()
+	root.End()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if auth != "Bearer x" {
+		t.Errorf("Missing configured header, got %q", auth)
+	}
+	data, _ := json.Marshal(got)
+	for _, want := range []string{
+		`"stringValue":"bindiff-test"`,
+		`"name":"child"`,
+		`"intValue":"42"`,
+		`"boolValue":true`,
+		`"status":{"code":2,"message":"failed"}`,
+		`"traceId":"` + root.SpanContext().Traceparent()[3:35] + `"`,
+		`"parentSpanId":"`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Export missing %s:\n%s", want, data)
+		}
+	}
+}
+
+// TestEndpointFromEnv 测试按 OpenTelemetry 环境变量确定导出地址
+func TestEndpointFromEnv(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318/")
+	if got := trace.EndpointFromEnv(); got != "http://collector:4318/v1/traces" {
+		t.Errorf("EndpointFromEnv = %q", got)
+	}
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://tempo/otlp")
+	if got := trace.EndpointFromEnv(); got != "http://tempo/otlp" {
+		t.Errorf("EndpointFromEnv = %q", got)
+	}
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key=abc, x-tenant = t1")
+	if h := trace.HeadersFromEnv(); h["api-key"] != "abc" || h["x-tenant"] != "t1" {
+		t.Errorf("HeadersFromEnv = %v", h)
+	}
+}
@@ -0,0 +1,91 @@
+package update_test
+
+import (
+	"bindiff/core"
+	"bindiff/pkg/update"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSelfUpdate 从 HTTP 下载签名补丁并替换目标文件
+func TestSelfUpdate(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	oldExe := make([]byte, 64*1024)
+	rng.Read(oldExe)
+
+	b := core.NewPatchBuilder(oldExe)
+	if err := b.AppendReplace(4096, []byte("v2 code")); err != nil {
+		t.Fatal(err)
+	}
+	df, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch := core.EncodeDiffFile(df)
+	newExe, err := core.ApplyDiffFile(oldExe, df, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rng)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := base64.StdEncoding.EncodeToString(update.Sign(priv, patch)) + "\n"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app.bdf", func(w http.ResponseWriter, r *http.Request) { w.Write(patch) })
+	mux.HandleFunc("/app.bdf.sig", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(sig)) })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	target := filepath.Join(t.TempDir(), "app")
+	if err := os.WriteFile(target, oldExe, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// 其他公钥签名的补丁被拒绝，文件保持不变
+	otherPub, _, _ := ed25519.GenerateKey(rng)
+	_, err = update.Apply(context.Background(), srv.URL+"/app.bdf", &update.Options{PublicKey: otherPub, TargetPath: target})
+	if !errors.Is(err, update.ErrSignature) {
+		t.Errorf("Expected ErrSignature for the wrong key, got %v", err)
+	}
+
+	key, err := update.ParsePublicKey(base64.StdEncoding.EncodeToString(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := update.Apply(context.Background(), srv.URL+"/app.bdf", &update.Options{PublicKey: key, TargetPath: target})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if res.Path != target || res.PatchSize != int64(len(patch)) || res.NewSize != int64(len(newExe)) {
+		t.Errorf("Unexpected result %+v", res)
+	}
+	got, _ := os.ReadFile(target)
+	if !bytes.Equal(got, newExe) {
+		t.Error("Target not updated")
+	}
+	if info, _ := os.Stat(target); info.Mode().Perm() != 0755 {
+		t.Errorf("Mode not preserved: %v", info.Mode())
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(target)); len(entries) != 1 {
+		t.Errorf("Temporary files left behind: %d entries", len(entries))
+	}
+
+	// 已更新的文件不再匹配补丁的旧文件哈希
+	if _, err := update.ApplyPatch(patch, update.Sign(priv, patch), &update.Options{PublicKey: pub, TargetPath: target}); !errors.Is(err, update.ErrNotApplicable) {
+		t.Errorf("Expected ErrNotApplicable after update, got %v", err)
+	}
+	if _, err := update.Apply(context.Background(), srv.URL+"/missing.bdf", &update.Options{PublicKey: pub, TargetPath: target}); err == nil {
+		t.Error("Expected error for a missing patch")
+	}
+}
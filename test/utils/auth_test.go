@@ -0,0 +1,33 @@
+package utils_test
+
+import (
+	"bindiff/pkg/utils"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestBearerAuthorized 测试 bearer 令牌检查，令牌为空时不要求认证
+func TestBearerAuthorized(t *testing.T) {
+	tests := []struct {
+		header, token string
+		want          bool
+	}{
+		{"Bearer secret", "secret", true},
+		{"Bearer wrong", "secret", false},
+		{"Bearer secret2", "secret", false},
+		{"secret", "secret", false},
+		{"Basic secret", "secret", false},
+		{"", "secret", false},
+		{"", "", true},
+		{"Bearer anything", "", true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		if got := utils.BearerAuthorized(r, tt.token); got != tt.want {
+			t.Errorf("BearerAuthorized(%q, %q) = %v, want %v", tt.header, tt.token, got, tt.want)
+		}
+	}
+}
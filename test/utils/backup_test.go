@@ -0,0 +1,95 @@
+package utils_test
+
+import (
+	"bindiff/pkg/utils"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// writeBackup 以指定时间创建一个备份文件
+func writeBackup(t *testing.T, file string, at time.Time, content string) string {
+	t.Helper()
+	path := file + ".backup." + at.Format("20060102-150405")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBackupFileAndRestore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.bin")
+	if err := os.WriteFile(file, []byte("v1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	first, err := utils.BackupFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同一秒内的第二个备份不覆盖第一个
+	second, err := utils.BackupFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatalf("two backups share the name %s", first)
+	}
+
+	backups, err := utils.ListBackups(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 || backups[0].Path != second || backups[1].Path != first {
+		t.Fatalf("unexpected backups: %+v", backups)
+	}
+
+	if err := os.WriteFile(file, []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.RestoreBackup(first, file); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(file); string(got) != "v1" {
+		t.Errorf("restored content = %q, want v1", got)
+	}
+	if info, _ := os.Stat(file); runtime.GOOS != "windows" && info.Mode().Perm() != 0755 {
+		t.Errorf("restored mode = %v, want 0755", info.Mode().Perm())
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.bin")
+	now := time.Now()
+	var paths []string
+	for _, age := range []time.Duration{time.Hour, 2 * time.Hour, 48 * time.Hour, 96 * time.Hour} {
+		paths = append(paths, writeBackup(t, file, now.Add(-age), "old"))
+	}
+	// 其他文件的备份与非备份文件不受影响
+	other := writeBackup(t, filepath.Join(filepath.Dir(file), "other.bin"), now.Add(-96*time.Hour), "x")
+
+	removed, err := utils.PruneBackups(file, 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != paths[3] {
+		t.Errorf("keep=3 removed %v, want %v", removed, paths[3:])
+	}
+
+	removed, err = utils.PruneBackups(file, 0, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != paths[2] {
+		t.Errorf("max age removed %v, want %v", removed, paths[2:3])
+	}
+
+	backups, _ := utils.ListBackups(file)
+	if len(backups) != 2 {
+		t.Errorf("expected 2 backups left, got %d", len(backups))
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("backup of another file was removed: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package utils_test
+
+import (
+	"bindiff/pkg/utils"
+	"bytes"
+	"io"
+	"testing"
+)
+
+// TestOpenInput 测试各种 IO 提示下读出的内容与文件一致
+func TestOpenInput(t *testing.T) {
+	data := make([]byte, 300*1024+123)
+	for i := range data {
+		data[i] = byte(i*17 + i>>12)
+	}
+	path := writeFile(t, data)
+
+	for _, hints := range []utils.IOHints{
+		{},
+		{BufferSize: 1000, Sequential: true, DropCache: true},
+		{Direct: true, DropCache: true},
+		{Direct: true, BufferSize: 5000},
+	} {
+		in, err := utils.OpenInput(path, hints)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 未对齐的偏移量与长度，包括跨越文件末尾
+		for _, r := range [][2]int{{0, 10}, {4095, 4099}, {12345, 100000}, {len(data) - 50, 50}} {
+			buf := make([]byte, r[1])
+			n, err := in.ReadAt(buf, int64(r[0]))
+			if err != nil || !bytes.Equal(buf[:n], data[r[0]:r[0]+r[1]]) {
+				t.Errorf("%+v: ReadAt(%d, %d) = %d, %v", hints, r[0], r[1], n, err)
+			}
+		}
+		buf := make([]byte, 100)
+		if n, err := in.ReadAt(buf, int64(len(data)-40)); n != 40 || err != io.EOF {
+			t.Errorf("%+v: ReadAt past the end = %d, %v; want 40, EOF", hints, n, err)
+		}
+
+		got, err := io.ReadAll(in)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%+v: sequential read returned %d bytes, %v", hints, len(got), err)
+		}
+		if err := in.Close(); err != nil {
+			t.Error(err)
+		}
+
+		got, err = utils.ReadFileHinted(path, hints)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%+v: ReadFileHinted returned %d bytes, %v", hints, len(got), err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package utils_test
+
+import (
+	"bindiff/pkg/utils"
+	"bindiff/types"
+	"bytes"
+	"testing"
+)
+
+// TestBackgroundHashing 测试后台哈希与同步计算的结果一致
+func TestBackgroundHashing(t *testing.T) {
+	data := make([]byte, 3<<20+12345)
+	for i := range data {
+		data[i] = byte(i*31 + i>>11)
+	}
+
+	for _, algo := range []types.HashAlgorithm{types.HASH_SHA256, types.HASH_BLAKE3, types.HASH_XXHASH64} {
+		want, err := utils.ComputeHashWith(algo, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := utils.HashAsync(algo, data).Wait()
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("HashAsync(%s) = %x, %v; want %x", utils.HashAlgorithmName(algo), got, err, want)
+		}
+
+		w, err := utils.NewHashWriter(algo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 写入大小不一，跨越缓冲区边界
+		for rest, n := data, 1; len(rest) > 0; n = n*3 + 1 {
+			n = min(n, len(rest))
+			w.Write(rest[:n])
+			rest = rest[n:]
+		}
+		if got := w.Sum(); !bytes.Equal(got, want) {
+			t.Errorf("HashWriter(%s) = %x, want %x", utils.HashAlgorithmName(algo), got, want)
+		}
+		w.Close()
+	}
+
+	if _, err := utils.HashAsync(types.HashAlgorithm(99), data).Wait(); err == nil {
+		t.Error("Expected an error for an unknown algorithm")
+	}
+	empty, _ := utils.NewHashWriter(types.HASH_SHA256)
+	if want, _ := utils.ComputeHashWith(types.HASH_SHA256, nil); !bytes.Equal(empty.Sum(), want) {
+		t.Error("HashWriter without writes should hash empty input")
+	}
+}
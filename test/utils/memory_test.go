@@ -0,0 +1,29 @@
+package utils_test
+
+import (
+	"bindiff/pkg/utils"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestTrackMemory(t *testing.T) {
+	tracker := utils.TrackMemory(time.Millisecond)
+	buf := make([]byte, 64<<20)
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	runtime.KeepAlive(buf)
+
+	peak := tracker.Stop()
+	if peak.HeapBytes < uint64(len(buf)) {
+		t.Errorf("peak heap %d does not include the %d byte allocation", peak.HeapBytes, len(buf))
+	}
+	if peak.RSSBytes == 0 {
+		t.Error("no RSS reported")
+	}
+	if again := tracker.Stop(); again != peak {
+		t.Errorf("second Stop = %+v, want %+v", again, peak)
+	}
+}
@@ -0,0 +1,77 @@
+package utils_test
+
+import (
+	"bindiff/pkg/utils"
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// writeFile 在临时目录写入测试文件
+func writeFile(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestMapFile 测试映射内容、写时复制与小文件回退
+func TestMapFile(t *testing.T) {
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	path := writeFile(t, data)
+
+	m, err := utils.MapFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (runtime.GOOS != "js" && runtime.GOOS != "wasip1") != m.Mapped() {
+		t.Errorf("Mapped() = %v on %s", m.Mapped(), runtime.GOOS)
+	}
+	if !bytes.Equal(m.Bytes(), data) {
+		t.Fatal("Mapped content differs from the file")
+	}
+
+	// 修改映射不影响文件
+	m.Bytes()[0] ^= 0xff
+	onDisk, _ := os.ReadFile(path)
+	if onDisk[0] != data[0] {
+		t.Error("Write to a private mapping reached the file")
+	}
+
+	inside := m.Detach(m.Bytes()[10:20])
+	outside := []byte("x")
+	if &m.Detach(outside)[0] != &outside[0] {
+		t.Error("Detach copied a slice outside the mapping")
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(inside, data[10:20]) {
+		t.Error("Detached slice lost its content")
+	}
+	if m.Close() != nil || m.Bytes() != nil {
+		t.Error("Close should be idempotent")
+	}
+
+	for _, size := range []int{0, 100} {
+		small, err := utils.MapFile(writeFile(t, data[:size]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if small.Mapped() || len(small.Bytes()) != size {
+			t.Errorf("Expected a %d-byte file to be read, got mapped=%v len=%d", size, small.Mapped(), len(small.Bytes()))
+		}
+		small.Close()
+	}
+
+	if _, err := utils.MapFile(filepath.Join(t.TempDir(), "missing")); !os.IsNotExist(err) {
+		t.Errorf("Expected not-exist error, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package utils_test
+
+import (
+	"bindiff/pkg/utils"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRemovePartialFiles 测试中断时只删除仍在写入的文件
+func TestRemovePartialFiles(t *testing.T) {
+	dir := t.TempDir()
+	writing := filepath.Join(dir, "patch.bdf.tmp")
+	finished := filepath.Join(dir, "bundle.tar")
+	for _, p := range []string{writing, finished} {
+		if err := os.WriteFile(p, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	utils.TrackPartial(writing)
+	done := utils.TrackPartial(finished)
+	done()
+	done() // 重复调用无效
+
+	removed := utils.RemovePartialFiles()
+	if len(removed) != 1 || removed[0] != writing {
+		t.Errorf("RemovePartialFiles = %v, want [%s]", removed, writing)
+	}
+	if _, err := os.Stat(writing); !os.IsNotExist(err) {
+		t.Error("partial file was not removed")
+	}
+	if _, err := os.Stat(finished); err != nil {
+		t.Errorf("finished file was removed: %v", err)
+	}
+	if removed := utils.RemovePartialFiles(); len(removed) != 0 {
+		t.Errorf("second RemovePartialFiles = %v, want none", removed)
+	}
+}
+
+// TestSafeWriteUntracksTempFile 测试 SafeWrite 完成后临时文件不再登记
+func TestSafeWriteUntracksTempFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.bin")
+	if err := utils.SafeWrite(path, []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if removed := utils.RemovePartialFiles(); len(removed) != 0 {
+		t.Errorf("RemovePartialFiles after SafeWrite = %v, want none", removed)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("output removed: %v", err)
+	}
+}
@@ -0,0 +1,19 @@
+package utils_test
+
+import (
+	"bindiff/pkg/progress"
+	"bindiff/pkg/utils"
+	"testing"
+)
+
+// TestDeprecatedProgressBar 测试 utils 中保留的进度条转发到 pkg/progress
+func TestDeprecatedProgressBar(t *testing.T) {
+	var bar *progress.ProgressBar = utils.NewProgressBar(100, "test", false)
+	if bar == nil {
+		t.Fatal("NewProgressBar returned nil")
+	}
+	// 禁用的进度条不输出，调用不应出错
+	bar.Add(10)
+	bar.Set(50)
+	bar.Finish()
+}
@@ -0,0 +1,92 @@
+package utils_test
+
+import (
+	"bindiff/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fastRetry 测试用的短等待
+var fastRetry = utils.RetryOptions{Attempts: 4, Delay: time.Millisecond}
+
+func TestRetryWithContextRetriesTransientErrors(t *testing.T) {
+	calls := 0
+	var waits []time.Duration
+	opts := fastRetry
+	opts.OnRetry = func(attempt int, err error, wait time.Duration) { waits = append(waits, wait) }
+	err := utils.RetryWithContext(context.Background(), opts, func(context.Context) error {
+		if calls++; calls < 3 {
+			return fmt.Errorf("read: %w", syscall.ECONNRESET)
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("RetryWithContext = %v after %d calls, want success after 3", err, calls)
+	}
+	// 等待在退避值的一半到全部之间
+	if len(waits) != 2 || waits[0] < 500*time.Microsecond || waits[0] > time.Millisecond || waits[1] > 2*time.Millisecond {
+		t.Errorf("unexpected waits %v", waits)
+	}
+}
+
+func TestRetryWithContextStopsOnPermanentError(t *testing.T) {
+	calls := 0
+	boom := errors.New("checksum mismatch")
+	err := utils.RetryWithContext(context.Background(), fastRetry, func(context.Context) error {
+		calls++
+		return boom
+	})
+	if err != boom || calls != 1 {
+		t.Errorf("RetryWithContext = %v after %d calls, want the error unchanged after 1", err, calls)
+	}
+}
+
+func TestRetryWithContextGivesUp(t *testing.T) {
+	calls := 0
+	err := utils.RetryWithContext(context.Background(), fastRetry, func(context.Context) error {
+		calls++
+		return &utils.StatusError{Method: "GET", URL: "http://x", StatusCode: 503, Status: "503 Service Unavailable"}
+	})
+	var status *utils.StatusError
+	if calls != 4 || !errors.As(err, &status) {
+		t.Errorf("RetryWithContext = %v after %d calls, want the last StatusError after 4", err, calls)
+	}
+}
+
+func TestRetryWithContextHonoursCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Now()
+	time.AfterFunc(10*time.Millisecond, cancel)
+	err := utils.RetryWithContext(ctx, utils.RetryOptions{Attempts: 10, Delay: time.Hour}, func(context.Context) error {
+		return io.ErrUnexpectedEOF
+	})
+	if !errors.Is(err, context.Canceled) || time.Since(start) > time.Second {
+		t.Errorf("RetryWithContext = %v after %v, want a prompt context.Canceled", err, time.Since(start))
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		want bool
+	}{
+		{&utils.StatusError{StatusCode: 503}, true},
+		{&utils.StatusError{StatusCode: 429}, true},
+		{&utils.StatusError{StatusCode: 404}, false},
+		{&utils.StatusError{StatusCode: 501}, false},
+		{fmt.Errorf("body: %w", io.ErrUnexpectedEOF), true},
+		{fmt.Errorf("dial: %w", syscall.ECONNREFUSED), true},
+		{utils.Permanent(syscall.ECONNREFUSED), false},
+		{context.Canceled, false},
+		{errors.New("invalid index"), false},
+	} {
+		if got := utils.IsTransient(c.err); got != c.want {
+			t.Errorf("IsTransient(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package utils_test
+
+import (
+	"bindiff/pkg/utils"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSafeWriteDurable(t *testing.T) {
+	for _, durable := range []bool{true, false} {
+		utils.SetDurableWrites(durable)
+		path := filepath.Join(t.TempDir(), "sub", "patch.bdf")
+		data := bytes.Repeat([]byte("bindiff"), 1000)
+		if err := utils.SafeWrite(path, data); err != nil {
+			t.Fatalf("SafeWrite (durable=%t): %v", durable, err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("durable=%t: content mismatch (%v)", durable, err)
+		}
+		if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+			t.Errorf("durable=%t: temp file left behind", durable)
+		}
+	}
+	utils.SetDurableWrites(true)
+}
+
+func TestSafeWriteFuncKeepsOldFileOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.bin")
+	if err := utils.SafeWrite(path, []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	boom := errors.New("boom")
+	err := utils.SafeWriteFunc(path, func(w io.Writer) error {
+		w.Write([]byte("partial"))
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("SafeWriteFunc = %v, want boom", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "old" {
+		t.Errorf("existing file was replaced: %q", got)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("temp file left behind")
+	}
+}
+
+func TestSyncDir(t *testing.T) {
+	if err := utils.SyncDir(t.TempDir()); err != nil {
+		t.Errorf("SyncDir: %v", err)
+	}
+	if err := utils.SyncDir(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
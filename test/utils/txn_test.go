@@ -0,0 +1,165 @@
+package utils_test
+
+import (
+	"bindiff/pkg/utils"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// listTree 返回 dir 下全部文件的相对路径（已排序）
+func listTree(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestTransactionCommit(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "a.bin")
+	if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	txn := utils.NewTransaction(dir)
+	if err := txn.Write(existing, []byte("new a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Write(filepath.Join(dir, "sub", "b.bin"), []byte("new b")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(existing); string(got) != "old" {
+		t.Fatalf("target replaced before commit: %q", got)
+	}
+	// ReadFile 读取暂存的内容
+	if got, err := txn.ReadFile(existing); err != nil || string(got) != "new a" {
+		t.Errorf("ReadFile before commit = %q, %v", got, err)
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if got, err := txn.ReadFile(existing); err != nil || string(got) != "new a" {
+		t.Errorf("ReadFile after commit = %q, %v", got, err)
+	}
+
+	if got, _ := os.ReadFile(existing); string(got) != "new a" {
+		t.Errorf("a.bin = %q", got)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "sub", "b.bin")); string(got) != "new b" {
+		t.Errorf("sub/b.bin = %q", got)
+	}
+	if files := listTree(t, dir); len(files) != 2 {
+		t.Errorf("leftover files after commit: %v", files)
+	}
+	if err := txn.Commit(); !errors.Is(err, utils.ErrTransactionDone) {
+		t.Errorf("second Commit = %v, want ErrTransactionDone", err)
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "a.bin")
+	if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	txn := utils.NewTransaction(dir)
+	txn.Write(existing, []byte("new"))
+	txn.Write(filepath.Join(dir, "b.bin"), []byte("new"))
+	boom := errors.New("boom")
+	err := txn.WriteFunc(filepath.Join(dir, "c.bin"), func(w io.Writer) error {
+		w.Write([]byte("partial"))
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("WriteFunc = %v, want boom", err)
+	}
+	if txn.Len() != 2 {
+		t.Errorf("Len = %d, want 2", txn.Len())
+	}
+	if err := txn.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := os.ReadFile(existing); string(got) != "old" {
+		t.Errorf("a.bin = %q after rollback", got)
+	}
+	if files := listTree(t, dir); len(files) != 1 || files[0] != "a.bin" {
+		t.Errorf("files after rollback: %v", files)
+	}
+}
+
+func TestTransactionCommitFailureRollsBack(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.bin")
+	if err := os.WriteFile(first, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	txn := utils.NewTransaction(dir)
+	txn.Write(first, []byte("new"))
+	txn.Write(filepath.Join(dir, "b.bin"), []byte("new"))
+	txn.Write(filepath.Join(dir, "c.bin"), []byte("new"))
+	// 删除最后一个文件的临时文件，使提交在替换前两个文件之后失败
+	temps, _ := filepath.Glob(filepath.Join(dir, "c.bin.*.tmp"))
+	if len(temps) != 1 {
+		t.Fatalf("expected one staged temp file for c.bin, got %v", temps)
+	}
+	os.Remove(temps[0])
+	if err := txn.Commit(); err == nil {
+		t.Fatal("Commit succeeded without a staged file")
+	}
+
+	if got, _ := os.ReadFile(first); string(got) != "old" {
+		t.Errorf("a.bin = %q, want the original content", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.bin")); !os.IsNotExist(err) {
+		t.Error("new file b.bin was not removed")
+	}
+	if files := listTree(t, dir); len(files) != 1 || files[0] != "a.bin" {
+		t.Errorf("leftover files: %v", files)
+	}
+}
+
+func TestRecoverTransactions(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "a.bin")
+	// 模拟提交中途退出：原文件已移到备份，新内容已就位
+	os.WriteFile(target+".txn-1.old", []byte("old"), 0644)
+	os.WriteFile(target, []byte("new"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.bin.txn-1.tmp"), []byte("new"), 0644)
+	journal := `{"id":"1","committed":false,"entries":[` +
+		`{"target":"` + filepath.ToSlash(target) + `","temp":"` + filepath.ToSlash(target) + `.txn-1.tmp","backup":"` + filepath.ToSlash(target) + `.txn-1.old","existed":true},` +
+		`{"target":"` + filepath.ToSlash(filepath.Join(dir, "b.bin")) + `","temp":"` + filepath.ToSlash(filepath.Join(dir, "b.bin.txn-1.tmp")) + `","backup":"` + filepath.ToSlash(filepath.Join(dir, "b.bin.txn-1.old")) + `","existed":false}]}`
+	os.WriteFile(filepath.Join(dir, ".txn-1.journal"), []byte(journal), 0644)
+
+	n, err := utils.RecoverTransactions(dir)
+	if err != nil || n != 1 {
+		t.Fatalf("RecoverTransactions = %d, %v", n, err)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "old" {
+		t.Errorf("a.bin = %q, want the original content", got)
+	}
+	if files := listTree(t, dir); len(files) != 1 || files[0] != "a.bin" {
+		t.Errorf("leftover files after recovery: %v", files)
+	}
+
+	if n, err := utils.RecoverTransactions(filepath.Join(dir, "missing")); n != 0 || err != nil {
+		t.Errorf("RecoverTransactions on a missing dir = %d, %v", n, err)
+	}
+}
@@ -0,0 +1,193 @@
+package webhook_test
+
+import (
+	"bindiff/pkg/jobs"
+	"bindiff/pkg/webhook"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver 记录收到的事件并校验签名
+type receiver struct {
+	t      *testing.T
+	secret string
+	// fail 前 fail 次请求返回 500
+	fail int
+
+	mu     sync.Mutex
+	calls  int
+	events []webhook.Event
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.calls++
+	if rc.calls <= rc.fail {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if rc.secret == "" {
+		if r.Header.Get(webhook.HeaderSignature) != "" {
+			rc.t.Error("Unexpected signature without a secret")
+		}
+	} else if err := webhook.Verify([]byte(rc.secret), r.Header.Get(webhook.HeaderTimestamp), r.Header.Get(webhook.HeaderSignature), body, time.Minute); err != nil {
+		rc.t.Errorf("Signature check failed: %v", err)
+	}
+	var e webhook.Event
+	if err := json.Unmarshal(body, &e); err != nil {
+		rc.t.Errorf("Bad event body: %v", err)
+	}
+	if r.Header.Get(webhook.HeaderEvent) != e.Type || r.Header.Get(webhook.HeaderDelivery) != e.ID {
+		rc.t.Errorf("Headers do not match the event: %v", r.Header)
+	}
+	rc.events = append(rc.events, e)
+}
+
+// types 返回按顺序收到的事件类型
+func (rc *receiver) types() []string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	var types []string
+	for _, e := range rc.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+// TestDelivery 测试签名、重试与事件过滤
+func TestDelivery(t *testing.T) {
+	rc := &receiver{t: t, secret: "s3cret", fail: 2}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	n := webhook.New(webhook.Options{
+		URLs:       []string{srv.URL},
+		Secret:     rc.secret,
+		Events:     []string{webhook.EventCompleted, webhook.EventFailed},
+		RetryDelay: time.Millisecond,
+	})
+	n.Send(webhook.Event{Type: webhook.EventStarted, JobID: "j1"})
+	n.Send(webhook.Event{Type: webhook.EventCompleted, JobID: "j1", Kind: "diff", PatchSize: 42})
+	if err := n.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := rc.types(); len(got) != 1 || got[0] != webhook.EventCompleted {
+		t.Fatalf("Received %v, want only job.completed", got)
+	}
+	if rc.calls != 3 {
+		t.Errorf("Expected 2 retries, got %d calls", rc.calls)
+	}
+	if e := rc.events[0]; e.ID == "" || e.Time.IsZero() || e.PatchSize != 42 {
+		t.Errorf("Event not filled in: %+v", e)
+	}
+
+	var nilNotifier *webhook.Notifier
+	nilNotifier.Send(webhook.Event{Type: webhook.EventQueued})
+	if webhook.New(webhook.Options{}) != nil || nilNotifier.Close(context.Background()) != nil {
+		t.Error("Expected a nil notifier without URLs")
+	}
+}
+
+// TestVerify 测试签名校验与时间戳检查
+func TestVerify(t *testing.T) {
+	secret := []byte("key")
+	body := []byte(`{"type":"job.failed"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	sig := webhook.Sign(secret, now, body)
+
+	if err := webhook.Verify(secret, now, sig, body, time.Minute); err != nil {
+		t.Errorf("Valid signature rejected: %v", err)
+	}
+	if err := webhook.Verify(secret, now, sig, []byte(`{}`), time.Minute); !errors.Is(err, webhook.ErrSignature) {
+		t.Errorf("Expected ErrSignature for a modified body, got %v", err)
+	}
+	if err := webhook.Verify([]byte("other"), now, sig, body, 0); !errors.Is(err, webhook.ErrSignature) {
+		t.Errorf("Expected ErrSignature for another secret, got %v", err)
+	}
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	if err := webhook.Verify(secret, old, webhook.Sign(secret, old, body), body, time.Minute); !errors.Is(err, webhook.ErrExpired) {
+		t.Errorf("Expected ErrExpired, got %v", err)
+	}
+}
+
+// TestJobEvents 测试任务队列发送的生命周期事件
+func TestJobEvents(t *testing.T) {
+	rc := &receiver{t: t}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	n := webhook.New(webhook.Options{URLs: []string{srv.URL}, RetryDelay: time.Millisecond})
+
+	q, err := jobs.Open(t.TempDir(), jobs.Options{Webhooks: n})
+	if err != nil {
+		t.Fatal(err)
+	}
+	submit := func(kind string, files map[string]string) string {
+		t.Helper()
+		u, err := q.NewUpload(kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, data := range files {
+			if err := u.Add(name, strings.NewReader(data), 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		job, err := u.Submit()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return job.ID
+	}
+	ok := submit(jobs.KindDiff, map[string]string{"old": "hello world", "new": "hello there world"})
+	bad := submit(jobs.KindApply, map[string]string{"old": "hello", "patch": "not a patch"})
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		a, _ := q.Get(ok)
+		b, _ := q.Get(bad)
+		if a.Finished != nil && b.Finished != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	q.Close()
+	n.Close(context.Background())
+
+	byJob := map[string][]webhook.Event{}
+	for _, e := range rc.events {
+		byJob[e.JobID] = append(byJob[e.JobID], e)
+	}
+	want := map[string][]string{
+		ok:  {webhook.EventQueued, webhook.EventStarted, webhook.EventCompleted},
+		bad: {webhook.EventQueued, webhook.EventStarted, webhook.EventFailed},
+	}
+	for id, types := range want {
+		events := byJob[id]
+		if len(events) != len(types) {
+			t.Fatalf("Job %s: got %d events, want %v", id, len(events), types)
+		}
+		for i, e := range events {
+			if e.Type != types[i] || e.Source != "rest" {
+				t.Errorf("Job %s event %d = %s/%s, want %s", id, i, e.Type, e.Source, types[i])
+			}
+		}
+	}
+	if done := byJob[ok][2]; done.Kind != jobs.KindDiff || done.PatchSize == 0 || done.PatchSize != done.ResultSize {
+		t.Errorf("Completed event missing patch size: %+v", done)
+	}
+	if failed := byJob[bad][2]; failed.Error == "" || failed.DurationSeconds < 0 {
+		t.Errorf("Failed event missing error: %+v", failed)
+	}
+}
@@ -0,0 +1,192 @@
+package zchunk_test
+
+import (
+	"bindiff/pkg/storage"
+	"bindiff/pkg/zchunk"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// publish 把 data 发布到临时目录并以 HTTP 提供，返回清单、服务器与块请求计数
+func publish(t *testing.T, data []byte) (*zchunk.Manifest, *httptest.Server, *int64) {
+	t.Helper()
+	dir := t.TempDir()
+	m, stats, err := zchunk.Build(context.Background(), data, "app.bin", storage.NewFS(filepath.Join(dir, "chunks")), nil)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if stats.Uploaded == 0 || stats.Existing != 0 {
+		t.Errorf("Unexpected build stats: %+v", stats)
+	}
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "app.bin.zck.json"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := new(int64)
+	files := http.FileServer(http.Dir(dir))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/chunks/") {
+			atomic.AddInt64(requests, 1)
+			if r.Header.Get("Range") != "" {
+				t.Errorf("Unexpected Range request for %s", r.URL.Path)
+			}
+		}
+		files.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return m, srv, requests
+}
+
+// fetch 通过 HTTP 读取清单并重建
+func fetch(t *testing.T, srv *httptest.Server, seed []byte) ([]byte, *zchunk.Stats, error) {
+	t.Helper()
+	resp, err := http.Get(srv.URL + "/app.bin.zck.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	m, err := zchunk.ReadManifest(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadManifest failed: %v", err)
+	}
+	base, err := m.BaseURL(srv.URL + "/app.bin.zck.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zchunk.Fetch(context.Background(), m, base, seed, &zchunk.FetchOptions{Concurrency: 3})
+}
+
+// TestFetchReusesChunks 测试只下载本地缺少的块
+func TestFetchReusesChunks(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	oldData := make([]byte, 256<<10)
+	r.Read(oldData)
+	newData := append([]byte{}, oldData[:100<<10]...)
+	newData = append(newData, bytes.Repeat([]byte("inserted"), 512)...)
+	newData = append(newData, oldData[100<<10:]...)
+
+	m, srv, requests := publish(t, newData)
+	out, stats, err := fetch(t, srv, oldData)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if !bytes.Equal(out, newData) {
+		t.Fatal("Reconstructed file mismatch")
+	}
+	if stats.Chunks == 0 || stats.Chunks >= len(m.Chunks)/2 || stats.Reused < int64(len(oldData))*3/4 {
+		t.Errorf("Expected most chunks to be reused: %+v of %d chunks", stats, len(m.Chunks))
+	}
+	if int(*requests) != stats.Chunks {
+		t.Errorf("Chunk requests = %d, want %d", *requests, stats.Chunks)
+	}
+
+	// 没有本地文件时下载全部的块
+	out, stats, err = fetch(t, srv, nil)
+	if err != nil || !bytes.Equal(out, newData) || stats.Reused != 0 {
+		t.Errorf("Full fetch failed: %v %+v", err, stats)
+	}
+}
+
+// TestBuildDeduplicates 测试重复块只存储、下载一次，再次发布时跳过已有的块
+func TestBuildDeduplicates(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	block := make([]byte, 64<<10)
+	r.Read(block)
+	data := bytes.Repeat(block, 4)
+
+	chunks := storage.NewFS(t.TempDir())
+	m, stats, err := zchunk.Build(context.Background(), data, "rep.bin", chunks, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := chunks.List(context.Background(), "")
+	if len(keys) != stats.Uploaded || len(keys) >= len(m.Chunks) {
+		t.Errorf("Expected duplicate chunks to be stored once: %d keys, %d chunks", len(keys), len(m.Chunks))
+	}
+
+	_, again, err := zchunk.Build(context.Background(), data, "rep.bin", chunks, nil)
+	if err != nil || again.Uploaded != 0 || again.Existing != stats.Uploaded {
+		t.Errorf("Rebuild should reuse stored chunks: %+v %v", again, err)
+	}
+
+	out, fstats, err := zchunk.Fetch(context.Background(), m, "", nil, &zchunk.FetchOptions{Storage: chunks})
+	if err != nil || !bytes.Equal(out, data) {
+		t.Fatalf("Fetch from storage failed: %v", err)
+	}
+	if fstats.Chunks != len(keys) {
+		t.Errorf("Downloaded %d chunks, want %d", fstats.Chunks, len(keys))
+	}
+}
+
+// TestCorruptChunk 测试被篡改的块被拒绝
+func TestCorruptChunk(t *testing.T) {
+	data := bytes.Repeat([]byte("corrupt me "), 4096)
+	chunks := storage.NewFS(t.TempDir())
+	m, _, err := zchunk.Build(context.Background(), data, "c.bin", chunks, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 以另一段内容的合法 gzip 数据替换第一个块
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(bytes.ToUpper(data[:m.Chunks[0].Size]))
+	zw.Close()
+	chunks.Put(context.Background(), zchunk.ChunkKey(m.Chunks[0].Hash), buf.Bytes())
+
+	_, _, err = zchunk.Fetch(context.Background(), m, "", nil, &zchunk.FetchOptions{Storage: chunks})
+	if !errors.Is(err, zchunk.ErrChecksum) {
+		t.Fatalf("Expected ErrChecksum, got %v", err)
+	}
+}
+
+// TestReadManifest 测试清单校验与块目录地址解析
+func TestReadManifest(t *testing.T) {
+	m, _, err := zchunk.Build(context.Background(), []byte("hello zchunk"), "h.bin", storage.NewFS(t.TempDir()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	if _, err := zchunk.ReadManifest(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("ReadManifest failed: %v", err)
+	}
+	for name, bad := range map[string]string{
+		"version":     strings.Replace(buf.String(), `"version": 1`, `"version": 9`, 1),
+		"compression": strings.Replace(buf.String(), `"gzip"`, `"zstd"`, 1),
+		"size":        strings.Replace(buf.String(), `"size": 12`, `"size": 13`, 1),
+		"json":        "{",
+	} {
+		if _, err := zchunk.ReadManifest(strings.NewReader(bad)); !errors.Is(err, zchunk.ErrInvalidManifest) {
+			t.Errorf("%s: expected ErrInvalidManifest, got %v", name, err)
+		}
+	}
+
+	for manifest, want := range map[string]string{
+		"https://cdn.example.com/rel/app.zck.json": "https://cdn.example.com/rel/chunks/",
+		"s3://bucket/rel/app.zck.json":             "s3://bucket/rel/chunks/",
+		"dist/app.zck.json":                        "dist/chunks/",
+		"app.zck.json":                             "chunks/",
+	} {
+		if got, _ := m.BaseURL(manifest); got != want {
+			t.Errorf("BaseURL(%s) = %s, want %s", manifest, got, want)
+		}
+	}
+	m.ChunksURL = "https://other.example.com/chunks/"
+	if got, _ := m.BaseURL("https://cdn.example.com/app.zck.json"); got != m.ChunksURL {
+		t.Errorf("Absolute chunks_url should be used as is, got %s", got)
+	}
+}
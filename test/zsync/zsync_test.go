@@ -0,0 +1,176 @@
+package zsync_test
+
+import (
+	"bindiff/pkg/storage"
+	"bindiff/pkg/zsync"
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serve 发布文件与索引，返回服务器与收到的 Range 请求数
+func serve(t *testing.T, data []byte, ranges bool) (*httptest.Server, *int) {
+	t.Helper()
+	idx, err := zsync.BuildIndex(data, "app.bin", "files/app.bin", 1024)
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+	var index bytes.Buffer
+	if _, err := idx.WriteTo(&index); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+
+	requests := new(int)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app.bin.zsync", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(index.Bytes())
+	})
+	mux.HandleFunc("/files/app.bin", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			*requests++
+		}
+		if !ranges {
+			w.Write(data)
+			return
+		}
+		http.ServeContent(w, r, "app.bin", time.Time{}, bytes.NewReader(data))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+// fetch 下载并解析索引，然后重建文件
+func fetch(t *testing.T, srv *httptest.Server, seed []byte) ([]byte, *zsync.Stats, error) {
+	t.Helper()
+	resp, err := http.Get(srv.URL + "/app.bin.zsync")
+	if err != nil {
+		t.Fatalf("GET index failed: %v", err)
+	}
+	defer resp.Body.Close()
+	idx, err := zsync.ReadIndex(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadIndex failed: %v", err)
+	}
+	fileURL, err := idx.FileURL(srv.URL + "/app.bin.zsync")
+	if err != nil {
+		t.Fatalf("FileURL failed: %v", err)
+	}
+	if !strings.HasSuffix(fileURL, "/files/app.bin") {
+		t.Fatalf("Unexpected file URL %s", fileURL)
+	}
+	return zsync.Fetch(context.Background(), idx, fileURL, seed, nil)
+}
+
+// TestFetch 测试只下载本地文件缺少的块
+func TestFetch(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	old := make([]byte, 50_000)
+	rng.Read(old)
+	patch := make([]byte, 300)
+	rng.Read(patch)
+
+	// 新文件：开头插入数据、中间修改一段、末尾截短
+	newData := append(append([]byte{}, patch...), old[:20_000]...)
+	newData = append(newData, patch...)
+	newData = append(newData, old[20_300:49_500]...)
+
+	srv, requests := serve(t, newData, true)
+	got, stats, err := fetch(t, srv, old)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatal("Reconstructed file mismatch")
+	}
+	if stats.Downloaded > 5*1024 || stats.Downloaded+stats.Reused != int64(len(newData)) {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if *requests != stats.Requests || stats.Requests == 0 {
+		t.Errorf("Expected %d range requests, server saw %d", stats.Requests, *requests)
+	}
+
+	// 没有本地文件时下载全部内容
+	got, stats, err = fetch(t, srv, nil)
+	if err != nil || !bytes.Equal(got, newData) {
+		t.Fatalf("Fetch without seed failed: %v", err)
+	}
+	if stats.Requests != 1 || stats.Downloaded != int64(len(newData)) {
+		t.Errorf("Unexpected stats without seed: %+v", stats)
+	}
+}
+
+// TestFetchWithoutRangeSupport 测试服务器忽略 Range 时下载整个文件
+func TestFetchWithoutRangeSupport(t *testing.T) {
+	data := make([]byte, 8000)
+	rand.New(rand.NewSource(2)).Read(data)
+	srv, _ := serve(t, data, false)
+	seed := append([]byte{}, data...)
+	seed[5000] ^= 0xff
+	got, stats, err := fetch(t, srv, seed)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if stats.Downloaded != int64(len(data)) {
+		t.Errorf("Expected full download, got %+v", stats)
+	}
+}
+
+// TestFetchFromStorage 测试从存储后端读取缺失的块
+func TestFetchFromStorage(t *testing.T) {
+	data := make([]byte, 20_000)
+	rand.New(rand.NewSource(3)).Read(data)
+	idx, err := zsync.BuildIndex(data, "app.bin", "app.bin", 1024)
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+	backend := storage.NewFS(t.TempDir())
+	if err := backend.Put(context.Background(), "files/app.bin", data); err != nil {
+		t.Fatal(err)
+	}
+	seed := append([]byte{}, data...)
+	seed[9000] ^= 0xff
+	got, stats, err := zsync.Fetch(context.Background(), idx, "", seed,
+		&zsync.FetchOptions{Storage: backend, Key: "files/app.bin"})
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if stats.Requests != 1 || stats.Downloaded != 1024 {
+		t.Errorf("Expected one block read from storage, got %+v", stats)
+	}
+}
+
+// TestIndexValidation 测试损坏的索引与校验失败
+func TestIndexValidation(t *testing.T) {
+	data := bytes.Repeat([]byte{1, 2, 3}, 5000)
+	idx, err := zsync.BuildIndex(data, "a", "a", 0)
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+	var buf bytes.Buffer
+	idx.WriteTo(&buf)
+	raw := buf.Bytes()
+
+	if _, err := zsync.ReadIndex(bytes.NewReader(raw[:len(raw)-3])); !errors.Is(err, zsync.ErrInvalidIndex) {
+		t.Errorf("Expected ErrInvalidIndex for truncated index, got %v", err)
+	}
+	bad := bytes.Replace(raw, []byte("Length: 15000"), []byte("Length: 99999"), 1)
+	if _, err := zsync.ReadIndex(bytes.NewReader(bad)); !errors.Is(err, zsync.ErrInvalidIndex) {
+		t.Errorf("Expected ErrInvalidIndex for wrong length, got %v", err)
+	}
+
+	// 服务器上的文件与索引不一致
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "a", time.Time{}, bytes.NewReader(make([]byte, len(data))))
+	}))
+	defer srv.Close()
+	if _, _, err := zsync.Fetch(context.Background(), idx, srv.URL, nil, nil); !errors.Is(err, zsync.ErrChecksum) {
+		t.Errorf("Expected ErrChecksum, got %v", err)
+	}
+}
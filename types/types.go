@@ -1,9 +1,12 @@
 package types
 
-
 const (
 	PATCH_MAGIC      = 0x42444646 // 'BDFF' magic number
-	PATCH_VERSION    = 1
+	PATCH_VERSION    = 5
+	PATCH_VERSION_V4 = 4 // 无输出块的 Merkle 树
+	PATCH_VERSION_V3 = 3 // 无整体校验和尾部
+	PATCH_VERSION_V2 = 2 // 无负载格式字段，负载固定为操作序列
+	PATCH_VERSION_V1 = 1 // 无哈希算法字段，固定 SHA256
 	INDEX_FILE       = ".binary_index"
 	BLOCK_SIZE       = 1024
 	MIN_MATCH_LENGTH = 64
@@ -20,17 +23,89 @@ const (
 	OP_DELETE  Operator = 0x05
 )
 
+// FileChangeKind 目录差分中文件的变化类型
+type FileChangeKind uint8
+
+// 文件变化类型
+const (
+	FILE_UNCHANGED FileChangeKind = 0x00
+	FILE_ADDED     FileChangeKind = 0x01
+	FILE_REMOVED   FileChangeKind = 0x02
+	FILE_MODIFIED  FileChangeKind = 0x03
+	FILE_RENAMED   FileChangeKind = 0x04
+)
+
+// FileDiff 目录差分中单个文件的结果，Path 使用 '/' 分隔
+type FileDiff struct {
+	Path string
+	// OldPath FILE_RENAMED 时的原路径，补丁以原文件为基
+	OldPath string
+	Kind    FileChangeKind
+	OldSize int64
+	NewSize int64
+	Patches []Patch
+}
+
+// PatchFormat 补丁负载格式，写入补丁头（version >= 3）
+type PatchFormat uint32
+
+// 补丁负载格式
+const (
+	FORMAT_RAW     PatchFormat = 0x00 // 负载为操作序列（EncodePatch）
+	FORMAT_ARCHIVE PatchFormat = 0x01 // 负载为逐条目的归档补丁（EncodeArchivePatch）
+	FORMAT_GZIP    PatchFormat = 0x02 // 负载为解压后数据的补丁与重新压缩参数（EncodeGzipPatch）
+	FORMAT_SQLITE  PatchFormat = 0x03 // 负载为 SQLite 逐页补丁，编码与归档补丁相同
+	FORMAT_EXEC    PatchFormat = 0x04 // 负载为可执行文件的节映射与逐节补丁（EncodeExecPatch）
+	FORMAT_DISK    PatchFormat = 0x05 // 负载为磁盘镜像逐分区、逐块的补丁，编码与归档补丁相同
+)
+
+// HashAlgorithm 校验哈希算法 ID，写入补丁头
+type HashAlgorithm uint32
+
+// 校验哈希算法
+const (
+	HASH_SHA256   HashAlgorithm = 0x00
+	HASH_BLAKE3   HashAlgorithm = 0x01
+	HASH_XXHASH64 HashAlgorithm = 0x02
+)
+
 // 仓库管理功能
 type IndexEntry struct {
-	Path      string `json:"path"`
-	Size      int    `json:"size"`
-	Hash      string `json:"hash"`
+	Path      string        `json:"path"`
+	Size      int           `json:"size"`
+	Hash      string        `json:"hash"`
+	Timestamp int64         `json:"timestamp"`
+	Versions  []FileVersion `json:"versions,omitempty"`
+}
+
+// 仓库对象类型
+const (
+	OBJECT_FULL    = "full"
+	OBJECT_DELTA   = "delta"
+	OBJECT_CHUNKED = "chunked" // 对象为分块清单，每行一个块对象 ID
+)
+
+// FileVersion 文件的一个历史版本，内容存放在内容寻址的对象中
+type FileVersion struct {
+	Hash      string `json:"hash"` // 文件内容 SHA256（十六进制）
+	Size      int64  `json:"size"`
 	Timestamp int64  `json:"timestamp"`
+	Object    string `json:"object"`         // 存储对象 ID（对象内容的 SHA256）
+	Kind      string `json:"kind"`           // OBJECT_FULL、OBJECT_DELTA 或 OBJECT_CHUNKED
+	Base      string `json:"base,omitempty"` // 增量对象的基版本内容哈希
 }
 
 type RepositoryIndex struct {
-	Version int                   `json:"version"`
-	Files   map[string]IndexEntry `json:"files"`
+	Version  int                   `json:"version"`
+	Files    map[string]IndexEntry `json:"files"`
+	Tags     map[string]Tag        `json:"tags,omitempty"`
+	Channels map[string]string     `json:"channels,omitempty"` // 通道名 -> 标签名
+}
+
+// Tag 仓库状态的命名快照，记录打标签时每个文件的最新版本
+type Tag struct {
+	Timestamp int64             `json:"timestamp"`
+	Files     map[string]string `json:"files"` // 路径 -> 内容哈希
 }
 
 type Patch struct {
@@ -49,6 +124,10 @@ type Patchs struct {
 // +----------------------------------+
 // |            Version Number         | 4 bytes (little-endian)
 // +----------------------------------+
+// |           Hash Algorithm          | 4 bytes (little-endian, version >= 2)
+// +----------------------------------+
+// |           Patch Format            | 4 bytes (little-endian, version >= 3)
+// +----------------------------------+
 // |        Old File Name Length       | 4 bytes (little-endian)
 // +----------------------------------+
 // |         Old File Name             | Variable length
@@ -61,29 +140,49 @@ type Patchs struct {
 // +----------------------------------+
 // |         New File Size             | 4 bytes (little-endian)
 // +----------------------------------+
-// |         Old File SHA256           | 32 bytes
+// |         Old File Hash             | 32 bytes (xxhash64: 8 bytes)
 // +----------------------------------+
-// |         New File SHA256           | 32 bytes
+// |         New File Hash             | 32 bytes (xxhash64: 8 bytes)
 // +----------------------------------+
 // |           Offset Value            | 4 bytes (signed int32, little-endian)
 // +----------------------------------+
+// |        Merkle Block Size          | 4 bytes (little-endian, 0 = no tree, version >= 5)
+// +----------------------------------+
+// |        Merkle Leaves              | ceil(New File Size / block size) hashes (version >= 5)
+// +----------------------------------+
+// |        Merkle Root                | 1 hash (version >= 5, only when block size > 0)
+// +----------------------------------+
 // |        Diff Data Length           | 4 bytes (little-endian)
 // +----------------------------------+
 // |           Diff Data               | Variable length
+// +----------------------------------+
+// |           Checksum                | 4 bytes (CRC32-C of all preceding bytes, little-endian, version >= 4)
+
+// MAX_FILE_SIZE 补丁头 OldSize、NewSize 字段（uint32）能记录的最大文件大小
+const MAX_FILE_SIZE = 1<<32 - 1
 
 type DiffFile struct {
-	MagicNumber uint32
-	Version uint32
+	MagicNumber       uint32
+	Version           uint32
+	HashAlgorithm     HashAlgorithm
+	Format            PatchFormat
 	OldFileNameLength uint32
-	FileName []byte
+	FileName          []byte
 	NewFileNameLength uint32
-	NewFileName []byte
-	OldSize uint32
-	NewSize uint32
-	OldHash []byte
-	NewHash []byte
-	Offset int32
+	NewFileName       []byte
+	OldSize           uint32
+	NewSize           uint32
+	OldHash           []byte
+	NewHash           []byte
+	Offset            int32
+	// MerkleBlockSize 新文件分块校验的块大小，0 表示补丁中没有 Merkle 树
+	MerkleBlockSize uint32
+	// MerkleLeaves 新文件各块的叶子哈希（HashAlgorithm）依次相连
+	MerkleLeaves []byte
+	// MerkleRoot 由叶子计算的根哈希，读取时用于认证叶子
+	MerkleRoot []byte
 	DataLength uint32
-	Diff []Patch
+	Diff       []Patch
+	// Payload Format 不是 FORMAT_RAW 时的原始差分数据，此时 Diff 为空
+	Payload []byte
 }
-